@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+var (
+	flagSet      = flag.NewFlagSet("engmigrate", flag.ExitOnError)
+	dataDir      = flagSet.String("data_dir", "", "the data dir of the partition to migrate, such as data_root/namespace-0")
+	dataRoot     = flagSet.String("data_root", "", "the data root dir of the node, all the partitions under it will be migrated")
+	checkpoint   = flagSet.String("checkpoint", "", "the checkpoint dir to migrate")
+	output       = flagSet.String("output", "", "the output dir of the migrated checkpoint")
+	srcEngine    = flagSet.String("src_engine", "rocksdb", "the engine type of the source data")
+	dstEngine    = flagSet.String("dst_engine", "", "the engine type of the destination data")
+	batch        = flagSet.Int("batch", 1000, "the number of keys written in one batch")
+	force        = flagSet.Bool("force", false, "remove the existing destination data before migrating")
+	removeSource = flagSet.Bool("remove_source", false, "remove the source data after migrated")
+)
+
+func help() {
+	log.Println("Usage:")
+	log.Println("\t", os.Args[0], "-data_dir partition_dir -src_engine rocksdb -dst_engine pebble [-batch 1000] [-force] [-remove_source]")
+	log.Println("\t", os.Args[0], "-data_root node_data_dir -src_engine rocksdb -dst_engine pebble [-batch 1000] [-force] [-remove_source]")
+	log.Println("\t", os.Args[0], "-checkpoint checkpoint_dir -output output_dir -src_engine rocksdb -dst_engine pebble [-batch 1000] [-force]")
+	os.Exit(1)
+}
+
+func checkParameter() {
+	if *srcEngine == "" || *dstEngine == "" {
+		log.Println("Error: must specify the source and destination engine type")
+		help()
+	}
+	if *srcEngine == *dstEngine {
+		log.Println("Error: the source and destination engine type should be different")
+		help()
+	}
+	n := 0
+	for _, d := range []string{*dataDir, *dataRoot, *checkpoint} {
+		if d != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		log.Println("Error: must specify only one of data_dir, data_root and checkpoint")
+		help()
+	}
+	if *checkpoint != "" && *output == "" {
+		log.Println("Error: must specify the output dir for the checkpoint")
+		help()
+	}
+}
+
+func isDirExist(dir string) bool {
+	fi, err := os.Stat(dir)
+	return err == nil && fi.IsDir()
+}
+
+// find all the partition data dirs under the data root, the partition dir should have the
+// source engine data or the checkpoints.
+func getPartitionDirs(root string) ([]string, error) {
+	names, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]string, 0, len(names))
+	for _, fi := range names {
+		if !fi.IsDir() {
+			continue
+		}
+		base := path.Join(root, fi.Name())
+		if isDirExist(path.Join(base, *srcEngine)) || isDirExist(rockredis.GetBackupDir(base)) {
+			dirs = append(dirs, base)
+		}
+	}
+	return dirs, nil
+}
+
+func main() {
+	flagSet.Parse(os.Args[1:])
+	checkParameter()
+
+	logger := common.NewDefaultLogger("engmigrate")
+	rockredis.SetLogger(int32(common.LOG_INFO), logger)
+	engine.SetLogger(int32(common.LOG_INFO), logger)
+
+	opts := rockredis.EngineMigrateOptions{
+		SrcEngine:    *srcEngine,
+		DstEngine:    *dstEngine,
+		BatchNum:     *batch,
+		RockOpts:     engine.RockOptions{},
+		Force:        *force,
+		RemoveSource: *removeSource,
+	}
+	start := time.Now()
+	if *checkpoint != "" {
+		err := rockredis.MigrateCheckpoint(*checkpoint, *output, opts)
+		if err != nil {
+			log.Fatalf("migrate checkpoint %v failed: %v", *checkpoint, err)
+		}
+		log.Printf("migrate checkpoint %v to %v finished, cost: %v", *checkpoint, *output, time.Since(start))
+		return
+	}
+	dirs := []string{*dataDir}
+	if *dataRoot != "" {
+		var err error
+		dirs, err = getPartitionDirs(*dataRoot)
+		if err != nil {
+			log.Fatalf("read data root %v failed: %v", *dataRoot, err)
+		}
+	}
+	for _, d := range dirs {
+		err := rockredis.MigrateEngineData(d, opts)
+		if err != nil {
+			log.Fatalf("migrate %v failed: %v", d, err)
+		}
+	}
+	log.Printf("migrate %v partitions finished, cost: %v", len(dirs), time.Since(start))
+}
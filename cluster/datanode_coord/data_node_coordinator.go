@@ -960,6 +960,8 @@ func (dc *DataCoordinator) prepareNamespaceConf(nsInfo *cluster.PartitionMetaInf
 	if nsInfo.DataVersion != "" {
 		nsConf.DataVersion = nsInfo.DataVersion
 	}
+	nsConf.PartitionKeyVersion = nsInfo.PartitionKeyVersion
+	nsConf.PartitionKeyRegex = nsInfo.PartitionKeyRegex
 	if nsInfo.SnapCount > 100 {
 		nsConf.SnapCount = nsInfo.SnapCount
 		nsConf.SnapCatchup = nsInfo.SnapCount / 4
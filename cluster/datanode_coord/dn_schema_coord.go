@@ -17,12 +17,26 @@ func (dc *DataCoordinator) doSyncSchemaInfo(localNamespace *node.NamespaceNode,
 	for table, tindexes := range indexSchemas {
 		localIndexSchema, err := localNamespace.Node.GetIndexSchema(table)
 		schemaMap := make(map[string]*common.HsetIndexSchema)
+		ftSchemaMap := make(map[string]*common.FullTextIndexSchema)
+		ctSchemaMap := make(map[string]*common.ColumnTableSchema)
+		jsonSchemaMap := make(map[string]*common.JSONIndexSchema)
+		var localTableSchema *common.TableSchema
 		if err == nil {
 			localTableIndexSchema, ok := localIndexSchema[table]
 			if ok {
+				localTableSchema = localTableIndexSchema.TableSchema
 				for _, v := range localTableIndexSchema.HsetIndexes {
 					schemaMap[v.Name] = v
 				}
+				for _, v := range localTableIndexSchema.FullTextIndexes {
+					ftSchemaMap[v.Name] = v
+				}
+				for _, v := range localTableIndexSchema.ColumnTables {
+					ctSchemaMap[v.Name] = v
+				}
+				for _, v := range localTableIndexSchema.JSONIndexes {
+					jsonSchemaMap[v.Name] = v
+				}
 			}
 		}
 		for _, hindex := range tindexes.HsetIndexes {
@@ -33,60 +47,148 @@ func (dc *DataCoordinator) doSyncSchemaInfo(localNamespace *node.NamespaceNode,
 			}
 			sc.SchemaData, _ = json.Marshal(hindex)
 
-			// check if we need propose the updated index state
 			localHIndex, ok := schemaMap[hindex.Name]
-			if !ok {
-				if hindex.State == common.DeletedIndex {
-					continue
-				}
-				if hindex.State != common.InitIndex {
-					cluster.CoordLog().Warningf("namespace %v update index state invalid: %v, local index not init",
-						localNamespace.FullName(), hindex)
-					continue
-				}
-				cluster.CoordLog().Infof("namespace %v init new index : %v, table: %v",
-					localNamespace.FullName(), hindex, table)
-				localNamespace.Node.ProposeChangeTableSchema(table, sc)
-			} else if hindex.State == localHIndex.State {
-			} else {
-				switch hindex.State {
-				case common.BuildingIndex:
-					if localHIndex.State == common.InitIndex {
-						cluster.CoordLog().Infof("namespace %v index start to build : %v, %v",
-							localNamespace.FullName(), hindex, table)
-						sc.Type = node.SchemaChangeUpdateHsetIndex
-						localNamespace.Node.ProposeChangeTableSchema(table, sc)
-					}
-				case common.ReadyIndex:
-					if localHIndex.State == common.BuildDoneIndex {
-						cluster.CoordLog().Infof("namespace %v index ready for read: %v, %v",
-							localNamespace.FullName(), hindex, table)
-						sc.Type = node.SchemaChangeUpdateHsetIndex
-						localNamespace.Node.ProposeChangeTableSchema(table, sc)
-					}
-				case common.InitIndex:
-					// maybe rebuild, wait current done
-					if localHIndex.State == common.BuildDoneIndex ||
-						localHIndex.State == common.ReadyIndex ||
-						localHIndex.State == common.DeletedIndex {
-						cluster.CoordLog().Warningf("namespace %v rebuild index: %v for table %v, local index state: %v",
-							localNamespace.FullName(), hindex, table, localHIndex)
-						sc.Type = node.SchemaChangeUpdateHsetIndex
-						localNamespace.Node.ProposeChangeTableSchema(table, sc)
-					}
-				case common.DeletedIndex:
-					// remove local
-					if localHIndex.State == common.BuildDoneIndex ||
-						localHIndex.State == common.ReadyIndex {
-						sc.Type = node.SchemaChangeDeleteHsetIndex
-						localNamespace.Node.ProposeChangeTableSchema(table, sc)
-					}
-				default:
-				}
+			localState := common.InitIndex
+			if ok {
+				localState = localHIndex.State
+			}
+			syncIndexState(localNamespace, table, hindex, hindex.State, localState, ok, sc,
+				node.SchemaChangeUpdateHsetIndex, node.SchemaChangeDeleteHsetIndex)
+		}
+		for _, ftindex := range tindexes.FullTextIndexes {
+			sc := &node.SchemaChange{
+				Type:       node.SchemaChangeAddFullTextIndex,
+				Table:      table,
+				SchemaData: nil,
 			}
+			sc.SchemaData, _ = json.Marshal(ftindex)
+
+			localFTIndex, ok := ftSchemaMap[ftindex.Name]
+			localState := common.InitIndex
+			if ok {
+				localState = localFTIndex.State
+			}
+			syncIndexState(localNamespace, table, ftindex, ftindex.State, localState, ok, sc,
+				node.SchemaChangeUpdateFullTextIndex, node.SchemaChangeDeleteFullTextIndex)
+		}
+		for _, ct := range tindexes.ColumnTables {
+			sc := &node.SchemaChange{
+				Type:       node.SchemaChangeAddColumnTable,
+				Table:      table,
+				SchemaData: nil,
+			}
+			sc.SchemaData, _ = json.Marshal(ct)
+
+			localCT, ok := ctSchemaMap[ct.Name]
+			localState := common.InitIndex
+			if ok {
+				localState = localCT.State
+			}
+			syncIndexState(localNamespace, table, ct, ct.State, localState, ok, sc,
+				node.SchemaChangeUpdateColumnTable, node.SchemaChangeDeleteColumnTable)
 		}
 		for _, jsonIndex := range tindexes.JSONIndexes {
-			_ = jsonIndex
+			sc := &node.SchemaChange{
+				Type:       node.SchemaChangeAddJSONIndex,
+				Table:      table,
+				SchemaData: nil,
+			}
+			sc.SchemaData, _ = json.Marshal(jsonIndex)
+
+			localJSONIndex, ok := jsonSchemaMap[jsonIndex.Name]
+			localState := common.InitIndex
+			if ok {
+				localState = localJSONIndex.State
+			}
+			syncIndexState(localNamespace, table, jsonIndex, jsonIndex.State, localState, ok, sc,
+				node.SchemaChangeUpdateJSONIndex, node.SchemaChangeDeleteJSONIndex)
+		}
+		syncTableSchema(localNamespace, table, tindexes.TableSchema, localTableSchema)
+	}
+}
+
+// the table schema has no build state, it is synced if the version changed and
+// deleted if it is removed from the register.
+func syncTableSchema(localNamespace *node.NamespaceNode, table string,
+	schema *common.TableSchema, localSchema *common.TableSchema) {
+	sc := &node.SchemaChange{
+		Table: table,
+	}
+	if schema == nil {
+		if localSchema == nil {
+			return
+		}
+		sc.Type = node.SchemaChangeDeleteTableSchema
+	} else {
+		if localSchema != nil && localSchema.Version == schema.Version {
+			return
+		}
+		sc.Type = node.SchemaChangeAddTableSchema
+		if localSchema != nil {
+			sc.Type = node.SchemaChangeUpdateTableSchema
+		}
+		sc.SchemaData, _ = json.Marshal(schema)
+	}
+	cluster.CoordLog().Infof("namespace %v table %v schema changed: %v, %v",
+		localNamespace.FullName(), table, sc.Type, string(sc.SchemaData))
+	localNamespace.Node.ProposeChangeTableSchema(table, sc)
+}
+
+// check if we need propose the updated index state
+func syncIndexState(localNamespace *node.NamespaceNode, table string, index interface{},
+	state common.IndexState, localState common.IndexState, hasLocal bool,
+	sc *node.SchemaChange, updateType node.SchemaChangeType, deleteType node.SchemaChangeType) {
+	if !hasLocal {
+		if state == common.DeletedIndex {
+			return
+		}
+		if state != common.InitIndex {
+			cluster.CoordLog().Warningf("namespace %v update index state invalid: %v, local index not init",
+				localNamespace.FullName(), index)
+			return
+		}
+		cluster.CoordLog().Infof("namespace %v init new index : %v, table: %v",
+			localNamespace.FullName(), index, table)
+		localNamespace.Node.ProposeChangeTableSchema(table, sc)
+		return
+	}
+	if state == localState {
+		return
+	}
+	switch state {
+	case common.BuildingIndex:
+		if localState == common.InitIndex {
+			cluster.CoordLog().Infof("namespace %v index start to build : %v, %v",
+				localNamespace.FullName(), index, table)
+			sc.Type = updateType
+			localNamespace.Node.ProposeChangeTableSchema(table, sc)
+		}
+	case common.ReadyIndex:
+		if localState == common.BuildDoneIndex {
+			cluster.CoordLog().Infof("namespace %v index ready for read: %v, %v",
+				localNamespace.FullName(), index, table)
+			sc.Type = updateType
+			localNamespace.Node.ProposeChangeTableSchema(table, sc)
+		}
+	case common.InitIndex:
+		// maybe rebuild, wait current done
+		if localState == common.BuildDoneIndex ||
+			localState == common.ReadyIndex ||
+			localState == common.DeletedIndex {
+			cluster.CoordLog().Warningf("namespace %v rebuild index: %v for table %v, local index state: %v",
+				localNamespace.FullName(), index, table, localState)
+			sc.Type = updateType
+			localNamespace.Node.ProposeChangeTableSchema(table, sc)
+		}
+	case common.DeletedIndex:
+		// remove local, the building index may be cancelled
+		if localState == common.BuildDoneIndex ||
+			localState == common.ReadyIndex ||
+			localState == common.InitIndex ||
+			localState == common.BuildingIndex {
+			sc.Type = deleteType
+			localNamespace.Node.ProposeChangeTableSchema(table, sc)
 		}
+	default:
 	}
 }
@@ -10,6 +10,12 @@ import (
 	"github.com/youzan/ZanRedisDB/common"
 )
 
+var (
+	ErrEngineMigrateRunning  = errors.New("another node is migrating the engine")
+	ErrEngineMigrateNotReady = errors.New("the namespace partitions on the node are not full ready")
+	ErrNoEngineMigrate       = errors.New("the node is not migrating the engine")
+)
+
 // some API for outside
 func (pdCoord *PDCoordinator) IsClusterStable() bool {
 	return atomic.LoadInt32(&pdCoord.isClusterUnstable) == 0 &&
@@ -78,6 +84,104 @@ func (pdCoord *PDCoordinator) SetClusterUpgradeState(upgrading bool) error {
 	return nil
 }
 
+// check all the partitions which have the replica on the node are full ready, if checkReplicas is true,
+// the partitions should also have other replicas to serve while the node is stopped.
+func (pdCoord *PDCoordinator) isNodePartitionsFullReady(nid string, checkReplicas bool) (bool, error) {
+	allNamespaces, _, err := pdCoord.register.GetAllNamespaces()
+	if err != nil {
+		return false, err
+	}
+	for _, parts := range allNamespaces {
+		for _, nsInfo := range parts {
+			if cluster.FindSlice(nsInfo.RaftNodes, nid) == -1 {
+				continue
+			}
+			if checkReplicas && len(nsInfo.GetISR()) <= 1 {
+				cluster.CoordLog().Infof("namespace %v has no other replicas: %v", nsInfo.GetDesp(), nsInfo.RaftNodes)
+				return false, nil
+			}
+			ok, err := IsAllISRFullReady(&nsInfo)
+			if err != nil || !ok {
+				cluster.CoordLog().Infof("namespace %v isr is not full ready: %v", nsInfo.GetDesp(), err)
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// BeginEngineMigrate marks the data node as migrating the storage engine, the node can be stopped
+// to convert the data offline after this. Only one node is allowed to migrate at the same time and
+// the partitions will not be moved from the stopped node until the migration is done.
+func (pdCoord *PDCoordinator) BeginEngineMigrate(nid string) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while begin engine migrate")
+		return ErrNotLeader
+	}
+	pdCoord.engineMigrateMutex.Lock()
+	defer pdCoord.engineMigrateMutex.Unlock()
+	if pdCoord.engineMigratingNode != "" {
+		if pdCoord.engineMigratingNode == nid {
+			return nil
+		}
+		return ErrEngineMigrateRunning
+	}
+	if _, ok := pdCoord.getCurrentNodes(nil)[nid]; !ok {
+		return ErrNodeNotFound.ToErrorType()
+	}
+	if atomic.LoadInt32(&pdCoord.isClusterUnstable) == 1 {
+		return ErrClusterUnstable
+	}
+	ok, err := pdCoord.isNodePartitionsFullReady(nid, true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrEngineMigrateNotReady
+	}
+	if !atomic.CompareAndSwapInt32(&pdCoord.isUpgrading, 0, 1) {
+		return ErrClusterUnstable
+	}
+	pdCoord.engineMigratingNode = nid
+	cluster.CoordLog().Infof("node %v begin migrating the engine", nid)
+	return nil
+}
+
+// FinishEngineMigrate should be called after the node restarted with the new engine, it will fail
+// until the node is back and all the partitions on it catch up with the others.
+func (pdCoord *PDCoordinator) FinishEngineMigrate(nid string) error {
+	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
+		cluster.CoordLog().Infof("not leader while finish engine migrate")
+		return ErrNotLeader
+	}
+	pdCoord.engineMigrateMutex.Lock()
+	defer pdCoord.engineMigrateMutex.Unlock()
+	if pdCoord.engineMigratingNode != nid {
+		return ErrNoEngineMigrate
+	}
+	if _, ok := pdCoord.getCurrentNodes(nil)[nid]; !ok {
+		return ErrNodeNotFound.ToErrorType()
+	}
+	ok, err := pdCoord.isNodePartitionsFullReady(nid, false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrEngineMigrateNotReady
+	}
+	pdCoord.engineMigratingNode = ""
+	atomic.StoreInt32(&pdCoord.isUpgrading, 0)
+	cluster.CoordLog().Infof("node %v finished migrating the engine", nid)
+	pdCoord.triggerCheckNamespaces("", 0, time.Second)
+	return nil
+}
+
+func (pdCoord *PDCoordinator) GetEngineMigratingNode() string {
+	pdCoord.engineMigrateMutex.Lock()
+	defer pdCoord.engineMigrateMutex.Unlock()
+	return pdCoord.engineMigratingNode
+}
+
 func (pdCoord *PDCoordinator) RemoveNamespaceFromNode(ns string, pidStr string, nid string) error {
 	if pdCoord.leaderNode.GetID() != pdCoord.myNode.GetID() {
 		cluster.CoordLog().Infof("not leader while delete namespace")
@@ -324,6 +428,57 @@ func (pdCoord *PDCoordinator) DelHIndexSchema(namespace string, table string, hi
 	return pdCoord.delHIndexSchema(namespace, table, hindexName)
 }
 
+func (pdCoord *PDCoordinator) CancelHIndexBuild(namespace string, table string, hindexName string) error {
+	return pdCoord.cancelHIndexBuild(namespace, table, hindexName)
+}
+
+func (pdCoord *PDCoordinator) GetIndexJobs(namespace string, table string) ([]common.IndexJobProgress, error) {
+	return pdCoord.getIndexJobs(namespace, table)
+}
+
+func (pdCoord *PDCoordinator) SetIndexJobThrottle(namespace string, rate int64, paused bool) error {
+	return pdCoord.setIndexJobThrottle(namespace, rate, paused)
+}
+
+func (pdCoord *PDCoordinator) VerifyHIndex(namespace string, table string, hindexName string, repair bool) error {
+	return pdCoord.verifyHIndex(namespace, table, hindexName, repair)
+}
+
+func (pdCoord *PDCoordinator) AddJSONIndexSchema(namespace string, table string, jindex *common.JSONIndexSchema) error {
+	jindex.State = common.InitIndex
+	return pdCoord.addJSONIndexSchema(namespace, table, jindex)
+}
+
+func (pdCoord *PDCoordinator) DelJSONIndexSchema(namespace string, table string, name string) error {
+	return pdCoord.delJSONIndexSchema(namespace, table, name)
+}
+
+func (pdCoord *PDCoordinator) AddFullTextIndexSchema(namespace string, table string, ftindex *common.FullTextIndexSchema) error {
+	ftindex.State = common.InitIndex
+	return pdCoord.addFullTextIndexSchema(namespace, table, ftindex)
+}
+
+func (pdCoord *PDCoordinator) DelFullTextIndexSchema(namespace string, table string, name string) error {
+	return pdCoord.delFullTextIndexSchema(namespace, table, name)
+}
+
+func (pdCoord *PDCoordinator) AddColumnTableSchema(namespace string, table string, ct *common.ColumnTableSchema) error {
+	ct.State = common.InitIndex
+	return pdCoord.addColumnTableSchema(namespace, table, ct)
+}
+
+func (pdCoord *PDCoordinator) DelColumnTableSchema(namespace string, table string, name string) error {
+	return pdCoord.delColumnTableSchema(namespace, table, name)
+}
+
+func (pdCoord *PDCoordinator) SetTableSchema(namespace string, table string, ts *common.TableSchema) error {
+	return pdCoord.setTableSchema(namespace, table, ts)
+}
+
+func (pdCoord *PDCoordinator) DelTableSchema(namespace string, table string) error {
+	return pdCoord.delTableSchema(namespace, table)
+}
+
 func (pdCoord *PDCoordinator) RemoveLearnerFromNs(ns string, pidStr string, nid string) error {
 	if pidStr == "**" {
 		oldMeta, err := pdCoord.register.GetNamespaceMetaInfo(ns)
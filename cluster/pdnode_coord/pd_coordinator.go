@@ -66,6 +66,8 @@ type PDCoordinator struct {
 	monitorChan            chan struct{}
 	isClusterUnstable      int32
 	isUpgrading            int32
+	engineMigrateMutex     sync.Mutex
+	engineMigratingNode    string
 	dpm                    *DataPlacement
 	doChecking             int32
 	autoBalance            int32
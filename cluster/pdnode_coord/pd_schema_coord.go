@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"net"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/youzan/ZanRedisDB/cluster"
@@ -11,7 +13,8 @@ import (
 )
 
 var (
-	ErrInvalidSchema = errors.New("invalid schema info")
+	ErrInvalidSchema     = errors.New("invalid schema info")
+	ErrGlobalUniqueIndex = errors.New("the global unique index across partitions is not implemented yet, use the partition unique index")
 )
 
 func getIndexSchemasFromDataNode(remoteNode string, ns string) (map[string]*common.IndexSchema, error) {
@@ -28,6 +31,135 @@ func getIndexSchemasFromDataNode(remoteNode string, ns string) (map[string]*comm
 	return rsp, nil
 }
 
+// request the api on all the replicas of all the partitions, the path of the
+// api is built from the namespace partition name.
+func (pdCoord *PDCoordinator) requestAllPartsDataNodes(ns string, method string, apiPath func(string) string,
+	handle func(node string, ret []common.IndexJobProgress)) error {
+	parts, err := pdCoord.register.GetNamespaceInfo(ns)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		for _, remoteNode := range part.RaftNodes {
+			nip, _, _, httpPort := cluster.ExtractNodeInfoFromID(remoteNode)
+			endpoint := "http://" + net.JoinHostPort(nip, httpPort) + apiPath(common.GetNsDesp(ns, part.Partition))
+			var rsp []common.IndexJobProgress
+			var ret interface{}
+			if handle != nil {
+				ret = &rsp
+			}
+			_, err := common.APIRequest(method, endpoint, nil, time.Second*3, ret)
+			if err != nil {
+				cluster.CoordLog().Infof("failed (%v) to request %v for namespace %v-%v : %v",
+					nip, endpoint, ns, part.Partition, err)
+				return err
+			}
+			if handle != nil {
+				handle(remoteNode, rsp)
+			}
+		}
+	}
+	return nil
+}
+
+func (pdCoord *PDCoordinator) getIndexJobs(ns string, table string) ([]common.IndexJobProgress, error) {
+	jobs := make([]common.IndexJobProgress, 0)
+	err := pdCoord.requestAllPartsDataNodes(ns, "GET", func(nsPart string) string {
+		return common.APIIndexJobs + "/" + nsPart
+	}, func(node string, ret []common.IndexJobProgress) {
+		for _, j := range ret {
+			if table != "" && j.Table != table {
+				continue
+			}
+			j.Node = node
+			jobs = append(jobs, j)
+		}
+	})
+	return jobs, err
+}
+
+func (pdCoord *PDCoordinator) setIndexJobThrottle(ns string, rate int64, paused bool) error {
+	query := url.Values{}
+	query.Set("rate", strconv.FormatInt(rate, 10))
+	query.Set("pause", strconv.FormatBool(paused))
+	return pdCoord.requestAllPartsDataNodes(ns, "POST", func(nsPart string) string {
+		return common.APIIndexBuildThrottle + "/" + nsPart + "?" + query.Encode()
+	}, nil)
+}
+
+func (pdCoord *PDCoordinator) verifyHIndex(ns string, table string, name string, repair bool) error {
+	query := url.Values{}
+	query.Set("repair", strconv.FormatBool(repair))
+	return pdCoord.requestAllPartsDataNodes(ns, "POST", func(nsPart string) string {
+		return common.APIIndexVerify + "/" + nsPart + "/" + url.PathEscape(table) + "/" +
+			url.PathEscape(name) + "?" + query.Encode()
+	}, nil)
+}
+
+// cancel the building hash index by marking it as deleted, the data nodes
+// will stop the build and clean the built index data.
+func (pdCoord *PDCoordinator) cancelHIndexBuild(ns string, table string, hindexName string) error {
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		return err
+	}
+	newSchema.Epoch = schema.Epoch
+	err = json.Unmarshal(schema.Schema, &indexes)
+	if err != nil {
+		cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+		return err
+	}
+	found := false
+	for _, hi := range indexes.HsetIndexes {
+		if hi.Name == hindexName {
+			if hi.State != common.InitIndex && hi.State != common.BuildingIndex {
+				return errors.New("index is not building")
+			}
+			cluster.CoordLog().Infof("namespace %v table %v index schema build cancelled: %v", ns, table, hi)
+			hi.State = common.DeletedIndex
+			found = true
+		}
+	}
+	if !found {
+		return errors.New("index not found")
+	}
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
+
+// the index name is unique in the table for all the index types
+func getIndexSchemaState(s *common.IndexSchema, name string) (common.IndexState, bool) {
+	for _, partIndex := range s.HsetIndexes {
+		if partIndex.Name == name {
+			return partIndex.State, true
+		}
+	}
+	for _, partIndex := range s.JSONIndexes {
+		if partIndex.Name == name {
+			return partIndex.State, true
+		}
+	}
+	for _, partIndex := range s.FullTextIndexes {
+		if partIndex.Name == name {
+			return partIndex.State, true
+		}
+	}
+	for _, partIndex := range s.ColumnTables {
+		if partIndex.Name == name {
+			return partIndex.State, true
+		}
+	}
+	return common.InitIndex, false
+}
+
+func isIndexNameExist(indexes *common.IndexSchema, name string) bool {
+	_, ok := getIndexSchemaState(indexes, name)
+	return ok
+}
+
 func isAllPartsIndexSchemaReady(allPartsSchema map[int]map[string]*common.IndexSchema, table string,
 	name string, expectedState common.IndexState) bool {
 	allDone := true
@@ -37,16 +169,8 @@ func isAllPartsIndexSchemaReady(allPartsSchema map[int]map[string]*common.IndexS
 			allDone = false
 			break
 		}
-		isSame := false
-		for _, partIndex := range s.HsetIndexes {
-			if partIndex.Name == name {
-				if partIndex.State == expectedState {
-					isSame = true
-				}
-				break
-			}
-		}
-		if !isSame {
+		state, ok := getIndexSchemaState(s, name)
+		if !ok || state != expectedState {
 			allDone = false
 			break
 		}
@@ -100,28 +224,24 @@ func (pdCoord *PDCoordinator) doSchemaCheck() {
 			schemaChanged := false
 			newSchemaInfo := schemaInfo
 			for _, hindex := range indexes.HsetIndexes {
-				switch hindex.State {
-				case common.InitIndex:
-					// wait all partitions to begin init index, and then change the state to building
-					if isAllPartsIndexSchemaReady(allPartsSchema, table, hindex.Name, common.InitIndex) {
-						schemaChanged = true
-						hindex.State = common.BuildingIndex
-					}
-					go pdCoord.triggerCheckNamespaces(ns, -1, time.Second)
-				case common.BuildingIndex:
-					// wait all partitions to finish building index, and then change the state to ready
-					if isAllPartsIndexSchemaReady(allPartsSchema, table, hindex.Name, common.BuildDoneIndex) {
-						schemaChanged = true
-						hindex.State = common.ReadyIndex
-						cluster.CoordLog().Infof("namespace %v table %v schema info ready: %v", ns, table, hindex)
-					} else {
-						go pdCoord.triggerCheckNamespaces(ns, -1, time.Second*3)
-					}
-				default:
+				if pdCoord.checkIndexStateChange(ns, table, allPartsSchema, hindex.Name, &hindex.State) {
+					schemaChanged = true
+				}
+			}
+			for _, ftindex := range indexes.FullTextIndexes {
+				if pdCoord.checkIndexStateChange(ns, table, allPartsSchema, ftindex.Name, &ftindex.State) {
+					schemaChanged = true
+				}
+			}
+			for _, ct := range indexes.ColumnTables {
+				if pdCoord.checkIndexStateChange(ns, table, allPartsSchema, ct.Name, &ct.State) {
+					schemaChanged = true
 				}
 			}
 			for _, jsonIndex := range indexes.JSONIndexes {
-				_ = jsonIndex
+				if pdCoord.checkIndexStateChange(ns, table, allPartsSchema, jsonIndex.Name, &jsonIndex.State) {
+					schemaChanged = true
+				}
 			}
 
 			if schemaChanged {
@@ -136,7 +256,37 @@ func (pdCoord *PDCoordinator) doSchemaCheck() {
 	}
 }
 
+// check and change the index state if all the partitions are ready for the next state
+func (pdCoord *PDCoordinator) checkIndexStateChange(ns string, table string,
+	allPartsSchema map[int]map[string]*common.IndexSchema, name string, state *common.IndexState) bool {
+	switch *state {
+	case common.InitIndex:
+		// wait all partitions to begin init index, and then change the state to building
+		go pdCoord.triggerCheckNamespaces(ns, -1, time.Second)
+		if isAllPartsIndexSchemaReady(allPartsSchema, table, name, common.InitIndex) {
+			*state = common.BuildingIndex
+			return true
+		}
+	case common.BuildingIndex:
+		// wait all partitions to finish building index, and then change the state to ready
+		if isAllPartsIndexSchemaReady(allPartsSchema, table, name, common.BuildDoneIndex) {
+			*state = common.ReadyIndex
+			cluster.CoordLog().Infof("namespace %v table %v index %v schema info ready", ns, table, name)
+			return true
+		}
+		go pdCoord.triggerCheckNamespaces(ns, -1, time.Second*3)
+	default:
+	}
+	return false
+}
+
 func (pdCoord *PDCoordinator) addHIndexSchema(ns string, table string, hindex *common.HsetIndexSchema) error {
+	if hindex.IsComposite() && hindex.IndexField == "" {
+		hindex.IndexField = hindex.CompositeIndexField()
+	}
+	if hindex.Unique == common.GlobalUniqueIndex {
+		return ErrGlobalUniqueIndex
+	}
 	if !hindex.IsValidNewSchema() {
 		return ErrInvalidSchema
 	}
@@ -158,10 +308,8 @@ func (pdCoord *PDCoordinator) addHIndexSchema(ns string, table string, hindex *c
 		}
 	}
 
-	for _, hi := range indexes.HsetIndexes {
-		if hi.Name == hindex.Name {
-			return errors.New("index already exist")
-		}
+	if isIndexNameExist(&indexes, hindex.Name) {
+		return errors.New("index already exist")
 	}
 	indexes.HsetIndexes = append(indexes.HsetIndexes, hindex)
 	newSchema.Schema, _ = json.Marshal(indexes)
@@ -195,3 +343,251 @@ func (pdCoord *PDCoordinator) delHIndexSchema(ns string, table string, hindexNam
 	newSchema.Schema, _ = json.Marshal(indexes)
 	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
 }
+
+func (pdCoord *PDCoordinator) addJSONIndexSchema(ns string, table string, jindex *common.JSONIndexSchema) error {
+	if !jindex.IsValidNewSchema() {
+		return ErrInvalidSchema
+	}
+	jindex.Path = common.NormalizeJSONIndexPath(jindex.Path)
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		if err != cluster.ErrKeyNotFound {
+			return err
+		}
+		newSchema.Epoch = 0
+	} else {
+		newSchema.Epoch = schema.Epoch
+		err := json.Unmarshal(schema.Schema, &indexes)
+		if err != nil {
+			cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+			return err
+		}
+	}
+
+	if isIndexNameExist(&indexes, jindex.Name) {
+		return errors.New("index already exist")
+	}
+	for _, ji := range indexes.JSONIndexes {
+		if common.NormalizeJSONIndexPath(ji.Path) == jindex.Path && ji.State != common.DeletedIndex {
+			return errors.New("json path already indexed")
+		}
+	}
+	indexes.JSONIndexes = append(indexes.JSONIndexes, jindex)
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
+
+func (pdCoord *PDCoordinator) delJSONIndexSchema(ns string, table string, name string) error {
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		return err
+	}
+	newSchema.Epoch = schema.Epoch
+	err = json.Unmarshal(schema.Schema, &indexes)
+	if err != nil {
+		cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+		return err
+	}
+	for _, ji := range indexes.JSONIndexes {
+		if ji.Name == name {
+			if ji.State != common.ReadyIndex {
+				cluster.CoordLog().Infof("namespace %v table %v json index schema not ready: %v", ns, table, ji)
+				return errors.New("Unready index can not be deleted")
+			}
+			cluster.CoordLog().Infof("namespace %v table %v json index schema deleted: %v", ns, table, ji)
+			ji.State = common.DeletedIndex
+		}
+	}
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
+
+func (pdCoord *PDCoordinator) addFullTextIndexSchema(ns string, table string, ftindex *common.FullTextIndexSchema) error {
+	if !ftindex.IsValidNewSchema() {
+		return ErrInvalidSchema
+	}
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		if err != cluster.ErrKeyNotFound {
+			return err
+		}
+		newSchema.Epoch = 0
+	} else {
+		newSchema.Epoch = schema.Epoch
+		err := json.Unmarshal(schema.Schema, &indexes)
+		if err != nil {
+			cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+			return err
+		}
+	}
+
+	if isIndexNameExist(&indexes, ftindex.Name) {
+		return errors.New("index already exist")
+	}
+	// only one full text index is allowed for each table
+	for _, fi := range indexes.FullTextIndexes {
+		if fi.State != common.DeletedIndex {
+			return errors.New("full text index already exist for table")
+		}
+	}
+	indexes.FullTextIndexes = append(indexes.FullTextIndexes, ftindex)
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
+
+func (pdCoord *PDCoordinator) delFullTextIndexSchema(ns string, table string, name string) error {
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		return err
+	}
+	newSchema.Epoch = schema.Epoch
+	err = json.Unmarshal(schema.Schema, &indexes)
+	if err != nil {
+		cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+		return err
+	}
+	for _, fi := range indexes.FullTextIndexes {
+		if fi.Name == name {
+			if fi.State != common.ReadyIndex {
+				cluster.CoordLog().Infof("namespace %v table %v full text index schema not ready: %v", ns, table, fi)
+				return errors.New("Unready index can not be deleted")
+			}
+			cluster.CoordLog().Infof("namespace %v table %v full text index schema deleted: %v", ns, table, fi)
+			fi.State = common.DeletedIndex
+		}
+	}
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
+
+func (pdCoord *PDCoordinator) addColumnTableSchema(ns string, table string, ct *common.ColumnTableSchema) error {
+	if !ct.IsValidNewSchema() {
+		return ErrInvalidSchema
+	}
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		if err != cluster.ErrKeyNotFound {
+			return err
+		}
+		newSchema.Epoch = 0
+	} else {
+		newSchema.Epoch = schema.Epoch
+		err := json.Unmarshal(schema.Schema, &indexes)
+		if err != nil {
+			cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+			return err
+		}
+	}
+
+	if isIndexNameExist(&indexes, ct.Name) {
+		return errors.New("index already exist")
+	}
+	// only one columnar table is allowed for each table
+	for _, c := range indexes.ColumnTables {
+		if c.State != common.DeletedIndex {
+			return errors.New("column table already exist for table")
+		}
+	}
+	indexes.ColumnTables = append(indexes.ColumnTables, ct)
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
+
+func (pdCoord *PDCoordinator) delColumnTableSchema(ns string, table string, name string) error {
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		return err
+	}
+	newSchema.Epoch = schema.Epoch
+	err = json.Unmarshal(schema.Schema, &indexes)
+	if err != nil {
+		cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+		return err
+	}
+	for _, c := range indexes.ColumnTables {
+		if c.Name == name {
+			if c.State != common.ReadyIndex {
+				cluster.CoordLog().Infof("namespace %v table %v column table schema not ready: %v", ns, table, c)
+				return errors.New("Unready index can not be deleted")
+			}
+			cluster.CoordLog().Infof("namespace %v table %v column table schema deleted: %v", ns, table, c)
+			c.State = common.DeletedIndex
+		}
+	}
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
+
+// set the declared fields of the table, the version of the schema will be increased
+// for each change to sync the schema to all the partitions.
+func (pdCoord *PDCoordinator) setTableSchema(ns string, table string, ts *common.TableSchema) error {
+	if !ts.IsValidNewSchema() {
+		return ErrInvalidSchema
+	}
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		if err != cluster.ErrKeyNotFound {
+			return err
+		}
+		newSchema.Epoch = 0
+	} else {
+		newSchema.Epoch = schema.Epoch
+		err := json.Unmarshal(schema.Schema, &indexes)
+		if err != nil {
+			cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+			return err
+		}
+	}
+	ts.Version = 1
+	if indexes.TableSchema != nil {
+		ts.Version = indexes.TableSchema.Version + 1
+	}
+	indexes.TableSchema = ts
+	cluster.CoordLog().Infof("namespace %v table %v schema changed: %v", ns, table, ts)
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
+
+func (pdCoord *PDCoordinator) delTableSchema(ns string, table string) error {
+	var indexes common.IndexSchema
+	var newSchema cluster.SchemaInfo
+
+	schema, err := pdCoord.register.GetNamespaceTableSchema(ns, table)
+	if err != nil {
+		return err
+	}
+	newSchema.Epoch = schema.Epoch
+	err = json.Unmarshal(schema.Schema, &indexes)
+	if err != nil {
+		cluster.CoordLog().Infof("unmarshal schema data failed: %v", err)
+		return err
+	}
+	if indexes.TableSchema == nil {
+		return errors.New("table schema not found")
+	}
+	cluster.CoordLog().Infof("namespace %v table %v schema deleted: %v", ns, table, indexes.TableSchema)
+	indexes.TableSchema = nil
+	newSchema.Schema, _ = json.Marshal(indexes)
+	return pdCoord.register.UpdateNamespaceSchema(ns, table, &newSchema)
+}
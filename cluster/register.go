@@ -63,6 +63,10 @@ type NamespaceMetaInfo struct {
 	Tags             map[string]interface{}
 	ExpirationPolicy string
 	DataVersion      string
+	// the partition key version and the regex for the custom partition key,
+	// can not be changed after the namespace created
+	PartitionKeyVersion string
+	PartitionKeyRegex   string
 }
 
 func (self *NamespaceMetaInfo) MetaEpoch() EpochType {
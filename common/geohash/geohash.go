@@ -26,6 +26,7 @@ var (
 var (
 	ErrPositionOutOfRange = errors.New("position out of range of WGS84")
 	ErrStepOutOfRange     = errors.New("geohash encode step must less-equal than 32 and greater than 0")
+	ErrInvalidPolygon     = errors.New("polygon need at least 3 points")
 )
 
 func EncodeWGS84(longitude, latitude float64) (uint64, error) {
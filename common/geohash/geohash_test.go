@@ -121,3 +121,40 @@ func TestDistance(t *testing.T) {
 	}
 
 }
+
+func TestShapeContains(t *testing.T) {
+	lon, lat := 116.39763057232, 39.905637761392
+	// The Palace Museum
+	dist, ok := GetDistanceIfInRectangle(1000, 3000, lon, lat, 116.39715582132, 39.916345328893)
+	if !ok || math.Abs(dist-1191.8406) > 0.5 {
+		t.Fatalf("the point should be in rectangle with distance %v", dist)
+	}
+	if _, ok := GetDistanceIfInRectangle(1000, 1000, lon, lat, 116.39715582132, 39.916345328893); ok {
+		t.Fatal("the point should not be in rectangle")
+	}
+
+	polygon := []Point{{0, 0}, {10, 0}, {10, 10}, {5, 5}, {0, 10}}
+	inside := []Point{{1, 1}, {9, 8}, {5, 4}, {1, 8}}
+	outside := []Point{{5, 6}, {-1, 1}, {11, 5}, {5, 11}, {5, -1}}
+	for _, p := range inside {
+		if !PointInPolygon(polygon, p.Longitude, p.Latitude) {
+			t.Fatalf("%v should be inside the polygon", p)
+		}
+	}
+	for _, p := range outside {
+		if PointInPolygon(polygon, p.Longitude, p.Latitude) {
+			t.Fatalf("%v should be outside the polygon", p)
+		}
+	}
+
+	area, center, err := GetAreasByPolygonWGS84(polygon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if center.Longitude != 5 || center.Latitude != 5 || area.Hash.IsZero() {
+		t.Fatalf("polygon area center wrong: %v", center)
+	}
+	if _, _, err := GetAreasByPolygonWGS84(polygon[:2]); err != ErrInvalidPolygon {
+		t.Fatalf("should return invalid polygon error: %v", err)
+	}
+}
@@ -353,3 +353,75 @@ func moveY(hash *HashBits, d int8) *HashBits {
 	hash.Bits = (x | y)
 	return hash
 }
+
+/* Return the distance if the point (lon1d, lat1d) is inside the rectangle
+ * with the center (lon0d, lat0d) and the given width and height in meters,
+ * otherwise false will be returned. */
+func GetDistanceIfInRectangle(width, height, lon0d, lat0d, lon1d, lat1d float64) (float64, bool) {
+	latDistance := EARTH_RADIUS_IN_METERS * math.Abs(degRad(lat1d)-degRad(lat0d))
+	if latDistance > height/2 {
+		return 0, false
+	}
+	lonDistance := GetDistance(lon1d, lat1d, lon0d, lat1d)
+	if lonDistance > width/2 {
+		return 0, false
+	}
+	return GetDistance(lon0d, lat0d, lon1d, lat1d), true
+}
+
+func GetAreasByBoxWGS84(longitude, latitude, width, height float64) (*Radius, error) {
+	/* The circle with the half diagonal as radius will cover the whole box,
+	 * the points outside the box will be filtered while searching. */
+	radius := math.Sqrt((width/2)*(width/2) + (height/2)*(height/2))
+	return GetAreasByRadiusWGS84(longitude, latitude, radius)
+}
+
+/* Get the areas which cover the polygon, the center of the polygon bounding box
+ * is returned. The polygon edges are treated as straight lines in longitude and
+ * latitude, so the polygon should not cross the 180th meridian. */
+func GetAreasByPolygonWGS84(polygon []Point) (*Radius, *Point, error) {
+	if len(polygon) < 3 {
+		return nil, nil, ErrInvalidPolygon
+	}
+	minLon, maxLon := polygon[0].Longitude, polygon[0].Longitude
+	minLat, maxLat := polygon[0].Latitude, polygon[0].Latitude
+	for _, p := range polygon[1:] {
+		minLon = math.Min(minLon, p.Longitude)
+		maxLon = math.Max(maxLon, p.Longitude)
+		minLat = math.Min(minLat, p.Latitude)
+		maxLat = math.Max(maxLat, p.Latitude)
+	}
+	center := &Point{
+		Longitude: (minLon + maxLon) / 2,
+		Latitude:  (minLat + maxLat) / 2,
+	}
+	var radius float64
+	for _, p := range polygon {
+		d := GetDistance(center.Longitude, center.Latitude, p.Longitude, p.Latitude)
+		if d > radius {
+			radius = d
+		}
+	}
+	area, err := GetAreasByRadiusWGS84(center.Longitude, center.Latitude, radius)
+	if err != nil {
+		return nil, nil, err
+	}
+	return area, center, nil
+}
+
+/* Check if the point is inside the polygon using the ray casting algorithm,
+ * the point on the edge may be treated as either inside or outside. */
+func PointInPolygon(polygon []Point, longitude, latitude float64) bool {
+	inside := false
+	j := len(polygon) - 1
+	for i := 0; i < len(polygon); i++ {
+		pi, pj := polygon[i], polygon[j]
+		if (pi.Latitude > latitude) != (pj.Latitude > latitude) &&
+			longitude < (pj.Longitude-pi.Longitude)*(latitude-pi.Latitude)/
+				(pj.Latitude-pi.Latitude)+pi.Longitude {
+			inside = !inside
+		}
+		j = i
+	}
+	return inside
+}
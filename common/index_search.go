@@ -0,0 +1,247 @@
+package common
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+var (
+	ErrInvalidIndexCursor = errors.New("invalid index search cursor")
+)
+
+// the cursor for the first page and the cursor returned after the last page
+const IndexSearchCursorStart = "0"
+
+// IndexSearchPos is the last index position returned from a partition, the int value
+// is used for the number index and the value is used for the string index.
+type IndexSearchPos struct {
+	PKey     []byte `json:"pk"`
+	IntValue int64  `json:"iv,omitempty"`
+	Value    []byte `json:"v,omitempty"`
+}
+
+// IndexSearchCursor is the continuation of the ordered index search, each partition will
+// continue the scan after the position of the partition in the cursor.
+type IndexSearchCursor struct {
+	OrderField string                 `json:"f"`
+	Desc       bool                   `json:"d,omitempty"`
+	Positions  map[int]IndexSearchPos `json:"p,omitempty"`
+}
+
+func (c *IndexSearchCursor) Encode() string {
+	if len(c.Positions) == 0 {
+		return IndexSearchCursorStart
+	}
+	d, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(d)
+}
+
+func DecodeIndexSearchCursor(data []byte) (*IndexSearchCursor, error) {
+	var c IndexSearchCursor
+	if string(data) == IndexSearchCursorStart {
+		return &c, nil
+	}
+	d, err := base64.RawURLEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, ErrInvalidIndexCursor
+	}
+	err = json.Unmarshal(d, &c)
+	if err != nil {
+		return nil, ErrInvalidIndexCursor
+	}
+	return &c, nil
+}
+
+// IndexSearchOptions is the options after the where clause of the index search,
+// [ORDER BY field [ASC|DESC]] [LIMIT offset num] [CURSOR cursor] [post command]
+// or AGG FUNC field [FUNC field ...] for the aggregation.
+type IndexSearchOptions struct {
+	OrderField []byte
+	Desc       bool
+	Offset     int
+	// -1 if no limit
+	Limit int
+	// the position of the LIMIT in the args, -1 if no limit
+	LimitArgIndex int
+	// nil if no cursor
+	Cursor *IndexSearchCursor
+	// the args of the aggregation functions after AGG
+	AggArgs  [][]byte
+	PostArgs [][]byte
+}
+
+func ParseIndexSearchOptions(args [][]byte) (*IndexSearchOptions, error) {
+	opts := &IndexSearchOptions{Limit: -1, LimitArgIndex: -1}
+	hasLimit := false
+	i := 0
+	for i < len(args) {
+		switch string(bytes.ToLower(args[i])) {
+		case "order":
+			if opts.OrderField != nil || i+2 >= len(args) || string(bytes.ToLower(args[i+1])) != "by" ||
+				len(args[i+2]) == 0 {
+				return nil, ErrInvalidArgs
+			}
+			opts.OrderField = args[i+2]
+			i += 3
+			if i < len(args) {
+				switch string(bytes.ToLower(args[i])) {
+				case "asc":
+					i++
+				case "desc":
+					opts.Desc = true
+					i++
+				}
+			}
+		case "limit":
+			if hasLimit || i+2 >= len(args) {
+				return nil, ErrInvalidArgs
+			}
+			var err error
+			if opts.Offset, err = strconv.Atoi(string(args[i+1])); err != nil || opts.Offset < 0 {
+				return nil, ErrInvalidArgs
+			}
+			if opts.Limit, err = strconv.Atoi(string(args[i+2])); err != nil {
+				return nil, ErrInvalidArgs
+			}
+			hasLimit = true
+			opts.LimitArgIndex = i
+			i += 3
+		case "cursor":
+			if opts.Cursor != nil || i+1 >= len(args) {
+				return nil, ErrInvalidArgs
+			}
+			c, err := DecodeIndexSearchCursor(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			opts.Cursor = c
+			i += 2
+		case "agg":
+			opts.AggArgs = args[i+1:]
+			if len(opts.AggArgs) == 0 {
+				return nil, ErrInvalidArgs
+			}
+			i = len(args)
+		default:
+			opts.PostArgs = args[i:]
+			i = len(args)
+		}
+	}
+	if opts.AggArgs != nil && (opts.OrderField != nil || hasLimit || opts.Cursor != nil) {
+		return nil, ErrInvalidArgs
+	}
+	if opts.Cursor != nil {
+		if opts.OrderField == nil {
+			return nil, ErrInvalidArgs
+		}
+		if len(opts.Cursor.Positions) == 0 {
+			opts.Cursor.OrderField = string(opts.OrderField)
+			opts.Cursor.Desc = opts.Desc
+		} else if opts.Cursor.OrderField != string(opts.OrderField) || opts.Cursor.Desc != opts.Desc {
+			return nil, ErrInvalidIndexCursor
+		}
+	}
+	return opts, nil
+}
+
+func (r *HIndexRespWithValues) searchPos() IndexSearchPos {
+	pos := IndexSearchPos{PKey: r.PKey}
+	switch realV := r.IndexV.(type) {
+	case []byte:
+		pos.Value = realV
+	case int:
+		pos.IntValue = int64(realV)
+	case int32:
+		pos.IntValue = int64(realV)
+	case int64:
+		pos.IntValue = realV
+	}
+	return pos
+}
+
+// compare the index value and then the primary key
+func compareIndexSearchResp(l *HIndexRespWithValues, r *HIndexRespWithValues) int {
+	lp := l.searchPos()
+	rp := r.searchPos()
+	cmp := 0
+	if _, ok := l.IndexV.([]byte); ok {
+		cmp = bytes.Compare(lp.Value, rp.Value)
+	} else if lp.IntValue < rp.IntValue {
+		cmp = -1
+	} else if lp.IntValue > rp.IntValue {
+		cmp = 1
+	}
+	if cmp == 0 {
+		cmp = bytes.Compare(lp.PKey, rp.PKey)
+	}
+	return cmp
+}
+
+// the heads of the sorted results from each partition
+type indexSearchMergeHeap struct {
+	desc  bool
+	parts []int
+	rets  [][]HIndexRespWithValues
+}
+
+func (h *indexSearchMergeHeap) Len() int { return len(h.rets) }
+func (h *indexSearchMergeHeap) Less(i, j int) bool {
+	cmp := compareIndexSearchResp(&h.rets[i][0], &h.rets[j][0])
+	if h.desc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func (h *indexSearchMergeHeap) Swap(i, j int) {
+	h.rets[i], h.rets[j] = h.rets[j], h.rets[i]
+	h.parts[i], h.parts[j] = h.parts[j], h.parts[i]
+}
+
+func (h *indexSearchMergeHeap) Push(x interface{}) {}
+
+func (h *indexSearchMergeHeap) Pop() interface{} {
+	n := len(h.rets) - 1
+	h.rets = h.rets[:n]
+	h.parts = h.parts[:n]
+	return nil
+}
+
+// MergeOrderedIndexSearch merge the sorted results from all the partitions into the globally
+// sorted results, skip the offset and return at most limit results. The cursor will be
+// updated to the last position consumed in each partition.
+func MergeOrderedIndexSearch(partRets map[int][]HIndexRespWithValues, cursor *IndexSearchCursor,
+	offset int, limit int) []HIndexRespWithValues {
+	h := &indexSearchMergeHeap{desc: cursor.Desc}
+	for pid, rets := range partRets {
+		if len(rets) > 0 {
+			h.parts = append(h.parts, pid)
+			h.rets = append(h.rets, rets)
+		}
+	}
+	heap.Init(h)
+	merged := make([]HIndexRespWithValues, 0, 32)
+	for h.Len() > 0 && (limit < 0 || len(merged) < limit) {
+		r := h.rets[0][0]
+		if cursor.Positions == nil {
+			cursor.Positions = make(map[int]IndexSearchPos)
+		}
+		cursor.Positions[h.parts[0]] = r.searchPos()
+		h.rets[0] = h.rets[0][1:]
+		if len(h.rets[0]) == 0 {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func splitArgs(args ...string) [][]byte {
+	rets := make([][]byte, 0, len(args))
+	for _, a := range args {
+		rets = append(rets, []byte(a))
+	}
+	return rets
+}
+
+func TestParseIndexSearchOptions(t *testing.T) {
+	opts, err := ParseIndexSearchOptions(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, opts.Limit)
+	assert.Equal(t, -1, opts.LimitArgIndex)
+	assert.Nil(t, opts.OrderField)
+
+	opts, err = ParseIndexSearchOptions(splitArgs("ORDER", "BY", "f1", "DESC", "limit", "2", "10", "cursor", "0", "hget", "$", "f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "f1", string(opts.OrderField))
+	assert.True(t, opts.Desc)
+	assert.Equal(t, 2, opts.Offset)
+	assert.Equal(t, 10, opts.Limit)
+	assert.Equal(t, 4, opts.LimitArgIndex)
+	assert.Equal(t, "f1", opts.Cursor.OrderField)
+	assert.True(t, opts.Cursor.Desc)
+	assert.Equal(t, splitArgs("hget", "$", "f2"), opts.PostArgs)
+
+	opts, err = ParseIndexSearchOptions(splitArgs("order", "by", "f1", "hgetall", "$"))
+	assert.Nil(t, err)
+	assert.False(t, opts.Desc)
+	assert.Equal(t, splitArgs("hgetall", "$"), opts.PostArgs)
+
+	opts, err = ParseIndexSearchOptions(splitArgs("agg", "count", "*", "sum", "f1"))
+	assert.Nil(t, err)
+	assert.Equal(t, splitArgs("count", "*", "sum", "f1"), opts.AggArgs)
+
+	invalids := [][]string{
+		{"order", "f1"},
+		{"order", "by"},
+		{"limit", "1"},
+		{"limit", "a", "1"},
+		{"limit", "-1", "1"},
+		{"limit", "0", "1", "limit", "0", "1"},
+		{"cursor", "0"},
+		{"order", "by", "f1", "cursor", "invalid!"},
+		{"agg"},
+		{"order", "by", "f1", "agg", "count", "*"},
+		{"limit", "0", "10", "agg", "count", "*"},
+	}
+	for _, args := range invalids {
+		_, err = ParseIndexSearchOptions(splitArgs(args...))
+		assert.NotNil(t, err, args)
+	}
+}
+
+func TestIndexSearchCursor(t *testing.T) {
+	c := &IndexSearchCursor{OrderField: "f1", Desc: true}
+	assert.Equal(t, IndexSearchCursorStart, c.Encode())
+	c.Positions = map[int]IndexSearchPos{
+		0: {PKey: []byte("table:key1"), IntValue: 10},
+		3: {PKey: []byte("table:key2"), Value: []byte("v2")},
+	}
+	encoded := c.Encode()
+	decoded, err := DecodeIndexSearchCursor([]byte(encoded))
+	assert.Nil(t, err)
+	assert.Equal(t, c, decoded)
+
+	_, err = ParseIndexSearchOptions(splitArgs("order", "by", "f1", "desc", "cursor", encoded))
+	assert.Nil(t, err)
+	// the cursor should be used with the same order
+	_, err = ParseIndexSearchOptions(splitArgs("order", "by", "f1", "cursor", encoded))
+	assert.Equal(t, ErrInvalidIndexCursor, err)
+	_, err = ParseIndexSearchOptions(splitArgs("order", "by", "f2", "desc", "cursor", encoded))
+	assert.Equal(t, ErrInvalidIndexCursor, err)
+}
+
+func TestMergeOrderedIndexSearch(t *testing.T) {
+	partRets := map[int][]HIndexRespWithValues{
+		0: {{PKey: []byte("t:k1"), IndexV: int64(1)}, {PKey: []byte("t:k4"), IndexV: int64(4)}, {PKey: []byte("t:k6"), IndexV: int64(4)}},
+		1: {{PKey: []byte("t:k2"), IndexV: int64(2)}, {PKey: []byte("t:k5"), IndexV: int64(4)}},
+		2: {},
+	}
+	keys := func(rets []HIndexRespWithValues) []string {
+		ks := make([]string, 0, len(rets))
+		for _, r := range rets {
+			ks = append(ks, string(r.PKey))
+		}
+		return ks
+	}
+	c := &IndexSearchCursor{OrderField: "f1"}
+	merged := MergeOrderedIndexSearch(partRets, c, 1, 3)
+	assert.Equal(t, []string{"t:k2", "t:k4", "t:k5"}, keys(merged))
+	assert.Equal(t, 2, len(c.Positions))
+	assert.Equal(t, IndexSearchPos{PKey: []byte("t:k4"), IntValue: 4}, c.Positions[0])
+	assert.Equal(t, IndexSearchPos{PKey: []byte("t:k5"), IntValue: 4}, c.Positions[1])
+
+	c = &IndexSearchCursor{OrderField: "f1", Desc: true}
+	partRets = map[int][]HIndexRespWithValues{
+		0: {{PKey: []byte("t:k3"), IndexV: []byte("c")}, {PKey: []byte("t:k1"), IndexV: []byte("a")}},
+		1: {{PKey: []byte("t:k2"), IndexV: []byte("b")}},
+	}
+	merged = MergeOrderedIndexSearch(partRets, c, 0, -1)
+	assert.Equal(t, []string{"t:k3", "t:k2", "t:k1"}, keys(merged))
+	assert.Equal(t, IndexSearchPos{PKey: []byte("t:k1"), Value: []byte("a")}, c.Positions[0])
+}
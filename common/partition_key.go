@@ -0,0 +1,103 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// The partition is decided by the hash of the partition key, and the partition key
+// is the whole primary key by default. The partition key version is decided while
+// creating the namespace and can not be changed, so the old data will not be moved.
+type PartitionKeyVersionT int
+
+const (
+	DefaultPartitionKeyVer PartitionKeyVersionT = iota
+
+	// HashTagPartitionKeyV1 use the content between the first '{' and the first '}' after it
+	// as the partition key just like the redis cluster, so the keys with the same tag
+	// will be stored in the same partition.
+	HashTagPartitionKeyV1
+
+	// RegexPartitionKeyV1 use the first sub match of the regex configured for the namespace
+	// as the partition key.
+	RegexPartitionKeyV1
+
+	UnknownPartitionKeyVer
+)
+
+const (
+	HashTagPartitionKeyV1Str = "hash_tag_v1"
+	RegexPartitionKeyV1Str   = "regex_v1"
+)
+
+var errInvalidPartitionKeyRegex = errors.New("the partition key regex should have one sub expression")
+
+func StringToPartitionKeyVersionType(s string) (PartitionKeyVersionT, error) {
+	switch s {
+	case "":
+		return DefaultPartitionKeyVer, nil
+	case HashTagPartitionKeyV1Str:
+		return HashTagPartitionKeyV1, nil
+	case RegexPartitionKeyV1Str:
+		return RegexPartitionKeyV1, nil
+	default:
+		return UnknownPartitionKeyVer, errors.New("unknown partition key version type")
+	}
+}
+
+// PartitionKeyExtractor return the partition key from the primary key (table:key)
+type PartitionKeyExtractor func(pk []byte) []byte
+
+// ExtractHashTag return the hash tag in the key, the whole key will be returned if
+// no tag or the tag is empty.
+func ExtractHashTag(pk []byte) []byte {
+	start := bytes.IndexByte(pk, '{')
+	if start < 0 {
+		return pk
+	}
+	end := bytes.IndexByte(pk[start+1:], '}')
+	if end <= 0 {
+		return pk
+	}
+	return pk[start+1 : start+1+end]
+}
+
+// NewPartitionKeyExtractor return the extractor for the partition key version,
+// nil will be returned for the default version which use the whole primary key.
+func NewPartitionKeyExtractor(ver string, pattern string) (PartitionKeyExtractor, error) {
+	pv, err := StringToPartitionKeyVersionType(ver)
+	if err != nil {
+		return nil, err
+	}
+	switch pv {
+	case HashTagPartitionKeyV1:
+		return ExtractHashTag, nil
+	case RegexPartitionKeyV1:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if re.NumSubexp() != 1 {
+			return nil, errInvalidPartitionKeyRegex
+		}
+		return func(pk []byte) []byte {
+			m := re.FindSubmatch(pk)
+			if len(m) < 2 || len(m[1]) == 0 {
+				return pk
+			}
+			return m[1]
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func GetPartitionKeyHashSum(pk []byte, extractor PartitionKeyExtractor) int {
+	if extractor != nil {
+		pk = extractor(pk)
+	}
+	return int(murmur3.Sum32(pk))
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/spaolacci/murmur3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractHashTag(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"table:{user1}:following", "user1"},
+		{"table:{user1}:followers", "user1"},
+		{"table:user1", "table:user1"},
+		{"table:{}user1", "table:{}user1"},
+		{"table:{user1", "table:{user1"},
+		{"table:}{user1}", "user1"},
+		{"table:{a}{b}", "a"},
+		{"table:{{a}}", "{a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(ExtractHashTag([]byte(tt.key))))
+		})
+	}
+}
+
+func TestPartitionKeyExtractor(t *testing.T) {
+	ext, err := NewPartitionKeyExtractor("", "")
+	assert.Nil(t, err)
+	assert.Nil(t, ext)
+	pk := []byte("table:{user1}:a")
+	// the default should keep the old placement
+	assert.Equal(t, int(murmur3.Sum32(pk)), GetPartitionKeyHashSum(pk, ext))
+
+	ext, err = NewPartitionKeyExtractor(HashTagPartitionKeyV1Str, "")
+	assert.Nil(t, err)
+	assert.Equal(t, GetPartitionKeyHashSum(pk, ext), GetPartitionKeyHashSum([]byte("other:{user1}:b"), ext))
+	assert.Equal(t, int(murmur3.Sum32([]byte("user1"))), GetPartitionKeyHashSum(pk, ext))
+
+	_, err = NewPartitionKeyExtractor(RegexPartitionKeyV1Str, "^[^:]+:[^:]+")
+	assert.NotNil(t, err)
+	_, err = NewPartitionKeyExtractor(RegexPartitionKeyV1Str, "(")
+	assert.NotNil(t, err)
+	ext, err = NewPartitionKeyExtractor(RegexPartitionKeyV1Str, "^[^:]+:([^:]+):")
+	assert.Nil(t, err)
+	assert.Equal(t, "user1", string(ext([]byte("table:user1:a"))))
+	assert.Equal(t, "table:user1", string(ext([]byte("table:user1"))))
+
+	_, err = NewPartitionKeyExtractor("unknown", "")
+	assert.NotNil(t, err)
+}
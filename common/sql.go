@@ -0,0 +1,326 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrSQLSyntax        = errors.New("invalid sql syntax")
+	ErrSQLNotSupported  = errors.New("only the select query is supported")
+	ErrSQLLimitTooLarge = errors.New("the offset and limit of the sql query are too large")
+)
+
+const (
+	// the number of rows returned if no limit in the sql query
+	SQLDefaultLimit = 1000
+	// the max offset+limit of the sql query, since the first offset+limit rows
+	// are returned from each partition and merged
+	SQLMaxLimit = 10000
+)
+
+// SQLSelect is the parsed query
+// SELECT {* | field [, field ...]} FROM namespace.table [WHERE {WHERE clause}]
+// [ORDER BY field [ASC|DESC]] [LIMIT [offset,] num]
+// the where clause is the same as the hash index search.
+type SQLSelect struct {
+	Namespace string
+	Table     string
+	// nil if all the fields are selected by *
+	Fields [][]byte
+	// nil if no where clause
+	Where      []byte
+	OrderField []byte
+	Desc       bool
+	Offset     int
+	// SQLDefaultLimit if no limit
+	Limit int
+}
+
+// SQLRow is one row of the query results, the Values are the values of the selected fields,
+// or the field value pairs if all the fields are selected.
+type SQLRow struct {
+	PKey       []byte
+	OrderValue []byte
+	Values     [][]byte
+}
+
+// the position of the token in the query, the quoted string and the parentheses
+// are only used to find the clauses.
+type sqlToken struct {
+	start  int
+	end    int
+	quoted bool
+}
+
+func isSQLWordChar(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '(', ')', ',', '=', '<', '>', '!', '\'', '"':
+		return false
+	}
+	return true
+}
+
+func tokenizeSQL(query []byte) ([]sqlToken, error) {
+	tokens := make([]sqlToken, 0, 16)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			start := i
+			i++
+			closed := false
+			for i < len(query) {
+				if query[i] == '\\' && i+1 < len(query) {
+					i += 2
+					continue
+				}
+				i++
+				if query[i-1] == c {
+					closed = true
+					break
+				}
+			}
+			if !closed {
+				return nil, ErrSQLSyntax
+			}
+			tokens = append(tokens, sqlToken{start: start, end: i, quoted: true})
+		case !isSQLWordChar(c):
+			tokens = append(tokens, sqlToken{start: i, end: i + 1})
+			i++
+		default:
+			start := i
+			for i < len(query) && isSQLWordChar(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{start: start, end: i})
+		}
+	}
+	return tokens, nil
+}
+
+type sqlParser struct {
+	query  []byte
+	tokens []sqlToken
+	pos    int
+}
+
+func (p *sqlParser) eof() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *sqlParser) word(i int) []byte {
+	if i >= len(p.tokens) {
+		return nil
+	}
+	return p.query[p.tokens[i].start:p.tokens[i].end]
+}
+
+func (p *sqlParser) isKeyword(i int, k string) bool {
+	if i >= len(p.tokens) || p.tokens[i].quoted {
+		return false
+	}
+	return strings.EqualFold(string(p.word(i)), k)
+}
+
+func (p *sqlParser) next() []byte {
+	w := p.word(p.pos)
+	p.pos++
+	return w
+}
+
+func (p *sqlParser) parseFields(s *SQLSelect) error {
+	if !p.eof() && string(p.word(p.pos)) == "*" {
+		p.pos++
+		return nil
+	}
+	for {
+		if p.eof() || p.tokens[p.pos].quoted || !isSQLWordChar(p.query[p.tokens[p.pos].start]) ||
+			p.isKeyword(p.pos, "from") {
+			return ErrSQLSyntax
+		}
+		s.Fields = append(s.Fields, p.next())
+		if p.eof() || string(p.word(p.pos)) != "," {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+func (p *sqlParser) parseTable(s *SQLSelect) error {
+	if p.eof() || p.tokens[p.pos].quoted {
+		return ErrSQLSyntax
+	}
+	name := string(p.next())
+	index := strings.Index(name, ".")
+	if index <= 0 {
+		return ErrSQLSyntax
+	}
+	s.Namespace = name[:index]
+	s.Table = name[index+1:]
+	if !IsValidNamespaceName(s.Namespace) || !isValidNameString(s.Table) {
+		return ErrSQLSyntax
+	}
+	return nil
+}
+
+// the where clause ends at the ORDER BY or LIMIT outside the parentheses
+func (p *sqlParser) parseWhere(s *SQLSelect) error {
+	start := p.pos
+	depth := 0
+	for ; !p.eof(); p.pos++ {
+		if p.tokens[p.pos].quoted {
+			continue
+		}
+		switch string(p.word(p.pos)) {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth > 0 {
+			continue
+		}
+		if p.isKeyword(p.pos, "limit") || (p.isKeyword(p.pos, "order") && p.isKeyword(p.pos+1, "by")) {
+			break
+		}
+	}
+	if p.pos == start {
+		return ErrSQLSyntax
+	}
+	s.Where = p.query[p.tokens[start].start:p.tokens[p.pos-1].end]
+	return nil
+}
+
+func (p *sqlParser) parseLimit(s *SQLSelect) error {
+	n, err := strconv.Atoi(string(p.next()))
+	if err != nil || n < 0 {
+		return ErrSQLSyntax
+	}
+	s.Limit = n
+	if p.eof() || string(p.word(p.pos)) != "," {
+		return nil
+	}
+	p.pos++
+	n, err = strconv.Atoi(string(p.next()))
+	if err != nil || n < 0 {
+		return ErrSQLSyntax
+	}
+	s.Offset = s.Limit
+	s.Limit = n
+	return nil
+}
+
+// ParseSQLSelect parse the read only sql query, the keywords are case insensitive
+// and the table is given as namespace.table, such as
+// "SELECT name, age FROM default.users WHERE age > 18 ORDER BY age DESC LIMIT 10, 20".
+func ParseSQLSelect(query []byte) (*SQLSelect, error) {
+	query = bytes.TrimRight(bytes.TrimSpace(query), ";")
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{query: query, tokens: tokens}
+	if !p.isKeyword(0, "select") {
+		return nil, ErrSQLNotSupported
+	}
+	p.pos++
+	s := &SQLSelect{Limit: -1}
+	if err := p.parseFields(s); err != nil {
+		return nil, err
+	}
+	if !p.isKeyword(p.pos, "from") {
+		return nil, ErrSQLSyntax
+	}
+	p.pos++
+	if err := p.parseTable(s); err != nil {
+		return nil, err
+	}
+	if p.isKeyword(p.pos, "where") {
+		p.pos++
+		if err := p.parseWhere(s); err != nil {
+			return nil, err
+		}
+	}
+	if p.isKeyword(p.pos, "order") && p.isKeyword(p.pos+1, "by") {
+		p.pos += 2
+		if p.eof() || p.tokens[p.pos].quoted || !isSQLWordChar(p.query[p.tokens[p.pos].start]) {
+			return nil, ErrSQLSyntax
+		}
+		s.OrderField = p.next()
+		if p.isKeyword(p.pos, "desc") {
+			s.Desc = true
+			p.pos++
+		} else if p.isKeyword(p.pos, "asc") {
+			p.pos++
+		}
+	}
+	if p.isKeyword(p.pos, "limit") {
+		p.pos++
+		if err := p.parseLimit(s); err != nil {
+			return nil, err
+		}
+	}
+	if !p.eof() {
+		return nil, ErrSQLSyntax
+	}
+	// the rows are read into memory, so the query without usable index will not
+	// read all the rows in the table
+	if s.Limit < 0 {
+		s.Limit = SQLDefaultLimit
+	}
+	if s.Offset+s.Limit > SQLMaxLimit {
+		return nil, ErrSQLLimitTooLarge
+	}
+	return s, nil
+}
+
+// CompareSQLValue compare the values of the field for ORDER BY, the values are
+// compared as numbers if both are numbers, otherwise compared as strings.
+func CompareSQLValue(l []byte, r []byte) int {
+	lf, lerr := strconv.ParseFloat(string(l), 64)
+	rf, rerr := strconv.ParseFloat(string(r), 64)
+	if lerr == nil && rerr == nil {
+		if lf < rf {
+			return -1
+		} else if lf > rf {
+			return 1
+		}
+		return 0
+	}
+	return bytes.Compare(l, r)
+}
+
+// MergeSQLRows merge the rows from all the partitions, the rows are sorted by the order value
+// (and then the primary key) if ordered. The offset is skipped and at most limit rows are returned.
+func MergeSQLRows(partRows [][]SQLRow, ordered bool, desc bool, offset int, limit int) []SQLRow {
+	merged := make([]SQLRow, 0, 32)
+	for _, rows := range partRows {
+		merged = append(merged, rows...)
+	}
+	if ordered {
+		sort.Slice(merged, func(i, j int) bool {
+			cmp := CompareSQLValue(merged[i].OrderValue, merged[j].OrderValue)
+			if cmp == 0 {
+				cmp = bytes.Compare(merged[i].PKey, merged[j].PKey)
+			}
+			if desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+	}
+	if offset >= len(merged) {
+		return merged[:0]
+	}
+	merged = merged[offset:]
+	if limit >= 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
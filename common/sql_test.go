@@ -0,0 +1,88 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSQLSelect(t *testing.T) {
+	s, err := ParseSQLSelect([]byte("select * from default.users"))
+	assert.Nil(t, err)
+	assert.Equal(t, "default", s.Namespace)
+	assert.Equal(t, "users", s.Table)
+	assert.Nil(t, s.Fields)
+	assert.Nil(t, s.Where)
+	assert.Nil(t, s.OrderField)
+	assert.Equal(t, 0, s.Offset)
+	assert.Equal(t, SQLDefaultLimit, s.Limit)
+
+	s, err = ParseSQLSelect([]byte("SELECT name,age, city FROM default.users WHERE (age > 18 and city = 'order by x') " +
+		"or name like 'limit%' ORDER BY age DESC LIMIT 10, 20;"))
+	assert.Nil(t, err)
+	assert.Equal(t, splitArgs("name", "age", "city"), s.Fields)
+	assert.Equal(t, "(age > 18 and city = 'order by x') or name like 'limit%'", string(s.Where))
+	assert.Equal(t, "age", string(s.OrderField))
+	assert.True(t, s.Desc)
+	assert.Equal(t, 10, s.Offset)
+	assert.Equal(t, 20, s.Limit)
+
+	s, err = ParseSQLSelect([]byte("select name from default.users order by name asc limit 5"))
+	assert.Nil(t, err)
+	assert.Equal(t, "name", string(s.OrderField))
+	assert.False(t, s.Desc)
+	assert.Equal(t, 0, s.Offset)
+	assert.Equal(t, 5, s.Limit)
+
+	s, err = ParseSQLSelect([]byte(`select name from default.users where name = "a \" limit 1"`))
+	assert.Nil(t, err)
+	assert.Equal(t, `name = "a \" limit 1"`, string(s.Where))
+	assert.Equal(t, SQLDefaultLimit, s.Limit)
+
+	s, err = ParseSQLSelect([]byte("select name from default.users limit 100, 9900"))
+	assert.Nil(t, err)
+	assert.Equal(t, SQLMaxLimit, s.Offset+s.Limit)
+	_, err = ParseSQLSelect([]byte("select name from default.users limit 100, 9901"))
+	assert.Equal(t, ErrSQLLimitTooLarge, err)
+
+	_, err = ParseSQLSelect([]byte("delete from default.users"))
+	assert.Equal(t, ErrSQLNotSupported, err)
+	invalids := []string{
+		"select from default.users",
+		"select name, from default.users",
+		"select name from users",
+		"select name from default.users where",
+		"select name from default.users where a = 1 limit",
+		"select name from default.users limit -1",
+		"select name from default.users limit 1, 2, 3",
+		"select name from default.users order by",
+		"select name from default.users where name = 'a",
+		"select name from default.users group by name",
+	}
+	for _, q := range invalids {
+		_, err = ParseSQLSelect([]byte(q))
+		assert.Equal(t, ErrSQLSyntax, err, q)
+	}
+}
+
+func TestMergeSQLRows(t *testing.T) {
+	newRow := func(pk string, v string) SQLRow {
+		return SQLRow{PKey: []byte(pk), OrderValue: []byte(v)}
+	}
+	parts := [][]SQLRow{
+		{newRow("t:1", "9"), newRow("t:4", "100")},
+		{newRow("t:2", "10"), newRow("t:3", "9")},
+	}
+	merged := MergeSQLRows(parts, true, false, 0, -1)
+	assert.Equal(t, []SQLRow{newRow("t:1", "9"), newRow("t:3", "9"), newRow("t:2", "10"), newRow("t:4", "100")}, merged)
+	merged = MergeSQLRows(parts, true, true, 1, 2)
+	assert.Equal(t, []SQLRow{newRow("t:2", "10"), newRow("t:3", "9")}, merged)
+	merged = MergeSQLRows(parts, false, false, 3, 2)
+	assert.Equal(t, 1, len(merged))
+	merged = MergeSQLRows(parts, false, false, 4, 2)
+	assert.Equal(t, 0, len(merged))
+
+	assert.Equal(t, -1, CompareSQLValue([]byte("9"), []byte("10")))
+	assert.Equal(t, 1, CompareSQLValue([]byte("9"), []byte("10a")))
+	assert.Equal(t, 0, CompareSQLValue([]byte("1.0"), []byte("1")))
+}
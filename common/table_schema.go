@@ -0,0 +1,442 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+var (
+	ErrJSONNotObject        = errors.New("json should be an object for the table schema")
+	ErrJSONPathNotSupported = errors.New("json path not supported for the table schema")
+)
+
+func (t TableFieldType) String() string {
+	switch t {
+	case FieldInt:
+		return "int"
+	case FieldFloat:
+		return "float"
+	case FieldString:
+		return "string"
+	case FieldBool:
+		return "bool"
+	case FieldJSON:
+		return "json"
+	}
+	return "unknown"
+}
+
+func (s *TableSchema) GetField(name string) *TableFieldSchema {
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+func (f *TableFieldSchema) typeMismatchErr() error {
+	return fmt.Errorf("field %v should be %v", f.Name, f.Type)
+}
+
+func (f *TableFieldSchema) checkHashValue(v []byte) error {
+	var err error
+	switch f.Type {
+	case FieldInt:
+		_, err = strconv.ParseInt(string(v), 10, 64)
+	case FieldFloat:
+		_, err = strconv.ParseFloat(string(v), 64)
+	case FieldBool:
+		_, err = strconv.ParseBool(string(v))
+	case FieldJSON:
+		if !json.Valid(v) {
+			err = errors.New("invalid json")
+		}
+	}
+	if err != nil {
+		return f.typeMismatchErr()
+	}
+	return nil
+}
+
+func (f *TableFieldSchema) checkJSONValue(v gjson.Result) error {
+	ok := true
+	switch f.Type {
+	case FieldInt:
+		_, err := strconv.ParseInt(v.Raw, 10, 64)
+		ok = v.Type == gjson.Number && err == nil
+	case FieldFloat:
+		ok = v.Type == gjson.Number
+	case FieldString:
+		ok = v.Type == gjson.String
+	case FieldBool:
+		ok = v.Type == gjson.True || v.Type == gjson.False
+	}
+	if !ok {
+		return f.typeMismatchErr()
+	}
+	return nil
+}
+
+// the default value is declared as the hash value, so the string should be quoted in json
+func (f *TableFieldSchema) jsonDefault() []byte {
+	d := *f.Default
+	switch f.Type {
+	case FieldString:
+		v, _ := json.Marshal(d)
+		return v
+	case FieldBool:
+		b, _ := strconv.ParseBool(d)
+		return []byte(strconv.FormatBool(b))
+	}
+	return []byte(d)
+}
+
+func (s *TableSchema) undeclaredErr(field string) error {
+	return fmt.Errorf("field %v not declared in the table schema", field)
+}
+
+// ValidateHashFields checks the field value pairs written to the hash. If the hash is new,
+// the required fields without the default value should be written.
+func (s *TableSchema) ValidateHashFields(fvs [][]byte, isNew bool) error {
+	written := make(map[string]bool, len(fvs)/2)
+	for i := 0; i+1 < len(fvs); i += 2 {
+		f := s.GetField(string(fvs[i]))
+		if f == nil {
+			if s.Strict {
+				return s.undeclaredErr(string(fvs[i]))
+			}
+			continue
+		}
+		if err := f.checkHashValue(fvs[i+1]); err != nil {
+			return err
+		}
+		written[f.Name] = true
+	}
+	if !isNew {
+		return nil
+	}
+	for _, f := range s.Fields {
+		if !written[f.Name] && f.Default == nil && f.Required {
+			return fmt.Errorf("required field %v is missing", f.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateHashIncr checks the field increased by hincrby, only the int field can be increased.
+// If the hash is new, the required fields without the default value should be written.
+func (s *TableSchema) ValidateHashIncr(field []byte, isNew bool) error {
+	f := s.GetField(string(field))
+	if f == nil {
+		if s.Strict {
+			return s.undeclaredErr(string(field))
+		}
+	} else if f.Type != FieldInt {
+		return f.typeMismatchErr()
+	}
+	return s.ValidateHashFields([][]byte{field, []byte("0")}, isNew)
+}
+
+// ValidateHashDel checks the fields deleted by hdel, the required fields can not be deleted.
+func (s *TableSchema) ValidateHashDel(fields [][]byte) error {
+	for _, field := range fields {
+		f := s.GetField(string(field))
+		if f != nil && f.Required {
+			return f.requiredDeletedErr()
+		}
+	}
+	return nil
+}
+
+func (f *TableFieldSchema) requiredDeletedErr() error {
+	return fmt.Errorf("required field %v can not be deleted", f.Name)
+}
+
+// FillHashDefaults returns the field value pairs with the default values of the missing
+// fields appended. It should be used while creating the hash at apply time, so the
+// concurrent first writes will not overwrite each other with the default values.
+func (s *TableSchema) FillHashDefaults(fvs []KVRecord) []KVRecord {
+	var filled []KVRecord
+	for _, f := range s.Fields {
+		if f.Default == nil {
+			continue
+		}
+		written := false
+		for _, fv := range fvs {
+			if string(fv.Key) == f.Name {
+				written = true
+				break
+			}
+		}
+		if written {
+			continue
+		}
+		if filled == nil {
+			filled = make([]KVRecord, 0, len(fvs)+len(s.Fields))
+			filled = append(filled, fvs...)
+		}
+		filled = append(filled, KVRecord{Key: []byte(f.Name), Value: []byte(*f.Default)})
+	}
+	if filled == nil {
+		return fvs
+	}
+	return filled
+}
+
+// split the json path to the keys, only the dot path and the array index are supported.
+func splitJSONFieldPath(path string) ([]string, bool) {
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var segs []string
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end == -1 {
+				return nil, false
+			}
+			if _, err := strconv.Atoi(p[1:end]); err != nil {
+				return nil, false
+			}
+			segs = append(segs, p[1:end])
+			p = p[end+1:]
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end == -1 {
+				end = len(p)
+			}
+			segs = append(segs, p[:end])
+			p = p[end:]
+		}
+	}
+	return segs, true
+}
+
+func escapeJSONKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '.', '*', '?', '#', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(key[i])
+	}
+	return b.String()
+}
+
+func (s *TableSchema) validateJSONDoc(doc []byte, isNew bool) error {
+	r := gjson.ParseBytes(doc)
+	if !r.IsObject() {
+		return ErrJSONNotObject
+	}
+	var err error
+	r.ForEach(func(k, v gjson.Result) bool {
+		f := s.GetField(k.String())
+		if f == nil {
+			if s.Strict {
+				err = s.undeclaredErr(k.String())
+			}
+		} else {
+			err = f.checkJSONValue(v)
+		}
+		return err == nil
+	})
+	if err != nil || !isNew {
+		return err
+	}
+	for _, f := range s.Fields {
+		if f.Default == nil && f.Required && !gjson.GetBytes(doc, escapeJSONKey(f.Name)).Exists() {
+			return fmt.Errorf("required field %v is missing", f.Name)
+		}
+	}
+	return nil
+}
+
+// FillJSONDefaults sets the default values of the missing top level fields in the json object.
+// It should be used while creating the json at apply time, so the concurrent first writes
+// will not overwrite each other with the default values.
+func (s *TableSchema) FillJSONDefaults(doc []byte) ([]byte, error) {
+	if !gjson.ParseBytes(doc).IsObject() {
+		return doc, nil
+	}
+	var err error
+	for _, f := range s.Fields {
+		key := escapeJSONKey(f.Name)
+		if f.Default == nil || gjson.GetBytes(doc, key).Exists() {
+			continue
+		}
+		doc, err = sjson.SetRawBytes(doc, key, f.jsonDefault())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// ValidateJSONSet checks the value set at the json path, the top level keys of the json are
+// checked as the declared fields. If the whole json is replaced or created, the json should
+// be an object and the required fields without the default value should exist.
+func (s *TableSchema) ValidateJSONSet(path []byte, value []byte, isNew bool) error {
+	if !gjson.Valid(string(value)) {
+		return errors.New("invalid json value")
+	}
+	segs, ok := splitJSONFieldPath(string(path))
+	if !ok {
+		return ErrJSONPathNotSupported
+	}
+	if len(segs) == 0 {
+		return s.validateJSONDoc(value, true)
+	}
+	f := s.GetField(segs[0])
+	if f == nil {
+		if s.Strict {
+			return s.undeclaredErr(segs[0])
+		}
+	} else if len(segs) == 1 {
+		if err := f.checkJSONValue(gjson.ParseBytes(value)); err != nil {
+			return err
+		}
+	} else if f.Type != FieldJSON {
+		return f.typeMismatchErr()
+	}
+	if !isNew {
+		return nil
+	}
+	// the new json will be created as the object with the value at the path
+	keys := make([]string, 0, len(segs))
+	for _, seg := range segs {
+		keys = append(keys, escapeJSONKey(seg))
+	}
+	doc, err := sjson.SetRawBytes([]byte("{}"), strings.Join(keys, "."), value)
+	if err != nil {
+		return err
+	}
+	return s.validateJSONDoc(doc, true)
+}
+
+// check the json path changed by the operation which only works on the value of the types.
+// The field of the path is returned, nil if the field is not declared or the path is in
+// the json field.
+func (s *TableSchema) checkJSONFieldOp(path []byte, types ...TableFieldType) (*TableFieldSchema, error) {
+	segs, ok := splitJSONFieldPath(string(path))
+	if !ok {
+		return nil, ErrJSONPathNotSupported
+	}
+	if len(segs) == 0 {
+		// the whole json should be kept as an object
+		return nil, ErrJSONNotObject
+	}
+	f := s.GetField(segs[0])
+	if f == nil {
+		if s.Strict {
+			return nil, s.undeclaredErr(segs[0])
+		}
+		return nil, nil
+	}
+	if len(segs) > 1 {
+		if f.Type != FieldJSON {
+			return nil, f.typeMismatchErr()
+		}
+		return nil, nil
+	}
+	for _, t := range types {
+		if f.Type == t {
+			return f, nil
+		}
+	}
+	return nil, f.typeMismatchErr()
+}
+
+// ValidateJSONNumIncr checks the number increased by json.numincrby at the path,
+// the int field can only be increased by the int number.
+func (s *TableSchema) ValidateJSONNumIncr(path []byte, num []byte) error {
+	f, err := s.checkJSONFieldOp(path, FieldInt, FieldFloat)
+	if err != nil || f == nil {
+		return err
+	}
+	if f.Type == FieldInt {
+		if _, err := strconv.ParseInt(string(num), 10, 64); err != nil {
+			return f.typeMismatchErr()
+		}
+	}
+	return nil
+}
+
+// ValidateJSONStrAppend checks the string appended by json.strappend at the path.
+func (s *TableSchema) ValidateJSONStrAppend(path []byte) error {
+	_, err := s.checkJSONFieldOp(path, FieldString)
+	return err
+}
+
+// ValidateJSONToggle checks the bool toggled by json.toggle at the path.
+func (s *TableSchema) ValidateJSONToggle(path []byte) error {
+	_, err := s.checkJSONFieldOp(path, FieldBool)
+	return err
+}
+
+// ValidateJSONArrayInsert checks the array changed by json.arrinsert at the path,
+// the array is only allowed in the json field.
+func (s *TableSchema) ValidateJSONArrayInsert(path []byte) error {
+	_, err := s.checkJSONFieldOp(path, FieldJSON)
+	return err
+}
+
+// ValidateJSONMerge checks the json merge patch at the path. For the root path the top level
+// keys of the patch are checked as the declared fields, and the null value which removes
+// the field is not allowed for the required fields. If the json is created by the merge,
+// the required fields without the default value should exist.
+func (s *TableSchema) ValidateJSONMerge(path []byte, value []byte, isNew bool) error {
+	if !gjson.Valid(string(value)) {
+		return errors.New("invalid json value")
+	}
+	patch := gjson.ParseBytes(value)
+	segs, ok := splitJSONFieldPath(string(path))
+	if !ok {
+		return ErrJSONPathNotSupported
+	}
+	if len(segs) > 0 {
+		f, err := s.checkJSONFieldOp(path, FieldInt, FieldFloat, FieldString, FieldBool, FieldJSON)
+		if err != nil || f == nil {
+			return err
+		}
+		// the patch which is not an object replaces the value, and the object patch
+		// makes the value an object
+		return f.checkJSONValue(patch)
+	}
+	if !patch.IsObject() {
+		return ErrJSONNotObject
+	}
+	var err error
+	patch.ForEach(func(k, v gjson.Result) bool {
+		f := s.GetField(k.String())
+		if f == nil {
+			if s.Strict {
+				err = s.undeclaredErr(k.String())
+			}
+		} else if v.Type == gjson.Null {
+			if f.Required {
+				err = f.requiredDeletedErr()
+			}
+		} else {
+			err = f.checkJSONValue(v)
+		}
+		return err == nil
+	})
+	if err != nil || !isNew {
+		return err
+	}
+	for _, f := range s.Fields {
+		if f.Default == nil && f.Required && !gjson.GetBytes(value, escapeJSONKey(f.Name)).Exists() {
+			return fmt.Errorf("required field %v is missing", f.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func newTestTableSchema(strict bool) *TableSchema {
+	defAge := "18"
+	defName := "unknown"
+	return &TableSchema{
+		Fields: []TableFieldSchema{
+			{Name: "id", Type: FieldInt, Required: true},
+			{Name: "age", Type: FieldInt, Default: &defAge},
+			{Name: "score", Type: FieldFloat},
+			{Name: "name", Type: FieldString, Default: &defName},
+			{Name: "vip", Type: FieldBool},
+			{Name: "profile", Type: FieldJSON},
+		},
+		Strict: strict,
+	}
+}
+
+func TestTableSchemaValid(t *testing.T) {
+	s := newTestTableSchema(false)
+	assert.True(t, s.IsValidNewSchema())
+	assert.False(t, (&TableSchema{}).IsValidNewSchema())
+
+	s.Fields = append(s.Fields, TableFieldSchema{Name: "id", Type: FieldString})
+	assert.False(t, s.IsValidNewSchema())
+
+	s = newTestTableSchema(false)
+	s.Fields = append(s.Fields, TableFieldSchema{Name: "t", Type: MaxFieldType})
+	assert.False(t, s.IsValidNewSchema())
+
+	s = newTestTableSchema(false)
+	invalidDefault := "abc"
+	s.Fields = append(s.Fields, TableFieldSchema{Name: "f", Type: FieldFloat, Default: &invalidDefault})
+	assert.False(t, s.IsValidNewSchema())
+}
+
+func TestTableSchemaValidateHashFields(t *testing.T) {
+	s := newTestTableSchema(false)
+	err := s.ValidateHashFields(splitArgs("id", "1", "score", "1.5", "vip", "true",
+		"profile", `{"a":1}`, "other", "any"), true)
+	assert.Nil(t, err)
+
+	err = s.ValidateHashFields(splitArgs("age", "20"), true)
+	assert.NotNil(t, err)
+	err = s.ValidateHashFields(splitArgs("age", "20"), false)
+	assert.Nil(t, err)
+
+	err = s.ValidateHashFields(splitArgs("age", "1.5"), false)
+	assert.NotNil(t, err)
+	err = s.ValidateHashFields(splitArgs("score", "abc"), false)
+	assert.NotNil(t, err)
+	err = s.ValidateHashFields(splitArgs("vip", "yes"), false)
+	assert.NotNil(t, err)
+	err = s.ValidateHashFields(splitArgs("profile", "{a"), false)
+	assert.NotNil(t, err)
+
+	s.Strict = true
+	err = s.ValidateHashFields(splitArgs("other", "any"), false)
+	assert.NotNil(t, err)
+}
+
+func TestTableSchemaValidateHashIncr(t *testing.T) {
+	s := newTestTableSchema(false)
+	assert.Nil(t, s.ValidateHashIncr([]byte("age"), false))
+	assert.Nil(t, s.ValidateHashIncr([]byte("other"), false))
+	assert.NotNil(t, s.ValidateHashIncr([]byte("score"), false))
+	assert.NotNil(t, s.ValidateHashIncr([]byte("name"), false))
+	assert.NotNil(t, s.ValidateHashIncr([]byte("vip"), false))
+	assert.NotNil(t, s.ValidateHashIncr([]byte("profile"), false))
+	// the required field is missing while creating the hash
+	assert.NotNil(t, s.ValidateHashIncr([]byte("age"), true))
+	assert.Nil(t, s.ValidateHashIncr([]byte("id"), true))
+
+	s.Strict = true
+	assert.NotNil(t, s.ValidateHashIncr([]byte("other"), false))
+}
+
+func TestTableSchemaValidateHashDel(t *testing.T) {
+	s := newTestTableSchema(true)
+	assert.Nil(t, s.ValidateHashDel(splitArgs("age", "score", "other")))
+	assert.NotNil(t, s.ValidateHashDel(splitArgs("age", "id")))
+}
+
+func TestTableSchemaFillHashDefaults(t *testing.T) {
+	s := newTestTableSchema(false)
+	fvs := []KVRecord{{Key: []byte("id"), Value: []byte("1")}, {Key: []byte("name"), Value: []byte("n1")}}
+	filled := s.FillHashDefaults(fvs)
+	assert.Equal(t, append(fvs, KVRecord{Key: []byte("age"), Value: []byte("18")}), filled)
+
+	fvs = []KVRecord{{Key: []byte("age"), Value: []byte("20")}, {Key: []byte("name"), Value: []byte("n1")}}
+	assert.Equal(t, fvs, s.FillHashDefaults(fvs))
+}
+
+func TestTableSchemaValidateJSONSet(t *testing.T) {
+	s := newTestTableSchema(true)
+	err := s.ValidateJSONSet([]byte("."), []byte(`{"id":1,"name":"n1","profile":{"a":[1]}}`), false)
+	assert.Nil(t, err)
+
+	err = s.ValidateJSONSet([]byte("$"), []byte(`{"name":"n1"}`), false)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONSet([]byte("."), []byte(`[1, 2]`), false)
+	assert.Equal(t, ErrJSONNotObject, err)
+	err = s.ValidateJSONSet([]byte("."), []byte(`{"id":1.5}`), false)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONSet([]byte("."), []byte(`{"id":1,"other":1}`), false)
+	assert.NotNil(t, err)
+
+	err = s.ValidateJSONSet([]byte("$.score"), []byte("2.5"), false)
+	assert.Nil(t, err)
+	err = s.ValidateJSONSet([]byte(".vip"), []byte(`"true"`), false)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONSet([]byte(".other"), []byte("1"), false)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONSet([]byte(".name.first"), []byte(`"a"`), false)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONSet([]byte(".profile.tags[0]"), []byte(`"a"`), false)
+	assert.Nil(t, err)
+	err = s.ValidateJSONSet([]byte(".profile['a']"), []byte(`"a"`), false)
+	assert.Equal(t, ErrJSONPathNotSupported, err)
+
+	// create the new json from the path
+	err = s.ValidateJSONSet([]byte(".age"), []byte("20"), true)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONSet([]byte(".id"), []byte("2"), true)
+	assert.Nil(t, err)
+}
+
+func TestTableSchemaFillJSONDefaults(t *testing.T) {
+	s := newTestTableSchema(true)
+	doc, err := s.FillJSONDefaults([]byte(`{"id":1,"name":"n1"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), gjson.GetBytes(doc, "id").Int())
+	assert.Equal(t, int64(18), gjson.GetBytes(doc, "age").Int())
+	assert.Equal(t, "n1", gjson.GetBytes(doc, "name").String())
+
+	doc, err = s.FillJSONDefaults([]byte(`[1]`))
+	assert.Nil(t, err)
+	assert.Equal(t, `[1]`, string(doc))
+}
+
+func TestTableSchemaValidateJSONOps(t *testing.T) {
+	s := newTestTableSchema(true)
+	assert.Nil(t, s.ValidateJSONNumIncr([]byte(".age"), []byte("2")))
+	assert.Nil(t, s.ValidateJSONNumIncr([]byte("$.score"), []byte("1.5")))
+	assert.Nil(t, s.ValidateJSONNumIncr([]byte(".profile.count"), []byte("1.5")))
+	assert.NotNil(t, s.ValidateJSONNumIncr([]byte(".age"), []byte("1.5")))
+	assert.NotNil(t, s.ValidateJSONNumIncr([]byte(".name"), []byte("1")))
+	assert.NotNil(t, s.ValidateJSONNumIncr([]byte(".other"), []byte("1")))
+	assert.Equal(t, ErrJSONNotObject, s.ValidateJSONNumIncr([]byte("."), []byte("1")))
+
+	assert.Nil(t, s.ValidateJSONStrAppend([]byte(".name")))
+	assert.Nil(t, s.ValidateJSONStrAppend([]byte(".profile.desc")))
+	assert.NotNil(t, s.ValidateJSONStrAppend([]byte(".age")))
+	assert.NotNil(t, s.ValidateJSONStrAppend([]byte(".name.first")))
+	assert.Equal(t, ErrJSONNotObject, s.ValidateJSONStrAppend([]byte("")))
+
+	assert.Nil(t, s.ValidateJSONToggle([]byte(".vip")))
+	assert.NotNil(t, s.ValidateJSONToggle([]byte(".id")))
+	assert.NotNil(t, s.ValidateJSONToggle([]byte(".other")))
+
+	assert.Nil(t, s.ValidateJSONArrayInsert([]byte(".profile")))
+	assert.Nil(t, s.ValidateJSONArrayInsert([]byte(".profile.tags")))
+	assert.NotNil(t, s.ValidateJSONArrayInsert([]byte(".name")))
+	assert.Equal(t, ErrJSONPathNotSupported, s.ValidateJSONArrayInsert([]byte(".profile['a']")))
+
+	s.Strict = false
+	assert.Nil(t, s.ValidateJSONToggle([]byte(".other")))
+	assert.Nil(t, s.ValidateJSONArrayInsert([]byte(".other")))
+}
+
+func TestTableSchemaValidateJSONMerge(t *testing.T) {
+	s := newTestTableSchema(true)
+	err := s.ValidateJSONMerge([]byte("."), []byte(`{"age":20,"score":null,"profile":{"a":[1]}}`), false)
+	assert.Nil(t, err)
+	err = s.ValidateJSONMerge([]byte("."), []byte(`{"id":null}`), false)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONMerge([]byte("."), []byte(`{"age":"20"}`), false)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONMerge([]byte("."), []byte(`{"other":1}`), false)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONMerge([]byte("."), []byte(`[1]`), false)
+	assert.Equal(t, ErrJSONNotObject, err)
+	err = s.ValidateJSONMerge([]byte("."), []byte(`{a`), false)
+	assert.NotNil(t, err)
+
+	err = s.ValidateJSONMerge([]byte(".name"), []byte(`"n2"`), false)
+	assert.Nil(t, err)
+	err = s.ValidateJSONMerge([]byte(".name"), []byte(`{"first":"n"}`), false)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONMerge([]byte(".profile"), []byte(`{"a":null}`), false)
+	assert.Nil(t, err)
+	err = s.ValidateJSONMerge([]byte(".vip.a"), []byte(`true`), false)
+	assert.NotNil(t, err)
+
+	// create the new json by the merge
+	err = s.ValidateJSONMerge([]byte("."), []byte(`{"age":20}`), true)
+	assert.NotNil(t, err)
+	err = s.ValidateJSONMerge([]byte("."), []byte(`{"id":1}`), true)
+	assert.Nil(t, err)
+}
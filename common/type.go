@@ -395,6 +395,21 @@ const (
 	MaxVT   IndexPropertyDType = 3
 )
 
+type HsetIndexFieldSchema struct {
+	Field     string             `json:"field"`
+	ValueType IndexPropertyDType `json:"value_type"`
+}
+
+const (
+	// the indexed value is unique in the partition
+	PartitionUniqueIndex int32 = 1
+	// reserved for the indexed value unique across all the partitions, which needs the index
+	// stored in the partition chosen by the value and the atomic commit across the raft
+	// groups. It is deferred to a follow-up (see rockredis/t_hash_unique_index.go) and
+	// rejected while adding the index.
+	GlobalUniqueIndex int32 = 2
+)
+
 type HsetIndexSchema struct {
 	Name       string             `json:"name"`
 	IndexField string             `json:"index_field"`
@@ -402,10 +417,47 @@ type HsetIndexSchema struct {
 	Unique     int32              `json:"unique"`
 	ValueType  IndexPropertyDType `json:"value_type"`
 	State      IndexState         `json:"state"`
+	// the ordered fields for the composite index, the index_field of the
+	// composite index is the field names joined by comma
+	CompositeFields []HsetIndexFieldSchema `json:"composite_fields,omitempty"`
+}
+
+func (s *HsetIndexSchema) IsComposite() bool {
+	return len(s.CompositeFields) > 0
+}
+
+func (s *HsetIndexSchema) CompositeIndexField() string {
+	fields := make([]string, 0, len(s.CompositeFields))
+	for _, f := range s.CompositeFields {
+		fields = append(fields, f.Field)
+	}
+	return strings.Join(fields, ",")
 }
 
 func (s *HsetIndexSchema) IsValidNewSchema() bool {
-	return s.Name != "" && s.IndexField != "" && s.ValueType < MaxVT && s.State < MaxIndexState
+	if s.Name == "" || s.IndexField == "" || s.ValueType >= MaxVT || s.State >= MaxIndexState {
+		return false
+	}
+	// the unique index is checked in the partition, the global unique index is not supported
+	if s.Unique != 0 && s.Unique != PartitionUniqueIndex {
+		return false
+	}
+	// the truncated prefix values can not be used to check the uniqueness
+	if s.Unique == PartitionUniqueIndex && s.PrefixLen != 0 {
+		return false
+	}
+	if !s.IsComposite() {
+		return true
+	}
+	if len(s.CompositeFields) < 2 || s.PrefixLen != 0 || s.IndexField != s.CompositeIndexField() {
+		return false
+	}
+	for _, f := range s.CompositeFields {
+		if f.Field == "" || strings.Contains(f.Field, ",") || f.ValueType >= MaxVT {
+			return false
+		}
+	}
+	return true
 }
 
 type HIndexRespWithValues struct {
@@ -478,13 +530,180 @@ func (sh *SearchResultHeap) update(item *HIndexRespWithValues) {
 	heap.Fix(sh, item.index)
 }
 
+// JSONIndexSchema is the secondary index on the value at the json path, the path
+// should match only one value in the json, such as "address.city" or "$.tags[0]".
 type JSONIndexSchema struct {
-	State IndexState `json:"state"`
+	Name      string             `json:"name"`
+	Path      string             `json:"path"`
+	PrefixLen int32              `json:"prefix_len"`
+	ValueType IndexPropertyDType `json:"value_type"`
+	State     IndexState         `json:"state"`
+}
+
+func (s *JSONIndexSchema) IsValidNewSchema() bool {
+	if s.Name == "" || NormalizeJSONIndexPath(s.Path) == "" || s.ValueType >= MaxVT || s.State >= MaxIndexState {
+		return false
+	}
+	return true
+}
+
+// NormalizeJSONIndexPath converts the json path to the dotted form used as the json index key,
+// so "$.a.b", ".a.b" and "a.b" will be the same index. The JSONPath using the brackets, wildcards
+// or recursive descent is returned as it is and the data node will convert it while indexing.
+func NormalizeJSONIndexPath(path string) string {
+	jpath := strings.TrimSpace(path)
+	jpath = strings.TrimPrefix(jpath, ".")
+	if jpath == "$" {
+		return ""
+	}
+	if !strings.HasPrefix(jpath, "$.") {
+		return jpath
+	}
+	rest := jpath[2:]
+	if rest == "" || strings.ContainsAny(rest, "[]*?#:'\"\\") || strings.Contains(rest, "..") ||
+		strings.HasPrefix(rest, ".") || strings.HasSuffix(rest, ".") {
+		return jpath
+	}
+	return rest
+}
+
+// FullTextIndexSchema is the full text index on the hash fields or the json paths,
+// only one of the hash fields and json paths can be used for an index.
+type FullTextIndexSchema struct {
+	Name       string     `json:"name"`
+	HashFields []string   `json:"hash_fields"`
+	JSONPaths  []string   `json:"json_paths"`
+	State      IndexState `json:"state"`
+}
+
+func (s *FullTextIndexSchema) IsValidNewSchema() bool {
+	if s.Name == "" || s.State >= MaxIndexState {
+		return false
+	}
+	if (len(s.HashFields) == 0) == (len(s.JSONPaths) == 0) {
+		return false
+	}
+	for _, f := range s.HashFields {
+		if f == "" {
+			return false
+		}
+	}
+	for _, p := range s.JSONPaths {
+		if p == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ColumnTableSchema declares the table as columnar, the hash fields in the columns
+// will also be stored column-wise for the aggregation.
+type ColumnTableSchema struct {
+	Name    string     `json:"name"`
+	Columns []string   `json:"columns"`
+	State   IndexState `json:"state"`
+}
+
+func (s *ColumnTableSchema) IsValidNewSchema() bool {
+	if s.Name == "" || s.State >= MaxIndexState || len(s.Columns) == 0 {
+		return false
+	}
+	columns := make(map[string]bool, len(s.Columns))
+	for _, c := range s.Columns {
+		if c == "" || columns[c] {
+			return false
+		}
+		columns[c] = true
+	}
+	return true
+}
+
+// TableFieldType is the value type of the field declared in the table schema
+type TableFieldType int32
+
+const (
+	FieldInt     TableFieldType = 0
+	FieldFloat   TableFieldType = 1
+	FieldString  TableFieldType = 2
+	FieldBool    TableFieldType = 3
+	FieldJSON    TableFieldType = 4
+	MaxFieldType TableFieldType = 5
+)
+
+type TableFieldSchema struct {
+	Name     string         `json:"name"`
+	Type     TableFieldType `json:"type"`
+	Required bool           `json:"required"`
+	// the default value will be filled if the field is missing while creating the hash or json
+	Default *string `json:"default,omitempty"`
+}
+
+// TableSchema declares the typed hash fields (or the top level fields of json) in the table,
+// the writes are validated on the leader before proposal.
+type TableSchema struct {
+	Fields []TableFieldSchema `json:"fields"`
+	// the fields not declared are not allowed in the strict schema
+	Strict bool `json:"strict"`
+	// increased for each change and used to sync the schema to the partitions
+	Version int64 `json:"version"`
+}
+
+func (s *TableSchema) IsValidNewSchema() bool {
+	if len(s.Fields) == 0 {
+		return false
+	}
+	fields := make(map[string]bool, len(s.Fields))
+	for _, f := range s.Fields {
+		if f.Name == "" || fields[f.Name] || f.Type < 0 || f.Type >= MaxFieldType {
+			return false
+		}
+		if f.Default != nil && f.checkHashValue([]byte(*f.Default)) != nil {
+			return false
+		}
+		fields[f.Name] = true
+	}
+	return true
 }
 
 type IndexSchema struct {
-	HsetIndexes []*HsetIndexSchema `json:"hset_indexes"`
-	JSONIndexes []*JSONIndexSchema `json:"json_indexes"`
+	HsetIndexes     []*HsetIndexSchema     `json:"hset_indexes"`
+	JSONIndexes     []*JSONIndexSchema     `json:"json_indexes"`
+	FullTextIndexes []*FullTextIndexSchema `json:"fulltext_indexes"`
+	ColumnTables    []*ColumnTableSchema   `json:"column_tables"`
+	TableSchema     *TableSchema           `json:"table_schema,omitempty"`
+}
+
+const (
+	IndexJobBuild  = "build"
+	IndexJobVerify = "verify"
+
+	IndexJobRunning   = "running"
+	IndexJobPaused    = "paused"
+	IndexJobDone      = "done"
+	IndexJobCancelled = "cancelled"
+	IndexJobFailed    = "failed"
+)
+
+// IndexJobProgress is the progress of the index build or verify job in one partition,
+// the total keys is the approximate key number of the table.
+type IndexJobProgress struct {
+	Namespace   string   `json:"namespace"`
+	Node        string   `json:"node,omitempty"`
+	Table       string   `json:"table"`
+	Indexes     []string `json:"indexes"`
+	Job         string   `json:"job"`
+	Status      string   `json:"status"`
+	TotalKeys   int64    `json:"total_keys"`
+	ScannedKeys int64    `json:"scanned_keys"`
+	KeysPerSec  float64  `json:"keys_per_sec"`
+	ETASeconds  int64    `json:"eta_seconds"`
+	StartTime   int64    `json:"start_time"`
+	UpdateTime  int64    `json:"update_time"`
+	// the index entries missing or not matched with the hash data found by the verify job
+	MissingEntries int64  `json:"missing_entries"`
+	StaleEntries   int64  `json:"stale_entries"`
+	Repaired       int64  `json:"repaired"`
+	Error          string `json:"error,omitempty"`
 }
 
 type ExpiredDataBuffer interface {
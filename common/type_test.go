@@ -77,3 +77,71 @@ func TestSortHindexRespForInt(t *testing.T) {
 		lastV = vt
 	}
 }
+
+func TestCompositeHsetIndexSchema(t *testing.T) {
+	s := HsetIndexSchema{
+		Name: "test",
+		CompositeFields: []HsetIndexFieldSchema{
+			{Field: "tenant_id", ValueType: StringV},
+			{Field: "created_at", ValueType: Int64V},
+		},
+	}
+	assert.True(t, s.IsComposite())
+	assert.Equal(t, "tenant_id,created_at", s.CompositeIndexField())
+	assert.False(t, s.IsValidNewSchema())
+	s.IndexField = s.CompositeIndexField()
+	assert.True(t, s.IsValidNewSchema())
+	s.PrefixLen = 2
+	assert.False(t, s.IsValidNewSchema())
+	s.PrefixLen = 0
+	s.Unique = 1
+	assert.True(t, s.IsValidNewSchema())
+	s.Unique = GlobalUniqueIndex
+	assert.False(t, s.IsValidNewSchema())
+	s.Unique = 0
+	s.CompositeFields[1].ValueType = MaxVT
+	assert.False(t, s.IsValidNewSchema())
+	s.CompositeFields = s.CompositeFields[:1]
+	s.IndexField = s.CompositeIndexField()
+	assert.False(t, s.IsValidNewSchema())
+}
+
+func TestUniqueHsetIndexSchema(t *testing.T) {
+	s := HsetIndexSchema{
+		Name:       "test",
+		IndexField: "email",
+		ValueType:  StringV,
+		Unique:     PartitionUniqueIndex,
+	}
+	assert.True(t, s.IsValidNewSchema())
+	// the prefix index can not check the uniqueness for the whole value
+	s.PrefixLen = 4
+	assert.False(t, s.IsValidNewSchema())
+	s.Unique = 0
+	assert.True(t, s.IsValidNewSchema())
+	s.PrefixLen = 0
+	s.Unique = GlobalUniqueIndex
+	assert.False(t, s.IsValidNewSchema())
+}
+
+func TestNormalizeJSONIndexPath(t *testing.T) {
+	cases := map[string]string{
+		"a":            "a",
+		".a":           "a",
+		"$.a":          "a",
+		" $.a.b ":      "a.b",
+		"$":            "",
+		" . ":          "",
+		"$.tags[0]":    "$.tags[0]",
+		"$..name":      "$..name",
+		"$.a.*":        "$.a.*",
+		"$['a.b']":     "$['a.b']",
+		"$.a:b":        "$.a:b",
+		"address.city": "address.city",
+	}
+	for p, expected := range cases {
+		assert.Equal(t, expected, NormalizeJSONIndexPath(p), p)
+	}
+	assert.False(t, (&JSONIndexSchema{Name: "a", Path: "$"}).IsValidNewSchema())
+	assert.True(t, (&JSONIndexSchema{Name: "a", Path: "$.a"}).IsValidNewSchema())
+}
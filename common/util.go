@@ -23,6 +23,10 @@ const (
 	// check if the namespace raft node is synced and can be elected as leader immediately
 	APIIsRaftSynced = "/cluster/israftsynced"
 	APITableStats   = "/tablestats"
+	// the index build and verify jobs of the namespace partition
+	APIIndexJobs          = "/schema/index/jobs"
+	APIIndexBuildThrottle = "/schema/index/throttle"
+	APIIndexVerify        = "/schema/index/verify"
 
 	// below api for pd
 	APIGetSnapshotSyncInfo = "/pd/snapshot_sync_info"
@@ -199,12 +203,30 @@ func IsMergeIndexSearchCommand(cmd string) bool {
 	if len(cmd) != len("hidx.from") {
 		return false
 	}
-	return strings.ToLower(cmd) == "hidx.from"
+	lcmd := strings.ToLower(cmd)
+	return lcmd == "hidx.from" || lcmd == "jidx.from"
 }
 
 func IsMergeKeysCommand(cmd string) bool {
 	lcmd := strings.ToLower(cmd)
-	return lcmd == "plset" || lcmd == "exists" || lcmd == "del"
+	return lcmd == "plset" || lcmd == "exists" || lcmd == "del" || lcmd == "json.mget"
+}
+
+func IsMergeTSRangeCommand(cmd string) bool {
+	lcmd := strings.ToLower(cmd)
+	return lcmd == "ts.mrange" || lcmd == "ts.mrevrange"
+}
+
+func IsMergeFullTextSearchCommand(cmd string) bool {
+	return strings.ToLower(cmd) == "ft.search"
+}
+
+func IsMergeColumnAggCommand(cmd string) bool {
+	return strings.ToLower(cmd) == "col.agg"
+}
+
+func IsMergeSQLCommand(cmd string) bool {
+	return strings.ToLower(cmd) == "sql"
 }
 
 func IsMergeCommand(cmd string) bool {
@@ -216,6 +238,22 @@ func IsMergeCommand(cmd string) bool {
 		return true
 	}
 
+	if IsMergeTSRangeCommand(cmd) {
+		return true
+	}
+
+	if IsMergeFullTextSearchCommand(cmd) {
+		return true
+	}
+
+	if IsMergeColumnAggCommand(cmd) {
+		return true
+	}
+
+	if IsMergeSQLCommand(cmd) {
+		return true
+	}
+
 	if IsMergeKeysCommand(cmd) {
 		return true
 	}
@@ -0,0 +1,745 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/options"
+	"github.com/dgraph-io/badger/table"
+	"github.com/dgraph-io/badger/y"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+const (
+	// the max value length which can be stored in the lsm tree of badger
+	badgerMaxValueThreshold = 65500
+	badgerValueLogGCRatio   = 0.5
+)
+
+type sharedBadgerConfig struct {
+}
+
+func newSharedBadgerConfig(opt RockOptions) *sharedBadgerConfig {
+	sc := &sharedBadgerConfig{}
+	return sc
+}
+
+func (sc *sharedBadgerConfig) ChangeLimiter(bytesPerSec int64) {
+}
+
+func (sc *sharedBadgerConfig) Destroy() {
+}
+
+type badgerRefSlice struct {
+	b []byte
+}
+
+func (rs *badgerRefSlice) Free() {
+}
+
+func (rs *badgerRefSlice) Bytes() []byte {
+	return rs.b
+}
+
+func (rs *badgerRefSlice) Data() []byte {
+	return rs.b
+}
+
+type BadgerEng struct {
+	rwmutex sync.RWMutex
+	// all the write batches are committed one by one
+	writeMutex  sync.Mutex
+	cfg         *RockEngConfig
+	eng         *badger.DB
+	opts        badger.Options
+	wb          *badgerWriteBatch
+	engOpened   int32
+	lastCompact int64
+	deletedCnt  int64
+	quit        chan struct{}
+	// the resolved operations of the large batch which is not fully applied
+	pendingOps     []writeOp
+	tableKeysMutex sync.Mutex
+	tableKeys      map[uint64]*badgerTableKeys
+}
+
+func NewBadgerEng(cfg *RockEngConfig) (*BadgerEng, error) {
+	if len(cfg.DataDir) == 0 {
+		return nil, errors.New("config error")
+	}
+
+	err := os.MkdirAll(cfg.DataDir, common.DIR_PERM)
+	if err != nil {
+		return nil, err
+	}
+	opts := badger.DefaultOptions
+	opts.SyncWrites = !cfg.DisableWAL
+	opts.Truncate = true
+	opts.Logger = dbLog
+	opts.TableLoadingMode = options.MemoryMap
+	opts.MaxTableSize = int64(cfg.TargetFileSizeBase)
+	opts.LevelOneSize = int64(cfg.MaxBytesForLevelBase)
+	opts.NumLevelZeroTables = cfg.Level0FileNumCompactionTrigger
+	if opts.NumLevelZeroTables < 2 {
+		opts.NumLevelZeroTables = 2
+	}
+	if opts.NumLevelZeroTablesStall <= opts.NumLevelZeroTables {
+		opts.NumLevelZeroTablesStall = opts.NumLevelZeroTables * 2
+	}
+	// the values larger than the threshold will be stored in the value log to
+	// reduce the write amplification of the lsm tree
+	opts.ValueThreshold = cfg.BadgerValueThreshold
+	if opts.ValueThreshold <= 0 || opts.ValueThreshold > badgerMaxValueThreshold {
+		opts.ValueThreshold = badgerMaxValueThreshold
+	}
+	if cfg.DisableMergeCounter {
+		cfg.EnableTableCounter = false
+	}
+	db := &BadgerEng{
+		cfg:  cfg,
+		opts: opts,
+		quit: make(chan struct{}),
+	}
+	db.opts.Dir = db.GetDataDir()
+	db.opts.ValueDir = db.GetDataDir()
+	go db.compactLoop()
+
+	return db, nil
+}
+
+func (be *BadgerEng) NewWriteBatch() WriteBatch {
+	if be.eng == nil {
+		panic("nil engine, should only get write batch after db opened")
+	}
+	return newBadgerWriteBatch(be)
+}
+
+func (be *BadgerEng) DefaultWriteBatch() WriteBatch {
+	if be.wb == nil {
+		panic("nil write batch, should only get write batch after db opened")
+	}
+	return be.wb
+}
+
+func (be *BadgerEng) GetDataDir() string {
+	return path.Join(be.cfg.DataDir, "badger")
+}
+
+func (be *BadgerEng) SetMaxBackgroundOptions(maxCompact int, maxBackJobs int) error {
+	return nil
+}
+
+// the space of the value log can only be reclaimed by the value log gc, so we
+// run the value log gc periodically even if the auto compaction is disabled.
+func (be *BadgerEng) compactLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	gcTicker := time.NewTicker(time.Minute * 10)
+	defer gcTicker.Stop()
+	interval := (time.Hour / time.Second).Nanoseconds()
+	dbLog.Infof("start auto compact loop : %v", interval)
+	for {
+		select {
+		case <-be.quit:
+			return
+		case <-gcTicker.C:
+			be.runValueLogGC()
+		case <-ticker.C:
+			if be.cfg.AutoCompacted && (be.DeletedBeforeCompact() > compactThreshold) &&
+				(time.Now().Unix()-be.LastCompactTime()) > interval {
+				dbLog.Infof("auto compact : %v, %v", be.DeletedBeforeCompact(), be.LastCompactTime())
+				be.CompactAllRange()
+			}
+		}
+	}
+}
+
+func (be *BadgerEng) runValueLogGC() {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		return
+	}
+	for {
+		select {
+		case <-be.quit:
+			return
+		default:
+		}
+		// rewrite the value log files until no file can be rewritten
+		err := be.eng.RunValueLogGC(badgerValueLogGCRatio)
+		if err != nil {
+			if err != badger.ErrNoRewrite {
+				dbLog.Infof("value log gc failed: %v", err)
+			}
+			return
+		}
+	}
+}
+
+func (be *BadgerEng) CheckDBEngForRead(fullPath string) error {
+	// badger returns nil error for the read only open if the dir not exist
+	_, err := os.Stat(fullPath)
+	if err != nil {
+		return err
+	}
+	ro := be.opts
+	ro.Dir = fullPath
+	ro.ValueDir = fullPath
+	ro.ReadOnly = true
+	db, err := badger.Open(ro)
+	if err != nil {
+		return err
+	}
+	db.Close()
+	return nil
+}
+
+func (be *BadgerEng) OpenEng() error {
+	if !be.IsClosed() {
+		dbLog.Warningf("engine already opened: %v, should close it before reopen", be.GetDataDir())
+		return errors.New("open failed since not closed")
+	}
+	be.rwmutex.Lock()
+	defer be.rwmutex.Unlock()
+	eng, err := badger.Open(be.opts)
+	if err != nil {
+		return err
+	}
+	be.eng = eng
+	be.pendingOps = nil
+	err = be.loadPendingOps()
+	if err != nil {
+		dbLog.Warningf("failed to apply the pending large batch: %v, %v", be.GetDataDir(), err.Error())
+		eng.Close()
+		be.eng = nil
+		return err
+	}
+	be.wb = newBadgerWriteBatch(be)
+	atomic.StoreInt32(&be.engOpened, 1)
+	dbLog.Infof("engine opened: %v", be.GetDataDir())
+	return nil
+}
+
+func (be *BadgerEng) Write(wb WriteBatch) error {
+	return wb.Commit()
+}
+
+func (be *BadgerEng) DeletedBeforeCompact() int64 {
+	return atomic.LoadInt64(&be.deletedCnt)
+}
+
+func (be *BadgerEng) AddDeletedCnt(c int64) {
+	atomic.AddInt64(&be.deletedCnt, c)
+}
+
+func (be *BadgerEng) LastCompactTime() int64 {
+	return atomic.LoadInt64(&be.lastCompact)
+}
+
+// badger can not compact the given range, so all the tables will be compacted
+// to the same level and the value log is rewritten.
+func (be *BadgerEng) CompactRange(rg CRange) {
+	atomic.StoreInt64(&be.lastCompact, time.Now().Unix())
+	atomic.StoreInt64(&be.deletedCnt, 0)
+	be.rwmutex.RLock()
+	closed := be.IsClosed()
+	if !closed {
+		err := be.eng.Flatten(be.opts.NumCompactors)
+		if err != nil {
+			dbLog.Infof("compact failed: %v", err)
+		}
+	}
+	be.rwmutex.RUnlock()
+	if !closed {
+		be.runValueLogGC()
+	}
+}
+
+func (be *BadgerEng) CompactAllRange() {
+	be.CompactRange(CRange{})
+}
+
+// the key number is the total key number of the tables, the multi versions of the key in
+// different levels and the keys in the memtable are not excluded.
+func (be *BadgerEng) GetApproximateTotalKeyNum() int {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		return 0
+	}
+	total := uint64(0)
+	for _, t := range be.eng.Tables() {
+		tk := be.getTableKeys(t.ID)
+		if tk != nil {
+			total += tk.num
+		}
+	}
+	return int(total)
+}
+
+// the key number of the tables fully in the range is counted, and the key number of the
+// tables partially overlapped with the range is estimated by the sampled keys of the table.
+func (be *BadgerEng) GetApproximateKeyNum(ranges []CRange) uint64 {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		return 0
+	}
+	total := uint64(0)
+	for _, t := range be.eng.Tables() {
+		left := y.ParseKey(t.Left)
+		right := y.ParseKey(t.Right)
+		for _, r := range ranges {
+			if r.Limit != nil && bytes.Compare(left, r.Limit) >= 0 {
+				continue
+			}
+			if r.Start != nil && bytes.Compare(right, r.Start) < 0 {
+				continue
+			}
+			tk := be.getTableKeys(t.ID)
+			if tk == nil {
+				continue
+			}
+			if tk.num == 0 {
+				continue
+			}
+			if (r.Start == nil || bytes.Compare(tk.smallest, r.Start) >= 0) &&
+				(r.Limit == nil || bytes.Compare(tk.largest, r.Limit) < 0) {
+				total += tk.num
+				continue
+			}
+			cnt := uint64(0)
+			for _, k := range tk.samples {
+				if r.Start != nil && bytes.Compare(k, r.Start) < 0 {
+					continue
+				}
+				if r.Limit != nil && bytes.Compare(k, r.Limit) >= 0 {
+					break
+				}
+				cnt += badgerKeySampleInterval
+			}
+			if cnt > tk.num {
+				cnt = tk.num
+			}
+			total += cnt
+		}
+	}
+	return total
+}
+
+const badgerKeySampleInterval = 128
+
+var badgerInternalKeyPrefix = []byte("!badger!")
+
+type badgerTableKeys struct {
+	num      uint64
+	smallest []byte
+	largest  []byte
+	// the key at every badgerKeySampleInterval keys in the table
+	samples [][]byte
+}
+
+// the tables are immutable, so the key number of the table is cached by the table id,
+// and the cache of the tables removed by compaction will be cleaned while refreshing.
+func (be *BadgerEng) getTableKeys(id uint64) *badgerTableKeys {
+	be.tableKeysMutex.Lock()
+	tk, ok := be.tableKeys[id]
+	be.tableKeysMutex.Unlock()
+	if ok {
+		return tk
+	}
+	tk, err := loadBadgerTableKeys(table.NewFilename(id, be.opts.Dir))
+	if err != nil {
+		dbLog.Infof("failed to load the table keys: %v, %v", id, err.Error())
+		return nil
+	}
+	be.tableKeysMutex.Lock()
+	if be.tableKeys == nil || len(be.tableKeys) > 2*len(be.eng.Tables()) {
+		newKeys := make(map[uint64]*badgerTableKeys)
+		for _, t := range be.eng.Tables() {
+			if old, ok := be.tableKeys[t.ID]; ok {
+				newKeys[t.ID] = old
+			}
+		}
+		be.tableKeys = newKeys
+	}
+	be.tableKeys[id] = tk
+	be.tableKeysMutex.Unlock()
+	return tk
+}
+
+func loadBadgerTableKeys(fileName string) (*badgerTableKeys, error) {
+	fd, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	// the table file may be removed by the compaction, so we load it to the memory
+	// instead of mmap
+	t, err := table.OpenTable(fd, options.LoadToRAM, nil)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	defer t.Close()
+	it := t.NewIterator(false)
+	defer it.Close()
+	tk := &badgerTableKeys{}
+	var last []byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		k := y.ParseKey(it.Key())
+		// ignore the internal keys of badger
+		if bytes.HasPrefix(k, badgerInternalKeyPrefix) {
+			continue
+		}
+		if tk.num%badgerKeySampleInterval == 0 {
+			tk.samples = append(tk.samples, copyBytes(k))
+		}
+		if tk.num == 0 {
+			tk.smallest = copyBytes(k)
+		}
+		last = append(last[:0], k...)
+		tk.num++
+	}
+	tk.largest = copyBytes(last)
+	return tk, nil
+}
+
+func (be *BadgerEng) SetOptsForLogStorage() {
+	return
+}
+
+// the size is the total size of the tables overlapped with the range, and the size of
+// the values in the value log is estimated by the ratio of the total value log size
+// to the total lsm size. The data in memtable is not included.
+func (be *BadgerEng) GetApproximateSizes(ranges []CRange, includeMem bool) []uint64 {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	sizeList := make([]uint64, len(ranges))
+	if be.IsClosed() {
+		return sizeList
+	}
+	tables := be.eng.Tables()
+	tableSizes := make([]uint64, len(tables))
+	for i, t := range tables {
+		fi, err := os.Stat(table.NewFilename(t.ID, be.opts.Dir))
+		if err != nil {
+			continue
+		}
+		tableSizes[i] = uint64(fi.Size())
+	}
+	lsmSize, vlogSize := be.eng.Size()
+	for i, r := range ranges {
+		for ti, t := range tables {
+			left := y.ParseKey(t.Left)
+			right := y.ParseKey(t.Right)
+			if r.Limit != nil && bytes.Compare(left, r.Limit) >= 0 {
+				continue
+			}
+			if r.Start != nil && bytes.Compare(right, r.Start) < 0 {
+				continue
+			}
+			sizeList[i] += tableSizes[ti]
+		}
+		if lsmSize > 0 && vlogSize > 0 {
+			sizeList[i] += uint64(float64(sizeList[i]) * float64(vlogSize) / float64(lsmSize))
+		}
+	}
+	return sizeList
+}
+
+func (be *BadgerEng) IsClosed() bool {
+	if atomic.LoadInt32(&be.engOpened) == 0 {
+		return true
+	}
+	return false
+}
+
+func (be *BadgerEng) CloseEng() bool {
+	be.rwmutex.Lock()
+	defer be.rwmutex.Unlock()
+	if be.eng != nil {
+		if atomic.CompareAndSwapInt32(&be.engOpened, 1, 0) {
+			if be.wb != nil {
+				be.wb.Destroy()
+			}
+			be.eng.Close()
+			dbLog.Infof("engine closed: %v", be.GetDataDir())
+			return true
+		}
+	}
+	return false
+}
+
+func (be *BadgerEng) CloseAll() {
+	select {
+	case <-be.quit:
+	default:
+		close(be.quit)
+	}
+	be.CloseEng()
+}
+
+func (be *BadgerEng) GetStatistics() string {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		return ""
+	}
+	lsmSize, vlogSize := be.eng.Size()
+	return fmt.Sprintf("lsm size: %v, value log size: %v, tables: %v",
+		lsmSize, vlogSize, len(be.eng.Tables()))
+}
+
+func (be *BadgerEng) GetInternalStatus() map[string]interface{} {
+	s := make(map[string]interface{})
+	s["internal"] = be.GetStatistics()
+	return s
+}
+
+func (be *BadgerEng) GetInternalPropertyStatus(p string) string {
+	return p
+}
+
+func (be *BadgerEng) GetBytesNoLock(key []byte) ([]byte, error) {
+	val, err := be.GetRefNoLock(key)
+	if err != nil {
+		return nil, err
+	}
+	return val.Bytes(), nil
+}
+
+func (be *BadgerEng) GetBytes(key []byte) ([]byte, error) {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		return nil, errDBEngClosed
+	}
+	return be.GetBytesNoLock(key)
+}
+
+func (be *BadgerEng) MultiGetBytes(keyList [][]byte, values [][]byte, errs []error) {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		for i, _ := range errs {
+			errs[i] = errDBEngClosed
+		}
+		return
+	}
+	txn := be.eng.NewTransaction(false)
+	defer txn.Discard()
+	for i, k := range keyList {
+		values[i], errs[i] = badgerTxnGet(txn, k)
+	}
+}
+
+func (be *BadgerEng) Exist(key []byte) (bool, error) {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		return false, errDBEngClosed
+	}
+	return be.ExistNoLock(key)
+}
+
+func (be *BadgerEng) ExistNoLock(key []byte) (bool, error) {
+	txn := be.eng.NewTransaction(false)
+	defer txn.Discard()
+	_, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// the value is copied out of the transaction, so the slice need not be freed
+func badgerTxnGet(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		v = []byte{}
+	}
+	return v, nil
+}
+
+func (be *BadgerEng) GetRefNoLock(key []byte) (RefSlice, error) {
+	txn := be.eng.NewTransaction(false)
+	defer txn.Discard()
+	v, err := badgerTxnGet(txn, key)
+	if err != nil {
+		return nil, err
+	}
+	return &badgerRefSlice{b: v}, nil
+}
+
+func (be *BadgerEng) GetRef(key []byte) (RefSlice, error) {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		return nil, errDBEngClosed
+	}
+	return be.GetRefNoLock(key)
+}
+
+func (be *BadgerEng) GetValueWithOp(key []byte,
+	op func([]byte) error) error {
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		return errDBEngClosed
+	}
+	return be.GetValueWithOpNoLock(key, op)
+}
+
+func (be *BadgerEng) GetValueWithOpNoLock(key []byte,
+	op func([]byte) error) error {
+	txn := be.eng.NewTransaction(false)
+	defer txn.Discard()
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return op(nil)
+	}
+	if err != nil {
+		return err
+	}
+	return item.Value(func(v []byte) error {
+		if v == nil {
+			v = []byte{}
+		}
+		return op(v)
+	})
+}
+
+// the whole range is dropped only if all the keys in range have the same prefix,
+// otherwise the data will be deleted by the delete range in the write batch.
+func (be *BadgerEng) DeleteFilesInRange(rg CRange) {
+	prefix := rangeToPrefix(rg)
+	if prefix == nil {
+		return
+	}
+	be.rwmutex.RLock()
+	defer be.rwmutex.RUnlock()
+	if be.IsClosed() {
+		return
+	}
+	// drop prefix will block the writes, and the writes should not happen on the
+	// range which is deleted
+	be.writeMutex.Lock()
+	defer be.writeMutex.Unlock()
+	err := be.eng.DropPrefix(prefix)
+	if err != nil {
+		dbLog.Infof("drop prefix %v failed: %v", prefix, err)
+	}
+}
+
+// return the prefix if the range [start, limit) contains all the keys with the prefix
+func rangeToPrefix(rg CRange) []byte {
+	if len(rg.Start) == 0 || len(rg.Limit) != len(rg.Start) {
+		return nil
+	}
+	// the limit should be the prefix with the last byte increased
+	n := len(rg.Start) - 1
+	if rg.Start[n] == 0xff || !bytes.Equal(rg.Start[:n], rg.Limit[:n]) ||
+		rg.Start[n]+1 != rg.Limit[n] {
+		return nil
+	}
+	return rg.Start
+}
+
+func (be *BadgerEng) GetIterator(opts IteratorOpts) (Iterator, error) {
+	dbit, err := newBadgerIterator(be, opts)
+	if err != nil {
+		return nil, err
+	}
+	return dbit, nil
+}
+
+func (be *BadgerEng) NewCheckpoint() (KVCheckpoint, error) {
+	return &badgerEngCheckpoint{
+		be: be,
+	}, nil
+}
+
+type badgerEngCheckpoint struct {
+	be *BadgerEng
+}
+
+// Save copy all the data in the snapshot to a new badger db in the path, so the
+// checkpoint can be opened as the data dir of the badger engine.
+func (bck *badgerEngCheckpoint) Save(path string, notify chan struct{}) error {
+	bck.be.rwmutex.RLock()
+	defer bck.be.rwmutex.RUnlock()
+	if bck.be.IsClosed() {
+		return errDBEngClosed
+	}
+	// the snapshot should not include the partial large batch
+	bck.be.writeMutex.Lock()
+	err := bck.be.applyPendingOps()
+	if err != nil {
+		bck.be.writeMutex.Unlock()
+		return err
+	}
+	txn := bck.be.eng.NewTransaction(false)
+	bck.be.writeMutex.Unlock()
+	defer txn.Discard()
+	if notify != nil {
+		close(notify)
+	}
+	opts := bck.be.opts
+	opts.Dir = path
+	opts.ValueDir = path
+	opts.SyncWrites = false
+	err = os.MkdirAll(path, common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	ckdb, err := badger.Open(opts)
+	if err != nil {
+		return err
+	}
+	err = copyBadgerSnapshot(txn, ckdb)
+	if err != nil {
+		ckdb.Close()
+		return err
+	}
+	return ckdb.Close()
+}
+
+func copyBadgerSnapshot(txn *badger.Txn, dst *badger.DB) error {
+	wb := dst.NewWriteBatch()
+	defer wb.Cancel()
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		err = wb.Set(item.KeyCopy(nil), v, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
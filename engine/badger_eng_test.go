@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func TestBadgerWriteBatchAndIterator(t *testing.T) {
+	SetLogger(0, nil)
+	cfg := NewRockConfig()
+	tmpDir, err := ioutil.TempDir("", "badger")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg.DataDir = tmpDir
+	// store the large values in the value log
+	cfg.BadgerValueThreshold = 64
+	be, err := NewBadgerEng(cfg)
+	assert.Nil(t, err)
+	err = be.OpenEng()
+	assert.Nil(t, err)
+	defer be.CloseAll()
+
+	wb := be.DefaultWriteBatch()
+	for i := 0; i < 10; i++ {
+		wb.Put([]byte("test"+strconv.Itoa(i)), []byte("v"+strconv.Itoa(i)))
+	}
+	wb.Put([]byte("big"), make([]byte, 1000))
+	cnt := make([]byte, 8)
+	binary.LittleEndian.PutUint64(cnt, 3)
+	wb.Merge([]byte("cnt"), cnt)
+	wb.Merge([]byte("cnt"), cnt)
+	err = be.Write(wb)
+	assert.Nil(t, err)
+
+	v, err := be.GetBytes([]byte("test1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), v)
+	v, err = be.GetBytes([]byte("nokey"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	v, err = be.GetBytes([]byte("big"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(v))
+	n, err := GetRocksdbUint64(be.GetBytes([]byte("cnt")))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6), n)
+
+	it, err := be.GetIterator(IteratorOpts{
+		Range: Range{Min: []byte("test2"), Max: []byte("test5"), Type: common.RangeClose},
+	})
+	assert.Nil(t, err)
+	keys := make([]string, 0)
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	assert.Equal(t, []string{"test2", "test3", "test4", "test5"}, keys)
+	keys = keys[:0]
+	for it.SeekToLast(); it.Valid(); it.Prev() {
+		keys = append(keys, string(it.Key()))
+	}
+	assert.Equal(t, []string{"test5", "test4", "test3", "test2"}, keys)
+	// change the direction
+	it.Seek([]byte("test3"))
+	it.Next()
+	it.Prev()
+	assert.Equal(t, []byte("test3"), it.Key())
+	assert.Equal(t, []byte("v3"), it.Value())
+	it.SeekForPrev([]byte("test45"))
+	assert.Equal(t, []byte("test4"), it.Key())
+	it.Close()
+
+	wb.DeleteRange([]byte("test3"), []byte("test6"))
+	wb.Put([]byte("test4"), []byte("new"))
+	err = be.Write(wb)
+	assert.Nil(t, err)
+	v, err = be.GetBytes([]byte("test3"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	v, err = be.GetBytes([]byte("test4"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), v)
+	v, err = be.GetBytes([]byte("test6"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v6"), v)
+
+	be.DeleteFilesInRange(CRange{Start: []byte("test"), Limit: []byte("tesu")})
+	v, err = be.GetBytes([]byte("test6"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	v, err = be.GetBytes([]byte("big"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(v))
+}
+
+func TestBadgerWriteBatchTooBig(t *testing.T) {
+	SetLogger(0, nil)
+	cfg := NewRockConfig()
+	tmpDir, err := ioutil.TempDir("", "badger")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg.DataDir = tmpDir
+	// limit the transaction size to about 150KB
+	cfg.TargetFileSizeBase = 1024 * 1024
+	be, err := NewBadgerEng(cfg)
+	assert.Nil(t, err)
+	err = be.OpenEng()
+	assert.Nil(t, err)
+	defer be.CloseAll()
+
+	wb := be.DefaultWriteBatch()
+	for i := 0; i < 100; i++ {
+		wb.Put([]byte("test"+strconv.Itoa(i)), make([]byte, 10000))
+		wb.Merge([]byte("counter"), make([]byte, 8))
+	}
+	wb.Merge([]byte("counter"), []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	// the batch larger than the transaction limit should be committed in several transactions
+	err = be.Write(wb)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		v, err := be.GetBytes([]byte("test" + strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, 10000, len(v))
+	}
+	v, err := be.GetBytes([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{1, 0, 0, 0, 0, 0, 0, 0}, v)
+	_, err = os.Stat(be.pendingOpsFile())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBadgerDeleteLargeRange(t *testing.T) {
+	SetLogger(0, nil)
+	cfg := NewRockConfig()
+	tmpDir, err := ioutil.TempDir("", "badger")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg.DataDir = tmpDir
+	cfg.TargetFileSizeBase = 1024 * 1024
+	be, err := NewBadgerEng(cfg)
+	assert.Nil(t, err)
+	err = be.OpenEng()
+	assert.Nil(t, err)
+	defer be.CloseAll()
+
+	keyNum := 30000
+	wb := be.NewWriteBatch()
+	for i := 0; i < keyNum; i++ {
+		wb.Put([]byte(fmt.Sprintf("test:%08d", i)), []byte("value"))
+		if i%1000 == 999 {
+			err = be.Write(wb)
+			assert.Nil(t, err)
+		}
+	}
+	wb.Put([]byte("tesu"), []byte("value"))
+	err = be.Write(wb)
+	assert.Nil(t, err)
+
+	// the range is larger than the transaction limit
+	wb.Put([]byte("test:new"), []byte("value"))
+	wb.DeleteRange([]byte("test:"), []byte("tesu"))
+	wb.Put([]byte("test:00000001"), []byte("new"))
+	err = be.Write(wb)
+	assert.Nil(t, err)
+
+	it, err := be.GetIterator(IteratorOpts{})
+	assert.Nil(t, err)
+	defer it.Close()
+	var keys []string
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		keys = append(keys, string(it.RefKey()))
+	}
+	assert.Equal(t, []string{"test:00000001", "tesu"}, keys)
+	v, err := be.GetBytes([]byte("test:00000001"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new"), v)
+}
+
+func TestBadgerReplayPendingLargeBatch(t *testing.T) {
+	SetLogger(0, nil)
+	cfg := NewRockConfig()
+	tmpDir, err := ioutil.TempDir("", "badger")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg.DataDir = tmpDir
+	be, err := NewBadgerEng(cfg)
+	assert.Nil(t, err)
+	err = be.OpenEng()
+	assert.Nil(t, err)
+	defer be.CloseAll()
+
+	wb := be.NewWriteBatch()
+	wb.Put([]byte("test1"), []byte("v1"))
+	wb.Put([]byte("test2"), []byte("v2"))
+	err = be.Write(wb)
+	assert.Nil(t, err)
+	// simulate the crash while applying the large batch
+	ops := []writeOp{
+		{op: DeleteRangeOp, key: []byte("test"), value: []byte("tesu")},
+		{op: PutOp, key: []byte("test3"), value: []byte("v3")},
+		{op: PutOp, key: []byte("empty"), value: []byte{}},
+		{op: DeleteRangeOp, key: []byte("z"), value: nil},
+	}
+	err = saveBadgerPendingOps(be.pendingOpsFile(), ops)
+	assert.Nil(t, err)
+	loaded, err := loadBadgerPendingOps(be.pendingOpsFile())
+	assert.Nil(t, err)
+	assert.Equal(t, ops, loaded)
+	be.CloseEng()
+	err = be.OpenEng()
+	assert.Nil(t, err)
+
+	v, err := be.GetBytes([]byte("test1"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	v, err = be.GetBytes([]byte("test3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3"), v)
+	_, err = os.Stat(be.pendingOpsFile())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBadgerApproximateKeyNum(t *testing.T) {
+	SetLogger(0, nil)
+	cfg := NewRockConfig()
+	tmpDir, err := ioutil.TempDir("", "badger")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg.DataDir = tmpDir
+	be, err := NewBadgerEng(cfg)
+	assert.Nil(t, err)
+	err = be.OpenEng()
+	assert.Nil(t, err)
+	defer be.CloseAll()
+
+	wb := be.NewWriteBatch()
+	for i := 0; i < 10000; i++ {
+		wb.Put([]byte(fmt.Sprintf("test:%08d", i)), []byte("value"))
+		if i%1000 == 999 {
+			err = be.Write(wb)
+			assert.Nil(t, err)
+		}
+	}
+	// flush the memtable to the tables
+	be.CloseEng()
+	err = be.OpenEng()
+	assert.Nil(t, err)
+
+	assert.Equal(t, 10000, be.GetApproximateTotalKeyNum())
+	assert.Equal(t, uint64(10000), be.GetApproximateKeyNum([]CRange{{Start: []byte("test:"), Limit: []byte("tesu")}}))
+	num := be.GetApproximateKeyNum([]CRange{{Start: []byte("test:00005000"), Limit: []byte("tesu")}})
+	assert.InDelta(t, 5000, num, 2*badgerKeySampleInterval)
+	assert.Equal(t, uint64(0), be.GetApproximateKeyNum([]CRange{{Start: []byte("tesu"), Limit: []byte("tesv")}}))
+}
+
+func TestBadgerCheckpointRestore(t *testing.T) {
+	SetLogger(0, nil)
+	cfg := NewRockConfig()
+	tmpDir, err := ioutil.TempDir("", "checkpoint")
+	assert.Nil(t, err)
+	t.Log(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	cfg.DataDir = path.Join(tmpDir, "test")
+	be, err := NewBadgerEng(cfg)
+	assert.Nil(t, err)
+	err = be.OpenEng()
+	assert.Nil(t, err)
+	defer be.CloseAll()
+	wb := be.DefaultWriteBatch()
+	wb.Put([]byte("test"), []byte("test"))
+	err = be.Write(wb)
+	assert.Nil(t, err)
+
+	ck, _ := be.NewCheckpoint()
+	ckPath := path.Join(tmpDir, "cktmp")
+	notify := make(chan struct{})
+	err = ck.Save(ckPath, notify)
+	assert.Nil(t, err)
+	<-notify
+	err = be.CheckDBEngForRead(ckPath)
+	assert.Nil(t, err)
+
+	// the checkpoint can be used as the data dir of the new engine
+	cfg2 := NewRockConfig()
+	cfg2.DataDir = path.Join(tmpDir, "test2")
+	be2, err := NewBadgerEng(cfg2)
+	assert.Nil(t, err)
+	err = os.Rename(ckPath, be2.GetDataDir())
+	assert.Nil(t, err)
+	err = be2.OpenEng()
+	assert.Nil(t, err)
+	defer be2.CloseAll()
+	v, err := be2.GetBytes([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("test"), v)
+
+	be.CloseEng()
+	err = be.OpenEng()
+	assert.Nil(t, err)
+	v, err = be.GetBytes([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("test"), v)
+}
@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"bytes"
+
+	"github.com/dgraph-io/badger"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+// the badger iterator can only move in one direction, so we create a new iterator
+// in the other direction while changing the direction.
+type badgerIterator struct {
+	db           *BadgerEng
+	txn          *badger.Txn
+	it           *badger.Iterator
+	reverse      bool
+	lowerBound   []byte
+	upperBound   []byte
+	valBuf       []byte
+	removeTsType byte
+}
+
+// low_bound is inclusive
+// upper bound is exclusive
+func newBadgerIterator(db *BadgerEng, opts IteratorOpts) (*badgerIterator, error) {
+	db.rwmutex.RLock()
+	if db.IsClosed() {
+		db.rwmutex.RUnlock()
+		return nil, errDBEngClosed
+	}
+	upperBound := opts.Max
+	lowerBound := opts.Min
+	if opts.Type&common.RangeROpen <= 0 && upperBound != nil {
+		// range right not open, we need inclusive the max,
+		// however upperBound is exclusive
+		upperBound = append(upperBound, 0)
+	}
+	// the read only transaction is always a snapshot of the db
+	dbit := &badgerIterator{
+		db:         db,
+		txn:        db.eng.NewTransaction(false),
+		lowerBound: lowerBound,
+		upperBound: upperBound,
+	}
+	dbit.resetIter(false)
+	return dbit, nil
+}
+
+func (it *badgerIterator) resetIter(reverse bool) {
+	if it.it != nil {
+		if it.reverse == reverse {
+			return
+		}
+		it.it.Close()
+	}
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Reverse = reverse
+	it.it = it.txn.NewIterator(opts)
+	it.reverse = reverse
+}
+
+func (it *badgerIterator) Next() {
+	if !it.reverse {
+		it.it.Next()
+		return
+	}
+	if !it.it.Valid() {
+		return
+	}
+	cur := it.it.Item().KeyCopy(nil)
+	it.resetIter(false)
+	it.it.Seek(cur)
+	if it.it.Valid() && bytes.Equal(it.it.Item().Key(), cur) {
+		it.it.Next()
+	}
+}
+
+func (it *badgerIterator) Prev() {
+	if it.reverse {
+		it.it.Next()
+		return
+	}
+	if !it.it.Valid() {
+		return
+	}
+	cur := it.it.Item().KeyCopy(nil)
+	it.resetIter(true)
+	it.it.Seek(cur)
+	if it.it.Valid() && bytes.Equal(it.it.Item().Key(), cur) {
+		it.it.Next()
+	}
+}
+
+func (it *badgerIterator) Seek(key []byte) {
+	if it.lowerBound != nil && bytes.Compare(key, it.lowerBound) < 0 {
+		key = it.lowerBound
+	}
+	it.resetIter(false)
+	it.it.Seek(key)
+}
+
+// seek to the last key less than or equal to the key
+func (it *badgerIterator) SeekForPrev(key []byte) {
+	it.resetIter(true)
+	if it.upperBound != nil && bytes.Compare(key, it.upperBound) >= 0 {
+		it.seekToUpperBound()
+		return
+	}
+	it.it.Seek(key)
+}
+
+func (it *badgerIterator) SeekToFirst() {
+	it.resetIter(false)
+	if it.lowerBound != nil {
+		it.it.Seek(it.lowerBound)
+	} else {
+		it.it.Rewind()
+	}
+}
+
+func (it *badgerIterator) SeekToLast() {
+	it.resetIter(true)
+	if it.upperBound != nil {
+		it.seekToUpperBound()
+	} else {
+		it.it.Rewind()
+	}
+}
+
+// seek to the last key less than the exclusive upper bound
+func (it *badgerIterator) seekToUpperBound() {
+	it.it.Seek(it.upperBound)
+	if it.it.Valid() && bytes.Equal(it.it.Item().Key(), it.upperBound) {
+		it.it.Next()
+	}
+}
+
+func (it *badgerIterator) Valid() bool {
+	if !it.it.Valid() {
+		return false
+	}
+	k := it.it.Item().Key()
+	if it.lowerBound != nil && bytes.Compare(k, it.lowerBound) < 0 {
+		return false
+	}
+	if it.upperBound != nil && bytes.Compare(k, it.upperBound) >= 0 {
+		return false
+	}
+	return true
+}
+
+// the bytes returned will be freed after next
+func (it *badgerIterator) RefKey() []byte {
+	return it.it.Item().Key()
+}
+
+func (it *badgerIterator) Key() []byte {
+	return it.it.Item().KeyCopy(nil)
+}
+
+// the bytes returned will be freed after next
+func (it *badgerIterator) RefValue() []byte {
+	v, err := it.it.Item().ValueCopy(it.valBuf[:0])
+	if err != nil {
+		dbLog.Warningf("failed to read value for key %v: %v", it.it.Item().Key(), err)
+		return nil
+	}
+	it.valBuf = v
+	if (it.removeTsType == KVType || it.removeTsType == HashType) && len(v) >= tsLen {
+		v = v[:len(v)-tsLen]
+	}
+	return v
+}
+
+func (it *badgerIterator) Value() []byte {
+	v := it.RefValue()
+	if v == nil {
+		return nil
+	}
+	vv := make([]byte, len(v))
+	copy(vv, v)
+	return vv
+}
+
+func (it *badgerIterator) NoTimestamp(vt byte) {
+	it.removeTsType = vt
+}
+
+func (it *badgerIterator) Close() {
+	if it.it != nil {
+		it.it.Close()
+	}
+	if it.txn != nil {
+		it.txn.Discard()
+	}
+	it.db.rwmutex.RUnlock()
+}
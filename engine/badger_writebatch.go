@@ -0,0 +1,483 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/dgraph-io/badger"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+const (
+	badgerPendingOpsFile   = "pending_large_batch"
+	badgerDeleteRangeBatch = 10000
+	// the estimated size of the entry meta in the transaction
+	badgerEntryOverhead = 32
+)
+
+var errBadgerPendingOpsCorrupt = errors.New("the pending large batch file is corrupt")
+
+type badgerWriteBatch struct {
+	db  *BadgerEng
+	ops []writeOp
+}
+
+func newBadgerWriteBatch(db *BadgerEng) *badgerWriteBatch {
+	return &badgerWriteBatch{
+		db:  db,
+		ops: make([]writeOp, 0, 10),
+	}
+}
+
+func (wb *badgerWriteBatch) Destroy() {
+	wb.ops = wb.ops[:0]
+}
+
+func (wb *badgerWriteBatch) Clear() {
+	wb.ops = wb.ops[:0]
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+func (wb *badgerWriteBatch) DeleteRange(start, end []byte) {
+	wb.ops = append(wb.ops, writeOp{
+		op:    DeleteRangeOp,
+		key:   copyBytes(start),
+		value: copyBytes(end),
+	})
+}
+
+func (wb *badgerWriteBatch) Delete(key []byte) {
+	wb.ops = append(wb.ops, writeOp{
+		op:  DeleteOp,
+		key: copyBytes(key),
+	})
+}
+
+func (wb *badgerWriteBatch) Put(key []byte, value []byte) {
+	v := copyBytes(value)
+	if v == nil {
+		v = []byte{}
+	}
+	wb.ops = append(wb.ops, writeOp{
+		op:    PutOp,
+		key:   copyBytes(key),
+		value: v,
+	})
+}
+
+func (wb *badgerWriteBatch) Merge(key []byte, value []byte) {
+	wb.ops = append(wb.ops, writeOp{
+		op:    MergeOp,
+		key:   copyBytes(key),
+		value: copyBytes(value),
+	})
+}
+
+var errBadgerBatchTooBig = errors.New("the write batch is too big for the badger transaction")
+
+// Commit tries to commit the batch in one badger transaction first, so the merge operation
+// can read the value written by the previous operations in the same batch. If the batch is
+// larger than the limit of the badger transaction (about 15% of the max table size), such as
+// the large range delete or the large raft apply batch, the batch will be committed as a
+// large batch (see commitLargeOps).
+func (wb *badgerWriteBatch) Commit() error {
+	defer wb.Clear()
+	wb.db.rwmutex.RLock()
+	defer wb.db.rwmutex.RUnlock()
+	if wb.db.IsClosed() {
+		return errDBEngClosed
+	}
+	// merge need read before write, we serialize all the commits to avoid the
+	// conflict between the transactions
+	wb.db.writeMutex.Lock()
+	defer wb.db.writeMutex.Unlock()
+	// the previous large batch should be applied before any new write
+	err := wb.db.applyPendingOps()
+	if err != nil {
+		return err
+	}
+	err = wb.db.commitOps(wb.ops, false)
+	if err != errBadgerBatchTooBig {
+		return err
+	}
+	return wb.db.commitLargeOps(wb.ops)
+}
+
+// commit the operations in one transaction, or in several transactions if split is true.
+// The merge operations are not allowed while split since the merge is not idempotent.
+func (be *BadgerEng) commitOps(ops []writeOp, split bool) error {
+	bc := &badgerTxnCommitter{db: be.eng, txn: be.eng.NewTransaction(true), split: split}
+	defer func() {
+		bc.txn.Discard()
+	}()
+	for _, w := range ops {
+		var err error
+		switch w.op {
+		case DeleteOp:
+			err = bc.delete(w.key)
+		case PutOp:
+			err = bc.set(w.key, w.value)
+		case DeleteRangeOp:
+			err = bc.deleteRange(w.key, w.value)
+		case MergeOp:
+			if split {
+				return errors.New("merge operation can not be split")
+			}
+			err = bc.merge(w.key, w.value)
+		default:
+			return errors.New("unknown write operation")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bc.txn.Commit()
+}
+
+// commitLargeOps commits the batch larger than the transaction limit. The merge operations
+// are resolved to the put operations first, and all the resolved operations are saved to the
+// pending file before applying them in several transactions. Since the resolved operations are
+// idempotent, the pending file will be applied again while opening the engine if we crashed
+// while applying, so the batch is atomic after restart. Note the reader may see the partial
+// batch before it is fully applied. If the apply failed, the pending operations will be applied
+// again before the next commit, and all the new writes will fail until the pending operations
+// are applied, so no newer writes can be overwritten while replaying the pending file.
+//
+// With the WAL disabled the transactions are not synced, the same as the normal commits.
+func (be *BadgerEng) commitLargeOps(ops []writeOp) error {
+	resolved, err := be.resolveMergeOps(ops)
+	if err != nil {
+		return err
+	}
+	err = saveBadgerPendingOps(be.pendingOpsFile(), resolved)
+	if err != nil {
+		return err
+	}
+	be.pendingOps = resolved
+	return be.applyPendingOps()
+}
+
+func (be *BadgerEng) pendingOpsFile() string {
+	return path.Join(be.GetDataDir(), badgerPendingOpsFile)
+}
+
+func (be *BadgerEng) applyPendingOps() error {
+	if len(be.pendingOps) == 0 {
+		return nil
+	}
+	err := be.commitOps(be.pendingOps, true)
+	if err != nil {
+		dbLog.Warningf("failed to apply the pending large batch: %v", err.Error())
+		return err
+	}
+	err = os.Remove(be.pendingOpsFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	be.pendingOps = nil
+	return nil
+}
+
+// loadPendingOps loads the pending operations of the large batch which were not fully
+// applied before the engine closed.
+func (be *BadgerEng) loadPendingOps() error {
+	ops, err := loadBadgerPendingOps(be.pendingOpsFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	dbLog.Infof("apply the pending large batch: %v, operations: %v", be.GetDataDir(), len(ops))
+	be.pendingOps = ops
+	return be.applyPendingOps()
+}
+
+// resolve the merge operations to the put operations using the values written by the
+// previous operations in the batch or the values in db. Each operation should fit in
+// one transaction, otherwise the batch will fail without writing anything.
+func (be *BadgerEng) resolveMergeOps(ops []writeOp) ([]writeOp, error) {
+	maxSize := be.eng.MaxBatchSize()
+	for _, w := range ops {
+		// the value larger than the threshold is stored in the value log
+		vlen := len(w.value)
+		if vlen >= be.opts.ValueThreshold {
+			vlen = 0
+		}
+		if int64(len(w.key)+vlen+badgerEntryOverhead) >= maxSize {
+			return nil, errBadgerBatchTooBig
+		}
+	}
+	hasMerge := false
+	for _, w := range ops {
+		if w.op == MergeOp {
+			hasMerge = true
+			break
+		}
+	}
+	if !hasMerge {
+		return ops, nil
+	}
+	txn := be.eng.NewTransaction(false)
+	defer txn.Discard()
+	// the values written in the batch, nil for deleted
+	written := make(map[string][]byte)
+	deletedRanges := make([]writeOp, 0)
+	resolved := make([]writeOp, 0, len(ops))
+	for _, w := range ops {
+		switch w.op {
+		case PutOp:
+			written[string(w.key)] = w.value
+		case DeleteOp:
+			written[string(w.key)] = nil
+		case DeleteRangeOp:
+			for k := range written {
+				if bytes.Compare([]byte(k), w.key) >= 0 && (w.value == nil || bytes.Compare([]byte(k), w.value) < 0) {
+					delete(written, k)
+				}
+			}
+			deletedRanges = append(deletedRanges, w)
+		case MergeOp:
+			v, ok := written[string(w.key)]
+			var err error
+			if !ok && !inBadgerDeletedRanges(deletedRanges, w.key) {
+				var item *badger.Item
+				item, err = txn.Get(w.key)
+				if err == nil {
+					v, err = item.ValueCopy(nil)
+				} else if err == badger.ErrKeyNotFound {
+					err = nil
+				}
+			}
+			cur, err := GetRocksdbUint64(v, err)
+			if err != nil {
+				return nil, err
+			}
+			vint, err := GetRocksdbUint64(w.value, nil)
+			if err != nil {
+				return nil, err
+			}
+			buf := make([]byte, 8)
+			binary.LittleEndian.PutUint64(buf, cur+vint)
+			written[string(w.key)] = buf
+			resolved = append(resolved, writeOp{op: PutOp, key: w.key, value: buf})
+			continue
+		}
+		resolved = append(resolved, w)
+	}
+	return resolved, nil
+}
+
+func inBadgerDeletedRanges(ranges []writeOp, key []byte) bool {
+	for _, r := range ranges {
+		if bytes.Compare(key, r.key) >= 0 && (r.value == nil || bytes.Compare(key, r.value) < 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// the pending file is: [op(1 byte) keylen(uvarint) key valuelen+1(uvarint, 0 for nil) value]... crc32
+func saveBadgerPendingOps(fileName string, ops []writeOp) error {
+	buf := make([]byte, 0, 1024)
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, w := range ops {
+		buf = append(buf, byte(w.op))
+		n := binary.PutUvarint(lenBuf[:], uint64(len(w.key)))
+		buf = append(buf, lenBuf[:n]...)
+		buf = append(buf, w.key...)
+		vlen := uint64(0)
+		if w.value != nil {
+			vlen = uint64(len(w.value)) + 1
+		}
+		n = binary.PutUvarint(lenBuf[:], vlen)
+		buf = append(buf, lenBuf[:n]...)
+		buf = append(buf, w.value...)
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf))
+	buf = append(buf, sum[:]...)
+
+	tmpName := fileName + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, common.FILE_PERM)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	err = os.Rename(tmpName, fileName)
+	if err != nil {
+		return err
+	}
+	return syncDir(path.Dir(fileName))
+}
+
+func loadBadgerPendingOps(fileName string) ([]writeOp, error) {
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 4 {
+		return nil, errBadgerPendingOpsCorrupt
+	}
+	data := buf[:len(buf)-4]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(buf[len(buf)-4:]) {
+		return nil, errBadgerPendingOpsCorrupt
+	}
+	ops := make([]writeOp, 0, 100)
+	for len(data) > 0 {
+		var w writeOp
+		w.op = wop(data[0])
+		data = data[1:]
+		klen, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < klen {
+			return nil, errBadgerPendingOpsCorrupt
+		}
+		w.key = data[n : n+int(klen)]
+		data = data[n+int(klen):]
+		vlen, n := binary.Uvarint(data)
+		if n <= 0 || (vlen > 0 && uint64(len(data)-n) < vlen-1) {
+			return nil, errBadgerPendingOpsCorrupt
+		}
+		if vlen > 0 {
+			w.value = data[n : n+int(vlen-1)]
+			data = data[n+int(vlen-1):]
+		} else {
+			data = data[n:]
+		}
+		ops = append(ops, w)
+	}
+	return ops, nil
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+type badgerTxnCommitter struct {
+	db  *badger.DB
+	txn *badger.Txn
+	// commit the current transaction and begin a new one if the transaction is too big
+	split bool
+}
+
+func (bc *badgerTxnCommitter) renew() error {
+	err := bc.txn.Commit()
+	if err != nil {
+		return err
+	}
+	bc.txn = bc.db.NewTransaction(true)
+	return nil
+}
+
+func (bc *badgerTxnCommitter) set(key []byte, value []byte) error {
+	err := bc.txn.Set(key, value)
+	if err == badger.ErrTxnTooBig && bc.split {
+		if err = bc.renew(); err != nil {
+			return err
+		}
+		err = bc.txn.Set(key, value)
+	}
+	if err == badger.ErrTxnTooBig {
+		return errBadgerBatchTooBig
+	}
+	return err
+}
+
+func (bc *badgerTxnCommitter) delete(key []byte) error {
+	err := bc.txn.Delete(key)
+	if err == badger.ErrTxnTooBig && bc.split {
+		if err = bc.renew(); err != nil {
+			return err
+		}
+		err = bc.txn.Delete(key)
+	}
+	if err == badger.ErrTxnTooBig {
+		return errBadgerBatchTooBig
+	}
+	return err
+}
+
+// merge the uint64 value to the current value of the key which may be written in
+// the current transaction
+func (bc *badgerTxnCommitter) merge(key []byte, value []byte) error {
+	var v []byte
+	item, err := bc.txn.Get(key)
+	if err == nil {
+		v, err = item.ValueCopy(nil)
+	} else if err == badger.ErrKeyNotFound {
+		err = nil
+	}
+	cur, err := GetRocksdbUint64(v, err)
+	if err != nil {
+		return err
+	}
+	vint, err := GetRocksdbUint64(value, nil)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, cur+vint)
+	return bc.set(key, buf)
+}
+
+// delete the keys in range [start, end) including the keys written in the current
+// transaction, the keys are deleted in batches so the large range can be split into
+// several transactions.
+func (bc *badgerTxnCommitter) deleteRange(start []byte, end []byte) error {
+	for {
+		keys := bc.rangeKeys(start, end, badgerDeleteRangeBatch)
+		for _, k := range keys {
+			err := bc.delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		if len(keys) < badgerDeleteRangeBatch {
+			return nil
+		}
+		start = append(keys[len(keys)-1], 0)
+	}
+}
+
+// get at most limit keys in range [start, end) including the keys written in the current transaction
+func (bc *badgerTxnCommitter) rangeKeys(start []byte, end []byte, limit int) [][]byte {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := bc.txn.NewIterator(opts)
+	defer it.Close()
+	keys := make([][]byte, 0, 100)
+	for it.Seek(start); it.Valid() && len(keys) < limit; it.Next() {
+		k := it.Item().Key()
+		if end != nil && bytes.Compare(k, end) >= 0 {
+			break
+		}
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+	return keys
+}
@@ -791,8 +791,14 @@ func (i *biterator) SeekGE(item *kvitem) {
 	}
 }
 
+// SeekForPrev seeks to the last item less-than or equal to the key.
 func (i *biterator) SeekForPrev(key []byte) {
-	i.SeekLT(&kvitem{key: key})
+	item := &kvitem{key: key}
+	i.SeekGE(item)
+	if i.Valid() && bytes.Equal(i.Cur().key, key) {
+		return
+	}
+	i.SeekLT(item)
 }
 
 // SeekLT seeks to the first item less-than the provided item.
@@ -889,7 +895,7 @@ func (i *biterator) Prev() {
 
 // Valid returns whether the iterator is positioned at a valid position.
 func (i *biterator) Valid() bool {
-	return i.pos >= 0 && i.pos < i.n.count
+	return i.n != nil && i.pos >= 0 && i.pos < i.n.count
 }
 
 // Cur returns the item at the iterator's current position. It is illegal
@@ -0,0 +1,614 @@
+// Package conformance contains the tests which should be passed by all the
+// KVEngine implementations, so all the engines have the same behavior for the
+// rockredis. All the keys used in the tests have the same 3 bytes prefix, since
+// the rocksdb iterator only iterates the keys which have the same prefix as the
+// seek key.
+package conformance
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// NewEngineFunc should create the engine using the data dir without opening it
+type NewEngineFunc func(dataDir string) (engine.KVEngine, error)
+
+// RunKVEngineTests run all the conformance tests on the engine created by newEng,
+// the tests in skips will be skipped if the engine does not support them.
+func RunKVEngineTests(t *testing.T, newEng NewEngineFunc, skips ...string) {
+	run := func(name string, f func(t *testing.T, newEng NewEngineFunc)) {
+		t.Run(name, func(t *testing.T) {
+			for _, s := range skips {
+				if s == name {
+					t.Skip("not supported by the engine")
+				}
+			}
+			f(t, newEng)
+		})
+	}
+	run("GetPut", testGetPut)
+	run("GetRef", testGetRef)
+	run("WriteBatch", testWriteBatch)
+	run("Merge", testMerge)
+	run("MergeAfterPut", testMergeAfterPut)
+	run("DeleteRange", testDeleteRange)
+	run("IteratorBounds", testIteratorBounds)
+	run("IteratorSeek", testIteratorSeek)
+	run("IteratorDirection", testIteratorDirection)
+	run("IteratorNoTimestamp", testIteratorNoTimestamp)
+	run("Checkpoint", testCheckpoint)
+	run("Randomized", func(t *testing.T, newEng NewEngineFunc) {
+		RunRandomizedTests(t, newEng, time.Now().UnixNano(), 20)
+	})
+}
+
+func openTestEngine(t *testing.T, newEng NewEngineFunc) (engine.KVEngine, func()) {
+	dataDir, err := ioutil.TempDir("", "engine-conformance")
+	require.Nil(t, err)
+	eng, err := newEng(dataDir)
+	require.Nil(t, err)
+	err = eng.OpenEng()
+	require.Nil(t, err)
+	return eng, func() {
+		eng.CloseAll()
+		os.RemoveAll(dataDir)
+	}
+}
+
+func testKey(i int) []byte {
+	return []byte(fmt.Sprintf("tst:key%04d", i))
+}
+
+func testValue(i int) []byte {
+	return []byte(fmt.Sprintf("value%04d", i))
+}
+
+func putKeys(t *testing.T, eng engine.KVEngine, start int, end int) {
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	for i := start; i < end; i++ {
+		wb.Put(testKey(i), testValue(i))
+	}
+	err := eng.Write(wb)
+	require.Nil(t, err)
+}
+
+func uint64Value(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return buf
+}
+
+func testGetPut(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+	putKeys(t, eng, 0, 10)
+
+	v, err := eng.GetBytes(testKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(1), v)
+	v, err = eng.GetBytesNoLock(testKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(2), v)
+	v, err = eng.GetBytes(testKey(100))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	ok, err := eng.Exist(testKey(3))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = eng.ExistNoLock(testKey(100))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	keys := [][]byte{testKey(4), testKey(100), testKey(5)}
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	eng.MultiGetBytes(keys, values, errs)
+	assert.Equal(t, [][]byte{testValue(4), nil, testValue(5)}, values)
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+
+	var opValue []byte
+	err = eng.GetValueWithOp(testKey(6), func(v []byte) error {
+		opValue = append([]byte{}, v...)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(6), opValue)
+	err = eng.GetValueWithOpNoLock(testKey(100), func(v []byte) error {
+		opValue = v
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, opValue)
+
+	// overwrite and delete
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(testKey(1), testValue(100))
+	wb.Delete(testKey(2))
+	err = eng.Write(wb)
+	assert.Nil(t, err)
+	v, err = eng.GetBytes(testKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(100), v)
+	v, err = eng.GetBytes(testKey(2))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func testGetRef(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+	putKeys(t, eng, 0, 10)
+
+	ref, err := eng.GetRef(testKey(1))
+	assert.Nil(t, err)
+	require.NotNil(t, ref)
+	assert.Equal(t, testValue(1), ref.Data())
+	copied := ref.Bytes()
+
+	// the ref data should not be changed by the later writes before freed
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(testKey(1), testValue(100))
+	err = eng.Write(wb)
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(1), ref.Data())
+	ref.Free()
+	assert.Equal(t, testValue(1), copied)
+
+	ref, err = eng.GetRefNoLock(testKey(1))
+	assert.Nil(t, err)
+	require.NotNil(t, ref)
+	assert.Equal(t, testValue(100), ref.Data())
+	ref.Free()
+
+	// the ref for the key not found can be nil or with nil data
+	ref, err = eng.GetRef(testKey(100))
+	assert.Nil(t, err)
+	if ref != nil {
+		assert.Nil(t, ref.Data())
+		ref.Free()
+	}
+}
+
+func testWriteBatch(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	// the operations in the batch should be applied in order
+	wb.Put(testKey(1), testValue(1))
+	wb.Delete(testKey(1))
+	wb.Delete(testKey(2))
+	wb.Put(testKey(2), testValue(2))
+	wb.Put(testKey(3), testValue(3))
+	wb.Put(testKey(3), testValue(30))
+	// the data should be copied into the batch
+	buf := testKey(4)
+	wb.Put(buf, testValue(4))
+	copy(buf, testKey(5))
+	err := eng.Write(wb)
+	assert.Nil(t, err)
+	wb.Clear()
+
+	v, err := eng.GetBytes(testKey(1))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	v, err = eng.GetBytes(testKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(2), v)
+	v, err = eng.GetBytes(testKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(30), v)
+	v, err = eng.GetBytes(testKey(4))
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(4), v)
+
+	// the cleared operations should not be written
+	wb.Put(testKey(6), testValue(6))
+	wb.Clear()
+	wb.Put(testKey(7), testValue(7))
+	err = eng.Write(wb)
+	assert.Nil(t, err)
+	wb.Clear()
+	v, err = eng.GetBytes(testKey(6))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	v, err = eng.GetBytes(testKey(7))
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(7), v)
+
+	// the default write batch can be reused after cleared
+	dwb := eng.DefaultWriteBatch()
+	dwb.Put(testKey(8), testValue(8))
+	err = eng.Write(dwb)
+	assert.Nil(t, err)
+	dwb.Clear()
+	dwb.Put(testKey(9), testValue(9))
+	err = eng.Write(dwb)
+	assert.Nil(t, err)
+	dwb.Clear()
+	v, err = eng.GetBytes(testKey(8))
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(8), v)
+	v, err = eng.GetBytes(testKey(9))
+	assert.Nil(t, err)
+	assert.Equal(t, testValue(9), v)
+}
+
+func testMerge(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Merge(testKey(1), uint64Value(1))
+	wb.Merge(testKey(1), uint64Value(2))
+	wb.Merge(testKey(2), uint64Value(5))
+	err := eng.Write(wb)
+	assert.Nil(t, err)
+	wb.Clear()
+	wb.Merge(testKey(1), uint64Value(3))
+	wb.Delete(testKey(2))
+	wb.Merge(testKey(2), uint64Value(7))
+	err = eng.Write(wb)
+	assert.Nil(t, err)
+
+	n, err := engine.GetRocksdbUint64(eng.GetBytes(testKey(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6), n)
+	n, err = engine.GetRocksdbUint64(eng.GetBytes(testKey(2)))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), n)
+}
+
+// the merge operands should be added to the value written by put
+func testMergeAfterPut(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(testKey(1), uint64Value(10))
+	wb.Merge(testKey(1), uint64Value(5))
+	err := eng.Write(wb)
+	assert.Nil(t, err)
+	n, err := engine.GetRocksdbUint64(eng.GetBytes(testKey(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(15), n)
+
+	wb.Clear()
+	wb.Put(testKey(1), uint64Value(20))
+	err = eng.Write(wb)
+	assert.Nil(t, err)
+	wb.Clear()
+	wb.Merge(testKey(1), uint64Value(1))
+	err = eng.Write(wb)
+	assert.Nil(t, err)
+	n, err = engine.GetRocksdbUint64(eng.GetBytes(testKey(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(21), n)
+}
+
+func testDeleteRange(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+	putKeys(t, eng, 0, 20)
+
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.DeleteRange(testKey(5), testKey(10))
+	// the put before the delete range should be deleted
+	wb.Put(testKey(15), testValue(150))
+	wb.DeleteRange(testKey(12), testKey(16))
+	// the put after the delete range should be kept
+	wb.DeleteRange(testKey(0), testKey(3))
+	wb.Put(testKey(1), testValue(100))
+	err := eng.Write(wb)
+	assert.Nil(t, err)
+
+	expected := make(map[int][]byte)
+	for i := 0; i < 20; i++ {
+		expected[i] = testValue(i)
+	}
+	for i := 5; i < 10; i++ {
+		delete(expected, i)
+	}
+	for i := 12; i < 16; i++ {
+		delete(expected, i)
+	}
+	delete(expected, 0)
+	delete(expected, 2)
+	expected[1] = testValue(100)
+	for i := 0; i < 20; i++ {
+		v, err := eng.GetBytes(testKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, expected[i], v, "key %v", i)
+	}
+
+	// the data out of the range should not be deleted
+	eng.DeleteFilesInRange(engine.CRange{Start: testKey(16), Limit: testKey(18)})
+	for _, i := range []int{1, 3, 4, 10, 11, 18, 19} {
+		v, err := eng.GetBytes(testKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, expected[i], v, "key %v", i)
+	}
+}
+
+func iterKeys(it engine.Iterator, reverse bool) [][]byte {
+	keys := make([][]byte, 0)
+	for it.Valid() {
+		keys = append(keys, it.Key())
+		if reverse {
+			it.Prev()
+		} else {
+			it.Next()
+		}
+	}
+	return keys
+}
+
+func testKeys(start int, end int) [][]byte {
+	keys := make([][]byte, 0)
+	if start <= end {
+		for i := start; i <= end; i++ {
+			keys = append(keys, testKey(i))
+		}
+	} else {
+		for i := start; i >= end; i-- {
+			keys = append(keys, testKey(i))
+		}
+	}
+	return keys
+}
+
+func testIteratorBounds(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+	putKeys(t, eng, 0, 10)
+
+	it, err := eng.GetIterator(engine.IteratorOpts{})
+	require.Nil(t, err)
+	it.SeekToFirst()
+	assert.Equal(t, testKeys(0, 9), iterKeys(it, false))
+	it.SeekToLast()
+	assert.Equal(t, testKeys(9, 0), iterKeys(it, true))
+	it.Close()
+
+	// the max is inclusive if the range is closed
+	it, err = eng.GetIterator(engine.IteratorOpts{
+		Range: engine.Range{Min: testKey(2), Max: testKey(5), Type: common.RangeClose},
+	})
+	require.Nil(t, err)
+	it.SeekToFirst()
+	assert.Equal(t, testKeys(2, 5), iterKeys(it, false))
+	it.SeekToLast()
+	assert.Equal(t, testKeys(5, 2), iterKeys(it, true))
+	it.Close()
+
+	it, err = eng.GetIterator(engine.IteratorOpts{
+		Range: engine.Range{Min: testKey(2), Max: testKey(5), Type: common.RangeROpen},
+	})
+	require.Nil(t, err)
+	it.SeekToFirst()
+	assert.Equal(t, testKeys(2, 4), iterKeys(it, false))
+	it.SeekToLast()
+	assert.Equal(t, testKeys(4, 2), iterKeys(it, true))
+	it.Close()
+
+	// the bounds not matching any key
+	it, err = eng.GetIterator(engine.IteratorOpts{
+		Range: engine.Range{Min: []byte("tst:key00011"), Max: []byte("tst:key00012"), Type: common.RangeClose},
+	})
+	require.Nil(t, err)
+	it.SeekToFirst()
+	assert.False(t, it.Valid())
+	it.SeekToLast()
+	assert.False(t, it.Valid())
+	it.Close()
+
+	// the range iterator used by rockredis
+	rit, err := engine.NewDBRangeIteratorWithOpts(eng, engine.IteratorOpts{
+		Range:   engine.Range{Min: testKey(3), Max: testKey(7), Type: common.RangeOpen},
+		Reverse: true,
+	})
+	require.Nil(t, err)
+	keys := make([][]byte, 0)
+	for ; rit.Valid(); rit.Next() {
+		keys = append(keys, rit.Key())
+	}
+	rit.Close()
+	assert.Equal(t, testKeys(6, 4), keys)
+	rit, err = engine.NewDBRangeLimitIteratorWithOpts(eng, engine.IteratorOpts{
+		Range: engine.Range{Min: testKey(3), Max: testKey(7), Type: common.RangeClose},
+		Limit: engine.Limit{Offset: 1, Count: 2},
+	})
+	require.Nil(t, err)
+	keys = keys[:0]
+	for ; rit.Valid(); rit.Next() {
+		keys = append(keys, rit.Key())
+	}
+	rit.Close()
+	assert.Equal(t, testKeys(4, 5), keys)
+}
+
+func testIteratorSeek(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+	// only the even keys
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	for i := 0; i < 20; i += 2 {
+		wb.Put(testKey(i), testValue(i))
+	}
+	err := eng.Write(wb)
+	require.Nil(t, err)
+
+	it, err := eng.GetIterator(engine.IteratorOpts{
+		Range: engine.Range{Min: testKey(4), Max: testKey(12), Type: common.RangeClose},
+	})
+	require.Nil(t, err)
+	defer it.Close()
+	it.Seek(testKey(6))
+	assert.True(t, it.Valid())
+	assert.Equal(t, testKey(6), it.Key())
+	assert.Equal(t, testValue(6), it.Value())
+	it.Seek(testKey(7))
+	assert.True(t, it.Valid())
+	assert.Equal(t, testKey(8), it.Key())
+	// the seek key less than the lower bound
+	it.Seek(testKey(1))
+	assert.True(t, it.Valid())
+	assert.Equal(t, testKey(4), it.Key())
+	it.Seek(testKey(13))
+	assert.False(t, it.Valid())
+
+	// seek for prev should find the last key less than or equal to the seek key
+	it.SeekForPrev(testKey(8))
+	assert.True(t, it.Valid())
+	assert.Equal(t, testKey(8), it.Key())
+	it.SeekForPrev(testKey(9))
+	assert.True(t, it.Valid())
+	assert.Equal(t, testKey(8), it.Key())
+	// the seek key larger than the upper bound
+	it.SeekForPrev(testKey(18))
+	assert.True(t, it.Valid())
+	assert.Equal(t, testKey(12), it.Key())
+	it.SeekForPrev(testKey(3))
+	assert.False(t, it.Valid())
+}
+
+func testIteratorDirection(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+	putKeys(t, eng, 0, 10)
+
+	it, err := eng.GetIterator(engine.IteratorOpts{
+		Range: engine.Range{Min: testKey(2), Max: testKey(8), Type: common.RangeROpen},
+	})
+	require.Nil(t, err)
+	defer it.Close()
+	it.Seek(testKey(4))
+	it.Next()
+	assert.Equal(t, testKey(5), it.Key())
+	it.Prev()
+	assert.Equal(t, testKey(4), it.Key())
+	it.Prev()
+	assert.Equal(t, testKey(3), it.Key())
+	it.Next()
+	assert.Equal(t, testKey(4), it.Key())
+	// the key should be copied and not changed after moving
+	k := it.Key()
+	v := it.Value()
+	it.Next()
+	assert.Equal(t, testKey(4), k)
+	assert.Equal(t, testValue(4), v)
+	assert.Equal(t, testKey(5), it.RefKey())
+	assert.Equal(t, testValue(5), it.RefValue())
+
+	it.SeekToLast()
+	assert.Equal(t, testKey(7), it.Key())
+	it.Next()
+	assert.False(t, it.Valid())
+	it.SeekToFirst()
+	assert.Equal(t, testKey(2), it.Key())
+	it.Prev()
+	assert.False(t, it.Valid())
+}
+
+func testIteratorNoTimestamp(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+	value := append([]byte("value"), uint64Value(uint64(time.Now().UnixNano()))...)
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(testKey(1), value)
+	err := eng.Write(wb)
+	require.Nil(t, err)
+
+	it, err := eng.GetIterator(engine.IteratorOpts{})
+	require.Nil(t, err)
+	defer it.Close()
+	it.SeekToFirst()
+	assert.Equal(t, value, it.Value())
+	it.NoTimestamp(engine.KVType)
+	assert.Equal(t, []byte("value"), it.Value())
+	assert.Equal(t, []byte("value"), it.RefValue())
+}
+
+// the checkpoint should contain all the data written before saving and can be used
+// as the data dir of the new engine
+func testCheckpoint(t *testing.T, newEng NewEngineFunc) {
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+	putKeys(t, eng, 0, 10)
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Merge(testKey(100), uint64Value(3))
+	err := eng.Write(wb)
+	require.Nil(t, err)
+
+	ckDir, err := ioutil.TempDir("", "engine-conformance-checkpoint")
+	require.Nil(t, err)
+	defer os.RemoveAll(ckDir)
+	ckEng, err := newEng(ckDir)
+	require.Nil(t, err)
+	defer ckEng.CloseAll()
+
+	ck, err := eng.NewCheckpoint()
+	require.Nil(t, err)
+	notify := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- ck.Save(ckEng.GetDataDir(), notify)
+	}()
+	select {
+	case <-notify:
+	case <-time.After(time.Minute):
+		t.Fatal("checkpoint start notify timeout")
+	}
+	err = <-done
+	require.Nil(t, err)
+	// the writes after the checkpoint saved should not change the checkpoint
+	putKeys(t, eng, 10, 20)
+	wb.Clear()
+	wb.Delete(testKey(1))
+	err = eng.Write(wb)
+	require.Nil(t, err)
+
+	err = eng.CheckDBEngForRead(ckEng.GetDataDir())
+	assert.Nil(t, err)
+	err = eng.CheckDBEngForRead(path.Join(ckDir, "notexist"))
+	assert.NotNil(t, err)
+
+	err = ckEng.OpenEng()
+	require.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		v, err := ckEng.GetBytes(testKey(i))
+		assert.Nil(t, err)
+		if i < 10 {
+			assert.Equal(t, testValue(i), v)
+		} else {
+			assert.Nil(t, v)
+		}
+	}
+	n, err := engine.GetRocksdbUint64(ckEng.GetBytes(testKey(100)))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), n)
+	v, err := eng.GetBytes(testKey(1))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
@@ -0,0 +1,265 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+const (
+	randKeySpace   = 200
+	randCounterNum = 10
+)
+
+// the in-memory reference model of the engine
+type kvModel struct {
+	data map[string][]byte
+}
+
+func newKVModel() *kvModel {
+	return &kvModel{data: make(map[string][]byte)}
+}
+
+func (m *kvModel) put(key []byte, value []byte) {
+	m.data[string(key)] = append([]byte{}, value...)
+}
+
+func (m *kvModel) delete(key []byte) {
+	delete(m.data, string(key))
+}
+
+func (m *kvModel) deleteRange(start []byte, end []byte) {
+	for k := range m.data {
+		if k >= string(start) && k < string(end) {
+			delete(m.data, k)
+		}
+	}
+}
+
+func (m *kvModel) merge(key []byte, value []byte) {
+	var n uint64
+	if old, ok := m.data[string(key)]; ok && len(old) >= 8 {
+		n = binary.LittleEndian.Uint64(old)
+	}
+	m.data[string(key)] = uint64Value(n + binary.LittleEndian.Uint64(value))
+}
+
+func (m *kvModel) get(key []byte) []byte {
+	return m.data[string(key)]
+}
+
+// return the sorted keys in the range [min, max) or [min, max] if rangeClosed
+func (m *kvModel) keysInRange(min []byte, max []byte, rightClosed bool) [][]byte {
+	keys := make([][]byte, 0)
+	for k := range m.data {
+		if min != nil && k < string(min) {
+			continue
+		}
+		if max != nil {
+			if rightClosed && k > string(max) {
+				continue
+			}
+			if !rightClosed && k >= string(max) {
+				continue
+			}
+		}
+		keys = append(keys, []byte(k))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	return keys
+}
+
+func randKey(r *rand.Rand) []byte {
+	return []byte(fmt.Sprintf("rnd:key%05d", r.Intn(randKeySpace)))
+}
+
+// the counter keys are only changed by merge and delete, since merge on the
+// normal value is not defined for all the engines.
+func randCounterKey(r *rand.Rand) []byte {
+	return []byte(fmt.Sprintf("rnd:cnt%02d", r.Intn(randCounterNum)))
+}
+
+func randValue(r *rand.Rand) []byte {
+	v := make([]byte, 1+r.Intn(64))
+	r.Read(v)
+	return v
+}
+
+// return the ordered key pair
+func randRange(r *rand.Rand) ([]byte, []byte) {
+	start := randKey(r)
+	end := randKey(r)
+	if bytes.Compare(start, end) > 0 {
+		start, end = end, start
+	}
+	return start, end
+}
+
+// RunRandomizedTests apply the random write batches to both the engine and the in-memory
+// model, and check the results of reading and iterating after each round.
+func RunRandomizedTests(t *testing.T, newEng NewEngineFunc, seed int64, rounds int) {
+	t.Logf("random seed: %v", seed)
+	r := rand.New(rand.NewSource(seed))
+	eng, clean := openTestEngine(t, newEng)
+	defer clean()
+	m := newKVModel()
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	for round := 0; round < rounds; round++ {
+		wb.Clear()
+		opNum := 1 + r.Intn(100)
+		for i := 0; i < opNum; i++ {
+			switch op := r.Intn(100); {
+			case op < 60:
+				k := randKey(r)
+				v := randValue(r)
+				wb.Put(k, v)
+				m.put(k, v)
+			case op < 75:
+				k := randKey(r)
+				wb.Delete(k)
+				m.delete(k)
+			case op < 80:
+				start, end := randRange(r)
+				wb.DeleteRange(start, end)
+				m.deleteRange(start, end)
+			case op < 95:
+				k := randCounterKey(r)
+				v := uint64Value(uint64(r.Intn(1000)))
+				wb.Merge(k, v)
+				m.merge(k, v)
+			default:
+				k := randCounterKey(r)
+				wb.Delete(k)
+				m.delete(k)
+			}
+		}
+		err := eng.Write(wb)
+		require.Nil(t, err)
+		if !checkModel(t, r, eng, m, round) {
+			return
+		}
+	}
+}
+
+func checkModel(t *testing.T, r *rand.Rand, eng engine.KVEngine, m *kvModel, round int) bool {
+	for i := 0; i < 20; i++ {
+		k := randKey(r)
+		if r.Intn(4) == 0 {
+			k = randCounterKey(r)
+		}
+		v, err := eng.GetBytes(k)
+		if !assert.Nil(t, err) || !assert.Equal(t, m.get(k), v, "round %v get key %s", round, k) {
+			return false
+		}
+	}
+	for i := 0; i < 5; i++ {
+		min, max := randRange(r)
+		if r.Intn(5) == 0 {
+			min = nil
+		}
+		if r.Intn(5) == 0 {
+			max = nil
+		}
+		rt := common.RangeClose
+		if r.Intn(2) == 0 {
+			rt = common.RangeROpen
+		}
+		if !checkModelRange(t, r, eng, m, min, max, rt, round) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkModelRange(t *testing.T, r *rand.Rand, eng engine.KVEngine, m *kvModel,
+	min []byte, max []byte, rt uint8, round int) bool {
+	expected := m.keysInRange(min, max, max != nil && rt != common.RangeROpen)
+	msg := fmt.Sprintf("round %v range [%s, %s] type %v", round, min, max, rt)
+	it, err := eng.GetIterator(engine.IteratorOpts{
+		Range: engine.Range{Min: min, Max: max, Type: rt},
+	})
+	if !assert.Nil(t, err) {
+		return false
+	}
+	defer it.Close()
+
+	keys := make([][]byte, 0)
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+		if !assert.Equal(t, m.get(it.Key()), it.Value(), msg) {
+			return false
+		}
+	}
+	if !assert.Equal(t, expected, keys, msg) {
+		return false
+	}
+	keys = keys[:0]
+	for it.SeekToLast(); it.Valid(); it.Prev() {
+		keys = append(keys, it.Key())
+	}
+	reversed := make([][]byte, 0, len(expected))
+	for i := len(expected) - 1; i >= 0; i-- {
+		reversed = append(reversed, expected[i])
+	}
+	if !assert.Equal(t, reversed, keys, msg) {
+		return false
+	}
+
+	// seek to the first key larger than or equal to the seek key, and seek for prev to
+	// the last key less than or equal to the seek key
+	for i := 0; i < 5; i++ {
+		sk := randKey(r)
+		pos := sort.Search(len(expected), func(i int) bool {
+			return bytes.Compare(expected[i], sk) >= 0
+		})
+		it.Seek(sk)
+		if pos < len(expected) {
+			if !assert.True(t, it.Valid(), msg) || !assert.Equal(t, expected[pos], it.Key(), msg) {
+				return false
+			}
+			// change the direction after seek
+			it.Prev()
+			if pos > 0 {
+				if !assert.True(t, it.Valid(), msg) || !assert.Equal(t, expected[pos-1], it.Key(), msg) {
+					return false
+				}
+			} else if !assert.False(t, it.Valid(), msg) {
+				return false
+			}
+		} else if !assert.False(t, it.Valid(), msg) {
+			return false
+		}
+
+		if pos < len(expected) && bytes.Equal(expected[pos], sk) {
+			pos++
+		}
+		it.SeekForPrev(sk)
+		if pos > 0 {
+			if !assert.True(t, it.Valid(), msg) || !assert.Equal(t, expected[pos-1], it.Key(), msg) {
+				return false
+			}
+			it.Next()
+			if pos < len(expected) {
+				if !assert.True(t, it.Valid(), msg) || !assert.Equal(t, expected[pos], it.Key(), msg) {
+					return false
+				}
+			} else if !assert.False(t, it.Valid(), msg) {
+				return false
+			}
+		} else if !assert.False(t, it.Valid(), msg) {
+			return false
+		}
+	}
+	return true
+}
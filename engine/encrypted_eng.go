@@ -0,0 +1,510 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
+)
+
+const (
+	reEncryptScanNum        = 10000
+	encryptionCheckInterval = time.Hour
+)
+
+var (
+	errEncryptedData    = errors.New("the data is encrypted, need the encryption enabled to open it")
+	errReEncryptRunning = errors.New("the re-encryption is already running")
+)
+
+func isEncryptedDataDir(dataDir string) bool {
+	_, err := os.Stat(path.Join(dataDir, encryption.KeyStoreFileName))
+	return err == nil
+}
+
+// encryptedEng encrypts all the values written by the write batch, and decrypts the values
+// while reading. The keys are not encrypted since the iterator depends on the order of keys,
+// so the table names, the keys, the hash fields, the set/zset/geo members and the indexed
+// values stored in the keys are plain text in the data files. The merge operands are not
+// encrypted since the merge operator needs the plain value, which is only used for the counters. The data keys are stored in the data dir, so they
+// can be saved and transferred with the checkpoint.
+type encryptedEng struct {
+	KVEngine
+	km      *encryption.KeyManager
+	ksMutex sync.RWMutex
+	ks      *encryption.KeyStore
+	// the write batch is encrypted and committed with the read lock. The re-encryption,
+	// the key rotation and removing the old keys need the write lock, so the batch
+	// will not be encrypted by the key which is rotated or removed before committed.
+	writeMutex sync.RWMutex
+	// avoid changing the data keys while saving the checkpoint
+	keyChangeMutex sync.Mutex
+	defaultWB      WriteBatch
+	reEncrypting   int32
+	quit           chan struct{}
+}
+
+func newEncryptedEng(cfg *RockEngConfig, eng KVEngine) *encryptedEng {
+	e := &encryptedEng{
+		KVEngine: eng,
+		km:       cfg.KeyManager,
+		quit:     make(chan struct{}),
+	}
+	go e.checkKeysLoop()
+	return e
+}
+
+func (e *encryptedEng) keys() *encryption.KeyStore {
+	e.ksMutex.RLock()
+	defer e.ksMutex.RUnlock()
+	return e.ks
+}
+
+func (e *encryptedEng) OpenEng() error {
+	// the data keys should be loaded before any data written
+	err := os.MkdirAll(e.GetDataDir(), common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	ks, err := e.km.OpenKeyStore(path.Join(e.GetDataDir(), encryption.KeyStoreFileName))
+	if err != nil {
+		dbLog.Warningf("open the encryption keys for %v failed: %v", e.GetDataDir(), err)
+		return err
+	}
+	e.ksMutex.Lock()
+	e.ks = ks
+	e.ksMutex.Unlock()
+	err = e.KVEngine.OpenEng()
+	if err != nil {
+		return err
+	}
+	e.defaultWB = e.wrapWriteBatch(e.KVEngine.DefaultWriteBatch())
+	return nil
+}
+
+func (e *encryptedEng) CheckDBEngForRead(fullPath string) error {
+	err := e.KVEngine.CheckDBEngForRead(fullPath)
+	if err != nil {
+		return err
+	}
+	_, err = e.km.LoadKeyStore(path.Join(fullPath, encryption.KeyStoreFileName))
+	if os.IsNotExist(err) {
+		// the data saved before the encryption enabled
+		return nil
+	}
+	return err
+}
+
+func (e *encryptedEng) CloseAll() {
+	select {
+	case <-e.quit:
+	default:
+		close(e.quit)
+	}
+	e.KVEngine.CloseAll()
+}
+
+func (e *encryptedEng) wrapWriteBatch(wb WriteBatch) WriteBatch {
+	if wb == nil {
+		return nil
+	}
+	return &encryptedWriteBatch{
+		WriteBatch: wb,
+		e:          e,
+	}
+}
+
+func (e *encryptedEng) NewWriteBatch() WriteBatch {
+	return e.wrapWriteBatch(e.KVEngine.NewWriteBatch())
+}
+
+func (e *encryptedEng) DefaultWriteBatch() WriteBatch {
+	if e.defaultWB == nil {
+		return e.wrapWriteBatch(e.KVEngine.DefaultWriteBatch())
+	}
+	return e.defaultWB
+}
+
+func (e *encryptedEng) Write(wb WriteBatch) error {
+	return wb.Commit()
+}
+
+func (e *encryptedEng) decrypt(key []byte, v []byte) ([]byte, error) {
+	ks := e.keys()
+	if !ks.IsEncrypted(v) {
+		// the counters and the data written before the encryption enabled
+		return v, nil
+	}
+	return ks.Decrypt(v, key)
+}
+
+func (e *encryptedEng) GetBytesNoLock(key []byte) ([]byte, error) {
+	v, err := e.KVEngine.GetBytesNoLock(key)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(key, v)
+}
+
+func (e *encryptedEng) GetBytes(key []byte) ([]byte, error) {
+	v, err := e.KVEngine.GetBytes(key)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(key, v)
+}
+
+func (e *encryptedEng) MultiGetBytes(keyList [][]byte, values [][]byte, errs []error) {
+	e.KVEngine.MultiGetBytes(keyList, values, errs)
+	for i, k := range keyList {
+		if errs[i] != nil {
+			continue
+		}
+		values[i], errs[i] = e.decrypt(k, values[i])
+	}
+}
+
+func (e *encryptedEng) decryptRef(key []byte, ref RefSlice, err error) (RefSlice, error) {
+	if err != nil || ref == nil {
+		return ref, err
+	}
+	if !e.keys().IsEncrypted(ref.Data()) {
+		return ref, nil
+	}
+	v, err := e.decrypt(key, ref.Data())
+	ref.Free()
+	if err != nil {
+		return nil, err
+	}
+	return &memRefSlice{b: v, needCopy: false}, nil
+}
+
+func (e *encryptedEng) GetRef(key []byte) (RefSlice, error) {
+	ref, err := e.KVEngine.GetRef(key)
+	return e.decryptRef(key, ref, err)
+}
+
+func (e *encryptedEng) GetRefNoLock(key []byte) (RefSlice, error) {
+	ref, err := e.KVEngine.GetRefNoLock(key)
+	return e.decryptRef(key, ref, err)
+}
+
+func (e *encryptedEng) GetValueWithOp(key []byte, op func([]byte) error) error {
+	return e.KVEngine.GetValueWithOp(key, func(v []byte) error {
+		v, err := e.decrypt(key, v)
+		if err != nil {
+			return err
+		}
+		return op(v)
+	})
+}
+
+func (e *encryptedEng) GetValueWithOpNoLock(key []byte, op func([]byte) error) error {
+	return e.KVEngine.GetValueWithOpNoLock(key, func(v []byte) error {
+		v, err := e.decrypt(key, v)
+		if err != nil {
+			return err
+		}
+		return op(v)
+	})
+}
+
+func (e *encryptedEng) GetIterator(opts IteratorOpts) (Iterator, error) {
+	it, err := e.KVEngine.GetIterator(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedIterator{
+		Iterator: it,
+		e:        e,
+	}, nil
+}
+
+func (e *encryptedEng) NewCheckpoint() (KVCheckpoint, error) {
+	ck, err := e.KVEngine.NewCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedCheckpoint{
+		KVCheckpoint: ck,
+		e:            e,
+	}, nil
+}
+
+// the data encrypted by the old data keys will be encrypted again before compacting,
+// so the old data keys can be removed after the compaction
+func (e *encryptedEng) CompactRange(rg CRange) {
+	err := e.reEncryptRange(rg)
+	if err != nil {
+		dbLog.Infof("re-encrypt %v failed: %v", e.GetDataDir(), err)
+	}
+	e.KVEngine.CompactRange(rg)
+}
+
+func (e *encryptedEng) CompactAllRange() {
+	ks := e.keys()
+	if ks == nil || ks.IsReEncrypted() {
+		e.KVEngine.CompactAllRange()
+		return
+	}
+	err := e.reEncryptRange(CRange{})
+	e.KVEngine.CompactAllRange()
+	if err != nil {
+		dbLog.Infof("re-encrypt %v failed: %v", e.GetDataDir(), err)
+		return
+	}
+	e.writeMutex.Lock()
+	e.keyChangeMutex.Lock()
+	err = ks.FinishReEncrypt()
+	e.keyChangeMutex.Unlock()
+	e.writeMutex.Unlock()
+	if err != nil {
+		dbLog.Warningf("remove the old data keys for %v failed: %v", e.GetDataDir(), err)
+	}
+}
+
+func (e *encryptedEng) reEncryptRange(rg CRange) error {
+	ks := e.keys()
+	if ks == nil || ks.IsReEncrypted() {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt32(&e.reEncrypting, 0, 1) {
+		return errReEncryptRunning
+	}
+	defer atomic.StoreInt32(&e.reEncrypting, 0)
+	start := time.Now()
+	total := 0
+	min := rg.Start
+	for {
+		keys, next, err := e.scanOldKeys(ks, min, rg.Limit)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			err = e.reEncryptKeys(ks, keys)
+			if err != nil {
+				return err
+			}
+			total += len(keys)
+		}
+		if next == nil {
+			break
+		}
+		min = next
+		select {
+		case <-e.quit:
+			return common.ErrStopped
+		default:
+		}
+	}
+	dbLog.Infof("re-encrypt %v done, %v keys, cost: %v", e.GetDataDir(), total, time.Since(start))
+	return nil
+}
+
+// scan the limited number of keys from the min key and return the keys encrypted by the old
+// data keys and the next key to scan. The iterator is closed before writing since some
+// engines do not allow writing while iterating.
+func (e *encryptedEng) scanOldKeys(ks *encryption.KeyStore, min []byte, max []byte) ([][]byte, []byte, error) {
+	it, err := e.KVEngine.GetIterator(IteratorOpts{
+		Range:      Range{Min: min, Max: max, Type: common.RangeROpen},
+		TotalOrder: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer it.Close()
+	keys := make([][]byte, 0)
+	scanned := 0
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if scanned >= reEncryptScanNum {
+			return keys, it.Key(), nil
+		}
+		scanned++
+		if ks.NeedReEncrypt(it.RefValue()) {
+			keys = append(keys, it.Key())
+		}
+	}
+	return keys, nil, nil
+}
+
+func (e *encryptedEng) reEncryptKeys(ks *encryption.KeyStore, keys [][]byte) error {
+	e.writeMutex.Lock()
+	defer e.writeMutex.Unlock()
+	wb := e.KVEngine.NewWriteBatch()
+	defer wb.Destroy()
+	for _, k := range keys {
+		// the value may be changed after scanned
+		v, err := e.KVEngine.GetBytes(k)
+		if err != nil {
+			return err
+		}
+		if !ks.NeedReEncrypt(v) {
+			continue
+		}
+		plain, err := ks.Decrypt(v, k)
+		if err != nil {
+			return err
+		}
+		v, err = ks.Encrypt(plain, k)
+		if err != nil {
+			return err
+		}
+		wb.Put(k, v)
+	}
+	return e.KVEngine.Write(wb)
+}
+
+func (e *encryptedEng) checkKeysLoop() {
+	ticker := time.NewTicker(encryptionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.quit:
+			return
+		case <-ticker.C:
+			e.checkDataKeys()
+		}
+	}
+}
+
+// rotate the expired data key and encrypt the old data by the new key
+func (e *encryptedEng) checkDataKeys() {
+	ks := e.keys()
+	if ks == nil || e.IsClosed() {
+		return
+	}
+	e.writeMutex.Lock()
+	e.keyChangeMutex.Lock()
+	rotated, err := ks.RotateIfExpired(e.km.RotateInterval())
+	e.keyChangeMutex.Unlock()
+	e.writeMutex.Unlock()
+	if err != nil {
+		dbLog.Warningf("rotate the data key for %v failed: %v", e.GetDataDir(), err)
+		return
+	}
+	if rotated {
+		dbLog.Infof("the data key for %v rotated", e.GetDataDir())
+	}
+	if !ks.IsReEncrypted() {
+		e.CompactAllRange()
+	}
+}
+
+// encryptedWriteBatch keeps the plain operations and encrypts the values while committing
+// with the read lock of writeMutex, so the values are always encrypted by the current data
+// key and the batch can not be committed while the old data keys are removing.
+type encryptedWriteBatch struct {
+	WriteBatch
+	e   *encryptedEng
+	ops []writeOp
+}
+
+func (wb *encryptedWriteBatch) DeleteRange(start, end []byte) {
+	wb.ops = append(wb.ops, writeOp{op: DeleteRangeOp, key: copyBytes(start), value: copyBytes(end)})
+}
+
+func (wb *encryptedWriteBatch) Delete(key []byte) {
+	wb.ops = append(wb.ops, writeOp{op: DeleteOp, key: copyBytes(key)})
+}
+
+func (wb *encryptedWriteBatch) Put(key []byte, value []byte) {
+	wb.ops = append(wb.ops, writeOp{op: PutOp, key: copyBytes(key), value: copyBytes(value)})
+}
+
+func (wb *encryptedWriteBatch) Merge(key []byte, value []byte) {
+	wb.ops = append(wb.ops, writeOp{op: MergeOp, key: copyBytes(key), value: copyBytes(value)})
+}
+
+func (wb *encryptedWriteBatch) Clear() {
+	wb.ops = wb.ops[:0]
+	wb.WriteBatch.Clear()
+}
+
+func (wb *encryptedWriteBatch) Destroy() {
+	wb.ops = wb.ops[:0]
+	wb.WriteBatch.Destroy()
+}
+
+func (wb *encryptedWriteBatch) Commit() error {
+	defer wb.Clear()
+	wb.e.writeMutex.RLock()
+	defer wb.e.writeMutex.RUnlock()
+	ks := wb.e.keys()
+	if ks == nil {
+		return errDBEngClosed
+	}
+	for _, w := range wb.ops {
+		switch w.op {
+		case PutOp:
+			v, err := ks.Encrypt(w.value, w.key)
+			if err != nil {
+				return err
+			}
+			wb.WriteBatch.Put(w.key, v)
+		case DeleteOp:
+			wb.WriteBatch.Delete(w.key)
+		case DeleteRangeOp:
+			wb.WriteBatch.DeleteRange(w.key, w.value)
+		case MergeOp:
+			wb.WriteBatch.Merge(w.key, w.value)
+		}
+	}
+	return wb.WriteBatch.Commit()
+}
+
+type encryptedIterator struct {
+	Iterator
+	e            *encryptedEng
+	removeTsType byte
+}
+
+func (it *encryptedIterator) decryptValue(v []byte) []byte {
+	v, err := it.e.decrypt(it.Iterator.RefKey(), v)
+	if err != nil {
+		dbLog.Errorf("decrypt the value in %v failed: %v", it.e.GetDataDir(), err)
+		return nil
+	}
+	// the timestamp should be removed after decrypted
+	if (it.removeTsType == KVType || it.removeTsType == HashType) && len(v) >= tsLen {
+		v = v[:len(v)-tsLen]
+	}
+	return v
+}
+
+func (it *encryptedIterator) RefValue() []byte {
+	return it.decryptValue(it.Iterator.RefValue())
+}
+
+func (it *encryptedIterator) Value() []byte {
+	return it.decryptValue(it.Iterator.Value())
+}
+
+func (it *encryptedIterator) NoTimestamp(vt byte) {
+	it.removeTsType = vt
+}
+
+type encryptedCheckpoint struct {
+	KVCheckpoint
+	e *encryptedEng
+}
+
+// the data keys are saved with the checkpoint, so the checkpoint can be restored
+// on the other node with the same master key
+func (ck *encryptedCheckpoint) Save(cpath string, notify chan struct{}) error {
+	ck.e.keyChangeMutex.Lock()
+	defer ck.e.keyChangeMutex.Unlock()
+	err := ck.KVCheckpoint.Save(cpath, notify)
+	if err != nil {
+		return err
+	}
+	ks := ck.e.keys()
+	if ks == nil {
+		return errDBEngClosed
+	}
+	return ks.SaveTo(path.Join(cpath, encryption.KeyStoreFileName))
+}
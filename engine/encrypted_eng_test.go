@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
+)
+
+func newTestKeyManager(t *testing.T, dir string) *encryption.KeyManager {
+	keyFile := path.Join(dir, "master.key")
+	err := ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(make([]byte, 32))), 0600)
+	require.Nil(t, err)
+	km, err := encryption.NewKeyManager(encryption.Config{
+		MasterKeyType: encryption.MasterKeyTypeFile,
+		MasterKeyFile: keyFile,
+	})
+	require.Nil(t, err)
+	return km
+}
+
+func TestEncryptedEngReEncrypt(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encrypted_eng")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg := NewRockConfig()
+	cfg.DataDir = path.Join(tmpDir, "data")
+	cfg.EngineType = "pebble"
+	cfg.KeyManager = newTestKeyManager(t, tmpDir)
+	kv, err := NewKVEng(cfg)
+	require.Nil(t, err)
+	err = kv.OpenEng()
+	require.Nil(t, err)
+	defer kv.CloseAll()
+	eng := kv.(*encryptedEng)
+
+	keyNum := reEncryptScanNum + 10
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	for i := 0; i < keyNum; i++ {
+		wb.Put([]byte("test:key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(i)))
+	}
+	err = eng.Write(wb)
+	require.Nil(t, err)
+
+	// the value stored in the engine should be encrypted
+	raw, err := eng.KVEngine.GetBytes([]byte("test:key1"))
+	assert.Nil(t, err)
+	assert.True(t, encryption.IsEncrypted(raw))
+	v, err := eng.GetBytes([]byte("test:key1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), v)
+
+	err = eng.keys().Rotate()
+	require.Nil(t, err)
+	assert.True(t, eng.keys().NeedReEncrypt(raw))
+	wb.Clear()
+	wb.Put([]byte("test:key2"), []byte("new value2"))
+	err = eng.Write(wb)
+	require.Nil(t, err)
+
+	eng.CompactAllRange()
+	assert.True(t, eng.keys().IsReEncrypted())
+	for i := 0; i < keyNum; i++ {
+		k := []byte("test:key" + strconv.Itoa(i))
+		raw, err := eng.KVEngine.GetBytes(k)
+		assert.Nil(t, err)
+		assert.False(t, eng.keys().NeedReEncrypt(raw))
+		v, err := eng.GetBytes(k)
+		assert.Nil(t, err)
+		if i == 2 {
+			assert.Equal(t, []byte("new value2"), v)
+		} else {
+			assert.Equal(t, []byte("value"+strconv.Itoa(i)), v)
+		}
+	}
+}
+
+func TestEncryptedEngCommitBatchAfterReEncrypt(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encrypted_eng")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg := NewRockConfig()
+	cfg.DataDir = path.Join(tmpDir, "data")
+	cfg.EngineType = "pebble"
+	cfg.KeyManager = newTestKeyManager(t, tmpDir)
+	kv, err := NewKVEng(cfg)
+	require.Nil(t, err)
+	err = kv.OpenEng()
+	require.Nil(t, err)
+	defer kv.CloseAll()
+	eng := kv.(*encryptedEng)
+
+	wb := eng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put([]byte("test:key1"), []byte("value1"))
+	// the batch filled before the rotation should be encrypted by the new key
+	// even if it is committed after the old key removed
+	err = eng.keys().Rotate()
+	require.Nil(t, err)
+	eng.CompactAllRange()
+	assert.True(t, eng.keys().IsReEncrypted())
+	err = eng.Write(wb)
+	require.Nil(t, err)
+
+	raw, err := eng.KVEngine.GetBytes([]byte("test:key1"))
+	assert.Nil(t, err)
+	assert.False(t, eng.keys().NeedReEncrypt(raw))
+	v, err := eng.GetBytes([]byte("test:key1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), v)
+}
+
+func TestEncryptedEngOpenWithoutKeys(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encrypted_eng")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg := NewRockConfig()
+	cfg.DataDir = path.Join(tmpDir, "data")
+	cfg.EngineType = "pebble"
+	cfg.KeyManager = newTestKeyManager(t, tmpDir)
+	eng, err := NewKVEng(cfg)
+	require.Nil(t, err)
+	err = eng.OpenEng()
+	require.Nil(t, err)
+	wb := eng.NewWriteBatch()
+	wb.Put([]byte("test:key1"), []byte("value1"))
+	err = eng.Write(wb)
+	wb.Destroy()
+	require.Nil(t, err)
+
+	ck, err := eng.NewCheckpoint()
+	require.Nil(t, err)
+	ckPath := path.Join(tmpDir, "checkpoint")
+	err = ck.Save(ckPath, make(chan struct{}))
+	require.Nil(t, err)
+	// the data keys should be saved with the checkpoint
+	_, err = os.Stat(path.Join(ckPath, encryption.KeyStoreFileName))
+	assert.Nil(t, err)
+	err = eng.CheckDBEngForRead(ckPath)
+	assert.Nil(t, err)
+	eng.CloseAll()
+
+	cfg.KeyManager = nil
+	_, err = NewKVEng(cfg)
+	assert.Equal(t, errEncryptedData, err)
+}
+
+func TestEncryptedEngReadPlainDataBeforeEnabled(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encrypted_eng")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg := NewRockConfig()
+	cfg.DataDir = path.Join(tmpDir, "data")
+	cfg.EngineType = "pebble"
+	eng, err := NewKVEng(cfg)
+	require.Nil(t, err)
+	err = eng.OpenEng()
+	require.Nil(t, err)
+	// the plain value looks like the encrypted data
+	plainLikeEnc := append([]byte{0x00, 0xec, 0x01}, make([]byte, encryption.Overhead)...)
+	wb := eng.NewWriteBatch()
+	wb.Put([]byte("test:key1"), plainLikeEnc)
+	wb.Put([]byte("test:key2"), []byte("value2"))
+	err = eng.Write(wb)
+	wb.Destroy()
+	require.Nil(t, err)
+	eng.CloseAll()
+
+	cfg.KeyManager = newTestKeyManager(t, tmpDir)
+	eng, err = NewKVEng(cfg)
+	require.Nil(t, err)
+	err = eng.OpenEng()
+	require.Nil(t, err)
+	defer eng.CloseAll()
+	v, err := eng.GetBytes([]byte("test:key1"))
+	assert.Nil(t, err)
+	assert.Equal(t, plainLikeEnc, v)
+	v, err = eng.GetBytes([]byte("test:key2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), v)
+	it, err := eng.GetIterator(IteratorOpts{})
+	require.Nil(t, err)
+	it.Seek([]byte("test:key1"))
+	assert.True(t, it.Valid())
+	assert.Equal(t, plainLikeEnc, it.Value())
+	it.Close()
+
+	wb = eng.NewWriteBatch()
+	wb.Put([]byte("test:key3"), []byte("value3"))
+	err = eng.Write(wb)
+	wb.Destroy()
+	require.Nil(t, err)
+	v, err = eng.GetBytes([]byte("test:key3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value3"), v)
+}
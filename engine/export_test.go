@@ -0,0 +1,7 @@
+package engine
+
+// SetUseSkiplist change the data structure used by the mem engine for the tests
+// outside the package
+func SetUseSkiplist(b bool) {
+	useSkiplist = b
+}
@@ -18,11 +18,16 @@ type IteratorGetter interface {
 	GetIterator(IteratorOpts) (Iterator, error)
 }
 
+// Iterator should keep the same semantics as the rocksdb iterator for all the engines,
+// the keys out of the range in IteratorOpts (the min is inclusive and the max is exclusive
+// if the range right open) should never be valid.
 type Iterator interface {
 	Next()
 	Prev()
 	Valid() bool
+	// Seek seeks to the first key greater than or equal to the key
 	Seek([]byte)
+	// SeekForPrev seeks to the last key less than or equal to the key
 	SeekForPrev([]byte)
 	SeekToFirst()
 	SeekToLast()
@@ -86,6 +91,8 @@ type IteratorOpts struct {
 	Reverse   bool
 	IgnoreDel bool
 	WithSnap  bool
+	// iterate all the keys without the prefix limit, should only be used for the full scan
+	TotalOrder bool
 }
 
 // note: all the iterator use the prefix iterator flag. Which means it may skip the keys for different table
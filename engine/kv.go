@@ -5,6 +5,7 @@ import (
 
 	"github.com/shirou/gopsutil/mem"
 	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
 )
 
 var (
@@ -50,6 +51,8 @@ type RockEngConfig struct {
 	SharedConfig       SharedRockConfig
 	EnableTableCounter bool
 	AutoCompacted      bool
+	// the values will be encrypted by the data keys if the key manager is set
+	KeyManager *encryption.KeyManager
 	RockOptions
 }
 
@@ -90,6 +93,8 @@ type RockOptions struct {
 	LevelCompactionDynamicLevelBytes bool   `json:"level_compaction_dynamic_level_bytes,omitempty"`
 	InsertHintFixedLen               int    `json:"insert_hint_fixed_len"`
 	EngineType                       string `json:"engine_type,omitempty"`
+	// only for badger engine, the values larger than the threshold will be stored in the value log
+	BadgerValueThreshold int `json:"badger_value_threshold,omitempty"`
 }
 
 func FillDefaultOptions(opts *RockOptions) {
@@ -202,14 +207,30 @@ type KVEngine interface {
 }
 
 func NewKVEng(cfg *RockEngConfig) (KVEngine, error) {
+	var eng KVEngine
+	var err error
 	if cfg.EngineType == "" || cfg.EngineType == "rocksdb" {
-		return NewRockEng(cfg)
+		eng, err = NewRockEng(cfg)
 	} else if cfg.EngineType == "pebble" {
-		return NewPebbleEng(cfg)
+		eng, err = NewPebbleEng(cfg)
 	} else if cfg.EngineType == "mem" {
-		return NewMemEng(cfg)
+		eng, err = NewMemEng(cfg)
+	} else if cfg.EngineType == "badger" {
+		eng, err = NewBadgerEng(cfg)
+	} else {
+		return nil, errors.New("unknown engine type for: " + cfg.EngineType)
 	}
-	return nil, errors.New("unknown engine type for: " + cfg.EngineType)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.KeyManager != nil {
+		return newEncryptedEng(cfg, eng), nil
+	}
+	if isEncryptedDataDir(eng.GetDataDir()) {
+		eng.CloseAll()
+		return nil, errEncryptedData
+	}
+	return eng, nil
 }
 
 func NewSharedEngConfig(cfg RockOptions) (SharedRockConfig, error) {
@@ -219,6 +240,8 @@ func NewSharedEngConfig(cfg RockOptions) (SharedRockConfig, error) {
 		return newSharedPebblekConfig(cfg), nil
 	} else if cfg.EngineType == "mem" {
 		return newSharedMemConfig(cfg), nil
+	} else if cfg.EngineType == "badger" {
+		return newSharedBadgerConfig(cfg), nil
 	}
 	return nil, errors.New("unknown engine type for: " + cfg.EngineType)
 }
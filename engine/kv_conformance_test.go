@@ -0,0 +1,84 @@
+package engine_test
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/engine/conformance"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
+)
+
+func init() {
+	// set only once since the background goroutines of the closed engines may still
+	// be logging
+	engine.SetLogger(0, nil)
+}
+
+func newTestEngine(engType string) conformance.NewEngineFunc {
+	return func(dataDir string) (engine.KVEngine, error) {
+		cfg := engine.NewRockConfig()
+		cfg.DataDir = dataDir
+		cfg.EngineType = engType
+		return engine.NewKVEng(cfg)
+	}
+}
+
+func TestRocksdbConformance(t *testing.T) {
+	conformance.RunKVEngineTests(t, newTestEngine("rocksdb"))
+}
+
+func TestPebbleConformance(t *testing.T) {
+	conformance.RunKVEngineTests(t, newTestEngine("pebble"))
+}
+
+func TestBadgerConformance(t *testing.T) {
+	conformance.RunKVEngineTests(t, newTestEngine("badger"))
+}
+
+func TestMemEngSkiplistConformance(t *testing.T) {
+	conformance.RunKVEngineTests(t, newTestEngine("mem"))
+}
+
+func TestMemEngBtreeConformance(t *testing.T) {
+	engine.SetUseSkiplist(false)
+	defer engine.SetUseSkiplist(true)
+	conformance.RunKVEngineTests(t, newTestEngine("mem"))
+}
+
+func newEncryptedTestEngine(t *testing.T, engType string) (conformance.NewEngineFunc, func()) {
+	tmpDir, err := ioutil.TempDir("", "encryption")
+	require.Nil(t, err)
+	keyFile := path.Join(tmpDir, "master.key")
+	err = ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(make([]byte, 32))), 0600)
+	require.Nil(t, err)
+	km, err := encryption.NewKeyManager(encryption.Config{
+		MasterKeyType: encryption.MasterKeyTypeFile,
+		MasterKeyFile: keyFile,
+	})
+	require.Nil(t, err)
+	return func(dataDir string) (engine.KVEngine, error) {
+			cfg := engine.NewRockConfig()
+			cfg.DataDir = dataDir
+			cfg.EngineType = engType
+			cfg.KeyManager = km
+			return engine.NewKVEng(cfg)
+		}, func() {
+			os.RemoveAll(tmpDir)
+		}
+}
+
+func TestEncryptedEngConformance(t *testing.T) {
+	for _, engType := range []string{"rocksdb", "pebble", "badger", "mem"} {
+		t.Run(engType, func(t *testing.T) {
+			newEng, clean := newEncryptedTestEngine(t, engType)
+			defer clean()
+			// the merge operands are not encrypted, so the counters can not be written by put
+			conformance.RunKVEngineTests(t, newEng, "MergeAfterPut")
+		})
+	}
+}
@@ -131,6 +131,101 @@ func TestPebbleEngIterator(t *testing.T) {
 	testKVIterator(t, "pebble")
 }
 
+func TestMemEngBtreeIteratorSeekForPrevAndBounds(t *testing.T) {
+	useSkiplist = false
+	defer func() {
+		useSkiplist = true
+	}()
+	testKVIteratorSeekForPrevAndBounds(t, "mem")
+}
+
+func TestMemEngSkiplistIteratorSeekForPrevAndBounds(t *testing.T) {
+	testKVIteratorSeekForPrevAndBounds(t, "mem")
+}
+
+func TestRockEngIteratorSeekForPrevAndBounds(t *testing.T) {
+	testKVIteratorSeekForPrevAndBounds(t, "rocksdb")
+}
+
+func TestPebbleEngIteratorSeekForPrevAndBounds(t *testing.T) {
+	testKVIteratorSeekForPrevAndBounds(t, "pebble")
+}
+
+func TestBadgerEngIteratorSeekForPrevAndBounds(t *testing.T) {
+	testKVIteratorSeekForPrevAndBounds(t, "badger")
+}
+
+// the SeekForPrev should include the key itself, and the iterator should never
+// be valid for the keys out of the range in the iterator options.
+func testKVIteratorSeekForPrevAndBounds(t *testing.T, engType string) {
+	SetLogger(0, nil)
+	cfg := NewRockConfig()
+	tmpDir, err := ioutil.TempDir("", "iterator_data")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	cfg.DataDir = tmpDir
+	cfg.EngineType = engType
+	eng, err := NewKVEng(cfg)
+	assert.Nil(t, err)
+	err = eng.OpenEng()
+	assert.Nil(t, err)
+	defer eng.CloseAll()
+
+	wb := eng.NewWriteBatch()
+	for i := 0; i < 5; i++ {
+		k := []byte("test" + strconv.Itoa(i))
+		wb.Put(k, k)
+	}
+	err = eng.Write(wb)
+	assert.Nil(t, err)
+	wb.Destroy()
+
+	it, err := eng.GetIterator(IteratorOpts{})
+	assert.Nil(t, err)
+	it.SeekForPrev([]byte("test2"))
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("test2"), it.Key())
+	it.SeekForPrev([]byte("test21"))
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("test2"), it.Key())
+	it.SeekForPrev([]byte("test0"))
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("test0"), it.Key())
+	it.SeekForPrev([]byte("test"))
+	assert.False(t, it.Valid())
+	it.Close()
+
+	// [test1, test3)
+	it, err = eng.GetIterator(IteratorOpts{
+		Range: Range{Min: []byte("test1"), Max: []byte("test3"), Type: common.RangeROpen},
+	})
+	assert.Nil(t, err)
+	defer it.Close()
+	it.SeekToFirst()
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("test1"), it.Key())
+	it.Prev()
+	assert.False(t, it.Valid())
+	it.SeekToLast()
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("test2"), it.Key())
+	it.Next()
+	assert.False(t, it.Valid())
+	it.Seek([]byte("test0"))
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("test1"), it.Key())
+	it.Seek([]byte("test3"))
+	assert.False(t, it.Valid())
+	it.SeekForPrev([]byte("test3"))
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("test2"), it.Key())
+	it.SeekForPrev([]byte("test4"))
+	assert.True(t, it.Valid())
+	assert.Equal(t, []byte("test2"), it.Key())
+	it.SeekForPrev([]byte("test0"))
+	assert.False(t, it.Valid())
+}
+
 func testKVIterator(t *testing.T, engType string) {
 	SetLogger(0, nil)
 	cfg := NewRockConfig()
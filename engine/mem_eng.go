@@ -2,10 +2,7 @@ package engine
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
-	"fmt"
-	"io"
 	"os"
 	"path"
 	"sync"
@@ -66,6 +63,9 @@ type memEng struct {
 	lastCompact int64
 	deletedCnt  int64
 	quit        chan struct{}
+
+	// the skiplist writes are blocked while copying the data for snapshot
+	snapshotMutex sync.RWMutex
 }
 
 func NewMemEng(cfg *RockEngConfig) (*memEng, error) {
@@ -119,14 +119,6 @@ func (pe *memEng) SetMaxBackgroundOptions(maxCompact int, maxBackJobs int) error
 func (pe *memEng) compactLoop() {
 }
 
-func (pe *memEng) CheckDBEngForRead(fullPath string) error {
-	return nil
-}
-
-func (pe *memEng) getDataFileName() string {
-	return path.Join(pe.GetDataDir(), "mem.dat")
-}
-
 func (pe *memEng) OpenEng() error {
 	if !pe.IsClosed() {
 		dbLog.Warningf("engine already opened: %v, should close it before reopen", pe.GetDataDir())
@@ -401,164 +393,3 @@ func (pe *memEng) NewCheckpoint() (KVCheckpoint, error) {
 		pe: pe,
 	}, nil
 }
-
-type memEngCheckpoint struct {
-	pe *memEng
-}
-
-func (pck *memEngCheckpoint) Save(cpath string, notify chan struct{}) error {
-	tmpFile := path.Join(cpath, "mem.dat.tmp")
-	err := os.Mkdir(cpath, common.DIR_PERM)
-	if err != nil && !os.IsExist(err) {
-		return err
-	}
-	it, err := pck.pe.GetIterator(IteratorOpts{})
-	if err != nil {
-		return err
-	}
-	var dataNum int64
-	if useSkiplist {
-		dataNum = pck.pe.slEng.Len()
-	} else {
-		dataNum = int64(pck.pe.eng.Len())
-	}
-
-	it.SeekToFirst()
-	if notify != nil {
-		close(notify)
-	}
-
-	n, fs, err := saveMemDBToFile(it, tmpFile, dataNum)
-	// release the lock early to avoid blocking while sync file
-	it.Close()
-
-	if err != nil {
-		dbLog.Infof("save checkpoint to %v failed: %s", cpath, err.Error())
-		return err
-	}
-	if fs != nil {
-		err = fs.Sync()
-		if err != nil {
-			dbLog.Errorf("save checkpoint to %v sync failed: %v ", cpath, err.Error())
-			return err
-		}
-		fs.Close()
-	}
-	err = os.Rename(tmpFile, path.Join(cpath, "mem.dat"))
-	if err != nil {
-		dbLog.Errorf("save checkpoint to %v failed: %v ", cpath, err.Error())
-	} else {
-		dbLog.Infof("save checkpoint to %v done: %v bytes", cpath, n)
-	}
-	return err
-}
-
-func loadMemDBFromFile(fileName string, loader func([]byte, []byte) error) error {
-	// read from checkpoint file
-	fs, err := os.Open(fileName)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
-	}
-	header := make([]byte, 22)
-	_, err = fs.Read(header)
-	if err != nil {
-		return err
-	}
-	lenBuf := make([]byte, 8)
-	dataKeyBuf := make([]byte, 0, 1024)
-	dataValueBuf := make([]byte, 0, 1024)
-	for {
-		_, err := fs.Read(lenBuf)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		vl := binary.BigEndian.Uint64(lenBuf)
-		if uint64(len(dataKeyBuf)) < vl {
-			dataKeyBuf = make([]byte, vl)
-		}
-		_, err = fs.Read(dataKeyBuf[:vl])
-		if err != nil {
-			return err
-		}
-		key := dataKeyBuf[:vl]
-		_, err = fs.Read(lenBuf)
-		if err != nil {
-			return err
-		}
-		vl = binary.BigEndian.Uint64(lenBuf)
-		if uint64(len(dataValueBuf)) < vl {
-			dataValueBuf = make([]byte, vl)
-		}
-		_, err = fs.Read(dataValueBuf[:vl])
-		if err != nil {
-			return err
-		}
-		value := dataValueBuf[:vl]
-		err = loader(key, value)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func saveMemDBToFile(it Iterator, fileName string, dataNum int64) (int64, *os.File, error) {
-	fs, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, common.FILE_PERM)
-	if err != nil {
-		return 0, nil, err
-	}
-	defer func() {
-		if err != nil {
-			fs.Close()
-		}
-	}()
-	total := int64(0)
-	n := int(0)
-	n, err = fs.Write([]byte("v001\n"))
-	if err != nil {
-		return total, nil, err
-	}
-	total += int64(n)
-	n, err = fs.Write([]byte(fmt.Sprintf("%016d\n", dataNum)))
-	if err != nil {
-		return total, nil, err
-	}
-	total += int64(n)
-	buf := make([]byte, 8)
-	for it.SeekToFirst(); it.Valid(); it.Next() {
-		k := it.RefKey()
-		// save item to path
-		vlen := uint64(len(k))
-		binary.BigEndian.PutUint64(buf, vlen)
-		n, err = fs.Write(buf[:8])
-		if err != nil {
-			return total, nil, err
-		}
-		total += int64(n)
-		n, err = fs.Write(k)
-		if err != nil {
-			return total, nil, err
-		}
-		total += int64(n)
-		v := it.RefValue()
-		vlen = uint64(len(v))
-		binary.BigEndian.PutUint64(buf, vlen)
-		n, err = fs.Write(buf[:8])
-		if err != nil {
-			return total, nil, err
-		}
-		total += int64(n)
-		n, err = fs.Write(v)
-		if err != nil {
-			return total, nil, err
-		}
-		total += int64(n)
-	}
-	return total, fs, nil
-}
@@ -3,6 +3,8 @@ package engine
 import (
 	"io/ioutil"
 	"os"
+	"path"
+	"strconv"
 	"testing"
 	"time"
 
@@ -27,3 +29,80 @@ func TestMemEngReopenAndCheck(t *testing.T) {
 	pe.CloseAll()
 	time.Sleep(time.Second * 10)
 }
+
+func testMemEngSnapshot(t *testing.T) {
+	SetLogger(0, nil)
+	cfg := NewRockConfig()
+	tmpDir, err := ioutil.TempDir("", "checkpoint")
+	assert.Nil(t, err)
+	t.Log(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	cfg.DataDir = tmpDir
+	pe, err := NewMemEng(cfg)
+	assert.Nil(t, err)
+	err = pe.OpenEng()
+	assert.Nil(t, err)
+	defer pe.CloseAll()
+	wb := pe.DefaultWriteBatch()
+	for i := 0; i < 100; i++ {
+		wb.Put([]byte("test"+strconv.Itoa(i)), []byte("test"+strconv.Itoa(i)))
+	}
+	err = pe.Write(wb)
+	assert.Nil(t, err)
+
+	ck, _ := pe.NewCheckpoint()
+	ckPath := path.Join(tmpDir, "cktmp")
+	notify := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- ck.Save(ckPath, notify)
+	}()
+	<-notify
+	// the write after the checkpoint started should not be saved in the checkpoint
+	wb = pe.DefaultWriteBatch()
+	wb.Put([]byte("test_after"), []byte("test_after"))
+	err = pe.Write(wb)
+	assert.Nil(t, err)
+	assert.Nil(t, <-done)
+	err = pe.CheckDBEngForRead(ckPath)
+	assert.Nil(t, err)
+
+	v, err := pe.GetBytes([]byte("test_after"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("test_after"), v)
+	assert.Equal(t, 101, pe.GetApproximateTotalKeyNum())
+
+	cfg2 := NewRockConfig()
+	cfg2.DataDir = path.Join(tmpDir, "test2")
+	pe2, err := NewMemEng(cfg2)
+	assert.Nil(t, err)
+	err = os.Rename(ckPath, pe2.GetDataDir())
+	assert.Nil(t, err)
+	err = pe2.OpenEng()
+	assert.Nil(t, err)
+	defer pe2.CloseAll()
+	v, err = pe2.GetBytes([]byte("test_after"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	assert.Equal(t, 100, pe2.GetApproximateTotalKeyNum())
+
+	// the broken data file should be checked
+	dataFile := path.Join(pe2.GetDataDir(), memDataFileName)
+	fi, err := os.Stat(dataFile)
+	assert.Nil(t, err)
+	err = os.Truncate(dataFile, fi.Size()-10)
+	assert.Nil(t, err)
+	assert.NotNil(t, pe2.CheckDBEngForRead(pe2.GetDataDir()))
+}
+
+func TestMemEngSkiplistSnapshot(t *testing.T) {
+	testMemEngSnapshot(t)
+}
+
+func TestMemEngBtreeSnapshot(t *testing.T) {
+	useSkiplist = false
+	defer func() {
+		useSkiplist = true
+	}()
+	testMemEngSnapshot(t)
+}
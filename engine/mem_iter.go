@@ -1,6 +1,8 @@
 package engine
 
 import (
+	"bytes"
+
 	"github.com/youzan/ZanRedisDB/common"
 )
 
@@ -67,23 +69,59 @@ func (it *memIterator) Prev() {
 }
 
 func (it *memIterator) Seek(key []byte) {
+	if it.lowerBound != nil && bytes.Compare(key, it.lowerBound) < 0 {
+		key = it.lowerBound
+	}
 	it.memit.Seek(key)
 }
 
 func (it *memIterator) SeekForPrev(key []byte) {
+	if it.upperBound != nil && bytes.Compare(key, it.upperBound) >= 0 {
+		it.seekToUpperBound()
+		return
+	}
 	it.memit.SeekForPrev(key)
 }
 
 func (it *memIterator) SeekToFirst() {
+	if it.lowerBound != nil {
+		it.memit.Seek(it.lowerBound)
+		return
+	}
 	it.memit.First()
 }
 
 func (it *memIterator) SeekToLast() {
+	if it.upperBound != nil {
+		it.seekToUpperBound()
+		return
+	}
 	it.memit.Last()
 }
 
+// seek to the last key less than the exclusive upper bound
+func (it *memIterator) seekToUpperBound() {
+	it.memit.SeekForPrev(it.upperBound)
+	if it.memit.Valid() && bytes.Equal(it.memit.Key(), it.upperBound) {
+		it.memit.Prev()
+	}
+}
+
 func (it *memIterator) Valid() bool {
-	return it.memit.Valid()
+	if !it.memit.Valid() {
+		return false
+	}
+	if it.lowerBound == nil && it.upperBound == nil {
+		return true
+	}
+	k := it.memit.Key()
+	if it.lowerBound != nil && bytes.Compare(k, it.lowerBound) < 0 {
+		return false
+	}
+	if it.upperBound != nil && bytes.Compare(k, it.upperBound) >= 0 {
+		return false
+	}
+	return true
 }
 
 // the bytes returned will be freed after next
@@ -0,0 +1,275 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+const (
+	memDataFileName = "mem.dat"
+	// the header is the version line and the line of the data number
+	memDataHeaderLen = 22
+	// the old data file with the 8 bytes length before each key and value
+	memDataVersionV1 = "v001\n"
+	// the key and value with varint length in the snappy framed stream
+	memDataVersion = "v002\n"
+)
+
+var errInvalidMemDataFile = errors.New("invalid mem engine data file")
+
+type memEngCheckpoint struct {
+	pe *memEng
+}
+
+func (pck *memEngCheckpoint) Save(cpath string, notify chan struct{}) error {
+	err := os.Mkdir(cpath, common.DIR_PERM)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	return pck.pe.saveSnapshot(path.Join(cpath, memDataFileName), notify)
+}
+
+// save all the data to the file at a consistent point. The btree is cloned and the writes
+// can continue while saving. The skiplist has no snapshot, so the writes are blocked
+// only while copying the data to a btree in memory, and the file is written from the copy.
+func (pe *memEng) saveSnapshot(fileName string, notify chan struct{}) error {
+	start := time.Now()
+	pe.rwmutex.RLock()
+	if pe.IsClosed() {
+		pe.rwmutex.RUnlock()
+		return errDBEngClosed
+	}
+	var snap *btree
+	if useSkiplist {
+		snap = pe.copySkiplist()
+	} else {
+		c := pe.eng.Clone()
+		snap = &c
+	}
+	pe.rwmutex.RUnlock()
+	defer snap.Reset()
+	if notify != nil {
+		close(notify)
+	}
+	bit := snap.MakeIter()
+	tmpFile := fileName + ".tmp"
+	cnt, n, err := saveMemDBToFile(&bit, tmpFile)
+	bit.Close()
+	if err != nil {
+		dbLog.Infof("save mem data to %v failed: %s", fileName, err.Error())
+		return err
+	}
+	err = os.Rename(tmpFile, fileName)
+	if err != nil {
+		dbLog.Errorf("save mem data to %v failed: %v ", fileName, err.Error())
+		return err
+	}
+	dbLog.Infof("save mem data to %v done: %v keys, %v bytes, cost: %v", fileName, cnt, n, time.Since(start))
+	return nil
+}
+
+// copy all the data in skiplist to a btree, the writes are blocked while copying
+func (pe *memEng) copySkiplist() *btree {
+	pe.snapshotMutex.Lock()
+	defer pe.snapshotMutex.Unlock()
+	snap := &btree{
+		cmp: cmpItem,
+	}
+	it := pe.slEng.NewIterator()
+	defer it.Close()
+	for it.First(); it.Valid(); it.Next() {
+		// the key and value from the skiplist iterator are already copied
+		snap.Set(&kvitem{key: it.Key(), value: it.Value()})
+	}
+	return snap
+}
+
+func (pe *memEng) getDataFileName() string {
+	return path.Join(pe.GetDataDir(), memDataFileName)
+}
+
+// check all the data in the checkpoint can be read
+func (pe *memEng) CheckDBEngForRead(fullPath string) error {
+	fileName := path.Join(fullPath, memDataFileName)
+	_, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	return loadMemDBFromFile(fileName, func(key []byte, value []byte) error {
+		return nil
+	})
+}
+
+func loadMemDBFromFile(fileName string, loader func([]byte, []byte) error) error {
+	// read from checkpoint file
+	fs, err := os.Open(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer fs.Close()
+	r := bufio.NewReader(fs)
+	header := make([]byte, memDataHeaderLen)
+	_, err = io.ReadFull(r, header)
+	if err != nil {
+		return err
+	}
+	switch string(header[:len(memDataVersion)]) {
+	case memDataVersionV1:
+		return loadMemDBV1(r, loader)
+	case memDataVersion:
+		dataNum, err := strconv.ParseInt(string(header[len(memDataVersion):memDataHeaderLen-1]), 10, 64)
+		if err != nil {
+			return errInvalidMemDataFile
+		}
+		return loadMemDB(bufio.NewReader(snappy.NewReader(r)), dataNum, loader)
+	}
+	return errInvalidMemDataFile
+}
+
+func loadMemDB(r *bufio.Reader, dataNum int64, loader func([]byte, []byte) error) error {
+	keyBuf := make([]byte, 0, 1024)
+	valueBuf := make([]byte, 0, 1024)
+	readBytes := func(buf []byte) ([]byte, error) {
+		vl, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(cap(buf)) < vl {
+			buf = make([]byte, vl)
+		}
+		buf = buf[:vl]
+		_, err = io.ReadFull(r, buf)
+		return buf, err
+	}
+	for i := int64(0); i < dataNum; i++ {
+		var err error
+		keyBuf, err = readBytes(keyBuf)
+		if err != nil {
+			return fmt.Errorf("read key %v of %v failed: %v", i, dataNum, err)
+		}
+		valueBuf, err = readBytes(valueBuf)
+		if err != nil {
+			return fmt.Errorf("read value %v of %v failed: %v", i, dataNum, err)
+		}
+		err = loader(keyBuf, valueBuf)
+		if err != nil {
+			return err
+		}
+	}
+	// make sure no more data after all the keys
+	_, err := r.ReadByte()
+	if err != io.EOF {
+		return errInvalidMemDataFile
+	}
+	return nil
+}
+
+func loadMemDBV1(r io.Reader, loader func([]byte, []byte) error) error {
+	lenBuf := make([]byte, 8)
+	dataKeyBuf := make([]byte, 0, 1024)
+	dataValueBuf := make([]byte, 0, 1024)
+	for {
+		_, err := io.ReadFull(r, lenBuf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		vl := binary.BigEndian.Uint64(lenBuf)
+		if uint64(len(dataKeyBuf)) < vl {
+			dataKeyBuf = make([]byte, vl)
+		}
+		_, err = io.ReadFull(r, dataKeyBuf[:vl])
+		if err != nil {
+			return err
+		}
+		key := dataKeyBuf[:vl]
+		_, err = io.ReadFull(r, lenBuf)
+		if err != nil {
+			return err
+		}
+		vl = binary.BigEndian.Uint64(lenBuf)
+		if uint64(len(dataValueBuf)) < vl {
+			dataValueBuf = make([]byte, vl)
+		}
+		_, err = io.ReadFull(r, dataValueBuf[:vl])
+		if err != nil {
+			return err
+		}
+		value := dataValueBuf[:vl]
+		err = loader(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save all the data in iterator to the file and return the number of keys and the file size,
+// the file is synced before return.
+func saveMemDBToFile(it memIter, fileName string) (int64, int64, error) {
+	fs, err := os.OpenFile(fileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, common.FILE_PERM)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer fs.Close()
+	// the data number will be updated after all the data written
+	_, err = fs.Write([]byte(fmt.Sprintf("%s%016d\n", memDataVersion, 0)))
+	if err != nil {
+		return 0, 0, err
+	}
+	sw := snappy.NewBufferedWriter(fs)
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeBytes := func(b []byte) error {
+		n := binary.PutUvarint(buf, uint64(len(b)))
+		_, err := sw.Write(buf[:n])
+		if err != nil {
+			return err
+		}
+		_, err = sw.Write(b)
+		return err
+	}
+	dataNum := int64(0)
+	for it.First(); it.Valid(); it.Next() {
+		err = writeBytes(it.Key())
+		if err != nil {
+			return 0, 0, err
+		}
+		err = writeBytes(it.Value())
+		if err != nil {
+			return 0, 0, err
+		}
+		dataNum++
+	}
+	err = sw.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = fs.WriteAt([]byte(fmt.Sprintf("%s%016d\n", memDataVersion, dataNum)), 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = fs.Sync()
+	if err != nil {
+		return 0, 0, err
+	}
+	fi, err := fs.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	return dataNum, fi.Size(), nil
+}
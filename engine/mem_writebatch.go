@@ -41,6 +41,8 @@ func (wb *memWriteBatch) Destroy() {
 
 func (wb *memWriteBatch) commitSkiplist() error {
 	defer wb.Clear()
+	wb.db.snapshotMutex.RLock()
+	defer wb.db.snapshotMutex.RUnlock()
 	var err error
 	for _, w := range wb.ops {
 		switch w.op {
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+const defaultMigrateBatchNum = 1000
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// EngineDigest is the summary of all the keys and values in the engine, the engines
+// with the same data have the same digest since all the engines iterate in the same
+// order.
+type EngineDigest struct {
+	KeyNum   int64
+	Checksum uint64
+}
+
+func (d EngineDigest) String() string {
+	return fmt.Sprintf("keys: %v, checksum: %016x", d.KeyNum, d.Checksum)
+}
+
+type engineDigester struct {
+	keyNum int64
+	h      hash.Hash64
+	lenBuf [binary.MaxVarintLen64]byte
+}
+
+func newEngineDigester() *engineDigester {
+	return &engineDigester{
+		h: crc64.New(crc64Table),
+	}
+}
+
+func (d *engineDigester) add(key []byte, value []byte) {
+	d.keyNum++
+	n := binary.PutUvarint(d.lenBuf[:], uint64(len(key)))
+	d.h.Write(d.lenBuf[:n])
+	d.h.Write(key)
+	n = binary.PutUvarint(d.lenBuf[:], uint64(len(value)))
+	d.h.Write(d.lenBuf[:n])
+	d.h.Write(value)
+}
+
+func (d *engineDigester) digest() EngineDigest {
+	return EngineDigest{
+		KeyNum:   d.keyNum,
+		Checksum: d.h.Sum64(),
+	}
+}
+
+// iterate all the data in the engine, the value is the raw value stored in the engine
+func getFullScanIterator(eng KVEngine) (Iterator, error) {
+	it, err := eng.GetIterator(IteratorOpts{
+		Range:      Range{Type: common.RangeClose},
+		TotalOrder: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	it.SeekToFirst()
+	return it, nil
+}
+
+// DigestEngine scans all the data in the engine to get the key number and checksum
+func DigestEngine(eng KVEngine) (EngineDigest, error) {
+	it, err := getFullScanIterator(eng)
+	if err != nil {
+		return EngineDigest{}, err
+	}
+	defer it.Close()
+	d := newEngineDigester()
+	for ; it.Valid(); it.Next() {
+		d.add(it.RefKey(), it.RefValue())
+	}
+	return d.digest(), nil
+}
+
+// CopyEngine copies all the data from the src engine to the dst engine and returns the digest
+// of the copied data. The counters written by merge are copied as the merged values.
+func CopyEngine(src KVEngine, dst KVEngine, batchNum int) (EngineDigest, error) {
+	if batchNum <= 0 {
+		batchNum = defaultMigrateBatchNum
+	}
+	it, err := getFullScanIterator(src)
+	if err != nil {
+		return EngineDigest{}, err
+	}
+	defer it.Close()
+	wb := dst.NewWriteBatch()
+	defer wb.Destroy()
+	d := newEngineDigester()
+	start := time.Now()
+	n := 0
+	for ; it.Valid(); it.Next() {
+		// the write batch may keep the reference, so we need copy
+		k := it.Key()
+		v := it.Value()
+		d.add(k, v)
+		wb.Put(k, v)
+		n++
+		if n >= batchNum {
+			err = dst.Write(wb)
+			if err != nil {
+				return EngineDigest{}, err
+			}
+			wb.Clear()
+			n = 0
+		}
+		if d.keyNum%1000000 == 0 {
+			dbLog.Infof("copied %v keys from %v to %v, cost: %v", d.keyNum, src.GetDataDir(), dst.GetDataDir(), time.Since(start))
+		}
+	}
+	if n > 0 {
+		err = dst.Write(wb)
+		if err != nil {
+			return EngineDigest{}, err
+		}
+	}
+	dbLog.Infof("copy from %v to %v done, %v, cost: %v", src.GetDataDir(), dst.GetDataDir(), d.digest(), time.Since(start))
+	return d.digest(), nil
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestEngine(t *testing.T, dataDir string, engType string) KVEngine {
+	cfg := NewRockConfig()
+	cfg.DataDir = dataDir
+	cfg.EngineType = engType
+	eng, err := NewKVEng(cfg)
+	require.Nil(t, err)
+	err = eng.OpenEng()
+	require.Nil(t, err)
+	return eng
+}
+
+func TestCopyEngine(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "engine_migrate")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	src := openTestEngine(t, path.Join(tmpDir, "src"), "pebble")
+	defer src.CloseAll()
+	keyNum := 2500
+	wb := src.NewWriteBatch()
+	for i := 0; i < keyNum; i++ {
+		wb.Put([]byte("test:key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(i)))
+	}
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, 3)
+	wb.Merge([]byte("test:counter"), buf)
+	wb.Merge([]byte("test:counter"), buf)
+	err = src.Write(wb)
+	wb.Destroy()
+	require.Nil(t, err)
+
+	srcDigest, err := DigestEngine(src)
+	require.Nil(t, err)
+	assert.Equal(t, int64(keyNum+1), srcDigest.KeyNum)
+
+	last := src
+	for _, engType := range []string{"badger", "mem"} {
+		dst := openTestEngine(t, path.Join(tmpDir, engType), engType)
+		defer dst.CloseAll()
+		copied, err := CopyEngine(last, dst, 100)
+		require.Nil(t, err)
+		assert.Equal(t, srcDigest, copied)
+		dstDigest, err := DigestEngine(dst)
+		require.Nil(t, err)
+		assert.Equal(t, srcDigest, dstDigest)
+
+		v, err := dst.GetBytes([]byte("test:key10"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value10"), v)
+		n, err := GetRocksdbUint64(dst.GetBytes([]byte("test:counter")))
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(6), n)
+		last = dst
+	}
+
+	// the digest should be changed after the data changed
+	wb = src.NewWriteBatch()
+	wb.Delete([]byte("test:key1"))
+	err = src.Write(wb)
+	wb.Destroy()
+	require.Nil(t, err)
+	changed, err := DigestEngine(src)
+	require.Nil(t, err)
+	assert.NotEqual(t, srcDigest, changed)
+}
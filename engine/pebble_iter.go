@@ -58,8 +58,9 @@ func (it *pebbleIterator) Seek(key []byte) {
 	it.Iterator.SeekGE(key)
 }
 
+// seek to the last key less than or equal to the key, the same as rocksdb
 func (it *pebbleIterator) SeekForPrev(key []byte) {
-	it.Iterator.SeekLT(key)
+	it.Iterator.SeekLT(append(key[:len(key):len(key)], 0))
 }
 
 func (it *pebbleIterator) SeekToFirst() {
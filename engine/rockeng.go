@@ -552,7 +552,7 @@ func (r *RockEng) GetValueWithOpNoLock(key []byte,
 }
 
 func (r *RockEng) GetIterator(opts IteratorOpts) (Iterator, error) {
-	dbit, err := newRockIterator(r.eng, true, opts)
+	dbit, err := newRockIterator(r.eng, !opts.TotalOrder, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,208 @@
+package node
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+var errBloomOptions = errors.New("ERR syntax error, unknown option for filter")
+
+// bf.reserve key error_rate capacity [EXPANSION expansion] [NONSCALING]
+func (kvsm *kvStoreSM) localBFReserveCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	errRate, err := strconv.ParseFloat(string(cmd.Args[2]), 64)
+	if err != nil {
+		return nil, rockredis.ErrBloomErrorRate
+	}
+	capacity, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+	if err != nil {
+		return nil, rockredis.ErrBloomCapacity
+	}
+	expansion := int64(rockredis.DefaultBloomExpansion)
+	nonScaling := false
+	for i := 4; i < len(cmd.Args); i++ {
+		switch strings.ToLower(string(cmd.Args[i])) {
+		case "expansion":
+			if i+1 >= len(cmd.Args) {
+				return nil, errBloomOptions
+			}
+			i++
+			expansion, err = strconv.ParseInt(string(cmd.Args[i]), 10, 64)
+			if err != nil {
+				return nil, rockredis.ErrBloomExpansion
+			}
+		case "nonscaling":
+			nonScaling = true
+		default:
+			return nil, errBloomOptions
+		}
+	}
+	return nil, kvsm.store.BFReserve(ts, cmd.Args[1], errRate, capacity, expansion, nonScaling)
+}
+
+func (kvsm *kvStoreSM) localBFAddCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	rets, err := kvsm.store.BFAdd(ts, cmd.Args[1], cmd.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	return rets[0], nil
+}
+
+func (kvsm *kvStoreSM) localBFMAddCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.BFAdd(ts, cmd.Args[1], cmd.Args[2:]...)
+}
+
+func (kvsm *kvStoreSM) localBFClearCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.BFClear(ts, cmd.Args[1])
+}
+
+func (kvsm *kvStoreSM) localBFExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	duration, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return int64(0), err
+	}
+	return kvsm.store.BFExpire(ts, cmd.Args[1], duration)
+}
+
+func (kvsm *kvStoreSM) localBFPersistCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.BFPersist(ts, cmd.Args[1])
+}
+
+// cf.reserve key capacity [EXPANSION expansion]
+func (kvsm *kvStoreSM) localCFReserveCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	capacity, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return nil, rockredis.ErrCuckooCapacity
+	}
+	expansion := int64(rockredis.DefaultCuckooExpansion)
+	if len(cmd.Args) > 3 {
+		if len(cmd.Args) != 5 || strings.ToLower(string(cmd.Args[3])) != "expansion" {
+			return nil, errBloomOptions
+		}
+		expansion, err = strconv.ParseInt(string(cmd.Args[4]), 10, 64)
+		if err != nil {
+			return nil, rockredis.ErrBloomExpansion
+		}
+	}
+	return nil, kvsm.store.CFReserve(ts, cmd.Args[1], capacity, expansion)
+}
+
+func (kvsm *kvStoreSM) localCFAddCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.CFAdd(ts, cmd.Args[1], cmd.Args[2])
+}
+
+func (kvsm *kvStoreSM) localCFDelCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.CFDel(ts, cmd.Args[1], cmd.Args[2])
+}
+
+func (kvsm *kvStoreSM) localCFClearCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.CFClear(ts, cmd.Args[1])
+}
+
+func (kvsm *kvStoreSM) localCFExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	duration, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return int64(0), err
+	}
+	return kvsm.store.CFExpire(ts, cmd.Args[1], duration)
+}
+
+func (kvsm *kvStoreSM) localCFPersistCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.CFPersist(ts, cmd.Args[1])
+}
+
+func (nd *KVNode) bfExistsCommand(conn redcon.Conn, cmd redcon.Command) {
+	rets, err := nd.store.BFExists(cmd.Args[1], cmd.Args[2])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteInt64(rets[0])
+}
+
+func (nd *KVNode) bfMExistsCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args[2:]) > common.MAX_BATCH_NUM {
+		conn.WriteError(errTooMuchBatchSize.Error())
+		return
+	}
+	rets, err := nd.store.BFExists(cmd.Args[1], cmd.Args[2:]...)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(len(rets))
+	for _, v := range rets {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) bfInfoCommand(conn redcon.Conn, cmd redcon.Command) {
+	info, err := nd.store.BFInfo(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(10)
+	conn.WriteString("Capacity")
+	conn.WriteInt64(info.Capacity)
+	conn.WriteString("Size")
+	conn.WriteInt64(info.Size)
+	conn.WriteString("Number of filters")
+	conn.WriteInt64(info.Filters)
+	conn.WriteString("Number of items inserted")
+	conn.WriteInt64(info.Items)
+	conn.WriteString("Expansion rate")
+	conn.WriteInt64(info.Expansion)
+}
+
+func (nd *KVNode) bfKeyExistCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.BFKeyExists(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) bfttlCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.BFTtl(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) cfExistsCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.CFExists(cmd.Args[1], cmd.Args[2]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) cfCountCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.CFCount(cmd.Args[1], cmd.Args[2]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) cfKeyExistCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.CFKeyExists(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) cfttlCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.CFTtl(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
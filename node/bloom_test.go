@@ -0,0 +1,64 @@
+package node
+
+import (
+	"os"
+	"testing"
+
+	"github.com/absolute8511/redcon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKVNode_bloomCommand(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	testKey := []byte("default:test:1")
+	testCKey := []byte("default:test:2")
+	testItem := []byte("1")
+	testItem2 := []byte("2")
+
+	tests := []struct {
+		name string
+		args redcon.Command
+	}{
+		{"bf.reserve", buildCommand([][]byte{[]byte("bf.reserve"), testKey, []byte("0.01"), []byte("100"), []byte("EXPANSION"), []byte("2")})},
+		{"bf.add", buildCommand([][]byte{[]byte("bf.add"), testKey, testItem})},
+		{"bf.madd", buildCommand([][]byte{[]byte("bf.madd"), testKey, testItem, testItem2})},
+		{"bf.exists", buildCommand([][]byte{[]byte("bf.exists"), testKey, testItem})},
+		{"bf.mexists", buildCommand([][]byte{[]byte("bf.mexists"), testKey, testItem, testItem2})},
+		{"bf.info", buildCommand([][]byte{[]byte("bf.info"), testKey})},
+		{"bf.keyexist", buildCommand([][]byte{[]byte("bf.keyexist"), testKey})},
+		{"bf.expire", buildCommand([][]byte{[]byte("bf.expire"), testKey, []byte("10")})},
+		{"bf.ttl", buildCommand([][]byte{[]byte("bf.ttl"), testKey})},
+		{"bf.persist", buildCommand([][]byte{[]byte("bf.persist"), testKey})},
+		{"bf.clear", buildCommand([][]byte{[]byte("bf.clear"), testKey})},
+		{"cf.reserve", buildCommand([][]byte{[]byte("cf.reserve"), testCKey, []byte("100"), []byte("EXPANSION"), []byte("2")})},
+		{"cf.add", buildCommand([][]byte{[]byte("cf.add"), testCKey, testItem})},
+		{"cf.exists", buildCommand([][]byte{[]byte("cf.exists"), testCKey, testItem})},
+		{"cf.count", buildCommand([][]byte{[]byte("cf.count"), testCKey, testItem})},
+		{"cf.del", buildCommand([][]byte{[]byte("cf.del"), testCKey, testItem})},
+		{"cf.keyexist", buildCommand([][]byte{[]byte("cf.keyexist"), testCKey})},
+		{"cf.expire", buildCommand([][]byte{[]byte("cf.expire"), testCKey, []byte("10")})},
+		{"cf.ttl", buildCommand([][]byte{[]byte("cf.ttl"), testCKey})},
+		{"cf.persist", buildCommand([][]byte{[]byte("cf.persist"), testCKey})},
+		{"cf.clear", buildCommand([][]byte{[]byte("cf.clear"), testCKey})},
+	}
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+	c := &fakeRedisConn{}
+	for _, cmd := range tests {
+		c.Reset()
+		origCmd := append([]byte{}, cmd.args.Raw...)
+		handler, ok := nd.router.GetCmdHandler(cmd.name)
+		if ok {
+			handler(c, cmd.args)
+			assert.Nil(t, c.GetError())
+		} else {
+			whandler, _ := nd.router.GetWCmdHandler(cmd.name)
+			rsp, err := whandler(cmd.args)
+			assert.Nil(t, err)
+			_, ok := rsp.(error)
+			assert.True(t, !ok, cmd.name)
+		}
+		assert.Equal(t, origCmd, cmd.args.Raw)
+	}
+}
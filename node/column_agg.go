@@ -0,0 +1,140 @@
+package node
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+var (
+	columnCondSplitter = regexp.MustCompile(`(?i)\s+and\s+`)
+	// the longer operators should be matched first
+	columnCondOps = []struct {
+		op   string
+		cond rockredis.ColumnCondOp
+	}{
+		{">=", rockredis.ColumnCondGE},
+		{"<=", rockredis.ColumnCondLE},
+		{"!=", rockredis.ColumnCondNE},
+		{"=", rockredis.ColumnCondEQ},
+		{">", rockredis.ColumnCondGT},
+		{"<", rockredis.ColumnCondLT},
+	}
+	columnAggFuncs = map[string]rockredis.ColumnAggFunc{
+		"count": rockredis.ColumnAggCount,
+		"sum":   rockredis.ColumnAggSum,
+		"min":   rockredis.ColumnAggMin,
+		"max":   rockredis.ColumnAggMax,
+		"avg":   rockredis.ColumnAggAvg,
+	}
+)
+
+type ColumnAggResults struct {
+	Table   string
+	Aggs    []rockredis.ColumnAggregation
+	GroupBy bool
+	Groups  []rockredis.ColumnAggGroup
+}
+
+// parse the where clause like "field1 > 1 and field2 = xx"
+func parseColumnConditions(where []byte) ([]rockredis.ColumnCondition, error) {
+	where = bytes.TrimSpace(bytes.Trim(where, "\""))
+	if len(where) == 0 {
+		return nil, common.ErrInvalidArgs
+	}
+	var conds []rockredis.ColumnCondition
+	for _, c := range columnCondSplitter.Split(string(where), -1) {
+		found := false
+		for _, op := range columnCondOps {
+			pos := strings.Index(c, op.op)
+			if pos <= 0 {
+				continue
+			}
+			field := strings.TrimSpace(c[:pos])
+			value := strings.Trim(strings.TrimSpace(c[pos+len(op.op):]), "'")
+			if len(field) == 0 {
+				return nil, common.ErrInvalidArgs
+			}
+			conds = append(conds, rockredis.ColumnCondition{
+				Field: []byte(field),
+				Op:    op.cond,
+				Value: []byte(value),
+			})
+			found = true
+			break
+		}
+		if !found {
+			return nil, common.ErrInvalidArgs
+		}
+	}
+	return conds, nil
+}
+
+// COL.AGG ns:table FUNC field [FUNC field ...] [WHERE "field1 > 1 and field2 = xx"] [GROUP BY field]
+// the FUNC can be COUNT, SUM, MIN, MAX and AVG, and COUNT * will count all the matched rows.
+func (nd *KVNode) columnAggCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 4 {
+		return nil, common.ErrInvalidArgs
+	}
+	table, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	var aggs []rockredis.ColumnAggregation
+	var conds []rockredis.ColumnCondition
+	var groupBy []byte
+	args := cmd.Args[2:]
+	for len(args) > 0 {
+		name := strings.ToLower(string(args[0]))
+		if name == "where" {
+			if len(args) < 2 || conds != nil {
+				return nil, common.ErrInvalidArgs
+			}
+			conds, err = parseColumnConditions(args[1])
+			if err != nil {
+				return nil, err
+			}
+			args = args[2:]
+			continue
+		}
+		if name == "group" {
+			if len(args) < 3 || strings.ToLower(string(args[1])) != "by" || groupBy != nil {
+				return nil, common.ErrInvalidArgs
+			}
+			groupBy = args[2]
+			args = args[3:]
+			continue
+		}
+		fn, ok := columnAggFuncs[name]
+		if !ok || len(args) < 2 || conds != nil || groupBy != nil {
+			return nil, common.ErrInvalidArgs
+		}
+		agg := rockredis.ColumnAggregation{Func: fn, Field: args[1]}
+		if string(args[1]) == "*" {
+			if fn != rockredis.ColumnAggCount {
+				return nil, common.ErrInvalidArgs
+			}
+			agg.Field = nil
+		}
+		aggs = append(aggs, agg)
+		args = args[2:]
+	}
+	if len(aggs) == 0 {
+		return nil, common.ErrInvalidArgs
+	}
+	groups, err := nd.store.ColumnAggregate(table, aggs, conds, groupBy)
+	if err != nil {
+		nd.rn.Infof("column aggregate %v error: %v", string(table), err)
+		return nil, err
+	}
+	return &ColumnAggResults{
+		Table:   string(table),
+		Aggs:    aggs,
+		GroupBy: groupBy != nil,
+		Groups:  groups,
+	}, nil
+}
@@ -3,6 +3,7 @@ package node
 import (
 	"github.com/youzan/ZanRedisDB/common"
 	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
 )
 
 type NamespaceConfig struct {
@@ -19,6 +20,9 @@ type NamespaceConfig struct {
 	RaftGroupConf    RaftGroupConfig `json:"raft_group_conf"`
 	ExpirationPolicy string          `json:"expiration_policy"`
 	DataVersion      string          `json:"data_version"`
+	// the partition key is the whole primary key if the version is empty
+	PartitionKeyVersion string `json:"partition_key_version"`
+	PartitionKeyRegex   string `json:"partition_key_regex"`
 }
 
 func NewNSConfig() *NamespaceConfig {
@@ -58,6 +62,7 @@ type MachineConfig struct {
 	RocksDBSharedConfig    engine.SharedRockConfig
 	WALRocksDBOpts         engine.RockOptions `json:"wal_rocksdb_opts"`
 	WALRocksDBSharedConfig engine.SharedRockConfig
+	KeyManager             *encryption.KeyManager
 }
 
 type ReplicaInfo struct {
@@ -0,0 +1,95 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+const (
+	defaultFullTextSearchLimit = 10
+)
+
+type FTSearchResults struct {
+	Table string
+	Total int64
+	Rets  []rockredis.FullTextSearchResult
+}
+
+// FT.STATS ns:table "query"
+// internal command to get the local stats of the full text index for the terms in the query,
+// the stats of all the partitions will be merged and passed to FT.SEARCH.
+func (nd *KVNode) ftStatsCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) != 3 {
+		return nil, common.ErrInvalidArgs
+	}
+	table, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	query := bytes.Trim(cmd.Args[2], "\"")
+	stats, err := nd.store.FullTextIndexStats(table, query)
+	if err != nil {
+		nd.rn.Infof("full text stats %v, %v error: %v", string(table), string(query), err)
+		return nil, err
+	}
+	return stats, nil
+}
+
+// FT.SEARCH ns:table "query" [LIMIT offset num] [STATS stats]
+// all the terms in the query should be matched, and the results are sorted by the BM25 score.
+// The STATS is the json of the stats merged from all the partitions, and the local
+// stats will be used if not given.
+func (nd *KVNode) ftSearchCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 3 {
+		return nil, common.ErrInvalidArgs
+	}
+	table, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	query := bytes.Trim(cmd.Args[2], "\"")
+	offset := 0
+	count := defaultFullTextSearchLimit
+	var stats *rockredis.FullTextSearchStats
+	args := cmd.Args[3:]
+	for len(args) > 0 {
+		switch strings.ToLower(string(args[0])) {
+		case "limit":
+			if len(args) < 3 {
+				return nil, common.ErrInvalidArgs
+			}
+			offset, count, err = parseIndexQueryLimit(args[:3])
+			if err != nil {
+				return nil, err
+			}
+			if offset < 0 {
+				return nil, common.ErrInvalidArgs
+			}
+			args = args[3:]
+		case "stats":
+			if len(args) < 2 {
+				return nil, common.ErrInvalidArgs
+			}
+			stats = &rockredis.FullTextSearchStats{}
+			err = json.Unmarshal(args[1], stats)
+			if err != nil {
+				return nil, common.ErrInvalidArgs
+			}
+			args = args[2:]
+		default:
+			return nil, common.ErrInvalidArgs
+		}
+	}
+	total, rets, err := nd.store.FullTextIndexSearch(table, query, stats, offset, count)
+	if err != nil {
+		nd.rn.Infof("full text search %v, %v error: %v", string(table), string(query), err)
+		return nil, err
+	}
+	nd.rn.Debugf("full text search result count: %v, total: %v", len(rets), total)
+	return &FTSearchResults{Table: string(table), Total: total, Rets: rets}, nil
+}
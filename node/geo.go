@@ -19,6 +19,12 @@ var (
 	ifGeoHashUnitTest = false
 )
 
+var (
+	errGeoSearchFrom          = errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified")
+	errGeoSearchBy            = errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified")
+	errGeoStoreCrossNamespace = errors.New("ERR the source and destination should be in the same namespace")
+)
+
 type searchType int
 
 const (
@@ -34,6 +40,15 @@ const (
 	SORT_DESC
 )
 
+type geoShapeType int
+
+const (
+	GEO_SHAPE_NONE geoShapeType = iota
+	GEO_SHAPE_CIRCLE
+	GEO_SHAPE_BOX
+	GEO_SHAPE_POLYGON
+)
+
 /* usage:
 GEOADD key lon0 lat0 elem0 lon1 lat1 elem1
 */
@@ -175,9 +190,10 @@ func (nd *KVNode) geoposCommand(conn redcon.Conn, cmd redcon.Command) {
 	}
 }
 
+
 /* usage:
 GEORADIUS key longitude latitude radius m|km|ft|mi [WITHCOORD] [WITHDIST]
-[WITHHASH] [COUNT count] [ASC|DESC] [STORE key] [STOREDIST key]
+[WITHHASH] [COUNT count [ANY]] [ASC|DESC]
 */
 func (nd *KVNode) geoRadiusCommand(conn redcon.Conn, cmd redcon.Command) {
 	nd.geoRadiusGeneric(conn, cmd, RADIUS_COORDS)
@@ -185,14 +201,13 @@ func (nd *KVNode) geoRadiusCommand(conn redcon.Conn, cmd redcon.Command) {
 
 /* usage:
 GEORADIUSBYMEMBER key member radius m|km|ft|mi [WITHCOORD] [WITHDIST]
-[WITHHASH] [COUNT count] [ASC|DESC] [STORE key] [STOREDIST key]
+[WITHHASH] [COUNT count [ANY]] [ASC|DESC]
 */
 func (nd *KVNode) geoRadiusByMemberCommand(conn redcon.Conn, cmd redcon.Command) {
 	nd.geoRadiusGeneric(conn, cmd, RADIUS_MEMBER)
 }
 
 func (nd *KVNode) geoRadiusGeneric(conn redcon.Conn, cmd redcon.Command, stype searchType) {
-	var x, y float64
 	var err error
 
 	if card, err := nd.store.ZCard(cmd.Args[1]); err != nil || card == 0 {
@@ -205,107 +220,377 @@ func (nd *KVNode) geoRadiusGeneric(conn redcon.Conn, cmd redcon.Command, stype s
 	}
 
 	var baseArgs = 0
+	shape := &geoShape{stype: GEO_SHAPE_CIRCLE}
 
 	switch stype {
 	case RADIUS_COORDS:
 		baseArgs = 4
-		if x, err = strconv.ParseFloat(string(cmd.Args[2]), 64); err != nil {
+		if shape.lon, err = strconv.ParseFloat(string(cmd.Args[2]), 64); err != nil {
 			conn.WriteError("Err value is not a valid float")
 			return
 		}
-		if y, err = strconv.ParseFloat(string(cmd.Args[3]), 64); err != nil {
+		if shape.lat, err = strconv.ParseFloat(string(cmd.Args[3]), 64); err != nil {
 			conn.WriteError("Err value is not a valid float")
 			return
 		}
 
 	case RADIUS_MEMBER:
 		baseArgs = 3
-		hash, err := nd.store.ZScore(cmd.Args[1], cmd.Args[2])
-		if err != nil {
-			conn.WriteError(err.Error())
-			return
-		}
-		x, y = geohash.DecodeToLongLatWGS84(uint64(hash))
+		shape.member = cmd.Args[2]
 
 	default:
 		conn.WriteError("unknown georadius search type")
 		return
 	}
 
-	radiusMeters, conversion, err := extractDistance(cmd.Args[baseArgs], cmd.Args[baseArgs+1])
+	shape.radius, shape.conversion, err = extractDistance(cmd.Args[baseArgs], cmd.Args[baseArgs+1])
 	if err != nil {
 		conn.WriteError(err.Error())
 		return
 	}
 
-	var withdist, withhash, withcoords bool
-	var sortT sortType
-	var optLen, count int
-
 	/* Parse the radius search opts.*/
-	opts := cmd.Args[baseArgs+2:]
-	for i := 0; i < len(opts); i++ {
-		option := strings.ToLower(string(opts[i]))
-		switch option {
-		case "withdist":
-			withdist = true
-			optLen++
-		case "withcoord":
-			withcoords = true
-			optLen++
-		case "withhash":
-			withhash = true
-			optLen++
-		case "asc":
-			sortT = SORT_ASC
-		case "desc":
-			sortT = SORT_DESC
-		case "count":
-			if i+1 >= len(opts) {
-				err = errors.New("ERR syntax error")
-			} else {
-				count, err = strconv.Atoi(string(opts[i+1]))
-				if err != nil {
-					err = errors.New("ERR value is not an integer or out of range")
-				} else if count < 0 {
-					err = errors.New("ERR COUNT must > 0")
-				} else {
-					i++
-				}
-			}
-		default:
-			err = errors.New("ERR syntax error")
+	opts, err := parseGeoSearchOpts(cmd.Args[baseArgs+2:], false)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+
+	plist, err := geoSearchMembers(nd.store, cmd.Args[1], shape, opts)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	writeGeoPoints(conn, plist, shape.conversion, opts)
+}
+
+/* usage:
+GEOSEARCH key [FROMMEMBER member] [FROMLONLAT longitude latitude]
+[BYRADIUS radius m|km|ft|mi] [BYBOX width height m|km|ft|mi]
+[ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+*/
+func (nd *KVNode) geosearchCommand(conn redcon.Conn, cmd redcon.Command) {
+	shape, opts, err := parseGeoSearchArgs(cmd.Args[2:], false)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	plist, err := geoSearchMembers(nd.store, cmd.Args[1], shape, opts)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	writeGeoPoints(conn, plist, shape.conversion, opts)
+}
+
+/* usage:
+GEOSEARCHSTORE destination source [FROMMEMBER member] [FROMLONLAT longitude latitude]
+[BYRADIUS radius m|km|ft|mi] [BYBOX width height m|km|ft|mi]
+[ASC|DESC] [COUNT count [ANY]] [STOREDIST]
+
+The source and destination should be in the same partition.
+*/
+func (nd *KVNode) geosearchstoreCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 7 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	// check the options before propose
+	if _, _, err := parseGeoSearchArgs(cmd.Args[3:], true); err != nil {
+		return nil, err
+	}
+	ns, _, err := common.ExtractNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	srcNs, src, err := common.ExtractNamesapce(cmd.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	if srcNs != ns {
+		return nil, errGeoStoreCrossNamespace
+	}
+	args := make([][]byte, len(cmd.Args))
+	copy(args, cmd.Args)
+	args[2] = src
+	return rebuildFirstKeyAndPropose(nd, buildCommand(args), checkAndRewriteIntRsp)
+}
+
+func (kvsm *kvStoreSM) localGeoSearchStoreCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	if len(cmd.Args) < 7 {
+		return nil, common.ErrInvalidArgs
+	}
+	shape, opts, err := parseGeoSearchArgs(cmd.Args[3:], true)
+	if err != nil {
+		return nil, err
+	}
+	plist, err := geoSearchMembers(kvsm.store, cmd.Args[2], shape, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := kvsm.store.ZClear(ts, cmd.Args[1]); err != nil {
+		return nil, err
+	}
+	if len(plist) == 0 {
+		return int64(0), nil
+	}
+	mlist := make([]common.ScorePair, 0, len(plist))
+	for _, p := range plist {
+		score := p.score
+		if opts.storeDist {
+			score = p.dist / shape.conversion
+		}
+		mlist = append(mlist, common.ScorePair{Score: score, Member: p.member})
+	}
+	if _, err := kvsm.store.ZAdd(ts, cmd.Args[1], mlist...); err != nil {
+		return nil, err
+	}
+	return int64(len(mlist)), nil
+}
+
+/* usage:
+GEOWITHIN key lon0 lat0 lon1 lat1 lon2 lat2 ... lonN latN [WITHCOORD] [WITHDIST]
+[WITHHASH] [COUNT count [ANY]] [ASC|DESC]
+
+Return the members inside the polygon, at least 3 vertices are needed and the
+polygon will be closed automatically. The distance is measured from the center
+of the polygon bounding box.
+*/
+func (nd *KVNode) geowithinCommand(conn redcon.Conn, cmd redcon.Command) {
+	shape := &geoShape{stype: GEO_SHAPE_POLYGON, conversion: 1}
+	args := cmd.Args[2:]
+	for len(args) >= 2 {
+		lon, err := strconv.ParseFloat(string(args[0]), 64)
+		if err != nil {
+			break
 		}
+		lat, err := strconv.ParseFloat(string(args[1]), 64)
 		if err != nil {
-			conn.WriteError(err.Error())
+			conn.WriteError("ERR value is not a valid float")
 			return
 		}
+		shape.polygon = append(shape.polygon, geohash.Point{Longitude: lon, Latitude: lat})
+		args = args[2:]
+	}
+	if len(shape.polygon) < 3 {
+		conn.WriteError("ERR " + geohash.ErrInvalidPolygon.Error())
+		return
+	}
+	opts, err := parseGeoSearchOpts(args, false)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	plist, err := geoSearchMembers(nd.store, cmd.Args[1], shape, opts)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	writeGeoPoints(conn, plist, shape.conversion, opts)
+}
+
+type geoSearchOpts struct {
+	withdist   bool
+	withhash   bool
+	withcoords bool
+	sortT      sortType
+	count      int
+	// return as soon as enough matches are found
+	any bool
+	// store the distance instead of geohash for geosearchstore
+	storeDist bool
+}
+
+func (opts *geoSearchOpts) optLen() int {
+	l := 0
+	if opts.withdist {
+		l++
+	}
+	if opts.withhash {
+		l++
+	}
+	if opts.withcoords {
+		l++
+	}
+	return l
+}
+
+// parse the result option at position i, return the next position to parse and
+// false if the option is unknown.
+func parseGeoSearchResultOpt(opts *geoSearchOpts, args [][]byte, i int) (int, bool, error) {
+	option := strings.ToLower(string(args[i]))
+	switch option {
+	case "withdist":
+		opts.withdist = true
+	case "withcoord":
+		opts.withcoords = true
+	case "withhash":
+		opts.withhash = true
+	case "asc":
+		opts.sortT = SORT_ASC
+	case "desc":
+		opts.sortT = SORT_DESC
+	case "count":
+		if i+1 >= len(args) {
+			return i, true, errors.New("ERR syntax error")
+		}
+		count, err := strconv.Atoi(string(args[i+1]))
+		if err != nil {
+			return i, true, errors.New("ERR value is not an integer or out of range")
+		} else if count < 0 {
+			return i, true, errors.New("ERR COUNT must > 0")
+		}
+		opts.count = count
+		i++
+		if i+1 < len(args) && strings.ToLower(string(args[i+1])) == "any" {
+			opts.any = true
+			i++
+		}
+	default:
+		return i, false, nil
 	}
+	return i + 1, true, nil
+}
 
+func parseGeoSearchOpts(args [][]byte, isStore bool) (*geoSearchOpts, error) {
+	opts := &geoSearchOpts{}
+	for i := 0; i < len(args); {
+		next, ok, err := parseGeoSearchResultOpt(opts, args, i)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("ERR syntax error")
+		}
+		i = next
+	}
+	if err := opts.check(isStore); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func (opts *geoSearchOpts) check(isStore bool) error {
+	if opts.any && opts.count == 0 {
+		return errors.New("ERR the ANY argument requires COUNT argument")
+	}
+	if isStore && opts.optLen() > 0 {
+		return errors.New("ERR WITH* options not allowed while storing the result")
+	}
 	/* COUNT without ordering does not make much sense, force ASC
 	 * ordering if COUNT was specified but no sorting was requested. */
-	if count != 0 && sortT == SORT_NONE {
-		sortT = SORT_ASC
+	if opts.count != 0 && !opts.any && opts.sortT == SORT_NONE {
+		opts.sortT = SORT_ASC
 	}
+	return nil
+}
 
-	radiusArea, err := geohash.GetAreasByRadiusWGS84(x, y, radiusMeters)
+// parse the geosearch args after the key
+func parseGeoSearchArgs(args [][]byte, isStore bool) (*geoShape, *geoSearchOpts, error) {
+	shape := &geoShape{stype: GEO_SHAPE_NONE}
+	opts := &geoSearchOpts{}
+	var fromMember, fromLonLat bool
+	var err error
+	for i := 0; i < len(args); {
+		option := strings.ToLower(string(args[i]))
+		switch {
+		case option == "frommember" && i+1 < len(args):
+			fromMember = true
+			shape.member = args[i+1]
+			i += 2
+		case option == "fromlonlat" && i+2 < len(args):
+			fromLonLat = true
+			if shape.lon, err = strconv.ParseFloat(string(args[i+1]), 64); err != nil {
+				return nil, nil, errors.New("ERR value is not a valid float")
+			}
+			if shape.lat, err = strconv.ParseFloat(string(args[i+2]), 64); err != nil {
+				return nil, nil, errors.New("ERR value is not a valid float")
+			}
+			i += 3
+		case option == "byradius" && i+2 < len(args):
+			if shape.stype != GEO_SHAPE_NONE {
+				return nil, nil, errGeoSearchBy
+			}
+			shape.stype = GEO_SHAPE_CIRCLE
+			shape.radius, shape.conversion, err = extractDistance(args[i+1], args[i+2])
+			if err != nil {
+				return nil, nil, err
+			}
+			i += 3
+		case option == "bybox" && i+3 < len(args):
+			if shape.stype != GEO_SHAPE_NONE {
+				return nil, nil, errGeoSearchBy
+			}
+			shape.stype = GEO_SHAPE_BOX
+			shape.width, shape.conversion, err = extractDistance(args[i+1], args[i+3])
+			if err != nil {
+				return nil, nil, err
+			}
+			shape.height, _, err = extractDistance(args[i+2], args[i+3])
+			if err != nil {
+				return nil, nil, err
+			}
+			i += 4
+		case option == "storedist" && isStore:
+			opts.storeDist = true
+			i++
+		default:
+			next, ok, err := parseGeoSearchResultOpt(opts, args, i)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !ok {
+				return nil, nil, errors.New("ERR syntax error")
+			}
+			i = next
+		}
+	}
+	if fromMember == fromLonLat {
+		return nil, nil, errGeoSearchFrom
+	}
+	if shape.stype == GEO_SHAPE_NONE {
+		return nil, nil, errGeoSearchBy
+	}
+	if err := opts.check(isStore); err != nil {
+		return nil, nil, err
+	}
+	return shape, opts, nil
+}
+
+// search the members in the shape, the result will be sorted and limited by the options
+func geoSearchMembers(store *KVStore, key []byte, shape *geoShape, opts *geoSearchOpts) ([]*geoPoints, error) {
+	if card, err := store.ZCard(key); err != nil || card == 0 {
+		return nil, err
+	}
+	if shape.member != nil {
+		hash, err := store.ZScore(key, shape.member)
+		if err != nil {
+			return nil, errors.New("ERR could not decode requested zset member")
+		}
+		shape.lon, shape.lat = geohash.DecodeToLongLatWGS84(uint64(hash))
+	}
+
+	area, err := shape.searchAreas()
 	if err != nil {
-		conn.WriteError(err.Error())
-		return
+		return nil, err
 	}
 
-	plist, err := nd.geoMembersOfAllNeighbors(cmd.Args[1], radiusArea, x, y, radiusMeters)
+	limit := 0
+	if opts.any {
+		limit = opts.count
+	}
+	plist, err := geoMembersOfAllNeighbors(store, key, area, shape, limit)
 	if err != nil {
-		conn.WriteError(err.Error())
-		return
+		return nil, err
 	}
 
+	count := opts.count
 	if count == 0 || len(plist) < count {
 		count = len(plist)
 	}
 
 	/* Sort the returned geoPoints. */
-	switch sortT {
+	switch opts.sortT {
 	case SORT_ASC:
 		slice := geoPointsSlice(plist)
 		sort.Sort(slice)
@@ -314,27 +599,31 @@ func (nd *KVNode) geoRadiusGeneric(conn redcon.Conn, cmd redcon.Command, stype s
 		sort.Sort(sort.Reverse(slice))
 	default:
 	}
+	return plist[:count], nil
+}
 
+func writeGeoPoints(conn redcon.Conn, plist []*geoPoints, conversion float64, opts *geoSearchOpts) {
+	optLen := opts.optLen()
 	/* Return results to user. */
-	conn.WriteArray(count)
+	conn.WriteArray(len(plist))
 
-	for _, point := range plist[:count] {
+	for _, point := range plist {
 		if optLen > 0 {
 			conn.WriteArray(optLen + 1)
 		}
 
 		conn.WriteBulk(point.member)
 
-		if withdist {
+		if opts.withdist {
 			dist := point.dist / conversion
 			conn.WriteBulk([]byte(strconv.FormatFloat(dist, 'g', -1, 64)))
 		}
 
-		if withhash {
+		if opts.withhash {
 			conn.WriteInt64(int64(point.score))
 		}
 
-		if withcoords {
+		if opts.withcoords {
 			conn.WriteArray(2)
 			conn.WriteBulk([]byte(strconv.FormatFloat(point.longitude, 'g', -1, 64)))
 			conn.WriteBulk([]byte(strconv.FormatFloat(point.latitude, 'g', -1, 64)))
@@ -343,7 +632,7 @@ func (nd *KVNode) geoRadiusGeneric(conn redcon.Conn, cmd redcon.Command, stype s
 }
 
 func extractUnit(unit []byte) (float64, error) {
-	switch string(unit) {
+	switch strings.ToLower(string(unit)) {
 	case "m":
 		return 1, nil
 	case "km":
@@ -373,7 +662,60 @@ func extractDistance(radius []byte, unit []byte) (float64, float64, error) {
 	return distance * toMeters, toMeters, nil
 }
 
-func (nd *KVNode) geoMembersOfAllNeighbors(set []byte, geoRadius *geohash.Radius, lon, lat, radius float64) ([]*geoPoints, error) {
+type geoShape struct {
+	stype geoShapeType
+	// the search center, for polygon it is the center of the bounding box
+	lon    float64
+	lat    float64
+	member []byte
+	// in meters
+	radius float64
+	width  float64
+	height float64
+	// the vertices of polygon
+	polygon []geohash.Point
+	// the unit to meters
+	conversion float64
+}
+
+// get the geohash areas which cover the shape
+func (shape *geoShape) searchAreas() (*geohash.Radius, error) {
+	switch shape.stype {
+	case GEO_SHAPE_CIRCLE:
+		return geohash.GetAreasByRadiusWGS84(shape.lon, shape.lat, shape.radius)
+	case GEO_SHAPE_BOX:
+		return geohash.GetAreasByBoxWGS84(shape.lon, shape.lat, shape.width, shape.height)
+	case GEO_SHAPE_POLYGON:
+		area, center, err := geohash.GetAreasByPolygonWGS84(shape.polygon)
+		if err != nil {
+			return nil, err
+		}
+		shape.lon, shape.lat = center.Longitude, center.Latitude
+		return area, nil
+	default:
+		return nil, errGeoSearchBy
+	}
+}
+
+// return the distance to the center if the point is inside the shape
+func (shape *geoShape) contains(lon, lat float64) (float64, bool) {
+	switch shape.stype {
+	case GEO_SHAPE_BOX:
+		return geohash.GetDistanceIfInRectangle(shape.width, shape.height, shape.lon, shape.lat, lon, lat)
+	case GEO_SHAPE_POLYGON:
+		if !geohash.PointInPolygon(shape.polygon, lon, lat) {
+			return 0, false
+		}
+		return geohash.GetDistance(lon, lat, shape.lon, shape.lat), true
+	default:
+		dist := geohash.GetDistance(lon, lat, shape.lon, shape.lat)
+		return dist, shape.radius >= dist
+	}
+}
+
+// get all the members in the neighbors which match the shape, if limit is
+// not 0, it will return as soon as limit members are found.
+func geoMembersOfAllNeighbors(store *KVStore, set []byte, geoRadius *geohash.Radius, shape *geoShape, limit int) ([]*geoPoints, error) {
 	neighbors := [9]*geohash.HashBits{
 		&geoRadius.Hash,
 		&geoRadius.North,
@@ -402,12 +744,15 @@ func (nd *KVNode) geoMembersOfAllNeighbors(set []byte, geoRadius *geohash.Radius
 			area.Step == neighbors[lastProcessed].Step {
 			continue
 		}
-		ps, err := nd.membersOfGeoHashBox(set, lon, lat, radius, area)
+		ps, err := membersOfGeoHashBox(store, set, shape, area)
 		if err != nil {
 			return nil, err
 		} else {
 			plist = append(plist, ps...)
 		}
+		if limit > 0 && len(plist) >= limit {
+			break
+		}
 		lastProcessed = i
 	}
 	return plist, nil
@@ -422,18 +767,17 @@ type geoPoints struct {
 }
 
 // Obtain all members between the min/max of this geohash bounding box.
-func (nd *KVNode) membersOfGeoHashBox(zset []byte, longitude, latitude, radius float64, hash *geohash.HashBits) ([]*geoPoints, error) {
+func membersOfGeoHashBox(store *KVStore, zset []byte, shape *geoShape, hash *geohash.HashBits) ([]*geoPoints, error) {
 	points := make([]*geoPoints, 0, 32)
 	min, max := scoresOfGeoHashBox(hash)
-	vlist, err := nd.store.ZRangeByScoreGeneric(zset, float64(min), float64(max), 0, -1, false)
+	vlist, err := store.ZRangeByScoreGeneric(zset, float64(min), float64(max), 0, -1, false)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, v := range vlist {
 		x, y := geohash.DecodeToLongLatWGS84(uint64(v.Score))
-		dist := geohash.GetDistance(x, y, longitude, latitude)
-		if radius >= dist {
+		if dist, ok := shape.contains(x, y); ok {
 			p := &geoPoints{
 				longitude: x,
 				latitude:  y,
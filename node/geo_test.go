@@ -508,3 +508,128 @@ func convIBytes2Float64AndCompare(i interface{}, v, deviation float64) (bool, er
 		return true, nil
 	}
 }
+
+func TestKVNode_GeoSearchCommand(t *testing.T) {
+	ifGeoHashUnitTest = true
+
+	nd, dataDir, stopC := getTestKVNode(t)
+	testKey := []byte("default:test:geosearch_places")
+
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+
+	places := []*geoTStruct{
+		{name: "Tian An Men Square", lat: 39.905637761392, lon: 116.39763057232},
+		{name: "The Palace Museum", lat: 39.916345328893, lon: 116.39715582132},
+		{name: "Great Hall of the people", lat: 39.9050003, lon: 116.3939423},
+		{name: "The Summer Palace", lat: 39.999886103047, lon: 116.27552270889},
+		{name: "The Great Wall", lat: 40.359759768836, lon: 116.02002181113},
+	}
+	cmdArgs := [][]byte{[]byte("geoadd"), testKey}
+	for _, p := range places {
+		cmdArgs = append(cmdArgs, []byte(strconv.FormatFloat(p.lon, 'g', -1, 64)),
+			[]byte(strconv.FormatFloat(p.lat, 'g', -1, 64)), []byte(p.name))
+	}
+	whandler, _ := nd.router.GetWCmdHandler("geoadd")
+	_, err := whandler(buildCommand(cmdArgs))
+	assert.Nil(t, err)
+
+	tests := []struct {
+		cmd    string
+		args   []string
+		hasErr bool
+		rsp    []interface{}
+	}{
+		{"geosearch", []string{"fromlonlat", "116.39763057232", "39.905637761392", "byradius", "2", "km", "asc"}, false,
+			[]interface{}{3, []byte(places[0].name), []byte(places[2].name), []byte(places[1].name)}},
+		{"geosearch", []string{"frommember", places[0].name, "byradius", "2", "km", "desc"}, false,
+			[]interface{}{3, []byte(places[1].name), []byte(places[2].name), []byte(places[0].name)}},
+		{"geosearch", []string{"frommember", places[0].name, "bybox", "1", "3", "km", "asc"}, false,
+			[]interface{}{3, []byte(places[0].name), []byte(places[2].name), []byte(places[1].name)}},
+		{"geosearch", []string{"frommember", places[0].name, "bybox", "1", "1", "km", "asc"}, false,
+			[]interface{}{2, []byte(places[0].name), []byte(places[2].name)}},
+		{"geosearch", []string{"fromlonlat", "116.39763057232", "39.905637761392", "bybox", "200", "200", "km", "count", "2"}, false,
+			[]interface{}{2, []byte(places[0].name), []byte(places[2].name)}},
+		{"geosearch", []string{"fromlonlat", "116.39763057232", "39.905637761392", "byradius", "200", "km", "count", "1", "any"}, false, nil},
+		{"geosearch", []string{"frommember", "nonexist", "byradius", "2", "km"}, true, nil},
+		{"geosearch", []string{"frommember", places[0].name, "fromlonlat", "1", "1", "byradius", "2", "km"}, true, nil},
+		{"geosearch", []string{"frommember", places[0].name, "byradius", "2", "km", "bybox", "1", "1", "km"}, true, nil},
+		{"geosearch", []string{"frommember", places[0].name, "withdist", "asc"}, true, nil},
+		{"geosearch", []string{"frommember", places[0].name, "byradius", "2", "km", "any"}, true, nil},
+		{"geowithin", []string{"116.395", "39.90", "116.40", "39.90", "116.40", "39.92", "116.395", "39.92", "asc"}, false,
+			[]interface{}{2, []byte(places[0].name), []byte(places[1].name)}},
+		{"geowithin", []string{"116.0", "39.0", "117.0", "39.0", "116.5", "41.0", "count", "5", "any"}, false, nil},
+		{"geowithin", []string{"116.395", "39.90", "116.40", "39.90", "asc"}, true, nil},
+		{"geowithin", []string{"116.395", "39.90", "116.40", "39.90", "116.40", "unknown"}, true, nil},
+	}
+	for _, tt := range tests {
+		args := [][]byte{[]byte(tt.cmd), testKey}
+		for _, arg := range tt.args {
+			args = append(args, []byte(arg))
+		}
+		c := &fakeRedisConn{}
+		handler, _ := nd.router.GetCmdHandler(tt.cmd)
+		handler(c, buildCommand(args))
+		if tt.hasErr {
+			assert.NotNil(t, c.GetError(), tt.args)
+			continue
+		}
+		assert.Nil(t, c.GetError(), tt.args)
+		if tt.rsp != nil {
+			assert.Equal(t, tt.rsp, c.rsp, tt.args)
+		} else {
+			assert.True(t, len(c.rsp) > 0)
+		}
+	}
+
+	c := &fakeRedisConn{}
+	handler, _ := nd.router.GetCmdHandler("geosearch")
+	handler(c, buildCommand([][]byte{[]byte("geosearch"), testKey, []byte("fromlonlat"), []byte("116.39763057232"),
+		[]byte("39.905637761392"), []byte("byradius"), []byte("200"), []byte("km"), []byte("count"), []byte("1"), []byte("any")}))
+	assert.Equal(t, 1, c.rsp[0])
+	c.Reset()
+	handler, _ = nd.router.GetCmdHandler("geowithin")
+	handler(c, buildCommand([][]byte{[]byte("geowithin"), testKey, []byte("116.0"), []byte("39.0"),
+		[]byte("117.0"), []byte("39.0"), []byte("116.5"), []byte("41.0"), []byte("withcoord")}))
+	assert.Nil(t, c.GetError())
+	// the great wall is outside the triangle
+	assert.Equal(t, 4, c.rsp[0])
+
+	sm, ok := nd.sm.(*kvStoreSM)
+	assert.True(t, ok)
+	destKey := []byte("test:geosearch_dest")
+	srcKey := []byte("test:geosearch_places")
+	rsp, err := sm.localGeoSearchStoreCommand(buildCommand([][]byte{[]byte("geosearchstore"), destKey, srcKey,
+		[]byte("frommember"), []byte(places[0].name), []byte("byradius"), []byte("2"), []byte("km"),
+		[]byte("storedist")}), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), rsp)
+	n, err := nd.store.ZCard(destKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	dist, err := nd.store.ZScore(destKey, []byte(places[1].name))
+	assert.Nil(t, err)
+	assert.True(t, math.Abs(dist-1.1918406) < 0.001, dist)
+
+	// store without distance will overwrite the destination with the geohash score
+	rsp, err = sm.localGeoSearchStoreCommand(buildCommand([][]byte{[]byte("geosearchstore"), destKey, srcKey,
+		[]byte("frommember"), []byte(places[0].name), []byte("byradius"), []byte("500"), []byte("m")}), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), rsp)
+	n, err = nd.store.ZCard(destKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	hash, err := nd.store.ZScore(destKey, []byte(places[0].name))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(4069885364411786), hash)
+
+	_, err = sm.localGeoSearchStoreCommand(buildCommand([][]byte{[]byte("geosearchstore"), destKey, srcKey,
+		[]byte("frommember"), []byte(places[0].name), []byte("byradius"), []byte("500"), []byte("m"),
+		[]byte("withdist")}), 0)
+	assert.NotNil(t, err)
+	_, err = nd.geosearchstoreCommand(buildCommand([][]byte{[]byte("geosearchstore"), []byte("default:test:geosearch_dest"),
+		[]byte("other:test:geosearch_places"), []byte("frommember"), []byte(places[0].name), []byte("byradius"),
+		[]byte("500"), []byte("m")}))
+	assert.Equal(t, errGeoStoreCrossNamespace, err)
+}
@@ -40,6 +40,11 @@ func TestKVNode_hashCommand(t *testing.T) {
 		{"hkeyexist", buildCommand([][]byte{[]byte("hkeyexist"), testKey})},
 		{"hexpire", buildCommand([][]byte{[]byte("hexpire"), testKey, []byte("10")})},
 		{"hpersist", buildCommand([][]byte{[]byte("hpersist"), testKey})},
+		{"hexpire", buildCommand([][]byte{[]byte("hexpire"), testKey, []byte("10"), []byte("FIELDS"), []byte("1"), testField2})},
+		{"hpexpire", buildCommand([][]byte{[]byte("hpexpire"), testKey, []byte("10000"), []byte("FIELDS"), []byte("1"), testField2})},
+		{"httl", buildCommand([][]byte{[]byte("httl"), testKey, []byte("FIELDS"), []byte("1"), testField2})},
+		{"hpttl", buildCommand([][]byte{[]byte("hpttl"), testKey, []byte("FIELDS"), []byte("1"), testField2})},
+		{"hpersist", buildCommand([][]byte{[]byte("hpersist"), testKey, []byte("FIELDS"), []byte("1"), testField2})},
 		{"hclear", buildCommand([][]byte{[]byte("hclear"), testKey})},
 	}
 	defer os.RemoveAll(dataDir)
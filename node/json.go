@@ -1,6 +1,9 @@
 package node
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/absolute8511/redcon"
 	"github.com/youzan/ZanRedisDB/common"
 )
@@ -59,7 +62,35 @@ func (nd *KVNode) jsonmkGetCommand(conn redcon.Conn, cmd redcon.Command) {
 		}
 		keys[i] = key
 	}
-	nd.store.JMGet(path, keys...)
+	vals, err := nd.store.JMGet(path, keys...)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(len(vals))
+	for _, val := range vals {
+		conn.WriteBulk(val)
+	}
+}
+
+// json.mget key1 key2 ... path, the keys may be across partitions, the response is [][]byte
+// in the same order of keys
+func (nd *KVNode) jsonMGetCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 3 {
+		return nil, fmt.Errorf("ERR wrong number of arguments for '%s' command", string(cmd.Args[0]))
+	}
+	if len(cmd.Args[1:]) > common.MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	keys := make([][]byte, 0, len(cmd.Args)-2)
+	for _, k := range cmd.Args[1 : len(cmd.Args)-1] {
+		key, err := common.CutNamesapce(k)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return nd.store.JMGet(cmd.Args[len(cmd.Args)-1], keys...)
 }
 
 func (nd *KVNode) jsonTypeCommand(conn redcon.Conn, cmd redcon.Command) {
@@ -129,6 +160,51 @@ func (nd *KVNode) jsonObjKeysCommand(conn redcon.Conn, cmd redcon.Command) {
 	}
 }
 
+func (nd *KVNode) jsonStrLenCommand(conn redcon.Conn, cmd redcon.Command) {
+	var val int64
+	var err error
+	if len(cmd.Args) == 2 {
+		val, err = nd.store.JStrLen(cmd.Args[1], []byte(""))
+	} else {
+		val, err = nd.store.JStrLen(cmd.Args[1], cmd.Args[2])
+	}
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteInt64(val)
+}
+
+// json.arrindex key path value [start [stop]]
+func (nd *KVNode) jsonArrayIndexCommand(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) > 6 {
+		conn.WriteError("ERR wrong number of arguments for '" + string(cmd.Args[0]) + "' command")
+		return
+	}
+	var start, stop int64
+	var err error
+	if len(cmd.Args) > 4 {
+		start, err = strconv.ParseInt(string(cmd.Args[4]), 10, 64)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+	}
+	if len(cmd.Args) > 5 {
+		stop, err = strconv.ParseInt(string(cmd.Args[5]), 10, 64)
+		if err != nil {
+			conn.WriteError(err.Error())
+			return
+		}
+	}
+	val, err := nd.store.JArrayIndex(cmd.Args[1], cmd.Args[2], cmd.Args[3], start, stop)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteInt64(val)
+}
+
 func (kvsm *kvStoreSM) localJSONSetCommand(cmd redcon.Command, ts int64) (interface{}, error) {
 	v, err := kvsm.store.JSet(ts, cmd.Args[1], cmd.Args[2], cmd.Args[3])
 	return v, err
@@ -166,3 +242,62 @@ func (kvsm *kvStoreSM) localJSONArrayPopCommand(cmd redcon.Command, ts int64) (i
 	}
 	return []byte(elem), nil
 }
+
+func (kvsm *kvStoreSM) localJSONNumIncrByCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.JNumIncrBy(ts, cmd.Args[1], cmd.Args[2], cmd.Args[3])
+}
+
+func (kvsm *kvStoreSM) localJSONNumMultByCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.JNumMultBy(ts, cmd.Args[1], cmd.Args[2], cmd.Args[3])
+}
+
+func (kvsm *kvStoreSM) localJSONStrAppendCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	path := []byte("")
+	value := cmd.Args[2]
+	if len(cmd.Args) > 3 {
+		path = cmd.Args[2]
+		value = cmd.Args[3]
+	}
+	return kvsm.store.JStrAppend(ts, cmd.Args[1], path, value)
+}
+
+func (kvsm *kvStoreSM) localJSONArrayInsertCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	index, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.JArrayInsert(ts, cmd.Args[1], cmd.Args[2], index, cmd.Args[4:]...)
+}
+
+func (kvsm *kvStoreSM) localJSONArrayTrimCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	start, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	stop, err := strconv.ParseInt(string(cmd.Args[4]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.JArrayTrim(ts, cmd.Args[1], cmd.Args[2], start, stop)
+}
+
+func (kvsm *kvStoreSM) localJSONToggleCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	v, err := kvsm.store.JToggle(ts, cmd.Args[1], cmd.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.FormatBool(v)), nil
+}
+
+func (kvsm *kvStoreSM) localJSONClearCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	path := []byte("")
+	if len(cmd.Args) > 2 {
+		path = cmd.Args[2]
+	}
+	return kvsm.store.JClear(ts, cmd.Args[1], path)
+}
+
+func (kvsm *kvStoreSM) localJSONMergeCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	err := kvsm.store.JMerge(ts, cmd.Args[1], cmd.Args[2], cmd.Args[3])
+	return nil, err
+}
@@ -31,6 +31,21 @@ func TestKVNode_jsonCommand(t *testing.T) {
 		{"json.del", buildCommand([][]byte{[]byte("json.del"), testKey, testJSONField})},
 		{"json.arrappend", buildCommand([][]byte{[]byte("json.arrappend"), testKey, testJSONField, testJSONFieldValue})},
 		{"json.arrpop", buildCommand([][]byte{[]byte("json.arrpop"), testKey, testJSONField})},
+		{"json.set", buildCommand([][]byte{[]byte("json.set"), testKey, []byte("arr"), []byte("[1,2,3]")})},
+		{"json.arrinsert", buildCommand([][]byte{[]byte("json.arrinsert"), testKey, []byte("arr"), []byte("0"), []byte("4")})},
+		{"json.arrindex", buildCommand([][]byte{[]byte("json.arrindex"), testKey, []byte("arr"), []byte("4")})},
+		{"json.arrtrim", buildCommand([][]byte{[]byte("json.arrtrim"), testKey, []byte("arr"), []byte("0"), []byte("1")})},
+		{"json.set", buildCommand([][]byte{[]byte("json.set"), testKey, []byte("s"), []byte(`"str"`)})},
+		{"json.strappend", buildCommand([][]byte{[]byte("json.strappend"), testKey, []byte("s"), []byte(`"x"`)})},
+		{"json.strlen", buildCommand([][]byte{[]byte("json.strlen"), testKey, []byte("s")})},
+		{"json.set", buildCommand([][]byte{[]byte("json.set"), testKey, []byte("n"), []byte("1")})},
+		{"json.numincrby", buildCommand([][]byte{[]byte("json.numincrby"), testKey, []byte("n"), []byte("2")})},
+		{"json.nummultby", buildCommand([][]byte{[]byte("json.nummultby"), testKey, []byte("$.n"), []byte("3")})},
+		{"json.set", buildCommand([][]byte{[]byte("json.set"), testKey, []byte("b"), []byte("true")})},
+		{"json.toggle", buildCommand([][]byte{[]byte("json.toggle"), testKey, []byte("b")})},
+		{"json.merge", buildCommand([][]byte{[]byte("json.merge"), testKey, []byte("$"), []byte(`{"m":1}`)})},
+		{"json.clear", buildCommand([][]byte{[]byte("json.clear"), testKey, []byte("arr")})},
+		{"json.get", buildCommand([][]byte{[]byte("json.get"), testKey, []byte("$..n")})},
 		{"json.del", buildCommand([][]byte{[]byte("json.del"), testKey})},
 	}
 	defer os.RemoveAll(dataDir)
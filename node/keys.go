@@ -76,35 +76,61 @@ func (nd *KVNode) Lookup(key []byte) ([]byte, error) {
 	return v, err
 }
 
-func (nd *KVNode) getNoLockCommand(conn redcon.Conn, cmd redcon.Command) {
-	err := nd.store.GetValueWithOpNoLock(cmd.Args[1], func(val []byte) error {
-		if val == nil {
-			conn.WriteNull()
-		} else {
-			conn.WriteBulk(val)
-			// since val will be freed, we need flush before return
-			conn.Flush()
-		}
+// write the value as bulk, the chunks of the large value will be written
+// without assembling the whole value.
+type bulkChunkWriter struct {
+	conn    redcon.Conn
+	written int64
+	started bool
+}
+
+func (w *bulkChunkWriter) write(size int64, data []byte) error {
+	if size < 0 {
+		w.conn.WriteNull()
 		return nil
-	})
+	}
+	if !w.started && int64(len(data)) == size {
+		w.conn.WriteBulk(data)
+		// since val will be freed, we need flush before return
+		w.conn.Flush()
+		return nil
+	}
+	if !w.started {
+		w.started = true
+		w.conn.WriteRaw([]byte("$" + strconv.FormatInt(size, 10) + "\r\n"))
+	}
+	w.conn.WriteRaw(data)
+	w.written += int64(len(data))
+	if w.written >= size {
+		w.conn.WriteRaw([]byte("\r\n"))
+	}
+	return w.conn.Flush()
+}
+
+func (w *bulkChunkWriter) writeError(err error) {
+	if !w.started {
+		w.conn.WriteError(err.Error())
+		return
+	}
+	// the partial bulk has been written, the error reply can not be parsed
+	// by the client, so we can only close the connection.
+	nodeLog.Infof("failed while writing the large value: %v", err)
+	w.conn.Close()
+}
+
+func (nd *KVNode) getNoLockCommand(conn redcon.Conn, cmd redcon.Command) {
+	w := &bulkChunkWriter{conn: conn}
+	err := nd.store.GetValueWithChunkOpNoLock(cmd.Args[1], w.write)
 	if err != nil {
-		conn.WriteError(err.Error())
+		w.writeError(err)
 	}
 }
 
 func (nd *KVNode) getCommand(conn redcon.Conn, cmd redcon.Command) {
-	err := nd.store.GetValueWithOp(cmd.Args[1], func(val []byte) error {
-		if val == nil {
-			conn.WriteNull()
-		} else {
-			conn.WriteBulk(val)
-			// since val will be freed, we need flush before return
-			conn.Flush()
-		}
-		return nil
-	})
+	w := &bulkChunkWriter{conn: conn}
+	err := nd.store.GetValueWithChunkOp(cmd.Args[1], w.write)
 	if err != nil {
-		conn.WriteError(err.Error())
+		w.writeError(err)
 	}
 }
 
@@ -1,6 +1,7 @@
 package node
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -418,6 +419,50 @@ func TestKVNode_batchWithNonBatchCommand(t *testing.T) {
 	}
 }
 
+func TestKVNode_largeValueStaged(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+
+	testKey := []byte("default:test:large_staged")
+	testKey2 := []byte("default:test:large_staged2")
+	// the value larger than the stage chunk size and the max value size
+	for _, size := range []int{proposeStageChunkSize * 2, rockredis.MaxValueSize + proposeStageChunkSize} {
+		value := bytes.Repeat([]byte("a"), size)
+		setHandler, _ := nd.router.GetWCmdHandler("set")
+		rsp, err := setHandler(buildCommand([][]byte{[]byte("set"), testKey, value}))
+		assert.Nil(t, err)
+		rsp, err = rsp.(*FutureRsp).WaitRsp()
+		assert.Nil(t, err)
+		assert.Equal(t, "OK", rsp)
+
+		// the multi keys write should also be staged
+		value2 := bytes.Repeat([]byte("b"), size)
+		plsetHandler, _, _ := nd.router.GetMergeCmdHandler("plset")
+		_, err = plsetHandler(buildCommand([][]byte{[]byte("plset"), testKey2, value2, testKey, value2}))
+		assert.Nil(t, err)
+
+		fc := &fakeRedisConn{}
+		getHandler, _ := nd.router.GetCmdHandler("get")
+		for _, k := range [][]byte{testKey, testKey2} {
+			fc.Reset()
+			getHandler(fc, buildCommand([][]byte{[]byte("get"), k}))
+			assert.Nil(t, fc.GetError())
+			var got []byte
+			for _, r := range fc.rsp {
+				got = append(got, r.([]byte)...)
+			}
+			if len(fc.rsp) == 1 {
+				assert.Equal(t, value2, got)
+			} else {
+				// the chunked value is written as raw bulk reply
+				assert.Equal(t, "$"+strconv.Itoa(size)+"\r\n"+string(value2)+"\r\n", string(got))
+			}
+		}
+	}
+}
+
 func TestKVNode_bitV2Command(t *testing.T) {
 	nd, dataDir, stopC := getTestKVNode(t)
 	testBitKey := []byte("default:test:bitv2_1")
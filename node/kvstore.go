@@ -6,6 +6,7 @@ import (
 
 	"github.com/youzan/ZanRedisDB/common"
 	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
 	"github.com/youzan/ZanRedisDB/rockredis"
 )
 
@@ -23,6 +24,7 @@ type KVOptions struct {
 	DataVersion      common.DataVersionT
 	RockOpts         engine.RockOptions
 	SharedConfig     engine.SharedRockConfig
+	KeyManager       *encryption.KeyManager
 }
 
 func NewKVStore(kvopts *KVOptions) (*KVStore, error) {
@@ -46,6 +48,7 @@ func (s *KVStore) openDB() error {
 		cfg.ExpirationPolicy = s.opts.ExpirationPolicy
 		cfg.DataVersion = s.opts.DataVersion
 		cfg.SharedConfig = s.opts.SharedConfig
+		cfg.KeyManager = s.opts.KeyManager
 		cfg.KeepBackup = s.opts.KeepBackup
 		s.RockDB, err = rockredis.OpenRockDB(cfg)
 		if err != nil {
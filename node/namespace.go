@@ -230,8 +230,16 @@ func (nn *NamespaceNode) TransferMyLeader(to uint64, toRaftID uint64) error {
 }
 
 type NamespaceMeta struct {
-	PartitionNum int
-	walEng       engine.KVEngine
+	PartitionNum      int
+	PartitionKeyVer   string
+	PartitionKeyRegex string
+	partKeyExtractor  common.PartitionKeyExtractor
+	walEng            engine.KVEngine
+}
+
+func (nm *NamespaceMeta) isSamePartitionKey(conf *NamespaceConfig) bool {
+	return nm.PartitionNum == conf.PartitionNum && nm.PartitionKeyVer == conf.PartitionKeyVersion &&
+		nm.PartitionKeyRegex == conf.PartitionKeyRegex
 }
 
 type NamespaceMgr struct {
@@ -510,6 +518,7 @@ func (nsm *NamespaceMgr) getWALEng(ns string, dataDir string, id uint64, gid uin
 	walEngCfg.DataDir = rsDir
 	walEngCfg.RockOptions = nsm.machineConf.WALRocksDBOpts
 	walEngCfg.SharedConfig = nsm.machineConf.WALRocksDBSharedConfig
+	walEngCfg.KeyManager = nsm.machineConf.KeyManager
 	engine.FillDefaultOptions(&walEngCfg.RockOptions)
 	eng := initRaftStorageEng(walEngCfg)
 	if nsm.machineConf.SharedRocksWAL {
@@ -540,6 +549,11 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 	if dv != common.DefaultDataVer {
 		nodeLog.Infof("namespace %v data version: %v, expire policy: %v", conf.Name, conf.DataVersion, expPolicy)
 	}
+	partKeyExtractor, err := common.NewPartitionKeyExtractor(conf.PartitionKeyVersion, conf.PartitionKeyRegex)
+	if err != nil {
+		nodeLog.Infof("namespace %v invalid partition key: %v, %v", conf.Name, conf.PartitionKeyVersion, conf.PartitionKeyRegex)
+		return nil, err
+	}
 
 	kvOpts := &KVOptions{
 		DataDir:          path.Join(nsm.machineConf.DataRootDir, conf.Name),
@@ -549,6 +563,7 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 		ExpirationPolicy: expPolicy,
 		DataVersion:      dv,
 		SharedConfig:     nsm.machineConf.RocksDBSharedConfig,
+		KeyManager:       nsm.machineConf.KeyManager,
 	}
 	engine.FillDefaultOptions(&kvOpts.RockOpts)
 
@@ -597,12 +612,15 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 	var meta *NamespaceMeta
 	if oldMeta, ok := nsm.nsMetas[conf.BaseName]; !ok {
 		meta = &NamespaceMeta{
-			PartitionNum: conf.PartitionNum,
+			PartitionNum:      conf.PartitionNum,
+			PartitionKeyVer:   conf.PartitionKeyVersion,
+			PartitionKeyRegex: conf.PartitionKeyRegex,
+			partKeyExtractor:  partKeyExtractor,
 		}
 		nsm.nsMetas[conf.BaseName] = meta
 		nodeLog.Infof("namespace meta init: %v", conf)
 	} else {
-		if oldMeta.PartitionNum != conf.PartitionNum {
+		if !oldMeta.isSamePartitionKey(conf) {
 			nodeLog.Errorf("namespace meta mismatch: %v, old: %v", conf, oldMeta)
 			// update the meta if mismatch, it may happen if create the same namespace with different
 			// config for old deleted namespace
@@ -610,7 +628,10 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 				oldMeta.walEng.CloseAll()
 			}
 			meta = &NamespaceMeta{
-				PartitionNum: conf.PartitionNum,
+				PartitionNum:      conf.PartitionNum,
+				PartitionKeyVer:   conf.PartitionKeyVersion,
+				PartitionKeyRegex: conf.PartitionKeyRegex,
+				partKeyExtractor:  partKeyExtractor,
 			}
 			nsm.nsMetas[conf.BaseName] = meta
 		} else {
@@ -638,8 +659,10 @@ func (nsm *NamespaceMgr) InitNamespaceNode(conf *NamespaceConfig, raftID uint64,
 	return n, nil
 }
 
-func GetHashedPartitionID(pk []byte, pnum int) int {
-	return int(murmur3.Sum32(pk)) % pnum
+// GetHashedPartitionID return the partition id for the primary key, the partition key
+// will be extracted from the primary key by the extractor if not nil.
+func GetHashedPartitionID(pk []byte, pnum int, extractor common.PartitionKeyExtractor) int {
+	return common.GetPartitionKeyHashSum(pk, extractor) % pnum
 }
 
 func (nsm *NamespaceMgr) GetNamespaceNodeWithPrimaryKeySum(nsBaseName string, pk []byte, pkSum int) (*NamespaceNode, error) {
@@ -663,8 +686,20 @@ func (nsm *NamespaceMgr) GetNamespaceNodeWithPrimaryKeySum(nsBaseName string, pk
 	return n, nil
 }
 
+// GetPrimaryKeySum return the hash sum of the partition key extracted from the primary key
+// by the partition key version of the namespace.
+func (nsm *NamespaceMgr) GetPrimaryKeySum(nsBaseName string, pk []byte) int {
+	nsm.mutex.RLock()
+	v, ok := nsm.nsMetas[nsBaseName]
+	nsm.mutex.RUnlock()
+	if !ok {
+		return int(murmur3.Sum32(pk))
+	}
+	return common.GetPartitionKeyHashSum(pk, v.partKeyExtractor)
+}
+
 func (nsm *NamespaceMgr) GetNamespaceNodeWithPrimaryKey(nsBaseName string, pk []byte) (*NamespaceNode, error) {
-	pkSum := int(murmur3.Sum32(pk))
+	pkSum := nsm.GetPrimaryKeySum(nsBaseName, pk)
 	return nsm.GetNamespaceNodeWithPrimaryKeySum(nsBaseName, pk, pkSum)
 }
 
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/spaolacci/murmur3"
 	"github.com/stretchr/testify/assert"
 	"github.com/youzan/ZanRedisDB/common"
 	"github.com/youzan/ZanRedisDB/raft"
@@ -203,7 +204,7 @@ func (m *testMapGet) getNode(nsBaseName string, pk []byte) *NamespaceNode {
 	if !ok {
 		return nil
 	}
-	pid := GetHashedPartitionID(pk, v.PartitionNum)
+	pid := GetHashedPartitionID(pk, v.PartitionNum, v.partKeyExtractor)
 	fullName := common.GetNsDesp(nsBaseName, pid)
 	n, ok := m.kvNodes[fullName]
 	if !ok {
@@ -218,7 +219,7 @@ func (m *testMapGet) getNode2(nsBaseName string, pk []byte) *NamespaceNode {
 		return nil
 	}
 	vv := v.(*NamespaceMeta)
-	pid := GetHashedPartitionID(pk, vv.PartitionNum)
+	pid := GetHashedPartitionID(pk, vv.PartitionNum, vv.partKeyExtractor)
 	fullName := common.GetNsDesp(nsBaseName, pid)
 	n, ok := m.kvNodes2.Load(fullName)
 	if !ok {
@@ -263,3 +264,62 @@ func BenchmarkNamespaceMgr_GetNamespaceNodeWithPrimaryKey(b *testing.B) {
 	}
 	wg.Wait()
 }
+
+func TestGetPrimaryKeySumWithPartitionKey(t *testing.T) {
+	nsMgr, tmpDir := getTestNamespaceMgr(t)
+	defer os.RemoveAll(tmpDir)
+
+	ext, err := common.NewPartitionKeyExtractor(common.HashTagPartitionKeyV1Str, "")
+	assert.Nil(t, err)
+	nsMgr.nsMetas["test_tag"] = &NamespaceMeta{
+		PartitionNum:     16,
+		PartitionKeyVer:  common.HashTagPartitionKeyV1Str,
+		partKeyExtractor: ext,
+	}
+	nsMgr.nsMetas["test_default"] = &NamespaceMeta{
+		PartitionNum: 16,
+	}
+	pk1 := []byte("table:{user1}:following")
+	pk2 := []byte("table2:{user1}:followers")
+	assert.Equal(t, nsMgr.GetPrimaryKeySum("test_tag", pk1), nsMgr.GetPrimaryKeySum("test_tag", pk2))
+	assert.Equal(t, int(murmur3.Sum32([]byte("user1"))), nsMgr.GetPrimaryKeySum("test_tag", pk1))
+	// the namespace without partition key version should keep the old placement
+	assert.Equal(t, int(murmur3.Sum32(pk1)), nsMgr.GetPrimaryKeySum("test_default", pk1))
+	assert.Equal(t, int(murmur3.Sum32(pk1)), nsMgr.GetPrimaryKeySum("not_exist", pk1))
+
+	assert.Equal(t, GetHashedPartitionID(pk1, 16, ext), GetHashedPartitionID(pk2, 16, ext))
+	assert.Equal(t, int(murmur3.Sum32([]byte("user1")))%16, GetHashedPartitionID(pk1, 16, ext))
+	assert.Equal(t, int(murmur3.Sum32(pk1))%16, GetHashedPartitionID(pk1, 16, nil))
+	assert.Equal(t, nsMgr.GetPrimaryKeySum("test_tag", pk1)%16, GetHashedPartitionID(pk1, 16, ext))
+}
+
+func TestGetNamespaceNodeRejectNotOwnedPartitionKey(t *testing.T) {
+	nsMgr, tmpDir := getTestNamespaceMgr(t)
+	defer os.RemoveAll(tmpDir)
+
+	ext, err := common.NewPartitionKeyExtractor(common.HashTagPartitionKeyV1Str, "")
+	assert.Nil(t, err)
+	nsMgr.nsMetas["test_tag"] = &NamespaceMeta{
+		PartitionNum:     16,
+		PartitionKeyVer:  common.HashTagPartitionKeyV1Str,
+		partKeyExtractor: ext,
+	}
+	pk := []byte("table:{user1}:following")
+	pid := GetHashedPartitionID(pk, 16, ext)
+	// only the partition of the tag is on this node
+	owned := &NamespaceNode{ready: 1}
+	nsMgr.kvNodes[common.GetNsDesp("test_tag", pid)] = owned
+
+	n, err := nsMgr.GetNamespaceNodeWithPrimaryKey("test_tag", []byte("table2:{user1}:followers"))
+	assert.Nil(t, err)
+	assert.Equal(t, owned, n)
+	// the keys with the other tags belong to the partitions not on this node and should be rejected
+	for i := 0; i < 100; i++ {
+		other := []byte(fmt.Sprintf("table:{user%v}:following", i))
+		if GetHashedPartitionID(other, 16, ext) == pid {
+			continue
+		}
+		_, err = nsMgr.GetNamespaceNodeWithPrimaryKey("test_tag", other)
+		assert.Equal(t, ErrNamespacePartitionNotFound, err)
+	}
+}
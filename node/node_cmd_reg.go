@@ -3,6 +3,9 @@ package node
 func (kvsm *kvStoreSM) registerHandlers() {
 
 	kvsm.router.RegisterInternal("noopwrite", kvsm.localNoOpWriteCommand)
+	// the staged chunks for the large write
+	kvsm.router.RegisterInternal(stageChunkCmd, kvsm.localStageChunkCommand)
+	kvsm.router.RegisterInternal(stageCommitCmd, kvsm.localStageCommitCommand)
 	// only write command need to be registered as internal
 	// kv
 	kvsm.router.RegisterInternal("del", kvsm.localDelCommand)
@@ -37,6 +40,49 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("json.del", kvsm.localJSONDelCommand)
 	kvsm.router.RegisterInternal("json.arrappend", kvsm.localJSONArrayAppendCommand)
 	kvsm.router.RegisterInternal("json.arrpop", kvsm.localJSONArrayPopCommand)
+	kvsm.router.RegisterInternal("json.numincrby", kvsm.localJSONNumIncrByCommand)
+	kvsm.router.RegisterInternal("json.nummultby", kvsm.localJSONNumMultByCommand)
+	kvsm.router.RegisterInternal("json.strappend", kvsm.localJSONStrAppendCommand)
+	kvsm.router.RegisterInternal("json.arrinsert", kvsm.localJSONArrayInsertCommand)
+	kvsm.router.RegisterInternal("json.arrtrim", kvsm.localJSONArrayTrimCommand)
+	kvsm.router.RegisterInternal("json.toggle", kvsm.localJSONToggleCommand)
+	kvsm.router.RegisterInternal("json.clear", kvsm.localJSONClearCommand)
+	kvsm.router.RegisterInternal("json.merge", kvsm.localJSONMergeCommand)
+	// bloom and cuckoo filter
+	kvsm.router.RegisterInternal("bf.reserve", kvsm.localBFReserveCommand)
+	kvsm.router.RegisterInternal("bf.add", kvsm.localBFAddCommand)
+	kvsm.router.RegisterInternal("bf.madd", kvsm.localBFMAddCommand)
+	kvsm.router.RegisterInternal("bf.clear", kvsm.localBFClearCommand)
+	kvsm.router.RegisterInternal("bf.expire", kvsm.localBFExpireCommand)
+	kvsm.router.RegisterInternal("bf.persist", kvsm.localBFPersistCommand)
+	kvsm.router.RegisterInternal("cf.reserve", kvsm.localCFReserveCommand)
+	kvsm.router.RegisterInternal("cf.add", kvsm.localCFAddCommand)
+	kvsm.router.RegisterInternal("cf.del", kvsm.localCFDelCommand)
+	kvsm.router.RegisterInternal("cf.clear", kvsm.localCFClearCommand)
+	kvsm.router.RegisterInternal("cf.expire", kvsm.localCFExpireCommand)
+	kvsm.router.RegisterInternal("cf.persist", kvsm.localCFPersistCommand)
+	// count-min sketch and top-k
+	kvsm.router.RegisterInternal("cms.initbydim", kvsm.localCMSInitByDimCommand)
+	kvsm.router.RegisterInternal("cms.initbyprob", kvsm.localCMSInitByProbCommand)
+	kvsm.router.RegisterInternal("cms.incrby", kvsm.localCMSIncrByCommand)
+	kvsm.router.RegisterInternal("cms.merge", kvsm.localCMSMergeCommand)
+	kvsm.router.RegisterInternal("cms.clear", kvsm.localCMSClearCommand)
+	kvsm.router.RegisterInternal("cms.expire", kvsm.localCMSExpireCommand)
+	kvsm.router.RegisterInternal("cms.persist", kvsm.localCMSPersistCommand)
+	kvsm.router.RegisterInternal("topk.reserve", kvsm.localTopKReserveCommand)
+	kvsm.router.RegisterInternal("topk.add", kvsm.localTopKAddCommand)
+	kvsm.router.RegisterInternal("topk.clear", kvsm.localTopKClearCommand)
+	kvsm.router.RegisterInternal("topk.expire", kvsm.localTopKExpireCommand)
+	kvsm.router.RegisterInternal("topk.persist", kvsm.localTopKPersistCommand)
+	// time series
+	kvsm.router.RegisterInternal("ts.create", kvsm.localTSCreateCommand)
+	kvsm.router.RegisterInternal("ts.add", kvsm.localTSAddCommand)
+	kvsm.router.RegisterInternal("ts.madd", kvsm.localTSMAddCommand)
+	kvsm.router.RegisterInternal("ts.createrule", kvsm.localTSCreateRuleCommand)
+	kvsm.router.RegisterInternal("ts.deleterule", kvsm.localTSDeleteRuleCommand)
+	kvsm.router.RegisterInternal("ts.clear", kvsm.localTSClearCommand)
+	kvsm.router.RegisterInternal("ts.expire", kvsm.localTSExpireCommand)
+	kvsm.router.RegisterInternal("ts.persist", kvsm.localTSPersistCommand)
 	// list
 	kvsm.router.RegisterInternal("lfixkey", kvsm.localLfixkeyCommand)
 	kvsm.router.RegisterInternal("lpop", kvsm.localLpopCommand)
@@ -57,6 +103,7 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("zremrangebylex", kvsm.localZremrangebylexCommand)
 	kvsm.router.RegisterInternal("zclear", kvsm.localZclearCommand)
 	kvsm.router.RegisterInternal("zmclear", kvsm.localZMClearCommand)
+	kvsm.router.RegisterInternal("geosearchstore", kvsm.localGeoSearchStoreCommand)
 	// set
 	kvsm.router.RegisterInternal("sadd", kvsm.localSadd)
 	kvsm.router.RegisterInternal("srem", kvsm.localSrem)
@@ -68,6 +115,7 @@ func (kvsm *kvStoreSM) registerHandlers() {
 	kvsm.router.RegisterInternal("expire", kvsm.localExpireCommand)
 	kvsm.router.RegisterInternal("lexpire", kvsm.localListExpireCommand)
 	kvsm.router.RegisterInternal("hexpire", kvsm.localHashExpireCommand)
+	kvsm.router.RegisterInternal("hpexpire", kvsm.localHashPExpireCommand)
 	kvsm.router.RegisterInternal("sexpire", kvsm.localSetExpireCommand)
 	kvsm.router.RegisterInternal("zexpire", kvsm.localZSetExpireCommand)
 	kvsm.router.RegisterInternal("bexpire", kvsm.localBitExpireCommand)
@@ -125,11 +173,11 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterRead("hexists", wrapReadCommandKSubkey(nd.hexistsCommand))
 	nd.router.RegisterRead("hmget", wrapReadCommandKSubkeySubkey(nd.hmgetCommand))
 	nd.router.RegisterRead("hlen", wrapReadCommandK(nd.hlenCommand))
-	nd.router.RegisterWrite("hset", wrapWriteCommandKSubkeyV(nd, checkAndRewriteIntRsp))
-	nd.router.RegisterWrite("hsetnx", wrapWriteCommandKSubkeyV(nd, checkAndRewriteIntRsp))
-	nd.router.RegisterWrite("hmset", wrapWriteCommandKSubkeyVSubkeyV(nd, checkOKRsp))
-	nd.router.RegisterWrite("hdel", wrapWriteCommandKSubkeySubkey(nd, checkAndRewriteIntRsp))
-	nd.router.RegisterWrite("hincrby", wrapWriteCommandKSubkeyV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("hset", wrapHashSchemaCheck(nd, wrapWriteCommandKSubkeyV(nd, checkAndRewriteIntRsp)))
+	nd.router.RegisterWrite("hsetnx", wrapHashSchemaCheck(nd, wrapWriteCommandKSubkeyV(nd, checkAndRewriteIntRsp)))
+	nd.router.RegisterWrite("hmset", wrapHashSchemaCheck(nd, wrapWriteCommandKSubkeyVSubkeyV(nd, checkOKRsp)))
+	nd.router.RegisterWrite("hdel", wrapHashDelSchemaCheck(nd, wrapWriteCommandKSubkeySubkey(nd, checkAndRewriteIntRsp)))
+	nd.router.RegisterWrite("hincrby", wrapHashIncrSchemaCheck(nd, wrapWriteCommandKSubkeyV(nd, checkAndRewriteIntRsp)))
 	nd.router.RegisterWrite("hclear", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
 	// for json
 	nd.router.RegisterRead("json.get", wrapReadCommandKAnySubkey(nd.jsonGetCommand))
@@ -140,10 +188,78 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterRead("json.arrlen", wrapReadCommandKAnySubkey(nd.jsonArrayLenCommand))
 	nd.router.RegisterRead("json.objkeys", wrapReadCommandKAnySubkey(nd.jsonObjKeysCommand))
 	nd.router.RegisterRead("json.objlen", wrapReadCommandKAnySubkey(nd.jsonObjLenCommand))
-	nd.router.RegisterWrite("json.set", wrapWriteCommandKSubkeyV(nd, checkOKRsp))
+	nd.router.RegisterRead("json.strlen", wrapReadCommandKAnySubkey(nd.jsonStrLenCommand))
+	nd.router.RegisterRead("json.arrindex", wrapReadCommandKAnySubkeyN(nd.jsonArrayIndexCommand, 2))
+	nd.router.RegisterWrite("json.set", wrapJSONSchemaCheck(nd, wrapWriteCommandKSubkeyV(nd, checkOKRsp)))
 	nd.router.RegisterWrite("json.del", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntRsp, 0))
 	nd.router.RegisterWrite("json.arrappend", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntRsp, 2))
 	nd.router.RegisterWrite("json.arrpop", wrapWriteCommandKAnySubkey(nd, checkAndRewriteBulkRsp, 0))
+	nd.router.RegisterWrite("json.numincrby", wrapJSONNumIncrSchemaCheck(nd, wrapWriteCommandKSubkeyV(nd, checkAndRewriteBulkRsp)))
+	nd.router.RegisterWrite("json.nummultby", wrapWriteCommandKSubkeyV(nd, checkAndRewriteBulkRsp))
+	nd.router.RegisterWrite("json.strappend", wrapJSONStrAppendSchemaCheck(nd, wrapWriteCommandKAnySubkeyAndMax(nd, checkAndRewriteIntRsp, 1, 2)))
+	nd.router.RegisterWrite("json.arrinsert", wrapJSONArrayInsertSchemaCheck(nd, wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntRsp, 3)))
+	nd.router.RegisterWrite("json.arrtrim", wrapWriteCommandKAnySubkeyAndMax(nd, checkAndRewriteIntRsp, 3, 3))
+	nd.router.RegisterWrite("json.toggle", wrapJSONToggleSchemaCheck(nd, wrapWriteCommandKSubkey(nd, checkAndRewriteBulkRsp)))
+	nd.router.RegisterWrite("json.clear", wrapWriteCommandKAnySubkeyAndMax(nd, checkAndRewriteIntRsp, 0, 1))
+	nd.router.RegisterWrite("json.merge", wrapJSONMergeSchemaCheck(nd, wrapWriteCommandKSubkeyV(nd, checkOKRsp)))
+	// for bloom and cuckoo filter
+	nd.router.RegisterRead("bf.exists", wrapReadCommandKSubkey(nd.bfExistsCommand))
+	nd.router.RegisterRead("bf.mexists", wrapReadCommandKAnySubkeyN(nd.bfMExistsCommand, 1))
+	nd.router.RegisterRead("bf.info", wrapReadCommandK(nd.bfInfoCommand))
+	nd.router.RegisterRead("bf.keyexist", wrapReadCommandK(nd.bfKeyExistCommand))
+	nd.router.RegisterRead("bf.ttl", wrapReadCommandK(nd.bfttlCommand))
+	nd.router.RegisterWrite("bf.reserve", wrapWriteCommandKAnySubkeyAndMax(nd, checkOKRsp, 2, 5))
+	nd.router.RegisterWrite("bf.add", wrapWriteCommandKSubkey(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("bf.madd", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntArrayRsp, 1))
+	nd.router.RegisterWrite("bf.clear", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("bf.expire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("bf.persist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterRead("cf.exists", wrapReadCommandKSubkey(nd.cfExistsCommand))
+	nd.router.RegisterRead("cf.count", wrapReadCommandKSubkey(nd.cfCountCommand))
+	nd.router.RegisterRead("cf.keyexist", wrapReadCommandK(nd.cfKeyExistCommand))
+	nd.router.RegisterRead("cf.ttl", wrapReadCommandK(nd.cfttlCommand))
+	nd.router.RegisterWrite("cf.reserve", wrapWriteCommandKAnySubkeyAndMax(nd, checkOKRsp, 1, 3))
+	nd.router.RegisterWrite("cf.add", wrapWriteCommandKSubkey(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("cf.del", wrapWriteCommandKSubkey(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("cf.clear", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("cf.expire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("cf.persist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	// for count-min sketch and top-k
+	nd.router.RegisterRead("cms.query", wrapReadCommandKAnySubkeyN(nd.cmsQueryCommand, 1))
+	nd.router.RegisterRead("cms.info", wrapReadCommandK(nd.cmsInfoCommand))
+	nd.router.RegisterRead("cms.keyexist", wrapReadCommandK(nd.cmsKeyExistCommand))
+	nd.router.RegisterRead("cms.ttl", wrapReadCommandK(nd.cmsttlCommand))
+	nd.router.RegisterWrite("cms.initbydim", wrapWriteCommandKAnySubkeyAndMax(nd, checkOKRsp, 2, 2))
+	nd.router.RegisterWrite("cms.initbyprob", wrapWriteCommandKAnySubkeyAndMax(nd, checkOKRsp, 2, 2))
+	nd.router.RegisterWrite("cms.incrby", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntArrayRsp, 2))
+	nd.router.RegisterWrite("cms.merge", nd.cmsMergeCommand)
+	nd.router.RegisterWrite("cms.clear", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("cms.expire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("cms.persist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterRead("topk.query", wrapReadCommandKAnySubkeyN(nd.topkQueryCommand, 1))
+	nd.router.RegisterRead("topk.list", wrapReadCommandKAnySubkey(nd.topkListCommand))
+	nd.router.RegisterRead("topk.keyexist", wrapReadCommandK(nd.topkKeyExistCommand))
+	nd.router.RegisterRead("topk.ttl", wrapReadCommandK(nd.topkttlCommand))
+	nd.router.RegisterWrite("topk.reserve", wrapWriteCommandKAnySubkeyAndMax(nd, checkOKRsp, 1, 4))
+	nd.router.RegisterWrite("topk.add", wrapWriteCommandKAnySubkey(nd, checkAndRewriteBulkArrayRsp, 1))
+	nd.router.RegisterWrite("topk.clear", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("topk.expire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("topk.persist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	// for time series
+	nd.router.RegisterRead("ts.get", wrapReadCommandK(nd.tsGetCommand))
+	nd.router.RegisterRead("ts.info", wrapReadCommandK(nd.tsInfoCommand))
+	nd.router.RegisterRead("ts.range", wrapReadCommandKAnySubkeyN(nd.tsRangeCommand, 2))
+	nd.router.RegisterRead("ts.revrange", wrapReadCommandKAnySubkeyN(nd.tsRevRangeCommand, 2))
+	nd.router.RegisterRead("ts.keyexist", wrapReadCommandK(nd.tsKeyExistCommand))
+	nd.router.RegisterRead("ts.ttl", wrapReadCommandK(nd.tsttlCommand))
+	nd.router.RegisterWrite("ts.create", wrapWriteCommandKAnySubkey(nd, checkOKRsp, 0))
+	nd.router.RegisterWrite("ts.add", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntRsp, 2))
+	nd.router.RegisterWrite("ts.madd", nd.tsMAddCommand)
+	nd.router.RegisterWrite("ts.createrule", nd.tsRuleCommand)
+	nd.router.RegisterWrite("ts.deleterule", nd.tsRuleCommand)
+	nd.router.RegisterWrite("ts.clear", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("ts.expire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("ts.persist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
 	// for list
 	nd.router.RegisterRead("lindex", wrapReadCommandKSubkey(nd.lindexCommand))
 	nd.router.RegisterRead("llen", wrapReadCommandK(nd.llenCommand))
@@ -188,7 +304,8 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterWrite("sclear", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
 	// for ttl
 	nd.router.RegisterRead("ttl", wrapReadCommandK(nd.ttlCommand))
-	nd.router.RegisterRead("httl", wrapReadCommandK(nd.httlCommand))
+	nd.router.RegisterRead("httl", wrapReadCommandKAnySubkey(nd.httlCommand))
+	nd.router.RegisterRead("hpttl", wrapReadCommandKAnySubkeyN(nd.hpttlCommand, 3))
 	nd.router.RegisterRead("lttl", wrapReadCommandK(nd.lttlCommand))
 	nd.router.RegisterRead("sttl", wrapReadCommandK(nd.sttlCommand))
 	nd.router.RegisterRead("zttl", wrapReadCommandK(nd.zttlCommand))
@@ -199,17 +316,22 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterRead("skeyexist", wrapReadCommandK(nd.sKeyExistCommand))
 	nd.router.RegisterRead("zkeyexist", wrapReadCommandK(nd.zKeyExistCommand))
 	nd.router.RegisterRead("bkeyexist", wrapReadCommandK(nd.bKeyExistCommand))
+	// for object inspect, the sub command is folded into the command name by the server
+	nd.router.RegisterRead("memory.usage", wrapReadCommandKAnySubkey(nd.memoryUsageCommand))
+	nd.router.RegisterRead("object.encoding", wrapReadCommandKAnySubkey(nd.objectEncodingCommand))
+	nd.router.RegisterRead("object.idletime", wrapReadCommandKAnySubkey(nd.objectIdleTimeCommand))
 
 	nd.router.RegisterWrite("setex", wrapWriteCommandKVV(nd, checkOKRsp))
 	nd.router.RegisterWrite("expire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
-	nd.router.RegisterWrite("hexpire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("hexpire", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntArrayRsp, 1))
+	nd.router.RegisterWrite("hpexpire", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntArrayRsp, 4))
 	nd.router.RegisterWrite("lexpire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("sexpire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("zexpire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("bexpire", wrapWriteCommandKV(nd, checkAndRewriteIntRsp))
 
 	nd.router.RegisterWrite("persist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
-	nd.router.RegisterWrite("hpersist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
+	nd.router.RegisterWrite("hpersist", wrapWriteCommandKAnySubkey(nd, checkAndRewriteIntArrayRsp, 0))
 	nd.router.RegisterWrite("lpersist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("spersist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
 	nd.router.RegisterWrite("zpersist", wrapWriteCommandK(nd, checkAndRewriteIntRsp))
@@ -230,6 +352,9 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterRead("geopos", wrapReadCommandKAnySubkeyN(nd.geoposCommand, 1))
 	nd.router.RegisterRead("georadius", wrapReadCommandKAnySubkeyN(nd.geoRadiusCommand, 4))
 	nd.router.RegisterRead("georadiusbymember", wrapReadCommandKAnySubkeyN(nd.geoRadiusByMemberCommand, 3))
+	nd.router.RegisterRead("geosearch", wrapReadCommandKAnySubkeyN(nd.geosearchCommand, 5))
+	nd.router.RegisterRead("geowithin", wrapReadCommandKAnySubkeyN(nd.geowithinCommand, 6))
+	nd.router.RegisterWrite("geosearchstore", nd.geosearchstoreCommand)
 
 	//for cross mutil partion
 	nd.router.RegisterMerge("scan", wrapMergeCommand(nd.scanCommand))
@@ -238,8 +363,16 @@ func (nd *KVNode) registerHandler() {
 	nd.router.RegisterMerge("advrevscan", nd.advanceScanCommand)
 	nd.router.RegisterMerge("fullscan", nd.fullScanCommand)
 	nd.router.RegisterMerge("hidx.from", nd.hindexSearchCommand)
+	nd.router.RegisterMerge("jidx.from", nd.jindexSearchCommand)
+	nd.router.RegisterMerge("ft.search", nd.ftSearchCommand)
+	nd.router.RegisterMerge("ft.stats", nd.ftStatsCommand)
+	nd.router.RegisterMerge("col.agg", nd.columnAggCommand)
+	nd.router.RegisterMerge("sql", nd.sqlQueryCommand)
 
 	nd.router.RegisterMerge("exists", wrapMergeCommandKK(nd.existsCommand))
+	nd.router.RegisterMerge("json.mget", nd.jsonMGetCommand)
+	nd.router.RegisterMerge("ts.mrange", nd.tsMRangeCommand)
+	nd.router.RegisterMerge("ts.mrevrange", nd.tsMRangeCommand)
 	// make sure the merged write command will be stopped if cluster is not allowed to write
 	nd.router.RegisterWriteMerge("del", wrapWriteMergeCommandKK(nd, checkAndRewriteIntRsp))
 	//nd.router.RegisterWriteMerge("mset", nd.msetCommand)
@@ -255,6 +388,8 @@ func (nd *KVNode) registerHandler() {
 
 func (kvsm *kvStoreSM) registerConflictHandlers() {
 	// only write command
+	kvsm.cRouter.Register(stageChunkCmd, kvsm.checkStageChunkConflict)
+	kvsm.cRouter.Register(stageCommitCmd, kvsm.checkStageCommitConflict)
 	kvsm.cRouter.Register("del", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("delifeq", kvsm.checkKVConflict)
 	kvsm.cRouter.Register("set", kvsm.checkKVConflict)
@@ -306,6 +441,7 @@ func (kvsm *kvStoreSM) registerConflictHandlers() {
 	kvsm.cRouter.Register("zclear", kvsm.checkZSetConflict)
 	kvsm.cRouter.Register("zexpire", kvsm.checkZSetConflict)
 	kvsm.cRouter.Register("zpersist", kvsm.checkZSetConflict)
+	kvsm.cRouter.Register("geosearchstore", kvsm.checkZSetConflict)
 	// set
 	kvsm.cRouter.Register("sadd", kvsm.checkSetConflict)
 	kvsm.cRouter.Register("srem", kvsm.checkSetConflict)
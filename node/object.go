@@ -0,0 +1,110 @@
+package node
+
+import (
+	"strings"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+// parse the options for memory and object command:
+// key [TYPE kv|hash|list|set|zset|bitmap|json] [WITHCOUNT]
+func parseObjectArgs(args [][]byte, allowCount bool) (byte, bool, error) {
+	dt := rockredis.NoneType
+	withCount := false
+	for i := 0; i < len(args); i++ {
+		op := strings.ToLower(string(args[i]))
+		switch op {
+		case "type":
+			if i+1 >= len(args) {
+				return dt, withCount, common.ErrInvalidArgs
+			}
+			var err error
+			dt, err = rockredis.ObjectTypeFromName(strings.ToLower(string(args[i+1])))
+			if err != nil {
+				return dt, withCount, err
+			}
+			i++
+		case "withcount":
+			if !allowCount {
+				return dt, withCount, common.ErrInvalidArgs
+			}
+			withCount = true
+		default:
+			return dt, withCount, common.ErrInvalidArgs
+		}
+	}
+	return dt, withCount, nil
+}
+
+func (nd *KVNode) getKeyObject(dt byte, key []byte) (*rockredis.KeyObjectInfo, error) {
+	if dt == rockredis.NoneType {
+		return nd.store.DetectKeyObject(key)
+	}
+	return nd.store.KeyObject(dt, key)
+}
+
+// memory usage key [TYPE type] [WITHCOUNT]
+func (nd *KVNode) memoryUsageCommand(conn redcon.Conn, cmd redcon.Command) {
+	dt, withCount, err := parseObjectArgs(cmd.Args[2:], true)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	info, err := nd.getKeyObject(dt, cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if info == nil {
+		conn.WriteNull()
+		return
+	}
+	if !withCount {
+		conn.WriteInt64(info.Size)
+		return
+	}
+	conn.WriteArray(2)
+	conn.WriteInt64(info.Size)
+	conn.WriteInt64(info.Count)
+}
+
+// object encoding key [TYPE type]
+func (nd *KVNode) objectEncodingCommand(conn redcon.Conn, cmd redcon.Command) {
+	dt, _, err := parseObjectArgs(cmd.Args[2:], false)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	info, err := nd.getKeyObject(dt, cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if info == nil {
+		conn.WriteNull()
+		return
+	}
+	conn.WriteBulkString(info.Encoding)
+}
+
+// object idletime key [TYPE type]
+func (nd *KVNode) objectIdleTimeCommand(conn redcon.Conn, cmd redcon.Command) {
+	dt, _, err := parseObjectArgs(cmd.Args[2:], false)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	info, err := nd.getKeyObject(dt, cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if info == nil {
+		conn.WriteNull()
+		return
+	}
+	conn.WriteInt64(info.IdleTime(time.Now().UnixNano()))
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"runtime"
 	"sort"
 	"strconv"
@@ -31,6 +32,7 @@ import (
 	ps "github.com/prometheus/client_golang/prometheus"
 	"github.com/youzan/ZanRedisDB/common"
 	"github.com/youzan/ZanRedisDB/metric"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
 	"github.com/youzan/ZanRedisDB/pkg/fileutil"
 	"github.com/youzan/ZanRedisDB/pkg/idutil"
 	"github.com/youzan/ZanRedisDB/pkg/types"
@@ -201,6 +203,12 @@ func (rc *raftNode) openWAL(snapshot *raftpb.Snapshot, readOld bool) (*wal.WAL,
 		w, err := wal.Create(rc.config.WALDir, d, rc.config.OptimizedFsync)
 		if err != nil {
 			nodeLog.Errorf("create wal error (%v)", err)
+			return w, d, hardState, nil, err
+		}
+		err = rc.initWALCipher(w)
+		if err != nil {
+			w.Close()
+			return nil, d, hardState, nil, err
 		}
 		return w, d, hardState, nil, err
 	}
@@ -218,6 +226,11 @@ func (rc *raftNode) openWAL(snapshot *raftpb.Snapshot, readOld bool) (*wal.WAL,
 			nodeLog.Errorf("error loading wal (%v)", err)
 			return w, nil, hardState, nil, err
 		}
+		err = rc.initWALCipher(w)
+		if err != nil {
+			w.Close()
+			return nil, nil, hardState, nil, err
+		}
 		if readOld {
 			meta, st, ents, err := w.ReadAll()
 			if err != nil {
@@ -243,6 +256,29 @@ func (rc *raftNode) openWAL(snapshot *raftpb.Snapshot, readOld bool) (*wal.WAL,
 	return w, nil, hardState, nil, err
 }
 
+// the raft entries in wal will be encrypted by the data keys saved in the wal dir
+func (rc *raftNode) initWALCipher(w *wal.WAL) error {
+	if rc.config.nodeConfig == nil || rc.config.nodeConfig.KeyManager == nil {
+		return nil
+	}
+	km := rc.config.nodeConfig.KeyManager
+	ks, err := km.OpenKeyStore(path.Join(rc.config.WALDir, encryption.KeyStoreFileName))
+	if err != nil {
+		nodeLog.Errorf("open wal encryption keys error (%v)", err)
+		return err
+	}
+	rotated, err := ks.RotateIfExpired(km.RotateInterval())
+	if err != nil {
+		nodeLog.Errorf("rotate wal encryption key error (%v)", err)
+		return err
+	}
+	if rotated {
+		rc.Infof("wal encryption key rotated")
+	}
+	w.SetCipher(ks)
+	return nil
+}
+
 func (rc *raftNode) replayWALForSyncLearner(snapshot *raftpb.Snapshot) error {
 	// TODO: for sync learner, we do not need replay any logs before the remote synced term-index
 	// and also, to avoid snapshot from leader while new sync learner started, we can get the remote
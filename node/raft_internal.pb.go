@@ -50,21 +50,57 @@ func (ReqSourceType) EnumDescriptor() ([]byte, []int) {
 type SchemaChangeType int32
 
 const (
-	SchemaChangeAddHsetIndex    SchemaChangeType = 0
-	SchemaChangeUpdateHsetIndex SchemaChangeType = 1
-	SchemaChangeDeleteHsetIndex SchemaChangeType = 2
+	SchemaChangeAddHsetIndex        SchemaChangeType = 0
+	SchemaChangeUpdateHsetIndex     SchemaChangeType = 1
+	SchemaChangeDeleteHsetIndex     SchemaChangeType = 2
+	SchemaChangeAddFullTextIndex    SchemaChangeType = 3
+	SchemaChangeUpdateFullTextIndex SchemaChangeType = 4
+	SchemaChangeDeleteFullTextIndex SchemaChangeType = 5
+	SchemaChangeAddColumnTable      SchemaChangeType = 6
+	SchemaChangeUpdateColumnTable   SchemaChangeType = 7
+	SchemaChangeDeleteColumnTable   SchemaChangeType = 8
+	SchemaChangeAddJSONIndex        SchemaChangeType = 9
+	SchemaChangeUpdateJSONIndex     SchemaChangeType = 10
+	SchemaChangeDeleteJSONIndex     SchemaChangeType = 11
+	SchemaChangeAddTableSchema      SchemaChangeType = 12
+	SchemaChangeUpdateTableSchema   SchemaChangeType = 13
+	SchemaChangeDeleteTableSchema   SchemaChangeType = 14
 )
 
 var SchemaChangeType_name = map[int32]string{
-	0: "SchemaChangeAddHsetIndex",
-	1: "SchemaChangeUpdateHsetIndex",
-	2: "SchemaChangeDeleteHsetIndex",
+	0:  "SchemaChangeAddHsetIndex",
+	1:  "SchemaChangeUpdateHsetIndex",
+	2:  "SchemaChangeDeleteHsetIndex",
+	3:  "SchemaChangeAddFullTextIndex",
+	4:  "SchemaChangeUpdateFullTextIndex",
+	5:  "SchemaChangeDeleteFullTextIndex",
+	6:  "SchemaChangeAddColumnTable",
+	7:  "SchemaChangeUpdateColumnTable",
+	8:  "SchemaChangeDeleteColumnTable",
+	9:  "SchemaChangeAddJSONIndex",
+	10: "SchemaChangeUpdateJSONIndex",
+	11: "SchemaChangeDeleteJSONIndex",
+	12: "SchemaChangeAddTableSchema",
+	13: "SchemaChangeUpdateTableSchema",
+	14: "SchemaChangeDeleteTableSchema",
 }
 
 var SchemaChangeType_value = map[string]int32{
-	"SchemaChangeAddHsetIndex":    0,
-	"SchemaChangeUpdateHsetIndex": 1,
-	"SchemaChangeDeleteHsetIndex": 2,
+	"SchemaChangeAddHsetIndex":        0,
+	"SchemaChangeUpdateHsetIndex":     1,
+	"SchemaChangeDeleteHsetIndex":     2,
+	"SchemaChangeAddFullTextIndex":    3,
+	"SchemaChangeUpdateFullTextIndex": 4,
+	"SchemaChangeDeleteFullTextIndex": 5,
+	"SchemaChangeAddColumnTable":      6,
+	"SchemaChangeUpdateColumnTable":   7,
+	"SchemaChangeDeleteColumnTable":   8,
+	"SchemaChangeAddJSONIndex":        9,
+	"SchemaChangeUpdateJSONIndex":     10,
+	"SchemaChangeDeleteJSONIndex":     11,
+	"SchemaChangeAddTableSchema":      12,
+	"SchemaChangeUpdateTableSchema":   13,
+	"SchemaChangeDeleteTableSchema":   14,
 }
 
 func (x SchemaChangeType) String() string {
@@ -248,40 +284,45 @@ func init() {
 func init() { proto.RegisterFile("raft_internal.proto", fileDescriptor_b4c9a9be0cfca103) }
 
 var fileDescriptor_b4c9a9be0cfca103 = []byte{
-	// 514 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x53, 0xcd, 0x6e, 0xda, 0x40,
-	0x18, 0xf4, 0x1a, 0xf3, 0xf7, 0x41, 0x11, 0x5d, 0x92, 0xd6, 0x6d, 0x52, 0xc7, 0xe5, 0x52, 0x8b,
-	0x03, 0x55, 0xe1, 0x09, 0x42, 0x50, 0x15, 0x5f, 0xaa, 0x6a, 0xa1, 0x97, 0xaa, 0x12, 0xda, 0xe0,
-	0x2f, 0x80, 0x84, 0x7f, 0x58, 0x16, 0xa9, 0xbc, 0x45, 0x5f, 0xa2, 0xef, 0xc2, 0x91, 0x63, 0x4f,
-	0x55, 0x03, 0x2f, 0x52, 0xed, 0xda, 0x12, 0x6e, 0x14, 0xf5, 0xb6, 0x3b, 0x33, 0xf2, 0xcc, 0x37,
-	0x9f, 0x17, 0x5a, 0x82, 0xdf, 0xcb, 0xc9, 0x22, 0x92, 0x28, 0x22, 0xbe, 0xec, 0x26, 0x22, 0x96,
-	0x31, 0xb5, 0xa2, 0x38, 0xc0, 0xd7, 0x67, 0xb3, 0x78, 0x16, 0x6b, 0xe0, 0xbd, 0x3a, 0xa5, 0x5c,
-	0xfb, 0x2b, 0x3c, 0x63, 0xb8, 0xda, 0xe0, 0x5a, 0xde, 0x22, 0x0f, 0x50, 0xd0, 0x06, 0x98, 0xfe,
-	0xd0, 0x26, 0x2e, 0xf1, 0x2c, 0x66, 0xfa, 0x43, 0x7a, 0x01, 0xd5, 0x80, 0x4b, 0x3e, 0x91, 0xdb,
-	0x04, 0x6d, 0xd3, 0x25, 0x5e, 0x91, 0x55, 0x14, 0x30, 0xde, 0x26, 0x48, 0x2f, 0xa1, 0x2a, 0x17,
-	0x21, 0xae, 0x25, 0x0f, 0x13, 0xbb, 0xe0, 0x12, 0xaf, 0xc0, 0x4e, 0x40, 0xfb, 0x1b, 0xb4, 0xfc,
-	0x2c, 0x09, 0xe3, 0xf7, 0x32, 0xf3, 0xa1, 0x1f, 0xa0, 0x34, 0xd7, 0x5e, 0xda, 0xa5, 0xd6, 0x6b,
-	0x75, 0x55, 0xbe, 0xee, 0x3f, 0x31, 0x06, 0xd6, 0xee, 0xf7, 0x95, 0xc1, 0x32, 0x21, 0xa5, 0x60,
-	0x29, 0x4f, 0xed, 0x5f, 0x67, 0xfa, 0xdc, 0xfe, 0x69, 0x82, 0x3d, 0xe0, 0x72, 0x3a, 0x7f, 0xca,
-	0xe3, 0x25, 0x94, 0x05, 0xae, 0x26, 0xd1, 0x26, 0xd4, 0x26, 0x45, 0x56, 0x12, 0xb8, 0xfa, 0xb4,
-	0x09, 0x69, 0x1f, 0x2c, 0x81, 0xab, 0xb5, 0x6d, 0xba, 0x05, 0xaf, 0xd6, 0x7b, 0x95, 0x5a, 0x3f,
-	0xf1, 0x85, 0x2c, 0x80, 0x16, 0xff, 0x7f, 0x4c, 0xfa, 0x0e, 0x2c, 0x5d, 0x8e, 0xe5, 0x12, 0xaf,
-	0x91, 0x9b, 0x66, 0x14, 0x6f, 0xc4, 0x14, 0x55, 0x4f, 0x4c, 0x0b, 0xe8, 0x39, 0xa8, 0x14, 0x93,
-	0x45, 0x60, 0x17, 0x75, 0xbd, 0x45, 0x81, 0x2b, 0x3f, 0x50, 0x0d, 0xc7, 0x62, 0x31, 0x9b, 0x48,
-	0x14, 0xa1, 0x5d, 0xd2, 0x4c, 0x45, 0x01, 0x63, 0x14, 0x21, 0x7d, 0x03, 0xa0, 0xc9, 0x45, 0x14,
-	0xe0, 0x77, 0xbb, 0xac, 0x59, 0x2d, 0xf7, 0x15, 0x40, 0xdf, 0x42, 0x5d, 0xd3, 0xd3, 0xe5, 0x66,
-	0x2d, 0x51, 0xd8, 0x15, 0x97, 0x78, 0x55, 0x56, 0x53, 0xd8, 0x4d, 0x0a, 0xb5, 0x13, 0xa8, 0x8f,
-	0xa6, 0x73, 0x0c, 0xf9, 0xcd, 0x9c, 0x47, 0x33, 0xa4, 0x1d, 0xb0, 0x54, 0x26, 0xdd, 0x4b, 0xa3,
-	0xf7, 0x22, 0x8d, 0x9b, 0x57, 0xa4, 0x89, 0xf5, 0x7e, 0xcf, 0xa0, 0x38, 0xe6, 0x77, 0xcb, 0x74,
-	0xf1, 0x55, 0x96, 0x5e, 0xa8, 0x03, 0x90, 0xea, 0x87, 0x6a, 0x27, 0x05, 0xbd, 0x93, 0x1c, 0xd2,
-	0xe9, 0xeb, 0x7f, 0xea, 0x34, 0x3e, 0xad, 0x41, 0xf9, 0xa3, 0x88, 0xc3, 0xeb, 0xcf, 0x7e, 0xd3,
-	0xa0, 0xe7, 0xf0, 0x5c, 0x5d, 0xb2, 0x78, 0xa3, 0x6d, 0x34, 0x45, 0xd1, 0x24, 0x1d, 0x01, 0xcd,
-	0xc7, 0x21, 0xe8, 0x25, 0xd8, 0x79, 0xec, 0x3a, 0x08, 0x6e, 0xd7, 0x28, 0xf5, 0xe4, 0x4d, 0x83,
-	0x5e, 0xc1, 0x45, 0x9e, 0xfd, 0x92, 0x04, 0x5c, 0xe2, 0x49, 0x40, 0x1e, 0x0b, 0x86, 0xb8, 0xc4,
-	0xbc, 0xc0, 0x1c, 0xb8, 0xbb, 0x07, 0xc7, 0xd8, 0x3f, 0x38, 0xc6, 0xee, 0xe0, 0x90, 0xfd, 0xc1,
-	0x21, 0x7f, 0x0e, 0x0e, 0xf9, 0x71, 0x74, 0x8c, 0xfd, 0xd1, 0x31, 0x7e, 0x1d, 0x1d, 0xe3, 0xae,
-	0xa4, 0x5f, 0x49, 0xff, 0x6f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x3a, 0x85, 0x6c, 0x1a, 0x58, 0x03,
-	0x00, 0x00,
+	// 608 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x94, 0xcd, 0x4e, 0xdb, 0x40,
+	0x14, 0x85, 0xed, 0xc4, 0xf9, 0xbb, 0x09, 0x51, 0x3a, 0x40, 0xeb, 0xf2, 0x63, 0x4c, 0xba, 0x68,
+	0xc4, 0x82, 0xaa, 0xf0, 0x04, 0x40, 0x84, 0x70, 0x17, 0xb4, 0x72, 0xd2, 0x4d, 0x55, 0x29, 0x1a,
+	0xe2, 0x4b, 0x12, 0xc9, 0x7f, 0x99, 0x8c, 0x25, 0x78, 0x85, 0xae, 0xfa, 0x12, 0x7d, 0x17, 0x96,
+	0x2c, 0xbb, 0xaa, 0x0a, 0x79, 0x91, 0x6a, 0x66, 0x2c, 0xc5, 0x31, 0x56, 0x37, 0x91, 0xe7, 0xdc,
+	0x4f, 0x73, 0xce, 0x3d, 0x23, 0x05, 0x36, 0x19, 0xbd, 0xe5, 0xa3, 0x59, 0xc8, 0x91, 0x85, 0xd4,
+	0x3f, 0x8e, 0x59, 0xc4, 0x23, 0x62, 0x84, 0x91, 0x87, 0x3b, 0x5b, 0x93, 0x68, 0x12, 0x49, 0xe1,
+	0x83, 0xf8, 0x52, 0xb3, 0xee, 0x37, 0xd8, 0x70, 0x71, 0x9e, 0xe0, 0x82, 0x5f, 0x21, 0xf5, 0x90,
+	0x91, 0x36, 0x94, 0x9c, 0xbe, 0xa9, 0xdb, 0x7a, 0xcf, 0x70, 0x4b, 0x4e, 0x9f, 0xec, 0x42, 0xc3,
+	0xa3, 0x9c, 0x8e, 0xf8, 0x7d, 0x8c, 0x66, 0xc9, 0xd6, 0x7b, 0x15, 0xb7, 0x2e, 0x84, 0xe1, 0x7d,
+	0x8c, 0x64, 0x0f, 0x1a, 0x7c, 0x16, 0xe0, 0x82, 0xd3, 0x20, 0x36, 0xcb, 0xb6, 0xde, 0x2b, 0xbb,
+	0x2b, 0xa1, 0xfb, 0x1d, 0x36, 0x9d, 0x34, 0x89, 0x4b, 0x6f, 0x79, 0xea, 0x43, 0x3e, 0x42, 0x75,
+	0x2a, 0xbd, 0xa4, 0x4b, 0xf3, 0x64, 0xf3, 0x58, 0xe4, 0x3b, 0x5e, 0x8b, 0x71, 0x6e, 0x3c, 0xfc,
+	0x39, 0xd0, 0xdc, 0x14, 0x24, 0x04, 0x0c, 0xe1, 0x29, 0xfd, 0x5b, 0xae, 0xfc, 0xee, 0xfe, 0x2a,
+	0x81, 0x79, 0x4e, 0xf9, 0x78, 0x5a, 0xe4, 0xf1, 0x06, 0x6a, 0x0c, 0xe7, 0xa3, 0x30, 0x09, 0xa4,
+	0x49, 0xc5, 0xad, 0x32, 0x9c, 0x5f, 0x27, 0x01, 0x39, 0x05, 0x83, 0xe1, 0x7c, 0x61, 0x96, 0xec,
+	0x72, 0xaf, 0x79, 0xf2, 0x56, 0x59, 0x17, 0xdc, 0x90, 0x06, 0x90, 0xf0, 0xff, 0xd7, 0x24, 0xef,
+	0xc1, 0x90, 0xe5, 0x18, 0xb6, 0xde, 0x6b, 0x67, 0xb6, 0x19, 0x44, 0x09, 0x1b, 0xa3, 0xe8, 0xc9,
+	0x95, 0x00, 0xd9, 0x06, 0x91, 0x62, 0x34, 0xf3, 0xcc, 0x8a, 0xac, 0xb7, 0xc2, 0x70, 0xee, 0x78,
+	0xa2, 0xe1, 0x88, 0xcd, 0x26, 0x23, 0x8e, 0x2c, 0x30, 0xab, 0x72, 0x52, 0x17, 0xc2, 0x10, 0x59,
+	0x40, 0xf6, 0x01, 0xe4, 0x70, 0x16, 0x7a, 0x78, 0x67, 0xd6, 0xe4, 0x54, 0xe2, 0x8e, 0x10, 0xc8,
+	0x21, 0xb4, 0xe4, 0x78, 0xec, 0x27, 0x0b, 0x8e, 0xcc, 0xac, 0xdb, 0x7a, 0xaf, 0xe1, 0x36, 0x85,
+	0x76, 0xa1, 0xa4, 0x6e, 0x0c, 0xad, 0xc1, 0x78, 0x8a, 0x01, 0xbd, 0x98, 0xd2, 0x70, 0x82, 0xe4,
+	0x08, 0x0c, 0x91, 0x49, 0xf6, 0xd2, 0x3e, 0x79, 0xad, 0xe2, 0x66, 0x09, 0x95, 0x58, 0xfc, 0x92,
+	0x2d, 0xa8, 0x0c, 0xe9, 0x8d, 0xaf, 0x1e, 0xbe, 0xe1, 0xaa, 0x03, 0xb1, 0x00, 0x14, 0xdf, 0x17,
+	0x6f, 0x52, 0x96, 0x6f, 0x92, 0x51, 0x8e, 0x4e, 0x61, 0x63, 0x6d, 0x7d, 0xd2, 0x84, 0xda, 0x25,
+	0x8b, 0x82, 0xb3, 0x2f, 0x4e, 0x47, 0x23, 0xdb, 0xf0, 0x4a, 0x1c, 0xd2, 0x78, 0x83, 0xfb, 0x70,
+	0x8c, 0xac, 0xa3, 0x1f, 0xfd, 0x30, 0xa0, 0x93, 0x4f, 0x41, 0xf6, 0xc0, 0xcc, 0x6a, 0x67, 0x9e,
+	0x77, 0xb5, 0x40, 0x2e, 0x57, 0xef, 0x68, 0xe4, 0x00, 0x76, 0xb3, 0xd3, 0xaf, 0xb1, 0x47, 0x39,
+	0xae, 0x00, 0x3d, 0x0f, 0xf4, 0xd1, 0xc7, 0x2c, 0x50, 0x22, 0x36, 0xec, 0xe5, 0xee, 0xbf, 0x4c,
+	0x7c, 0x7f, 0x88, 0x77, 0x29, 0x51, 0x26, 0xef, 0xe0, 0xe0, 0xa5, 0xc7, 0x3a, 0x64, 0xe4, 0x21,
+	0xe5, 0xb3, 0x0e, 0x55, 0x88, 0x05, 0x3b, 0x39, 0xaf, 0x8b, 0xc8, 0x4f, 0x82, 0x50, 0x76, 0xda,
+	0xa9, 0x92, 0x43, 0xd8, 0x7f, 0xe9, 0x94, 0x45, 0x6a, 0x79, 0x44, 0xf9, 0x64, 0x91, 0x7a, 0x41,
+	0x63, 0x9f, 0x06, 0x9f, 0xaf, 0x55, 0x86, 0x46, 0x71, 0x63, 0x2b, 0x00, 0x8a, 0x1b, 0x5b, 0x01,
+	0xcd, 0x82, 0x2d, 0xa4, 0xb3, 0xd2, 0x3a, 0xad, 0xe2, 0x2d, 0xb2, 0xc8, 0x46, 0xf1, 0x16, 0x59,
+	0xa4, 0x7d, 0x6e, 0x3f, 0x3c, 0x59, 0xda, 0xe3, 0x93, 0xa5, 0x3d, 0x3c, 0x5b, 0xfa, 0xe3, 0xb3,
+	0xa5, 0xff, 0x7d, 0xb6, 0xf4, 0x9f, 0x4b, 0x4b, 0x7b, 0x5c, 0x5a, 0xda, 0xef, 0xa5, 0xa5, 0xdd,
+	0x54, 0xe5, 0xdf, 0xd7, 0xe9, 0xbf, 0x01, 0x00, 0x61, 0x8d, 0x96, 0x61, 0xf1, 0x04, 0x00, 0x00,
 }
 
 func (m *RequestHeader) Marshal() (dAtA []byte, err error) {
@@ -8,24 +8,79 @@ import (
 
 	"github.com/absolute8511/redcon"
 	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/rockredis"
 )
 
+type scanArgs struct {
+	cursor   []byte
+	match    string
+	count    int
+	dataType common.DataType
+	filter   *rockredis.ScanFilter
+}
+
 func parseScanArgs(args [][]byte) (cursor []byte, match string, count int, err error) {
+	sargs, err := parseScanFilterArgs(args, false)
+	return sargs.cursor, sargs.match, sargs.count, err
+}
+
+func parseScanDataType(t []byte) (common.DataType, error) {
+	switch strings.ToUpper(string(t)) {
+	case "KV", "STRING":
+		return common.KV, nil
+	case "HASH":
+		return common.HASH, nil
+	case "LIST":
+		return common.LIST, nil
+	case "SET":
+		return common.SET, nil
+	case "ZSET":
+		return common.ZSET, nil
+	default:
+		return common.NONE, common.ErrInvalidScanType
+	}
+}
+
+// parse the range for filter, +inf and -inf can be used for no limit
+func parseScanFilterRange(minArg []byte, maxArg []byte) (*rockredis.ScanFilterRange, error) {
+	rg := rockredis.NewScanFilterRange()
+	var err error
+	if min := strings.ToLower(string(minArg)); min != "-inf" {
+		rg.Min, err = strconv.ParseInt(min, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if max := strings.ToLower(string(maxArg)); max != "+inf" && max != "inf" {
+		rg.Max, err = strconv.ParseInt(max, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rg.Min > rg.Max {
+		return nil, common.ErrInvalidArgs
+	}
+	return rg, nil
+}
+
+// cursor [MATCH match] [COUNT count] [TYPE type] [SIZE min max] [CARD min max] [TTL min max] [VERSION min max]
+// the filter options are only allowed if allowFilter is true
+func parseScanFilterArgs(args [][]byte, allowFilter bool) (sargs scanArgs, err error) {
 	if len(args) == 0 {
 		return
 	}
-	cursor = args[0]
+	sargs.cursor = args[0]
 	args = args[1:]
-	count = 0
 
 	for i := 0; i < len(args); {
-		switch strings.ToLower(string(args[i])) {
+		op := strings.ToLower(string(args[i]))
+		switch op {
 		case "match":
 			if i+1 >= len(args) {
 				err = common.ErrInvalidArgs
 				return
 			}
-			match = string(args[i+1])
+			sargs.match = string(args[i+1])
 			i++
 		case "count":
 			if i+1 >= len(args) {
@@ -33,12 +88,46 @@ func parseScanArgs(args [][]byte) (cursor []byte, match string, count int, err e
 				return
 			}
 
-			count, err = strconv.Atoi(string(args[i+1]))
+			sargs.count, err = strconv.Atoi(string(args[i+1]))
 			if err != nil {
 				return
 			}
 
 			i++
+		case "type":
+			if !allowFilter || i+1 >= len(args) {
+				err = common.ErrInvalidArgs
+				return
+			}
+			sargs.dataType, err = parseScanDataType(args[i+1])
+			if err != nil {
+				return
+			}
+			i++
+		case "size", "card", "ttl", "version":
+			if !allowFilter || i+2 >= len(args) {
+				err = common.ErrInvalidArgs
+				return
+			}
+			var rg *rockredis.ScanFilterRange
+			rg, err = parseScanFilterRange(args[i+1], args[i+2])
+			if err != nil {
+				return
+			}
+			if sargs.filter == nil {
+				sargs.filter = &rockredis.ScanFilter{}
+			}
+			switch op {
+			case "size":
+				sargs.filter.Size = rg
+			case "card":
+				sargs.filter.Card = rg
+			case "ttl":
+				sargs.filter.TTL = rg
+			case "version":
+				sargs.filter.Version = rg
+			}
+			i += 2
 		default:
 			err = fmt.Errorf("invalid argument %s", args[i])
 			return
@@ -49,8 +138,40 @@ func parseScanArgs(args [][]byte) (cursor []byte, match string, count int, err e
 	return
 }
 
-// SCAN cursor [MATCH match] [COUNT count]
-// scan only kv type, cursor is table:key
+// scan with filter, the returned next cursor is the full key (table:key) and
+// empty if no more keys in the same table
+func (nd *KVNode) scanWithFilter(dataType common.DataType, cursor []byte, count int,
+	match string, filter *rockredis.ScanFilter, reverse bool) ([][]byte, []byte, error) {
+	table, _, err := common.ExtractTable(cursor)
+	if err != nil {
+		return nil, nil, common.ErrInvalidScanCursor
+	}
+	ay, nextCursor, err := nd.store.ScanWithFilter(dataType, cursor, count, match, filter, reverse)
+	if err != nil {
+		return nil, nil, err
+	}
+	for idx, v := range ay {
+		tab, _, err := common.ExtractTable(v)
+		if err != nil || !bytes.Equal(tab, table) {
+			ay = ay[:idx]
+			nextCursor = nil
+			break
+		}
+	}
+	if len(nextCursor) > 0 {
+		tab, _, err := common.ExtractTable(nextCursor)
+		if err != nil || !bytes.Equal(tab, table) {
+			nextCursor = nil
+		}
+	}
+	if nextCursor == nil {
+		nextCursor = []byte("")
+	}
+	return ay, nextCursor, nil
+}
+
+// SCAN cursor [MATCH match] [COUNT count] [TYPE type] [filters...]
+// scan kv type if no type specified, cursor is table:key
 
 // TODO: for scan we act like the prefix scan, if the prefix changed , we should stop scan
 func (nd *KVNode) scanCommand(cmd redcon.Command) (interface{}, error) {
@@ -60,11 +181,23 @@ func (nd *KVNode) scanCommand(cmd redcon.Command) (interface{}, error) {
 		reverse = true
 	}
 	args := cmd.Args[1:]
-	cursor, match, count, err := parseScanArgs(args)
-
+	sargs, err := parseScanFilterArgs(args, true)
 	if err != nil {
 		return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: err}, err
 	}
+	cursor, match, count := sargs.cursor, sargs.match, sargs.count
+	dataType := common.KV
+	if sargs.dataType != common.NONE {
+		dataType = sargs.dataType
+	}
+	_, pid := common.GetNamespaceAndPartition(nd.ns)
+	if dataType != common.KV || !sargs.filter.IsEmpty() {
+		ay, nextCursor, err := nd.scanWithFilter(dataType, cursor, count, match, sargs.filter, reverse)
+		if err != nil {
+			return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: err}, err
+		}
+		return &common.ScanResult{Keys: ay, NextCursor: nextCursor, PartionId: strconv.Itoa(pid), Error: nil}, nil
+	}
 
 	table, _, err := common.ExtractTable(cursor)
 	if err != nil {
@@ -102,11 +235,10 @@ func (nd *KVNode) scanCommand(cmd redcon.Command) (interface{}, error) {
 		}
 	}
 
-	_, pid := common.GetNamespaceAndPartition(nd.ns)
 	return &common.ScanResult{Keys: ay, NextCursor: nextCursor, PartionId: strconv.Itoa(pid), Error: nil}, nil
 }
 
-// ADVSCAN cursor type [MATCH match] [COUNT count]
+// ADVSCAN cursor type [MATCH match] [COUNT count] [filters...]
 // here cursor is the scan key for start, (table:key)
 // and the response will return the next start key for next scan,
 // (note: it is not the "0" as the redis scan to indicate the end of scan)
@@ -116,20 +248,9 @@ func (nd *KVNode) advanceScanCommand(cmd redcon.Command) (interface{}, error) {
 		return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: common.ErrInvalidArgs}, common.ErrInvalidArgs
 	}
 
-	var dataType common.DataType
-	switch strings.ToUpper(string(cmd.Args[2])) {
-	case "KV":
-		dataType = common.KV
-	case "HASH":
-		dataType = common.HASH
-	case "LIST":
-		dataType = common.LIST
-	case "SET":
-		dataType = common.SET
-	case "ZSET":
-		dataType = common.ZSET
-	default:
-		return &common.ScanResult{Keys: nil, NextCursor: nil, Error: common.ErrInvalidScanType}, common.ErrInvalidScanType
+	dataType, err := parseScanDataType(cmd.Args[2])
+	if err != nil {
+		return &common.ScanResult{Keys: nil, NextCursor: nil, Error: err}, err
 	}
 	key, err := common.CutNamesapce(cmd.Args[1])
 	if err != nil {
@@ -143,10 +264,25 @@ func (nd *KVNode) advanceScanCommand(cmd redcon.Command) (interface{}, error) {
 	cmd.Args[1] = key
 	cmd.Args[1], cmd.Args[2] = cmd.Args[2], cmd.Args[1]
 
-	cursor, match, count, err := parseScanArgs(cmd.Args[2:])
+	sargs, err := parseScanFilterArgs(cmd.Args[2:], true)
 	if err != nil {
 		return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: err}, err
 	}
+	if sargs.dataType != common.NONE {
+		return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: common.ErrInvalidArgs}, common.ErrInvalidArgs
+	}
+	cursor, match, count := sargs.cursor, sargs.match, sargs.count
+	_, pid := common.GetNamespaceAndPartition(nd.ns)
+	if !sargs.filter.IsEmpty() {
+		ay, nextCursor, err := nd.scanWithFilter(dataType, cursor, count, match, sargs.filter, reverse)
+		if err != nil {
+			return &common.ScanResult{Keys: nil, NextCursor: nil, PartionId: "", Error: err}, err
+		}
+		if len(nextCursor) > 0 {
+			_, nextCursor, _ = common.ExtractTable(nextCursor)
+		}
+		return &common.ScanResult{Keys: ay, NextCursor: nextCursor, PartionId: strconv.Itoa(pid), Error: nil}, nil
+	}
 
 	table, _, err := common.ExtractTable(cursor)
 	if err != nil {
@@ -191,7 +327,6 @@ func (nd *KVNode) advanceScanCommand(cmd redcon.Command) (interface{}, error) {
 			}
 		}
 	}
-	_, pid := common.GetNamespaceAndPartition(nd.ns)
 	return &common.ScanResult{Keys: ay, NextCursor: nextCursor, PartionId: strconv.Itoa(pid), Error: nil}, nil
 }
 
@@ -339,7 +474,7 @@ func (nd *KVNode) zscanCommand(conn redcon.Conn, cmd redcon.Command) {
 	return
 }
 
-// fullScan cursor type [MATCH match] [COUNT count]
+// fullScan cursor type [MATCH match] [COUNT count] [filters...]
 // here cursor is the scan key for start, (table:key)
 // and the response will return the next start key for next scan,
 // (note: it is not the "0" as the redis scan to indicate the end of scan)
@@ -348,20 +483,9 @@ func (nd *KVNode) fullScanCommand(cmd redcon.Command) (interface{}, error) {
 		return nil, common.ErrInvalidArgs
 	}
 
-	var dataType common.DataType
-	switch strings.ToUpper(string(cmd.Args[2])) {
-	case "KV":
-		dataType = common.KV
-	case "HASH":
-		dataType = common.HASH
-	case "LIST":
-		dataType = common.LIST
-	case "SET":
-		dataType = common.SET
-	case "ZSET":
-		dataType = common.ZSET
-	default:
-		return nil, common.ErrInvalidScanType
+	dataType, err := parseScanDataType(cmd.Args[2])
+	if err != nil {
+		return nil, err
 	}
 	key, err := common.CutNamesapce(cmd.Args[1])
 	if err != nil {
@@ -370,17 +494,21 @@ func (nd *KVNode) fullScanCommand(cmd redcon.Command) (interface{}, error) {
 	cmd.Args[1] = key
 	cmd.Args[1], cmd.Args[2] = cmd.Args[2], cmd.Args[1]
 
-	cursor, match, count, err := parseScanArgs(cmd.Args[2:])
+	sargs, err := parseScanFilterArgs(cmd.Args[2:], true)
 	if err != nil {
 		return nil, err
 	}
+	if sargs.dataType != common.NONE {
+		return nil, common.ErrInvalidArgs
+	}
+	cursor := sargs.cursor
 
 	pos := bytes.IndexByte(cursor, common.KEYSEP)
 	if pos == -1 {
 		return nil, common.ErrInvalidScanCursor
 	}
 
-	result := nd.store.FullScan(dataType, cursor, count, match)
+	result := nd.store.FullScanWithFilter(dataType, cursor, sargs.count, sargs.match, sargs.filter)
 	result.Type = dataType
 
 	if result.Error != nil {
@@ -1,11 +1,13 @@
 package node
 
 import (
+	"math"
 	"os"
 	"testing"
 
 	"github.com/absolute8511/redcon"
 	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
 )
 
 func TestKVNode_scanCommand(t *testing.T) {
@@ -35,6 +37,11 @@ func TestKVNode_scanCommand(t *testing.T) {
 		{"fullscan", buildCommand([][]byte{[]byte("fullscan"), testKey, []byte("list")})},
 		{"fullscan", buildCommand([][]byte{[]byte("fullscan"), testKey, []byte("set")})},
 		{"fullscan", buildCommand([][]byte{[]byte("fullscan"), testKey, []byte("zset")})},
+		{"scan", buildCommand([][]byte{[]byte("scan"), testKey, []byte("type"), []byte("hash"), []byte("count"), []byte("1")})},
+		{"scan", buildCommand([][]byte{[]byte("scan"), testKey, []byte("size"), []byte("1"), []byte("+inf")})},
+		{"advscan", buildCommand([][]byte{[]byte("advscan"), testKey, []byte("hash"), []byte("card"), []byte("10"), []byte("+inf"), []byte("ttl"), []byte("-1"), []byte("-1")})},
+		{"advscan", buildCommand([][]byte{[]byte("advscan"), testKey, []byte("zset"), []byte("version"), []byte("-inf"), []byte("100")})},
+		{"fullscan", buildCommand([][]byte{[]byte("fullscan"), testKey, []byte("set"), []byte("card"), []byte("1"), []byte("2")})},
 	}
 	defer os.RemoveAll(dataDir)
 	defer nd.Stop()
@@ -61,3 +68,30 @@ func TestKVNode_scanCommand(t *testing.T) {
 		}
 	}
 }
+
+func TestParseScanFilterArgs(t *testing.T) {
+	cursor := []byte("test:")
+	sargs, err := parseScanFilterArgs([][]byte{cursor, []byte("MATCH"), []byte("a*"), []byte("COUNT"), []byte("10"),
+		[]byte("TYPE"), []byte("zset"), []byte("CARD"), []byte("10000"), []byte("+inf"), []byte("TTL"), []byte("-1"), []byte("-1")}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, cursor, sargs.cursor)
+	assert.Equal(t, "a*", sargs.match)
+	assert.Equal(t, 10, sargs.count)
+	assert.Equal(t, common.ZSET, sargs.dataType)
+	assert.Equal(t, int64(10000), sargs.filter.Card.Min)
+	assert.Equal(t, int64(math.MaxInt64), sargs.filter.Card.Max)
+	assert.Equal(t, int64(-1), sargs.filter.TTL.Min)
+	assert.Equal(t, int64(-1), sargs.filter.TTL.Max)
+	assert.Nil(t, sargs.filter.Size)
+	assert.Nil(t, sargs.filter.Version)
+
+	_, err = parseScanFilterArgs([][]byte{cursor, []byte("size"), []byte("10"), []byte("1")}, true)
+	assert.NotNil(t, err)
+	_, err = parseScanFilterArgs([][]byte{cursor, []byte("size"), []byte("10")}, true)
+	assert.NotNil(t, err)
+	_, err = parseScanFilterArgs([][]byte{cursor, []byte("type"), []byte("unknown")}, true)
+	assert.NotNil(t, err)
+	// filter not allowed for the sub data scan
+	_, _, _, err = parseScanArgs([][]byte{cursor, []byte("size"), []byte("1"), []byte("10")})
+	assert.NotNil(t, err)
+}
@@ -20,6 +20,26 @@ func (nd *KVNode) GetIndexSchema(table string) (map[string]*common.IndexSchema,
 	}, nil
 }
 
+// GetIndexJobs return the index build and verify jobs in this partition
+func (nd *KVNode) GetIndexJobs() []common.IndexJobProgress {
+	jobs := nd.store.GetIndexJobs()
+	for i := range jobs {
+		jobs[i].Namespace = nd.ns
+	}
+	return jobs
+}
+
+func (nd *KVNode) SetIndexJobThrottle(rate int64, paused bool) {
+	nd.store.SetIndexJobThrottle(rate, paused)
+}
+
+// VerifyHsetIndex will check the local index data and repair it if needed,
+// the verify is not replicated by raft since the index data is built locally,
+// so it should be called on each replica to repair all of them.
+func (nd *KVNode) VerifyHsetIndex(table string, name string, repair bool) error {
+	return nd.store.VerifyHsetIndex(table, name, repair)
+}
+
 func (kvsm *kvStoreSM) handleSchemaUpdate(sc SchemaChange) error {
 	switch sc.Type {
 	case SchemaChangeAddHsetIndex, SchemaChangeUpdateHsetIndex, SchemaChangeDeleteHsetIndex:
@@ -34,6 +54,51 @@ func (kvsm *kvStoreSM) handleSchemaUpdate(sc SchemaChange) error {
 			err = kvsm.store.UpdateHsetIndexState(sc.Table, &hindex)
 		}
 		return err
+	case SchemaChangeAddJSONIndex, SchemaChangeUpdateJSONIndex, SchemaChangeDeleteJSONIndex:
+		var jindex common.JSONIndexSchema
+		err := json.Unmarshal(sc.SchemaData, &jindex)
+		if err != nil {
+			return err
+		}
+		if sc.Type == SchemaChangeAddJSONIndex {
+			err = kvsm.store.AddJSONIndex(sc.Table, &jindex)
+		} else {
+			err = kvsm.store.UpdateJSONIndexState(sc.Table, &jindex)
+		}
+		return err
+	case SchemaChangeAddFullTextIndex, SchemaChangeUpdateFullTextIndex, SchemaChangeDeleteFullTextIndex:
+		var ftindex common.FullTextIndexSchema
+		err := json.Unmarshal(sc.SchemaData, &ftindex)
+		if err != nil {
+			return err
+		}
+		if sc.Type == SchemaChangeAddFullTextIndex {
+			err = kvsm.store.AddFullTextIndex(sc.Table, &ftindex)
+		} else {
+			err = kvsm.store.UpdateFullTextIndexState(sc.Table, &ftindex)
+		}
+		return err
+	case SchemaChangeAddColumnTable, SchemaChangeUpdateColumnTable, SchemaChangeDeleteColumnTable:
+		var ct common.ColumnTableSchema
+		err := json.Unmarshal(sc.SchemaData, &ct)
+		if err != nil {
+			return err
+		}
+		if sc.Type == SchemaChangeAddColumnTable {
+			err = kvsm.store.AddColumnTable(sc.Table, &ct)
+		} else {
+			err = kvsm.store.UpdateColumnTableState(sc.Table, &ct)
+		}
+		return err
+	case SchemaChangeAddTableSchema, SchemaChangeUpdateTableSchema:
+		var schema common.TableSchema
+		err := json.Unmarshal(sc.SchemaData, &schema)
+		if err != nil {
+			return err
+		}
+		return kvsm.store.SetTableSchema(sc.Table, &schema)
+	case SchemaChangeDeleteTableSchema:
+		return kvsm.store.DeleteTableSchema(sc.Table)
 	default:
 		return errors.New("unknown schema change type")
 	}
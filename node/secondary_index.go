@@ -1,7 +1,6 @@
 package node
 
 import (
-	"bytes"
 	"strconv"
 	"strings"
 
@@ -12,68 +11,16 @@ import (
 
 type HindexSearchResults struct {
 	Table string
-	Rets  []common.HIndexRespWithValues
+	// the partition of the results, used to build the cursor of the ordered search
+	Partition int
+	Rets      []common.HIndexRespWithValues
 }
 
-func parseSingleCond(condData []byte, indexCond *rockredis.IndexCondition) ([]byte, error) {
-	condData = bytes.TrimSpace(condData)
-	var field []byte
-	if pos := bytes.Index(condData, []byte("=")); pos != -1 {
-		if condData[pos-1] == '<' {
-			indexCond.EndKey = condData[pos+1:]
-			indexCond.IncludeEnd = true
-			field = condData[:pos-1]
-		} else if condData[pos-1] == '>' {
-			indexCond.StartKey = condData[pos+1:]
-			indexCond.IncludeStart = true
-			field = condData[:pos-1]
-		} else {
-			indexCond.StartKey = condData[pos+1:]
-			indexCond.IncludeStart = true
-			indexCond.EndKey = condData[pos+1:]
-			indexCond.IncludeEnd = true
-			field = condData[:pos]
-		}
-	} else if pos = bytes.Index(condData, []byte(">")); pos != -1 {
-		indexCond.StartKey = condData[pos+1:]
-		indexCond.IncludeStart = false
-		field = condData[:pos]
-	} else if pos = bytes.Index(condData, []byte("<")); pos != -1 {
-		indexCond.EndKey = condData[pos+1:]
-		indexCond.IncludeEnd = false
-		field = condData[:pos]
-	} else {
-		return nil, common.ErrInvalidArgs
-	}
-
-	return field, nil
-}
-
-// TODO: handle string index value which may contains ">, =, <, and" words
-func parseIndexQueryWhere(whereData []byte) ([]byte, *rockredis.IndexCondition, error) {
-	whereData = bytes.Trim(whereData, "\"")
-	andConds := bytes.SplitN(whereData, []byte("and"), 2)
-	if len(andConds) != 1 && len(andConds) != 2 {
-		return nil, nil, common.ErrInvalidArgs
-	}
-	indexCond := &rockredis.IndexCondition{
-		Offset: 0,
-		Limit:  -1,
-	}
-	field, err := parseSingleCond(andConds[0], indexCond)
-	if err != nil {
-		return nil, nil, err
-	}
-	if len(andConds) == 2 {
-		field2, err := parseSingleCond(andConds[1], indexCond)
-		if err != nil {
-			return nil, nil, err
-		}
-		if !bytes.Equal(field, field2) {
-			return nil, nil, common.ErrInvalidArgs
-		}
-	}
-	return field, indexCond, nil
+// the aggregation results in one partition which will be merged across the partitions
+type HindexAggResults struct {
+	Table  string
+	Aggs   []rockredis.ColumnAggregation
+	Values []rockredis.ColumnAggValue
 }
 
 func parseIndexQueryLimit(args [][]byte) (int, int, error) {
@@ -92,12 +39,17 @@ func parseIndexQueryLimit(args [][]byte) (int, int, error) {
 	return offset, count, nil
 }
 
-// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] [HGET $ field2]
-// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] HGETALL $
-// HIDX.FROM {namespace:table} WHERE {WHERE clause} [LIMIT offset num] [ANY HASH REDIS COMMAND]
-// handle (xx and xx) or (xx and xx), get the min and max range and iterator in the possible range,
-// match all the conditions to decide whether the cursor should be returned
-func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
+type indexSearchArgs struct {
+	table []byte
+	where []byte
+	expr  *rockredis.IndexQueryExpr
+	// the options after the where clause
+	opts *common.IndexSearchOptions
+}
+
+// parse the {namespace:table} WHERE {WHERE clause} [ORDER BY field [ASC|DESC]] [LIMIT offset num]
+// [CURSOR cursor] [post command]
+func (nd *KVNode) parseIndexSearchArgs(cmd redcon.Command) (*indexSearchArgs, error) {
 	if len(cmd.Args) < 4 {
 		return nil, common.ErrInvalidArgs
 	}
@@ -111,24 +63,122 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 		return nil, common.ErrInvalidArgs
 	}
 	nd.rn.Debugf("parsing where condition: %v", string(cmd.Args[3]))
-	field, cond, err := parseIndexQueryWhere(cmd.Args[3])
+	whereData := cmd.Args[3]
+	if len(whereData) >= 2 && whereData[0] == '"' && whereData[len(whereData)-1] == '"' {
+		whereData = whereData[1 : len(whereData)-1]
+	}
+	expr, err := rockredis.ParseIndexQueryWhere(whereData)
 	if err != nil {
 		return nil, err
 	}
-	args := cmd.Args[4:]
-	if len(args) >= 3 && bytes.Equal(bytes.ToLower(args[0]), []byte("limit")) {
-		offset, count, err := parseIndexQueryLimit(args)
-		if err != nil {
-			return nil, err
+	opts, err := common.ParseIndexSearchOptions(cmd.Args[4:])
+	if err != nil {
+		return nil, err
+	}
+	return &indexSearchArgs{table: table, where: whereData, expr: expr, opts: opts}, nil
+}
+
+// parse FUNC field [FUNC field ...], the FUNC can be COUNT, SUM, MIN, MAX and AVG,
+// and COUNT * will count all the matched keys.
+func parseIndexAggregations(args [][]byte) ([]rockredis.ColumnAggregation, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, common.ErrInvalidArgs
+	}
+	aggs := make([]rockredis.ColumnAggregation, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		fn, ok := columnAggFuncs[strings.ToLower(string(args[i]))]
+		if !ok {
+			return nil, common.ErrInvalidArgs
 		}
-		cond.Offset = offset
-		cond.Limit = count
-		args = args[3:]
+		agg := rockredis.ColumnAggregation{Func: fn, Field: args[i+1]}
+		if string(args[i+1]) == "*" {
+			if fn != rockredis.ColumnAggCount {
+				return nil, common.ErrInvalidArgs
+			}
+			agg.Field = nil
+		}
+		aggs = append(aggs, agg)
+	}
+	return aggs, nil
+}
+
+func (nd *KVNode) partitionID() int {
+	_, pid := common.GetNamespaceAndPartition(nd.ns)
+	return pid
+}
+
+// search the index in this partition, the results are ordered by the indexed field
+// if ORDER BY is given, and the scan will continue after the position of this
+// partition in the cursor.
+func (nd *KVNode) searchIndex(sargs *indexSearchArgs, isJSON bool) ([]rockredis.HIndexResp, error) {
+	opts := sargs.opts
+	if opts.OrderField == nil {
+		if isJSON {
+			return nd.store.JSONIndexQuery(sargs.table, sargs.expr, opts.Offset, opts.Limit)
+		}
+		return nd.store.HsetIndexQuery(sargs.table, sargs.expr, opts.Offset, opts.Limit)
+	}
+	order := &rockredis.IndexQueryOrder{Field: opts.OrderField, Desc: opts.Desc}
+	if opts.Cursor != nil {
+		if pos, ok := opts.Cursor.Positions[nd.partitionID()]; ok {
+			order.After = &rockredis.HIndexResp{PKey: pos.PKey, IndexValue: pos.Value, IndexIntValue: pos.IntValue}
+		}
+	}
+	if isJSON {
+		return nd.store.JSONIndexOrderedQuery(sargs.table, sargs.expr, order, opts.Offset, opts.Limit)
+	}
+	return nd.store.HsetIndexOrderedQuery(sargs.table, sargs.expr, order, opts.Offset, opts.Limit)
+}
+
+func newIndexRespWithValues(pk rockredis.HIndexResp, vals [][]byte) common.HIndexRespWithValues {
+	rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue, HsetValues: vals}
+	if pk.IndexValueType == rockredis.Int64V || pk.IndexValueType == rockredis.Int32V {
+		rspV.IndexV = pk.IndexIntValue
 	}
-	nd.rn.Debugf("table %v parsing where condition result: %v, field: %v", string(table), cond, string(field))
-	vt, _, pkList, err := nd.store.HsetIndexSearch(table, field, cond, false)
+	return rspV
+}
+
+// HIDX.FROM ns:table where "field1 > 1" AGG COUNT * SUM field2 MAX field2
+func (nd *KVNode) aggregateIndex(sargs *indexSearchArgs, isJSON bool) (interface{}, error) {
+	aggs, err := parseIndexAggregations(sargs.opts.AggArgs)
+	if err != nil {
+		return nil, err
+	}
+	var values []rockredis.ColumnAggValue
+	if isJSON {
+		values, err = nd.store.JSONIndexAggregate(sargs.table, sargs.expr, aggs)
+	} else {
+		values, err = nd.store.HsetIndexAggregate(sargs.table, sargs.expr, aggs)
+	}
+	if err != nil {
+		nd.rn.Infof("aggregate %v, %v error: %v", string(sargs.table), string(sargs.where), err)
+		return nil, err
+	}
+	return &HindexAggResults{Table: string(sargs.table), Aggs: aggs, Values: values}, nil
+}
+
+// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] [HGET $ field2]
+// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] HGETALL $
+// HIDX.FROM {namespace:table} WHERE {WHERE clause} [ORDER BY field [ASC|DESC]] [LIMIT offset num]
+// [CURSOR cursor] [ANY HASH REDIS COMMAND]
+// HIDX.FROM {namespace:table} WHERE {WHERE clause} AGG FUNC field [FUNC field ...]
+// the where clause support and, or, in, !=, prefix like and parentheses, such as
+// "(field1 > 1 and field1 < 10) or field2 in ('a', 'b') or field3 like 'abc%'",
+// each (xx and xx) term will be searched by one index range scan and the results are merged by primary key.
+// With ORDER BY, the index on the order field is scanned in order and the where clause is checked for each key.
+func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
+	sargs, err := nd.parseIndexSearchArgs(cmd)
 	if err != nil {
-		nd.rn.Infof("search %v, %v error: %v", string(table), string(field), err)
+		return nil, err
+	}
+	if sargs.opts.AggArgs != nil {
+		return nd.aggregateIndex(sargs, false)
+	}
+	table := sargs.table
+	args := sargs.opts.PostArgs
+	pkList, err := nd.searchIndex(sargs, false)
+	if err != nil {
+		nd.rn.Infof("search %v, %v error: %v", string(table), string(sargs.where), err)
 		return nil, err
 	}
 	nd.rn.Debugf("search result count: %v", len(pkList))
@@ -149,12 +199,7 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 				if err != nil {
 					continue
 				}
-				vv := [][]byte{v}
-				rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue, HsetValues: vv}
-				if vt == rockredis.Int64V || vt == rockredis.Int32V {
-					rspV.IndexV = pk.IndexIntValue
-				}
-				rets = append(rets, rspV)
+				rets = append(rets, newIndexRespWithValues(pk, [][]byte{v}))
 			}
 		case "hmget":
 			if len(postCmdArgs) < 3 {
@@ -165,11 +210,7 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 				if err != nil {
 					continue
 				}
-				rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue, HsetValues: vals}
-				if vt == rockredis.Int64V || vt == rockredis.Int32V {
-					rspV.IndexV = pk.IndexIntValue
-				}
-				rets = append(rets, rspV)
+				rets = append(rets, newIndexRespWithValues(pk, vals))
 			}
 		case "hgetall":
 			for _, pk := range pkList {
@@ -181,24 +222,58 @@ func (nd *KVNode) hindexSearchCommand(cmd redcon.Command) (interface{}, error) {
 				for _, v := range vals {
 					vv = append(vv, v.Rec.Key, v.Rec.Value)
 				}
-				rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue, HsetValues: vv}
-				if vt == rockredis.Int64V || vt == rockredis.Int32V {
-					rspV.IndexV = pk.IndexIntValue
-				}
-				rets = append(rets, rspV)
+				rets = append(rets, newIndexRespWithValues(pk, vv))
 			}
 		default:
 			return nil, common.ErrNotSupport
 		}
-		return &HindexSearchResults{Table: string(table), Rets: rets}, nil
+		return &HindexSearchResults{Table: string(table), Partition: nd.partitionID(), Rets: rets}, nil
 	} else {
 		for _, pk := range pkList {
-			rspV := common.HIndexRespWithValues{PKey: pk.PKey, IndexV: pk.IndexValue}
-			if vt == rockredis.Int64V || vt == rockredis.Int32V {
-				rspV.IndexV = pk.IndexIntValue
-			}
-			rets = append(rets, rspV)
+			rets = append(rets, newIndexRespWithValues(pk, nil))
+		}
+		return &HindexSearchResults{Table: string(table), Partition: nd.partitionID(), Rets: rets}, nil
+	}
+}
+
+// JIDX.FROM ns:table where "path1 > 1 and path2 = 'a'" [LIMIT offset num] [JSON.GET $ path3 path4]
+// the same where clause and options as HIDX.FROM are supported while the field is the json path indexed.
+func (nd *KVNode) jindexSearchCommand(cmd redcon.Command) (interface{}, error) {
+	sargs, err := nd.parseIndexSearchArgs(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if sargs.opts.AggArgs != nil {
+		return nd.aggregateIndex(sargs, true)
+	}
+	table := sargs.table
+	args := sargs.opts.PostArgs
+	pkList, err := nd.searchIndex(sargs, true)
+	if err != nil {
+		nd.rn.Infof("search json %v, %v error: %v", string(table), string(sargs.where), err)
+		return nil, err
+	}
+	nd.rn.Debugf("search result count: %v", len(pkList))
+	rets := make([]common.HIndexRespWithValues, 0, len(pkList))
+	if len(args) == 0 {
+		for _, pk := range pkList {
+			rets = append(rets, newIndexRespWithValues(pk, nil))
+		}
+		return &HindexSearchResults{Table: string(table), Partition: nd.partitionID(), Rets: rets}, nil
+	}
+	if len(args) < 3 || strings.ToLower(string(args[0])) != "json.get" {
+		return nil, common.ErrInvalidArgs
+	}
+	for _, pk := range pkList {
+		vals, err := nd.store.JGet(pk.PKey, args[2:]...)
+		if err != nil {
+			continue
+		}
+		vv := make([][]byte, 0, len(vals))
+		for _, v := range vals {
+			vv = append(vv, []byte(v))
 		}
-		return &HindexSearchResults{Table: string(table), Rets: rets}, nil
+		rets = append(rets, newIndexRespWithValues(pk, vv))
 	}
+	return &HindexSearchResults{Table: string(table), Partition: nd.partitionID(), Rets: rets}, nil
 }
@@ -0,0 +1,295 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+var (
+	errCMSMergeCrossNamespace = errors.New("ERR the source and destination should be in the same namespace")
+	errCMSNumKeys             = errors.New("ERR CMS: invalid numkeys")
+	errSketchSyntax           = errors.New("ERR syntax error")
+)
+
+// parse the args in the format: numkeys src [src ...] [WEIGHTS weight [weight ...]]
+func parseCMSMergeArgs(args [][]byte) ([][]byte, []int64, error) {
+	if len(args) < 2 {
+		return nil, nil, errCMSNumKeys
+	}
+	num, err := strconv.Atoi(string(args[0]))
+	if err != nil || num <= 0 || num > len(args)-1 {
+		return nil, nil, errCMSNumKeys
+	}
+	srcs := args[1 : 1+num]
+	weights := make([]int64, num)
+	left := args[1+num:]
+	if len(left) == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		return srcs, weights, nil
+	}
+	if strings.ToLower(string(left[0])) != "weights" || len(left) != num+1 {
+		return nil, nil, errSketchSyntax
+	}
+	for i, w := range left[1:] {
+		weights[i], err = strconv.ParseInt(string(w), 10, 64)
+		if err != nil {
+			return nil, nil, rockredis.ErrCMSIncrement
+		}
+	}
+	return srcs, weights, nil
+}
+
+// cms.initbydim key width depth
+func (kvsm *kvStoreSM) localCMSInitByDimCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	width, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return nil, rockredis.ErrCMSInvalidDim
+	}
+	depth, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+	if err != nil {
+		return nil, rockredis.ErrCMSInvalidDim
+	}
+	return nil, kvsm.store.CMSInitByDim(ts, cmd.Args[1], width, depth)
+}
+
+// cms.initbyprob key error probability
+func (kvsm *kvStoreSM) localCMSInitByProbCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	errRate, err := strconv.ParseFloat(string(cmd.Args[2]), 64)
+	if err != nil {
+		return nil, rockredis.ErrCMSInvalidProb
+	}
+	prob, err := strconv.ParseFloat(string(cmd.Args[3]), 64)
+	if err != nil {
+		return nil, rockredis.ErrCMSInvalidProb
+	}
+	return nil, kvsm.store.CMSInitByProb(ts, cmd.Args[1], errRate, prob)
+}
+
+// cms.incrby key item increment [item increment ...]
+func (kvsm *kvStoreSM) localCMSIncrByCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	args := cmd.Args[2:]
+	if len(args)%2 != 0 {
+		return nil, common.ErrInvalidArgs
+	}
+	elems := make([][]byte, 0, len(args)/2)
+	incrs := make([]int64, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		incr, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return nil, rockredis.ErrCMSIncrement
+		}
+		elems = append(elems, args[i])
+		incrs = append(incrs, incr)
+	}
+	return kvsm.store.CMSIncrBy(ts, cmd.Args[1], elems, incrs)
+}
+
+// cms.merge dest numkeys src [src ...] [WEIGHTS weight [weight ...]]
+func (kvsm *kvStoreSM) localCMSMergeCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	srcs, weights, err := parseCMSMergeArgs(cmd.Args[2:])
+	if err != nil {
+		return nil, err
+	}
+	return nil, kvsm.store.CMSMerge(ts, cmd.Args[1], srcs, weights)
+}
+
+func (kvsm *kvStoreSM) localCMSClearCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.CMSClear(ts, cmd.Args[1])
+}
+
+func (kvsm *kvStoreSM) localCMSExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	duration, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return int64(0), err
+	}
+	return kvsm.store.CMSExpire(ts, cmd.Args[1], duration)
+}
+
+func (kvsm *kvStoreSM) localCMSPersistCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.CMSPersist(ts, cmd.Args[1])
+}
+
+// topk.reserve key topk [width depth decay]
+func (kvsm *kvStoreSM) localTopKReserveCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	k, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return nil, rockredis.ErrTopKInvalidK
+	}
+	width := int64(rockredis.DefaultTopKWidth)
+	depth := int64(rockredis.DefaultTopKDepth)
+	decay := rockredis.DefaultTopKDecay
+	if len(cmd.Args) > 3 {
+		if len(cmd.Args) != 6 {
+			return nil, errSketchSyntax
+		}
+		width, err = strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+		if err != nil {
+			return nil, rockredis.ErrTopKInvalidDim
+		}
+		depth, err = strconv.ParseInt(string(cmd.Args[4]), 10, 64)
+		if err != nil {
+			return nil, rockredis.ErrTopKInvalidDim
+		}
+		decay, err = strconv.ParseFloat(string(cmd.Args[5]), 64)
+		if err != nil {
+			return nil, rockredis.ErrTopKDecay
+		}
+	}
+	return nil, kvsm.store.TopKReserve(ts, cmd.Args[1], k, width, depth, decay)
+}
+
+func (kvsm *kvStoreSM) localTopKAddCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.TopKAdd(ts, cmd.Args[1], cmd.Args[2:]...)
+}
+
+func (kvsm *kvStoreSM) localTopKClearCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.TopKClear(ts, cmd.Args[1])
+}
+
+func (kvsm *kvStoreSM) localTopKExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	duration, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return int64(0), err
+	}
+	return kvsm.store.TopKExpire(ts, cmd.Args[1], duration)
+}
+
+func (kvsm *kvStoreSM) localTopKPersistCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.TopKPersist(ts, cmd.Args[1])
+}
+
+// The source keys should be in the same partition with the destination.
+func (nd *KVNode) cmsMergeCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 4 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	srcs, _, err := parseCMSMergeArgs(cmd.Args[2:])
+	if err != nil {
+		return nil, err
+	}
+	ns, _, err := common.ExtractNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, len(cmd.Args))
+	copy(args, cmd.Args)
+	for i := range srcs {
+		srcNs, src, err := common.ExtractNamesapce(srcs[i])
+		if err != nil {
+			return nil, err
+		}
+		if srcNs != ns {
+			return nil, errCMSMergeCrossNamespace
+		}
+		args[3+i] = src
+	}
+	return rebuildFirstKeyAndPropose(nd, buildCommand(args), checkOKRsp)
+}
+
+func (nd *KVNode) cmsQueryCommand(conn redcon.Conn, cmd redcon.Command) {
+	rets, err := nd.store.CMSQuery(cmd.Args[1], cmd.Args[2:]...)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(len(rets))
+	for _, v := range rets {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) cmsInfoCommand(conn redcon.Conn, cmd redcon.Command) {
+	info, err := nd.store.CMSGetInfo(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(6)
+	conn.WriteString("width")
+	conn.WriteInt64(info.Width)
+	conn.WriteString("depth")
+	conn.WriteInt64(info.Depth)
+	conn.WriteString("count")
+	conn.WriteInt64(info.Count)
+}
+
+func (nd *KVNode) cmsKeyExistCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.CMSKeyExists(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) cmsttlCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.CMSTtl(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) topkQueryCommand(conn redcon.Conn, cmd redcon.Command) {
+	rets, err := nd.store.TopKQuery(cmd.Args[1], cmd.Args[2:]...)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(len(rets))
+	for _, v := range rets {
+		conn.WriteInt64(v)
+	}
+}
+
+// topk.list key [WITHCOUNT]
+func (nd *KVNode) topkListCommand(conn redcon.Conn, cmd redcon.Command) {
+	withCount := false
+	if len(cmd.Args) > 2 {
+		if len(cmd.Args) != 3 || strings.ToLower(string(cmd.Args[2])) != "withcount" {
+			conn.WriteError(errSketchSyntax.Error())
+			return
+		}
+		withCount = true
+	}
+	list, err := nd.store.TopKList(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if withCount {
+		conn.WriteArray(len(list) * 2)
+	} else {
+		conn.WriteArray(len(list))
+	}
+	for _, item := range list {
+		conn.WriteBulk(item.Item)
+		if withCount {
+			conn.WriteInt64(item.Count)
+		}
+	}
+}
+
+func (nd *KVNode) topkKeyExistCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.TopKKeyExists(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) topkttlCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.TopKTtl(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
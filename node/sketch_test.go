@@ -0,0 +1,65 @@
+package node
+
+import (
+	"os"
+	"testing"
+
+	"github.com/absolute8511/redcon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKVNode_sketchCommand(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	testKey := []byte("default:test:1")
+	testKey2 := []byte("default:test:2")
+	testTopKKey := []byte("default:test:3")
+	testItem := []byte("1")
+	testItem2 := []byte("2")
+
+	tests := []struct {
+		name string
+		args redcon.Command
+	}{
+		{"cms.initbydim", buildCommand([][]byte{[]byte("cms.initbydim"), testKey, []byte("100"), []byte("5")})},
+		{"cms.initbyprob", buildCommand([][]byte{[]byte("cms.initbyprob"), testKey2, []byte("0.01"), []byte("0.01")})},
+		{"cms.incrby", buildCommand([][]byte{[]byte("cms.incrby"), testKey, testItem, []byte("2"), testItem2, []byte("1")})},
+		{"cms.query", buildCommand([][]byte{[]byte("cms.query"), testKey, testItem, testItem2})},
+		{"cms.info", buildCommand([][]byte{[]byte("cms.info"), testKey})},
+		{"cms.merge", buildCommand([][]byte{[]byte("cms.merge"), testKey, []byte("1"), testKey, []byte("WEIGHTS"), []byte("2")})},
+		{"cms.keyexist", buildCommand([][]byte{[]byte("cms.keyexist"), testKey})},
+		{"cms.expire", buildCommand([][]byte{[]byte("cms.expire"), testKey, []byte("10")})},
+		{"cms.ttl", buildCommand([][]byte{[]byte("cms.ttl"), testKey})},
+		{"cms.persist", buildCommand([][]byte{[]byte("cms.persist"), testKey})},
+		{"cms.clear", buildCommand([][]byte{[]byte("cms.clear"), testKey})},
+		{"topk.reserve", buildCommand([][]byte{[]byte("topk.reserve"), testTopKKey, []byte("3"), []byte("10"), []byte("5"), []byte("0.9")})},
+		{"topk.add", buildCommand([][]byte{[]byte("topk.add"), testTopKKey, testItem, testItem2})},
+		{"topk.query", buildCommand([][]byte{[]byte("topk.query"), testTopKKey, testItem, testItem2})},
+		{"topk.list", buildCommand([][]byte{[]byte("topk.list"), testTopKKey})},
+		{"topk.list", buildCommand([][]byte{[]byte("topk.list"), testTopKKey, []byte("WITHCOUNT")})},
+		{"topk.keyexist", buildCommand([][]byte{[]byte("topk.keyexist"), testTopKKey})},
+		{"topk.expire", buildCommand([][]byte{[]byte("topk.expire"), testTopKKey, []byte("10")})},
+		{"topk.ttl", buildCommand([][]byte{[]byte("topk.ttl"), testTopKKey})},
+		{"topk.persist", buildCommand([][]byte{[]byte("topk.persist"), testTopKKey})},
+		{"topk.clear", buildCommand([][]byte{[]byte("topk.clear"), testTopKKey})},
+	}
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+	c := &fakeRedisConn{}
+	for _, cmd := range tests {
+		c.Reset()
+		origCmd := append([]byte{}, cmd.args.Raw...)
+		handler, ok := nd.router.GetCmdHandler(cmd.name)
+		if ok {
+			handler(c, cmd.args)
+			assert.Nil(t, c.GetError(), cmd.name)
+		} else {
+			whandler, _ := nd.router.GetWCmdHandler(cmd.name)
+			rsp, err := whandler(cmd.args)
+			assert.Nil(t, err, cmd.name)
+			_, ok := rsp.(error)
+			assert.True(t, !ok, cmd.name)
+		}
+		assert.Equal(t, origCmd, cmd.args.Raw)
+	}
+}
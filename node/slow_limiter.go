@@ -54,6 +54,7 @@ func init() {
 	maybeSlowCmd["zremrangebyscore"] = true
 	maybeSlowCmd["zremrangebylex"] = true
 	maybeSlowCmd["ltrim"] = true
+	maybeSlowCmd["geosearchstore"] = true
 	// remove below if compact ttl is enabled by default
 	maybeSlowCmd["sclear"] = true
 	maybeSlowCmd["zclear"] = true
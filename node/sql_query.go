@@ -0,0 +1,53 @@
+package node
+
+import (
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+// the rows of the sql query in one partition which will be merged across the partitions
+type SQLQueryResults struct {
+	Table string
+	Plan  rockredis.SQLQueryPlan
+	Rows  []common.SQLRow
+}
+
+// SQL ns:table "SELECT ... FROM ns.table ..." is dispatched to each partition by the server after
+// parsing the query, the offset is applied after merged so the first offset+limit rows are returned.
+func (nd *KVNode) sqlQueryCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) != 3 {
+		return nil, common.ErrInvalidArgs
+	}
+	table, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	s, err := common.ParseSQLSelect(cmd.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	if s.Table != string(table) {
+		return nil, common.ErrInvalidArgs
+	}
+	q := &rockredis.SQLQuery{
+		Table:      table,
+		Fields:     s.Fields,
+		OrderField: s.OrderField,
+		Desc:       s.Desc,
+		Limit:      s.Offset + s.Limit,
+	}
+	if s.Where != nil {
+		q.Where, err = rockredis.ParseIndexQueryWhere(s.Where)
+		if err != nil {
+			return nil, err
+		}
+	}
+	plan, rows, err := nd.store.HsetSQLQuery(q)
+	if err != nil {
+		nd.rn.Infof("sql query %v error: %v", string(cmd.Args[2]), err)
+		return nil, err
+	}
+	nd.rn.Debugf("sql query %v using %v, result count: %v", string(cmd.Args[2]), plan, len(rows))
+	return &SQLQueryResults{Table: string(table), Plan: plan, Rows: rows}, nil
+}
@@ -0,0 +1,191 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+// the write proposal larger than this will be split into several staged chunks, and the
+// command will be applied atomically while the commit proposal applied.
+const proposeStageChunkSize = 1024 * 1024
+
+const (
+	stageChunkCmd  = "stage.chunk"
+	stageCommitCmd = "stage.commit"
+)
+
+var errInvalidStageCmd = errors.New("ERR invalid staged command")
+
+func (nd *KVNode) proposeStageCmd(args [][]byte, useV2 bool) (*FutureRsp, error) {
+	ncmd := buildCommand(args)
+	if useV2 {
+		return nd.RedisV2ProposeAsync(ncmd.Raw)
+	}
+	return nd.RedisProposeAsync(ncmd.Raw)
+}
+
+// propose the large write command as several staged chunks and a commit, this will wait until
+// all the chunks are staged, and the returned future is for the commit proposal.
+func (nd *KVNode) proposeStaged(cmd redcon.Command) (*FutureRsp, error) {
+	key, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	orig := cmd.Args[1]
+	cmd.Args[1] = key
+	// the staged command is always without namespace, so it can be applied directly while committing
+	data := buildCommand(cmd.Args).Raw
+	cmd.Args[1] = orig
+	// the key of stage command should be the same as the normal proposal
+	pk := key
+	if UseRedisV2 {
+		pk = orig
+	}
+	return nd.proposeStagedData(pk, data, UseRedisV2)
+}
+
+// propose the command with all the keys namespace removed, the command will be staged if it is
+// too large for a single raft entry.
+func (nd *KVNode) redisProposeMaybeStaged(cmd redcon.Command) (*FutureRsp, error) {
+	if len(cmd.Raw) > proposeStageChunkSize {
+		return nd.proposeStagedData(cmd.Args[1], cmd.Raw, false)
+	}
+	return nd.RedisProposeAsync(cmd.Raw)
+}
+
+func (nd *KVNode) proposeStagedData(pk []byte, data []byte, useV2 bool) (*FutureRsp, error) {
+	stageID := []byte(strconv.FormatUint(nd.rn.reqIDGen.Next(), 10))
+	chunkNum := (len(data) + proposeStageChunkSize - 1) / proposeStageChunkSize
+	rsps := make([]*FutureRsp, 0, chunkNum)
+	var stageErr error
+	for i := 0; i < chunkNum; i++ {
+		start := i * proposeStageChunkSize
+		end := start + proposeStageChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		rsp, err := nd.proposeStageCmd([][]byte{[]byte(stageChunkCmd), pk, stageID,
+			[]byte(strconv.Itoa(i)), data[start:end]}, useV2)
+		if err != nil {
+			stageErr = err
+			break
+		}
+		rsps = append(rsps, rsp)
+	}
+	// we need wait all the proposed to release the resource even if failed
+	for _, rsp := range rsps {
+		_, err := rsp.WaitRsp()
+		if err != nil && stageErr == nil {
+			stageErr = err
+		}
+	}
+	if stageErr != nil {
+		nd.rn.Infof("failed to stage the large write for key %v: %v", string(pk), stageErr)
+		return nil, stageErr
+	}
+	return nd.proposeStageCmd([][]byte{[]byte(stageCommitCmd), pk, stageID,
+		[]byte(strconv.Itoa(chunkNum)), []byte(strconv.Itoa(len(data)))}, useV2)
+}
+
+// stage.chunk key stage_id index data
+func (kvsm *kvStoreSM) localStageChunkCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	if len(cmd.Args) != 5 {
+		return nil, errInvalidStageCmd
+	}
+	stageID, err := strconv.ParseUint(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	index, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	err = kvsm.store.StageChunk(ts, cmd.Args[1], stageID, index, cmd.Args[4])
+	return nil, err
+}
+
+// load the staged command for stage.commit key stage_id chunk_num size
+func (kvsm *kvStoreSM) loadStagedCommand(cmd redcon.Command) (uint64, redcon.Command, error) {
+	var inner redcon.Command
+	if len(cmd.Args) != 5 {
+		return 0, inner, errInvalidStageCmd
+	}
+	stageID, err := strconv.ParseUint(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return 0, inner, err
+	}
+	chunkNum, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+	if err != nil {
+		return stageID, inner, err
+	}
+	size, err := strconv.ParseInt(string(cmd.Args[4]), 10, 64)
+	if err != nil {
+		return stageID, inner, err
+	}
+	data, err := kvsm.store.LoadStaged(cmd.Args[1], stageID, chunkNum, size)
+	if err != nil {
+		return stageID, inner, err
+	}
+	inner, err = redcon.Parse(data)
+	if err != nil {
+		return stageID, inner, err
+	}
+	if len(inner.Args) < 2 || !bytes.Equal(inner.Args[1], cmd.Args[1]) {
+		return stageID, inner, errInvalidStageCmd
+	}
+	cmdName := strings.ToLower(string(inner.Args[0]))
+	if cmdName == stageChunkCmd || cmdName == stageCommitCmd {
+		return stageID, inner, errInvalidStageCmd
+	}
+	return stageID, inner, nil
+}
+
+func (kvsm *kvStoreSM) localStageCommitCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	stageID, inner, err := kvsm.loadStagedCommand(cmd)
+	if err == nil {
+		cmdName := strings.ToLower(string(inner.Args[0]))
+		h, ok := kvsm.router.GetInternalCmdHandler(cmdName)
+		if !ok {
+			err = common.ErrInvalidCommand
+		} else {
+			// the stage will be deleted in the same write batch with the staged command
+			err = kvsm.store.PrepareStageDelete(cmd.Args[1], stageID)
+			if err == nil {
+				var v interface{}
+				v, err = h(inner, ts)
+				if err == nil {
+					// make sure the stage is deleted even if the command has nothing to write
+					return v, kvsm.store.CommitBatchWrite()
+				}
+			}
+		}
+	}
+	kvsm.Infof("failed to commit staged command for key %v: %v", string(cmd.Args[1]), err)
+	// the failed stage should be deleted
+	kvsm.store.AbortBatch()
+	if stageID != 0 {
+		if derr := kvsm.store.DelStage(cmd.Args[1], stageID); derr != nil {
+			kvsm.Infof("failed to delete stage %v for key %v: %v", stageID, string(cmd.Args[1]), derr)
+		}
+	}
+	return nil, err
+}
+
+func (kvsm *kvStoreSM) checkStageChunkConflict(cmd redcon.Command, reqTs int64) ConflictState {
+	return NoConflict
+}
+
+// the staged command will be checked for the commit
+func (kvsm *kvStoreSM) checkStageCommitConflict(cmd redcon.Command, reqTs int64) ConflictState {
+	_, inner, err := kvsm.loadStagedCommand(cmd)
+	if err != nil {
+		// the error will be returned while applying
+		return NoConflict
+	}
+	return kvsm.preCheckConflict(inner, reqTs)
+}
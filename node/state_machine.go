@@ -751,7 +751,15 @@ func (kvsm *kvStoreSM) ApplyRaftRequest(isReplaying bool, batch IBatchOperator,
 					if kvsm.topnWrites != nil {
 						kvsm.topnWrites.HitWrite(pk)
 					}
-					v, err := h(cmd, reqTs)
+					var v interface{}
+					if batch.IsBatched() {
+						// the apply lock is held by the batch until committed
+						v, err = h(cmd, reqTs)
+					} else {
+						kvsm.store.LockApply()
+						v, err = h(cmd, reqTs)
+						kvsm.store.UnlockApply()
+					}
 					if err != nil {
 						kvsm.Errorf("redis command %v error: %v, cmd: %v", cmdName, err, string(cmd.Raw))
 						kvsm.w.Trigger(reqID, err)
@@ -0,0 +1,125 @@
+package node
+
+import (
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func (nd *KVNode) getKeyTableSchema(rawKey []byte) ([]byte, *common.TableSchema, error) {
+	key, err := common.CutNamesapce(rawKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	table, _, err := common.ExtractTable(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, nd.store.GetTableSchema(string(table)), nil
+}
+
+// check the command args with the table schema, isNew is true if the key not exist
+type schemaCheckFunc func(schema *common.TableSchema, args [][]byte, isNew bool) error
+
+// validate the write command with the table schema of the key before proposal, the
+// command with the invalid args is not checked and will be rejected by the handler.
+func wrapSchemaCheck(kvn *KVNode, f common.WriteCommandFunc, minArgs int,
+	exists func(store *KVStore, key []byte) (int64, error), check schemaCheckFunc) common.WriteCommandFunc {
+	return func(cmd redcon.Command) (interface{}, error) {
+		if len(cmd.Args) < minArgs {
+			return f(cmd)
+		}
+		key, schema, err := kvn.getKeyTableSchema(cmd.Args[1])
+		if err != nil || schema == nil {
+			return f(cmd)
+		}
+		isNew := false
+		if exists != nil {
+			n, err := exists(kvn.store, key)
+			if err != nil {
+				return nil, err
+			}
+			isNew = n == 0
+		}
+		err = check(schema, cmd.Args, isNew)
+		if err != nil {
+			return nil, err
+		}
+		return f(cmd)
+	}
+}
+
+// validate the hash fields written by hset, hsetnx and hmset with the table schema
+// before proposal. The default fields will be written at apply time if the hash is
+// created by this write.
+func wrapHashSchemaCheck(kvn *KVNode, f common.WriteCommandFunc) common.WriteCommandFunc {
+	return wrapSchemaCheck(kvn, f, 4, (*KVStore).HKeyExists, func(schema *common.TableSchema, args [][]byte, isNew bool) error {
+		if len(args[2:])%2 != 0 {
+			return nil
+		}
+		return schema.ValidateHashFields(args[2:], isNew)
+	})
+}
+
+// only the int field can be increased by hincrby
+func wrapHashIncrSchemaCheck(kvn *KVNode, f common.WriteCommandFunc) common.WriteCommandFunc {
+	return wrapSchemaCheck(kvn, f, 4, (*KVStore).HKeyExists, func(schema *common.TableSchema, args [][]byte, isNew bool) error {
+		return schema.ValidateHashIncr(args[2], isNew)
+	})
+}
+
+// the required fields can not be deleted by hdel
+func wrapHashDelSchemaCheck(kvn *KVNode, f common.WriteCommandFunc) common.WriteCommandFunc {
+	return wrapSchemaCheck(kvn, f, 3, nil, func(schema *common.TableSchema, args [][]byte, isNew bool) error {
+		return schema.ValidateHashDel(args[2:])
+	})
+}
+
+// validate the json.set with the table schema before proposal, the top level keys
+// of the json are checked as the declared fields. The default fields will be set at
+// apply time if the json is created or replaced by this write.
+func wrapJSONSchemaCheck(kvn *KVNode, f common.WriteCommandFunc) common.WriteCommandFunc {
+	return wrapSchemaCheck(kvn, f, 4, (*KVStore).JKeyExists, func(schema *common.TableSchema, args [][]byte, isNew bool) error {
+		if len(args) != 4 {
+			return nil
+		}
+		return schema.ValidateJSONSet(args[2], args[3], isNew)
+	})
+}
+
+// the json created by json.merge at the root path will have the default fields
+func wrapJSONMergeSchemaCheck(kvn *KVNode, f common.WriteCommandFunc) common.WriteCommandFunc {
+	return wrapSchemaCheck(kvn, f, 4, (*KVStore).JKeyExists, func(schema *common.TableSchema, args [][]byte, isNew bool) error {
+		return schema.ValidateJSONMerge(args[2], args[3], isNew)
+	})
+}
+
+// the other json write commands only change the existing json, so the value type at
+// the path is checked.
+func wrapJSONNumIncrSchemaCheck(kvn *KVNode, f common.WriteCommandFunc) common.WriteCommandFunc {
+	return wrapSchemaCheck(kvn, f, 4, nil, func(schema *common.TableSchema, args [][]byte, isNew bool) error {
+		return schema.ValidateJSONNumIncr(args[2], args[3])
+	})
+}
+
+func wrapJSONStrAppendSchemaCheck(kvn *KVNode, f common.WriteCommandFunc) common.WriteCommandFunc {
+	return wrapSchemaCheck(kvn, f, 3, nil, func(schema *common.TableSchema, args [][]byte, isNew bool) error {
+		// the path is optional and the root is used if not given
+		path := []byte("")
+		if len(args) > 3 {
+			path = args[2]
+		}
+		return schema.ValidateJSONStrAppend(path)
+	})
+}
+
+func wrapJSONToggleSchemaCheck(kvn *KVNode, f common.WriteCommandFunc) common.WriteCommandFunc {
+	return wrapSchemaCheck(kvn, f, 3, nil, func(schema *common.TableSchema, args [][]byte, isNew bool) error {
+		return schema.ValidateJSONToggle(args[2])
+	})
+}
+
+func wrapJSONArrayInsertSchemaCheck(kvn *KVNode, f common.WriteCommandFunc) common.WriteCommandFunc {
+	return wrapSchemaCheck(kvn, f, 5, nil, func(schema *common.TableSchema, args [][]byte, isNew bool) error {
+		return schema.ValidateJSONArrayInsert(args[2])
+	})
+}
@@ -0,0 +1,457 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+var (
+	errTSCrossNamespace = errors.New("ERR the keys should be in the same namespace")
+	errTSSyntax         = errors.New("ERR TSDB: wrong parameters")
+	errTSTimestamp      = errors.New("ERR TSDB: invalid timestamp")
+	errTSValue          = errors.New("ERR TSDB: invalid value")
+	errTSFilter         = errors.New("ERR TSDB: invalid filter")
+)
+
+// parse the options: [RETENTION retention] [CHUNK_DURATION duration] [LABELS label value ...]
+func parseTSCreateOptions(args [][]byte) (*rockredis.TSCreateOptions, error) {
+	opts := &rockredis.TSCreateOptions{}
+	var err error
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "retention":
+			if i+1 >= len(args) {
+				return nil, errTSSyntax
+			}
+			i++
+			opts.Retention, err = strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return nil, rockredis.ErrTSRetention
+			}
+		case "chunk_duration":
+			if i+1 >= len(args) {
+				return nil, errTSSyntax
+			}
+			i++
+			opts.ChunkDuration, err = strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return nil, rockredis.ErrTSChunkDuration
+			}
+		case "labels":
+			// labels should be the last option
+			labels := args[i+1:]
+			if len(labels) == 0 || len(labels)%2 != 0 {
+				return nil, rockredis.ErrTSLabels
+			}
+			for j := 0; j < len(labels); j += 2 {
+				opts.Labels = append(opts.Labels, rockredis.TSLabel{
+					Name:  string(labels[j]),
+					Value: string(labels[j+1]),
+				})
+			}
+			i = len(args)
+		default:
+			return nil, errTSSyntax
+		}
+	}
+	return opts, nil
+}
+
+// parse the sample timestamp in milliseconds, * means the time of the write
+func parseTSSampleTs(arg []byte, ts int64) (int64, error) {
+	if string(arg) == "*" {
+		return ts / int64(time.Millisecond), nil
+	}
+	v, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, errTSTimestamp
+	}
+	return v, nil
+}
+
+func parseTSValue(arg []byte) (float64, error) {
+	v, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil {
+		return 0, errTSValue
+	}
+	return v, nil
+}
+
+// parse the range from and to, - and + means the min and max timestamp
+func parseTSRangeTs(from []byte, to []byte) (int64, int64, error) {
+	start := int64(0)
+	end := int64(math.MaxInt64)
+	var err error
+	if string(from) != "-" {
+		start, err = strconv.ParseInt(string(from), 10, 64)
+		if err != nil {
+			return 0, 0, errTSTimestamp
+		}
+	}
+	if string(to) != "+" {
+		end, err = strconv.ParseInt(string(to), 10, 64)
+		if err != nil {
+			return 0, 0, errTSTimestamp
+		}
+	}
+	return start, end, nil
+}
+
+// parse the range options: [COUNT count] [AGGREGATION type bucket], the left args will be returned
+func parseTSRangeOptions(args [][]byte, reverse bool) (*rockredis.TSRangeOptions, [][]byte, error) {
+	opts := &rockredis.TSRangeOptions{Reverse: reverse}
+	var err error
+	for len(args) > 0 {
+		switch strings.ToLower(string(args[0])) {
+		case "count":
+			if len(args) < 2 {
+				return nil, nil, errTSSyntax
+			}
+			opts.Count, err = strconv.ParseInt(string(args[1]), 10, 64)
+			if err != nil || opts.Count < 0 {
+				return nil, nil, errTSSyntax
+			}
+			args = args[2:]
+		case "aggregation":
+			if len(args) < 3 {
+				return nil, nil, errTSSyntax
+			}
+			opts.AggType = string(args[1])
+			opts.Bucket, err = strconv.ParseInt(string(args[2]), 10, 64)
+			if err != nil {
+				return nil, nil, rockredis.ErrTSBucket
+			}
+			args = args[3:]
+		default:
+			return opts, args, nil
+		}
+	}
+	return opts, args, nil
+}
+
+// parse the filters: label=value or label!=value
+func parseTSLabelFilters(args [][]byte) ([]rockredis.TSLabelFilter, error) {
+	if len(args) == 0 {
+		return nil, errTSFilter
+	}
+	filters := make([]rockredis.TSLabelFilter, 0, len(args))
+	for _, arg := range args {
+		f := string(arg)
+		var filter rockredis.TSLabelFilter
+		if pos := strings.Index(f, "!="); pos > 0 {
+			filter.Name = f[:pos]
+			filter.Value = f[pos+2:]
+			filter.NotEqual = true
+		} else if pos := strings.Index(f, "="); pos > 0 {
+			filter.Name = f[:pos]
+			filter.Value = f[pos+1:]
+		} else {
+			return nil, errTSFilter
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// ts.create key [RETENTION retention] [CHUNK_DURATION duration] [LABELS label value ...]
+func (kvsm *kvStoreSM) localTSCreateCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	opts, err := parseTSCreateOptions(cmd.Args[2:])
+	if err != nil {
+		return nil, err
+	}
+	return nil, kvsm.store.TSCreate(ts, cmd.Args[1], opts)
+}
+
+// ts.add key timestamp value [RETENTION retention] [CHUNK_DURATION duration] [LABELS label value ...]
+func (kvsm *kvStoreSM) localTSAddCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	sampleTs, err := parseTSSampleTs(cmd.Args[2], ts)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseTSValue(cmd.Args[3])
+	if err != nil {
+		return nil, err
+	}
+	opts, err := parseTSCreateOptions(cmd.Args[4:])
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.TSAdd(ts, cmd.Args[1], sampleTs, v, opts)
+}
+
+// ts.madd key timestamp value [key timestamp value ...]
+func (kvsm *kvStoreSM) localTSMAddCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	args := cmd.Args[1:]
+	if len(args) == 0 || len(args)%3 != 0 {
+		return nil, common.ErrInvalidArgs
+	}
+	keys := make([][]byte, 0, len(args)/3)
+	tss := make([]int64, 0, len(args)/3)
+	vals := make([]float64, 0, len(args)/3)
+	for i := 0; i < len(args); i += 3 {
+		sampleTs, err := parseTSSampleTs(args[i+1], ts)
+		if err != nil {
+			return nil, err
+		}
+		v, err := parseTSValue(args[i+2])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, args[i])
+		tss = append(tss, sampleTs)
+		vals = append(vals, v)
+	}
+	return kvsm.store.TSMAdd(ts, keys, tss, vals)
+}
+
+// ts.createrule src dest AGGREGATION type bucket
+func (kvsm *kvStoreSM) localTSCreateRuleCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	if len(cmd.Args) != 6 || strings.ToLower(string(cmd.Args[3])) != "aggregation" {
+		return nil, errTSSyntax
+	}
+	bucket, err := strconv.ParseInt(string(cmd.Args[5]), 10, 64)
+	if err != nil {
+		return nil, rockredis.ErrTSBucket
+	}
+	return nil, kvsm.store.TSCreateRule(ts, cmd.Args[1], cmd.Args[2], string(cmd.Args[4]), bucket)
+}
+
+// ts.deleterule src dest
+func (kvsm *kvStoreSM) localTSDeleteRuleCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	if len(cmd.Args) != 3 {
+		return nil, errTSSyntax
+	}
+	return nil, kvsm.store.TSDeleteRule(ts, cmd.Args[1], cmd.Args[2])
+}
+
+func (kvsm *kvStoreSM) localTSClearCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.TSClear(ts, cmd.Args[1])
+}
+
+func (kvsm *kvStoreSM) localTSExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	duration, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return int64(0), err
+	}
+	return kvsm.store.TSExpire(ts, cmd.Args[1], duration)
+}
+
+func (kvsm *kvStoreSM) localTSPersistCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	return kvsm.store.TSPersist(ts, cmd.Args[1])
+}
+
+// All the keys in ts.madd should be in the same partition.
+func (nd *KVNode) tsMAddCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 4 || (len(cmd.Args)-1)%3 != 0 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	if (len(cmd.Args)-1)/3 > common.MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	ns, _, err := common.ExtractNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, len(cmd.Args))
+	copy(args, cmd.Args)
+	for i := 4; i < len(args); i += 3 {
+		keyNs, key, err := common.ExtractNamesapce(args[i])
+		if err != nil {
+			return nil, err
+		}
+		if keyNs != ns {
+			return nil, errTSCrossNamespace
+		}
+		args[i] = key
+	}
+	return rebuildFirstKeyAndPropose(nd, buildCommand(args), checkAndRewriteIntArrayRsp)
+}
+
+// The source and destination of the compaction rule should be in the same partition.
+func (nd *KVNode) tsRuleCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 3 {
+		err := fmt.Errorf("ERR wrong number arguments for '%v' command", string(cmd.Args[0]))
+		return nil, err
+	}
+	ns, _, err := common.ExtractNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	destNs, dest, err := common.ExtractNamesapce(cmd.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	if destNs != ns {
+		return nil, errTSCrossNamespace
+	}
+	args := make([][]byte, len(cmd.Args))
+	copy(args, cmd.Args)
+	args[2] = dest
+	return rebuildFirstKeyAndPropose(nd, buildCommand(args), checkOKRsp)
+}
+
+func writeTSSample(conn redcon.Conn, s rockredis.TSSample) {
+	conn.WriteArray(2)
+	conn.WriteInt64(s.Ts)
+	conn.WriteBulkString(strconv.FormatFloat(s.Value, 'f', -1, 64))
+}
+
+func (nd *KVNode) tsGetCommand(conn redcon.Conn, cmd redcon.Command) {
+	s, err := nd.store.TSGet(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if s == nil {
+		conn.WriteArray(0)
+		return
+	}
+	writeTSSample(conn, *s)
+}
+
+func (nd *KVNode) tsInfoCommand(conn redcon.Conn, cmd redcon.Command) {
+	info, err := nd.store.TSInfo(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	// the keys in the rules are stored without namespace
+	ns, _ := common.GetNamespaceAndPartition(nd.ns)
+	conn.WriteArray(16)
+	conn.WriteString("totalSamples")
+	conn.WriteInt64(info.Samples)
+	conn.WriteString("firstTimestamp")
+	conn.WriteInt64(info.FirstTimestamp)
+	conn.WriteString("lastTimestamp")
+	conn.WriteInt64(info.LastTimestamp)
+	conn.WriteString("retentionTime")
+	conn.WriteInt64(info.Retention)
+	conn.WriteString("chunkDuration")
+	conn.WriteInt64(info.ChunkDuration)
+	conn.WriteString("labels")
+	conn.WriteArray(len(info.Labels))
+	for _, l := range info.Labels {
+		conn.WriteArray(2)
+		conn.WriteBulkString(l.Name)
+		conn.WriteBulkString(l.Value)
+	}
+	conn.WriteString("sourceKey")
+	if len(info.Src) == 0 {
+		conn.WriteNull()
+	} else {
+		conn.WriteBulkString(ns + ":" + string(info.Src))
+	}
+	conn.WriteString("rules")
+	conn.WriteArray(len(info.Rules))
+	for _, r := range info.Rules {
+		conn.WriteArray(3)
+		conn.WriteBulkString(ns + ":" + string(r.Dest))
+		conn.WriteInt64(r.Bucket)
+		conn.WriteBulkString(r.AggType)
+	}
+}
+
+// ts.range key from to [COUNT count] [AGGREGATION type bucket]
+func (nd *KVNode) tsRangeCommand(conn redcon.Conn, cmd redcon.Command) {
+	nd.tsRangeGeneric(conn, cmd, false)
+}
+
+func (nd *KVNode) tsRevRangeCommand(conn redcon.Conn, cmd redcon.Command) {
+	nd.tsRangeGeneric(conn, cmd, true)
+}
+
+func (nd *KVNode) tsRangeGeneric(conn redcon.Conn, cmd redcon.Command, reverse bool) {
+	start, end, err := parseTSRangeTs(cmd.Args[2], cmd.Args[3])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	opts, left, err := parseTSRangeOptions(cmd.Args[4:], reverse)
+	if err == nil && len(left) > 0 {
+		err = errTSSyntax
+	}
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	samples, err := nd.store.TSRange(cmd.Args[1], start, end, opts)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(len(samples))
+	for _, s := range samples {
+		writeTSSample(conn, s)
+	}
+}
+
+func (nd *KVNode) tsKeyExistCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.TSKeyExists(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+func (nd *KVNode) tsttlCommand(conn redcon.Conn, cmd redcon.Command) {
+	if v, err := nd.store.TSTtl(cmd.Args[1]); err != nil {
+		conn.WriteError(err.Error())
+	} else {
+		conn.WriteInt64(v)
+	}
+}
+
+// TSMRangeResults is the ts.mrange results in one partition
+type TSMRangeResults struct {
+	WithLabels bool
+	Rets       []rockredis.TSRangeResult
+}
+
+// usage:
+// TS.MRANGE ns:table from to [COUNT count] [AGGREGATION type bucket] [WITHLABELS] FILTER filter...
+// The filter can be label=value or label!=value, the series in all partitions will be filtered
+// and merged.
+func (nd *KVNode) tsMRangeCommand(cmd redcon.Command) (interface{}, error) {
+	if len(cmd.Args) < 6 {
+		return nil, common.ErrInvalidArgs
+	}
+	table, err := common.CutNamesapce(cmd.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := parseTSRangeTs(cmd.Args[2], cmd.Args[3])
+	if err != nil {
+		return nil, err
+	}
+	reverse := strings.ToLower(string(cmd.Args[0])) == "ts.mrevrange"
+	opts, left, err := parseTSRangeOptions(cmd.Args[4:], reverse)
+	if err != nil {
+		return nil, err
+	}
+	withLabels := false
+	if len(left) > 0 && strings.ToLower(string(left[0])) == "withlabels" {
+		withLabels = true
+		left = left[1:]
+	}
+	if len(left) == 0 || strings.ToLower(string(left[0])) != "filter" {
+		return nil, errTSSyntax
+	}
+	filters, err := parseTSLabelFilters(left[1:])
+	if err != nil {
+		return nil, err
+	}
+	rets, err := nd.store.TSMRange(table, start, end, filters, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &TSMRangeResults{WithLabels: withLabels, Rets: rets}, nil
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"os"
+	"testing"
+
+	"github.com/absolute8511/redcon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKVNode_tsCommand(t *testing.T) {
+	nd, dataDir, stopC := getTestKVNode(t)
+	testKey := []byte("default:test:1")
+	testKey2 := []byte("default:test:2")
+
+	tests := []struct {
+		name string
+		args redcon.Command
+	}{
+		{"ts.create", buildCommand([][]byte{[]byte("ts.create"), testKey, []byte("RETENTION"), []byte("0"),
+			[]byte("LABELS"), []byte("type"), []byte("cpu")})},
+		{"ts.add", buildCommand([][]byte{[]byte("ts.add"), testKey2, []byte("*"), []byte("1.5"), []byte("LABELS"), []byte("type"), []byte("mem")})},
+		{"ts.add", buildCommand([][]byte{[]byte("ts.add"), testKey, []byte("1"), []byte("1")})},
+		{"ts.madd", buildCommand([][]byte{[]byte("ts.madd"), testKey, []byte("2"), []byte("2"), testKey, []byte("3"), []byte("3")})},
+		{"ts.createrule", buildCommand([][]byte{[]byte("ts.createrule"), testKey, testKey2, []byte("AGGREGATION"), []byte("avg"), []byte("10")})},
+		{"ts.get", buildCommand([][]byte{[]byte("ts.get"), testKey})},
+		{"ts.info", buildCommand([][]byte{[]byte("ts.info"), testKey})},
+		{"ts.range", buildCommand([][]byte{[]byte("ts.range"), testKey, []byte("-"), []byte("+")})},
+		{"ts.range", buildCommand([][]byte{[]byte("ts.range"), testKey, []byte("0"), []byte("10"), []byte("COUNT"), []byte("2"),
+			[]byte("AGGREGATION"), []byte("sum"), []byte("2")})},
+		{"ts.revrange", buildCommand([][]byte{[]byte("ts.revrange"), testKey, []byte("-"), []byte("+"), []byte("COUNT"), []byte("1")})},
+		{"ts.deleterule", buildCommand([][]byte{[]byte("ts.deleterule"), testKey, testKey2})},
+		{"ts.keyexist", buildCommand([][]byte{[]byte("ts.keyexist"), testKey})},
+		{"ts.expire", buildCommand([][]byte{[]byte("ts.expire"), testKey, []byte("10")})},
+		{"ts.ttl", buildCommand([][]byte{[]byte("ts.ttl"), testKey})},
+		{"ts.persist", buildCommand([][]byte{[]byte("ts.persist"), testKey})},
+		{"ts.clear", buildCommand([][]byte{[]byte("ts.clear"), testKey})},
+	}
+	defer os.RemoveAll(dataDir)
+	defer nd.Stop()
+	defer close(stopC)
+	c := &fakeRedisConn{}
+	for _, cmd := range tests {
+		c.Reset()
+		origCmd := append([]byte{}, cmd.args.Raw...)
+		handler, ok := nd.router.GetCmdHandler(cmd.name)
+		if ok {
+			handler(c, cmd.args)
+			assert.Nil(t, c.GetError(), cmd.name)
+		} else {
+			whandler, _ := nd.router.GetWCmdHandler(cmd.name)
+			rsp, err := whandler(cmd.args)
+			assert.Nil(t, err, cmd.name)
+			_, ok := rsp.(error)
+			assert.True(t, !ok, cmd.name)
+		}
+		assert.Equal(t, origCmd, cmd.args.Raw)
+	}
+
+	rsp, err := nd.tsMRangeCommand(buildCommand([][]byte{[]byte("ts.mrange"), []byte("default:test"), []byte("-"), []byte("+"),
+		[]byte("WITHLABELS"), []byte("FILTER"), []byte("type=mem")}))
+	assert.Nil(t, err)
+	rets := rsp.(*TSMRangeResults)
+	assert.True(t, rets.WithLabels)
+	assert.Equal(t, 1, len(rets.Rets))
+	assert.Equal(t, "test:2", string(rets.Rets[0].Key))
+	_, err = nd.tsMRangeCommand(buildCommand([][]byte{[]byte("ts.mrange"), []byte("default:test"), []byte("-"), []byte("+"),
+		[]byte("FILTER"), []byte("type")}))
+	assert.NotNil(t, err)
+}
@@ -3,6 +3,7 @@ package node
 import (
 	"errors"
 	"strconv"
+	"strings"
 
 	"github.com/absolute8511/redcon"
 	"github.com/youzan/ZanRedisDB/common"
@@ -11,6 +12,8 @@ import (
 var (
 	expireCmds                [common.ALL - common.NONE][]byte
 	ErrExpiredBatchedBuffFull = errors.New("the expired data batched buffer is full now")
+	errHashFieldsMissing      = errors.New("ERR mandatory argument FIELDS is missing or not at the right position")
+	errHashFieldsNum          = errors.New("ERR the numfields parameter must match the number of arguments")
 )
 
 const (
@@ -44,12 +47,45 @@ func (kvsm *kvStoreSM) localExpireCommand(cmd redcon.Command, ts int64) (interfa
 	}
 }
 
+// parse the fields args in the format: FIELDS numfields field [field ...]
+func parseHashFieldsArgs(args [][]byte) ([][]byte, error) {
+	if len(args) < 3 || strings.ToLower(string(args[0])) != "fields" {
+		return nil, errHashFieldsMissing
+	}
+	num, err := strconv.Atoi(string(args[1]))
+	if err != nil || num <= 0 || num != len(args)-2 {
+		return nil, errHashFieldsNum
+	}
+	return args[2:], nil
+}
+
+// hexpire key seconds [FIELDS numfields field ...]
 func (kvsm *kvStoreSM) localHashExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
-	if duration, err := strconv.Atoi(string(cmd.Args[2])); err != nil {
+	duration, err := strconv.Atoi(string(cmd.Args[2]))
+	if err != nil {
 		return int64(0), err
-	} else {
+	}
+	if len(cmd.Args) == 3 {
 		return kvsm.store.HExpire(ts, cmd.Args[1], int64(duration))
 	}
+	fields, err := parseHashFieldsArgs(cmd.Args[3:])
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.HFieldPExpire(ts, cmd.Args[1], int64(duration)*1000, fields...)
+}
+
+// hpexpire key milliseconds FIELDS numfields field ...
+func (kvsm *kvStoreSM) localHashPExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
+	duration, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := parseHashFieldsArgs(cmd.Args[3:])
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.HFieldPExpire(ts, cmd.Args[1], duration, fields...)
 }
 
 func (kvsm *kvStoreSM) localListExpireCommand(cmd redcon.Command, ts int64) (interface{}, error) {
@@ -88,8 +124,16 @@ func (kvsm *kvStoreSM) localPersistCommand(cmd redcon.Command, ts int64) (interf
 	return kvsm.store.Persist(ts, cmd.Args[1])
 }
 
+// hpersist key [FIELDS numfields field ...]
 func (kvsm *kvStoreSM) localHashPersistCommand(cmd redcon.Command, ts int64) (interface{}, error) {
-	return kvsm.store.HPersist(ts, cmd.Args[1])
+	if len(cmd.Args) == 2 {
+		return kvsm.store.HPersist(ts, cmd.Args[1])
+	}
+	fields, err := parseHashFieldsArgs(cmd.Args[2:])
+	if err != nil {
+		return nil, err
+	}
+	return kvsm.store.HFieldPersist(ts, cmd.Args[1], fields...)
 }
 
 func (kvsm *kvStoreSM) localListPersistCommand(cmd redcon.Command, ts int64) (interface{}, error) {
@@ -117,10 +161,46 @@ func (nd *KVNode) ttlCommand(conn redcon.Conn, cmd redcon.Command) {
 	}
 }
 
+// httl key [FIELDS numfields field ...]
 func (nd *KVNode) httlCommand(conn redcon.Conn, cmd redcon.Command) {
-	if v, err := nd.store.HashTtl(cmd.Args[1]); err != nil {
+	if len(cmd.Args) == 2 {
+		if v, err := nd.store.HashTtl(cmd.Args[1]); err != nil {
+			conn.WriteError(err.Error())
+		} else {
+			conn.WriteInt64(v)
+		}
+		return
+	}
+	fields, err := parseHashFieldsArgs(cmd.Args[2:])
+	if err != nil {
 		conn.WriteError(err.Error())
-	} else {
+		return
+	}
+	vals, err := nd.store.HFieldTTL(cmd.Args[1], fields...)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(len(vals))
+	for _, v := range vals {
+		conn.WriteInt64(v)
+	}
+}
+
+// hpttl key FIELDS numfields field ...
+func (nd *KVNode) hpttlCommand(conn redcon.Conn, cmd redcon.Command) {
+	fields, err := parseHashFieldsArgs(cmd.Args[2:])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	vals, err := nd.store.HFieldPTTL(cmd.Args[1], fields...)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	conn.WriteArray(len(vals))
+	for _, v := range vals {
 		conn.WriteInt64(v)
 	}
 }
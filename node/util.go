@@ -66,6 +66,22 @@ func checkAndRewriteIntRsp(cmd redcon.Command, v interface{}) (interface{}, erro
 	return nil, errInvalidResponse
 }
 
+// the response may be int64 for the key or []int64 for the sub keys
+func checkAndRewriteIntArrayRsp(cmd redcon.Command, v interface{}) (interface{}, error) {
+	switch rsp := v.(type) {
+	case int64, []int64:
+		return rsp, nil
+	}
+	return nil, errInvalidResponse
+}
+
+func checkAndRewriteBulkArrayRsp(cmd redcon.Command, v interface{}) (interface{}, error) {
+	if rsp, ok := v.([][]byte); ok {
+		return rsp, nil
+	}
+	return nil, errInvalidResponse
+}
+
 func checkAndRewriteBulkRsp(cmd redcon.Command, v interface{}) (interface{}, error) {
 	if v == nil {
 		return nil, nil
@@ -86,7 +102,10 @@ func rebuildFirstKeyAndPropose(kvn *KVNode, cmd redcon.Command, f common.Command
 
 	var rsp *FutureRsp
 	var err error
-	if !UseRedisV2 {
+	if len(cmd.Raw) > proposeStageChunkSize {
+		// split the large write to avoid the large raft entry
+		rsp, err = kvn.proposeStaged(cmd)
+	} else if !UseRedisV2 {
 		var key []byte
 		key, err = common.CutNamesapce(cmd.Args[1])
 		if err != nil {
@@ -236,7 +255,7 @@ func wrapWriteCommandKK(kvn *KVNode, f common.CommandRspFunc) common.WriteComman
 		copy(cmd.Raw[0:], ncmd.Raw[:])
 		cmd.Raw = cmd.Raw[:len(ncmd.Raw)]
 
-		rsp, err := kvn.RedisProposeAsync(cmd.Raw)
+		rsp, err := kvn.redisProposeMaybeStaged(cmd)
 		if err != nil {
 			return nil, err
 		}
@@ -349,7 +368,7 @@ func wrapWriteCommandKVKV(kvn *KVNode, f common.CommandRspFunc) common.WriteComm
 		copy(cmd.Raw[0:], ncmd.Raw[:])
 		cmd.Raw = cmd.Raw[:len(ncmd.Raw)]
 
-		rsp, err := kvn.RedisProposeAsync(cmd.Raw)
+		rsp, err := kvn.redisProposeMaybeStaged(cmd)
 		if err != nil {
 			return nil, err
 		}
@@ -425,7 +444,11 @@ func wrapWriteMergeCommandKK(kvn *KVNode, f common.MergeWriteCommandFunc) common
 			args[i] = key
 		}
 		ncmd := buildCommand(cmd.Args)
-		rsp, err := kvn.RedisPropose(ncmd.Raw)
+		fr, err := kvn.redisProposeMaybeStaged(ncmd)
+		if err != nil {
+			return nil, err
+		}
+		rsp, err := fr.WaitRsp()
 		if err != nil {
 			return nil, err
 		}
@@ -456,8 +479,11 @@ func wrapWriteMergeCommandKVKV(kvn *KVNode, f common.MergeWriteCommandFunc) comm
 			args[i] = key
 		}
 		ncmd := buildCommand(cmd.Args)
-
-		rsp, err := kvn.RedisPropose(ncmd.Raw)
+		fr, err := kvn.redisProposeMaybeStaged(ncmd)
+		if err != nil {
+			return nil, err
+		}
+		rsp, err := fr.WaitRsp()
 		if err != nil {
 			return nil, err
 		}
@@ -91,10 +91,19 @@ func (s *Server) initHttpHandler() {
 	router.Handle("DELETE", "/cluster/partition/remove_node", common.Decorate(s.doClusterNamespacePartRemoveNode, log, common.V1))
 	router.Handle("POST", "/cluster/upgrade/begin", common.Decorate(s.doClusterBeginUpgrade, log, common.V1))
 	router.Handle("POST", "/cluster/upgrade/done", common.Decorate(s.doClusterFinishUpgrade, log, common.V1))
+	router.Handle("POST", "/cluster/engine/migrate/begin", common.Decorate(s.doBeginEngineMigrate, log, common.V1))
+	router.Handle("POST", "/cluster/engine/migrate/done", common.Decorate(s.doFinishEngineMigrate, log, common.V1))
+	router.Handle("GET", "/cluster/engine/migrate/state", common.Decorate(s.getEngineMigrateState, log, common.V1))
 	router.Handle("POST", "/cluster/namespace/create", common.Decorate(s.doCreateNamespace, log, common.V1))
 	router.Handle("DELETE", "/cluster/namespace/delete", common.Decorate(s.doDeleteNamespace, log, common.V1))
 	router.Handle("POST", "/cluster/schema/index/add", common.Decorate(s.doAddIndexSchema, log, common.V1))
 	router.Handle("DELETE", "/cluster/schema/index/del", common.Decorate(s.doDelIndexSchema, log, common.V1))
+	router.Handle("GET", "/cluster/schema/index/progress", common.Decorate(s.getIndexJobsProgress, debugLog, common.V1))
+	router.Handle("POST", "/cluster/schema/index/throttle", common.Decorate(s.doSetIndexJobThrottle, log, common.V1))
+	router.Handle("POST", "/cluster/schema/index/cancel", common.Decorate(s.doCancelIndexBuild, log, common.V1))
+	router.Handle("POST", "/cluster/schema/index/verify", common.Decorate(s.doVerifyIndex, log, common.V1))
+	router.Handle("POST", "/cluster/schema/table/set", common.Decorate(s.doSetTableSchema, log, common.V1))
+	router.Handle("DELETE", "/cluster/schema/table/del", common.Decorate(s.doDelTableSchema, log, common.V1))
 	router.Handle("POST", "/cluster/namespace/meta/update", common.Decorate(s.doUpdateNamespaceMeta, log, common.V1))
 	router.Handle("POST", "/stable/nodenum", common.Decorate(s.doSetStableNodeNum, log, common.V1))
 
@@ -263,12 +272,16 @@ func (s *Server) doQueryNamespace(w http.ResponseWriter, req *http.Request, ps h
 	ex := ""
 	useFsync := false
 	engType := ""
+	partKeyVer := ""
+	partKeyRegex := ""
 	for _, nsInfo := range nsPartsInfo {
 		pnum = nsInfo.PartitionNum
 		replicator = nsInfo.Replica
 		ex = nsInfo.ExpirationPolicy
 		useFsync = nsInfo.OptimizedFsync
 		engType = nsInfo.EngType
+		partKeyVer = nsInfo.PartitionKeyVersion
+		partKeyRegex = nsInfo.PartitionKeyRegex
 		var pn PartitionNodeInfo
 		for _, nid := range nsInfo.RaftNodes {
 			n, ok := dns[nid]
@@ -303,14 +316,18 @@ func (s *Server) doQueryNamespace(w http.ResponseWriter, req *http.Request, ps h
 		}
 		partNodes[nsInfo.Partition] = pn
 	}
+	// the client should route the key to the partition by the partition key version
+	// and regex, see common.GetPartitionKeyHashSum
 	return map[string]interface{}{
-		"epoch":           curEpoch,
-		"partition_num":   pnum,
-		"replicator":      replicator,
-		"expire_policy":   ex,
-		"fsync_optimized": useFsync,
-		"eng_type":        engType,
-		"partitions":      partNodes,
+		"epoch":                 curEpoch,
+		"partition_num":         pnum,
+		"replicator":            replicator,
+		"expire_policy":         ex,
+		"fsync_optimized":       useFsync,
+		"eng_type":              engType,
+		"partition_key_version": partKeyVer,
+		"partition_key_regex":   partKeyRegex,
+		"partitions":            partNodes,
 	}, nil
 }
 
@@ -436,6 +453,45 @@ func (s *Server) doClusterFinishUpgrade(w http.ResponseWriter, req *http.Request
 	return nil, nil
 }
 
+func (s *Server) doBeginEngineMigrate(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	nid := reqParams.Get("node")
+	if nid == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NODE"}
+	}
+	err = s.pdCoord.BeginEngineMigrate(nid)
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doFinishEngineMigrate(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	nid := reqParams.Get("node")
+	if nid == "" {
+		return nil, common.HttpErr{Code: 400, Text: "MISSING_ARG_NODE"}
+	}
+	err = s.pdCoord.FinishEngineMigrate(nid)
+	if err != nil {
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) getEngineMigrateState(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	return map[string]interface{}{
+		"migrating_node": s.pdCoord.GetEngineMigratingNode(),
+		"stable":         s.pdCoord.IsClusterStable(),
+	}, nil
+}
+
 func (s *Server) doCreateNamespace(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -492,6 +548,12 @@ func (s *Server) doCreateNamespace(w http.ResponseWriter, req *http.Request, ps
 		}
 	}
 
+	partKeyVer := reqParams.Get("partition_key_version")
+	partKeyRegex := reqParams.Get("partition_key_regex")
+	if _, err := common.NewPartitionKeyExtractor(partKeyVer, partKeyRegex); err != nil {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_PARTITION_KEY_VERSION " + err.Error()}
+	}
+
 	tagStr := reqParams.Get("tags")
 	var tagList []string
 	if tagStr != "" {
@@ -512,6 +574,10 @@ func (s *Server) doCreateNamespace(w http.ResponseWriter, req *http.Request, ps
 	meta.EngType = engType
 	meta.ExpirationPolicy = expPolicy
 	meta.DataVersion = dataVersion
+	meta.PartitionKeyVersion = partKeyVer
+	if partKeyVer == common.RegexPartitionKeyV1Str {
+		meta.PartitionKeyRegex = partKeyRegex
+	}
 	meta.Tags = make(map[string]interface{})
 	for _, tag := range tagList {
 		if strings.TrimSpace(tag) != "" {
@@ -601,8 +667,60 @@ func (s *Server) doAddIndexSchema(w http.ResponseWriter, req *http.Request, ps h
 			sLog.Infof("add hash index failed: %v, %v", ns, err)
 			return nil, common.HttpErr{Code: 500, Text: err.Error()}
 		}
+	} else if indexType == "fulltext" {
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			sLog.Infof("read schema body error: %v, %v, %v", ns, table, err)
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+		var meta common.FullTextIndexSchema
+		err = json.Unmarshal(data, &meta)
+		if err != nil {
+			sLog.Infof("schema body unmarshal error: %v, %v, %v", ns, table, err)
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+		sLog.Infof("add full text index : %v, %v", ns, meta)
+		err = s.pdCoord.AddFullTextIndexSchema(ns, table, &meta)
+		if err != nil {
+			sLog.Infof("add full text index failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 500, Text: err.Error()}
+		}
+	} else if indexType == "columnar" {
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			sLog.Infof("read schema body error: %v, %v, %v", ns, table, err)
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+		var meta common.ColumnTableSchema
+		err = json.Unmarshal(data, &meta)
+		if err != nil {
+			sLog.Infof("schema body unmarshal error: %v, %v, %v", ns, table, err)
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+		sLog.Infof("add column table : %v, %v", ns, meta)
+		err = s.pdCoord.AddColumnTableSchema(ns, table, &meta)
+		if err != nil {
+			sLog.Infof("add column table failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 500, Text: err.Error()}
+		}
 	} else if indexType == "json_secondary" {
-		return nil, common.HttpErr{Code: 400, Text: "unsupported index type"}
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			sLog.Infof("read schema body error: %v, %v, %v", ns, table, err)
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+		var meta common.JSONIndexSchema
+		err = json.Unmarshal(data, &meta)
+		if err != nil {
+			sLog.Infof("schema body unmarshal error: %v, %v, %v", ns, table, err)
+			return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+		}
+		sLog.Infof("add json index : %v, %v", ns, meta)
+		err = s.pdCoord.AddJSONIndexSchema(ns, table, &meta)
+		if err != nil {
+			sLog.Infof("add json index failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 500, Text: err.Error()}
+		}
 	} else {
 		return nil, common.HttpErr{Code: 400, Text: "unsupported index type"}
 	}
@@ -651,8 +769,27 @@ func (s *Server) doDelIndexSchema(w http.ResponseWriter, req *http.Request, ps h
 			sLog.Infof("del hash index failed: %v, %v", ns, err)
 			return nil, common.HttpErr{Code: 500, Text: err.Error()}
 		}
+	} else if indexType == "fulltext" {
+		sLog.Infof("del full text index : %v, %v", ns, indexName)
+		err = s.pdCoord.DelFullTextIndexSchema(ns, table, indexName)
+		if err != nil {
+			sLog.Infof("del full text index failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 500, Text: err.Error()}
+		}
+	} else if indexType == "columnar" {
+		sLog.Infof("del column table : %v, %v", ns, indexName)
+		err = s.pdCoord.DelColumnTableSchema(ns, table, indexName)
+		if err != nil {
+			sLog.Infof("del column table failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 500, Text: err.Error()}
+		}
 	} else if indexType == "json_secondary" {
-		return nil, common.HttpErr{Code: 400, Text: "unsupported index type"}
+		sLog.Infof("del json index : %v, %v", ns, indexName)
+		err = s.pdCoord.DelJSONIndexSchema(ns, table, indexName)
+		if err != nil {
+			sLog.Infof("del json index failed: %v, %v", ns, err)
+			return nil, common.HttpErr{Code: 500, Text: err.Error()}
+		}
 	} else {
 		return nil, common.HttpErr{Code: 400, Text: "unsupported index type"}
 	}
@@ -660,6 +797,152 @@ func (s *Server) doDelIndexSchema(w http.ResponseWriter, req *http.Request, ps h
 	return nil, nil
 }
 
+// parse the namespace, table and index name for the index jobs, the table and index name
+// are required only if needed.
+func parseIndexJobParams(req *http.Request, needTable bool, needIndex bool) (url.Values, string, string, string, error) {
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, "", "", "", common.HttpErr{Code: 400, Text: "INVALID_REQUEST"}
+	}
+	ns := reqParams.Get("namespace")
+	if ns == "" {
+		return nil, "", "", "", common.HttpErr{Code: 400, Text: "MISSING_ARG_NAMESPACE"}
+	}
+	if !common.IsValidNamespaceName(ns) {
+		return nil, "", "", "", common.HttpErr{Code: 400, Text: "INVALID_ARG_NAMESPACE"}
+	}
+	table := reqParams.Get("table")
+	if needTable && table == "" {
+		return nil, "", "", "", common.HttpErr{Code: 400, Text: "MISSING_ARG_TABLE_NAME"}
+	}
+	indexName := reqParams.Get("indexname")
+	if needIndex && indexName == "" {
+		return nil, "", "", "", common.HttpErr{Code: 400, Text: "MISSING_ARG_INDEX_NAME"}
+	}
+	return reqParams, ns, table, indexName, nil
+}
+
+// get the progress of the index build and verify jobs on all the replicas of all the partitions
+func (s *Server) getIndexJobsProgress(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	_, ns, table, _, err := parseIndexJobParams(req, false, false)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := s.pdCoord.GetIndexJobs(ns, table)
+	if err != nil {
+		sLog.Infof("get index jobs failed: %v, %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return jobs, nil
+}
+
+// the rate is the max keys scanned per second in each partition, 0 means no limit.
+func (s *Server) doSetIndexJobThrottle(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, ns, _, _, err := parseIndexJobParams(req, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	rate, err := strconv.ParseInt(reqParams.Get("rate"), 10, 64)
+	if err != nil || rate < 0 {
+		return nil, common.HttpErr{Code: 400, Text: "INVALID_ARG_RATE"}
+	}
+	paused := reqParams.Get("pause") == "true"
+	sLog.Infof("set index job throttle : %v, %v, paused: %v", ns, rate, paused)
+	err = s.pdCoord.SetIndexJobThrottle(ns, rate, paused)
+	if err != nil {
+		sLog.Infof("set index job throttle failed: %v, %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doCancelIndexBuild(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	_, ns, table, indexName, err := parseIndexJobParams(req, true, true)
+	if err != nil {
+		return nil, err
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	sLog.Infof("cancel hash index build : %v, %v, %v", ns, table, indexName)
+	err = s.pdCoord.CancelHIndexBuild(ns, table, indexName)
+	if err != nil {
+		sLog.Infof("cancel hash index build failed: %v, %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+// start the verify job on all the replicas, the missing and stale index entries
+// will be repaired if repair=true.
+func (s *Server) doVerifyIndex(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	reqParams, ns, table, indexName, err := parseIndexJobParams(req, true, true)
+	if err != nil {
+		return nil, err
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	repair := reqParams.Get("repair") == "true"
+	sLog.Infof("verify hash index : %v, %v, %v, repair: %v", ns, table, indexName, repair)
+	err = s.pdCoord.VerifyHIndex(ns, table, indexName, repair)
+	if err != nil {
+		sLog.Infof("verify hash index failed: %v, %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+// set the declared fields of the table, the body is the json of the table schema,
+// the writes to the table will be validated after the schema synced to the partitions.
+func (s *Server) doSetTableSchema(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	_, ns, table, _, err := parseIndexJobParams(req, true, false)
+	if err != nil {
+		return nil, err
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		sLog.Infof("read schema body error: %v, %v, %v", ns, table, err)
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	var meta common.TableSchema
+	err = json.Unmarshal(data, &meta)
+	if err != nil {
+		sLog.Infof("schema body unmarshal error: %v, %v, %v", ns, table, err)
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	sLog.Infof("set table schema : %v, %v, %v", ns, table, string(data))
+	err = s.pdCoord.SetTableSchema(ns, table, &meta)
+	if err != nil {
+		sLog.Infof("set table schema failed: %v, %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *Server) doDelTableSchema(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	_, ns, table, _, err := parseIndexJobParams(req, true, false)
+	if err != nil {
+		return nil, err
+	}
+	if !s.pdCoord.IsMineLeader() {
+		return nil, common.HttpErr{Code: 400, Text: cluster.ErrFailedOnNotLeader}
+	}
+	sLog.Infof("del table schema : %v, %v", ns, table)
+	err = s.pdCoord.DelTableSchema(ns, table)
+	if err != nil {
+		sLog.Infof("del table schema failed: %v, %v", ns, err)
+		return nil, common.HttpErr{Code: 500, Text: err.Error()}
+	}
+	return nil, nil
+}
+
 func (s *Server) doUpdateNamespaceMeta(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	reqParams, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -0,0 +1,125 @@
+// Package encryption implements the at-rest encryption for the engine data and the raft logs.
+// The data is encrypted by AES-GCM with the data keys, and the data keys are stored in the
+// key store file wrapped by the master key loaded from a local file or a kms.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	MasterKeyTypeFile     = "file"
+	MasterKeyTypeLocalKMS = "local_kms"
+
+	dataKeyLen = 32
+	// 0x00 is never the first byte of the protobuf message, so the encrypted raft
+	// entry can be detected
+	magic0        = 0x00
+	magic1        = 0xec
+	formatVersion = 0x01
+	// the random marker of the key store generated while the encryption enabled, the plain
+	// data written before can not be taken as the encrypted data since it has no marker.
+	markerLen = 8
+	// magic, version, marker, key id and nonce
+	headerLen = 2 + 1 + markerLen + 4 + 12
+	// Overhead is the length added to the encrypted data
+	Overhead = headerLen + 16
+)
+
+var (
+	ErrNotEncrypted    = errors.New("encryption: data not encrypted")
+	ErrDataKeyNotFound = errors.New("encryption: data key not found")
+	ErrInvalidKey      = errors.New("encryption: invalid key")
+	ErrInvalidKeyStore = errors.New("encryption: invalid key store")
+)
+
+type Config struct {
+	// the type of the master key: file or local_kms, the encryption is disabled if empty
+	MasterKeyType string `json:"master_key_type"`
+	// the file with the hex encoded 32 bytes master key for the file type, or the
+	// key file of the local kms
+	MasterKeyFile string `json:"master_key_file"`
+	// the key id of the master key in the kms
+	KMSKeyID string `json:"kms_key_id"`
+	// rotate the data keys older than the days, no rotation if 0
+	DataKeyRotateDays int `json:"data_key_rotate_days"`
+}
+
+func (c *Config) Enabled() bool {
+	return c.MasterKeyType != ""
+}
+
+// IsEncrypted check whether the data is in the encrypted format, the marker should be
+// checked by the key store if the plain data may be in the same format.
+func IsEncrypted(data []byte) bool {
+	return len(data) >= Overhead && data[0] == magic0 && data[1] == magic1 && data[2] == formatVersion
+}
+
+func isEncryptedWithMarker(data []byte, marker []byte) bool {
+	return IsEncrypted(data) && bytes.Equal(data[3:3+markerLen], marker)
+}
+
+func encryptedKeyID(data []byte) uint32 {
+	return binary.BigEndian.Uint32(data[3+markerLen : 7+markerLen])
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != dataKeyLen {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newRandomKey() ([]byte, error) {
+	key := make([]byte, dataKeyLen)
+	_, err := io.ReadFull(rand.Reader, key)
+	return key, err
+}
+
+// seal the plain data as: nonce | encrypted data | tag, and append it to dst
+func seal(aead cipher.AEAD, dst []byte, plain []byte, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plain, ad), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, ad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidKey
+	}
+	nonce := sealed[:aead.NonceSize()]
+	return aead.Open(nil, nonce, sealed[aead.NonceSize():], ad)
+}
+
+// encrypt the data with the data key as: magic | version | marker | key id | nonce | encrypted data | tag
+func encryptData(aead cipher.AEAD, marker []byte, keyID uint32, plain []byte, ad []byte) ([]byte, error) {
+	dst := make([]byte, 7+markerLen, Overhead+len(plain))
+	dst[0] = magic0
+	dst[1] = magic1
+	dst[2] = formatVersion
+	copy(dst[3:3+markerLen], marker)
+	binary.BigEndian.PutUint32(dst[3+markerLen:7+markerLen], keyID)
+	return seal(aead, dst, plain, ad)
+}
+
+func decryptData(aead cipher.AEAD, data []byte, ad []byte) ([]byte, error) {
+	return open(aead, data[7+markerLen:], ad)
+}
+
+func daysToDuration(days int) time.Duration {
+	return time.Duration(days) * time.Hour * 24
+}
@@ -0,0 +1,220 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestMasterKey(t *testing.T, dir string, name string) string {
+	key, err := newRandomKey()
+	assert.Nil(t, err)
+	fileName := path.Join(dir, name)
+	err = ioutil.WriteFile(fileName, []byte(hex.EncodeToString(key)+"\n"), 0600)
+	assert.Nil(t, err)
+	return fileName
+}
+
+func TestFileMasterKey(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encryption")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	mk, err := NewMasterKey(Config{
+		MasterKeyType: MasterKeyTypeFile,
+		MasterKeyFile: writeTestMasterKey(t, tmpDir, "master.key"),
+	})
+	assert.Nil(t, err)
+	wrapped, err := mk.Wrap([]byte("data key"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, []byte("data key"), wrapped)
+	plain, err := mk.Unwrap(wrapped)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data key"), plain)
+
+	other, err := LoadFileMasterKey(writeTestMasterKey(t, tmpDir, "other.key"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, mk.ID(), other.ID())
+	_, err = other.Unwrap(wrapped)
+	assert.Equal(t, errWrongMasterKey, err)
+
+	invalid := path.Join(tmpDir, "invalid.key")
+	err = ioutil.WriteFile(invalid, []byte("abcd"), 0600)
+	assert.Nil(t, err)
+	_, err = LoadFileMasterKey(invalid)
+	assert.NotNil(t, err)
+	_, err = NewMasterKey(Config{MasterKeyType: "unknown"})
+	assert.NotNil(t, err)
+}
+
+func TestLocalKMSRotate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encryption")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	cfg := Config{
+		MasterKeyType: MasterKeyTypeLocalKMS,
+		MasterKeyFile: path.Join(tmpDir, "kms.keys"),
+		KMSKeyID:      "test-key",
+	}
+	km, err := NewKeyManager(cfg)
+	assert.Nil(t, err)
+	ksFile := path.Join(tmpDir, KeyStoreFileName)
+	ks, err := km.OpenKeyStore(ksFile)
+	assert.Nil(t, err)
+	enc, err := ks.Encrypt([]byte("value"), []byte("key"))
+	assert.Nil(t, err)
+	oldID := ks.data.MasterKeyID
+
+	kms, err := OpenLocalKMS(cfg.MasterKeyFile)
+	assert.Nil(t, err)
+	err = kms.RotateKey(cfg.KMSKeyID)
+	assert.Nil(t, err)
+	ver, err := kms.KeyVersion(cfg.KMSKeyID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, ver)
+
+	// the data keys should be wrapped by the new version of the kms key after reopen
+	km, err = NewKeyManager(cfg)
+	assert.Nil(t, err)
+	ks, err = km.OpenKeyStore(ksFile)
+	assert.Nil(t, err)
+	assert.NotEqual(t, oldID, ks.data.MasterKeyID)
+	plain, err := ks.Decrypt(enc, []byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), plain)
+
+	_, err = NewKeyManager(Config{MasterKeyType: MasterKeyTypeLocalKMS, MasterKeyFile: cfg.MasterKeyFile})
+	assert.NotNil(t, err)
+}
+
+func TestKeyStoreEncrypt(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encryption")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	km, err := NewKeyManager(Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, km)
+	km, err = NewKeyManager(Config{
+		MasterKeyType: MasterKeyTypeFile,
+		MasterKeyFile: writeTestMasterKey(t, tmpDir, "master.key"),
+	})
+	assert.Nil(t, err)
+	ksFile := path.Join(tmpDir, KeyStoreFileName)
+	_, err = km.LoadKeyStore(ksFile)
+	assert.True(t, os.IsNotExist(err))
+	ks, err := km.OpenKeyStore(ksFile)
+	assert.Nil(t, err)
+	assert.True(t, ks.IsReEncrypted())
+
+	enc, err := ks.Encrypt([]byte("value"), []byte("key"))
+	assert.Nil(t, err)
+	assert.True(t, IsEncrypted(enc))
+	assert.Equal(t, len("value")+Overhead, len(enc))
+	assert.False(t, IsEncrypted([]byte("value")))
+	plain, err := ks.Decrypt(enc, []byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), plain)
+	// the additional data is authenticated
+	_, err = ks.Decrypt(enc, []byte("key2"))
+	assert.NotNil(t, err)
+	_, err = ks.Decrypt([]byte("value"), []byte("key"))
+	assert.Equal(t, ErrNotEncrypted, err)
+	assert.True(t, ks.IsEncrypted(enc))
+	// the plain data in the same format without the marker of the key store
+	plainLikeEnc := append([]byte{magic0, magic1, formatVersion}, make([]byte, Overhead)...)
+	assert.True(t, IsEncrypted(plainLikeEnc))
+	assert.False(t, ks.IsEncrypted(plainLikeEnc))
+	_, err = ks.Decrypt(plainLikeEnc, []byte("key"))
+	assert.Equal(t, ErrNotEncrypted, err)
+	enc[len(enc)-1]++
+	_, err = ks.Decrypt(enc, []byte("key"))
+	assert.NotNil(t, err)
+	enc[len(enc)-1]--
+
+	// the data key should be loaded again from the file
+	ks2, err := km.LoadKeyStore(ksFile)
+	assert.Nil(t, err)
+	plain, err = ks2.Decrypt(enc, []byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), plain)
+	// the new key store should have a different marker
+	ks3, err := km.OpenKeyStore(path.Join(tmpDir, "other.keys"))
+	assert.Nil(t, err)
+	assert.False(t, ks3.IsEncrypted(enc))
+
+	other, err := LoadFileMasterKey(writeTestMasterKey(t, tmpDir, "other.key"))
+	assert.Nil(t, err)
+	_, err = NewKeyManagerWithMasterKey(other, 0).LoadKeyStore(ksFile)
+	assert.Equal(t, errWrongMasterKey, err)
+}
+
+func TestKeyStoreRotate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encryption")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	mk, err := LoadFileMasterKey(writeTestMasterKey(t, tmpDir, "master.key"))
+	assert.Nil(t, err)
+	km := NewKeyManagerWithMasterKey(mk, daysToDuration(1))
+	ksFile := path.Join(tmpDir, KeyStoreFileName)
+	ks, err := km.OpenKeyStore(ksFile)
+	assert.Nil(t, err)
+	rotated, err := ks.RotateIfExpired(km.RotateInterval())
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+
+	var encs [][]byte
+	for i := 0; i < 3; i++ {
+		enc, err := ks.Encrypt([]byte("value"), nil)
+		assert.Nil(t, err)
+		assert.False(t, ks.NeedReEncrypt(enc))
+		encs = append(encs, enc)
+		err = ks.Rotate()
+		assert.Nil(t, err)
+		assert.True(t, ks.NeedReEncrypt(enc))
+		assert.False(t, ks.IsReEncrypted())
+	}
+	rotated, err = ks.RotateIfExpired(0)
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+	rotated, err = ks.RotateIfExpired(-1)
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+	// the old data can be decrypted until the re-encryption finished
+	for _, enc := range encs {
+		plain, err := ks.Decrypt(enc, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"), plain)
+	}
+
+	err = ks.FinishReEncrypt()
+	assert.Nil(t, err)
+	assert.True(t, ks.IsReEncrypted())
+	assert.Equal(t, 2, len(ks.data.Keys))
+	_, err = ks.Decrypt(encs[0], nil)
+	assert.Equal(t, ErrDataKeyNotFound, err)
+	_, err = ks.Decrypt(encs[2], nil)
+	assert.Nil(t, err)
+
+	ks, err = km.LoadKeyStore(ksFile)
+	assert.Nil(t, err)
+	assert.True(t, ks.IsReEncrypted())
+	assert.Equal(t, 2, len(ks.data.Keys))
+	_, err = ks.Decrypt(encs[1], nil)
+	assert.Equal(t, ErrDataKeyNotFound, err)
+
+	// the snapshot copy of the keys
+	cpFile := path.Join(tmpDir, "cp.keys")
+	err = ks.SaveTo(cpFile)
+	assert.Nil(t, err)
+	cp, err := km.LoadKeyStore(cpFile)
+	assert.Nil(t, err)
+	_, err = cp.Decrypt(encs[2], nil)
+	assert.Nil(t, err)
+}
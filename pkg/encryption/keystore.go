@@ -0,0 +1,329 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeyStoreFileName is the name of the key store file saved with the data
+const KeyStoreFileName = "encryption.keys"
+
+type dataKey struct {
+	ID        uint32 `json:"id"`
+	Wrapped   []byte `json:"wrapped"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type keyStoreData struct {
+	MasterKeyID string     `json:"master_key_id"`
+	CurrentID   uint32     `json:"current_id"`
+	Keys        []*dataKey `json:"keys"`
+	// whether all the data encrypted by the old keys has been encrypted again by
+	// the current key
+	ReEncrypted bool `json:"re_encrypted"`
+	// the random marker generated while the key store created, it is written in all
+	// the encrypted data to tell it from the plain data written before
+	Marker []byte `json:"marker"`
+}
+
+// KeyStore keeps the data keys wrapped by the master key in the file. The data is always
+// encrypted by the current data key, and the old keys are kept to decrypt the old data
+// until all the data is encrypted by the new key.
+type KeyStore struct {
+	sync.RWMutex
+	fileName string
+	mk       MasterKey
+	data     keyStoreData
+	aeads    map[uint32]cipher.AEAD
+	// the marker never changed after loaded, so it can be read without lock
+	marker []byte
+}
+
+// KeyManager manages the key stores wrapped by the same master key
+type KeyManager struct {
+	mk             MasterKey
+	rotateInterval time.Duration
+}
+
+// NewKeyManager return nil if the encryption is disabled in the config
+func NewKeyManager(cfg Config) (*KeyManager, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	mk, err := NewMasterKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyManagerWithMasterKey(mk, daysToDuration(cfg.DataKeyRotateDays)), nil
+}
+
+func NewKeyManagerWithMasterKey(mk MasterKey, rotateInterval time.Duration) *KeyManager {
+	return &KeyManager{
+		mk:             mk,
+		rotateInterval: rotateInterval,
+	}
+}
+
+// RotateInterval is the max age of the current data key, 0 means no rotation
+func (km *KeyManager) RotateInterval() time.Duration {
+	return km.rotateInterval
+}
+
+// OpenKeyStore load the data keys from the file, the new key store will be created
+// if the file not exist.
+func (km *KeyManager) OpenKeyStore(fileName string) (*KeyStore, error) {
+	ks, err := km.LoadKeyStore(fileName)
+	if os.IsNotExist(err) {
+		ks = &KeyStore{
+			fileName: fileName,
+			mk:       km.mk,
+			aeads:    make(map[uint32]cipher.AEAD),
+		}
+		ks.data.MasterKeyID = km.mk.ID()
+		ks.data.Marker = make([]byte, markerLen)
+		if _, err := io.ReadFull(rand.Reader, ks.data.Marker); err != nil {
+			return nil, err
+		}
+		ks.marker = ks.data.Marker
+		ks.data.ReEncrypted = true
+		err = ks.newDataKey()
+		if err != nil {
+			return nil, err
+		}
+		return ks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ks.data.MasterKeyID != km.mk.ID() {
+		// the master key changed, wrap all the data keys again
+		err = ks.rewrap()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// LoadKeyStore load the existing key store file, and check all the data keys
+// can be unwrapped by the master key.
+func (km *KeyManager) LoadKeyStore(fileName string) (*KeyStore, error) {
+	d, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	ks := &KeyStore{
+		fileName: fileName,
+		mk:       km.mk,
+		aeads:    make(map[uint32]cipher.AEAD),
+	}
+	err = json.Unmarshal(d, &ks.data)
+	if err != nil {
+		return nil, err
+	}
+	if len(ks.data.Marker) != markerLen {
+		return nil, ErrInvalidKeyStore
+	}
+	ks.marker = ks.data.Marker
+	for _, k := range ks.data.Keys {
+		plain, err := km.mk.Unwrap(k.Wrapped)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := newAEAD(plain)
+		if err != nil {
+			return nil, err
+		}
+		ks.aeads[k.ID] = aead
+	}
+	if _, ok := ks.aeads[ks.data.CurrentID]; !ok {
+		return nil, ErrDataKeyNotFound
+	}
+	return ks, nil
+}
+
+func (ks *KeyStore) rewrap() error {
+	old := ks.data
+	ks.data.MasterKeyID = ks.mk.ID()
+	ks.data.Keys = make([]*dataKey, 0, len(old.Keys))
+	for _, k := range old.Keys {
+		plain, err := ks.mk.Unwrap(k.Wrapped)
+		if err != nil {
+			ks.data = old
+			return err
+		}
+		wrapped, err := ks.mk.Wrap(plain)
+		if err != nil {
+			ks.data = old
+			return err
+		}
+		ks.data.Keys = append(ks.data.Keys, &dataKey{ID: k.ID, Wrapped: wrapped, CreatedAt: k.CreatedAt})
+	}
+	err := ks.save()
+	if err != nil {
+		ks.data = old
+	}
+	return err
+}
+
+// create a new data key as the current key, should be called with the lock held
+func (ks *KeyStore) newDataKey() error {
+	key, err := newRandomKey()
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	wrapped, err := ks.mk.Wrap(key)
+	if err != nil {
+		return err
+	}
+	var id uint32
+	idBuf := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(rand.Reader, idBuf); err != nil {
+			return err
+		}
+		id = binary.BigEndian.Uint32(idBuf)
+		if _, ok := ks.aeads[id]; !ok && id != 0 {
+			break
+		}
+	}
+	old := ks.data
+	ks.data.Keys = append(ks.data.Keys[:len(ks.data.Keys):len(ks.data.Keys)], &dataKey{
+		ID:        id,
+		Wrapped:   wrapped,
+		CreatedAt: time.Now().Unix(),
+	})
+	ks.data.CurrentID = id
+	if len(old.Keys) > 0 {
+		ks.data.ReEncrypted = false
+	}
+	err = ks.save()
+	if err != nil {
+		ks.data = old
+		return err
+	}
+	ks.aeads[id] = aead
+	return nil
+}
+
+func (ks *KeyStore) save() error {
+	return ks.saveTo(ks.fileName)
+}
+
+func (ks *KeyStore) saveTo(fileName string) error {
+	d, err := json.Marshal(ks.data)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fileName, d)
+}
+
+// SaveTo save the copy of the key store to the file, it is used to save the keys
+// with the data snapshot.
+func (ks *KeyStore) SaveTo(fileName string) error {
+	ks.RLock()
+	defer ks.RUnlock()
+	return ks.saveTo(fileName)
+}
+
+// Encrypt the data by the current data key, the additional data is authenticated
+// but not encrypted, and the same additional data is needed while decrypting.
+func (ks *KeyStore) Encrypt(plain []byte, ad []byte) ([]byte, error) {
+	ks.RLock()
+	id := ks.data.CurrentID
+	aead := ks.aeads[id]
+	ks.RUnlock()
+	return encryptData(aead, ks.marker, id, plain, ad)
+}
+
+// IsEncrypted check whether the data is encrypted by this key store, the plain data
+// written before the encryption enabled is never taken as encrypted.
+func (ks *KeyStore) IsEncrypted(data []byte) bool {
+	return isEncryptedWithMarker(data, ks.marker)
+}
+
+func (ks *KeyStore) Decrypt(data []byte, ad []byte) ([]byte, error) {
+	if !ks.IsEncrypted(data) {
+		return nil, ErrNotEncrypted
+	}
+	ks.RLock()
+	aead, ok := ks.aeads[encryptedKeyID(data)]
+	ks.RUnlock()
+	if !ok {
+		return nil, ErrDataKeyNotFound
+	}
+	return decryptData(aead, data, ad)
+}
+
+// NeedReEncrypt check whether the data is encrypted by the old data key
+func (ks *KeyStore) NeedReEncrypt(data []byte) bool {
+	if !ks.IsEncrypted(data) {
+		return false
+	}
+	ks.RLock()
+	defer ks.RUnlock()
+	return encryptedKeyID(data) != ks.data.CurrentID
+}
+
+// IsReEncrypted return false if some data may be still encrypted by the old data keys
+func (ks *KeyStore) IsReEncrypted() bool {
+	ks.RLock()
+	defer ks.RUnlock()
+	return ks.data.ReEncrypted
+}
+
+// Rotate create the new data key as the current key
+func (ks *KeyStore) Rotate() error {
+	ks.Lock()
+	defer ks.Unlock()
+	return ks.newDataKey()
+}
+
+// RotateIfExpired rotate the data key if the current key is older than the interval
+func (ks *KeyStore) RotateIfExpired(interval time.Duration) (bool, error) {
+	if interval <= 0 {
+		return false, nil
+	}
+	ks.Lock()
+	defer ks.Unlock()
+	cur := ks.data.Keys[len(ks.data.Keys)-1]
+	if time.Since(time.Unix(cur.CreatedAt, 0)) < interval {
+		return false, nil
+	}
+	return true, ks.newDataKey()
+}
+
+// FinishReEncrypt should be called after all the data encrypted by the old keys has been
+// encrypted again by the current key. The previous key is kept since the data encrypted
+// by it before the rotation may be written after the re-encryption.
+func (ks *KeyStore) FinishReEncrypt() error {
+	ks.Lock()
+	defer ks.Unlock()
+	old := ks.data
+	keep := 2
+	if len(old.Keys) < keep {
+		keep = len(old.Keys)
+	}
+	ks.data.Keys = old.Keys[len(old.Keys)-keep:]
+	ks.data.ReEncrypted = true
+	err := ks.save()
+	if err != nil {
+		ks.data = old
+		return err
+	}
+	for _, k := range old.Keys[:len(old.Keys)-keep] {
+		delete(ks.aeads, k.ID)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+var errKMSKeyNotFound = errors.New("kms: key not found")
+
+type localKMSData struct {
+	// the hex encoded key versions for each key id, the last one is the current version
+	Keys map[string][]string `json:"keys"`
+}
+
+// LocalKMS is the local stand-in of the kms, all the keys are stored in the local file.
+// The encrypted blob is compatible with the kms which contains the key id and version.
+type LocalKMS struct {
+	sync.Mutex
+	fileName string
+	data     localKMSData
+	aeads    map[string][]cipher.AEAD
+}
+
+// OpenLocalKMS load the keys from the file, the empty kms will be created if the file not exist
+func OpenLocalKMS(fileName string) (*LocalKMS, error) {
+	kms := &LocalKMS{
+		fileName: fileName,
+		aeads:    make(map[string][]cipher.AEAD),
+	}
+	kms.data.Keys = make(map[string][]string)
+	d, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return kms, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(d, &kms.data)
+	if err != nil {
+		return nil, err
+	}
+	if kms.data.Keys == nil {
+		kms.data.Keys = make(map[string][]string)
+	}
+	for keyID, vers := range kms.data.Keys {
+		for _, v := range vers {
+			key, err := hex.DecodeString(v)
+			if err != nil {
+				return nil, fmt.Errorf("kms: invalid key %v: %v", keyID, err)
+			}
+			aead, err := newAEAD(key)
+			if err != nil {
+				return nil, fmt.Errorf("kms: invalid key %v: %v", keyID, err)
+			}
+			kms.aeads[keyID] = append(kms.aeads[keyID], aead)
+		}
+	}
+	return kms, nil
+}
+
+// CreateKey create the key if not exist
+func (kms *LocalKMS) CreateKey(keyID string) error {
+	kms.Lock()
+	defer kms.Unlock()
+	if _, ok := kms.aeads[keyID]; ok {
+		return nil
+	}
+	return kms.newKeyVersion(keyID)
+}
+
+// RotateKey add the new version of the key, the data encrypted by the old
+// versions can still be decrypted.
+func (kms *LocalKMS) RotateKey(keyID string) error {
+	kms.Lock()
+	defer kms.Unlock()
+	if _, ok := kms.aeads[keyID]; !ok {
+		return errKMSKeyNotFound
+	}
+	return kms.newKeyVersion(keyID)
+}
+
+func (kms *LocalKMS) newKeyVersion(keyID string) error {
+	key, err := newRandomKey()
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	old := kms.data.Keys[keyID]
+	kms.data.Keys[keyID] = append(old, hex.EncodeToString(key))
+	err = kms.save()
+	if err != nil {
+		kms.data.Keys[keyID] = old
+		return err
+	}
+	kms.aeads[keyID] = append(kms.aeads[keyID], aead)
+	return nil
+}
+
+func (kms *LocalKMS) save() error {
+	d, err := json.Marshal(kms.data)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(kms.fileName, d)
+}
+
+func (kms *LocalKMS) KeyVersion(keyID string) (int, error) {
+	kms.Lock()
+	defer kms.Unlock()
+	vers, ok := kms.aeads[keyID]
+	if !ok {
+		return 0, errKMSKeyNotFound
+	}
+	return len(vers), nil
+}
+
+func blobAD(keyID string, ver uint32) []byte {
+	return []byte(fmt.Sprintf("%v:%v", keyID, ver))
+}
+
+// Encrypt the data as: key id length | key id | version | nonce | encrypted data | tag
+func (kms *LocalKMS) Encrypt(keyID string, plain []byte) ([]byte, error) {
+	if len(keyID) > 255 {
+		return nil, ErrInvalidKey
+	}
+	kms.Lock()
+	vers, ok := kms.aeads[keyID]
+	kms.Unlock()
+	if !ok {
+		return nil, errKMSKeyNotFound
+	}
+	ver := uint32(len(vers))
+	blob := make([]byte, 0, 1+len(keyID)+4+Overhead+len(plain))
+	blob = append(blob, byte(len(keyID)))
+	blob = append(blob, keyID...)
+	blob = append(blob, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(blob[len(blob)-4:], ver)
+	return seal(vers[ver-1], blob, plain, blobAD(keyID, ver))
+}
+
+func (kms *LocalKMS) Decrypt(blob []byte) ([]byte, error) {
+	if len(blob) < 1 || len(blob) < 1+int(blob[0])+4 {
+		return nil, ErrInvalidKey
+	}
+	keyID := string(blob[1 : 1+int(blob[0])])
+	blob = blob[1+int(blob[0]):]
+	ver := binary.BigEndian.Uint32(blob[:4])
+	kms.Lock()
+	vers := kms.aeads[keyID]
+	kms.Unlock()
+	if ver == 0 || int(ver) > len(vers) {
+		return nil, errKMSKeyNotFound
+	}
+	return open(vers[ver-1], blob[4:], blobAD(keyID, ver))
+}
+
+// write to the temp file and rename it, so the file will not be broken if crashed while writing
+func writeFileAtomic(fileName string, d []byte) error {
+	tmpFile := fileName + ".tmp"
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(d)
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, fileName)
+}
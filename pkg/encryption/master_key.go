@@ -0,0 +1,128 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+var errWrongMasterKey = errors.New("encryption: the data key is not wrapped by the master key")
+
+// MasterKey is used to wrap the data keys stored in the key store
+type MasterKey interface {
+	// ID identify the master key, the data keys will be wrapped again if the id changed
+	ID() string
+	Wrap(plain []byte) ([]byte, error)
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+func NewMasterKey(cfg Config) (MasterKey, error) {
+	switch cfg.MasterKeyType {
+	case MasterKeyTypeFile:
+		return LoadFileMasterKey(cfg.MasterKeyFile)
+	case MasterKeyTypeLocalKMS:
+		if cfg.KMSKeyID == "" {
+			return nil, errors.New("encryption: kms key id is required")
+		}
+		kms, err := OpenLocalKMS(cfg.MasterKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		// the local kms will create the key at the first time
+		err = kms.CreateKey(cfg.KMSKeyID)
+		if err != nil {
+			return nil, err
+		}
+		return NewKMSMasterKey(kms, cfg.KMSKeyID)
+	}
+	return nil, fmt.Errorf("encryption: unknown master key type: %v", cfg.MasterKeyType)
+}
+
+// the master key loaded from the local file
+type fileMasterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// LoadFileMasterKey load the hex encoded 32 bytes master key from the file,
+// the key can be generated by: openssl rand -hex 32
+func LoadFileMasterKey(fileName string) (MasterKey, error) {
+	d, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(d)))
+	if err != nil {
+		return nil, fmt.Errorf("encryption: invalid master key file %v: %v", fileName, err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: invalid master key file %v: %v", fileName, err)
+	}
+	h := sha256.Sum256(key)
+	return &fileMasterKey{
+		id:   "file:" + hex.EncodeToString(h[:8]),
+		aead: aead,
+	}, nil
+}
+
+func (mk *fileMasterKey) ID() string {
+	return mk.id
+}
+
+func (mk *fileMasterKey) Wrap(plain []byte) ([]byte, error) {
+	return seal(mk.aead, nil, plain, []byte(mk.id))
+}
+
+func (mk *fileMasterKey) Unwrap(wrapped []byte) ([]byte, error) {
+	plain, err := open(mk.aead, wrapped, []byte(mk.id))
+	if err != nil {
+		return nil, errWrongMasterKey
+	}
+	return plain, nil
+}
+
+// KMS is the key management service to encrypt the data keys, the key material of the
+// master key never leaves the kms.
+type KMS interface {
+	// encrypt the data with the current version of the key
+	Encrypt(keyID string, plain []byte) ([]byte, error)
+	// decrypt the data encrypted by any version of the key
+	Decrypt(blob []byte) ([]byte, error)
+	// return the current version of the key
+	KeyVersion(keyID string) (int, error)
+}
+
+type kmsMasterKey struct {
+	kms   KMS
+	keyID string
+}
+
+func NewKMSMasterKey(kms KMS, keyID string) (MasterKey, error) {
+	if _, err := kms.KeyVersion(keyID); err != nil {
+		return nil, err
+	}
+	return &kmsMasterKey{
+		kms:   kms,
+		keyID: keyID,
+	}, nil
+}
+
+// the id changes after the kms key rotated, so the data keys will be wrapped by
+// the new version of the kms key
+func (mk *kmsMasterKey) ID() string {
+	ver, _ := mk.kms.KeyVersion(mk.keyID)
+	return fmt.Sprintf("kms:%v:%v", mk.keyID, ver)
+}
+
+func (mk *kmsMasterKey) Wrap(plain []byte) ([]byte, error) {
+	return mk.kms.Encrypt(mk.keyID, plain)
+}
+
+func (mk *kmsMasterKey) Unwrap(wrapped []byte) ([]byte, error) {
+	return mk.kms.Decrypt(wrapped)
+}
@@ -0,0 +1,203 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The column chunk stores the values of a column for all the rows in a row group.
+// The distinct values are stored in the dictionary, and the dictionary ids of the
+// rows are encoded with RLE:
+// row number|dict size|(value len, value)...|(run length, dict id)...
+// The dict id 0 is used for the null value, and the dict id i is the (i-1)th value
+// in the dictionary.
+
+const (
+	columnRowGroupSize = 1024
+)
+
+var errColumnChunkData = errors.New("invalid column chunk data")
+
+type columnChunk struct {
+	dict [][]byte
+	ids  []uint32
+	// value -> dict id, only built while changing the chunk
+	dictIndex map[string]uint32
+}
+
+func (c *columnChunk) rowNum() int {
+	return len(c.ids)
+}
+
+// return nil for the null value
+func (c *columnChunk) get(row int) []byte {
+	if row >= len(c.ids) || c.ids[row] == 0 {
+		return nil
+	}
+	return c.dict[c.ids[row]-1]
+}
+
+// set the value of the row, nil value means null
+func (c *columnChunk) set(row int, v []byte) {
+	for len(c.ids) <= row {
+		c.ids = append(c.ids, 0)
+	}
+	if v == nil {
+		c.ids[row] = 0
+		return
+	}
+	if c.dictIndex == nil {
+		c.dictIndex = make(map[string]uint32, len(c.dict))
+		for i, dv := range c.dict {
+			c.dictIndex[string(dv)] = uint32(i + 1)
+		}
+	}
+	id, ok := c.dictIndex[string(v)]
+	if !ok {
+		c.dict = append(c.dict, append([]byte{}, v...))
+		id = uint32(len(c.dict))
+		c.dictIndex[string(v)] = id
+	}
+	c.ids[row] = id
+}
+
+func (c *columnChunk) isAllNull() bool {
+	for _, id := range c.ids {
+		if id != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// the dictionary is rebuilt in the order of the first appearance to remove the unused values,
+// so the encoded data will be the same on all the replicas.
+func (c *columnChunk) encode() []byte {
+	newIDs := make(map[uint32]uint32, len(c.dict))
+	newDict := make([][]byte, 0, len(c.dict))
+	size := binary.MaxVarintLen64 * 2
+	for _, id := range c.ids {
+		if id == 0 {
+			continue
+		}
+		if _, ok := newIDs[id]; ok {
+			continue
+		}
+		v := c.dict[id-1]
+		newDict = append(newDict, v)
+		newIDs[id] = uint32(len(newDict))
+		size += len(v) + binary.MaxVarintLen64
+	}
+	size += binary.MaxVarintLen64 * 2 * len(c.ids)
+	buf := make([]byte, size)
+	pos := binary.PutUvarint(buf, uint64(len(c.ids)))
+	pos += binary.PutUvarint(buf[pos:], uint64(len(newDict)))
+	for _, v := range newDict {
+		pos += binary.PutUvarint(buf[pos:], uint64(len(v)))
+		pos += copy(buf[pos:], v)
+	}
+	for i := 0; i < len(c.ids); {
+		id := c.ids[i]
+		run := 1
+		for i+run < len(c.ids) && c.ids[i+run] == id {
+			run++
+		}
+		pos += binary.PutUvarint(buf[pos:], uint64(run))
+		pos += binary.PutUvarint(buf[pos:], uint64(newIDs[id]))
+		i += run
+	}
+	return buf[:pos]
+}
+
+func decodeColumnChunk(v []byte) (*columnChunk, error) {
+	rowNum, n := binary.Uvarint(v)
+	if n <= 0 || rowNum > columnRowGroupSize {
+		return nil, errColumnChunkData
+	}
+	pos := n
+	dictSize, n := binary.Uvarint(v[pos:])
+	if n <= 0 || dictSize > rowNum {
+		return nil, errColumnChunkData
+	}
+	pos += n
+	c := &columnChunk{
+		dict: make([][]byte, 0, dictSize),
+		ids:  make([]uint32, 0, rowNum),
+	}
+	for i := uint64(0); i < dictSize; i++ {
+		l, n := binary.Uvarint(v[pos:])
+		if n <= 0 || uint64(len(v)-pos-n) < l {
+			return nil, errColumnChunkData
+		}
+		pos += n
+		c.dict = append(c.dict, v[pos:pos+int(l)])
+		pos += int(l)
+	}
+	for uint64(len(c.ids)) < rowNum {
+		run, n := binary.Uvarint(v[pos:])
+		if n <= 0 || run == 0 || uint64(len(c.ids))+run > rowNum {
+			return nil, errColumnChunkData
+		}
+		pos += n
+		id, n := binary.Uvarint(v[pos:])
+		if n <= 0 || id > dictSize {
+			return nil, errColumnChunkData
+		}
+		pos += n
+		for j := uint64(0); j < run; j++ {
+			c.ids = append(c.ids, uint32(id))
+		}
+	}
+	return c, nil
+}
+
+// the row group meta stores the allocated row number and the bitmap for the live rows
+type columnRowGroup struct {
+	rowNum int
+	live   []byte
+}
+
+func (g *columnRowGroup) isLive(row int) bool {
+	if row/8 >= len(g.live) {
+		return false
+	}
+	return g.live[row/8]&(1<<uint(row%8)) != 0
+}
+
+func (g *columnRowGroup) setLive(row int, live bool) {
+	for len(g.live) <= row/8 {
+		g.live = append(g.live, 0)
+	}
+	if live {
+		g.live[row/8] |= 1 << uint(row%8)
+	} else {
+		g.live[row/8] &^= 1 << uint(row%8)
+	}
+}
+
+func (g *columnRowGroup) liveNum() int {
+	cnt := 0
+	for row := 0; row < g.rowNum; row++ {
+		if g.isLive(row) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func (g *columnRowGroup) encode() []byte {
+	buf := make([]byte, binary.MaxVarintLen64+len(g.live))
+	pos := binary.PutUvarint(buf, uint64(g.rowNum))
+	pos += copy(buf[pos:], g.live)
+	return buf[:pos]
+}
+
+func decodeColumnRowGroup(v []byte) (*columnRowGroup, error) {
+	rowNum, n := binary.Uvarint(v)
+	if n <= 0 || rowNum > columnRowGroupSize {
+		return nil, errColumnChunkData
+	}
+	g := &columnRowGroup{rowNum: int(rowNum)}
+	g.live = append(g.live, v[n:]...)
+	return g, nil
+}
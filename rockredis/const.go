@@ -39,6 +39,8 @@ const (
 	JSONType       byte = 31
 	BitmapType     byte = 32
 	BitmapMetaType byte = 33
+	// used in the exp table for the expire time of the hash field
+	HFieldExpType byte = 34
 
 	ColumnType byte = 38 // used for column store for OLAP
 
@@ -75,6 +77,8 @@ var (
 		SetType:    "set",
 		SSizeType:  "ssize",
 		JSONType:   "json",
+		// for hash field expire
+		HFieldExpType: "hfield",
 	}
 )
 
@@ -0,0 +1,253 @@
+package rockredis
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+var (
+	errSameEngineType   = errors.New("the source and destination engine type are the same")
+	errMigrateDstExist  = errors.New("the destination data already exist")
+	errDigestMismatch   = errors.New("the migrated data digest mismatch")
+	errNoDataForMigrate = errors.New("no data found for the source engine")
+)
+
+type EngineMigrateOptions struct {
+	SrcEngine string
+	DstEngine string
+	BatchNum  int
+	RockOpts  engine.RockOptions
+	// remove the existing destination data before migrating
+	Force bool
+	// remove the source data and checkpoints after migrated
+	RemoveSource bool
+}
+
+func getOldBackupDir(base string, engType string) string {
+	return GetBackupDir(base) + "." + engType
+}
+
+func newMigrateEngine(dataDir string, engType string, rockOpts engine.RockOptions) (engine.KVEngine, error) {
+	cfg := engine.NewRockConfig()
+	cfg.DataDir = dataDir
+	cfg.RockOptions = rockOpts
+	cfg.EngineType = engType
+	engine.FillDefaultOptions(&cfg.RockOptions)
+	eng, err := engine.NewKVEng(cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = eng.OpenEng()
+	if err != nil {
+		eng.CloseAll()
+		return nil, err
+	}
+	return eng, nil
+}
+
+func isDirNotEmpty(dir string) bool {
+	names, err := ioutil.ReadDir(dir)
+	return err == nil && len(names) > 0
+}
+
+// copy all the data to the destination engine and check the data in the destination
+func migrateEngine(src engine.KVEngine, dst engine.KVEngine, batchNum int) error {
+	copied, err := engine.CopyEngine(src, dst, batchNum)
+	if err != nil {
+		return err
+	}
+	migrated, err := engine.DigestEngine(dst)
+	if err != nil {
+		return err
+	}
+	if copied != migrated {
+		dbLog.Warningf("migrated data from %v to %v mismatch, source: %v, destination: %v",
+			src.GetDataDir(), dst.GetDataDir(), copied, migrated)
+		return errDigestMismatch
+	}
+	dbLog.Infof("migrated data from %v to %v, %v", src.GetDataDir(), dst.GetDataDir(), migrated)
+	return nil
+}
+
+// MigrateCheckpoint converts the checkpoint from the source engine format to the destination
+// engine format, the source checkpoint is not changed.
+func MigrateCheckpoint(srcPath string, dstPath string, opts EngineMigrateOptions) error {
+	if opts.SrcEngine == opts.DstEngine {
+		return errSameEngineType
+	}
+	srcPath, err := filepath.Abs(srcPath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(srcPath); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dstPath); !os.IsNotExist(err) {
+		if !opts.Force {
+			return errMigrateDstExist
+		}
+		os.RemoveAll(dstPath)
+	}
+	// the engine will open the data dir under the engine type name, so we copy the checkpoint
+	// to the temp dir as the data dir of the source engine
+	tmpDir := dstPath + ".migrating"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	srcBase := path.Join(tmpDir, "src")
+	err = os.MkdirAll(srcBase, common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	srcCopy := path.Join(srcBase, opts.SrcEngine)
+	err = copyCheckpointForMigrate(srcPath, srcCopy)
+	if err != nil {
+		return err
+	}
+	src, err := newMigrateEngine(srcBase, opts.SrcEngine, opts.RockOpts)
+	if err != nil {
+		return err
+	}
+	defer src.CloseAll()
+	dst, err := newMigrateEngine(path.Join(tmpDir, "dst"), opts.DstEngine, opts.RockOpts)
+	if err != nil {
+		return err
+	}
+	defer dst.CloseAll()
+	err = migrateEngine(src, dst, opts.BatchNum)
+	if err != nil {
+		return err
+	}
+	ck, err := dst.NewCheckpoint()
+	if err != nil {
+		return err
+	}
+	err = ck.Save(dstPath, make(chan struct{}))
+	if err != nil {
+		os.RemoveAll(dstPath)
+		return err
+	}
+	return dst.CheckDBEngForRead(dstPath)
+}
+
+// the engine may write some files while opening, so we use the hard links to open the copy
+// of the checkpoint to keep it unchanged.
+func copyCheckpointForMigrate(srcPath string, dstPath string) error {
+	err := os.MkdirAll(dstPath, common.DIR_PERM)
+	if err != nil {
+		return err
+	}
+	names, err := ioutil.ReadDir(srcPath)
+	if err != nil {
+		return err
+	}
+	for _, fi := range names {
+		src := path.Join(srcPath, fi.Name())
+		dst := path.Join(dstPath, fi.Name())
+		if fi.IsDir() {
+			err = copyCheckpointForMigrate(src, dst)
+		} else if path.Ext(fi.Name()) == ".sst" {
+			// the sst files are never changed after written
+			err = os.Link(src, dst)
+			if err != nil {
+				err = copyFile(src, dst, true)
+			}
+		} else {
+			err = copyFile(src, dst, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateEngineData converts the data of the stopped partition from the source engine to the
+// destination engine, including the engine data and all the local checkpoints. The checkpoints
+// keep the same term-index names, so the node can restore from the checkpoint of the latest
+// raft snapshot and replay the raft logs after it while restarting with the new engine type.
+// The old checkpoints are moved to the backup dir with the engine type suffix.
+func MigrateEngineData(base string, opts EngineMigrateOptions) error {
+	if opts.SrcEngine == opts.DstEngine {
+		return errSameEngineType
+	}
+	start := time.Now()
+	dbLog.Infof("begin migrate %v from %v to %v", base, opts.SrcEngine, opts.DstEngine)
+	srcDataDir := path.Join(base, opts.SrcEngine)
+	dstDataDir := path.Join(base, opts.DstEngine)
+	backupDir := GetBackupDir(base)
+	newBackupDir := backupDir + ".migrating"
+	oldBackupDir := getOldBackupDir(base, opts.SrcEngine)
+	checkpoints, err := filepath.Glob(path.Join(backupDir, "*-*"))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(srcDataDir)
+	if os.IsNotExist(err) && len(checkpoints) == 0 {
+		return errNoDataForMigrate
+	}
+	if isDirNotEmpty(dstDataDir) || isDirNotEmpty(oldBackupDir) {
+		if !opts.Force {
+			return errMigrateDstExist
+		}
+		os.RemoveAll(dstDataDir)
+		os.RemoveAll(oldBackupDir)
+	}
+
+	if err == nil {
+		src, err := newMigrateEngine(base, opts.SrcEngine, opts.RockOpts)
+		if err != nil {
+			return err
+		}
+		dst, err := newMigrateEngine(base, opts.DstEngine, opts.RockOpts)
+		if err != nil {
+			src.CloseAll()
+			return err
+		}
+		err = migrateEngine(src, dst, opts.BatchNum)
+		src.CloseAll()
+		dst.CloseAll()
+		if err != nil {
+			os.RemoveAll(dstDataDir)
+			return err
+		}
+	}
+
+	os.RemoveAll(newBackupDir)
+	for _, ck := range checkpoints {
+		fi, err := os.Stat(ck)
+		if err != nil || !fi.IsDir() {
+			continue
+		}
+		err = MigrateCheckpoint(ck, path.Join(newBackupDir, path.Base(ck)), opts)
+		if err != nil {
+			os.RemoveAll(newBackupDir)
+			return fmt.Errorf("migrate checkpoint %v failed: %v", ck, err)
+		}
+	}
+	if len(checkpoints) > 0 {
+		// the checkpoints from remote are not migrated since they are only used while transferring
+		err = os.Rename(backupDir, oldBackupDir)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(newBackupDir, backupDir)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.RemoveSource {
+		os.RemoveAll(srcDataDir)
+		os.RemoveAll(oldBackupDir)
+	}
+	dbLog.Infof("migrate %v from %v to %v done, %v checkpoints, cost: %v", base, opts.SrcEngine, opts.DstEngine,
+		len(checkpoints), time.Since(start))
+	return nil
+}
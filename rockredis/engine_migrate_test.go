@@ -0,0 +1,95 @@
+package rockredis
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+func TestMigrateEngineData(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "engine_migrate")
+	require.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	db := getTestDBWithDirType(t, dataDir, "pebble")
+	keyNum := 100
+	for i := 0; i < keyNum; i++ {
+		err = db.KVSet(0, []byte("test:key"+strconv.Itoa(i)), []byte("value"+strconv.Itoa(i)))
+		require.Nil(t, err)
+	}
+	bi := db.Backup(1, 10)
+	require.NotNil(t, bi)
+	_, err = bi.GetResult()
+	require.Nil(t, err)
+	// the data after the checkpoint should be migrated too
+	err = db.KVSet(0, []byte("test:key0"), []byte("changed"))
+	require.Nil(t, err)
+	db.Close()
+
+	opts := EngineMigrateOptions{
+		SrcEngine: "pebble",
+		DstEngine: "badger",
+	}
+	err = MigrateEngineData(dataDir, opts)
+	require.Nil(t, err)
+	err = MigrateEngineData(dataDir, opts)
+	assert.Equal(t, errMigrateDstExist, err)
+	opts.DstEngine = "pebble"
+	err = MigrateEngineData(dataDir, opts)
+	assert.Equal(t, errSameEngineType, err)
+
+	// the old checkpoints are kept with the engine type suffix
+	_, err = os.Stat(path.Join(getOldBackupDir(dataDir, "pebble"), GetCheckpointDir(1, 10)))
+	assert.Nil(t, err)
+
+	db = getTestDBWithDirType(t, dataDir, "badger")
+	defer db.Close()
+	v, err := db.KVGet([]byte("test:key0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("changed"), v)
+	ok, err := db.IsLocalBackupOK(1, 10)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	err = db.Restore(1, 10)
+	require.Nil(t, err)
+	for i := 0; i < keyNum; i++ {
+		v, err := db.KVGet([]byte("test:key" + strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value"+strconv.Itoa(i)), v)
+	}
+
+	// migrate the checkpoint back to pebble
+	ckDir := path.Join(dataDir, "checkpoint")
+	err = MigrateCheckpoint(path.Join(GetBackupDir(dataDir), GetCheckpointDir(1, 10)), ckDir, EngineMigrateOptions{
+		SrcEngine: "badger",
+		DstEngine: "pebble",
+	})
+	assert.Nil(t, err)
+	src := path.Join(getOldBackupDir(dataDir, "pebble"), GetCheckpointDir(1, 10))
+	srcCopy := path.Join(dataDir, "src")
+	require.Nil(t, copyCheckpointForMigrate(src, path.Join(srcCopy, "pebble")))
+	cfg := engine.NewRockConfig()
+	cfg.DataDir = srcCopy
+	cfg.EngineType = "pebble"
+	srcEng, err := engine.NewKVEng(cfg)
+	require.Nil(t, err)
+	require.Nil(t, srcEng.OpenEng())
+	defer srcEng.CloseAll()
+	cfg.DataDir = path.Join(dataDir, "checkpoint_open")
+	require.Nil(t, copyCheckpointForMigrate(ckDir, path.Join(cfg.DataDir, "pebble")))
+	dstEng, err := engine.NewKVEng(cfg)
+	require.Nil(t, err)
+	require.Nil(t, dstEng.OpenEng())
+	defer dstEng.CloseAll()
+	srcDigest, err := engine.DigestEngine(srcEng)
+	assert.Nil(t, err)
+	dstDigest, err := engine.DigestEngine(dstEng)
+	assert.Nil(t, err)
+	assert.Equal(t, srcDigest, dstDigest)
+}
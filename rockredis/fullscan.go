@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/binary"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/youzan/ZanRedisDB/common"
@@ -49,33 +50,42 @@ func getFullScanDataStoreType(dataType common.DataType) (byte, error) {
 }
 
 func (db *RockDB) FullScan(dataType common.DataType, cursor []byte, count int, match string) *common.FullScanResult {
-	return db.fullScanGeneric(dataType, cursor, count, match)
+	return db.fullScanGeneric(dataType, cursor, count, match, nil)
+}
+
+// FullScanWithFilter is the same as FullScan except that the keys not matched the filter will be skipped
+func (db *RockDB) FullScanWithFilter(dataType common.DataType, cursor []byte, count int, match string,
+	filter *ScanFilter) *common.FullScanResult {
+	return db.fullScanGeneric(dataType, cursor, count, match, filter)
 }
 
 func (db *RockDB) fullScanGeneric(dataType common.DataType, key []byte, count int,
-	match string) *common.FullScanResult {
-	return db.fullScanGenericUseBuffer(dataType, key, count, match, nil)
+	match string, filter *ScanFilter) *common.FullScanResult {
+	return db.fullScanGenericUseBuffer(dataType, key, count, match, filter, nil)
 }
 
 func (db *RockDB) fullScanGenericUseBuffer(dataType common.DataType, key []byte, count int,
-	match string, inputBuffer []interface{}) *common.FullScanResult {
+	match string, filter *ScanFilter, inputBuffer []interface{}) *common.FullScanResult {
 	storeDataType, err := getFullScanDataStoreType(dataType)
 	if err != nil {
 		return buildErrFullScanResult(err, dataType)
 	}
+	if err := db.checkScanFilter(dataType, filter); err != nil {
+		return buildErrFullScanResult(err, dataType)
+	}
 
 	var result *common.FullScanResult
 	switch storeDataType {
 	case KVType:
-		result = db.kvFullScan(key, count, match, inputBuffer)
+		result = db.kvFullScan(key, count, match, filter, inputBuffer)
 	case HashType:
-		result = db.hashFullScan(key, count, match, inputBuffer)
+		result = db.hashFullScan(key, count, match, filter, inputBuffer)
 	case ListType:
-		result = db.listFullScan(key, count, match, inputBuffer)
+		result = db.listFullScan(key, count, match, filter, inputBuffer)
 	case SetType:
-		result = db.setFullScan(key, count, match, inputBuffer)
+		result = db.setFullScan(key, count, match, filter, inputBuffer)
 	case ZSetType:
-		result = db.zsetFullScan(key, count, match, inputBuffer)
+		result = db.zsetFullScan(key, count, match, filter, inputBuffer)
 	default:
 		result = buildErrFullScanResult(errUnsuportType, dataType)
 	}
@@ -84,9 +94,9 @@ func (db *RockDB) fullScanGenericUseBuffer(dataType common.DataType, key []byte,
 }
 
 func (db *RockDB) kvFullScan(key []byte, count int,
-	match string, inputBuffer []interface{}) *common.FullScanResult {
+	match string, filter *ScanFilter, inputBuffer []interface{}) *common.FullScanResult {
 
-	return db.fullScanCommon(KVType, key, count, match,
+	return db.fullScanCommon(KVType, key, count, match, filter,
 		func(it *engine.RangeLimitedIterator, r glob.Glob) (*ItemContainer, error) {
 			if t, k, _, err := decodeFullScanKey(KVType, it.Key()); err != nil {
 				return nil, err
@@ -100,9 +110,9 @@ func (db *RockDB) kvFullScan(key []byte, count int,
 }
 
 func (db *RockDB) hashFullScan(key []byte, count int,
-	match string, inputBuffer []interface{}) *common.FullScanResult {
+	match string, filter *ScanFilter, inputBuffer []interface{}) *common.FullScanResult {
 
-	return db.fullScanCommon(HashType, key, count, match,
+	return db.fullScanCommon(HashType, key, count, match, filter,
 		func(it *engine.RangeLimitedIterator, r glob.Glob) (*ItemContainer, error) {
 			var t, k, f []byte
 			var err error
@@ -121,9 +131,9 @@ func (db *RockDB) hashFullScan(key []byte, count int,
 }
 
 func (db *RockDB) listFullScan(key []byte, count int,
-	match string, inputBuffer []interface{}) *common.FullScanResult {
+	match string, filter *ScanFilter, inputBuffer []interface{}) *common.FullScanResult {
 
-	return db.fullScanCommon(ListType, key, count, match,
+	return db.fullScanCommon(ListType, key, count, match, filter,
 		func(it *engine.RangeLimitedIterator, r glob.Glob) (*ItemContainer, error) {
 			var t, k, seq []byte
 			var err error
@@ -139,9 +149,9 @@ func (db *RockDB) listFullScan(key []byte, count int,
 }
 
 func (db *RockDB) setFullScan(key []byte, count int,
-	match string, inputBuffer []interface{}) *common.FullScanResult {
+	match string, filter *ScanFilter, inputBuffer []interface{}) *common.FullScanResult {
 
-	return db.fullScanCommon(SetType, key, count, match,
+	return db.fullScanCommon(SetType, key, count, match, filter,
 		func(it *engine.RangeLimitedIterator, r glob.Glob) (*ItemContainer, error) {
 			var t, k, m []byte
 			var err error
@@ -156,9 +166,9 @@ func (db *RockDB) setFullScan(key []byte, count int,
 }
 
 func (db *RockDB) zsetFullScan(key []byte, count int,
-	match string, inputBuffer []interface{}) *common.FullScanResult {
+	match string, filter *ScanFilter, inputBuffer []interface{}) *common.FullScanResult {
 
-	return db.fullScanCommon(ZSetType, key, count, match,
+	return db.fullScanCommon(ZSetType, key, count, match, filter,
 		func(it *engine.RangeLimitedIterator, r glob.Glob) (*ItemContainer, error) {
 			var t, k, m []byte
 			var err error
@@ -180,7 +190,7 @@ func (db *RockDB) zsetFullScan(key []byte, count int,
 }
 
 func (db *RockDB) fullScanCommon(tp byte, key []byte, count int, match string,
-	f itemFunc) *common.FullScanResult {
+	filter *ScanFilter, f itemFunc) *common.FullScanResult {
 	r, err := buildMatchRegexp(match)
 	if err != nil {
 		return buildErrFullScanResult(err, common.NONE)
@@ -192,7 +202,12 @@ func (db *RockDB) fullScanCommon(tp byte, key []byte, count int, match string,
 	}
 
 	count = checkScanCount(count)
-	it, err := db.buildFullScanIterator(tp, table, rk, count)
+	limit := count
+	if !filter.IsEmpty() {
+		// the filtered keys should also be counted to avoid scan too much
+		limit = count * scanFilterStepFactor
+	}
+	it, err := db.buildFullScanIterator(tp, table, rk, limit)
 	if err != nil {
 		return buildErrFullScanResult(err, common.NONE)
 	}
@@ -204,6 +219,10 @@ func (db *RockDB) fullScanCommon(tp byte, key []byte, count int, match string,
 	var container *ItemContainer
 	var prevKey []byte
 	var length int
+	var lastScanned *ItemContainer
+	var filterKey []byte
+	filterMatched := true
+	tn := time.Now().UnixNano()
 	for length = 0; it.Valid() && length < count; it.Next() {
 		container, err = f(it, r)
 		if err != nil {
@@ -213,6 +232,19 @@ func (db *RockDB) fullScanCommon(tp byte, key []byte, count int, match string,
 				return buildErrFullScanResult(err, common.NONE)
 			}
 		}
+		if !filter.IsEmpty() {
+			lastScanned = container
+			if !bytes.Equal(filterKey, container.key) {
+				filterKey = container.key
+				filterMatched, err = db.fullScanFilterMatch(tn, tp, table, container.key, filter)
+				if err != nil {
+					return buildErrFullScanResult(err, common.NONE)
+				}
+			}
+			if !filterMatched {
+				continue
+			}
+		}
 
 		if !bytes.Equal(prevKey, container.key) {
 			if len(item) > 0 {
@@ -229,8 +261,15 @@ func (db *RockDB) fullScanCommon(tp byte, key []byte, count int, match string,
 		result = append(result, item)
 	}
 
+	hasMore := length >= count
+	if !filter.IsEmpty() {
+		// the limited iterator is invalid after the scan steps used up, so we should
+		// check the underlying iterator to see if there is more data in the range
+		hasMore = it.Iterator.Valid() && lastScanned != nil
+		container = lastScanned
+	}
 	var nextCursor []byte
-	if length < count || (count == 0 && length == 0) {
+	if !hasMore {
 		nextCursor = []byte("")
 	} else {
 		if tp == KVType {
@@ -0,0 +1,91 @@
+package rockredis
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The tokenizer for the full text index. The text is split into words by the
+// characters which are neither letters nor digits, and the words are lower cased.
+// Since there is no space between the words in the CJK text, each CJK character
+// is treated as a single token.
+
+const (
+	maxFullTextTokenLen = 64
+)
+
+func isCJKRune(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
+
+// the token passed to the callback is only valid in the callback
+func tokenizeFullText(text []byte, fn func(token []byte)) {
+	start := -1
+	emit := func(word []byte) {
+		if len(word) == 0 || len(word) > maxFullTextTokenLen {
+			return
+		}
+		fn(bytes.ToLower(word))
+	}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		if r == utf8.RuneError && size <= 1 {
+			// invalid utf8 byte is treated as the separator
+			if start >= 0 {
+				emit(text[start:i])
+				start = -1
+			}
+			i++
+			continue
+		}
+		if isCJKRune(r) {
+			if start >= 0 {
+				emit(text[start:i])
+				start = -1
+			}
+			emit(text[i : i+size])
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			emit(text[start:i])
+			start = -1
+		}
+		i += size
+	}
+	if start >= 0 {
+		emit(text[start:])
+	}
+}
+
+// return the term frequency of all the tokens in the texts and the total token number
+func fullTextTermFreqs(texts [][]byte) (map[string]int64, int64) {
+	terms := make(map[string]int64)
+	var total int64
+	for _, text := range texts {
+		tokenizeFullText(text, func(token []byte) {
+			terms[string(token)]++
+			total++
+		})
+	}
+	return terms, total
+}
+
+// return the unique tokens in the query in the order of appearance
+func tokenizeFullTextQuery(query []byte) []string {
+	seen := make(map[string]bool)
+	terms := make([]string, 0, 4)
+	tokenizeFullText(query, func(token []byte) {
+		if seen[string(token)] {
+			return
+		}
+		seen[string(token)] = true
+		terms = append(terms, string(token))
+	})
+	return terms
+}
@@ -0,0 +1,462 @@
+package rockredis
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+var (
+	errIndexJobRunning     = errors.New("index job is already running")
+	errIndexBuildCancelled = errors.New("index build is cancelled")
+	errIndexNotBuilt       = errors.New("index is not built")
+)
+
+// the progress of the running or the last finished index job
+type indexJob struct {
+	sync.Mutex
+	progress common.IndexJobProgress
+	start    time.Time
+}
+
+func newIndexJob(job string, table string, indexes []string, total int64) *indexJob {
+	now := time.Now()
+	return &indexJob{
+		progress: common.IndexJobProgress{
+			Table:      table,
+			Indexes:    indexes,
+			Job:        job,
+			Status:     common.IndexJobRunning,
+			TotalKeys:  total,
+			StartTime:  now.Unix(),
+			UpdateTime: now.Unix(),
+		},
+		start: now,
+	}
+}
+
+func indexJobKey(job string, table string, name string) string {
+	return job + ":" + table + ":" + name
+}
+
+func (j *indexJob) addScanned(n int, missing int64, stale int64, repaired int64) {
+	j.Lock()
+	j.progress.ScannedKeys += int64(n)
+	j.progress.MissingEntries += missing
+	j.progress.StaleEntries += stale
+	j.progress.Repaired += repaired
+	j.progress.UpdateTime = time.Now().Unix()
+	j.Unlock()
+}
+
+func (j *indexJob) setStatus(status string) {
+	j.Lock()
+	j.progress.Status = status
+	j.progress.UpdateTime = time.Now().Unix()
+	j.Unlock()
+}
+
+func (j *indexJob) finish(err error) {
+	j.Lock()
+	defer j.Unlock()
+	j.progress.UpdateTime = time.Now().Unix()
+	switch err {
+	case nil:
+		j.progress.Status = common.IndexJobDone
+	case errIndexBuildCancelled:
+		j.progress.Status = common.IndexJobCancelled
+	default:
+		j.progress.Status = common.IndexJobFailed
+		j.progress.Error = err.Error()
+	}
+}
+
+func (j *indexJob) isRunning() bool {
+	j.Lock()
+	defer j.Unlock()
+	return j.progress.Status == common.IndexJobRunning || j.progress.Status == common.IndexJobPaused
+}
+
+// the rate is computed from the start of the job, and the ETA is estimated from
+// the approximate key number of the table.
+func (j *indexJob) snapshot() common.IndexJobProgress {
+	j.Lock()
+	defer j.Unlock()
+	p := j.progress
+	p.Indexes = append([]string{}, j.progress.Indexes...)
+	cost := time.Unix(p.UpdateTime, 0).Sub(j.start).Seconds()
+	if cost > 0 {
+		p.KeysPerSec = float64(p.ScannedKeys) / cost
+	}
+	if p.Status == common.IndexJobRunning && p.KeysPerSec > 0 && p.TotalKeys > p.ScannedKeys {
+		p.ETASeconds = int64(float64(p.TotalKeys-p.ScannedKeys) / p.KeysPerSec)
+	}
+	return p
+}
+
+func (im *IndexMgr) startIndexJob(db *RockDB, job string, table string, name string, indexes []string) (*indexJob, error) {
+	total, _ := db.GetTableKeyCount([]byte(table))
+	im.jobMu.Lock()
+	defer im.jobMu.Unlock()
+	key := indexJobKey(job, table, name)
+	if old, ok := im.jobs[key]; ok && old.isRunning() {
+		return nil, errIndexJobRunning
+	}
+	j := newIndexJob(job, table, indexes, total)
+	im.jobs[key] = j
+	return j, nil
+}
+
+// GetIndexJobs return the progress of all the running and the last finished index jobs.
+func (im *IndexMgr) GetIndexJobs() []common.IndexJobProgress {
+	im.jobMu.Lock()
+	jobs := make([]common.IndexJobProgress, 0, len(im.jobs))
+	for _, j := range im.jobs {
+		jobs = append(jobs, j.snapshot())
+	}
+	im.jobMu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Table != jobs[j].Table {
+			return jobs[i].Table < jobs[j].Table
+		}
+		return jobs[i].StartTime < jobs[j].StartTime
+	})
+	return jobs
+}
+
+// SetIndexJobThrottle limit the keys scanned per second by the index jobs, 0 means no limit.
+// The paused jobs will wait until resumed or cancelled.
+func (im *IndexMgr) SetIndexJobThrottle(rate int64, paused bool) {
+	if rate < 0 {
+		rate = 0
+	}
+	atomic.StoreInt64(&im.jobRateLimit, rate)
+	p := int32(0)
+	if paused {
+		p = 1
+	}
+	atomic.StoreInt32(&im.jobPaused, p)
+	dbLog.Infof("index job throttle changed to %v keys/s, paused: %v", rate, paused)
+}
+
+// wait after scanning n keys in the cost time to keep the scan rate under the limit,
+// and wait while the jobs are paused. Return false if the job should be stopped.
+func (im *IndexMgr) throttleIndexJob(job *indexJob, n int, cost time.Duration,
+	stopChan chan struct{}, isCancelled func() bool) bool {
+	rate := atomic.LoadInt64(&im.jobRateLimit)
+	if rate > 0 {
+		expected := time.Duration(int64(time.Second) * int64(n) / rate)
+		if expected > cost {
+			select {
+			case <-stopChan:
+				return false
+			case <-time.After(expected - cost):
+			}
+		}
+	}
+	if atomic.LoadInt32(&im.jobPaused) == 0 {
+		return true
+	}
+	job.setStatus(common.IndexJobPaused)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for atomic.LoadInt32(&im.jobPaused) == 1 {
+		select {
+		case <-stopChan:
+			return false
+		case <-ticker.C:
+		}
+		if isCancelled() {
+			break
+		}
+	}
+	job.setStatus(common.IndexJobRunning)
+	return true
+}
+
+// the index key and value for the hash key computed from the current hash data,
+// nil if the hash key should not be indexed.
+func (self *HsetIndex) expectedRec(db *RockDB, pk []byte) ([]byte, []byte, error) {
+	pkkey := pk
+	pkvalue := emptyValue
+	if self.Unique == 1 {
+		pkkey = nil
+		pkvalue = pk
+	}
+	if self.IsComposite() {
+		values, err := db.HMget(pk, self.compositeFieldNames()...)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the invalid values are never indexed
+		vals, _ := self.compositeEncodeValues(values)
+		if vals == nil {
+			return nil, nil, nil
+		}
+		key, err := self.encodeCompositeKey(vals, pkkey)
+		return key, pkvalue, err
+	}
+	value, err := db.HGet(pk, self.IndexField)
+	if err != nil || len(value) == 0 {
+		return nil, nil, err
+	}
+	if self.Unique == 1 {
+		key, err := self.uniqueKey(value)
+		if err != nil {
+			return nil, nil, nil
+		}
+		return key, pkvalue, nil
+	}
+	var key []byte
+	if self.ValueType == Int64V || self.ValueType == Int32V {
+		n, perr := strconv.ParseInt(string(value), 10, 64)
+		if perr != nil {
+			return nil, nil, nil
+		}
+		key, err = encodeHsetIndexNumberKey(self.dataType(), self.Table, self.Name, n, pkkey, false)
+	} else if self.ValueType == StringV {
+		if self.PrefixLen > 0 && int32(len(value)) > self.PrefixLen {
+			value = value[:self.PrefixLen]
+		}
+		key, err = encodeHsetIndexStringKey(self.dataType(), self.Table, self.Name, value, pkkey, false)
+	} else {
+		return nil, nil, ErrIndexValueType
+	}
+	return key, pkvalue, err
+}
+
+// the primary key of the index entry
+func (self *HsetIndex) decodeRecPK(key []byte, value []byte) ([]byte, error) {
+	if !self.IsComposite() {
+		resp, err := self.decodeSearchRec(key, value)
+		return resp.PKey, err
+	}
+	_, pk, err := self.decodeCompositeKey(key)
+	if self.Unique == 1 {
+		pk = value
+	}
+	return pk, err
+}
+
+// VerifyHsetIndex start the job to compare the index entries with the hash data in background,
+// the missing entries will be added and the stale entries will be removed if repair is true.
+func (im *IndexMgr) VerifyHsetIndex(db *RockDB, table string, name string, repair bool) error {
+	im.RLock()
+	stopChan := im.closeChan
+	indexes, ok := im.tableIndexes[table]
+	im.RUnlock()
+	if !ok {
+		return ErrIndexTableNotExist
+	}
+	if stopChan == nil {
+		return ErrIndexClosed
+	}
+	var hindex *HsetIndex
+	indexes.RLock()
+	for _, v := range indexes.hsetIndexes {
+		if string(v.Name) == name {
+			hindex = v
+			break
+		}
+	}
+	indexes.RUnlock()
+	if hindex == nil {
+		return ErrIndexNotExist
+	}
+	if hindex.State != BuildDoneIndex && hindex.State != ReadyIndex {
+		return errIndexNotBuilt
+	}
+	job, err := im.startIndexJob(db, common.IndexJobVerify, table, name, []string{name})
+	if err != nil {
+		return err
+	}
+	dbLog.Infof("begin verify index %v for table %v, repair: %v", name, table, repair)
+	im.wg.Add(1)
+	go func() {
+		defer im.wg.Done()
+		err := im.verifyHsetIndex(db, indexes, hindex, repair, job, stopChan)
+		job.finish(err)
+		p := job.snapshot()
+		dbLog.Infof("finish verify index %v for table %v: %v, missing: %v, stale: %v, repaired: %v, err: %v",
+			name, table, p.ScannedKeys, p.MissingEntries, p.StaleEntries, p.Repaired, err)
+	}()
+	return nil
+}
+
+func (im *IndexMgr) verifyHsetIndex(db *RockDB, t *TableIndexContainer, hindex *HsetIndex,
+	repair bool, job *indexJob, stopChan chan struct{}) error {
+	isDeleted := func() bool {
+		t.RLock()
+		defer t.RUnlock()
+		return hindex.State == DeletedIndex
+	}
+	// check all the hash keys are indexed
+	cursor := append([]byte{}, hindex.Table...)
+	cursor = append(cursor, common.NamespaceTableSeperator)
+	origPrefix := cursor
+	pkList := make([][]byte, 0, buildIndexBlock)
+	for len(cursor) > 0 {
+		begin := time.Now()
+		n, err := func() (int, error) {
+			if repair {
+				// the hash data and index entries should not be changed by the raft apply
+				// between checking and repairing
+				db.LockApply()
+				defer db.UnlockApply()
+			}
+			t.Lock()
+			defer t.Unlock()
+			select {
+			case <-stopChan:
+				return 0, ErrIndexClosed
+			default:
+			}
+			if hindex.State == DeletedIndex {
+				return 0, ErrIndexDeleted
+			}
+			var err error
+			pkList, err = db.ScanWithBuffer(common.HASH, cursor, buildIndexBlock, "", pkList[:0], false)
+			if err != nil {
+				return 0, err
+			}
+			if len(pkList) < buildIndexBlock {
+				cursor = nil
+			}
+			wb := db.rockEng.NewWriteBatch()
+			defer wb.Destroy()
+			var missing, repaired int64
+			n := 0
+			for _, pk := range pkList {
+				if !bytes.HasPrefix(pk, origPrefix) {
+					cursor = nil
+					break
+				}
+				n++
+				cursor = pk
+				key, v, err := hindex.expectedRec(db, pk)
+				if err != nil {
+					return n, err
+				}
+				if key == nil {
+					continue
+				}
+				found := false
+				if hindex.Unique == 1 {
+					owner, err := db.GetBytesNoLock(key)
+					if err != nil {
+						return n, err
+					}
+					// the duplicated value owned by other key can not be repaired
+					found = owner != nil
+					if found && !bytes.Equal(owner, pk) {
+						missing++
+						continue
+					}
+				} else {
+					found, err = db.ExistNoLock(key)
+					if err != nil {
+						return n, err
+					}
+				}
+				if found {
+					continue
+				}
+				missing++
+				if repair {
+					wb.Put(key, v)
+					repaired++
+				}
+			}
+			if repaired > 0 {
+				if err := db.rockEng.Write(wb); err != nil {
+					return n, err
+				}
+			}
+			job.addScanned(n, missing, 0, repaired)
+			return n, nil
+		}()
+		if err != nil {
+			return err
+		}
+		if !im.throttleIndexJob(job, n, time.Since(begin), stopChan, isDeleted) {
+			return ErrIndexClosed
+		}
+	}
+
+	// check all the index entries match the hash data
+	min := encodeHsetIndexStartKey(hindex.dataType(), hindex.Table, hindex.Name)
+	max := encodeHsetIndexStopKey(hindex.dataType(), hindex.Table, hindex.Name)
+	rt := common.RangeClose
+	for {
+		begin := time.Now()
+		done, n, err := func() (bool, int, error) {
+			if repair {
+				db.LockApply()
+				defer db.UnlockApply()
+			}
+			t.Lock()
+			defer t.Unlock()
+			select {
+			case <-stopChan:
+				return true, 0, ErrIndexClosed
+			default:
+			}
+			if hindex.State == DeletedIndex {
+				return true, 0, ErrIndexDeleted
+			}
+			it, err := db.NewDBRangeLimitIterator(min, max, rt, 0, buildIndexBlock, false)
+			if err != nil {
+				return true, 0, err
+			}
+			staleKeys := make([][]byte, 0)
+			n := 0
+			for ; it.Valid(); it.Next() {
+				n++
+				key := append([]byte{}, it.Key()...)
+				min = key
+				pk, err := hindex.decodeRecPK(key, it.Value())
+				if err != nil {
+					staleKeys = append(staleKeys, key)
+					continue
+				}
+				expected, _, err := hindex.expectedRec(db, pk)
+				if err != nil {
+					it.Close()
+					return true, n, err
+				}
+				if !bytes.Equal(expected, key) {
+					staleKeys = append(staleKeys, key)
+				}
+			}
+			// the iterator should be closed before write
+			it.Close()
+			rt = common.RangeLOpen
+			var repaired int64
+			if repair && len(staleKeys) > 0 {
+				wb := db.rockEng.NewWriteBatch()
+				defer wb.Destroy()
+				for _, k := range staleKeys {
+					wb.Delete(k)
+				}
+				if err := db.rockEng.Write(wb); err != nil {
+					return true, n, err
+				}
+				repaired = int64(len(staleKeys))
+			}
+			job.addScanned(0, 0, int64(len(staleKeys)), repaired)
+			return n < buildIndexBlock, n, nil
+		}()
+		if err != nil || done {
+			return err
+		}
+		if !im.throttleIndexJob(job, n, time.Since(begin), stopChan, isDeleted) {
+			return ErrIndexClosed
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package rockredis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func waitIndexJobDone(t *testing.T, db *RockDB, job string, table string) common.IndexJobProgress {
+	start := time.Now()
+	for {
+		time.Sleep(time.Millisecond * 10)
+		for _, j := range db.GetIndexJobs() {
+			if j.Job == job && j.Table == table && j.Status != common.IndexJobRunning &&
+				j.Status != common.IndexJobPaused {
+				return j
+			}
+		}
+		if time.Since(start) > time.Second*10 {
+			t.Fatalf("waiting index job %v timeout", job)
+		}
+	}
+}
+
+func TestHashIndexBuildProgressAndVerify(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test_index_job")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("index_test_field")
+	hindex.ValueType = StringV
+	for _, k := range []string{"a", "b", "c"} {
+		key := []byte(string(hindex.Table) + ":testdb_hash_" + k)
+		_, err := db.HSet(0, false, key, hindex.IndexField, []byte(k))
+		assert.Nil(t, err)
+	}
+
+	err := db.indexMgr.AddHsetIndex(db, &hindex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), BuildingIndex)
+	assert.Nil(t, err)
+	job := waitIndexJobDone(t, db, common.IndexJobBuild, string(hindex.Table))
+	assert.Equal(t, common.IndexJobDone, job.Status)
+	assert.Equal(t, int64(3), job.ScannedKeys)
+	assert.Equal(t, []string{"index1"}, job.Indexes)
+	assert.Equal(t, BuildDoneIndex, hindex.State)
+
+	err = db.VerifyHsetIndex(string(hindex.Table), "index_not_exist", false)
+	assert.Equal(t, ErrIndexNotExist, err)
+	err = db.VerifyHsetIndex(string(hindex.Table), string(hindex.Name), false)
+	assert.Nil(t, err)
+	job = waitIndexJobDone(t, db, common.IndexJobVerify, string(hindex.Table))
+	assert.Equal(t, common.IndexJobDone, job.Status)
+	assert.Equal(t, int64(3), job.ScannedKeys)
+	assert.Equal(t, int64(0), job.MissingEntries)
+	assert.Equal(t, int64(0), job.StaleEntries)
+
+	// make the index drift from the hash data
+	wb := db.rockEng.NewWriteBatch()
+	hsetIndexRemoveStringRec(hindex.dataType(), hindex.Table, hindex.Name, []byte("a"),
+		[]byte(string(hindex.Table)+":testdb_hash_a"), wb)
+	hsetIndexAddStringRec(hindex.dataType(), hindex.Table, hindex.Name, []byte("d"),
+		[]byte(string(hindex.Table)+":testdb_hash_d"), emptyValue, wb)
+	hsetIndexAddStringRec(hindex.dataType(), hindex.Table, hindex.Name, []byte("x"),
+		[]byte(string(hindex.Table)+":testdb_hash_b"), emptyValue, wb)
+	err = db.rockEng.Write(wb)
+	wb.Destroy()
+	assert.Nil(t, err)
+
+	err = db.VerifyHsetIndex(string(hindex.Table), string(hindex.Name), false)
+	assert.Nil(t, err)
+	job = waitIndexJobDone(t, db, common.IndexJobVerify, string(hindex.Table))
+	assert.Equal(t, int64(1), job.MissingEntries)
+	assert.Equal(t, int64(2), job.StaleEntries)
+	assert.Equal(t, int64(0), job.Repaired)
+
+	err = db.VerifyHsetIndex(string(hindex.Table), string(hindex.Name), true)
+	assert.Nil(t, err)
+	job = waitIndexJobDone(t, db, common.IndexJobVerify, string(hindex.Table))
+	assert.Equal(t, int64(3), job.Repaired)
+
+	err = db.VerifyHsetIndex(string(hindex.Table), string(hindex.Name), false)
+	assert.Nil(t, err)
+	job = waitIndexJobDone(t, db, common.IndexJobVerify, string(hindex.Table))
+	assert.Equal(t, int64(0), job.MissingEntries)
+	assert.Equal(t, int64(0), job.StaleEntries)
+	condAll := &IndexCondition{Limit: -1}
+	cnt, _, err := hindex.SearchRec(db, condAll, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), cnt)
+
+	// the repair should wait the pending batch committed and should not
+	// add the index entry for the old hash value
+	wb = db.rockEng.NewWriteBatch()
+	hsetIndexRemoveStringRec(hindex.dataType(), hindex.Table, hindex.Name, []byte("a"),
+		[]byte(string(hindex.Table)+":testdb_hash_a"), wb)
+	err = db.rockEng.Write(wb)
+	wb.Destroy()
+	assert.Nil(t, err)
+	err = db.BeginBatchWrite()
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte(string(hindex.Table)+":testdb_hash_a"), hindex.IndexField, []byte("a2"))
+	assert.Nil(t, err)
+	err = db.VerifyHsetIndex(string(hindex.Table), string(hindex.Name), true)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 100)
+	for _, j := range db.GetIndexJobs() {
+		if j.Job == common.IndexJobVerify {
+			assert.Equal(t, common.IndexJobRunning, j.Status)
+		}
+	}
+	err = db.CommitBatchWrite()
+	assert.Nil(t, err)
+	job = waitIndexJobDone(t, db, common.IndexJobVerify, string(hindex.Table))
+	assert.Equal(t, int64(0), job.Repaired)
+	err = db.VerifyHsetIndex(string(hindex.Table), string(hindex.Name), false)
+	assert.Nil(t, err)
+	job = waitIndexJobDone(t, db, common.IndexJobVerify, string(hindex.Table))
+	assert.Equal(t, int64(0), job.MissingEntries)
+	assert.Equal(t, int64(0), job.StaleEntries)
+}
+
+func TestHashIndexBuildCancel(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	oldBlock := buildIndexBlock
+	buildIndexBlock = 1
+	defer func() {
+		buildIndexBlock = oldBlock
+	}()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test_index_cancel")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("index_test_field")
+	hindex.ValueType = StringV
+	for _, k := range []string{"a", "b", "c"} {
+		key := []byte(string(hindex.Table) + ":testdb_hash_" + k)
+		_, err := db.HSet(0, false, key, hindex.IndexField, []byte(k))
+		assert.Nil(t, err)
+	}
+	err := db.indexMgr.AddHsetIndex(db, &hindex)
+	assert.Nil(t, err)
+
+	// the build will be paused after the first block
+	db.SetIndexJobThrottle(0, true)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), BuildingIndex)
+	assert.Nil(t, err)
+	start := time.Now()
+	for {
+		time.Sleep(time.Millisecond * 10)
+		jobs := db.GetIndexJobs()
+		if len(jobs) > 0 && jobs[0].Status == common.IndexJobPaused {
+			assert.Equal(t, int64(1), jobs[0].ScannedKeys)
+			break
+		}
+		if time.Since(start) > time.Second*10 {
+			t.Fatalf("waiting index build paused timeout")
+		}
+	}
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), DeletedIndex)
+	assert.Nil(t, err)
+	job := waitIndexJobDone(t, db, common.IndexJobBuild, string(hindex.Table))
+	assert.Equal(t, common.IndexJobCancelled, job.Status)
+	assert.Equal(t, DeletedIndex, hindex.State)
+	db.SetIndexJobThrottle(0, false)
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
 )
 
 var (
@@ -18,22 +21,40 @@ var (
 	buildIndexBlock = 1000
 )
 
+// JSONIndex is the secondary index on the json path, the IndexField is the
+// path converted by convertJSONPath.
 type JSONIndex struct {
-	Table []byte
-	HsetIndexInfo
+	HsetIndex
+}
+
+func newJSONIndex(table []byte, info HsetIndexInfo) *JSONIndex {
+	ji := &JSONIndex{}
+	ji.Table = table
+	ji.HsetIndexInfo = info
+	ji.indexDataType = jsonIndexDataType
+	return ji
 }
 
 type TableIndexContainer struct {
 	sync.RWMutex
 	// field -> index name, to convert "secondaryindex.select * from table where field = xxx" to scan(/hindex/table/indexname/xxx)
 	hsetIndexes map[string]*HsetIndex
+	// json path -> json index
 	jsonIndexes map[string]*JSONIndex
+	// index name -> full text index
+	fullTextIndexes map[string]*FullTextIndex
+	// name -> columnar table
+	columnTables map[string]*ColumnTable
+	// the declared fields of the table, nil if no schema
+	tableSchema *common.TableSchema
 }
 
 func NewIndexContainer() *TableIndexContainer {
 	return &TableIndexContainer{
-		hsetIndexes: make(map[string]*HsetIndex),
-		jsonIndexes: make(map[string]*JSONIndex),
+		hsetIndexes:     make(map[string]*HsetIndex),
+		jsonIndexes:     make(map[string]*JSONIndex),
+		fullTextIndexes: make(map[string]*FullTextIndex),
+		columnTables:    make(map[string]*ColumnTable),
 	}
 }
 
@@ -73,9 +94,59 @@ func (tic *TableIndexContainer) unmarshalHsetIndexes(table []byte, data []byte)
 	return nil
 }
 
+// get the full text indexes which should be updated while writing
+func (tic *TableIndexContainer) GetFullTextIndexesNoLock() []*FullTextIndex {
+	if len(tic.fullTextIndexes) == 0 {
+		return nil
+	}
+	indexes := make([]*FullTextIndex, 0, len(tic.fullTextIndexes))
+	for _, index := range tic.fullTextIndexes {
+		if index.State == InitIndex {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// only one full text index which is not deleted is allowed for a table
+func (tic *TableIndexContainer) GetFullTextIndexForSearchNoLock() *FullTextIndex {
+	for _, index := range tic.fullTextIndexes {
+		if index.State == InitIndex || index.State == DeletedIndex {
+			continue
+		}
+		return index
+	}
+	return nil
+}
+
+func (tic *TableIndexContainer) marshalFullTextIndexes() ([]byte, error) {
+	var indexList FullTextIndexList
+	for _, v := range tic.fullTextIndexes {
+		indexList.FulltextIndexes = append(indexList.FulltextIndexes, v.FullTextIndexInfo)
+	}
+	return indexList.Marshal()
+}
+
+func (tic *TableIndexContainer) unmarshalFullTextIndexes(table []byte, data []byte) error {
+	var indexList FullTextIndexList
+	err := indexList.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	tic.fullTextIndexes = make(map[string]*FullTextIndex)
+	for _, v := range indexList.FulltextIndexes {
+		var fi FullTextIndex
+		fi.FullTextIndexInfo = v
+		fi.Table = table
+		tic.fullTextIndexes[string(v.Name)] = &fi
+	}
+	dbLog.Infof("load full text index: %v", indexList.String())
+	return nil
+}
+
 func (tic *TableIndexContainer) GetJSONIndexNoLock(path string) *JSONIndex {
-	// TODO: path need to be converted to canonical form
-	index, ok := tic.jsonIndexes[path]
+	index, ok := tic.jsonIndexes[convertJSONPath([]byte(path))]
 	if !ok {
 		return nil
 	}
@@ -85,18 +156,200 @@ func (tic *TableIndexContainer) GetJSONIndexNoLock(path string) *JSONIndex {
 	return index
 }
 
+// get the json indexes which should be updated while writing
+func (tic *TableIndexContainer) GetJSONIndexesNoLock() []*JSONIndex {
+	if len(tic.jsonIndexes) == 0 {
+		return nil
+	}
+	indexes := make([]*JSONIndex, 0, len(tic.jsonIndexes))
+	for _, index := range tic.jsonIndexes {
+		if index.State == InitIndex {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+func (tic *TableIndexContainer) marshalJSONIndexes() ([]byte, error) {
+	var indexList HsetIndexList
+	for _, v := range tic.jsonIndexes {
+		indexList.HsetIndexes = append(indexList.HsetIndexes, v.HsetIndexInfo)
+	}
+	return indexList.Marshal()
+}
+
+func (tic *TableIndexContainer) unmarshalJSONIndexes(table []byte, data []byte) error {
+	var indexList HsetIndexList
+	err := indexList.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	tic.jsonIndexes = make(map[string]*JSONIndex)
+	for _, v := range indexList.HsetIndexes {
+		// the index saved by the old version may use the path not normalized
+		jindex := newJSONIndex(table, v)
+		jindex.IndexField = []byte(convertJSONPath(v.IndexField))
+		tic.jsonIndexes[string(jindex.IndexField)] = jindex
+	}
+	dbLog.Infof("load json index: %v", indexList.String())
+	return nil
+}
+
+func (tic *TableIndexContainer) getJSONIndexSchemasNoLock() []*common.JSONIndexSchema {
+	var schemas []*common.JSONIndexSchema
+	for _, v := range tic.jsonIndexes {
+		schemas = append(schemas, &common.JSONIndexSchema{
+			Name:      string(v.Name),
+			Path:      string(v.IndexField),
+			PrefixLen: v.PrefixLen,
+			ValueType: common.IndexPropertyDType(v.ValueType),
+			State:     common.IndexState(v.State),
+		})
+	}
+	return schemas
+}
+
+func (tic *TableIndexContainer) getHsetIndexSchemasNoLock() []*common.HsetIndexSchema {
+	var schemas []*common.HsetIndexSchema
+	for _, v := range tic.hsetIndexes {
+		s := &common.HsetIndexSchema{
+			Name:       string(v.Name),
+			IndexField: string(v.IndexField),
+			PrefixLen:  v.PrefixLen,
+			Unique:     v.Unique,
+			ValueType:  common.IndexPropertyDType(v.ValueType),
+			State:      common.IndexState(v.State),
+		}
+		for _, f := range v.CompositeFields {
+			s.CompositeFields = append(s.CompositeFields, common.HsetIndexFieldSchema{
+				Field:     string(f.Field),
+				ValueType: common.IndexPropertyDType(f.ValueType),
+			})
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas
+}
+
+// get the composite hash indexes which should be updated while writing
+func (tic *TableIndexContainer) GetCompositeHIndexesNoLock() []*HsetIndex {
+	var indexes []*HsetIndex
+	for _, index := range tic.hsetIndexes {
+		if index.State == InitIndex || !index.IsComposite() {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+func (tic *TableIndexContainer) getFullTextIndexSchemasNoLock() []*common.FullTextIndexSchema {
+	var schemas []*common.FullTextIndexSchema
+	for _, v := range tic.fullTextIndexes {
+		s := &common.FullTextIndexSchema{
+			Name:  string(v.Name),
+			State: common.IndexState(v.State),
+		}
+		for _, f := range v.HashFields {
+			s.HashFields = append(s.HashFields, string(f))
+		}
+		for _, p := range v.JsonPaths {
+			s.JSONPaths = append(s.JSONPaths, string(p))
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas
+}
+
+// get the columnar table which should be updated while writing
+func (tic *TableIndexContainer) GetColumnTableNoLock() *ColumnTable {
+	for _, ct := range tic.columnTables {
+		if ct.State == InitIndex {
+			continue
+		}
+		return ct
+	}
+	return nil
+}
+
+// only one columnar table which is not deleted is allowed for a table
+func (tic *TableIndexContainer) GetColumnTableForReadNoLock() *ColumnTable {
+	for _, ct := range tic.columnTables {
+		if ct.State == InitIndex || ct.State == DeletedIndex {
+			continue
+		}
+		return ct
+	}
+	return nil
+}
+
+func (tic *TableIndexContainer) marshalColumnTables() ([]byte, error) {
+	var ctList ColumnTableList
+	for _, v := range tic.columnTables {
+		ctList.ColumnTables = append(ctList.ColumnTables, v.ColumnTableInfo)
+	}
+	return ctList.Marshal()
+}
+
+func (tic *TableIndexContainer) unmarshalColumnTables(table []byte, data []byte) error {
+	var ctList ColumnTableList
+	err := ctList.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	tic.columnTables = make(map[string]*ColumnTable)
+	for _, v := range ctList.ColumnTables {
+		ct := &ColumnTable{}
+		ct.ColumnTableInfo = v
+		ct.Table = table
+		tic.columnTables[string(v.Name)] = ct
+	}
+	dbLog.Infof("load column table: %v", ctList.String())
+	return nil
+}
+
+func (tic *TableIndexContainer) getColumnTableSchemasNoLock() []*common.ColumnTableSchema {
+	var schemas []*common.ColumnTableSchema
+	for _, v := range tic.columnTables {
+		s := &common.ColumnTableSchema{
+			Name:  string(v.Name),
+			State: common.IndexState(v.State),
+		}
+		for _, c := range v.Columns {
+			s.Columns = append(s.Columns, string(c))
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas
+}
+
 type IndexMgr struct {
 	sync.RWMutex
 	tableIndexes   map[string]*TableIndexContainer
 	closeChan      chan struct{}
 	indexBuildChan chan int
 	wg             sync.WaitGroup
+	// whether there is any column data not committed in the batched write
+	columnPending  int32
+	pendingMu      sync.Mutex
+	pendingColumns map[*ColumnTable]struct{}
+	// the unique index keys changed in the batched write, shared by all hash indexes
+	uniquePending *uniquePendingKeys
+	// the progress of the index build and verify jobs
+	jobMu sync.Mutex
+	jobs  map[string]*indexJob
+	// the max keys scanned per second by the index jobs
+	jobRateLimit int64
+	jobPaused    int32
 }
 
 func NewIndexMgr() *IndexMgr {
 	return &IndexMgr{
 		tableIndexes:   make(map[string]*TableIndexContainer),
 		indexBuildChan: make(chan int, 10),
+		uniquePending:  &uniquePendingKeys{},
+		jobs:           make(map[string]*indexJob),
 	}
 }
 
@@ -111,19 +364,11 @@ func (im *IndexMgr) GetAllIndexSchemaInfo(db *RockDB) (map[string]*common.IndexS
 	for name, t := range im.tableIndexes {
 		var schema common.IndexSchema
 		t.RLock()
-		for _, v := range t.hsetIndexes {
-			schema.HsetIndexes = append(schema.HsetIndexes, &common.HsetIndexSchema{
-				Name:       string(v.Name),
-				IndexField: string(v.IndexField),
-				PrefixLen:  v.PrefixLen,
-				Unique:     v.Unique,
-				ValueType:  common.IndexPropertyDType(v.ValueType),
-				State:      common.IndexState(v.State),
-			})
-		}
-		//for _, v := range t.jsonIndexes {
-		//	schema.JSONIndexes = append(schema.JSONIndexes, common.JSONIndexSchema{})
-		//}
+		schema.HsetIndexes = t.getHsetIndexSchemasNoLock()
+		schema.JSONIndexes = t.getJSONIndexSchemasNoLock()
+		schema.FullTextIndexes = t.getFullTextIndexSchemasNoLock()
+		schema.ColumnTables = t.getColumnTableSchemasNoLock()
+		schema.TableSchema = t.tableSchema
 		t.RUnlock()
 		schemas[name] = &schema
 	}
@@ -144,19 +389,11 @@ func (im *IndexMgr) GetIndexSchemaInfo(db *RockDB, table string) (*common.IndexS
 		return nil, ErrIndexTableNotExist
 	}
 	t.RLock()
-	for _, v := range t.hsetIndexes {
-		schema.HsetIndexes = append(schema.HsetIndexes, &common.HsetIndexSchema{
-			Name:       string(v.Name),
-			IndexField: string(v.IndexField),
-			PrefixLen:  v.PrefixLen,
-			Unique:     v.Unique,
-			ValueType:  common.IndexPropertyDType(v.ValueType),
-			State:      common.IndexState(v.State),
-		})
-	}
-	//for _, v := range t.jsonIndexes {
-	//	schema.JSONIndexes = append(schema.JSONIndexes, common.JSONIndexSchema{})
-	//}
+	schema.HsetIndexes = t.getHsetIndexSchemasNoLock()
+	schema.JSONIndexes = t.getJSONIndexSchemasNoLock()
+	schema.FullTextIndexes = t.getFullTextIndexSchemasNoLock()
+	schema.ColumnTables = t.getColumnTableSchemasNoLock()
+	schema.TableSchema = t.tableSchema
 	t.RUnlock()
 	return &schema, nil
 }
@@ -181,11 +418,99 @@ func (im *IndexMgr) LoadIndexes(db *RockDB) error {
 			dbLog.Infof("unmarshal table %v hset indexes failed: %v", string(t), err)
 			return err
 		}
+		for _, hindex := range indexes.hsetIndexes {
+			hindex.uniquePending = im.uniquePending
+		}
 		dbLog.Infof("table %v load %v hash indexes", string(t), len(indexes.hsetIndexes))
 		im.Lock()
 		im.tableIndexes[string(t)] = indexes
 		im.Unlock()
 	}
+	tables = db.GetJSONIndexTables()
+	for _, t := range tables {
+		d, err := db.GetTableJSONIndexValue(t)
+		if err != nil {
+			dbLog.Infof("get table %v json index failed: %v", string(t), err)
+			continue
+		}
+		if d == nil {
+			dbLog.Infof("get table %v json index empty", string(t))
+			continue
+		}
+		im.Lock()
+		indexes, ok := im.tableIndexes[string(t)]
+		if !ok {
+			indexes = NewIndexContainer()
+			im.tableIndexes[string(t)] = indexes
+		}
+		im.Unlock()
+		indexes.Lock()
+		err = indexes.unmarshalJSONIndexes(t, d)
+		indexes.Unlock()
+		if err != nil {
+			dbLog.Infof("unmarshal table %v json indexes failed: %v", string(t), err)
+			return err
+		}
+		dbLog.Infof("table %v load %v json indexes", string(t), len(indexes.jsonIndexes))
+	}
+	tables = db.GetFullTextIndexTables()
+	for _, t := range tables {
+		d, err := db.GetTableFullTextIndexValue(t)
+		if err != nil {
+			dbLog.Infof("get table %v full text index failed: %v", string(t), err)
+			continue
+		}
+		if d == nil {
+			dbLog.Infof("get table %v full text index empty", string(t))
+			continue
+		}
+		im.Lock()
+		indexes, ok := im.tableIndexes[string(t)]
+		if !ok {
+			indexes = NewIndexContainer()
+			im.tableIndexes[string(t)] = indexes
+		}
+		im.Unlock()
+		indexes.Lock()
+		err = indexes.unmarshalFullTextIndexes(t, d)
+		indexes.Unlock()
+		if err != nil {
+			dbLog.Infof("unmarshal table %v full text indexes failed: %v", string(t), err)
+			return err
+		}
+		dbLog.Infof("table %v load %v full text indexes", string(t), len(indexes.fullTextIndexes))
+	}
+	tables = db.GetColumnTables()
+	for _, t := range tables {
+		d, err := db.GetTableColumnTableValue(t)
+		if err != nil {
+			dbLog.Infof("get table %v column table failed: %v", string(t), err)
+			continue
+		}
+		if d == nil {
+			dbLog.Infof("get table %v column table empty", string(t))
+			continue
+		}
+		im.Lock()
+		indexes, ok := im.tableIndexes[string(t)]
+		if !ok {
+			indexes = NewIndexContainer()
+			im.tableIndexes[string(t)] = indexes
+		}
+		im.Unlock()
+		indexes.Lock()
+		err = indexes.unmarshalColumnTables(t, d)
+		indexes.Unlock()
+		if err != nil {
+			dbLog.Infof("unmarshal table %v column tables failed: %v", string(t), err)
+			return err
+		}
+		dbLog.Infof("table %v load %v column tables", string(t), len(indexes.columnTables))
+	}
+	err := im.loadTableSchemas(db)
+	if err != nil {
+		return err
+	}
 
 	im.Lock()
 	if im.closeChan != nil {
@@ -240,6 +565,7 @@ func (im *IndexMgr) AddHsetIndex(db *RockDB, hindex *HsetIndex) error {
 		return ErrIndexExist
 	}
 	hindex.State = InitIndex
+	hindex.uniquePending = im.uniquePending
 	indexes.hsetIndexes[string(hindex.IndexField)] = hindex
 	d, err := indexes.marshalHsetIndexes()
 	if err != nil {
@@ -374,11 +700,24 @@ func (im *IndexMgr) GetHsetIndex(table string, field string) (*HsetIndex, error)
 	return index, nil
 }
 
+func (im *IndexMgr) GetCompositeHsetIndexes(table string) []*HsetIndex {
+	indexes := im.GetTableIndexes(table)
+	if indexes == nil {
+		return nil
+	}
+	indexes.RLock()
+	defer indexes.RUnlock()
+	return indexes.GetCompositeHIndexesNoLock()
+}
+
 func (im *IndexMgr) buildIndexes(db *RockDB, stopChan chan struct{}) {
 	for {
 		select {
 		case <-im.indexBuildChan:
 			im.dobuildIndexes(db, stopChan)
+			im.dobuildJSONIndexes(db, stopChan)
+			im.dobuildFullTextIndexes(db, stopChan)
+			im.dobuildColumnTables(db, stopChan)
 		case <-stopChan:
 			return
 		}
@@ -402,10 +741,14 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 		}
 		dbLog.Infof("begin rebuild index for table %v", table)
 		fields := make([][]byte, 0)
+		names := make([]string, 0)
 		for _, hindex := range tmpHsetIndexes {
 			fields = append(fields, hindex.IndexField)
+			names = append(names, string(hindex.Name))
 			dbLog.Infof("begin rebuild index for field: %s", string(hindex.IndexField))
 		}
+		// the build jobs are waited before next build, so the last build job of the table is always done
+		job, _ := im.startIndexJob(db, common.IndexJobBuild, table, "", names)
 
 		buildWg.Add(1)
 		go func(buildTable string, t *TableIndexContainer) {
@@ -415,7 +758,20 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 			origPrefix := cursor
 			indexPKCnt := 0
 			pkList := make([][]byte, 0, buildIndexBlock)
+			// the index is cancelled if the state is changed while building
+			isCancelled := func() bool {
+				t.RLock()
+				defer t.RUnlock()
+				for _, hindex := range tmpHsetIndexes {
+					if hindex.State == BuildingIndex {
+						return false
+					}
+				}
+				return true
+			}
 			for {
+				begin := time.Now()
+				blockCnt := indexPKCnt
 				done, err := func() (bool, error) {
 					t.Lock()
 					defer t.Unlock()
@@ -425,6 +781,21 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 						return true, ErrIndexClosed
 					default:
 					}
+					buildingIndexes := tmpHsetIndexes[:0]
+					buildingFields := fields[:0]
+					for _, hindex := range tmpHsetIndexes {
+						if hindex.State != BuildingIndex {
+							dbLog.Infof("rebuild index %s for table %v cancelled", string(hindex.Name), buildTable)
+							continue
+						}
+						buildingIndexes = append(buildingIndexes, hindex)
+						buildingFields = append(buildingFields, hindex.IndexField)
+					}
+					tmpHsetIndexes = buildingIndexes
+					fields = buildingFields
+					if len(tmpHsetIndexes) == 0 {
+						return true, errIndexBuildCancelled
+					}
 
 					if cap(pkList) < buildIndexBlock {
 						pkList = make([][]byte, 0, buildIndexBlock)
@@ -438,6 +809,18 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 					}
 					wb := db.rockEng.NewWriteBatch()
 					defer wb.Destroy()
+					// the unique keys in this block are not committed, so we track them
+					// in the block to find the duplicated values
+					blockPending := &uniquePendingKeys{}
+					blockIndexes := make([]*HsetIndex, 0, len(tmpHsetIndexes))
+					for _, hindex := range tmpHsetIndexes {
+						if hindex.Unique == 1 {
+							bindex := *hindex
+							bindex.uniquePending = blockPending
+							hindex = &bindex
+						}
+						blockIndexes = append(blockIndexes, hindex)
+					}
 					for _, pk := range pkList {
 						if !bytes.HasPrefix(pk, origPrefix) {
 							dbLog.Infof("rebuild index for table %v end at: %v, next is: %v",
@@ -450,8 +833,29 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 							dbLog.Infof("rebuild index for table %v error %v ", buildTable, err)
 							return true, err
 						}
-						for i := range fields {
-							err = tmpHsetIndexes[i].UpdateRec(nil, values[i], pk, wb)
+						for i, hindex := range blockIndexes {
+							if hindex.IsComposite() {
+								var cvalues [][]byte
+								cvalues, err = db.HMget(pk, hindex.compositeFieldNames()...)
+								if err == nil {
+									err = hindex.checkUniqueCompositeRec(db, cvalues, pk)
+								}
+								if err == nil {
+									err = hindex.UpdateCompositeRec(db, nil, cvalues, pk, wb)
+								}
+							} else {
+								err = hindex.checkUniqueRec(db, values[i], pk)
+								if err == nil {
+									err = hindex.UpdateRec(db, nil, values[i], pk, wb)
+								}
+							}
+							if err == ErrIndexUniqueConflict {
+								// keep the first indexed key for the existing duplicated values
+								dbLog.Warningf("rebuild unique index %s for table %v ignored duplicated value of: %s",
+									string(hindex.Name), buildTable, string(pk))
+								err = nil
+								continue
+							}
 							if err != nil {
 								dbLog.Infof("rebuild index for table %v error %v ", buildTable, err)
 								return true, err
@@ -464,6 +868,7 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 						cursor = nil
 					}
 					db.rockEng.Write(wb)
+					job.addScanned(indexPKCnt-blockCnt, 0, 0, 0)
 					if len(cursor) == 0 {
 						return true, nil
 					} else {
@@ -472,12 +877,18 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 					}
 					return false, nil
 				}()
+				if !done && !im.throttleIndexJob(job, indexPKCnt-blockCnt, time.Since(begin), stopChan, isCancelled) {
+					done = true
+					err = ErrIndexClosed
+				}
 				if done {
-					dbLog.Infof("finish rebuild index for table %v, total: %v", string(buildTable), indexPKCnt)
+					dbLog.Infof("finish rebuild index for table %v, total: %v, err: %v", string(buildTable), indexPKCnt, err)
+					job.finish(err)
 					t.Lock()
 					for _, f := range fields {
 						hindex, ok := t.hsetIndexes[string(f)]
-						if ok {
+						// the cancelled index should not be changed
+						if ok && hindex.State == BuildingIndex {
 							if err != nil {
 								hindex.State = InitIndex
 							} else {
@@ -495,3 +906,782 @@ func (im *IndexMgr) dobuildIndexes(db *RockDB, stopChan chan struct{}) {
 
 	buildWg.Wait()
 }
+
+func (im *IndexMgr) AddJSONIndex(db *RockDB, jindex *JSONIndex) error {
+	jpath := convertJSONPath(jindex.IndexField)
+	if jpath == "" || isJSONPath(jpath) {
+		// the JSONPath which may match several values can not be indexed
+		return errJSONPathNotSupport
+	}
+	jindex.IndexField = []byte(jpath)
+	jindex.indexDataType = jsonIndexDataType
+	im.Lock()
+	indexes, ok := im.tableIndexes[string(jindex.Table)]
+	if !ok {
+		indexes = NewIndexContainer()
+		im.tableIndexes[string(jindex.Table)] = indexes
+	}
+	im.Unlock()
+	indexes.Lock()
+	defer indexes.Unlock()
+	_, ok = indexes.jsonIndexes[jpath]
+	if ok {
+		return ErrIndexExist
+	}
+	jindex.State = InitIndex
+	indexes.jsonIndexes[jpath] = jindex
+	d, err := indexes.marshalJSONIndexes()
+	if err != nil {
+		delete(indexes.jsonIndexes, jpath)
+		return err
+	}
+	err = db.SetTableJSONIndexValue(jindex.Table, d)
+	if err != nil {
+		delete(indexes.jsonIndexes, jpath)
+		return err
+	}
+	dbLog.Infof("table %v add json index %v", string(jindex.Table), jindex.String())
+	return nil
+}
+
+func (im *IndexMgr) UpdateJSONIndexState(db *RockDB, table string, path string, state IndexState) error {
+	im.RLock()
+	isClosed := im.closeChan == nil
+	indexes, ok := im.tableIndexes[table]
+	im.RUnlock()
+	if !ok {
+		return ErrIndexTableNotExist
+	}
+	if isClosed {
+		return ErrIndexClosed
+	}
+
+	jpath := convertJSONPath([]byte(path))
+	indexes.Lock()
+	defer indexes.Unlock()
+	index, ok := indexes.jsonIndexes[jpath]
+	if !ok {
+		return ErrIndexNotExist
+	}
+	if index.State == state {
+		return nil
+	}
+	oldState := index.State
+	index.State = state
+	d, err := indexes.marshalJSONIndexes()
+	if err != nil {
+		index.State = oldState
+		return err
+	}
+	err = db.SetTableJSONIndexValue([]byte(table), d)
+	if err != nil {
+		index.State = oldState
+		return err
+	}
+	dbLog.Infof("table %v json index %v state updated from %v to %v", table, jpath, oldState, state)
+	if index.State == DeletedIndex {
+		im.wg.Add(1)
+		go func() {
+			defer im.wg.Done()
+			err := index.cleanAll(db, im.closeChan)
+			if err != nil {
+				dbLog.Infof("failed to clean json index: %v", err)
+			} else {
+				im.deleteJSONIndex(db, string(index.Table), string(index.IndexField))
+			}
+		}()
+	} else if index.State == BuildingIndex {
+		select {
+		case im.indexBuildChan <- 1:
+		default:
+		}
+	}
+	return nil
+}
+
+func (im *IndexMgr) deleteJSONIndex(db *RockDB, table string, path string) error {
+	im.Lock()
+	indexes, ok := im.tableIndexes[table]
+	im.Unlock()
+	if !ok {
+		return ErrIndexTableNotExist
+	}
+
+	jpath := convertJSONPath([]byte(path))
+	indexes.Lock()
+	defer indexes.Unlock()
+	jindex, ok := indexes.jsonIndexes[jpath]
+	if !ok {
+		return ErrIndexNotExist
+	}
+	if jindex.State != DeletedIndex {
+		return ErrIndexDeleteNotInDeleted
+	}
+	delete(indexes.jsonIndexes, jpath)
+	d, err := indexes.marshalJSONIndexes()
+	if err != nil {
+		return err
+	}
+	return db.SetTableJSONIndexValue([]byte(table), d)
+}
+
+func (im *IndexMgr) GetJSONIndex(table string, path string) (*JSONIndex, error) {
+	indexes := im.GetTableIndexes(table)
+	if indexes == nil {
+		return nil, ErrIndexTableNotExist
+	}
+	indexes.RLock()
+	defer indexes.RUnlock()
+	index, ok := indexes.jsonIndexes[convertJSONPath([]byte(path))]
+	if !ok {
+		return nil, ErrIndexNotExist
+	}
+	return index, nil
+}
+
+func (im *IndexMgr) dobuildJSONIndexes(db *RockDB, stopChan chan struct{}) {
+	var buildWg sync.WaitGroup
+	im.Lock()
+	for table, v := range im.tableIndexes {
+		var buildingIndexes []*JSONIndex
+		v.RLock()
+		for _, jindex := range v.jsonIndexes {
+			if jindex.State == BuildingIndex {
+				buildingIndexes = append(buildingIndexes, jindex)
+			}
+		}
+		v.RUnlock()
+		if len(buildingIndexes) == 0 {
+			continue
+		}
+		dbLog.Infof("begin rebuild json index for table %v", table)
+		buildWg.Add(1)
+		go func(t *TableIndexContainer, jindexes []*JSONIndex) {
+			defer buildWg.Done()
+			cnt, err := im.buildJSONIndexes(db, t, jindexes, stopChan)
+			dbLog.Infof("finish rebuild json index for table %v, total: %v, err: %v",
+				string(jindexes[0].Table), cnt, err)
+			t.Lock()
+			for _, jindex := range jindexes {
+				if jindex.State != BuildingIndex {
+					continue
+				}
+				if err != nil {
+					jindex.State = InitIndex
+				} else {
+					jindex.State = BuildDoneIndex
+				}
+			}
+			t.Unlock()
+		}(v, buildingIndexes)
+	}
+	im.Unlock()
+
+	buildWg.Wait()
+}
+
+func (im *IndexMgr) buildJSONIndexes(db *RockDB, t *TableIndexContainer,
+	jindexes []*JSONIndex, stopChan chan struct{}) (int, error) {
+	table := jindexes[0].Table
+	start, err := encodeJSONStartKey(table)
+	if err != nil {
+		return 0, err
+	}
+	stop := encodeJSONStopKey(table, nil)
+	indexPKCnt := 0
+	for {
+		done, err := func() (bool, error) {
+			t.Lock()
+			defer t.Unlock()
+			select {
+			case <-stopChan:
+				return true, ErrIndexClosed
+			default:
+			}
+			it, err := db.NewDBRangeLimitIterator(start, stop, common.RangeROpen, 0, buildIndexBlock, false)
+			if err != nil {
+				return true, err
+			}
+			defer it.Close()
+			wb := db.rockEng.NewWriteBatch()
+			defer wb.Destroy()
+			n := 0
+			var lastKey []byte
+			for ; it.Valid(); it.Next() {
+				n++
+				lastKey = it.Key()
+				table, rk, err := decodeJSONKey(lastKey)
+				if err != nil {
+					continue
+				}
+				v := it.Value()
+				if len(v) >= tsLen {
+					v = v[:len(v)-tsLen]
+				}
+				if decodeChunkManifest(v) != nil {
+					// the large json is chunked, read the whole json for index
+					_, v, _, err = db.getOldJSON(table, rk)
+					if err != nil {
+						return true, err
+					}
+				}
+				pk := packRedisKey(table, rk)
+				for _, jindex := range jindexes {
+					err = jindex.UpdateRec(db, nil, jindex.indexValue(v), pk, wb)
+					if err != nil {
+						return true, err
+					}
+				}
+				indexPKCnt++
+			}
+			err = db.rockEng.Write(wb)
+			if err != nil {
+				return true, err
+			}
+			if n < buildIndexBlock {
+				return true, nil
+			}
+			// the next block begin after the last key
+			start = append(lastKey, 0)
+			return false, nil
+		}()
+		if done {
+			return indexPKCnt, err
+		}
+	}
+}
+
+func (im *IndexMgr) AddFullTextIndex(db *RockDB, findex *FullTextIndex) error {
+	im.Lock()
+	indexes, ok := im.tableIndexes[string(findex.Table)]
+	if !ok {
+		indexes = NewIndexContainer()
+		im.tableIndexes[string(findex.Table)] = indexes
+	}
+	im.Unlock()
+	indexes.Lock()
+	defer indexes.Unlock()
+	_, ok = indexes.fullTextIndexes[string(findex.Name)]
+	if ok {
+		return ErrIndexExist
+	}
+	findex.State = InitIndex
+	indexes.fullTextIndexes[string(findex.Name)] = findex
+	d, err := indexes.marshalFullTextIndexes()
+	if err != nil {
+		delete(indexes.fullTextIndexes, string(findex.Name))
+		return err
+	}
+	err = db.SetTableFullTextIndexValue(findex.Table, d)
+	if err != nil {
+		delete(indexes.fullTextIndexes, string(findex.Name))
+		return err
+	}
+	dbLog.Infof("table %v add full text index %v", string(findex.Table), findex.String())
+	return nil
+}
+
+func (im *IndexMgr) UpdateFullTextIndexState(db *RockDB, table string, name string, state IndexState) error {
+	im.RLock()
+	isClosed := im.closeChan == nil
+	indexes, ok := im.tableIndexes[table]
+	im.RUnlock()
+	if !ok {
+		return ErrIndexTableNotExist
+	}
+	if isClosed {
+		return ErrIndexClosed
+	}
+
+	indexes.Lock()
+	defer indexes.Unlock()
+	index, ok := indexes.fullTextIndexes[name]
+	if !ok {
+		return ErrIndexNotExist
+	}
+	if index.State == state {
+		return nil
+	}
+	oldState := index.State
+	index.State = state
+	d, err := indexes.marshalFullTextIndexes()
+	if err != nil {
+		index.State = oldState
+		return err
+	}
+	err = db.SetTableFullTextIndexValue([]byte(table), d)
+	if err != nil {
+		index.State = oldState
+		return err
+	}
+	dbLog.Infof("table %v full text index %v state updated from %v to %v", table, name, oldState, state)
+	if index.State == DeletedIndex {
+		im.wg.Add(1)
+		go func() {
+			defer im.wg.Done()
+			err := index.cleanAll(db, im.closeChan)
+			if err != nil {
+				dbLog.Infof("failed to clean full text index: %v", err)
+			} else {
+				im.deleteFullTextIndex(db, string(index.Table), string(index.Name))
+			}
+		}()
+	} else if index.State == BuildingIndex {
+		select {
+		case im.indexBuildChan <- 1:
+		default:
+		}
+	}
+	return nil
+}
+
+func (im *IndexMgr) deleteFullTextIndex(db *RockDB, table string, name string) error {
+	im.Lock()
+	indexes, ok := im.tableIndexes[table]
+	im.Unlock()
+	if !ok {
+		return ErrIndexTableNotExist
+	}
+
+	indexes.Lock()
+	defer indexes.Unlock()
+	findex, ok := indexes.fullTextIndexes[name]
+	if !ok {
+		return ErrIndexNotExist
+	}
+	if findex.State != DeletedIndex {
+		return ErrIndexDeleteNotInDeleted
+	}
+	delete(indexes.fullTextIndexes, name)
+	d, err := indexes.marshalFullTextIndexes()
+	if err != nil {
+		return err
+	}
+	return db.SetTableFullTextIndexValue([]byte(table), d)
+}
+
+// the stats of the full text index may be changed by the aborted write batch,
+// so we need reload it from db while searching.
+func (im *IndexMgr) resetFullTextStats() {
+	im.RLock()
+	defer im.RUnlock()
+	for _, t := range im.tableIndexes {
+		t.Lock()
+		for _, findex := range t.fullTextIndexes {
+			findex.statsLoaded = false
+		}
+		t.Unlock()
+	}
+}
+
+func (im *IndexMgr) dobuildFullTextIndexes(db *RockDB, stopChan chan struct{}) {
+	var buildWg sync.WaitGroup
+	im.Lock()
+	for table, v := range im.tableIndexes {
+		v.RLock()
+		for _, findex := range v.fullTextIndexes {
+			if findex.State != BuildingIndex {
+				continue
+			}
+			dbLog.Infof("begin rebuild full text index %v for table %v", string(findex.Name), table)
+			buildWg.Add(1)
+			go func(t *TableIndexContainer, findex *FullTextIndex) {
+				defer buildWg.Done()
+				var cnt int
+				var err error
+				if len(findex.JsonPaths) > 0 {
+					cnt, err = im.buildJSONFullTextIndex(db, t, findex, stopChan)
+				} else {
+					cnt, err = im.buildHashFullTextIndex(db, t, findex, stopChan)
+				}
+				dbLog.Infof("finish rebuild full text index %v for table %v, total: %v, err: %v",
+					string(findex.Name), string(findex.Table), cnt, err)
+				t.Lock()
+				if findex.State == BuildingIndex {
+					if err != nil {
+						findex.State = InitIndex
+					} else {
+						findex.State = BuildDoneIndex
+					}
+				}
+				t.Unlock()
+			}(v, findex)
+		}
+		v.RUnlock()
+	}
+	im.Unlock()
+
+	buildWg.Wait()
+}
+
+func (im *IndexMgr) buildHashFullTextIndex(db *RockDB, t *TableIndexContainer,
+	findex *FullTextIndex, stopChan chan struct{}) (int, error) {
+	cursor := []byte(findex.Table)
+	cursor = append(cursor, common.NamespaceTableSeperator)
+	origPrefix := cursor
+	indexPKCnt := 0
+	pkList := make([][]byte, 0, buildIndexBlock)
+	for {
+		done, err := func() (bool, error) {
+			t.Lock()
+			defer t.Unlock()
+			select {
+			case <-stopChan:
+				return true, ErrIndexClosed
+			default:
+			}
+			var err error
+			pkList, err = db.ScanWithBuffer(common.HASH, cursor, buildIndexBlock, "", pkList[:0], false)
+			if err != nil {
+				return true, err
+			}
+			wb := db.rockEng.NewWriteBatch()
+			defer wb.Destroy()
+			for _, pk := range pkList {
+				if !bytes.HasPrefix(pk, origPrefix) {
+					cursor = nil
+					break
+				}
+				values, err := db.HMget(pk, findex.HashFields...)
+				if err != nil {
+					return true, err
+				}
+				err = findex.UpdateDoc(db, pk, values, wb)
+				if err != nil {
+					return true, err
+				}
+				cursor = pk
+				indexPKCnt++
+			}
+			if len(pkList) < buildIndexBlock {
+				cursor = nil
+			}
+			err = db.rockEng.Write(wb)
+			if err != nil {
+				return true, err
+			}
+			return len(cursor) == 0, nil
+		}()
+		if done {
+			return indexPKCnt, err
+		}
+	}
+}
+
+func (im *IndexMgr) buildJSONFullTextIndex(db *RockDB, t *TableIndexContainer,
+	findex *FullTextIndex, stopChan chan struct{}) (int, error) {
+	start, err := encodeJSONStartKey(findex.Table)
+	if err != nil {
+		return 0, err
+	}
+	stop := encodeJSONStopKey(findex.Table, nil)
+	indexPKCnt := 0
+	for {
+		done, err := func() (bool, error) {
+			t.Lock()
+			defer t.Unlock()
+			select {
+			case <-stopChan:
+				return true, ErrIndexClosed
+			default:
+			}
+			it, err := db.NewDBRangeLimitIterator(start, stop, common.RangeROpen, 0, buildIndexBlock, false)
+			if err != nil {
+				return true, err
+			}
+			defer it.Close()
+			wb := db.rockEng.NewWriteBatch()
+			defer wb.Destroy()
+			n := 0
+			var lastKey []byte
+			for ; it.Valid(); it.Next() {
+				n++
+				lastKey = it.Key()
+				table, rk, err := decodeJSONKey(lastKey)
+				if err != nil {
+					continue
+				}
+				v := it.Value()
+				if len(v) >= tsLen {
+					v = v[:len(v)-tsLen]
+				}
+				if decodeChunkManifest(v) != nil {
+					// the large json is chunked, read the whole json for index
+					_, v, _, err = db.getOldJSON(table, rk)
+					if err != nil {
+						return true, err
+					}
+				}
+				pk := packRedisKey(table, rk)
+				texts := getJSONFullTextValues(v, findex.JsonPaths)
+				err = findex.UpdateDoc(db, pk, texts, wb)
+				if err != nil {
+					return true, err
+				}
+				indexPKCnt++
+			}
+			err = db.rockEng.Write(wb)
+			if err != nil {
+				return true, err
+			}
+			if n < buildIndexBlock {
+				return true, nil
+			}
+			// the next block begin after the last key
+			start = append(lastKey, 0)
+			return false, nil
+		}()
+		if done {
+			return indexPKCnt, err
+		}
+	}
+}
+
+func (im *IndexMgr) AddColumnTable(db *RockDB, ct *ColumnTable) error {
+	im.Lock()
+	indexes, ok := im.tableIndexes[string(ct.Table)]
+	if !ok {
+		indexes = NewIndexContainer()
+		im.tableIndexes[string(ct.Table)] = indexes
+	}
+	im.Unlock()
+	indexes.Lock()
+	defer indexes.Unlock()
+	_, ok = indexes.columnTables[string(ct.Name)]
+	if ok {
+		return ErrIndexExist
+	}
+	ct.State = InitIndex
+	indexes.columnTables[string(ct.Name)] = ct
+	d, err := indexes.marshalColumnTables()
+	if err != nil {
+		delete(indexes.columnTables, string(ct.Name))
+		return err
+	}
+	err = db.SetTableColumnTableValue(ct.Table, d)
+	if err != nil {
+		delete(indexes.columnTables, string(ct.Name))
+		return err
+	}
+	dbLog.Infof("table %v add column table %v", string(ct.Table), ct.String())
+	return nil
+}
+
+func (im *IndexMgr) UpdateColumnTableState(db *RockDB, table string, name string, state IndexState) error {
+	im.RLock()
+	isClosed := im.closeChan == nil
+	indexes, ok := im.tableIndexes[table]
+	im.RUnlock()
+	if !ok {
+		return ErrIndexTableNotExist
+	}
+	if isClosed {
+		return ErrIndexClosed
+	}
+
+	indexes.Lock()
+	defer indexes.Unlock()
+	ct, ok := indexes.columnTables[name]
+	if !ok {
+		return ErrIndexNotExist
+	}
+	if ct.State == state {
+		return nil
+	}
+	oldState := ct.State
+	ct.State = state
+	d, err := indexes.marshalColumnTables()
+	if err != nil {
+		ct.State = oldState
+		return err
+	}
+	err = db.SetTableColumnTableValue([]byte(table), d)
+	if err != nil {
+		ct.State = oldState
+		return err
+	}
+	dbLog.Infof("table %v column table %v state updated from %v to %v", table, name, oldState, state)
+	if ct.State == DeletedIndex {
+		im.wg.Add(1)
+		go func() {
+			defer im.wg.Done()
+			err := ct.cleanAll(db, im.closeChan)
+			if err != nil {
+				dbLog.Infof("failed to clean column table: %v", err)
+			} else {
+				im.deleteColumnTable(db, string(ct.Table), string(ct.Name))
+			}
+		}()
+	} else if ct.State == BuildingIndex {
+		select {
+		case im.indexBuildChan <- 1:
+		default:
+		}
+	}
+	return nil
+}
+
+func (im *IndexMgr) deleteColumnTable(db *RockDB, table string, name string) error {
+	im.Lock()
+	indexes, ok := im.tableIndexes[table]
+	im.Unlock()
+	if !ok {
+		return ErrIndexTableNotExist
+	}
+
+	indexes.Lock()
+	defer indexes.Unlock()
+	ct, ok := indexes.columnTables[name]
+	if !ok {
+		return ErrIndexNotExist
+	}
+	if ct.State != DeletedIndex {
+		return ErrIndexDeleteNotInDeleted
+	}
+	delete(indexes.columnTables, name)
+	d, err := indexes.marshalColumnTables()
+	if err != nil {
+		return err
+	}
+	return db.SetTableColumnTableValue([]byte(table), d)
+}
+
+func (im *IndexMgr) addPendingColumnTable(ct *ColumnTable) {
+	im.pendingMu.Lock()
+	if im.pendingColumns == nil {
+		im.pendingColumns = make(map[*ColumnTable]struct{})
+	}
+	im.pendingColumns[ct] = struct{}{}
+	im.pendingMu.Unlock()
+	atomic.StoreInt32(&im.columnPending, 1)
+}
+
+// the container lock may be held by the caller, so the pending column tables
+// are tracked separately.
+func (im *IndexMgr) getPendingColumnTables() []*ColumnTable {
+	if atomic.LoadInt32(&im.columnPending) == 0 {
+		return nil
+	}
+	im.pendingMu.Lock()
+	defer im.pendingMu.Unlock()
+	cts := make([]*ColumnTable, 0, len(im.pendingColumns))
+	for ct := range im.pendingColumns {
+		cts = append(cts, ct)
+	}
+	return cts
+}
+
+// the column data in the batched write batch may be stale if the same row group is
+// changed by the separated write batch, so we put the latest data again before commit.
+func (im *IndexMgr) flushColumnPending(wb engine.WriteBatch) {
+	for _, ct := range im.getPendingColumnTables() {
+		ct.flushPending(wb)
+	}
+}
+
+// should be called after the batched write batch is committed or aborted
+func (im *IndexMgr) resetUniquePending() {
+	im.uniquePending.reset()
+}
+
+// should be called after the batched write batch is committed or aborted
+func (im *IndexMgr) resetColumnPending() {
+	if atomic.LoadInt32(&im.columnPending) == 0 {
+		return
+	}
+	im.pendingMu.Lock()
+	defer im.pendingMu.Unlock()
+	atomic.StoreInt32(&im.columnPending, 0)
+	for ct := range im.pendingColumns {
+		ct.resetPending()
+	}
+	im.pendingColumns = nil
+}
+
+func (im *IndexMgr) dobuildColumnTables(db *RockDB, stopChan chan struct{}) {
+	var buildWg sync.WaitGroup
+	im.Lock()
+	for table, v := range im.tableIndexes {
+		v.RLock()
+		for _, ct := range v.columnTables {
+			if ct.State != BuildingIndex {
+				continue
+			}
+			dbLog.Infof("begin rebuild column table %v for table %v", string(ct.Name), table)
+			buildWg.Add(1)
+			go func(t *TableIndexContainer, ct *ColumnTable) {
+				defer buildWg.Done()
+				cnt, err := im.buildColumnTable(db, t, ct, stopChan)
+				dbLog.Infof("finish rebuild column table %v for table %v, total: %v, err: %v",
+					string(ct.Name), string(ct.Table), cnt, err)
+				t.Lock()
+				if ct.State == BuildingIndex {
+					if err != nil {
+						ct.State = InitIndex
+					} else {
+						ct.State = BuildDoneIndex
+					}
+				}
+				t.Unlock()
+			}(v, ct)
+		}
+		v.RUnlock()
+	}
+	im.Unlock()
+
+	buildWg.Wait()
+}
+
+func (im *IndexMgr) buildColumnTable(db *RockDB, t *TableIndexContainer,
+	ct *ColumnTable, stopChan chan struct{}) (int, error) {
+	cursor := []byte(ct.Table)
+	cursor = append(cursor, common.NamespaceTableSeperator)
+	origPrefix := cursor
+	rowCnt := 0
+	pkList := make([][]byte, 0, buildIndexBlock)
+	for {
+		done, err := func() (bool, error) {
+			t.Lock()
+			defer t.Unlock()
+			select {
+			case <-stopChan:
+				return true, ErrIndexClosed
+			default:
+			}
+			var err error
+			pkList, err = db.ScanWithBuffer(common.HASH, cursor, buildIndexBlock, "", pkList[:0], false)
+			if err != nil {
+				return true, err
+			}
+			wb := db.rockEng.NewWriteBatch()
+			defer wb.Destroy()
+			for _, pk := range pkList {
+				if !bytes.HasPrefix(pk, origPrefix) {
+					cursor = nil
+					break
+				}
+				values, err := db.HMget(pk, ct.Columns...)
+				if err != nil {
+					return true, err
+				}
+				err = ct.UpdateRow(db, pk, values, wb)
+				if err != nil {
+					return true, err
+				}
+				cursor = pk
+				rowCnt++
+			}
+			if len(pkList) < buildIndexBlock {
+				cursor = nil
+			}
+			err = ct.commitSeparated(db, wb)
+			if err != nil {
+				return true, err
+			}
+			return len(cursor) == 0, nil
+		}()
+		if done {
+			return rowCnt, err
+		}
+	}
+}
@@ -0,0 +1,831 @@
+package rockredis
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+var (
+	ErrIndexQuerySyntax      = errors.New("invalid index query where syntax")
+	ErrIndexQueryTooComplex  = errors.New("too many conditions combined in index query")
+	ErrIndexQueryInvalidLike = errors.New("only prefix match like 'abc%' is supported")
+)
+
+const (
+	// the max number of the index range scans for a query after expanding OR and IN
+	maxIndexQueryScans = 64
+)
+
+type IndexCondOp int
+
+const (
+	IndexCondEQ IndexCondOp = iota
+	IndexCondNE
+	IndexCondGT
+	IndexCondGE
+	IndexCondLT
+	IndexCondLE
+	IndexCondIN
+	// only prefix match is supported for like, and the Values[0] is the prefix
+	IndexCondLike
+)
+
+type IndexFieldCond struct {
+	Field  []byte
+	Op     IndexCondOp
+	Values [][]byte
+}
+
+type IndexExprType int
+
+const (
+	IndexExprCond IndexExprType = iota
+	IndexExprAnd
+	IndexExprOr
+)
+
+// IndexQueryExpr is the parsed where clause for the hash index query,
+// the Cond is used for IndexExprCond and the Children is used for AND and OR.
+type IndexQueryExpr struct {
+	Type     IndexExprType
+	Cond     *IndexFieldCond
+	Children []*IndexQueryExpr
+}
+
+type indexTokenKind int
+
+const (
+	indexTokEOF indexTokenKind = iota
+	indexTokWord
+	indexTokString
+	indexTokOp
+	indexTokLParen
+	indexTokRParen
+	indexTokComma
+)
+
+type indexToken struct {
+	kind indexTokenKind
+	val  []byte
+}
+
+func (t indexToken) isKeyword(k string) bool {
+	return t.kind == indexTokWord && strings.EqualFold(string(t.val), k)
+}
+
+func isIndexWordChar(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '(', ')', ',', '=', '<', '>', '!', '\'', '"':
+		return false
+	}
+	return true
+}
+
+func tokenizeIndexQuery(where []byte) ([]indexToken, error) {
+	tokens := make([]indexToken, 0, 8)
+	for i := 0; i < len(where); {
+		c := where[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, indexToken{kind: indexTokLParen})
+			i++
+		case c == ')':
+			tokens = append(tokens, indexToken{kind: indexTokRParen})
+			i++
+		case c == ',':
+			tokens = append(tokens, indexToken{kind: indexTokComma})
+			i++
+		case c == '\'' || c == '"':
+			// the quoted string, the backslash is used to escape the next char
+			var v []byte
+			i++
+			closed := false
+			for i < len(where) {
+				if where[i] == '\\' && i+1 < len(where) {
+					v = append(v, where[i+1])
+					i += 2
+					continue
+				}
+				if where[i] == c {
+					closed = true
+					i++
+					break
+				}
+				v = append(v, where[i])
+				i++
+			}
+			if !closed {
+				return nil, ErrIndexQuerySyntax
+			}
+			if v == nil {
+				v = []byte{}
+			}
+			tokens = append(tokens, indexToken{kind: indexTokString, val: v})
+		case c == '=' || c == '<' || c == '>' || c == '!':
+			op := where[i : i+1]
+			if i+1 < len(where) && (where[i+1] == '=' || (c == '<' && where[i+1] == '>')) {
+				op = where[i : i+2]
+			}
+			if string(op) == "!" {
+				return nil, ErrIndexQuerySyntax
+			}
+			tokens = append(tokens, indexToken{kind: indexTokOp, val: op})
+			i += len(op)
+		default:
+			start := i
+			for i < len(where) && isIndexWordChar(where[i]) {
+				i++
+			}
+			tokens = append(tokens, indexToken{kind: indexTokWord, val: where[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+type indexQueryParser struct {
+	tokens []indexToken
+	pos    int
+}
+
+func (p *indexQueryParser) peek() indexToken {
+	if p.pos >= len(p.tokens) {
+		return indexToken{kind: indexTokEOF}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *indexQueryParser) next() indexToken {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *indexQueryParser) parseOr() (*IndexQueryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek().isKeyword("or") {
+		return left, nil
+	}
+	expr := &IndexQueryExpr{Type: IndexExprOr, Children: []*IndexQueryExpr{left}}
+	for p.peek().isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		expr.Children = append(expr.Children, right)
+	}
+	return expr, nil
+}
+
+func (p *indexQueryParser) parseAnd() (*IndexQueryExpr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek().isKeyword("and") {
+		return left, nil
+	}
+	expr := &IndexQueryExpr{Type: IndexExprAnd, Children: []*IndexQueryExpr{left}}
+	for p.peek().isKeyword("and") {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		expr.Children = append(expr.Children, right)
+	}
+	return expr, nil
+}
+
+func (p *indexQueryParser) parsePrimary() (*IndexQueryExpr, error) {
+	if p.peek().kind == indexTokLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != indexTokRParen {
+			return nil, ErrIndexQuerySyntax
+		}
+		return expr, nil
+	}
+	cond, err := p.parseCond()
+	if err != nil {
+		return nil, err
+	}
+	return &IndexQueryExpr{Type: IndexExprCond, Cond: cond}, nil
+}
+
+func (p *indexQueryParser) parseValue() ([]byte, error) {
+	t := p.next()
+	if t.kind != indexTokWord && t.kind != indexTokString {
+		return nil, ErrIndexQuerySyntax
+	}
+	return t.val, nil
+}
+
+func (p *indexQueryParser) parseCond() (*IndexFieldCond, error) {
+	field, err := p.parseValue()
+	if err != nil || len(field) == 0 {
+		return nil, ErrIndexQuerySyntax
+	}
+	cond := &IndexFieldCond{Field: field}
+	t := p.next()
+	switch {
+	case t.kind == indexTokOp:
+		switch string(t.val) {
+		case "=":
+			cond.Op = IndexCondEQ
+		case "!=", "<>":
+			cond.Op = IndexCondNE
+		case ">":
+			cond.Op = IndexCondGT
+		case ">=":
+			cond.Op = IndexCondGE
+		case "<":
+			cond.Op = IndexCondLT
+		case "<=":
+			cond.Op = IndexCondLE
+		default:
+			return nil, ErrIndexQuerySyntax
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		cond.Values = [][]byte{v}
+	case t.isKeyword("in"):
+		cond.Op = IndexCondIN
+		if p.next().kind != indexTokLParen {
+			return nil, ErrIndexQuerySyntax
+		}
+		for {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			cond.Values = append(cond.Values, v)
+			t = p.next()
+			if t.kind == indexTokRParen {
+				break
+			}
+			if t.kind != indexTokComma {
+				return nil, ErrIndexQuerySyntax
+			}
+		}
+	case t.isKeyword("like"):
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		pos := bytes.IndexByte(v, '%')
+		if pos == -1 {
+			cond.Op = IndexCondEQ
+		} else if pos == len(v)-1 {
+			cond.Op = IndexCondLike
+			v = v[:pos]
+		} else {
+			return nil, ErrIndexQueryInvalidLike
+		}
+		cond.Values = [][]byte{v}
+	default:
+		return nil, ErrIndexQuerySyntax
+	}
+	return cond, nil
+}
+
+// ParseIndexQueryWhere parse the where clause like "(a > 1 and a < 10) or b in (x, 'y z') or c like 'abc%'",
+// the string value can be quoted by single or double quotes.
+func ParseIndexQueryWhere(where []byte) (*IndexQueryExpr, error) {
+	tokens, err := tokenizeIndexQuery(where)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrIndexQuerySyntax
+	}
+	p := &indexQueryParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != indexTokEOF {
+		return nil, ErrIndexQuerySyntax
+	}
+	return expr, nil
+}
+
+// expand the expression to the OR of the AND terms, the IN condition is expanded
+// to the OR of the equal conditions.
+func (e *IndexQueryExpr) toDNF() ([][]*IndexFieldCond, error) {
+	switch e.Type {
+	case IndexExprCond:
+		if e.Cond.Op != IndexCondIN {
+			return [][]*IndexFieldCond{{e.Cond}}, nil
+		}
+		if len(e.Cond.Values) > maxIndexQueryScans {
+			return nil, ErrIndexQueryTooComplex
+		}
+		terms := make([][]*IndexFieldCond, 0, len(e.Cond.Values))
+		for _, v := range e.Cond.Values {
+			terms = append(terms, []*IndexFieldCond{{Field: e.Cond.Field, Op: IndexCondEQ, Values: [][]byte{v}}})
+		}
+		return terms, nil
+	case IndexExprOr:
+		var terms [][]*IndexFieldCond
+		for _, c := range e.Children {
+			sub, err := c.toDNF()
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, sub...)
+			if len(terms) > maxIndexQueryScans {
+				return nil, ErrIndexQueryTooComplex
+			}
+		}
+		return terms, nil
+	case IndexExprAnd:
+		terms := [][]*IndexFieldCond{{}}
+		for _, c := range e.Children {
+			sub, err := c.toDNF()
+			if err != nil {
+				return nil, err
+			}
+			if len(terms)*len(sub) > maxIndexQueryScans {
+				return nil, ErrIndexQueryTooComplex
+			}
+			newTerms := make([][]*IndexFieldCond, 0, len(terms)*len(sub))
+			for _, t := range terms {
+				for _, s := range sub {
+					nt := make([]*IndexFieldCond, 0, len(t)+len(s))
+					nt = append(nt, t...)
+					nt = append(nt, s...)
+					newTerms = append(newTerms, nt)
+				}
+			}
+			terms = newTerms
+		}
+		return terms, nil
+	}
+	return nil, ErrIndexQuerySyntax
+}
+
+type indexBound struct {
+	set  bool
+	v    []byte
+	n    int64
+	incl bool
+}
+
+func isNumberIndexType(vt IndexPropertyDType) bool {
+	return vt == Int64V || vt == Int32V
+}
+
+func compareIndexBound(vt IndexPropertyDType, a indexBound, b indexBound) int {
+	if isNumberIndexType(vt) {
+		if a.n < b.n {
+			return -1
+		} else if a.n > b.n {
+			return 1
+		}
+		return 0
+	}
+	return bytes.Compare(a.v, b.v)
+}
+
+func newIndexBound(vt IndexPropertyDType, v []byte, incl bool) (indexBound, error) {
+	b := indexBound{set: true, v: v, incl: incl}
+	if isNumberIndexType(vt) {
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return b, ErrIndexValueNotNumber
+		}
+		b.n = n
+	}
+	return b, nil
+}
+
+// the smallest value which is larger than all the values with the prefix,
+// nil if there is no such value
+func prefixSuccessor(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func isIndexRangeCond(vt IndexPropertyDType, cond *IndexFieldCond) bool {
+	switch cond.Op {
+	case IndexCondEQ, IndexCondGT, IndexCondGE, IndexCondLT, IndexCondLE:
+		return true
+	case IndexCondLike:
+		return !isNumberIndexType(vt)
+	}
+	return false
+}
+
+func findIndexEQCond(term []*IndexFieldCond, field []byte) *IndexFieldCond {
+	for _, c := range term {
+		if c.Op == IndexCondEQ && bytes.Equal(c.Field, field) {
+			return c
+		}
+	}
+	return nil
+}
+
+// the score of the index for the AND term, the equal condition is better than the range condition.
+func indexFieldScore(vt IndexPropertyDType, field []byte, term []*IndexFieldCond) int {
+	score := 0
+	for _, c := range term {
+		if !bytes.Equal(c.Field, field) || !isIndexRangeCond(vt, c) {
+			continue
+		}
+		if c.Op == IndexCondEQ {
+			score += 2
+		} else {
+			score++
+		}
+	}
+	return score
+}
+
+// the composite index can be used by the equal conditions on the leading fields
+// and the range conditions on the next field, return the score and the number of leading fields.
+func compositeIndexScore(hindex *HsetIndex, term []*IndexFieldCond) (int, int) {
+	score := 0
+	prefixNum := 0
+	for ; prefixNum < len(hindex.CompositeFields); prefixNum++ {
+		if findIndexEQCond(term, hindex.CompositeFields[prefixNum].Field) == nil {
+			break
+		}
+		score += 2
+	}
+	if prefixNum < len(hindex.CompositeFields) {
+		f := hindex.CompositeFields[prefixNum]
+		score += indexFieldScore(f.ValueType, f.Field, term)
+	}
+	return score, prefixNum
+}
+
+type indexScanPlan struct {
+	hindex *HsetIndex
+	cond   IndexCondition
+	// the conditions need to be checked using the hash field (or json path) values after scanning the index
+	filters []*IndexFieldCond
+}
+
+// get the index on the hash field or the json path
+func (db *RockDB) getQueryIndex(table []byte, field []byte, isJSON bool) (*HsetIndex, error) {
+	if isJSON {
+		jindex, err := db.getIndexer().GetJSONIndex(string(table), string(field))
+		if err != nil {
+			return nil, err
+		}
+		return &jindex.HsetIndex, nil
+	}
+	return db.getIndexer().GetHsetIndex(string(table), string(field))
+}
+
+// choose the index to scan for the AND term, the conditions on the other fields are used as filters.
+// nil will be returned if no value can be matched.
+func (db *RockDB) planIndexScan(table []byte, term []*IndexFieldCond, isJSON bool) (*indexScanPlan, error) {
+	var best *HsetIndex
+	bestScore := -1
+	bestPrefixNum := 0
+	for _, cond := range term {
+		hindex, err := db.getQueryIndex(table, cond.Field, isJSON)
+		if err != nil || hindex.IsComposite() {
+			continue
+		}
+		if hindex.State == DeletedIndex {
+			return nil, ErrIndexDeleted
+		}
+		score := indexFieldScore(hindex.ValueType, cond.Field, term)
+		if score > bestScore {
+			best = hindex
+			bestScore = score
+		}
+	}
+	var composites []*HsetIndex
+	if !isJSON {
+		composites = db.getIndexer().GetCompositeHsetIndexes(string(table))
+	}
+	for _, hindex := range composites {
+		if hindex.State == DeletedIndex {
+			continue
+		}
+		score, prefixNum := compositeIndexScore(hindex, term)
+		if score > bestScore {
+			best = hindex
+			bestScore = score
+			bestPrefixNum = prefixNum
+		}
+	}
+	if best == nil {
+		return nil, ErrIndexNotExist
+	}
+	plan := &indexScanPlan{
+		hindex: best,
+		cond:   IndexCondition{Offset: 0, Limit: -1},
+	}
+	rangeField := best.IndexField
+	vt := best.ValueType
+	used := make(map[*IndexFieldCond]bool)
+	if best.IsComposite() {
+		for i := 0; i < bestPrefixNum; i++ {
+			f := best.CompositeFields[i]
+			c := findIndexEQCond(term, f.Field)
+			if _, err := newIndexBound(f.ValueType, c.Values[0], true); err != nil {
+				return nil, err
+			}
+			plan.cond.PrefixValues = append(plan.cond.PrefixValues, c.Values[0])
+			used[c] = true
+		}
+		rangeField = nil
+		if bestPrefixNum < len(best.CompositeFields) {
+			rangeField = best.CompositeFields[bestPrefixNum].Field
+			vt = best.CompositeFields[bestPrefixNum].ValueType
+		}
+	}
+	var rangeConds []*IndexFieldCond
+	for _, c := range term {
+		if used[c] {
+			continue
+		}
+		if rangeField == nil || !bytes.Equal(c.Field, rangeField) || !isIndexRangeCond(vt, c) {
+			plan.filters = append(plan.filters, c)
+			continue
+		}
+		rangeConds = append(rangeConds, c)
+	}
+	lower, upper, err := mergeIndexRangeConds(vt, rangeConds)
+	if err != nil {
+		return nil, err
+	}
+	if isEmptyIndexRange(vt, lower, upper) {
+		return nil, nil
+	}
+	truncated := false
+	if !best.IsComposite() && !isNumberIndexType(vt) && best.PrefixLen > 0 {
+		// only the prefix of the value is stored in index, so we scan the larger range
+		// and check all the conditions on the hash value.
+		for _, b := range []*indexBound{&lower, &upper} {
+			if b.set && int32(len(b.v)) > best.PrefixLen {
+				b.v = b.v[:best.PrefixLen]
+				b.incl = true
+				truncated = true
+			}
+		}
+	}
+	if truncated {
+		plan.filters = append(plan.filters, rangeConds...)
+	}
+	if lower.set {
+		plan.cond.StartKey = lower.v
+		plan.cond.IncludeStart = lower.incl
+	}
+	if upper.set {
+		plan.cond.EndKey = upper.v
+		plan.cond.IncludeEnd = upper.incl
+	}
+	return plan, nil
+}
+
+// merge the range conditions on the same field to the lower and upper bound
+func mergeIndexRangeConds(vt IndexPropertyDType, rangeConds []*IndexFieldCond) (indexBound, indexBound, error) {
+	var lower, upper indexBound
+	for _, c := range rangeConds {
+		var lb, ub indexBound
+		var err error
+		switch c.Op {
+		case IndexCondEQ:
+			if lb, err = newIndexBound(vt, c.Values[0], true); err == nil {
+				ub = lb
+			}
+		case IndexCondGT, IndexCondGE:
+			lb, err = newIndexBound(vt, c.Values[0], c.Op == IndexCondGE)
+		case IndexCondLT, IndexCondLE:
+			ub, err = newIndexBound(vt, c.Values[0], c.Op == IndexCondLE)
+		case IndexCondLike:
+			lb = indexBound{set: true, v: c.Values[0], incl: true}
+			if end := prefixSuccessor(c.Values[0]); end != nil {
+				ub = indexBound{set: true, v: end, incl: false}
+			}
+		}
+		if err != nil {
+			return lower, upper, err
+		}
+		if lb.set {
+			if !lower.set {
+				lower = lb
+			} else if cmp := compareIndexBound(vt, lb, lower); cmp > 0 || (cmp == 0 && !lb.incl) {
+				lower = lb
+			}
+		}
+		if ub.set {
+			if !upper.set {
+				upper = ub
+			} else if cmp := compareIndexBound(vt, ub, upper); cmp < 0 || (cmp == 0 && !ub.incl) {
+				upper = ub
+			}
+		}
+	}
+	return lower, upper, nil
+}
+
+func isEmptyIndexRange(vt IndexPropertyDType, lower indexBound, upper indexBound) bool {
+	if lower.set && upper.set {
+		cmp := compareIndexBound(vt, lower, upper)
+		if cmp > 0 || (cmp == 0 && !(lower.incl && upper.incl)) {
+			return true
+		}
+	}
+	return false
+}
+
+func compareIndexQueryValue(v []byte, cv []byte) int {
+	return common.CompareSQLValue(v, cv)
+}
+
+// the field not exist will not match any condition
+func matchIndexFieldCond(v []byte, cond *IndexFieldCond) bool {
+	if v == nil {
+		return false
+	}
+	switch cond.Op {
+	case IndexCondLike:
+		return bytes.HasPrefix(v, cond.Values[0])
+	case IndexCondIN:
+		for _, cv := range cond.Values {
+			if compareIndexQueryValue(v, cv) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	c := compareIndexQueryValue(v, cond.Values[0])
+	switch cond.Op {
+	case IndexCondEQ:
+		return c == 0
+	case IndexCondNE:
+		return c != 0
+	case IndexCondGT:
+		return c > 0
+	case IndexCondGE:
+		return c >= 0
+	case IndexCondLT:
+		return c < 0
+	case IndexCondLE:
+		return c <= 0
+	}
+	return false
+}
+
+func (db *RockDB) matchIndexFilters(pk []byte, filters []*IndexFieldCond, isJSON bool) (bool, error) {
+	var jdata []byte
+	if isJSON && len(filters) > 0 {
+		table, rk, err := extractTableFromRedisKey(pk)
+		if err != nil {
+			return false, err
+		}
+		_, jdata, _, err = db.getOldJSON(table, rk)
+		if err != nil {
+			return false, err
+		}
+	}
+	for _, f := range filters {
+		var v []byte
+		if isJSON {
+			v = getJSONIndexValue(jdata, string(f.Field))
+		} else {
+			var err error
+			v, err = db.HGet(pk, f.Field)
+			if err != nil {
+				return false, err
+			}
+		}
+		if !matchIndexFieldCond(v, f) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HsetIndexQuery search the hash index using the where expression. The expression is
+// expanded to several index range scans, and the results are merged and deduplicated by the primary key.
+func (db *RockDB) HsetIndexQuery(table []byte, expr *IndexQueryExpr, offset int, limit int) ([]HIndexResp, error) {
+	return db.indexQuery(table, expr, offset, limit, false)
+}
+
+// JSONIndexQuery search the json path indexes using the where expression, the field in
+// the expression is the json path, such as "address.city = 'x' and age > 10".
+func (db *RockDB) JSONIndexQuery(table []byte, expr *IndexQueryExpr, offset int, limit int) ([]HIndexResp, error) {
+	return db.indexQuery(table, expr, offset, limit, true)
+}
+
+// expand the where expression to the DNF terms, the json path in the
+// conditions will be converted to the canonical form.
+func indexQueryTerms(expr *IndexQueryExpr, isJSON bool) ([][]*IndexFieldCond, error) {
+	terms, err := expr.toDNF()
+	if err != nil {
+		return nil, err
+	}
+	if isJSON {
+		// the same path may be written in different forms, such as "a.b" and "$.a.b"
+		for _, term := range terms {
+			for _, c := range term {
+				c.Field = []byte(convertJSONPath(c.Field))
+			}
+		}
+	}
+	return terms, nil
+}
+
+func (db *RockDB) planIndexQuery(table []byte, expr *IndexQueryExpr, isJSON bool) ([]*indexScanPlan, error) {
+	terms, err := indexQueryTerms(expr, isJSON)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]*indexScanPlan, 0, len(terms))
+	for _, term := range terms {
+		plan, err := db.planIndexScan(table, term, isJSON)
+		if err != nil {
+			return nil, err
+		}
+		if plan != nil {
+			plans = append(plans, plan)
+		}
+	}
+	return plans, nil
+}
+
+func (db *RockDB) indexQuery(table []byte, expr *IndexQueryExpr, offset int, limit int, isJSON bool) ([]HIndexResp, error) {
+	plans, err := db.planIndexQuery(table, expr, isJSON)
+	if err != nil {
+		return nil, err
+	}
+	return db.runIndexPlans(table, plans, offset, limit, isJSON)
+}
+
+func (db *RockDB) runIndexPlans(table []byte, plans []*indexScanPlan, offset int, limit int, isJSON bool) ([]HIndexResp, error) {
+	if len(plans) == 0 {
+		return nil, nil
+	}
+	if len(plans) == 1 && len(plans[0].filters) == 0 {
+		plans[0].cond.Offset = offset
+		plans[0].cond.Limit = limit
+		_, rets, err := plans[0].hindex.SearchRec(db, &plans[0].cond, false)
+		return rets, err
+	}
+	if dbLog.Level() >= common.LOG_DEBUG {
+		dbLog.Debugf("index query %v with %v scans", string(table), len(plans))
+	}
+	seen := make(map[string]bool)
+	rets := make([]HIndexResp, 0, 32)
+	for _, plan := range plans {
+		_, pkList, err := plan.hindex.SearchRec(db, &plan.cond, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, resp := range pkList {
+			if seen[string(resp.PKey)] {
+				continue
+			}
+			matched, err := db.matchIndexFilters(resp.PKey, plan.filters, isJSON)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+			seen[string(resp.PKey)] = true
+			rets = append(rets, resp)
+		}
+		if limit >= 0 && len(rets) >= offset+limit {
+			break
+		}
+	}
+	if offset >= len(rets) {
+		return rets[:0], nil
+	}
+	rets = rets[offset:]
+	if limit >= 0 && limit < len(rets) {
+		rets = rets[:limit]
+	}
+	return rets, nil
+}
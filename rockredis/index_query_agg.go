@@ -0,0 +1,107 @@
+package rockredis
+
+import (
+	"strconv"
+)
+
+// HsetIndexAggregate compute the aggregations over the hash keys matched by the where
+// expression in this partition, the field of the aggregation is the hash field and
+// the results can be merged across the partitions.
+func (db *RockDB) HsetIndexAggregate(table []byte, expr *IndexQueryExpr, aggs []ColumnAggregation) ([]ColumnAggValue, error) {
+	return db.indexAggregate(table, expr, aggs, false)
+}
+
+// JSONIndexAggregate is the same as HsetIndexAggregate while the field of the aggregation is the json path.
+func (db *RockDB) JSONIndexAggregate(table []byte, expr *IndexQueryExpr, aggs []ColumnAggregation) ([]ColumnAggValue, error) {
+	return db.indexAggregate(table, expr, aggs, true)
+}
+
+// get the values of the fields (or json paths) for the matched key
+func (db *RockDB) getIndexQueryFieldValues(pk []byte, fields [][]byte, isJSON bool) ([][]byte, error) {
+	if !isJSON {
+		return db.HMget(pk, fields...)
+	}
+	table, rk, err := extractTableFromRedisKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	_, jdata, _, err := db.getOldJSON(table, rk)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([][]byte, 0, len(fields))
+	for _, f := range fields {
+		vals = append(vals, getJSONIndexValue(jdata, string(f)))
+	}
+	return vals, nil
+}
+
+func (db *RockDB) indexAggregate(table []byte, expr *IndexQueryExpr, aggs []ColumnAggregation, isJSON bool) ([]ColumnAggValue, error) {
+	values := make([]ColumnAggValue, len(aggs))
+	// the position of the field value for the aggregation, -1 for count(*)
+	fieldPos := make([]int, len(aggs))
+	fields := make([][]byte, 0, len(aggs))
+	for i, agg := range aggs {
+		if agg.Field == nil {
+			if agg.Func != ColumnAggCount {
+				return nil, ErrColumnAggSumNonNum
+			}
+			fieldPos[i] = -1
+			continue
+		}
+		f := agg.Field
+		if isJSON {
+			f = []byte(convertJSONPath(f))
+		}
+		fieldPos[i] = len(fields)
+		fields = append(fields, f)
+	}
+	plans, err := db.planIndexQuery(table, expr, isJSON)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 && len(plans) == 1 && len(plans[0].filters) == 0 {
+		// count the index range without reading the keys
+		n, _, err := plans[0].hindex.SearchRec(db, &plans[0].cond, true)
+		if err != nil {
+			return nil, err
+		}
+		for i := range values {
+			values[i].Count = n
+		}
+		return values, nil
+	}
+	rets, err := db.runIndexPlans(table, plans, 0, -1, isJSON)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range rets {
+		var fvs [][]byte
+		if len(fields) > 0 {
+			fvs, err = db.getIndexQueryFieldValues(resp.PKey, fields, isJSON)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for i, agg := range aggs {
+			if fieldPos[i] < 0 {
+				values[i].Count++
+				continue
+			}
+			v := fvs[fieldPos[i]]
+			if v == nil {
+				continue
+			}
+			if agg.Func == ColumnAggCount {
+				values[i].Count++
+				continue
+			}
+			n, err := strconv.ParseFloat(string(v), 64)
+			if err != nil {
+				continue
+			}
+			values[i].addNum(n)
+		}
+	}
+	return values, nil
+}
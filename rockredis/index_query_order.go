@@ -0,0 +1,168 @@
+package rockredis
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+var (
+	errIndexOrderPrefix = errors.New("the prefix index can not be used for order by")
+)
+
+// IndexQueryOrder is the order of the query results by the value of the indexed field,
+// the keys without the field will not be returned. If After is not nil, only the
+// results after the position in the order are returned.
+type IndexQueryOrder struct {
+	Field []byte
+	Desc  bool
+	After *HIndexResp
+}
+
+// HsetIndexOrderedQuery search the hash keys matched by the where expression and return
+// the results ordered by the value of the indexed field, and then the primary key.
+func (db *RockDB) HsetIndexOrderedQuery(table []byte, expr *IndexQueryExpr, order *IndexQueryOrder,
+	offset int, limit int) ([]HIndexResp, error) {
+	return db.indexOrderedQuery(table, expr, order, offset, limit, false)
+}
+
+func (db *RockDB) JSONIndexOrderedQuery(table []byte, expr *IndexQueryExpr, order *IndexQueryOrder,
+	offset int, limit int) ([]HIndexResp, error) {
+	return db.indexOrderedQuery(table, expr, order, offset, limit, true)
+}
+
+// the index key of the position, the unique index key has no pk
+func (self *HsetIndex) encodeSearchPosKey(pos *HIndexResp) ([]byte, error) {
+	pk := pos.PKey
+	if self.Unique == 1 {
+		pk = nil
+	}
+	if isNumberIndexType(self.ValueType) {
+		return encodeHsetIndexNumberKey(self.dataType(), self.Table, self.Name, pos.IndexIntValue, pk, false)
+	}
+	return encodeHsetIndexStringKey(self.dataType(), self.Table, self.Name, pos.IndexValue, pk, false)
+}
+
+// match if all the conditions in any term are matched
+func (db *RockDB) matchIndexTerms(pk []byte, terms [][]*IndexFieldCond, isJSON bool) (bool, error) {
+	for _, term := range terms {
+		matched, err := db.matchIndexFilters(pk, term, isJSON)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+// The index on the order field is scanned in order and the where expression is checked
+// for each key. If there is only one AND term in the expression, the range conditions
+// on the order field are used as the scan range.
+func (db *RockDB) indexOrderedQuery(table []byte, expr *IndexQueryExpr, order *IndexQueryOrder,
+	offset int, limit int, isJSON bool) ([]HIndexResp, error) {
+	// all the keys with the order field are matched if no where expression
+	var terms [][]*IndexFieldCond
+	if expr != nil {
+		var err error
+		terms, err = indexQueryTerms(expr, isJSON)
+		if err != nil {
+			return nil, err
+		}
+	}
+	orderField := order.Field
+	if isJSON {
+		orderField = []byte(convertJSONPath(orderField))
+	}
+	hindex, err := db.getQueryIndex(table, orderField, isJSON)
+	if err != nil {
+		return nil, err
+	}
+	if hindex.State == DeletedIndex {
+		return nil, ErrIndexDeleted
+	}
+	if !isNumberIndexType(hindex.ValueType) && hindex.PrefixLen > 0 {
+		return nil, errIndexOrderPrefix
+	}
+	vt := hindex.ValueType
+	cond := IndexCondition{Limit: -1}
+	filters := terms
+	if len(terms) == 1 {
+		var rangeConds []*IndexFieldCond
+		var others []*IndexFieldCond
+		for _, c := range terms[0] {
+			if bytes.Equal(c.Field, orderField) && isIndexRangeCond(vt, c) {
+				rangeConds = append(rangeConds, c)
+			} else {
+				others = append(others, c)
+			}
+		}
+		lower, upper, err := mergeIndexRangeConds(vt, rangeConds)
+		if err != nil {
+			return nil, err
+		}
+		if isEmptyIndexRange(vt, lower, upper) {
+			return nil, nil
+		}
+		if lower.set {
+			cond.StartKey = lower.v
+			cond.IncludeStart = lower.incl
+		}
+		if upper.set {
+			cond.EndKey = upper.v
+			cond.IncludeEnd = upper.incl
+		}
+		filters = [][]*IndexFieldCond{others}
+	}
+	min, max, rt, err := hindex.searchRange(&cond)
+	if err != nil {
+		return nil, err
+	}
+	if order.After != nil {
+		pos, err := hindex.encodeSearchPosKey(order.After)
+		if err != nil {
+			return nil, err
+		}
+		// the position may be out of the range if the where expression is changed
+		if !order.Desc && bytes.Compare(pos, min) >= 0 {
+			min = pos
+			rt |= common.RangeLOpen
+		} else if order.Desc && bytes.Compare(pos, max) <= 0 {
+			max = pos
+			rt |= common.RangeROpen
+		}
+	}
+	if dbLog.Level() >= common.LOG_DEBUG {
+		dbLog.Debugf("begin ordered search index: %v-%v, %v~%v, desc: %v", string(table),
+			string(hindex.IndexField), min, max, order.Desc)
+	}
+	it, err := db.NewDBRangeLimitIterator(min, max, rt, 0, -1, order.Desc)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	rets := make([]HIndexResp, 0, 32)
+	for ; it.Valid(); it.Next() {
+		if limit >= 0 && len(rets) >= limit {
+			break
+		}
+		resp, err := hindex.decodeSearchRec(it.Key(), it.Value())
+		if err != nil {
+			continue
+		}
+		if len(filters) > 0 {
+			matched, err := db.matchIndexTerms(resp.PKey, filters, isJSON)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		rets = append(rets, resp)
+	}
+	return rets, nil
+}
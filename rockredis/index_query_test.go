@@ -0,0 +1,325 @@
+package rockredis
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func TestParseIndexQueryWhere(t *testing.T) {
+	expr, err := ParseIndexQueryWhere([]byte("a > 1 AND a <= 10"))
+	assert.Nil(t, err)
+	assert.Equal(t, IndexExprAnd, expr.Type)
+	assert.Equal(t, 2, len(expr.Children))
+	assert.Equal(t, IndexCondGT, expr.Children[0].Cond.Op)
+	assert.Equal(t, IndexCondLE, expr.Children[1].Cond.Op)
+
+	expr, err = ParseIndexQueryWhere([]byte("(a >= 1 and a < 2) or b in ('x y', \"and\", z) or c != 'it\\'s' or d like 'ab%'"))
+	assert.Nil(t, err)
+	assert.Equal(t, IndexExprOr, expr.Type)
+	assert.Equal(t, 4, len(expr.Children))
+	assert.Equal(t, IndexExprAnd, expr.Children[0].Type)
+	inCond := expr.Children[1].Cond
+	assert.Equal(t, IndexCondIN, inCond.Op)
+	assert.Equal(t, [][]byte{[]byte("x y"), []byte("and"), []byte("z")}, inCond.Values)
+	assert.Equal(t, IndexCondNE, expr.Children[2].Cond.Op)
+	assert.Equal(t, "it's", string(expr.Children[2].Cond.Values[0]))
+	assert.Equal(t, IndexCondLike, expr.Children[3].Cond.Op)
+	assert.Equal(t, "ab", string(expr.Children[3].Cond.Values[0]))
+
+	expr, err = ParseIndexQueryWhere([]byte("a<>'1'"))
+	assert.Nil(t, err)
+	assert.Equal(t, IndexCondNE, expr.Cond.Op)
+	expr, err = ParseIndexQueryWhere([]byte("a like 'abc'"))
+	assert.Nil(t, err)
+	assert.Equal(t, IndexCondEQ, expr.Cond.Op)
+
+	invalids := []string{"", "a", "a >", "(a > 1", "a > 1)", "a in (1, 2", "a = 'abc", "a ! 1",
+		"a > 1 and", "a like '%abc'", "a like 'a%c'", "a > 1 b < 2"}
+	for _, w := range invalids {
+		_, err = ParseIndexQueryWhere([]byte(w))
+		assert.NotNil(t, err, w)
+	}
+}
+
+func TestHashIndexQuery(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("int_field")
+	hindex.ValueType = Int64V
+	intIndex := hindex
+	err := db.indexMgr.AddHsetIndex(db, &intIndex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+
+	hindex.Name = []byte("index2")
+	hindex.IndexField = []byte("str_field")
+	hindex.ValueType = StringV
+	stringIndex := hindex
+	err = db.indexMgr.AddHsetIndex(db, &stringIndex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+
+	strValues := []string{"abc1", "abc2", "bcd", "it's", "x y", "abd", "b", "c", "d", "e"}
+	for i := 0; i < 10; i++ {
+		key := []byte("test:key" + strconv.Itoa(i))
+		_, err = db.HSet(0, false, key, intIndex.IndexField, []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		_, err = db.HSet(0, false, key, stringIndex.IndexField, []byte(strValues[i]))
+		assert.Nil(t, err)
+		_, err = db.HSet(0, false, key, []byte("noindex"), []byte(strconv.Itoa(i%2)))
+		assert.Nil(t, err)
+	}
+
+	query := func(where string, offset int, limit int) []string {
+		expr, err := ParseIndexQueryWhere([]byte(where))
+		assert.Nil(t, err, where)
+		rets, err := db.HsetIndexQuery(hindex.Table, expr, offset, limit)
+		assert.Nil(t, err, where)
+		keys := make([]string, 0, len(rets))
+		for _, r := range rets {
+			keys = append(keys, string(r.PKey))
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	assert.Equal(t, []string{"test:key2", "test:key3"}, query("int_field > 1 and int_field <= 3", 0, -1))
+	assert.Equal(t, []string{"test:key1", "test:key2", "test:key8"},
+		query("int_field = 1 or str_field = 'bcd' or int_field in (8, 2)", 0, -1))
+	assert.Equal(t, []string{"test:key0", "test:key1"}, query("str_field like 'abc%'", 0, -1))
+	assert.Equal(t, []string{"test:key3", "test:key4"}, query("str_field in ('it\\'s', \"x y\")", 0, -1))
+	assert.Equal(t, []string{"test:key0", "test:key2", "test:key3"},
+		query("int_field < 4 and int_field != 1", 0, -1))
+	assert.Equal(t, []string{"test:key1", "test:key3", "test:key5"},
+		query("(int_field < 6 and noindex = 1) or (str_field like 'abc%' and int_field = 1)", 0, -1))
+	// the range should be intersected with the different conditions on the same field
+	assert.Equal(t, 0, len(query("int_field > 5 and int_field < 3", 0, -1)))
+	assert.Equal(t, []string{"test:key2"}, query("int_field in (1, 2) and str_field = 'abc2'", 0, -1))
+
+	assert.Equal(t, 3, len(query("int_field >= 3 or str_field like 'abc%'", 0, 3)))
+	assert.Equal(t, 3, len(query("int_field >= 3 or str_field like 'abc%'", 6, 10)))
+	assert.Equal(t, 0, len(query("int_field >= 3 or str_field like 'abc%'", 10, 10)))
+	assert.Equal(t, 1, len(query("int_field >= 3", 6, 10)))
+
+	expr, err := ParseIndexQueryWhere([]byte("noindex = 1"))
+	assert.Nil(t, err)
+	_, err = db.HsetIndexQuery(hindex.Table, expr, 0, -1)
+	assert.Equal(t, ErrIndexNotExist, err)
+	expr, err = ParseIndexQueryWhere([]byte("int_field = 1 or noindex = 1"))
+	assert.Nil(t, err)
+	_, err = db.HsetIndexQuery(hindex.Table, expr, 0, -1)
+	assert.Equal(t, ErrIndexNotExist, err)
+	expr, err = ParseIndexQueryWhere([]byte("int_field = abc"))
+	assert.Nil(t, err)
+	_, err = db.HsetIndexQuery(hindex.Table, expr, 0, -1)
+	assert.NotNil(t, err)
+}
+
+func TestHashCompositeIndex(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("tenant_created")
+	hindex.IndexField = []byte("tenant_id,created_at")
+	hindex.CompositeFields = []HsetIndexField{
+		{Field: []byte("tenant_id"), ValueType: StringV},
+		{Field: []byte("created_at"), ValueType: Int64V},
+	}
+	err := db.indexMgr.AddHsetIndex(db, &hindex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		key := []byte("test:key" + strconv.Itoa(i))
+		tenant := "t" + strconv.Itoa(i%2)
+		err = db.HMset(0, key, common.KVRecord{Key: []byte("tenant_id"), Value: []byte(tenant)},
+			common.KVRecord{Key: []byte("created_at"), Value: []byte(strconv.Itoa(100 + i))})
+		assert.Nil(t, err)
+	}
+	// the key missing the member field should not be indexed
+	_, err = db.HSet(0, false, []byte("test:key_no_created"), []byte("tenant_id"), []byte("t0"))
+	assert.Nil(t, err)
+
+	search := func(cond *IndexCondition) []string {
+		_, _, rets, err := db.HsetIndexSearch(hindex.Table, hindex.IndexField, cond, false)
+		assert.Nil(t, err)
+		keys := make([]string, 0, len(rets))
+		for _, r := range rets {
+			keys = append(keys, string(r.PKey))
+		}
+		return keys
+	}
+	assert.Equal(t, 10, len(search(&IndexCondition{Limit: -1})))
+	assert.Equal(t, []string{"test:key0", "test:key2", "test:key4", "test:key6", "test:key8"},
+		search(&IndexCondition{PrefixValues: [][]byte{[]byte("t0")}, Limit: -1}))
+	assert.Equal(t, []string{"test:key4", "test:key6"},
+		search(&IndexCondition{PrefixValues: [][]byte{[]byte("t0")}, StartKey: []byte("102"), EndKey: []byte("106"),
+			IncludeEnd: true, Limit: -1}))
+	assert.Equal(t, []string{"test:key3"},
+		search(&IndexCondition{PrefixValues: [][]byte{[]byte("t1"), []byte("103")}, Limit: -1}))
+	_, _, rets, err := db.HsetIndexSearch(hindex.Table, hindex.IndexField,
+		&IndexCondition{PrefixValues: [][]byte{[]byte("t1")}, StartKey: []byte("109"), IncludeStart: true, Limit: -1}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, int64(109), rets[0].IndexIntValue)
+	assert.Equal(t, Int64V, rets[0].IndexValueType)
+
+	// update any member field should update the index
+	_, err = db.HSet(0, false, []byte("test:key2"), []byte("tenant_id"), []byte("t1"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key4"), []byte("created_at"), []byte("200"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key_no_created"), []byte("created_at"), []byte("105"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test:key_no_created", "test:key6"},
+		search(&IndexCondition{PrefixValues: [][]byte{[]byte("t0")}, StartKey: []byte("102"), EndKey: []byte("106"),
+			IncludeEnd: true, Limit: -1}))
+	assert.Equal(t, []string{"test:key2"},
+		search(&IndexCondition{PrefixValues: [][]byte{[]byte("t1"), []byte("102")}, Limit: -1}))
+
+	_, err = db.HDel(0, []byte("test:key6"), []byte("created_at"))
+	assert.Nil(t, err)
+	_, err = db.HClear(0, []byte("test:key_no_created"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(search(&IndexCondition{PrefixValues: [][]byte{[]byte("t0")}, StartKey: []byte("102"),
+		EndKey: []byte("106"), IncludeEnd: true, Limit: -1})))
+	assert.Equal(t, 9, len(search(&IndexCondition{Limit: -1})))
+
+	// the query planner should use the composite index for the leading equal conditions
+	expr, err := ParseIndexQueryWhere([]byte("tenant_id = t1 and created_at > 102 and created_at < 108"))
+	assert.Nil(t, err)
+	qrets, err := db.HsetIndexQuery(hindex.Table, expr, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(qrets))
+	expr, err = ParseIndexQueryWhere([]byte("(tenant_id = t0 and created_at >= 200) or (tenant_id = t1 and created_at = 101)"))
+	assert.Nil(t, err)
+	qrets, err = db.HsetIndexQuery(hindex.Table, expr, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(qrets))
+	expr, err = ParseIndexQueryWhere([]byte("tenant_id = t1 and created_at = abc"))
+	assert.Nil(t, err)
+	_, err = db.HsetIndexQuery(hindex.Table, expr, 0, -1)
+	assert.NotNil(t, err)
+}
+
+func TestHashIndexOrderedQueryAndAggregate(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("int_field")
+	hindex.ValueType = Int64V
+	intIndex := hindex
+	err := db.indexMgr.AddHsetIndex(db, &intIndex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+
+	hindex.Name = []byte("index2")
+	hindex.IndexField = []byte("str_field")
+	hindex.ValueType = StringV
+	stringIndex := hindex
+	err = db.indexMgr.AddHsetIndex(db, &stringIndex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+
+	strValues := []string{"abc1", "abc2", "bcd", "it's", "x y", "abd", "b", "c", "d", "e"}
+	for i := 0; i < 10; i++ {
+		key := []byte("test:key" + strconv.Itoa(i))
+		err = db.HMset(0, key, common.KVRecord{Key: intIndex.IndexField, Value: []byte(strconv.Itoa(i))},
+			common.KVRecord{Key: stringIndex.IndexField, Value: []byte(strValues[i])},
+			common.KVRecord{Key: []byte("noindex"), Value: []byte(strconv.Itoa(i % 2))})
+		assert.Nil(t, err)
+	}
+
+	query := func(where string, order *IndexQueryOrder, offset int, limit int) []string {
+		expr, err := ParseIndexQueryWhere([]byte(where))
+		assert.Nil(t, err, where)
+		rets, err := db.HsetIndexOrderedQuery(hindex.Table, expr, order, offset, limit)
+		assert.Nil(t, err, where)
+		keys := make([]string, 0, len(rets))
+		for _, r := range rets {
+			keys = append(keys, string(r.PKey))
+		}
+		return keys
+	}
+	byInt := &IndexQueryOrder{Field: intIndex.IndexField}
+	byIntDesc := &IndexQueryOrder{Field: intIndex.IndexField, Desc: true}
+	assert.Equal(t, []string{"test:key3", "test:key4", "test:key5"}, query("int_field >= 3", byInt, 0, 3))
+	assert.Equal(t, []string{"test:key9", "test:key8", "test:key7"}, query("int_field >= 3", byIntDesc, 0, 3))
+	assert.Equal(t, []string{"test:key8", "test:key9"}, query("int_field >= 0", byInt, 8, 5))
+	// continue after the position
+	byIntDesc.After = &HIndexResp{PKey: []byte("test:key8"), IndexIntValue: 8}
+	assert.Equal(t, []string{"test:key7", "test:key6", "test:key5"}, query("int_field >= 3", byIntDesc, 0, 3))
+	byInt.After = &HIndexResp{PKey: []byte("test:key5"), IndexIntValue: 5}
+	assert.Equal(t, []string{"test:key7", "test:key9"}, query("int_field >= 3 and noindex = 1", byInt, 0, -1))
+	// the position out of the range should be ignored
+	byInt.After = &HIndexResp{PKey: []byte("test:key1"), IndexIntValue: 1}
+	assert.Equal(t, []string{"test:key3", "test:key4"}, query("int_field >= 3", byInt, 0, 2))
+
+	byStr := &IndexQueryOrder{Field: stringIndex.IndexField}
+	assert.Equal(t, []string{"test:key0", "test:key1", "test:key9"}, query("int_field < 2 or str_field = 'e'", byStr, 0, -1))
+	byStr.Desc = true
+	assert.Equal(t, []string{"test:key9", "test:key1", "test:key0"}, query("int_field < 2 or str_field = 'e'", byStr, 0, -1))
+	byStr.After = &HIndexResp{PKey: []byte("test:key1"), IndexValue: []byte("abc2")}
+	assert.Equal(t, []string{"test:key0"}, query("int_field < 2 or str_field = 'e'", byStr, 0, -1))
+
+	expr, err := ParseIndexQueryWhere([]byte("int_field > 1"))
+	assert.Nil(t, err)
+	_, err = db.HsetIndexOrderedQuery(hindex.Table, expr, &IndexQueryOrder{Field: []byte("noindex")}, 0, -1)
+	assert.Equal(t, ErrIndexNotExist, err)
+
+	aggregate := func(where string, aggs ...ColumnAggregation) []float64 {
+		expr, err := ParseIndexQueryWhere([]byte(where))
+		assert.Nil(t, err, where)
+		values, err := db.HsetIndexAggregate(hindex.Table, expr, aggs)
+		assert.Nil(t, err, where)
+		rets := make([]float64, 0, len(values))
+		for i, v := range values {
+			r, ok := v.Result(aggs[i].Func)
+			assert.True(t, ok)
+			rets = append(rets, r)
+		}
+		return rets
+	}
+	assert.Equal(t, []float64{5}, aggregate("int_field >= 5", ColumnAggregation{Func: ColumnAggCount}))
+	assert.Equal(t, []float64{5, 35, 5, 9, 3, 5},
+		aggregate("int_field >= 5", ColumnAggregation{Func: ColumnAggCount},
+			ColumnAggregation{Func: ColumnAggSum, Field: intIndex.IndexField},
+			ColumnAggregation{Func: ColumnAggMin, Field: intIndex.IndexField},
+			ColumnAggregation{Func: ColumnAggMax, Field: intIndex.IndexField},
+			ColumnAggregation{Func: ColumnAggSum, Field: []byte("noindex")},
+			ColumnAggregation{Func: ColumnAggCount, Field: []byte("noindex")}))
+	assert.Equal(t, []float64{4, 0, 9}, aggregate("int_field < 3 or str_field = 'e'",
+		ColumnAggregation{Func: ColumnAggCount},
+		ColumnAggregation{Func: ColumnAggMin, Field: intIndex.IndexField},
+		ColumnAggregation{Func: ColumnAggMax, Field: intIndex.IndexField}))
+	// the non-number values are ignored for sum
+	assert.Equal(t, []float64{0, 2}, aggregate("int_field < 2",
+		ColumnAggregation{Func: ColumnAggSum, Field: stringIndex.IndexField},
+		ColumnAggregation{Func: ColumnAggCount, Field: stringIndex.IndexField}))
+	expr, err = ParseIndexQueryWhere([]byte("int_field > 1"))
+	assert.Nil(t, err)
+	_, err = db.HsetIndexAggregate(hindex.Table, expr, []ColumnAggregation{{Func: ColumnAggSum}})
+	assert.Equal(t, ErrColumnAggSumNonNum, err)
+}
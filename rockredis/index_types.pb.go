@@ -85,12 +85,13 @@ func (IndexState) EnumDescriptor() ([]byte, []int) {
 }
 
 type HsetIndexInfo struct {
-	Name       []byte             `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	IndexField []byte             `protobuf:"bytes,2,opt,name=index_field,json=indexField,proto3" json:"index_field,omitempty"`
-	PrefixLen  int32              `protobuf:"varint,3,opt,name=prefix_len,json=prefixLen,proto3" json:"prefix_len,omitempty"`
-	Unique     int32              `protobuf:"varint,4,opt,name=unique,proto3" json:"unique,omitempty"`
-	ValueType  IndexPropertyDType `protobuf:"varint,5,opt,name=value_type,json=valueType,proto3,enum=rockredis.IndexPropertyDType" json:"value_type,omitempty"`
-	State      IndexState         `protobuf:"varint,6,opt,name=state,proto3,enum=rockredis.IndexState" json:"state,omitempty"`
+	Name            []byte             `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	IndexField      []byte             `protobuf:"bytes,2,opt,name=index_field,json=indexField,proto3" json:"index_field,omitempty"`
+	PrefixLen       int32              `protobuf:"varint,3,opt,name=prefix_len,json=prefixLen,proto3" json:"prefix_len,omitempty"`
+	Unique          int32              `protobuf:"varint,4,opt,name=unique,proto3" json:"unique,omitempty"`
+	ValueType       IndexPropertyDType `protobuf:"varint,5,opt,name=value_type,json=valueType,proto3,enum=rockredis.IndexPropertyDType" json:"value_type,omitempty"`
+	State           IndexState         `protobuf:"varint,6,opt,name=state,proto3,enum=rockredis.IndexState" json:"state,omitempty"`
+	CompositeFields []HsetIndexField   `protobuf:"bytes,7,rep,name=composite_fields,json=compositeFields,proto3" json:"composite_fields"`
 }
 
 func (m *HsetIndexInfo) Reset()         { *m = HsetIndexInfo{} }
@@ -163,43 +164,250 @@ func (m *HsetIndexList) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_HsetIndexList proto.InternalMessageInfo
 
+type FullTextIndexInfo struct {
+	Name       []byte     `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	HashFields [][]byte   `protobuf:"bytes,2,rep,name=hash_fields,json=hashFields,proto3" json:"hash_fields,omitempty"`
+	JsonPaths  [][]byte   `protobuf:"bytes,3,rep,name=json_paths,json=jsonPaths,proto3" json:"json_paths,omitempty"`
+	State      IndexState `protobuf:"varint,4,opt,name=state,proto3,enum=rockredis.IndexState" json:"state,omitempty"`
+}
+
+func (m *FullTextIndexInfo) Reset()         { *m = FullTextIndexInfo{} }
+func (m *FullTextIndexInfo) String() string { return proto.CompactTextString(m) }
+func (*FullTextIndexInfo) ProtoMessage()    {}
+func (*FullTextIndexInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_65a2d0bf1752f5d6, []int{2}
+}
+func (m *FullTextIndexInfo) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *FullTextIndexInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_FullTextIndexInfo.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *FullTextIndexInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FullTextIndexInfo.Merge(m, src)
+}
+func (m *FullTextIndexInfo) XXX_Size() int {
+	return m.Size()
+}
+func (m *FullTextIndexInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_FullTextIndexInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FullTextIndexInfo proto.InternalMessageInfo
+
+type FullTextIndexList struct {
+	FulltextIndexes []FullTextIndexInfo `protobuf:"bytes,1,rep,name=fulltext_indexes,json=fulltextIndexes,proto3" json:"fulltext_indexes"`
+}
+
+func (m *FullTextIndexList) Reset()         { *m = FullTextIndexList{} }
+func (m *FullTextIndexList) String() string { return proto.CompactTextString(m) }
+func (*FullTextIndexList) ProtoMessage()    {}
+func (*FullTextIndexList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_65a2d0bf1752f5d6, []int{3}
+}
+func (m *FullTextIndexList) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *FullTextIndexList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_FullTextIndexList.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *FullTextIndexList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FullTextIndexList.Merge(m, src)
+}
+func (m *FullTextIndexList) XXX_Size() int {
+	return m.Size()
+}
+func (m *FullTextIndexList) XXX_DiscardUnknown() {
+	xxx_messageInfo_FullTextIndexList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FullTextIndexList proto.InternalMessageInfo
+
+type ColumnTableInfo struct {
+	Name    []byte     `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Columns [][]byte   `protobuf:"bytes,2,rep,name=columns,proto3" json:"columns,omitempty"`
+	State   IndexState `protobuf:"varint,3,opt,name=state,proto3,enum=rockredis.IndexState" json:"state,omitempty"`
+}
+
+func (m *ColumnTableInfo) Reset()         { *m = ColumnTableInfo{} }
+func (m *ColumnTableInfo) String() string { return proto.CompactTextString(m) }
+func (*ColumnTableInfo) ProtoMessage()    {}
+func (*ColumnTableInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_65a2d0bf1752f5d6, []int{4}
+}
+func (m *ColumnTableInfo) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ColumnTableInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ColumnTableInfo.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ColumnTableInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ColumnTableInfo.Merge(m, src)
+}
+func (m *ColumnTableInfo) XXX_Size() int {
+	return m.Size()
+}
+func (m *ColumnTableInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_ColumnTableInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ColumnTableInfo proto.InternalMessageInfo
+
+type ColumnTableList struct {
+	ColumnTables []ColumnTableInfo `protobuf:"bytes,1,rep,name=column_tables,json=columnTables,proto3" json:"column_tables"`
+}
+
+func (m *ColumnTableList) Reset()         { *m = ColumnTableList{} }
+func (m *ColumnTableList) String() string { return proto.CompactTextString(m) }
+func (*ColumnTableList) ProtoMessage()    {}
+func (*ColumnTableList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_65a2d0bf1752f5d6, []int{5}
+}
+func (m *ColumnTableList) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ColumnTableList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ColumnTableList.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ColumnTableList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ColumnTableList.Merge(m, src)
+}
+func (m *ColumnTableList) XXX_Size() int {
+	return m.Size()
+}
+func (m *ColumnTableList) XXX_DiscardUnknown() {
+	xxx_messageInfo_ColumnTableList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ColumnTableList proto.InternalMessageInfo
+
+type HsetIndexField struct {
+	Field     []byte             `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	ValueType IndexPropertyDType `protobuf:"varint,2,opt,name=value_type,json=valueType,proto3,enum=rockredis.IndexPropertyDType" json:"value_type,omitempty"`
+}
+
+func (m *HsetIndexField) Reset()         { *m = HsetIndexField{} }
+func (m *HsetIndexField) String() string { return proto.CompactTextString(m) }
+func (*HsetIndexField) ProtoMessage()    {}
+func (*HsetIndexField) Descriptor() ([]byte, []int) {
+	return fileDescriptor_65a2d0bf1752f5d6, []int{6}
+}
+func (m *HsetIndexField) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *HsetIndexField) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_HsetIndexField.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *HsetIndexField) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HsetIndexField.Merge(m, src)
+}
+func (m *HsetIndexField) XXX_Size() int {
+	return m.Size()
+}
+func (m *HsetIndexField) XXX_DiscardUnknown() {
+	xxx_messageInfo_HsetIndexField.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HsetIndexField proto.InternalMessageInfo
+
 func init() {
 	proto.RegisterEnum("rockredis.IndexPropertyDType", IndexPropertyDType_name, IndexPropertyDType_value)
 	proto.RegisterEnum("rockredis.IndexState", IndexState_name, IndexState_value)
 	proto.RegisterType((*HsetIndexInfo)(nil), "rockredis.HsetIndexInfo")
 	proto.RegisterType((*HsetIndexList)(nil), "rockredis.HsetIndexList")
+	proto.RegisterType((*FullTextIndexInfo)(nil), "rockredis.FullTextIndexInfo")
+	proto.RegisterType((*FullTextIndexList)(nil), "rockredis.FullTextIndexList")
+	proto.RegisterType((*ColumnTableInfo)(nil), "rockredis.ColumnTableInfo")
+	proto.RegisterType((*ColumnTableList)(nil), "rockredis.ColumnTableList")
+	proto.RegisterType((*HsetIndexField)(nil), "rockredis.HsetIndexField")
 }
 
 func init() { proto.RegisterFile("index_types.proto", fileDescriptor_65a2d0bf1752f5d6) }
 
 var fileDescriptor_65a2d0bf1752f5d6 = []byte{
-	// 401 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x92, 0xcf, 0x8a, 0x13, 0x41,
-	0x10, 0xc6, 0xbb, 0xf3, 0x4f, 0x52, 0xf9, 0xc3, 0x6c, 0xa1, 0xd2, 0x08, 0xdb, 0x3b, 0xec, 0x29,
-	0xac, 0x10, 0x21, 0x2b, 0x82, 0xe0, 0xc5, 0x10, 0xc4, 0xc0, 0x1e, 0x64, 0x56, 0x72, 0x0d, 0xd1,
-	0xa9, 0x64, 0x1b, 0xc7, 0xee, 0x71, 0xba, 0x47, 0x76, 0xde, 0xc2, 0xc7, 0xca, 0x31, 0x47, 0x4f,
-	0xe2, 0x26, 0xe0, 0x73, 0xc8, 0x74, 0xaf, 0xba, 0xea, 0xed, 0xab, 0x5f, 0xd5, 0x57, 0x7c, 0xd5,
-	0x34, 0x1c, 0x29, 0x9d, 0xd2, 0xf5, 0xd2, 0x55, 0x39, 0xd9, 0x71, 0x5e, 0x18, 0x67, 0xb0, 0x5b,
-	0x98, 0xf7, 0x1f, 0x0a, 0x4a, 0x95, 0x7d, 0x74, 0x7f, 0x63, 0x36, 0xc6, 0xd3, 0x27, 0xb5, 0x0a,
-	0x03, 0xa7, 0x3f, 0x38, 0x0c, 0x5e, 0x5b, 0x72, 0xf3, 0xda, 0x3a, 0xd7, 0x6b, 0x83, 0x08, 0x2d,
-	0xbd, 0xfa, 0x48, 0x82, 0xc7, 0x7c, 0xd4, 0x4f, 0xbc, 0xc6, 0x13, 0xe8, 0x85, 0xdd, 0x6b, 0x45,
-	0x59, 0x2a, 0x1a, 0xbe, 0x05, 0x1e, 0xbd, 0xaa, 0x09, 0x1e, 0x03, 0xe4, 0x05, 0xad, 0xd5, 0xf5,
-	0x32, 0x23, 0x2d, 0x9a, 0x31, 0x1f, 0xb5, 0x93, 0x6e, 0x20, 0x17, 0xa4, 0xf1, 0x21, 0x74, 0x4a,
-	0xad, 0x3e, 0x95, 0x24, 0x5a, 0xbe, 0x75, 0x5b, 0xe1, 0x0b, 0x80, 0xcf, 0xab, 0xac, 0x24, 0x9f,
-	0x59, 0xb4, 0x63, 0x3e, 0x1a, 0x4e, 0x8e, 0xc7, 0xbf, 0x33, 0x8f, 0x7d, 0xaa, 0x37, 0x85, 0xc9,
-	0xa9, 0x70, 0xd5, 0xec, 0x6d, 0x95, 0x53, 0xd2, 0xf5, 0x86, 0x5a, 0xe2, 0x63, 0x68, 0x5b, 0xb7,
-	0x72, 0x24, 0x3a, 0xde, 0xf8, 0xe0, 0x5f, 0xe3, 0x65, 0xdd, 0x4c, 0xc2, 0xcc, 0x69, 0x72, 0xe7,
-	0xce, 0x0b, 0x65, 0x1d, 0xbe, 0x84, 0xfe, 0x95, 0x25, 0xb7, 0xf4, 0x57, 0x90, 0x15, 0x3c, 0x6e,
-	0x8e, 0x7a, 0x13, 0x71, 0x67, 0xc9, 0x5f, 0xef, 0x32, 0x6d, 0x6d, 0xbf, 0x9d, 0xb0, 0xa4, 0x77,
-	0xf5, 0x0b, 0x92, 0x3d, 0x7b, 0x0e, 0xf8, 0x7f, 0x42, 0x04, 0xe8, 0xcc, 0xb5, 0x7b, 0xf6, 0x74,
-	0x11, 0xb1, 0x5b, 0x7d, 0x3e, 0x59, 0x44, 0x1c, 0x7b, 0x70, 0xef, 0xd2, 0x15, 0x4a, 0x6f, 0x16,
-	0x51, 0xe3, 0x2c, 0x05, 0xf8, 0x93, 0x11, 0x07, 0xd0, 0x9d, 0x6b, 0x15, 0xf6, 0x46, 0x0c, 0x8f,
-	0x60, 0x30, 0x2d, 0x55, 0x96, 0x2a, 0xbd, 0x09, 0x88, 0x23, 0xc2, 0xd0, 0xa3, 0x99, 0xd1, 0x14,
-	0x58, 0x03, 0x87, 0x00, 0x09, 0xad, 0xd2, 0x2a, 0xd4, 0x4d, 0x8c, 0xa0, 0x3f, 0xa3, 0x8c, 0x1c,
-	0xa5, 0x81, 0xb4, 0xa6, 0xf1, 0xf6, 0x46, 0xb2, 0xdd, 0x8d, 0x64, 0xdb, 0xbd, 0xe4, 0xbb, 0xbd,
-	0xe4, 0xdf, 0xf7, 0x92, 0x7f, 0x39, 0x48, 0xb6, 0x3b, 0x48, 0xf6, 0xf5, 0x20, 0xd9, 0xbb, 0x8e,
-	0xff, 0x06, 0xe7, 0x3f, 0x03, 0x00, 0x00, 0xff, 0xff, 0x14, 0x03, 0x0b, 0xa1, 0x3c, 0x02, 0x00,
-	0x00,
+	// 589 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x94, 0xdd, 0x4e, 0x13, 0x41,
+	0x14, 0xc7, 0x77, 0xbb, 0x6d, 0x49, 0x4f, 0x3f, 0x58, 0x26, 0x68, 0x56, 0x22, 0xcb, 0xa6, 0x57,
+	0x0d, 0x26, 0x98, 0x80, 0x31, 0x31, 0xf1, 0x46, 0x44, 0x62, 0x0d, 0x26, 0x64, 0x21, 0xc4, 0xbb,
+	0x66, 0xe9, 0x9e, 0xb6, 0xab, 0xc3, 0xcc, 0xba, 0x33, 0x6b, 0xda, 0xb7, 0xf0, 0xc2, 0x27, 0xf1,
+	0x29, 0xb8, 0xe4, 0xd2, 0x2b, 0x23, 0xf0, 0x22, 0x66, 0x66, 0xba, 0xb4, 0x14, 0x0d, 0x7a, 0x37,
+	0xe7, 0x7f, 0x3e, 0x7a, 0x7e, 0xff, 0x99, 0x2e, 0xac, 0x24, 0x2c, 0xc6, 0x71, 0x4f, 0x4e, 0x52,
+	0x14, 0x5b, 0x69, 0xc6, 0x25, 0x27, 0xb5, 0x8c, 0xf7, 0x3f, 0x65, 0x18, 0x27, 0x62, 0x6d, 0x75,
+	0xc8, 0x87, 0x5c, 0xab, 0x4f, 0xd5, 0xc9, 0x14, 0xb4, 0xbf, 0x97, 0xa0, 0xf9, 0x56, 0xa0, 0xec,
+	0xaa, 0xd6, 0x2e, 0x1b, 0x70, 0x42, 0xa0, 0xcc, 0xa2, 0x33, 0xf4, 0xec, 0xc0, 0xee, 0x34, 0x42,
+	0x7d, 0x26, 0x1b, 0x50, 0x37, 0xb3, 0x07, 0x09, 0xd2, 0xd8, 0x2b, 0xe9, 0x14, 0x68, 0x69, 0x5f,
+	0x29, 0x64, 0x1d, 0x20, 0xcd, 0x70, 0x90, 0x8c, 0x7b, 0x14, 0x99, 0xe7, 0x04, 0x76, 0xa7, 0x12,
+	0xd6, 0x8c, 0x72, 0x80, 0x8c, 0x3c, 0x84, 0x6a, 0xce, 0x92, 0xcf, 0x39, 0x7a, 0x65, 0x9d, 0x9a,
+	0x46, 0xe4, 0x25, 0xc0, 0x97, 0x88, 0xe6, 0xa8, 0x77, 0xf6, 0x2a, 0x81, 0xdd, 0x69, 0x6d, 0xaf,
+	0x6f, 0xdd, 0xec, 0xbc, 0xa5, 0xb7, 0x3a, 0xcc, 0x78, 0x8a, 0x99, 0x9c, 0xec, 0x1d, 0x4f, 0x52,
+	0x0c, 0x6b, 0xba, 0x41, 0x1d, 0xc9, 0x13, 0xa8, 0x08, 0x19, 0x49, 0xf4, 0xaa, 0xba, 0xf1, 0xc1,
+	0x62, 0xe3, 0x91, 0x4a, 0x86, 0xa6, 0x86, 0xbc, 0x03, 0xb7, 0xcf, 0xcf, 0x52, 0x2e, 0x12, 0x89,
+	0x06, 0x43, 0x78, 0x4b, 0x81, 0xd3, 0xa9, 0x6f, 0x3f, 0x9a, 0xeb, 0xbb, 0xb1, 0x42, 0x63, 0xed,
+	0x96, 0xcf, 0x7f, 0x6e, 0x58, 0xe1, 0xf2, 0x4d, 0xa3, 0x56, 0x45, 0x3b, 0x9c, 0xf3, 0xec, 0x20,
+	0x11, 0x92, 0xbc, 0x82, 0xc6, 0x48, 0xa0, 0xec, 0x69, 0x47, 0x50, 0x78, 0xb6, 0x1e, 0xec, 0xfd,
+	0x69, 0xb0, 0xf2, 0x78, 0x3a, 0xb7, 0x3e, 0x2a, 0x44, 0x14, 0xed, 0x6f, 0x36, 0xac, 0xec, 0xe7,
+	0x94, 0x1e, 0xe3, 0xf8, 0xfe, 0xcb, 0x18, 0x45, 0x62, 0x54, 0x40, 0x94, 0x02, 0x47, 0x5d, 0x86,
+	0x92, 0xcc, 0x7a, 0xea, 0x32, 0x3e, 0x0a, 0xce, 0x7a, 0x69, 0x24, 0x47, 0xc2, 0x73, 0x74, 0xbe,
+	0xa6, 0x94, 0x43, 0x25, 0xcc, 0x6c, 0x2b, 0xdf, 0x6f, 0x5b, 0xfb, 0x74, 0x61, 0x2b, 0x8d, 0xfb,
+	0x1e, 0xdc, 0x41, 0x4e, 0xa9, 0xc4, 0xf1, 0x22, 0xf2, 0xe3, 0xb9, 0x61, 0x77, 0x68, 0x0a, 0x3b,
+	0x8b, 0xde, 0x02, 0x9d, 0xc2, 0xf2, 0x6b, 0x4e, 0xf3, 0x33, 0x76, 0x1c, 0x9d, 0x52, 0xfc, 0x2b,
+	0xb7, 0x07, 0x4b, 0x7d, 0x5d, 0x56, 0x30, 0x17, 0xe1, 0x8c, 0xc8, 0xf9, 0x07, 0xa2, 0x0f, 0xb7,
+	0x7e, 0x4d, 0xf3, 0xbc, 0x81, 0xa6, 0x19, 0xd5, 0x93, 0x4a, 0x2b, 0x60, 0xd6, 0xe6, 0xe6, 0x2c,
+	0x2c, 0x38, 0x45, 0x69, 0xf4, 0x67, 0xb2, 0x68, 0xc7, 0xd0, 0xba, 0xfd, 0x7e, 0xc8, 0x2a, 0x54,
+	0xcc, 0x3f, 0xc6, 0x70, 0x98, 0x60, 0xe1, 0xd5, 0x97, 0xfe, 0xef, 0xd5, 0x6f, 0xbe, 0x00, 0x72,
+	0xb7, 0x80, 0x00, 0x54, 0xbb, 0x4c, 0x3e, 0x7f, 0x76, 0xe2, 0x5a, 0xd3, 0xf3, 0xce, 0xf6, 0x89,
+	0x6b, 0x93, 0x3a, 0x2c, 0x1d, 0xc9, 0x2c, 0x61, 0xc3, 0x13, 0xb7, 0xb4, 0x19, 0x03, 0xcc, 0xfc,
+	0x20, 0x4d, 0xa8, 0x75, 0x59, 0x62, 0xd6, 0x75, 0x2d, 0xb2, 0x02, 0xcd, 0xdd, 0x3c, 0xa1, 0x71,
+	0xc2, 0x86, 0x46, 0xb2, 0x09, 0x81, 0x96, 0x96, 0xf6, 0x38, 0x43, 0xa3, 0x95, 0x48, 0x0b, 0x20,
+	0xc4, 0x28, 0x9e, 0x98, 0xd8, 0x21, 0x2e, 0x34, 0xf6, 0x90, 0xa2, 0xc4, 0xd8, 0x28, 0xe5, 0xdd,
+	0xe0, 0xfc, 0xd2, 0xb7, 0x2e, 0x2e, 0x7d, 0xeb, 0xfc, 0xca, 0xb7, 0x2f, 0xae, 0x7c, 0xfb, 0xd7,
+	0x95, 0x6f, 0x7f, 0xbd, 0xf6, 0xad, 0x8b, 0x6b, 0xdf, 0xfa, 0x71, 0xed, 0x5b, 0xa7, 0x55, 0xfd,
+	0xed, 0xd9, 0xf9, 0x3d, 0x00, 0x68, 0x93, 0x9a, 0x41, 0xb1, 0x04, 0x00, 0x00,
 }
 
 func (m *HsetIndexInfo) Marshal() (dAtA []byte, err error) {
@@ -249,6 +457,18 @@ func (m *HsetIndexInfo) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintIndexTypes(dAtA, i, uint64(m.State))
 	}
+	if len(m.CompositeFields) > 0 {
+		for _, msg := range m.CompositeFields {
+			dAtA[i] = 0x3a
+			i++
+			i = encodeVarintIndexTypes(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -282,6 +502,177 @@ func (m *HsetIndexList) MarshalTo(dAtA []byte) (int, error) {
 	return i, nil
 }
 
+func (m *FullTextIndexInfo) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *FullTextIndexInfo) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Name) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintIndexTypes(dAtA, i, uint64(len(m.Name)))
+		i += copy(dAtA[i:], m.Name)
+	}
+	if len(m.HashFields) > 0 {
+		for _, b := range m.HashFields {
+			dAtA[i] = 0x12
+			i++
+			i = encodeVarintIndexTypes(dAtA, i, uint64(len(b)))
+			i += copy(dAtA[i:], b)
+		}
+	}
+	if len(m.JsonPaths) > 0 {
+		for _, b := range m.JsonPaths {
+			dAtA[i] = 0x1a
+			i++
+			i = encodeVarintIndexTypes(dAtA, i, uint64(len(b)))
+			i += copy(dAtA[i:], b)
+		}
+	}
+	if m.State != 0 {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintIndexTypes(dAtA, i, uint64(m.State))
+	}
+	return i, nil
+}
+
+func (m *FullTextIndexList) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *FullTextIndexList) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.FulltextIndexes) > 0 {
+		for _, msg := range m.FulltextIndexes {
+			dAtA[i] = 0xa
+			i++
+			i = encodeVarintIndexTypes(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *ColumnTableInfo) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ColumnTableInfo) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Name) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintIndexTypes(dAtA, i, uint64(len(m.Name)))
+		i += copy(dAtA[i:], m.Name)
+	}
+	if len(m.Columns) > 0 {
+		for _, b := range m.Columns {
+			dAtA[i] = 0x12
+			i++
+			i = encodeVarintIndexTypes(dAtA, i, uint64(len(b)))
+			i += copy(dAtA[i:], b)
+		}
+	}
+	if m.State != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintIndexTypes(dAtA, i, uint64(m.State))
+	}
+	return i, nil
+}
+
+func (m *ColumnTableList) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ColumnTableList) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.ColumnTables) > 0 {
+		for _, msg := range m.ColumnTables {
+			dAtA[i] = 0xa
+			i++
+			i = encodeVarintIndexTypes(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *HsetIndexField) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *HsetIndexField) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Field) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintIndexTypes(dAtA, i, uint64(len(m.Field)))
+		i += copy(dAtA[i:], m.Field)
+	}
+	if m.ValueType != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintIndexTypes(dAtA, i, uint64(m.ValueType))
+	}
+	return i, nil
+}
+
 func encodeVarintIndexTypes(dAtA []byte, offset int, v uint64) int {
 	for v >= 1<<7 {
 		dAtA[offset] = uint8(v&0x7f | 0x80)
@@ -317,6 +708,12 @@ func (m *HsetIndexInfo) Size() (n int) {
 	if m.State != 0 {
 		n += 1 + sovIndexTypes(uint64(m.State))
 	}
+	if len(m.CompositeFields) > 0 {
+		for _, e := range m.CompositeFields {
+			l = e.Size()
+			n += 1 + l + sovIndexTypes(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -332,23 +729,607 @@ func (m *HsetIndexList) Size() (n int) {
 			n += 1 + l + sovIndexTypes(uint64(l))
 		}
 	}
-	return n
-}
+	return n
+}
+
+func (m *FullTextIndexInfo) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Name)
+	if l > 0 {
+		n += 1 + l + sovIndexTypes(uint64(l))
+	}
+	if len(m.HashFields) > 0 {
+		for _, b := range m.HashFields {
+			l = len(b)
+			n += 1 + l + sovIndexTypes(uint64(l))
+		}
+	}
+	if len(m.JsonPaths) > 0 {
+		for _, b := range m.JsonPaths {
+			l = len(b)
+			n += 1 + l + sovIndexTypes(uint64(l))
+		}
+	}
+	if m.State != 0 {
+		n += 1 + sovIndexTypes(uint64(m.State))
+	}
+	return n
+}
+
+func (m *FullTextIndexList) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.FulltextIndexes) > 0 {
+		for _, e := range m.FulltextIndexes {
+			l = e.Size()
+			n += 1 + l + sovIndexTypes(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *ColumnTableInfo) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Name)
+	if l > 0 {
+		n += 1 + l + sovIndexTypes(uint64(l))
+	}
+	if len(m.Columns) > 0 {
+		for _, b := range m.Columns {
+			l = len(b)
+			n += 1 + l + sovIndexTypes(uint64(l))
+		}
+	}
+	if m.State != 0 {
+		n += 1 + sovIndexTypes(uint64(m.State))
+	}
+	return n
+}
+
+func (m *ColumnTableList) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.ColumnTables) > 0 {
+		for _, e := range m.ColumnTables {
+			l = e.Size()
+			n += 1 + l + sovIndexTypes(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *HsetIndexField) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Field)
+	if l > 0 {
+		n += 1 + l + sovIndexTypes(uint64(l))
+	}
+	if m.ValueType != 0 {
+		n += 1 + sovIndexTypes(uint64(m.ValueType))
+	}
+	return n
+}
+
+func sovIndexTypes(x uint64) (n int) {
+	for {
+		n++
+		x >>= 7
+		if x == 0 {
+			break
+		}
+	}
+	return n
+}
+func sozIndexTypes(x uint64) (n int) {
+	return sovIndexTypes(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndexTypes
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: HsetIndexInfo: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: HsetIndexInfo: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = append(m.Name[:0], dAtA[iNdEx:postIndex]...)
+			if m.Name == nil {
+				m.Name = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IndexField", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.IndexField = append(m.IndexField[:0], dAtA[iNdEx:postIndex]...)
+			if m.IndexField == nil {
+				m.IndexField = []byte{}
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PrefixLen", wireType)
+			}
+			m.PrefixLen = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.PrefixLen |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Unique", wireType)
+			}
+			m.Unique = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Unique |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ValueType", wireType)
+			}
+			m.ValueType = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ValueType |= IndexPropertyDType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
+			}
+			m.State = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.State |= IndexState(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CompositeFields", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.CompositeFields = append(m.CompositeFields, HsetIndexField{})
+			if err := m.CompositeFields[len(m.CompositeFields)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndexTypes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *HsetIndexList) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndexTypes
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: HsetIndexList: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: HsetIndexList: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field HsetIndexes", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.HsetIndexes = append(m.HsetIndexes, HsetIndexInfo{})
+			if err := m.HsetIndexes[len(m.HsetIndexes)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndexTypes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *FullTextIndexInfo) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndexTypes
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: FullTextIndexInfo: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: FullTextIndexInfo: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = append(m.Name[:0], dAtA[iNdEx:postIndex]...)
+			if m.Name == nil {
+				m.Name = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field HashFields", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.HashFields = append(m.HashFields, make([]byte, postIndex-iNdEx))
+			copy(m.HashFields[len(m.HashFields)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field JsonPaths", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.JsonPaths = append(m.JsonPaths, make([]byte, postIndex-iNdEx))
+			copy(m.JsonPaths[len(m.JsonPaths)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
+			}
+			m.State = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.State |= IndexState(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndexTypes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
 
-func sovIndexTypes(x uint64) (n int) {
-	for {
-		n++
-		x >>= 7
-		if x == 0 {
-			break
-		}
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
 	}
-	return n
-}
-func sozIndexTypes(x uint64) (n int) {
-	return sovIndexTypes(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+	return nil
 }
-func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
+func (m *FullTextIndexList) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -371,17 +1352,17 @@ func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: HsetIndexInfo: wiretype end group for non-group")
+			return fmt.Errorf("proto: FullTextIndexList: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: HsetIndexInfo: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: FullTextIndexList: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field FulltextIndexes", wireType)
 			}
-			var byteLen int
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndexTypes
@@ -391,29 +1372,83 @@ func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				byteLen |= int(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if byteLen < 0 {
+			if msglen < 0 {
 				return ErrInvalidLengthIndexTypes
 			}
-			postIndex := iNdEx + byteLen
+			postIndex := iNdEx + msglen
 			if postIndex < 0 {
 				return ErrInvalidLengthIndexTypes
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Name = append(m.Name[:0], dAtA[iNdEx:postIndex]...)
-			if m.Name == nil {
-				m.Name = []byte{}
+			m.FulltextIndexes = append(m.FulltextIndexes, FullTextIndexInfo{})
+			if err := m.FulltextIndexes[len(m.FulltextIndexes)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
 			}
 			iNdEx = postIndex
-		case 2:
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndexTypes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (m *ColumnTableInfo) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndexTypes
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ColumnTableInfo: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ColumnTableInfo: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field IndexField", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
 			}
 			var byteLen int
 			for shift := uint(0); ; shift += 7 {
@@ -440,16 +1475,16 @@ func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.IndexField = append(m.IndexField[:0], dAtA[iNdEx:postIndex]...)
-			if m.IndexField == nil {
-				m.IndexField = []byte{}
+			m.Name = append(m.Name[:0], dAtA[iNdEx:postIndex]...)
+			if m.Name == nil {
+				m.Name = []byte{}
 			}
 			iNdEx = postIndex
-		case 3:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field PrefixLen", wireType)
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Columns", wireType)
 			}
-			m.PrefixLen = 0
+			var byteLen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndexTypes
@@ -459,35 +1494,29 @@ func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.PrefixLen |= int32(b&0x7F) << shift
+				byteLen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-		case 4:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Unique", wireType)
+			if byteLen < 0 {
+				return ErrInvalidLengthIndexTypes
 			}
-			m.Unique = 0
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowIndexTypes
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := dAtA[iNdEx]
-				iNdEx++
-				m.Unique |= int32(b&0x7F) << shift
-				if b < 0x80 {
-					break
-				}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndexTypes
 			}
-		case 5:
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Columns = append(m.Columns, make([]byte, postIndex-iNdEx))
+			copy(m.Columns[len(m.Columns)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
 			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field ValueType", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
 			}
-			m.ValueType = 0
+			m.State = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndexTypes
@@ -497,16 +1526,69 @@ func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.ValueType |= IndexPropertyDType(b&0x7F) << shift
+				m.State |= IndexState(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-		case 6:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIndexTypes(dAtA[iNdEx:])
+			if err != nil {
+				return err
 			}
-			m.State = 0
+			if skippy < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ColumnTableList) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIndexTypes
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ColumnTableList: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ColumnTableList: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ColumnTables", wireType)
+			}
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndexTypes
@@ -516,11 +1598,26 @@ func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.State |= IndexState(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if msglen < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthIndexTypes
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ColumnTables = append(m.ColumnTables, ColumnTableInfo{})
+			if err := m.ColumnTables[len(m.ColumnTables)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipIndexTypes(dAtA[iNdEx:])
@@ -545,7 +1642,7 @@ func (m *HsetIndexInfo) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *HsetIndexList) Unmarshal(dAtA []byte) error {
+func (m *HsetIndexField) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -568,17 +1665,17 @@ func (m *HsetIndexList) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: HsetIndexList: wiretype end group for non-group")
+			return fmt.Errorf("proto: HsetIndexField: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: HsetIndexList: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: HsetIndexField: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field HsetIndexes", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Field", wireType)
 			}
-			var msglen int
+			var byteLen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowIndexTypes
@@ -588,26 +1685,45 @@ func (m *HsetIndexList) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				byteLen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
+			if byteLen < 0 {
 				return ErrInvalidLengthIndexTypes
 			}
-			postIndex := iNdEx + msglen
+			postIndex := iNdEx + byteLen
 			if postIndex < 0 {
 				return ErrInvalidLengthIndexTypes
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.HsetIndexes = append(m.HsetIndexes, HsetIndexInfo{})
-			if err := m.HsetIndexes[len(m.HsetIndexes)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
+			m.Field = append(m.Field[:0], dAtA[iNdEx:postIndex]...)
+			if m.Field == nil {
+				m.Field = []byte{}
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ValueType", wireType)
+			}
+			m.ValueType = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIndexTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ValueType |= IndexPropertyDType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipIndexTypes(dAtA[iNdEx:])
@@ -0,0 +1,215 @@
+package rockredis
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// JSONPath syntax (begin with $) is supported in addition to the gjson style path,
+// such as $.a.b, $.a[0], $['a'], $.a[*], $..a
+// Note: the recursive and wildcard path can only be used for read.
+
+var (
+	errInvalidJSONPath    = errors.New("invalid json path")
+	errJSONPathNotSupport = errors.New("json path with recursive or wildcard not supported for write")
+)
+
+type jsonPathSeg struct {
+	key       string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+func isJSONPath(path string) bool {
+	return len(path) > 0 && path[0] == '$'
+}
+
+func parseJSONPath(path string) ([]jsonPathSeg, error) {
+	if !isJSONPath(path) {
+		return nil, errInvalidJSONPath
+	}
+	segs := make([]jsonPathSeg, 0, 4)
+	var err error
+	i := 1
+	for i < len(path) {
+		var seg jsonPathSeg
+		if path[i] == '.' {
+			i++
+			if i < len(path) && path[i] == '.' {
+				seg.recursive = true
+				i++
+			}
+			if i >= len(path) {
+				return nil, errInvalidJSONPath
+			}
+			if path[i] != '[' {
+				start := i
+				for i < len(path) && path[i] != '.' && path[i] != '[' {
+					i++
+				}
+				name := path[start:i]
+				if name == "*" {
+					seg.wildcard = true
+				} else {
+					seg.key = name
+				}
+				segs = append(segs, seg)
+				continue
+			}
+		}
+		if path[i] != '[' {
+			return nil, errInvalidJSONPath
+		}
+		i, err = parseJSONPathBracket(path, i, &seg)
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, seg)
+	}
+	return segs, nil
+}
+
+// parse the bracket part such as [0], [*], ['key'], return the position after the bracket
+func parseJSONPathBracket(path string, i int, seg *jsonPathSeg) (int, error) {
+	i++
+	if i >= len(path) {
+		return i, errInvalidJSONPath
+	}
+	if q := path[i]; q == '\'' || q == '"' {
+		end := strings.IndexByte(path[i+1:], q)
+		if end < 0 {
+			return i, errInvalidJSONPath
+		}
+		seg.key = path[i+1 : i+1+end]
+		i = i + 1 + end + 1
+		if i >= len(path) || path[i] != ']' {
+			return i, errInvalidJSONPath
+		}
+		return i + 1, nil
+	}
+	end := strings.IndexByte(path[i:], ']')
+	if end < 0 {
+		return i, errInvalidJSONPath
+	}
+	content := strings.TrimSpace(path[i : i+end])
+	if content == "*" {
+		seg.wildcard = true
+	} else {
+		index, err := strconv.Atoi(content)
+		if err != nil {
+			return i, errInvalidJSONPath
+		}
+		seg.index = index
+		seg.isIndex = true
+	}
+	return i + end + 1, nil
+}
+
+func escapeJSONPathKey(key string) string {
+	if !strings.ContainsAny(key, `.*?#\:`) {
+		return key
+	}
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '.', '*', '?', '#', '\\', ':':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(key[i])
+	}
+	return b.String()
+}
+
+// convert the JSONPath to gjson style path, false will be returned if the path
+// can not be converted (recursive, wildcard or negative index)
+func jsonPathToGJSONPath(segs []jsonPathSeg) (string, bool) {
+	parts := make([]string, 0, len(segs))
+	for _, seg := range segs {
+		if seg.recursive || seg.wildcard {
+			return "", false
+		}
+		if seg.isIndex {
+			if seg.index < 0 {
+				return "", false
+			}
+			parts = append(parts, strconv.Itoa(seg.index))
+		} else {
+			parts = append(parts, escapeJSONPathKey(seg.key))
+		}
+	}
+	return strings.Join(parts, "."), true
+}
+
+// query all the matched values for the JSONPath
+func queryJSONPath(jdata []byte, path string) ([]gjson.Result, error) {
+	segs, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	cur := []gjson.Result{gjson.ParseBytes(jdata)}
+	if !cur[0].Exists() {
+		return nil, nil
+	}
+	for _, seg := range segs {
+		next := make([]gjson.Result, 0, len(cur))
+		for _, r := range cur {
+			if seg.recursive {
+				next = appendJSONPathRecursive(next, r, seg)
+			} else {
+				next = appendJSONPathMatch(next, r, seg)
+			}
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+func appendJSONPathMatch(rets []gjson.Result, r gjson.Result, seg jsonPathSeg) []gjson.Result {
+	switch {
+	case seg.wildcard:
+		if r.IsArray() || r.IsObject() {
+			r.ForEach(func(_, v gjson.Result) bool {
+				rets = append(rets, v)
+				return true
+			})
+		}
+	case seg.isIndex:
+		if r.IsArray() {
+			arr := r.Array()
+			index := seg.index
+			if index < 0 {
+				index += len(arr)
+			}
+			if index >= 0 && index < len(arr) {
+				rets = append(rets, arr[index])
+			}
+		}
+	default:
+		if r.IsObject() {
+			r.ForEach(func(k, v gjson.Result) bool {
+				if k.String() == seg.key {
+					rets = append(rets, v)
+					return false
+				}
+				return true
+			})
+		}
+	}
+	return rets
+}
+
+func appendJSONPathRecursive(rets []gjson.Result, r gjson.Result, seg jsonPathSeg) []gjson.Result {
+	rets = appendJSONPathMatch(rets, r, seg)
+	if r.IsArray() || r.IsObject() {
+		r.ForEach(func(_, v gjson.Result) bool {
+			rets = appendJSONPathRecursive(rets, v, seg)
+			return true
+		})
+	}
+	return rets
+}
@@ -29,6 +29,8 @@ const (
 	MaxRemoteCheckpointNum = 3
 	HLLReadCacheSize       = 1024
 	HLLWriteCacheSize      = 32
+	SketchReadCacheSize    = 128
+	SketchWriteCacheSize   = 16
 	writeTmpSize           = 1024 * 512
 )
 
@@ -166,9 +168,11 @@ type RockDB struct {
 	backupC           chan *BackupInfo
 	indexMgr          *IndexMgr
 	isBatching        int32
+	applyMutex        sync.Mutex
 	checkpointDirLock sync.RWMutex
 	hasher64          hash.Hash64
 	hllCache          *hllCache
+	sketchCache       *sketchCache
 	stopping          int32
 	engOpened         int32
 	latestSnapIndex   uint64
@@ -257,6 +261,10 @@ func (r *RockDB) reOpenEng() error {
 		return err
 	}
 	r.hllCache = hcache
+	r.sketchCache, err = newSketchCache(SketchReadCacheSize, SketchWriteCacheSize, r)
+	if err != nil {
+		return err
+	}
 	r.indexMgr = NewIndexMgr()
 
 	err = r.rockEng.OpenEng()
@@ -302,6 +310,9 @@ func (r *RockDB) closeEng() {
 		if r.hllCache != nil {
 			r.hllCache.Flush()
 		}
+		if r.sketchCache != nil {
+			r.sketchCache.Flush()
+		}
 		if r.indexMgr != nil {
 			r.indexMgr.Close()
 		}
@@ -458,6 +469,14 @@ func getTableDataRange(dt byte, table []byte, start, end []byte) ([]engine.CRang
 		}
 		rgs = append(rgs, engine.CRange{Start: zminKey, Limit: zmaxKey})
 	}
+	if dt == KVType {
+		// the chunks of the large kv value
+		crg, err := encodeChunkTableRange(KVChunkExtType, table, start, end)
+		if err != nil {
+			return nil, err
+		}
+		rgs = append(rgs, crg)
+	}
 	dbLog.Debugf("table dt %v data range: %v", dt, rgs)
 	return rgs, nil
 }
@@ -720,7 +739,12 @@ func (r *RockDB) Backup(term uint64, index uint64) *BackupInfo {
 	fname := GetCheckpointDir(term, index)
 	checkpointDir := path.Join(r.GetBackupDir(), fname)
 	bi := newBackupInfo(checkpointDir)
+	// flush with the apply lock held, so it will not run concurrently with
+	// the expired data deletion outside raft
+	r.LockApply()
 	r.hllCache.Flush()
+	r.sketchCache.Flush()
+	r.UnlockApply()
 	select {
 	case r.backupC <- bi:
 	default:
@@ -966,6 +990,18 @@ func (r *RockDB) GetAllIndexSchema() (map[string]*common.IndexSchema, error) {
 	return r.indexMgr.GetAllIndexSchemaInfo(r)
 }
 
+func (r *RockDB) GetIndexJobs() []common.IndexJobProgress {
+	return r.indexMgr.GetIndexJobs()
+}
+
+func (r *RockDB) SetIndexJobThrottle(rate int64, paused bool) {
+	r.indexMgr.SetIndexJobThrottle(rate, paused)
+}
+
+func (r *RockDB) VerifyHsetIndex(table string, name string, repair bool) error {
+	return r.indexMgr.VerifyHsetIndex(r, table, name, repair)
+}
+
 func (r *RockDB) AddHsetIndex(table string, hindex *common.HsetIndexSchema) error {
 	indexInfo := HsetIndexInfo{
 		Name:       []byte(hindex.Name),
@@ -975,6 +1011,12 @@ func (r *RockDB) AddHsetIndex(table string, hindex *common.HsetIndexSchema) erro
 		ValueType:  IndexPropertyDType(hindex.ValueType),
 		State:      IndexState(hindex.State),
 	}
+	for _, f := range hindex.CompositeFields {
+		indexInfo.CompositeFields = append(indexInfo.CompositeFields, HsetIndexField{
+			Field:     []byte(f.Field),
+			ValueType: IndexPropertyDType(f.ValueType),
+		})
+	}
 	index := &HsetIndex{
 		Table:         []byte(table),
 		HsetIndexInfo: indexInfo,
@@ -986,8 +1028,88 @@ func (r *RockDB) UpdateHsetIndexState(table string, hindex *common.HsetIndexSche
 	return r.indexMgr.UpdateHsetIndexState(r, table, hindex.IndexField, IndexState(hindex.State))
 }
 
+func (r *RockDB) AddJSONIndex(table string, jindex *common.JSONIndexSchema) error {
+	indexInfo := HsetIndexInfo{
+		Name:       []byte(jindex.Name),
+		IndexField: []byte(jindex.Path),
+		PrefixLen:  jindex.PrefixLen,
+		ValueType:  IndexPropertyDType(jindex.ValueType),
+		State:      IndexState(jindex.State),
+	}
+	return r.indexMgr.AddJSONIndex(r, newJSONIndex([]byte(table), indexInfo))
+}
+
+func (r *RockDB) UpdateJSONIndexState(table string, jindex *common.JSONIndexSchema) error {
+	return r.indexMgr.UpdateJSONIndexState(r, table, jindex.Path, IndexState(jindex.State))
+}
+
+func (r *RockDB) AddFullTextIndex(table string, findex *common.FullTextIndexSchema) error {
+	indexInfo := FullTextIndexInfo{
+		Name:  []byte(findex.Name),
+		State: IndexState(findex.State),
+	}
+	for _, f := range findex.HashFields {
+		indexInfo.HashFields = append(indexInfo.HashFields, []byte(f))
+	}
+	for _, p := range findex.JSONPaths {
+		indexInfo.JsonPaths = append(indexInfo.JsonPaths, []byte(p))
+	}
+	index := &FullTextIndex{
+		Table:             []byte(table),
+		FullTextIndexInfo: indexInfo,
+	}
+	return r.indexMgr.AddFullTextIndex(r, index)
+}
+
+func (r *RockDB) UpdateFullTextIndexState(table string, findex *common.FullTextIndexSchema) error {
+	return r.indexMgr.UpdateFullTextIndexState(r, table, findex.Name, IndexState(findex.State))
+}
+
+func (r *RockDB) AddColumnTable(table string, cschema *common.ColumnTableSchema) error {
+	info := ColumnTableInfo{
+		Name:  []byte(cschema.Name),
+		State: IndexState(cschema.State),
+	}
+	for _, c := range cschema.Columns {
+		info.Columns = append(info.Columns, []byte(c))
+	}
+	ct := &ColumnTable{
+		Table:           []byte(table),
+		ColumnTableInfo: info,
+	}
+	return r.indexMgr.AddColumnTable(r, ct)
+}
+
+func (r *RockDB) UpdateColumnTableState(table string, cschema *common.ColumnTableSchema) error {
+	return r.indexMgr.UpdateColumnTableState(r, table, cschema.Name, IndexState(cschema.State))
+}
+
+func (r *RockDB) SetTableSchema(table string, schema *common.TableSchema) error {
+	return r.indexMgr.SetTableSchema(r, table, schema)
+}
+
+func (r *RockDB) DeleteTableSchema(table string) error {
+	return r.indexMgr.DeleteTableSchema(r, table)
+}
+
+func (r *RockDB) GetTableSchema(table string) *common.TableSchema {
+	return r.indexMgr.GetTableSchema(table)
+}
+
+// LockApply should be held while applying the non-batched write from raft, so the
+// local writes outside raft will not read-modify-write the same data concurrently.
+// The batched write will hold it from BeginBatchWrite until the batch committed or aborted.
+func (r *RockDB) LockApply() {
+	r.applyMutex.Lock()
+}
+
+func (r *RockDB) UnlockApply() {
+	r.applyMutex.Unlock()
+}
+
 func (r *RockDB) BeginBatchWrite() error {
 	if atomic.CompareAndSwapInt32(&r.isBatching, 0, 1) {
+		r.applyMutex.Lock()
 		return nil
 	}
 	return errors.New("another batching is waiting")
@@ -999,28 +1121,48 @@ func (r *RockDB) MaybeCommitBatch() error {
 	}
 	err := r.rockEng.Write(r.wb)
 	r.wb.Clear()
+	if r.indexMgr != nil {
+		r.indexMgr.resetColumnPending()
+		r.indexMgr.resetUniquePending()
+	}
 	return err
 }
 
 func (r *RockDB) CommitBatchWrite() error {
+	if r.indexMgr != nil {
+		r.indexMgr.flushColumnPending(r.wb)
+	}
 	err := r.rockEng.Write(r.wb)
 	if err != nil {
 		dbLog.Infof("commit write error: %v", err)
 	}
 	r.wb.Clear()
-	atomic.StoreInt32(&r.isBatching, 0)
+	if r.indexMgr != nil {
+		r.indexMgr.resetColumnPending()
+		r.indexMgr.resetUniquePending()
+	}
+	if atomic.CompareAndSwapInt32(&r.isBatching, 1, 0) {
+		r.applyMutex.Unlock()
+	}
 	return err
 }
 
 func (r *RockDB) AbortBatch() {
 	r.wb.Clear()
-	atomic.StoreInt32(&r.isBatching, 0)
+	if atomic.CompareAndSwapInt32(&r.isBatching, 1, 0) {
+		r.applyMutex.Unlock()
+	}
+	if r.indexMgr != nil {
+		r.indexMgr.resetFullTextStats()
+		r.indexMgr.resetColumnPending()
+		r.indexMgr.resetUniquePending()
+	}
 }
 
 func IsNeedAbortError(err error) bool {
 	// for the error which will not touch write batch no need abort
 	// since it will not affect the write buffer in batch
-	if err == errTooMuchBatchSize {
+	if err == errTooMuchBatchSize || err == ErrIndexUniqueConflict {
 		return false
 	}
 	return true
@@ -17,9 +17,12 @@ import (
 	"github.com/youzan/ZanRedisDB/slow"
 )
 
-const (
-	testEngineType = "mem"
-)
+// the engine used by all the tests, can be changed by -args -engine_type=pebble
+var testEngineType string
+
+func init() {
+	flag.StringVar(&testEngineType, "engine_type", "mem", "the engine type for tests: rocksdb, pebble, badger or mem")
+}
 
 type testLogger struct {
 	t *testing.T
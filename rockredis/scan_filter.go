@@ -0,0 +1,257 @@
+package rockredis
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+const (
+	// the max keys can be scanned for each matched key while scanning with filter,
+	// to avoid scanning the whole db in one scan command.
+	scanFilterStepFactor = 16
+)
+
+var (
+	errScanFilterNotSupport    = errors.New("scan filter not supported for the data type")
+	errScanFilterTTLNotSupport = errors.New("scan filter of ttl not supported under the local deletion ttl policy")
+)
+
+// ScanFilterRange is the closed range [Min, Max] for the filter value
+type ScanFilterRange struct {
+	Min int64
+	Max int64
+}
+
+// NewScanFilterRange return the full range which match all
+func NewScanFilterRange() *ScanFilterRange {
+	return &ScanFilterRange{Min: math.MinInt64, Max: math.MaxInt64}
+}
+
+func (r *ScanFilterRange) match(v int64) bool {
+	if r == nil {
+		return true
+	}
+	return v >= r.Min && v <= r.Max
+}
+
+// ScanFilter is used to filter the scanned keys on the partition by the value meta
+type ScanFilter struct {
+	// value size in bytes, only for kv
+	Size *ScanFilterRange
+	// element count, only for the collection types
+	Card *ScanFilterRange
+	// ttl in seconds, -1 for the key without ttl.
+	// note the ttl can only be filtered under the compact ttl policy, since the ttl
+	// is not stored in the key meta under the local deletion policy
+	TTL *ScanFilterRange
+	// the last modify time in nano seconds
+	Version *ScanFilterRange
+}
+
+func (f *ScanFilter) IsEmpty() bool {
+	return f == nil || (f.Size == nil && f.Card == nil && f.TTL == nil && f.Version == nil)
+}
+
+// check if the filter can be used for the data type
+func (f *ScanFilter) Check(dataType common.DataType) error {
+	if f.IsEmpty() {
+		return nil
+	}
+	switch dataType {
+	case common.KV:
+		if f.Card != nil {
+			return errScanFilterNotSupport
+		}
+	case common.HASH:
+		// hash meta has no modify time
+		if f.Size != nil || f.Version != nil {
+			return errScanFilterNotSupport
+		}
+	case common.LIST, common.SET, common.ZSET:
+		if f.Size != nil {
+			return errScanFilterNotSupport
+		}
+	default:
+		return errScanFilterNotSupport
+	}
+	return nil
+}
+
+// check if the filter can be used for the data type under the expiration policy of db
+func (db *RockDB) checkScanFilter(dataType common.DataType, f *ScanFilter) error {
+	if err := f.Check(dataType); err != nil {
+		return err
+	}
+	if f != nil && f.TTL != nil && db.cfg.ExpirationPolicy == common.LocalDeletion {
+		return errScanFilterTTLNotSupport
+	}
+	return nil
+}
+
+// get the data type used for the expiration from the scan store data type
+func getScanFilterDataType(storeDataType byte) byte {
+	switch storeDataType {
+	case LMetaType:
+		return ListType
+	case HSizeType:
+		return HashType
+	case SSizeType:
+		return SetType
+	case ZSizeType:
+		return ZSetType
+	default:
+		return storeDataType
+	}
+}
+
+// match the key using the raw meta value of the key, the raw value is the value of the scanned meta key
+// (for kv the raw value is the full value with header and modify time)
+func (db *RockDB) scanFilterMatch(ts int64, storeDataType byte, key []byte, rawValue []byte, f *ScanFilter) (bool, error) {
+	if f.IsEmpty() {
+		return true, nil
+	}
+	if rawValue == nil {
+		return false, nil
+	}
+	dt := getScanFilterDataType(storeDataType)
+	expired, err := db.expiration.isExpired(ts, dt, key, rawValue, true)
+	if err != nil || expired {
+		return false, err
+	}
+	if f.TTL != nil {
+		ttl, err := db.expiration.ttl(ts, dt, key, rawValue)
+		if err != nil {
+			return false, err
+		}
+		if !f.TTL.match(ttl) {
+			return false, nil
+		}
+	}
+	var size, ver int64
+	switch dt {
+	case KVType:
+		if len(rawValue) >= tsLen {
+			ver, err = Int64(rawValue[len(rawValue)-tsLen:], nil)
+			if err != nil {
+				return false, err
+			}
+		}
+		realV, _, err := db.decodeDBRawValueToRealValue(rawValue)
+		if err != nil {
+			return false, err
+		}
+		return f.Size.match(chunkedValueLen(realV)) && f.Version.match(ver), nil
+	case HashType:
+		h, err := db.expiration.decodeRawValue(dt, rawValue)
+		if err != nil {
+			return false, err
+		}
+		size, err = Int64(h.UserData, nil)
+		if err != nil {
+			return false, err
+		}
+	case ListType:
+		h, err := db.expiration.decodeRawValue(dt, rawValue)
+		if err != nil {
+			return false, err
+		}
+		_, _, size, ver, err = parseListMeta(h.UserData)
+		if err != nil {
+			return false, err
+		}
+	case SetType, ZSetType:
+		h, err := db.expiration.decodeRawValue(dt, rawValue)
+		if err != nil {
+			return false, err
+		}
+		size, ver, err = parseZMeta(h.UserData)
+		if err != nil {
+			return false, err
+		}
+	default:
+		return false, errScanFilterNotSupport
+	}
+	return f.Card.match(size) && f.Version.match(ver), nil
+}
+
+// ScanWithFilter scan the keys and filter them using the value meta. Since many keys may be filtered,
+// the scanned keys will be limited and the next cursor will be returned, empty cursor means no more keys.
+// Note: this scan will not stop while cross table, the caller should check the table.
+func (db *RockDB) ScanWithFilter(dataType common.DataType, cursor []byte, count int, match string,
+	filter *ScanFilter, reverse bool) ([][]byte, []byte, error) {
+	storeDataType, err := getDataStoreType(dataType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := db.checkScanFilter(dataType, filter); err != nil {
+		return nil, nil, err
+	}
+	r, err := buildMatchRegexp(match)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	minKey, maxKey, err := buildScanKeyRange(storeDataType, cursor, reverse)
+	if err != nil {
+		return nil, nil, err
+	}
+	count = checkScanCount(count)
+	maxStep := count * scanFilterStepFactor
+
+	it, err := db.buildScanIterator(minKey, maxKey, reverse)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer it.Close()
+
+	tn := time.Now().UnixNano()
+	v := make([][]byte, 0, count)
+	var lastKey []byte
+	step := 0
+	for ; it.Valid() && len(v) < count && step < maxStep; it.Next() {
+		step++
+		k, err := decodeScanKey(storeDataType, it.Key())
+		if err != nil {
+			continue
+		}
+		lastKey = k
+		if r != nil && !r.Match(string(k)) {
+			continue
+		}
+		ok, err := db.scanFilterMatch(tn, storeDataType, k, it.RefValue(), filter)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			v = append(v, k)
+		}
+	}
+	if !it.Valid() {
+		lastKey = nil
+	}
+	return v, lastKey, nil
+}
+
+// fullScanFilterMatch read the meta of the key in full scan and check if matched,
+// the key is the scanned key from data (it may be the version key for collection)
+func (db *RockDB) fullScanFilterMatch(ts int64, dt byte, table []byte, key []byte, f *ScanFilter) (bool, error) {
+	fullKey := key
+	if dt != KVType {
+		rk, _, err := db.expiration.decodeFromVersionKey(dt, key)
+		if err != nil {
+			return false, err
+		}
+		fullKey = make([]byte, 0, len(table)+1+len(rk))
+		fullKey = append(fullKey, table...)
+		fullKey = append(fullKey, tableStartSep)
+		fullKey = append(fullKey, rk...)
+	}
+	v, err := db.GetBytes(encodeMetaKey(dt, fullKey))
+	if err != nil {
+		return false, err
+	}
+	return db.scanFilterMatch(ts, dt, fullKey, v, f)
+}
@@ -2,6 +2,7 @@ package rockredis
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"testing"
@@ -315,3 +316,95 @@ func TestRockDB_ZsetScan(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, len(fieldList2)-1, len(fvs))
 }
+
+func TestRockDB_ScanWithFilter(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	total := 50
+	for i := 0; i < total; i++ {
+		key := []byte(fmt.Sprintf("test:test_filter_scan_key_%05d", i))
+		fields := make([]common.KVRecord, 0, i+1)
+		for j := 0; j <= i; j++ {
+			fields = append(fields, common.KVRecord{Key: []byte(fmt.Sprintf("f%d", j)), Value: key})
+		}
+		err := db.HMset(int64(i+1), key, fields...)
+		assert.Nil(t, err)
+		err = db.KVSet(int64(i+1), key, make([]byte, i+1))
+		assert.Nil(t, err)
+	}
+
+	filter := &ScanFilter{Card: &ScanFilterRange{Min: 41, Max: math.MaxInt64}}
+	keys, next, err := db.ScanWithFilter(common.HASH, []byte("test:"), 100, "", filter, false)
+	assert.Nil(t, err)
+	assert.Nil(t, next)
+	assert.Equal(t, 10, len(keys))
+	assert.Equal(t, []byte("test:test_filter_scan_key_00040"), keys[0])
+
+	// the scan step is limited, so the next cursor should be returned
+	keys, next, err = db.ScanWithFilter(common.HASH, []byte("test:"), 1, "", filter, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	assert.Equal(t, []byte(fmt.Sprintf("test:test_filter_scan_key_%05d", scanFilterStepFactor-1)), next)
+
+	filter = &ScanFilter{Size: &ScanFilterRange{Min: 1, Max: 5}, Version: &ScanFilterRange{Min: 2, Max: math.MaxInt64}}
+	keys, _, err = db.ScanWithFilter(common.KV, []byte("test:"), 100, "", filter, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(keys))
+	assert.Equal(t, []byte("test:test_filter_scan_key_00001"), keys[0])
+
+	_, _, err = db.ScanWithFilter(common.HASH, []byte("test:"), 100, "", filter, false)
+	assert.Equal(t, errScanFilterNotSupport, err)
+
+	// the ttl is not available under the local deletion policy
+	filter = &ScanFilter{TTL: &ScanFilterRange{Min: -1, Max: -1}}
+	_, _, err = db.ScanWithFilter(common.HASH, []byte("test:"), 100, "", filter, false)
+	assert.Equal(t, errScanFilterTTLNotSupport, err)
+	ret := db.FullScanWithFilter(common.HASH, []byte("test:"), 100, "", filter)
+	assert.Equal(t, errScanFilterTTLNotSupport, ret.Error)
+
+	filter = &ScanFilter{Card: &ScanFilterRange{Min: 0, Max: 2}}
+	ret = db.FullScanWithFilter(common.HASH, []byte("test:"), 100, "", filter)
+	assert.Nil(t, ret.Error)
+	assert.Equal(t, 2, len(ret.Results))
+	assert.Equal(t, []byte(""), ret.NextCursor)
+}
+
+func TestRockDB_FullScanWithFilterStepLimit(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	count := 2
+	notMatched := count*scanFilterStepFactor*2 + 10
+	matched := 5
+	for i := 0; i < notMatched+matched; i++ {
+		key := []byte(fmt.Sprintf("test:test_filter_full_scan_key_%05d", i))
+		size := 1
+		if i >= notMatched {
+			size = 10
+		}
+		err := db.KVSet(int64(i+1), key, make([]byte, size))
+		assert.Nil(t, err)
+	}
+
+	filter := &ScanFilter{Size: &ScanFilterRange{Min: 10, Max: 10}}
+	cursor := []byte("test:")
+	keys := make([][]byte, 0)
+	for loop := 0; loop < notMatched+matched; loop++ {
+		ret := db.FullScanWithFilter(common.KV, cursor, count, "", filter)
+		assert.Nil(t, ret.Error)
+		for _, r := range ret.Results {
+			keys = append(keys, r.([]interface{})[0].([]byte))
+		}
+		if len(ret.NextCursor) == 0 {
+			break
+		}
+		cursor = append([]byte("test:"), ret.NextCursor...)
+	}
+	assert.Equal(t, matched, len(keys))
+	for i, k := range keys {
+		assert.Equal(t, []byte(fmt.Sprintf("test:test_filter_full_scan_key_%05d", notMatched+i)), k)
+	}
+}
@@ -0,0 +1,238 @@
+package rockredis
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+// SQLQueryPlan is how the matched keys of the sql query are found in the partition
+type SQLQueryPlan int
+
+const (
+	// scan all the hash keys in the table and check the where expression for each key
+	SQLPlanFullScan SQLQueryPlan = iota
+	// search the hash indexes using the where expression
+	SQLPlanIndex
+	// scan the number index on the order field in order
+	SQLPlanOrderedIndex
+)
+
+func (p SQLQueryPlan) String() string {
+	switch p {
+	case SQLPlanIndex:
+		return "index"
+	case SQLPlanOrderedIndex:
+		return "ordered_index"
+	default:
+		return "fullscan"
+	}
+}
+
+// SQLQuery is the read only query on the hash keys of the table in this partition
+type SQLQuery struct {
+	Table []byte
+	// nil if all the keys in the table are matched
+	Where *IndexQueryExpr
+	// the hash fields to return, nil for all the fields
+	Fields     [][]byte
+	OrderField []byte
+	Desc       bool
+	// the max number of the rows returned, -1 if no limit
+	Limit int
+}
+
+// get the index which can be used by the query, the index not ready is ignored
+// since the results from it may be incomplete.
+func (db *RockDB) getSQLQueryIndex(table []byte, field []byte) *HsetIndex {
+	hindex, err := db.getQueryIndex(table, field, false)
+	if err != nil || hindex.IsComposite() || hindex.State != ReadyIndex {
+		return nil
+	}
+	return hindex
+}
+
+// plan the query using the indexes on the where fields, nil plans will be returned
+// if some terms can not be searched by the ready indexes.
+func (db *RockDB) planSQLIndexQuery(q *SQLQuery) ([]*indexScanPlan, error) {
+	plans, err := db.planIndexQuery(q.Table, q.Where, false)
+	if err == ErrIndexNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, plan := range plans {
+		if plan.hindex.State != ReadyIndex {
+			return nil, nil
+		}
+	}
+	return plans, nil
+}
+
+// scan all the hash keys of the table and call the fn for the keys matched by the where
+// expression until the fn returns false
+func (db *RockDB) sqlFullScan(q *SQLQuery, fn func(pk []byte) (bool, error)) error {
+	var terms [][]*IndexFieldCond
+	if q.Where != nil {
+		var err error
+		terms, err = indexQueryTerms(q.Where, false)
+		if err != nil {
+			return err
+		}
+	}
+	cursor := append([]byte{}, q.Table...)
+	cursor = append(cursor, common.NamespaceTableSeperator)
+	origPrefix := cursor
+	pkList := make([][]byte, 0, buildIndexBlock)
+	for len(cursor) > 0 {
+		var err error
+		pkList, err = db.ScanWithBuffer(common.HASH, cursor, buildIndexBlock, "", pkList[:0], false)
+		if err != nil {
+			return err
+		}
+		if len(pkList) < buildIndexBlock {
+			cursor = nil
+		}
+		for _, pk := range pkList {
+			if !bytes.HasPrefix(pk, origPrefix) {
+				cursor = nil
+				break
+			}
+			if cursor != nil {
+				cursor = pk
+			}
+			if terms != nil {
+				matched, err := db.matchIndexTerms(pk, terms, false)
+				if err != nil {
+					return err
+				}
+				if !matched {
+					continue
+				}
+			}
+			more, err := fn(pk)
+			if err != nil || !more {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (db *RockDB) getSQLRowValues(pk []byte, fields [][]byte) ([][]byte, error) {
+	if fields != nil {
+		return db.HMget(pk, fields...)
+	}
+	_, fvs, err := db.HGetAll(pk)
+	if err != nil {
+		return nil, err
+	}
+	vals := make([][]byte, 0, len(fvs)*2)
+	for _, fv := range fvs {
+		vals = append(vals, fv.Rec.Key, fv.Rec.Value)
+	}
+	return vals, nil
+}
+
+// HsetSQLQuery find the hash keys matched by the sql query in this partition and return the rows
+// with the selected fields. If the order field has a ready number index, the index is scanned in
+// order. Otherwise the keys are searched by the indexes on the where fields, or by scanning the
+// whole table if no index can be used, and the rows are sorted by the order field. The keys without
+// the order field are not returned for the ordered query.
+func (db *RockDB) HsetSQLQuery(q *SQLQuery) (SQLQueryPlan, []common.SQLRow, error) {
+	if q.OrderField != nil {
+		hindex := db.getSQLQueryIndex(q.Table, q.OrderField)
+		if hindex != nil && isNumberIndexType(hindex.ValueType) {
+			order := &IndexQueryOrder{Field: q.OrderField, Desc: q.Desc}
+			pkList, err := db.indexOrderedQuery(q.Table, q.Where, order, 0, q.Limit, false)
+			if err != nil {
+				return SQLPlanOrderedIndex, nil, err
+			}
+			rows := make([]common.SQLRow, 0, len(pkList))
+			for _, resp := range pkList {
+				vals, err := db.getSQLRowValues(resp.PKey, q.Fields)
+				if err != nil {
+					return SQLPlanOrderedIndex, nil, err
+				}
+				rows = append(rows, common.SQLRow{
+					PKey:       resp.PKey,
+					OrderValue: []byte(strconv.FormatInt(resp.IndexIntValue, 10)),
+					Values:     vals,
+				})
+			}
+			return SQLPlanOrderedIndex, rows, nil
+		}
+	}
+	// all the matched keys are needed to sort if ordered, but only the top rows are kept
+	// while scanning and the values are read after sorted
+	rows := make([]common.SQLRow, 0, 32)
+	collect := func(pk []byte) (bool, error) {
+		if q.OrderField == nil && q.Limit >= 0 && len(rows) >= q.Limit {
+			return false, nil
+		}
+		var ov []byte
+		if q.OrderField != nil {
+			var err error
+			ov, err = db.HGet(pk, q.OrderField)
+			if err != nil {
+				return false, err
+			}
+			if ov == nil {
+				return true, nil
+			}
+		}
+		rows = append(rows, common.SQLRow{PKey: pk, OrderValue: ov})
+		if q.OrderField != nil && q.Limit >= 0 && len(rows) >= 2*q.Limit+buildIndexBlock {
+			rows = common.MergeSQLRows([][]common.SQLRow{rows}, true, q.Desc, 0, q.Limit)
+		}
+		return true, nil
+	}
+	plan := SQLPlanFullScan
+	var err error
+	if q.Where != nil {
+		var plans []*indexScanPlan
+		plans, err = db.planSQLIndexQuery(q)
+		if err != nil {
+			return plan, nil, err
+		}
+		if plans != nil {
+			plan = SQLPlanIndex
+			limit := q.Limit
+			if q.OrderField != nil {
+				limit = -1
+			}
+			var rets []HIndexResp
+			rets, err = db.runIndexPlans(q.Table, plans, 0, limit, false)
+			if err != nil {
+				return plan, nil, err
+			}
+			for _, resp := range rets {
+				more, err := collect(resp.PKey)
+				if err != nil {
+					return plan, nil, err
+				}
+				if !more {
+					break
+				}
+			}
+		}
+	}
+	if plan == SQLPlanFullScan {
+		err = db.sqlFullScan(q, collect)
+		if err != nil {
+			return plan, nil, err
+		}
+	}
+	if q.OrderField != nil {
+		rows = common.MergeSQLRows([][]common.SQLRow{rows}, true, q.Desc, 0, q.Limit)
+	}
+	for i := range rows {
+		rows[i].Values, err = db.getSQLRowValues(rows[i].PKey, q.Fields)
+		if err != nil {
+			return plan, nil, err
+		}
+	}
+	return plan, rows, nil
+}
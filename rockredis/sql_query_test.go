@@ -0,0 +1,116 @@
+package rockredis
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func TestHashSQLQuery(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("int_field")
+	hindex.ValueType = Int64V
+	intIndex := hindex
+	err := db.indexMgr.AddHsetIndex(db, &intIndex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+
+	// the index in building should not be used
+	hindex.Name = []byte("index2")
+	hindex.IndexField = []byte("str_field")
+	hindex.ValueType = StringV
+	stringIndex := hindex
+	err = db.indexMgr.AddHsetIndex(db, &stringIndex)
+	assert.Nil(t, err)
+
+	strValues := []string{"abc1", "abc2", "bcd", "it's", "x y", "abd", "b", "c", "d", "e"}
+	for i := 0; i < 10; i++ {
+		key := []byte("test:key" + strconv.Itoa(i))
+		err = db.HMset(0, key, common.KVRecord{Key: intIndex.IndexField, Value: []byte(strconv.Itoa(i))},
+			common.KVRecord{Key: stringIndex.IndexField, Value: []byte(strValues[i])},
+			common.KVRecord{Key: []byte("noindex"), Value: []byte(strconv.Itoa(10 - i))})
+		assert.Nil(t, err)
+	}
+	// the key in the other table should not be returned
+	err = db.HMset(0, []byte("test2:key1"), common.KVRecord{Key: intIndex.IndexField, Value: []byte("1")})
+	assert.Nil(t, err)
+
+	query := func(sql string, expectedPlan SQLQueryPlan) ([]string, []common.SQLRow) {
+		s, err := common.ParseSQLSelect([]byte(sql))
+		assert.Nil(t, err, sql)
+		q := &SQLQuery{Table: []byte(s.Table), Fields: s.Fields, OrderField: s.OrderField, Desc: s.Desc,
+			Limit: s.Offset + s.Limit}
+		if s.Where != nil {
+			q.Where, err = ParseIndexQueryWhere(s.Where)
+			assert.Nil(t, err, sql)
+		}
+		plan, rows, err := db.HsetSQLQuery(q)
+		assert.Nil(t, err, sql)
+		assert.Equal(t, expectedPlan, plan, sql)
+		keys := make([]string, 0, len(rows))
+		for _, r := range rows {
+			keys = append(keys, string(r.PKey))
+		}
+		return keys, rows
+	}
+	keys, rows := query("select str_field, noindex from default.test where int_field > 7", SQLPlanIndex)
+	assert.Equal(t, []string{"test:key8", "test:key9"}, keys)
+	assert.Equal(t, [][]byte{[]byte("d"), []byte("2")}, rows[0].Values)
+
+	keys, rows = query("select * from default.test where str_field = 'e'", SQLPlanFullScan)
+	assert.Equal(t, []string{"test:key9"}, keys)
+	assert.Equal(t, 6, len(rows[0].Values))
+
+	keys, _ = query("select * from default.test where int_field < 3 or noindex = 1", SQLPlanFullScan)
+	assert.Equal(t, []string{"test:key0", "test:key1", "test:key2", "test:key9"}, keys)
+
+	keys, _ = query("select * from default.test limit 3", SQLPlanFullScan)
+	assert.Equal(t, 3, len(keys))
+
+	keys, rows = query("select noindex from default.test where noindex >= 5 order by int_field desc limit 2",
+		SQLPlanOrderedIndex)
+	assert.Equal(t, []string{"test:key5", "test:key4"}, keys)
+	assert.Equal(t, "5", string(rows[0].OrderValue))
+
+	keys, _ = query("select noindex from default.test order by int_field limit 3", SQLPlanOrderedIndex)
+	assert.Equal(t, []string{"test:key0", "test:key1", "test:key2"}, keys)
+
+	// sort by the number values of the field without index
+	keys, rows = query("select int_field from default.test where int_field >= 5 order by noindex limit 3",
+		SQLPlanIndex)
+	assert.Equal(t, []string{"test:key9", "test:key8", "test:key7"}, keys)
+	assert.Equal(t, "1", string(rows[0].OrderValue))
+
+	keys, _ = query("select int_field from default.test order by str_field desc limit 2", SQLPlanFullScan)
+	assert.Equal(t, []string{"test:key4", "test:key3"}, keys)
+
+	// the default limit is used if no limit
+	keys, _ = query("select * from default.test", SQLPlanFullScan)
+	assert.Equal(t, 10, len(keys))
+	keys, _ = query("select * from default.test limit 0", SQLPlanFullScan)
+	assert.Equal(t, 0, len(keys))
+
+	// only the top rows are kept while scanning for the order
+	oldBlock := buildIndexBlock
+	buildIndexBlock = 1
+	defer func() {
+		buildIndexBlock = oldBlock
+	}()
+	keys, rows = query("select noindex from default.test order by noindex limit 2", SQLPlanFullScan)
+	assert.Equal(t, []string{"test:key9", "test:key8"}, keys)
+	assert.Equal(t, [][]byte{[]byte("1")}, rows[0].Values)
+	keys, _ = query("select noindex from default.test where int_field >= 2 order by str_field limit 1, 2",
+		SQLPlanIndex)
+	// the offset is applied after merged across the partitions
+	assert.Equal(t, []string{"test:key5", "test:key6", "test:key2"}, keys)
+}
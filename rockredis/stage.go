@@ -0,0 +1,177 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// The large write proposal will be split into several staged chunks, and the chunks will be
+// committed atomically by a commit proposal after all of them are staged, so the large write
+// will not block the raft log with a single large entry.
+// stage meta: ExtandType|StageMetaExtType|meta:|stage id|key -> create time
+// stage data: ExtandType|StageDataExtType|tableLen|table|:|memcmp(rk, :, stage id, chunk index) -> chunk data
+// The stage will be deleted while committed, and the stale stage left by the failed proposal
+// will be deleted while any new stage is created.
+const stageExpireTime = 30 * time.Minute
+
+var (
+	errStageNotFound = errors.New("staged data not found")
+	errStageInvalid  = errors.New("staged data is not complete")
+)
+
+func encodeStageMetaKey(key []byte, stageID uint64) []byte {
+	buf := make([]byte, 8+len(key))
+	binary.BigEndian.PutUint64(buf, stageID)
+	copy(buf[8:], key)
+	return extEncodeMetaKey(StageMetaExtType, buf)
+}
+
+func decodeStageMetaKey(mk []byte) ([]byte, uint64, error) {
+	_, buf, err := extDecodeMetaKey(mk)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(buf) < 8 {
+		return nil, 0, errExtMetaKey
+	}
+	return buf[8:], binary.BigEndian.Uint64(buf), nil
+}
+
+func encodeStageDataRange(key []byte, stageID uint64) ([]byte, []byte, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	start, err := extEncodeDataKey(StageDataExtType, table, rk, int64(stageID), int64(0))
+	if err != nil {
+		return nil, nil, err
+	}
+	stop, err := extEncodeDataKey(StageDataExtType, table, rk, int64(stageID+1), int64(0))
+	return start, stop, err
+}
+
+// StageChunk save the chunk of the large write proposal to the stage, the chunk with index 0 will
+// create the stage, and the other chunks should be staged after the stage created.
+func (db *RockDB) StageChunk(ts int64, key []byte, stageID uint64, index int64, data []byte) error {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return err
+	}
+	if err := checkKeySize(rk); err != nil {
+		return err
+	}
+	mk := encodeStageMetaKey(key, stageID)
+	if index == 0 {
+		if err := db.delStaleStages(ts, db.wb); err != nil {
+			return err
+		}
+		db.wb.Put(mk, PutInt64(ts))
+	} else {
+		exist, err := db.ExistNoLock(mk)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return errStageNotFound
+		}
+	}
+	dk, err := extEncodeDataKey(StageDataExtType, table, rk, int64(stageID), index)
+	if err != nil {
+		return err
+	}
+	db.wb.Put(dk, data)
+	return db.CommitBatchWrite()
+}
+
+// LoadStaged read all the staged chunks and return the assembled data, the chunk number and
+// the total size should be matched.
+func (db *RockDB) LoadStaged(key []byte, stageID uint64, chunkNum int64, size int64) ([]byte, error) {
+	exist, err := db.ExistNoLock(encodeStageMetaKey(key, stageID))
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, errStageNotFound
+	}
+	start, stop, err := encodeStageDataRange(key, stageID)
+	if err != nil {
+		return nil, err
+	}
+	it, err := db.NewDBRangeIterator(start, stop, common.RangeROpen, false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	buf := make([]byte, 0, size)
+	index := int64(0)
+	for ; it.Valid(); it.Next() {
+		_, _, _, vals, err := extDecodeDataKey(it.RefKey())
+		if err != nil {
+			return nil, err
+		}
+		if len(vals) < 2 || vals[1] != index || int64(len(buf)+len(it.RefValue())) > size {
+			return nil, errStageInvalid
+		}
+		buf = append(buf, it.RefValue()...)
+		index++
+	}
+	if index != chunkNum || int64(len(buf)) != size {
+		return nil, errStageInvalid
+	}
+	return buf, nil
+}
+
+// DelStage delete the stage and commit
+func (db *RockDB) DelStage(key []byte, stageID uint64) error {
+	if err := db.delStage(key, stageID, db.wb); err != nil {
+		return err
+	}
+	return db.CommitBatchWrite()
+}
+
+// PrepareStageDelete delete the stage in the write batch without commit, so the stage can
+// be deleted atomically with the staged command committed.
+func (db *RockDB) PrepareStageDelete(key []byte, stageID uint64) error {
+	return db.delStage(key, stageID, db.wb)
+}
+
+func (db *RockDB) delStage(key []byte, stageID uint64, wb engine.WriteBatch) error {
+	start, stop, err := encodeStageDataRange(key, stageID)
+	if err != nil {
+		return err
+	}
+	wb.DeleteRange(start, stop)
+	wb.Delete(encodeStageMetaKey(key, stageID))
+	return nil
+}
+
+// delete the stages created before the expire time, the ts should be the time of the raft
+// proposal to make sure all the replicas delete the same stages.
+func (db *RockDB) delStaleStages(ts int64, wb engine.WriteBatch) error {
+	start := extEncodeMetaKey(StageMetaExtType, nil)
+	stop := extEncodeMetaKey(StageMetaExtType+1, nil)
+	it, err := db.NewDBRangeIterator(start, stop, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		createTs, err := Int64(it.RefValue(), nil)
+		if err != nil || createTs+stageExpireTime.Nanoseconds() > ts {
+			continue
+		}
+		key, stageID, err := decodeStageMetaKey(it.RefKey())
+		if err != nil {
+			continue
+		}
+		dbLog.Infof("delete stale stage %v for key %v created at %v", stageID, string(key), createTs)
+		if err := db.delStage(key, stageID, wb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
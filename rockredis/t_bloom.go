@@ -0,0 +1,455 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/spaolacci/murmur3"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// The scalable bloom filter is made of several sub filters, a new sub filter will be added
+// with larger capacity and tighter error rate if the last one is full.
+// Each sub filter is a blocked bloom filter which is split into chunks with fixed size,
+// all the bits for the same item are in the same chunk, so we need rewrite only one chunk
+// while adding an item to a huge filter.
+// key:version:filter index:chunk index -> chunk bits
+
+const (
+	bloomChunkBytes = 1024
+	bloomChunkBits  = bloomChunkBytes * 8
+	// the error rate for the next sub filter will be tighter by this ratio
+	bloomTighteningRatio = 0.5
+	maxBloomSubFilters   = 32
+	maxBloomCapacity     = 1 << 32
+	maxBloomHashes       = 64
+
+	DefaultBloomErrorRate = 0.01
+	DefaultBloomCapacity  = 100
+	DefaultBloomExpansion = 2
+)
+
+var (
+	ErrBloomExist         = errors.New("ERR item exists")
+	ErrBloomNotFound      = errors.New("ERR not found")
+	ErrBloomErrorRate     = errors.New("ERR (0 < error rate range < 1)")
+	ErrBloomCapacity      = errors.New("ERR (capacity should be larger than 0)")
+	ErrBloomExpansion     = errors.New("ERR expansion should be greater or equal to 1")
+	ErrBloomNonScaling    = errors.New("ERR non scaling filter is full")
+	ErrBloomTooManyFilter = errors.New("ERR the number of sub filters exceed the limit")
+	errBloomMeta          = errors.New("invalid bloom filter meta")
+)
+
+type bloomSubFilter struct {
+	Capacity int64
+	Count    int64
+	Hashes   int64
+	Chunks   int64
+}
+
+type bloomMeta struct {
+	ErrorRate  float64
+	Capacity   int64
+	Expansion  int64
+	NonScaling bool
+	Filters    []bloomSubFilter
+}
+
+// BloomInfo is the information returned by bf.info
+type BloomInfo struct {
+	Capacity  int64
+	Size      int64
+	Filters   int64
+	Items     int64
+	Expansion int64
+	ErrorRate float64
+}
+
+func (bm *bloomMeta) encode() []byte {
+	buf := make([]byte, 8*3+1+2+len(bm.Filters)*8*4)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(bm.ErrorRate))
+	binary.BigEndian.PutUint64(buf[8:], uint64(bm.Capacity))
+	binary.BigEndian.PutUint64(buf[16:], uint64(bm.Expansion))
+	if bm.NonScaling {
+		buf[24] = 1
+	}
+	binary.BigEndian.PutUint16(buf[25:], uint16(len(bm.Filters)))
+	pos := 27
+	for _, f := range bm.Filters {
+		binary.BigEndian.PutUint64(buf[pos:], uint64(f.Capacity))
+		binary.BigEndian.PutUint64(buf[pos+8:], uint64(f.Count))
+		binary.BigEndian.PutUint64(buf[pos+16:], uint64(f.Hashes))
+		binary.BigEndian.PutUint64(buf[pos+24:], uint64(f.Chunks))
+		pos += 32
+	}
+	return buf
+}
+
+func decodeBloomMeta(v []byte) (*bloomMeta, error) {
+	if len(v) < 27 {
+		return nil, errBloomMeta
+	}
+	var bm bloomMeta
+	bm.ErrorRate = math.Float64frombits(binary.BigEndian.Uint64(v))
+	bm.Capacity = int64(binary.BigEndian.Uint64(v[8:]))
+	bm.Expansion = int64(binary.BigEndian.Uint64(v[16:]))
+	bm.NonScaling = v[24] == 1
+	n := int(binary.BigEndian.Uint16(v[25:]))
+	if len(v) < 27+n*32 {
+		return nil, errBloomMeta
+	}
+	pos := 27
+	bm.Filters = make([]bloomSubFilter, n)
+	for i := 0; i < n; i++ {
+		bm.Filters[i].Capacity = int64(binary.BigEndian.Uint64(v[pos:]))
+		bm.Filters[i].Count = int64(binary.BigEndian.Uint64(v[pos+8:]))
+		bm.Filters[i].Hashes = int64(binary.BigEndian.Uint64(v[pos+16:]))
+		bm.Filters[i].Chunks = int64(binary.BigEndian.Uint64(v[pos+24:]))
+		pos += 32
+	}
+	return &bm, nil
+}
+
+func newBloomSubFilter(capacity int64, errorRate float64) bloomSubFilter {
+	ln2 := math.Ln2
+	bits := math.Ceil(-float64(capacity) * math.Log(errorRate) / (ln2 * ln2))
+	hashes := int64(math.Ceil(-math.Log(errorRate) / ln2))
+	if hashes < 1 {
+		hashes = 1
+	} else if hashes > maxBloomHashes {
+		hashes = maxBloomHashes
+	}
+	chunks := int64(math.Ceil(bits / bloomChunkBits))
+	if chunks < 1 {
+		chunks = 1
+	}
+	return bloomSubFilter{
+		Capacity: capacity,
+		Hashes:   hashes,
+		Chunks:   chunks,
+	}
+}
+
+// add a new sub filter to the meta with larger capacity and tighter error rate
+func (bm *bloomMeta) grow() error {
+	n := len(bm.Filters)
+	if n >= maxBloomSubFilters {
+		return ErrBloomTooManyFilter
+	}
+	capacity := bm.Capacity
+	errRate := bm.ErrorRate
+	if n > 0 {
+		last := bm.Filters[n-1]
+		capacity = last.Capacity * bm.Expansion
+		if capacity > maxBloomCapacity {
+			capacity = maxBloomCapacity
+		}
+		errRate = bm.ErrorRate * math.Pow(bloomTighteningRatio, float64(n))
+	}
+	bm.Filters = append(bm.Filters, newBloomSubFilter(capacity, errRate))
+	return nil
+}
+
+type bloomItemHash struct {
+	h1 uint64
+	h2 uint64
+}
+
+func hashBloomItem(item []byte) bloomItemHash {
+	h1, h2 := murmur3.Sum128(item)
+	return bloomItemHash{h1: h1, h2: h2}
+}
+
+func (f *bloomSubFilter) chunkIndex(h bloomItemHash) int64 {
+	return int64(h.h1 % uint64(f.Chunks))
+}
+
+// the bit positions in the chunk for the item
+func (f *bloomSubFilter) bitPos(h bloomItemHash, i int64) uint32 {
+	a := uint32(h.h2)
+	b := uint32(h.h2>>32) | 1
+	return (a + uint32(i)*b) % bloomChunkBits
+}
+
+func (f *bloomSubFilter) testBits(h bloomItemHash, chunk []byte) bool {
+	if len(chunk) < bloomChunkBytes {
+		return false
+	}
+	for i := int64(0); i < f.Hashes; i++ {
+		pos := f.bitPos(h, i)
+		if chunk[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomSubFilter) setBits(h bloomItemHash, chunk []byte) {
+	for i := int64(0); i < f.Hashes; i++ {
+		pos := f.bitPos(h, i)
+		chunk[pos/8] |= 1 << (pos % 8)
+	}
+}
+
+// the chunks modified in the same command will be cached until all the items are added
+type bloomChunkCache struct {
+	db     *RockDB
+	table  []byte
+	rk     []byte
+	ver    int64
+	chunks map[string][]byte
+	dirty  map[string]bool
+}
+
+func (db *RockDB) newBloomChunkCache(key []byte, ver int64) (*bloomChunkCache, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &bloomChunkCache{
+		db:     db,
+		table:  table,
+		rk:     rk,
+		ver:    ver,
+		chunks: make(map[string][]byte),
+		dirty:  make(map[string]bool),
+	}, nil
+}
+
+func (c *bloomChunkCache) get(dataType byte, filter int64, chunk int64, chunkSize int, useLock bool) ([]byte, []byte, error) {
+	ck, err := extEncodeDataKey(dataType, c.table, c.rk, c.ver, filter, chunk)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v, ok := c.chunks[string(ck)]; ok {
+		return ck, v, nil
+	}
+	var v []byte
+	if useLock {
+		v, err = c.db.GetBytes(ck)
+	} else {
+		v, err = c.db.GetBytesNoLock(ck)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(v) < chunkSize {
+		nv := make([]byte, chunkSize)
+		copy(nv, v)
+		v = nv
+	}
+	c.chunks[string(ck)] = v
+	return ck, v, nil
+}
+
+func (c *bloomChunkCache) markDirty(ck []byte) {
+	c.dirty[string(ck)] = true
+}
+
+func (c *bloomChunkCache) flush(wb engine.WriteBatch) {
+	for ck := range c.dirty {
+		wb.Put([]byte(ck), c.chunks[ck])
+	}
+}
+
+func (db *RockDB) getBloomMeta(ts int64, key []byte, useLock bool) (*extMeta, *bloomMeta, error) {
+	m, err := db.extGetMeta(ts, BloomMetaExtType, key, useLock)
+	if err != nil || m == nil {
+		return nil, nil, err
+	}
+	bm, err := decodeBloomMeta(m.Data)
+	return m, bm, err
+}
+
+func checkBloomParams(errorRate float64, capacity int64, expansion int64) error {
+	if errorRate <= 0 || errorRate >= 1 {
+		return ErrBloomErrorRate
+	}
+	if capacity <= 0 || capacity > maxBloomCapacity {
+		return ErrBloomCapacity
+	}
+	if expansion < 1 {
+		return ErrBloomExpansion
+	}
+	return nil
+}
+
+// BFReserve create an empty bloom filter with the error rate and initial capacity
+func (db *RockDB) BFReserve(ts int64, key []byte, errorRate float64, capacity int64, expansion int64, nonScaling bool) error {
+	if err := checkBloomParams(errorRate, capacity, expansion); err != nil {
+		return err
+	}
+	wb := db.wb
+	m, created, err := db.extGetMetaForWrite(ts, BloomMetaExtType, key, wb)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return ErrBloomExist
+	}
+	bm := &bloomMeta{
+		ErrorRate:  errorRate,
+		Capacity:   capacity,
+		Expansion:  expansion,
+		NonScaling: nonScaling,
+	}
+	if err := bm.grow(); err != nil {
+		return err
+	}
+	m.Data = bm.encode()
+	db.extSetMeta(BloomMetaExtType, key, m, wb)
+	return db.MaybeCommitBatch()
+}
+
+// BFAdd add the items to the bloom filter, the filter will be created with default params if not exist.
+// For each item, 1 will be returned if it is newly added, 0 if it may exist before.
+func (db *RockDB) BFAdd(ts int64, key []byte, items ...[]byte) ([]int64, error) {
+	if len(items) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	wb := db.wb
+	m, created, err := db.extGetMetaForWrite(ts, BloomMetaExtType, key, wb)
+	if err != nil {
+		return nil, err
+	}
+	var bm *bloomMeta
+	if created {
+		bm = &bloomMeta{
+			ErrorRate: DefaultBloomErrorRate,
+			Capacity:  DefaultBloomCapacity,
+			Expansion: DefaultBloomExpansion,
+		}
+		if err := bm.grow(); err != nil {
+			return nil, err
+		}
+	} else {
+		bm, err = decodeBloomMeta(m.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cache, err := db.newBloomChunkCache(key, m.Ver)
+	if err != nil {
+		return nil, err
+	}
+	rets := make([]int64, len(items))
+	for i, item := range items {
+		h := hashBloomItem(item)
+		exist := false
+		for fi := range bm.Filters {
+			f := &bm.Filters[fi]
+			_, chunk, err := cache.get(BloomDataExtType, int64(fi), f.chunkIndex(h), bloomChunkBytes, false)
+			if err != nil {
+				return nil, err
+			}
+			if f.testBits(h, chunk) {
+				exist = true
+				break
+			}
+		}
+		if exist {
+			continue
+		}
+		last := &bm.Filters[len(bm.Filters)-1]
+		if last.Count >= last.Capacity {
+			if bm.NonScaling {
+				return nil, ErrBloomNonScaling
+			}
+			if err := bm.grow(); err != nil {
+				return nil, err
+			}
+			last = &bm.Filters[len(bm.Filters)-1]
+		}
+		ck, chunk, err := cache.get(BloomDataExtType, int64(len(bm.Filters)-1), last.chunkIndex(h), bloomChunkBytes, false)
+		if err != nil {
+			return nil, err
+		}
+		last.setBits(h, chunk)
+		last.Count++
+		cache.markDirty(ck)
+		rets[i] = 1
+	}
+	cache.flush(wb)
+	m.Data = bm.encode()
+	db.extSetMeta(BloomMetaExtType, key, m, wb)
+	err = db.MaybeCommitBatch()
+	return rets, err
+}
+
+// BFExists check whether the items may exist in the bloom filter
+func (db *RockDB) BFExists(key []byte, items ...[]byte) ([]int64, error) {
+	if len(items) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	rets := make([]int64, len(items))
+	m, bm, err := db.getBloomMeta(time.Now().UnixNano(), key, true)
+	if err != nil || m == nil {
+		return rets, err
+	}
+	cache, err := db.newBloomChunkCache(key, m.Ver)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		h := hashBloomItem(item)
+		for fi := range bm.Filters {
+			f := &bm.Filters[fi]
+			_, chunk, err := cache.get(BloomDataExtType, int64(fi), f.chunkIndex(h), bloomChunkBytes, true)
+			if err != nil {
+				return nil, err
+			}
+			if f.testBits(h, chunk) {
+				rets[i] = 1
+				break
+			}
+		}
+	}
+	return rets, nil
+}
+
+// BFInfo return the information of the bloom filter
+func (db *RockDB) BFInfo(key []byte) (*BloomInfo, error) {
+	m, bm, err := db.getBloomMeta(time.Now().UnixNano(), key, true)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, ErrBloomNotFound
+	}
+	info := &BloomInfo{
+		Filters:   int64(len(bm.Filters)),
+		Expansion: bm.Expansion,
+		ErrorRate: bm.ErrorRate,
+	}
+	if bm.NonScaling {
+		info.Expansion = 0
+	}
+	for _, f := range bm.Filters {
+		info.Capacity += f.Capacity
+		info.Items += f.Count
+		info.Size += f.Chunks * bloomChunkBytes
+	}
+	return info, nil
+}
+
+func (db *RockDB) BFClear(ts int64, key []byte) (int64, error) {
+	return db.extDelete(ts, BloomMetaExtType, key)
+}
+
+func (db *RockDB) BFKeyExists(key []byte) (int64, error) {
+	return db.extKeyExists(BloomMetaExtType, key)
+}
+
+func (db *RockDB) BFExpire(ts int64, key []byte, ttlSec int64) (int64, error) {
+	return db.extExpire(ts, BloomMetaExtType, key, ttlSec)
+}
+
+func (db *RockDB) BFPersist(ts int64, key []byte) (int64, error) {
+	return db.extPersist(ts, BloomMetaExtType, key)
+}
+
+func (db *RockDB) BFTtl(key []byte) (int64, error) {
+	return db.extTTL(BloomMetaExtType, key)
+}
@@ -0,0 +1,128 @@
+package rockredis
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilter(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_bloom")
+	tn := time.Now().UnixNano()
+	err := db.BFReserve(tn, key, 0.01, 1000, 2, false)
+	assert.Nil(t, err)
+	err = db.BFReserve(tn, key, 0.01, 1000, 2, false)
+	assert.Equal(t, ErrBloomExist, err)
+	err = db.BFReserve(tn, []byte("test:testdb_bloom_invalid"), 1, 1000, 2, false)
+	assert.Equal(t, ErrBloomErrorRate, err)
+
+	n := 10000
+	for i := 0; i < n; i += 100 {
+		items := make([][]byte, 0, 100)
+		for j := i; j < i+100; j++ {
+			items = append(items, []byte(fmt.Sprintf("item-%d", j)))
+		}
+		_, err := db.BFAdd(tn, key, items...)
+		assert.Nil(t, err)
+	}
+	for i := 0; i < n; i++ {
+		rets, err := db.BFExists(key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), rets[0])
+	}
+	fp := 0
+	for i := 0; i < n; i++ {
+		rets, err := db.BFExists(key, []byte(fmt.Sprintf("other-%d", i)))
+		assert.Nil(t, err)
+		fp += int(rets[0])
+	}
+	assert.True(t, float64(fp)/float64(n) < 0.02, fp)
+
+	info, err := db.BFInfo(key)
+	assert.Nil(t, err)
+	assert.True(t, info.Filters > 1)
+	assert.True(t, info.Capacity > int64(n))
+	assert.True(t, info.Items <= int64(n) && info.Items > int64(n)*9/10)
+
+	rets, err := db.BFAdd(tn, key, []byte("item-1"), []byte("new-item"), []byte("new-item"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0, 1, 0}, rets)
+
+	_, err = db.BFInfo([]byte("test:testdb_bloom_not_exist"))
+	assert.Equal(t, ErrBloomNotFound, err)
+	rets, err = db.BFExists([]byte("test:testdb_bloom_not_exist"), []byte("item-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0}, rets)
+
+	cnt, err := db.BFClear(tn, key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	cnt, err = db.BFKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+}
+
+func TestBloomFilterNonScaling(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_bloom_nonscaling")
+	tn := time.Now().UnixNano()
+	err := db.BFReserve(tn, key, 0.01, 10, 2, true)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		_, err := db.BFAdd(tn, key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+	}
+	_, err = db.BFAdd(tn, key, []byte("item-full"))
+	assert.Equal(t, ErrBloomNonScaling, err)
+}
+
+func TestBloomFilterTTL(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_bloom_ttl")
+	tn := time.Now().UnixNano()
+	_, err := db.BFAdd(tn, key, []byte("item"))
+	assert.Nil(t, err)
+	cnt, err := db.BFExpire(tn, key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	ttl, err := db.BFTtl(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl >= 0 && ttl <= 1)
+
+	cnt, err = db.BFPersist(tn, key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	ttl, err = db.BFTtl(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+
+	_, err = db.BFExpire(tn, key, 1)
+	assert.Nil(t, err)
+	time.Sleep(time.Second * 2)
+	rets, err := db.BFExists(key, []byte("item"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0}, rets)
+	runTTLCheckerOnce(t, db)
+
+	_, err = db.BFInfo(key)
+	assert.Equal(t, ErrBloomNotFound, err)
+	table, rk, _ := extractTableFromRedisKey(key)
+	start, stop, _ := extEncodeDataRange(BloomDataExtType, table, rk)
+	it, err := db.NewDBRangeIterator(start, stop, 0, false)
+	assert.Nil(t, err)
+	defer it.Close()
+	assert.False(t, it.Valid())
+}
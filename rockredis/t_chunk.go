@@ -0,0 +1,574 @@
+package rockredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// The kv and json value larger than MaxValueSize will be split into chunks with fixed size,
+// and a chunk manifest will be stored as the value of the key instead:
+// KVType|key -> |value header| manifest | modify time|
+// JSONType|table|:|key -> | manifest | modify time|
+// manifest: |magic|version|value size|chunk size|
+// chunk key: ExtandType|chunkSubType|tableLen|table|:|memcmp(rk, :, version, chunk index) -> chunk data
+// The version is the time the chunked value is created and it will not be changed by the partial
+// write (setrange, append), so only the chunks involved need to be rewritten. The chunks of the
+// old version will be deleted while the value is overwritten or deleted.
+const (
+	valueChunkSize = 1024 * 1024
+	// the max size of the chunked value
+	MaxChunkedValueSize = 512 * 1024 * 1024
+	// retry read while the chunked value is overwritten during reading
+	chunkReadRetry = 3
+)
+
+// the magic begin with 0xff which can not be the begin of a valid json, and the kv value
+// equal to a manifest will be always stored as chunks to avoid misunderstanding.
+var chunkManifestMagic = []byte{0xff, 'Z', 'C', 'H', 'K'}
+
+var chunkManifestLen = len(chunkManifestMagic) + 8 + 8 + 8
+
+var errChunkNotFound = errors.New("chunk of the large value not found or changed")
+
+type chunkManifest struct {
+	Ver       int64
+	Size      int64
+	ChunkSize int64
+}
+
+func (m *chunkManifest) encode() []byte {
+	buf := make([]byte, chunkManifestLen)
+	pos := copy(buf, chunkManifestMagic)
+	binary.BigEndian.PutUint64(buf[pos:], uint64(m.Ver))
+	pos += 8
+	binary.BigEndian.PutUint64(buf[pos:], uint64(m.Size))
+	pos += 8
+	binary.BigEndian.PutUint64(buf[pos:], uint64(m.ChunkSize))
+	return buf
+}
+
+// decode the manifest from the user value, nil will be returned if the value is not chunked
+func decodeChunkManifest(v []byte) *chunkManifest {
+	if len(v) != chunkManifestLen || !bytes.HasPrefix(v, chunkManifestMagic) {
+		return nil
+	}
+	var m chunkManifest
+	pos := len(chunkManifestMagic)
+	m.Ver = int64(binary.BigEndian.Uint64(v[pos:]))
+	pos += 8
+	m.Size = int64(binary.BigEndian.Uint64(v[pos:]))
+	pos += 8
+	m.ChunkSize = int64(binary.BigEndian.Uint64(v[pos:]))
+	if m.ChunkSize <= 0 {
+		return nil
+	}
+	return &m
+}
+
+func (m *chunkManifest) chunkNum() int64 {
+	return (m.Size + m.ChunkSize - 1) / m.ChunkSize
+}
+
+// the data length of the chunk, only the last chunk can be less than the chunk size
+func (m *chunkManifest) chunkLen(idx int64) int64 {
+	left := m.Size - idx*m.ChunkSize
+	if left > m.ChunkSize {
+		return m.ChunkSize
+	}
+	return left
+}
+
+func needChunkValue(v []byte) bool {
+	return len(v) > MaxValueSize || bytes.HasPrefix(v, chunkManifestMagic) && len(v) == chunkManifestLen
+}
+
+func checkKVValueSize(value []byte) error {
+	if len(value) > MaxChunkedValueSize {
+		return errValueSize
+	}
+	return nil
+}
+
+// the real size of the user value
+func chunkedValueLen(v []byte) int64 {
+	if m := decodeChunkManifest(v); m != nil {
+		return m.Size
+	}
+	return int64(len(v))
+}
+
+// the chunks of the same version will not be overwritten by the new value, so the new version
+// should be larger than the old
+func newChunkVer(ts int64, old *chunkManifest) int64 {
+	if old != nil && old.Ver >= ts {
+		return old.Ver + 1
+	}
+	return ts
+}
+
+func encodeChunkKey(chunkType byte, table []byte, rk []byte, ver int64, idx int64) ([]byte, error) {
+	return extEncodeDataKey(chunkType, table, rk, ver, idx)
+}
+
+// the range of the chunks for the keys in [start, end) of the table
+func encodeChunkTableRange(chunkType byte, table []byte, start []byte, end []byte) (engine.CRange, error) {
+	var rg engine.CRange
+	var err error
+	prefix := extEncodeDataPrefix(chunkType, table)
+	rg.Start = prefix
+	if start != nil {
+		rg.Start, err = EncodeMemCmpKey(prefix, start)
+		if err != nil {
+			return rg, err
+		}
+	}
+	if end != nil {
+		prefix = extEncodeDataPrefix(chunkType, table)
+		rg.Limit, err = EncodeMemCmpKey(prefix, end)
+		return rg, err
+	}
+	rg.Limit = extEncodeDataPrefix(chunkType, table)
+	rg.Limit[len(rg.Limit)-1]++
+	return rg, nil
+}
+
+func (db *RockDB) putValueChunks(chunkType byte, table []byte, rk []byte, ver int64, value []byte, wb engine.WriteBatch) (*chunkManifest, error) {
+	m := &chunkManifest{Ver: ver, Size: int64(len(value)), ChunkSize: valueChunkSize}
+	for idx := int64(0); idx < m.chunkNum(); idx++ {
+		ck, err := encodeChunkKey(chunkType, table, rk, ver, idx)
+		if err != nil {
+			return nil, err
+		}
+		start := idx * m.ChunkSize
+		wb.Put(ck, value[start:start+m.chunkLen(idx)])
+	}
+	return m, nil
+}
+
+func (db *RockDB) delValueChunks(chunkType byte, table []byte, rk []byte, m *chunkManifest, wb engine.WriteBatch) error {
+	start, err := encodeChunkKey(chunkType, table, rk, m.Ver, 0)
+	if err != nil {
+		return err
+	}
+	stop, err := encodeChunkKey(chunkType, table, rk, m.Ver+1, 0)
+	if err != nil {
+		return err
+	}
+	wb.DeleteRange(start, stop)
+	return nil
+}
+
+// delete the chunks of the old value and write the chunks for the new large value, the
+// returned value (the manifest for the chunked value) should be stored as the new value.
+func (db *RockDB) replaceValueChunks(chunkType byte, ts int64, table []byte, rk []byte, old *chunkManifest,
+	value []byte, wb engine.WriteBatch) ([]byte, error) {
+	if old != nil {
+		if err := db.delValueChunks(chunkType, table, rk, old, wb); err != nil {
+			return nil, err
+		}
+	}
+	if !needChunkValue(value) {
+		return value, nil
+	}
+	m, err := db.putValueChunks(chunkType, table, rk, newChunkVer(ts, old), value, wb)
+	if err != nil {
+		return nil, err
+	}
+	return m.encode(), nil
+}
+
+// read the data in [start, end] of the chunked value from a snapshot, the op will be called for each
+// chunk in order and the data passed to op is only valid until op returns.
+// All the chunks in the snapshot will be checked against the manifest before calling op, and
+// errChunkNotFound will be returned without calling op if the chunks are changed by the writes
+// after the manifest is read, so the caller can read the new manifest and try again.
+func (db *RockDB) readValueChunks(chunkType byte, table []byte, rk []byte, m *chunkManifest, start int64, end int64,
+	op func([]byte) error) error {
+	if end >= m.Size {
+		end = m.Size - 1
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > end {
+		return nil
+	}
+	first := start / m.ChunkSize
+	last := end / m.ChunkSize
+	minKey, err := encodeChunkKey(chunkType, table, rk, m.Ver, first)
+	if err != nil {
+		return err
+	}
+	// include the next chunk to check whether the value is appended
+	maxKey, err := encodeChunkKey(chunkType, table, rk, m.Ver, last+1)
+	if err != nil {
+		return err
+	}
+	opts := engine.IteratorOpts{
+		WithSnap: true,
+	}
+	opts.Min = minKey
+	opts.Max = maxKey
+	opts.Type = common.RangeClose
+	it, err := db.NewDBRangeIteratorWithOpts(opts)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	idx := first
+	for ; it.Valid(); it.Next() {
+		if idx > last {
+			if last == m.chunkNum()-1 {
+				// the chunk after the last one means the manifest is changed
+				return errChunkNotFound
+			}
+			break
+		}
+		if int64(len(it.RefValue())) != m.chunkLen(idx) {
+			return errChunkNotFound
+		}
+		idx++
+	}
+	if idx != last+1 {
+		return errChunkNotFound
+	}
+	// all the chunks are matched with the manifest, read them from the same snapshot
+	it.Seek(minKey)
+	for idx = first; idx <= last && it.Valid(); it.Next() {
+		chunk := it.RefValue()
+		offset := idx * m.ChunkSize
+		lo := start - offset
+		if lo < 0 {
+			lo = 0
+		}
+		hi := end - offset + 1
+		if hi > int64(len(chunk)) {
+			hi = int64(len(chunk))
+		}
+		if err := op(chunk[lo:hi]); err != nil {
+			return err
+		}
+		idx++
+	}
+	if idx != last+1 {
+		return errInvalidDBValue
+	}
+	return nil
+}
+
+func (db *RockDB) readChunkedValue(chunkType byte, table []byte, rk []byte, m *chunkManifest, start int64, end int64) ([]byte, error) {
+	if end >= m.Size {
+		end = m.Size - 1
+	}
+	if start > end {
+		return nil, nil
+	}
+	v := make([]byte, 0, end-start+1)
+	err := db.readValueChunks(chunkType, table, rk, m, start, end, func(chunk []byte) error {
+		v = append(v, chunk...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// write the value at the offset of the chunked value, only the chunks involved will be rewritten.
+// The manifest should have the new size and the old data of the chunk is read by oldChunk, so the
+// inline value can also be converted to the chunks.
+func (db *RockDB) setValueChunkRange(chunkType byte, table []byte, rk []byte, m *chunkManifest, oldSize int64,
+	oldChunk func(idx int64) ([]byte, error), offset int64, value []byte, wb engine.WriteBatch) error {
+	if len(value) == 0 {
+		return nil
+	}
+	first := offset / m.ChunkSize
+	if oldSize < offset {
+		// the gap between the old end and the offset should be filled with zero
+		first = oldSize / m.ChunkSize
+	}
+	end := offset + int64(len(value))
+	last := (end - 1) / m.ChunkSize
+	for idx := first; idx <= last; idx++ {
+		chunkStart := idx * m.ChunkSize
+		buf := make([]byte, m.chunkLen(idx))
+		if chunkStart < oldSize {
+			old, err := oldChunk(idx)
+			if err != nil {
+				return err
+			}
+			copy(buf, old)
+		}
+		vs := offset
+		if vs < chunkStart {
+			vs = chunkStart
+		}
+		ve := end
+		if ve > chunkStart+int64(len(buf)) {
+			ve = chunkStart + int64(len(buf))
+		}
+		if vs < ve {
+			copy(buf[vs-chunkStart:], value[vs-offset:ve-offset])
+		}
+		ck, err := encodeChunkKey(chunkType, table, rk, m.Ver, idx)
+		if err != nil {
+			return err
+		}
+		wb.Put(ck, buf)
+	}
+	return nil
+}
+
+// get the chunk for write, should be used only in write operation
+func (db *RockDB) getValueChunkNoLock(chunkType byte, table []byte, rk []byte, m *chunkManifest, idx int64) ([]byte, error) {
+	ck, err := encodeChunkKey(chunkType, table, rk, m.Ver, idx)
+	if err != nil {
+		return nil, err
+	}
+	v, err := db.GetBytesNoLock(ck)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(v)) != m.chunkLen(idx) {
+		return nil, errChunkNotFound
+	}
+	return v, nil
+}
+
+// write the value at the offset of the old value (inline or chunked), the old value will be converted to
+// chunks if the new size is larger than MaxValueSize. The new user value (manifest or inline value)
+// and the new size will be returned.
+func (db *RockDB) setRangeMaybeChunked(chunkType byte, ts int64, table []byte, rk []byte, realV []byte,
+	offset int64, value []byte, wb engine.WriteBatch) ([]byte, int64, error) {
+	old := decodeChunkManifest(realV)
+	oldSize := int64(len(realV))
+	if old != nil {
+		oldSize = old.Size
+	}
+	newSize := offset + int64(len(value))
+	if newSize < oldSize {
+		newSize = oldSize
+	}
+	if newSize > MaxChunkedValueSize {
+		return nil, 0, errValueSize
+	}
+	if old == nil && newSize <= int64(MaxValueSize) {
+		if extra := newSize - int64(len(realV)); extra > 0 {
+			realV = append(realV, make([]byte, extra)...)
+		}
+		copy(realV[offset:], value)
+		if !needChunkValue(realV) {
+			return realV, newSize, nil
+		}
+		// the new inline value looks like a manifest, store it as chunks
+		m, err := db.putValueChunks(chunkType, table, rk, newChunkVer(ts, nil), realV, wb)
+		if err != nil {
+			return nil, 0, err
+		}
+		return m.encode(), newSize, nil
+	}
+	var m chunkManifest
+	var oldChunk func(idx int64) ([]byte, error)
+	if old != nil {
+		m = *old
+		oldChunk = func(idx int64) ([]byte, error) {
+			return db.getValueChunkNoLock(chunkType, table, rk, old, idx)
+		}
+	} else {
+		m = chunkManifest{Ver: newChunkVer(ts, nil), ChunkSize: valueChunkSize}
+		oldChunk = func(idx int64) ([]byte, error) {
+			start := idx * m.ChunkSize
+			end := start + m.ChunkSize
+			if end > int64(len(realV)) {
+				end = int64(len(realV))
+			}
+			return realV[start:end], nil
+		}
+	}
+	m.Size = newSize
+	err := db.setValueChunkRange(chunkType, table, rk, &m, oldSize, oldChunk, offset, value, wb)
+	if err != nil {
+		return nil, 0, err
+	}
+	return m.encode(), newSize, nil
+}
+
+// get the chunk manifest of the kv value stored in db, nil will be returned if the value is not chunked.
+// The bool returned is true if the key exists.
+func (db *RockDB) getKVChunkManifestNoLock(ek []byte) (*chunkManifest, bool, error) {
+	vref, err := db.rockEng.GetRefNoLock(ek)
+	if err != nil || vref == nil {
+		return nil, false, err
+	}
+	defer vref.Free()
+	v := vref.Data()
+	if v == nil {
+		return nil, false, nil
+	}
+	realV, _, err := db.decodeDBRawValueToRealValue(v)
+	if err != nil {
+		return nil, true, err
+	}
+	return decodeChunkManifest(realV), true, nil
+}
+
+// delete the old chunks and write the chunks for the large kv value, the returned value should
+// be stored as the real kv value.
+func (db *RockDB) replaceKVValueChunks(ts int64, rawKey []byte, old *chunkManifest, value []byte,
+	wb engine.WriteBatch) ([]byte, error) {
+	if old == nil && !needChunkValue(value) {
+		return value, nil
+	}
+	table, rk, err := extractTableFromRedisKey(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	return db.replaceValueChunks(KVChunkExtType, ts, table, rk, old, value, wb)
+}
+
+func (db *RockDB) delKVValueChunks(rawKey []byte, m *chunkManifest, wb engine.WriteBatch) error {
+	table, rk, err := extractTableFromRedisKey(rawKey)
+	if err != nil {
+		return err
+	}
+	return db.delValueChunks(KVChunkExtType, table, rk, m, wb)
+}
+
+// read the whole kv value if the real value is a chunk manifest, should be used only in write operation
+func (db *RockDB) resolveKVChunkedValueNoLock(rawKey []byte, realV []byte) ([]byte, error) {
+	m := decodeChunkManifest(realV)
+	if m == nil {
+		return realV, nil
+	}
+	table, rk, err := extractTableFromRedisKey(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	return db.readChunkedValue(KVChunkExtType, table, rk, m, 0, m.Size-1)
+}
+
+// compare the real kv value with the expected value, the chunked value will be read
+// only if the size is matched.
+func (db *RockDB) isKVValueEqualNoLock(rawKey []byte, realV []byte, expected []byte) (bool, error) {
+	m := decodeChunkManifest(realV)
+	if m == nil {
+		return bytes.Equal(realV, expected), nil
+	}
+	if m.Size != int64(len(expected)) {
+		return false, nil
+	}
+	v, err := db.resolveKVChunkedValueNoLock(rawKey, realV)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(v, expected), nil
+}
+
+// read the kv value and call the op for each chunk of the value in [start, end] (same as getrange), the op
+// will be called only once if the value is not chunked. The size passed to op is the total size of
+// the value and -1 means the key is not exist.
+func (db *RockDB) kvGetWithChunkOp(rawKey []byte, useLock bool, start int64, end int64,
+	op func(size int64, data []byte) error) error {
+	table, key, err := convertRedisKeyToDBKVKey(rawKey)
+	if err != nil {
+		return err
+	}
+	_, rk, err := extractTableFromRedisKey(rawKey)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		var m *chunkManifest
+		getOp := func(v []byte) error {
+			ts := time.Now().UnixNano()
+			expired, realV, err := db.getAndCheckExpRealValue(ts, rawKey, v, false)
+			if err != nil {
+				return err
+			}
+			if expired || realV == nil {
+				return op(-1, nil)
+			}
+			m = decodeChunkManifest(realV)
+			if m != nil {
+				// the chunks should be read after the value ref is released
+				return nil
+			}
+			size := int64(len(realV))
+			s, e := getRange(start, end, size)
+			if s > e {
+				return op(size, realV[:0])
+			}
+			return op(size, realV[s:e+1])
+		}
+		if useLock {
+			err = db.rockEng.GetValueWithOp(key, getOp)
+		} else {
+			err = db.rockEng.GetValueWithOpNoLock(key, getOp)
+		}
+		if err != nil || m == nil {
+			return err
+		}
+		s, e := getRange(start, end, m.Size)
+		if s > e {
+			return op(m.Size, nil)
+		}
+		err = db.readValueChunks(KVChunkExtType, table, rk, m, s, e, func(chunk []byte) error {
+			return op(m.Size, chunk)
+		})
+		if err == errChunkNotFound && i < chunkReadRetry {
+			// overwritten while reading, read the new value again
+			continue
+		}
+		return err
+	}
+}
+
+// get the chunk manifest of the json value stored in db, nil will be returned if the value is not chunked.
+func (db *RockDB) getJSONChunkManifestNoLock(ek []byte) (*chunkManifest, error) {
+	vref, err := db.rockEng.GetRefNoLock(ek)
+	if err != nil || vref == nil {
+		return nil, err
+	}
+	defer vref.Free()
+	v := vref.Data()
+	if len(v) < tsLen {
+		return nil, nil
+	}
+	return decodeChunkManifest(v[:len(v)-tsLen]), nil
+}
+
+// write the new json value with modify time, the old chunks will be deleted and the large value will be
+// stored as chunks.
+func (db *RockDB) putJSONValue(ts int64, table []byte, rk []byte, ek []byte, value []byte, wb engine.WriteBatch) error {
+	old, err := db.getJSONChunkManifestNoLock(ek)
+	if err != nil {
+		return err
+	}
+	value, err = db.replaceValueChunks(JSONChunkExtType, ts, table, rk, old, value, wb)
+	if err != nil {
+		return err
+	}
+	tsBuf := PutInt64(ts)
+	value = append(value, tsBuf...)
+	wb.Put(ek, value)
+	return nil
+}
+
+func (db *RockDB) delJSONValue(table []byte, rk []byte, ek []byte, wb engine.WriteBatch) error {
+	old, err := db.getJSONChunkManifestNoLock(ek)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		if err := db.delValueChunks(JSONChunkExtType, table, rk, old, wb); err != nil {
+			return err
+		}
+	}
+	wb.Delete(ek)
+	return nil
+}
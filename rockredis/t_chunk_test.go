@@ -0,0 +1,388 @@
+package rockredis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func genLargeValue(size int) []byte {
+	v := make([]byte, size)
+	for i := range v {
+		v[i] = byte('a' + i%26)
+	}
+	return v
+}
+
+func countChunks(t *testing.T, db *RockDB, chunkType byte, table string) int {
+	rg, err := encodeChunkTableRange(chunkType, []byte(table), nil, nil)
+	require.Nil(t, err)
+	it, err := db.NewDBRangeIterator(rg.Start, rg.Limit, common.RangeROpen, false)
+	require.Nil(t, err)
+	defer it.Close()
+	cnt := 0
+	for ; it.Valid(); it.Next() {
+		cnt++
+	}
+	return cnt
+}
+
+func TestChunkManifestCodec(t *testing.T) {
+	m := chunkManifest{Ver: 10, Size: int64(MaxValueSize) + 1, ChunkSize: valueChunkSize}
+	v := m.encode()
+	assert.True(t, needChunkValue(v))
+	dm := decodeChunkManifest(v)
+	require.NotNil(t, dm)
+	assert.Equal(t, m, *dm)
+	assert.Equal(t, int64(MaxValueSize/valueChunkSize+1), m.chunkNum())
+	assert.Equal(t, int64(1), m.chunkLen(m.chunkNum()-1))
+	assert.Equal(t, m.Size, chunkedValueLen(v))
+
+	assert.Nil(t, decodeChunkManifest([]byte("hello")))
+	assert.Nil(t, decodeChunkManifest(v[:len(v)-1]))
+	assert.False(t, needChunkValue([]byte("hello")))
+	assert.Equal(t, int64(5), chunkedValueLen([]byte("hello")))
+}
+
+func TestDBKVLargeValue(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_kv_large")
+	size := MaxValueSize + valueChunkSize/2
+	value := genLargeValue(size)
+	err := db.KVSet(0, key, value)
+	assert.Nil(t, err)
+	assert.Equal(t, size/valueChunkSize+1, countChunks(t, db, KVChunkExtType, "test"))
+
+	v, err := db.KVGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, value, v)
+	vals, errs := db.MGet(key)
+	assert.Nil(t, errs[0])
+	assert.Equal(t, value, vals[0])
+	n, err := db.StrLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(size), n)
+	n, err = db.KVExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// the range cross the chunks
+	start := int64(valueChunkSize - 10)
+	v, err = db.GetRange(key, start, start+19)
+	assert.Nil(t, err)
+	assert.Equal(t, value[start:start+20], v)
+	v, err = db.GetRange(key, -10, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, value[size-10:], v)
+
+	var streamed []byte
+	calls := 0
+	err = db.GetValueWithChunkOp(key, func(total int64, data []byte) error {
+		assert.Equal(t, int64(size), total)
+		streamed = append(streamed, data...)
+		calls++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, value, streamed)
+	assert.Equal(t, size/valueChunkSize+1, calls)
+
+	n, err = db.SetRange(0, key, int(start), []byte("hello world"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(size), n)
+	copy(value[start:], []byte("hello world"))
+	v, err = db.GetRange(key, start, start+10)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(v))
+
+	n, err = db.Append(0, key, []byte("tail"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(size+4), n)
+	value = append(value, []byte("tail")...)
+	v, err = db.KVGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, value, v)
+
+	changed, err := db.SetIfEQ(0, key, []byte("not equal"), []byte("new"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), changed)
+	changed, err = db.SetIfEQ(0, key, value, value[:size], 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), changed)
+
+	old, err := db.KVGetSet(0, key, []byte("small"))
+	assert.Nil(t, err)
+	assert.Equal(t, value[:size], old)
+	assert.Equal(t, 0, countChunks(t, db, KVChunkExtType, "test"))
+	v, err = db.KVGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "small", string(v))
+
+	// setrange on the small value to make it larger than MaxValueSize
+	n, err = db.SetRange(0, key, MaxValueSize, []byte("end"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(MaxValueSize+3), n)
+	v, err = db.GetRange(key, 0, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "small", string(v))
+	v, err = db.GetRange(key, 5, 9)
+	assert.Nil(t, err)
+	assert.Equal(t, make([]byte, 5), v)
+	v, err = db.GetRange(key, int64(MaxValueSize), -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "end", string(v))
+	assert.True(t, countChunks(t, db, KVChunkExtType, "test") > 0)
+
+	_, err = db.SetRange(0, key, MaxChunkedValueSize, []byte("a"))
+	assert.NotNil(t, err)
+
+	changed, err = db.DelIfEQ(0, key, []byte("small"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), changed)
+	n, err = db.DelKeys(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	v, err = db.KVGet(key)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	assert.Equal(t, 0, countChunks(t, db, KVChunkExtType, "test"))
+}
+
+func TestDBKVLargeValueChangedWhileReading(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_kv_large_changed")
+	value := genLargeValue(MaxValueSize + 10)
+	err := db.KVSet(0, key, value)
+	assert.Nil(t, err)
+	_, ek, err := convertRedisKeyToDBKVKey(key)
+	assert.Nil(t, err)
+	m, exist, err := db.getKVChunkManifestNoLock(ek)
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	require.NotNil(t, m)
+
+	_, err = db.Append(0, key, []byte("tail"))
+	assert.Nil(t, err)
+	m2 := *m
+	m2.Size = int64(MaxValueSize)
+	_, err = db.Append(0, key, genLargeValue(valueChunkSize))
+	assert.Nil(t, err)
+	// the old manifest read before the append should not match the chunks in snapshot,
+	// and no data should be passed to op
+	for _, old := range []*chunkManifest{m, &m2} {
+		called := false
+		err = db.readValueChunks(KVChunkExtType, []byte("test"), []byte("testdb_kv_large_changed"),
+			old, 0, old.Size-1, func([]byte) error {
+				called = true
+				return nil
+			})
+		assert.Equal(t, errChunkNotFound, err)
+		assert.False(t, called)
+	}
+	n, err := db.StrLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(value)+4+valueChunkSize), n)
+}
+
+func TestDBKVLargeValueOverwrite(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key1 := []byte("test:testdb_kv_large_a")
+	key2 := []byte("test:testdb_kv_large_b")
+	value := genLargeValue(MaxValueSize + 1)
+	for i := 0; i < 3; i++ {
+		err := db.MSet(time.Now().UnixNano(), common.KVRecord{Key: key1, Value: value},
+			common.KVRecord{Key: key2, Value: value})
+		assert.Nil(t, err)
+	}
+	// the chunks of the old versions should be removed
+	assert.Equal(t, 2*(MaxValueSize/valueChunkSize+1), countChunks(t, db, KVChunkExtType, "test"))
+	vals, errs := db.MGet(key1, key2)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.Equal(t, value, vals[0])
+	assert.Equal(t, value, vals[1])
+
+	n, err := db.DelKeys(key1, key2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, 0, countChunks(t, db, KVChunkExtType, "test"))
+}
+
+func TestDBKVManifestLikeValue(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_kv_manifest")
+	m := chunkManifest{Ver: 1, Size: 100, ChunkSize: valueChunkSize}
+	value := m.encode()
+	err := db.KVSet(0, key, value)
+	assert.Nil(t, err)
+	// the user value looks like a manifest should be stored as chunks
+	assert.Equal(t, 1, countChunks(t, db, KVChunkExtType, "test"))
+	v, err := db.KVGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, value, v)
+	n, err := db.StrLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(value)), n)
+	changed, err := db.DelIfEQ(0, key, value)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), changed)
+	assert.Equal(t, 0, countChunks(t, db, KVChunkExtType, "test"))
+}
+
+func TestDBJSONLargeValue(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_json_large")
+	large := genLargeValue(MaxValueSize)
+	n, err := db.JSet(0, key, []byte("a"), []byte(`"`+string(large)+`"`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.True(t, countChunks(t, db, JSONChunkExtType, "test") > 0)
+
+	n, err = db.JSet(0, key, []byte("b"), []byte(`"small"`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	vals, err := db.JGet(key, []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(vals))
+	assert.Equal(t, string(large), vals[0])
+	assert.Equal(t, "small", vals[1])
+
+	n, err = db.JDel(0, key, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, 0, countChunks(t, db, JSONChunkExtType, "test"))
+	vals, err = db.JGet(key, []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, "small", vals[0])
+
+	n, err = db.JSet(0, key, []byte("a"), []byte(`"`+string(large)+`"`))
+	assert.Nil(t, err)
+	n, err = db.JDel(0, key, []byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, 0, countChunks(t, db, JSONChunkExtType, "test"))
+}
+
+func TestDBStageChunks(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_stage")
+	data := genLargeValue(1000)
+	ts := time.Now().UnixNano()
+	err := db.StageChunk(ts, key, 2, 1, data[:10])
+	assert.Equal(t, errStageNotFound, err)
+	for i := 0; i < 10; i++ {
+		err = db.StageChunk(ts, key, 2, int64(i), data[i*100:(i+1)*100])
+		assert.Nil(t, err)
+	}
+	v, err := db.LoadStaged(key, 2, 10, int64(len(data)))
+	assert.Nil(t, err)
+	assert.Equal(t, data, v)
+	_, err = db.LoadStaged(key, 2, 11, int64(len(data)))
+	assert.Equal(t, errStageInvalid, err)
+	_, err = db.LoadStaged(key, 2, 10, int64(len(data)-1))
+	assert.Equal(t, errStageInvalid, err)
+	_, err = db.LoadStaged(key, 3, 10, int64(len(data)))
+	assert.Equal(t, errStageNotFound, err)
+
+	err = db.DelStage(key, 2)
+	assert.Nil(t, err)
+	_, err = db.LoadStaged(key, 2, 10, int64(len(data)))
+	assert.Equal(t, errStageNotFound, err)
+
+	// the stale stage should be deleted while new stage created
+	for i := 0; i < 3; i++ {
+		err = db.StageChunk(ts, key, 3, int64(i), data[:10])
+		assert.Nil(t, err)
+	}
+	err = db.StageChunk(ts+1, key, 4, 0, data[:10])
+	assert.Nil(t, err)
+	_, err = db.LoadStaged(key, 3, 3, 30)
+	assert.Nil(t, err)
+	err = db.StageChunk(ts+stageExpireTime.Nanoseconds()+1, key, 5, 0, data[:10])
+	assert.Nil(t, err)
+	_, err = db.LoadStaged(key, 3, 3, 30)
+	assert.Equal(t, errStageNotFound, err)
+	_, err = db.LoadStaged(key, 4, 1, 10)
+	assert.Equal(t, errStageNotFound, err)
+	v, err = db.LoadStaged(key, 5, 1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, data[:10], v)
+
+	// the stage deletion should be committed with the write batch
+	err = db.PrepareStageDelete(key, 5)
+	assert.Nil(t, err)
+	_, err = db.LoadStaged(key, 5, 1, 10)
+	assert.Nil(t, err)
+	err = db.KVSet(ts, []byte("test:testdb_stage_kv"), data)
+	assert.Nil(t, err)
+	_, err = db.LoadStaged(key, 5, 1, 10)
+	assert.Equal(t, errStageNotFound, err)
+}
+
+func TestDBJSONLargeValueIndexBuild(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := "test_json_large_index"
+	key := []byte(table + ":1")
+	large := genLargeValue(MaxValueSize)
+	doc := `{"name":"large doc","age":30,"data":"` + string(large) + `"}`
+	_, err := db.JSet(0, key, []byte(""), []byte(doc))
+	assert.Nil(t, err)
+	assert.True(t, countChunks(t, db, JSONChunkExtType, table) > 0)
+
+	// the chunked json written before the index added should be indexed while building
+	jindex := &common.JSONIndexSchema{Name: "age_index", Path: "age", ValueType: common.Int64V}
+	err = db.AddJSONIndex(table, jindex)
+	assert.Nil(t, err)
+	jindex.State = common.BuildingIndex
+	err = db.UpdateJSONIndexState(table, jindex)
+	assert.Nil(t, err)
+	waitJSONIndexBuildDone(t, db, table, jindex.Path)
+	expr, err := ParseIndexQueryWhere([]byte("age = 30"))
+	assert.Nil(t, err)
+	rets, err := db.JSONIndexQuery([]byte(table), expr, 0, -1)
+	assert.Nil(t, err)
+	require.Equal(t, 1, len(rets))
+	assert.Equal(t, key, rets[0].PKey)
+
+	ftindex := &common.FullTextIndexSchema{
+		Name:      "ft_large",
+		JSONPaths: []string{"name"},
+		State:     common.InitIndex,
+	}
+	err = db.AddFullTextIndex(table, ftindex)
+	assert.Nil(t, err)
+	ftindex.State = common.BuildingIndex
+	err = db.UpdateFullTextIndexState(table, ftindex)
+	assert.Nil(t, err)
+	waitFullTextIndexBuildDone(t, db, table, ftindex.Name)
+	total, frets, err := db.FullTextIndexSearch([]byte(table), []byte("large"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Equal(t, 1, len(frets))
+	assert.Equal(t, key, frets[0].PKey)
+}
@@ -0,0 +1,301 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// Count-Min Sketch is a matrix of counters with depth rows and width columns, each row
+// use a different hash function to map the item to the column.
+// The estimated count is the minimum value of the counters for the item in all rows.
+
+var (
+	ErrCMSExist         = errors.New("ERR CMS: key already exists")
+	ErrCMSNotFound      = errors.New("ERR CMS: key does not exist")
+	ErrCMSInvalidDim    = errors.New("ERR CMS: invalid width/depth")
+	ErrCMSInvalidProb   = errors.New("ERR CMS: invalid overestimation value or probability")
+	ErrCMSIncrement     = errors.New("ERR CMS: Cannot parse number")
+	ErrCMSOverflow      = errors.New("ERR CMS: INCRBY overflow")
+	ErrCMSWidthMismatch = errors.New("ERR CMS: width/depth is not equal")
+	errCMSArgs          = errors.New("ERR CMS: wrong number of arguments")
+	errCMSMeta          = errors.New("invalid cms meta")
+)
+
+type cmsMeta struct {
+	Width int64
+	Depth int64
+}
+
+func (cm *cmsMeta) encode() []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, uint64(cm.Width))
+	binary.BigEndian.PutUint64(buf[8:], uint64(cm.Depth))
+	return buf
+}
+
+func decodeCMSMeta(v []byte) (*cmsMeta, error) {
+	if len(v) < 16 {
+		return nil, errCMSMeta
+	}
+	var cm cmsMeta
+	cm.Width = int64(binary.BigEndian.Uint64(v))
+	cm.Depth = int64(binary.BigEndian.Uint64(v[8:]))
+	if cm.Width <= 0 || cm.Depth <= 0 {
+		return nil, errCMSMeta
+	}
+	return &cm, nil
+}
+
+func (cm *cmsMeta) cells() int64 {
+	return cm.Width * cm.Depth
+}
+
+// CMSInfo is the information returned by cms.info
+type CMSInfo struct {
+	Width int64
+	Depth int64
+	Count int64
+}
+
+// the total count is stored in the extra data
+func cmsTotalCount(item *sketchCacheItem) int64 {
+	if len(item.extra) < 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(item.extra))
+}
+
+func cmsSetTotalCount(item *sketchCacheItem, cnt int64) {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(cnt))
+	item.setExtra(buf)
+}
+
+func cmsQueryItem(item *sketchCacheItem, cm *cmsMeta, elem []byte) uint64 {
+	h1, h2 := sketchHashes(elem)
+	minV := uint64(math.MaxUint64)
+	for r := int64(0); r < cm.Depth; r++ {
+		v := item.cells[sketchRowIndex(h1, h2, r, cm.Width)]
+		if v < minV {
+			minV = v
+		}
+	}
+	return minV
+}
+
+func (db *RockDB) getCMSMeta(ts int64, key []byte, useLock bool) (*extMeta, *cmsMeta, error) {
+	m, err := db.extGetMeta(ts, CMSMetaExtType, key, useLock)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m == nil {
+		return nil, nil, ErrCMSNotFound
+	}
+	cm, err := decodeCMSMeta(m.Data)
+	return m, cm, err
+}
+
+// CMSInitByDim create the count-min sketch with the width and depth
+func (db *RockDB) CMSInitByDim(ts int64, key []byte, width int64, depth int64) error {
+	if width <= 0 || depth <= 0 || width > maxSketchCells || width*depth > maxSketchCells {
+		return ErrCMSInvalidDim
+	}
+	wb := db.wb
+	m, created, err := db.extGetMetaForWrite(ts, CMSMetaExtType, key, wb)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return ErrCMSExist
+	}
+	cm := &cmsMeta{Width: width, Depth: depth}
+	m.Data = cm.encode()
+	db.extSetMeta(CMSMetaExtType, key, m, wb)
+	return db.MaybeCommitBatch()
+}
+
+// CMSInitByProb create the count-min sketch with the error rate of the estimation
+// and the probability of the estimation exceed the error rate.
+func (db *RockDB) CMSInitByProb(ts int64, key []byte, errRate float64, prob float64) error {
+	if errRate <= 0 || errRate >= 1 || prob <= 0 || prob >= 1 {
+		return ErrCMSInvalidProb
+	}
+	width := int64(math.Ceil(2 / errRate))
+	depth := int64(math.Ceil(math.Log10(prob) / math.Log10(0.5)))
+	return db.CMSInitByDim(ts, key, width, depth)
+}
+
+// CMSIncrBy increase the count of the items, the estimated count of each item
+// after increased will be returned
+func (db *RockDB) CMSIncrBy(ts int64, key []byte, elems [][]byte, incrs []int64) ([]int64, error) {
+	if len(elems) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	if len(elems) != len(incrs) {
+		return nil, errCMSArgs
+	}
+	for _, incr := range incrs {
+		if incr < 0 {
+			return nil, ErrCMSIncrement
+		}
+	}
+	m, cm, err := db.getCMSMeta(ts, key, false)
+	if err != nil {
+		return nil, err
+	}
+	item, err := db.getSketchItemForWrite(CMSMetaExtType, key, m.Ver, cm.cells())
+	if err != nil {
+		return nil, err
+	}
+	rets := make([]int64, len(elems))
+	item.Lock()
+	// check overflow before changing any counter, since the cached sketch may be shared
+	changed := make(map[int64]uint64, len(elems)*int(cm.Depth))
+	total := cmsTotalCount(item)
+	for i, elem := range elems {
+		incr := uint64(incrs[i])
+		h1, h2 := sketchHashes(elem)
+		minV := uint64(math.MaxUint64)
+		for r := int64(0); r < cm.Depth; r++ {
+			idx := sketchRowIndex(h1, h2, r, cm.Width)
+			old, ok := changed[idx]
+			if !ok {
+				old = item.cells[idx]
+			}
+			v := old + incr
+			if v < old || v > math.MaxInt64 {
+				item.Unlock()
+				return nil, ErrCMSOverflow
+			}
+			changed[idx] = v
+			if v < minV {
+				minV = v
+			}
+		}
+		total += int64(incr)
+		rets[i] = int64(minV)
+	}
+	for idx, v := range changed {
+		item.setCell(idx, v)
+	}
+	cmsSetTotalCount(item, total)
+	item.Unlock()
+	db.addSketchDirtyWrite(CMSMetaExtType, key, item)
+	return rets, nil
+}
+
+// CMSQuery return the estimated count of the items
+func (db *RockDB) CMSQuery(key []byte, elems ...[]byte) ([]int64, error) {
+	if len(elems) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	m, cm, err := db.getCMSMeta(time.Now().UnixNano(), key, true)
+	if err != nil {
+		return nil, err
+	}
+	item, err := db.getSketchItemForRead(CMSMetaExtType, key, m.Ver, cm.cells())
+	if err != nil {
+		return nil, err
+	}
+	rets := make([]int64, len(elems))
+	item.Lock()
+	for i, elem := range elems {
+		rets[i] = int64(cmsQueryItem(item, cm, elem))
+	}
+	item.Unlock()
+	return rets, nil
+}
+
+// CMSMerge merge the source sketches into the destination with the weights, all the
+// sketches should have the same width and depth, and the destination should be created before.
+// The source keys should be in the same partition with the destination.
+func (db *RockDB) CMSMerge(ts int64, dest []byte, srcs [][]byte, weights []int64) error {
+	if len(srcs) == 0 || len(srcs) > MAX_BATCH_NUM {
+		return errCMSArgs
+	}
+	if len(weights) != len(srcs) {
+		return errCMSArgs
+	}
+	m, cm, err := db.getCMSMeta(ts, dest, false)
+	if err != nil {
+		return err
+	}
+	merged := make([]uint64, cm.cells())
+	var total int64
+	for i, src := range srcs {
+		if weights[i] < 0 {
+			return ErrCMSIncrement
+		}
+		sm, scm, err := db.getCMSMeta(ts, src, false)
+		if err != nil {
+			return err
+		}
+		if scm.Width != cm.Width || scm.Depth != cm.Depth {
+			return ErrCMSWidthMismatch
+		}
+		sitem, err := db.getSketchItemForWrite(CMSMetaExtType, src, sm.Ver, scm.cells())
+		if err != nil {
+			return err
+		}
+		w := uint64(weights[i])
+		sitem.Lock()
+		for j, v := range sitem.cells {
+			if w != 0 && v > (math.MaxInt64-merged[j])/w {
+				sitem.Unlock()
+				return ErrCMSOverflow
+			}
+			merged[j] += v * w
+		}
+		total += cmsTotalCount(sitem) * weights[i]
+		sitem.Unlock()
+	}
+	item, err := db.getSketchItemForWrite(CMSMetaExtType, dest, m.Ver, cm.cells())
+	if err != nil {
+		return err
+	}
+	item.Lock()
+	copy(item.cells, merged)
+	item.setAllDirty()
+	cmsSetTotalCount(item, total)
+	item.Unlock()
+	db.addSketchDirtyWrite(CMSMetaExtType, dest, item)
+	return nil
+}
+
+// CMSGetInfo return the width, depth and the total count of the sketch
+func (db *RockDB) CMSGetInfo(key []byte) (*CMSInfo, error) {
+	m, cm, err := db.getCMSMeta(time.Now().UnixNano(), key, true)
+	if err != nil {
+		return nil, err
+	}
+	item, err := db.getSketchItemForRead(CMSMetaExtType, key, m.Ver, cm.cells())
+	if err != nil {
+		return nil, err
+	}
+	item.Lock()
+	cnt := cmsTotalCount(item)
+	item.Unlock()
+	return &CMSInfo{Width: cm.Width, Depth: cm.Depth, Count: cnt}, nil
+}
+
+func (db *RockDB) CMSClear(ts int64, key []byte) (int64, error) {
+	return db.extDelete(ts, CMSMetaExtType, key)
+}
+
+func (db *RockDB) CMSKeyExists(key []byte) (int64, error) {
+	return db.extKeyExists(CMSMetaExtType, key)
+}
+
+func (db *RockDB) CMSExpire(ts int64, key []byte, ttlSec int64) (int64, error) {
+	return db.extExpire(ts, CMSMetaExtType, key, ttlSec)
+}
+
+func (db *RockDB) CMSPersist(ts int64, key []byte) (int64, error) {
+	return db.extPersist(ts, CMSMetaExtType, key)
+}
+
+func (db *RockDB) CMSTtl(key []byte) (int64, error) {
+	return db.extTTL(CMSMetaExtType, key)
+}
@@ -0,0 +1,200 @@
+package rockredis
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func TestCMSIncrAndQuery(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_cms")
+	tn := time.Now().UnixNano()
+	err := db.CMSInitByProb(tn, key, 0.001, 0.01)
+	assert.Nil(t, err)
+	err = db.CMSInitByDim(tn, key, 100, 5)
+	assert.Equal(t, ErrCMSExist, err)
+	err = db.CMSInitByDim(tn, []byte("test:testdb_cms_invalid"), 0, 5)
+	assert.Equal(t, ErrCMSInvalidDim, err)
+	_, err = db.CMSIncrBy(tn, []byte("test:testdb_cms_not_exist"), [][]byte{[]byte("a")}, []int64{1})
+	assert.Equal(t, ErrCMSNotFound, err)
+
+	for i := 0; i < 1000; i++ {
+		items := make([][]byte, 0, 10)
+		incrs := make([]int64, 0, 10)
+		for j := 0; j <= i%10; j++ {
+			items = append(items, []byte(fmt.Sprintf("item-%d", j)))
+			incrs = append(incrs, 1)
+		}
+		_, err := db.CMSIncrBy(tn, key, items, incrs)
+		assert.Nil(t, err)
+	}
+	rets, err := db.CMSIncrBy(tn, key, [][]byte{[]byte("item-0")}, []int64{10})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1010}, rets)
+	_, err = db.CMSIncrBy(tn, key, [][]byte{[]byte("item-0")}, []int64{-1})
+	assert.Equal(t, ErrCMSIncrement, err)
+
+	rets, err = db.CMSQuery(key, []byte("item-0"), []byte("item-9"), []byte("not_exist_item"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1010, 100, 0}, rets)
+	info, err := db.CMSGetInfo(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2000), info.Width)
+	assert.Equal(t, int64(7), info.Depth)
+	assert.Equal(t, int64(5510), info.Count)
+
+	// flush the cache and reload from db
+	db.sketchCache.Flush()
+	db.sketchCache, err = newSketchCache(SketchReadCacheSize, SketchWriteCacheSize, db)
+	assert.Nil(t, err)
+	rets, err = db.CMSQuery(key, []byte("item-0"), []byte("item-9"), []byte("not_exist_item"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1010, 100, 0}, rets)
+	info, err = db.CMSGetInfo(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5510), info.Count)
+
+	n, err := db.CMSClear(tn, key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = db.CMSQuery(key, []byte("item-0"))
+	assert.Equal(t, ErrCMSNotFound, err)
+	// the dirty cache should not be flushed after cleared
+	db.sketchCache.Flush()
+	err = db.CMSInitByDim(tn, key, 2000, 7)
+	assert.Nil(t, err)
+	rets, err = db.CMSQuery(key, []byte("item-0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0}, rets)
+}
+
+func TestCMSMerge(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key1 := []byte("test:testdb_cms_merge1")
+	key2 := []byte("test:testdb_cms_merge2")
+	dest := []byte("test:testdb_cms_merge_dest")
+	tn := time.Now().UnixNano()
+	for _, k := range [][]byte{key1, key2, dest} {
+		err := db.CMSInitByDim(tn, k, 100, 5)
+		assert.Nil(t, err)
+	}
+	err := db.CMSInitByDim(tn, []byte("test:testdb_cms_merge_other"), 10, 5)
+	assert.Nil(t, err)
+	_, err = db.CMSIncrBy(tn, key1, [][]byte{[]byte("a"), []byte("b")}, []int64{1, 2})
+	assert.Nil(t, err)
+	_, err = db.CMSIncrBy(tn, key2, [][]byte{[]byte("a"), []byte("c")}, []int64{3, 4})
+	assert.Nil(t, err)
+
+	err = db.CMSMerge(tn, dest, [][]byte{key1, key2}, []int64{1, 2})
+	assert.Nil(t, err)
+	rets, err := db.CMSQuery(dest, []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{7, 2, 8}, rets)
+	info, err := db.CMSGetInfo(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(17), info.Count)
+
+	err = db.CMSMerge(tn, dest, [][]byte{key1, []byte("test:testdb_cms_merge_other")}, []int64{1, 1})
+	assert.Equal(t, ErrCMSWidthMismatch, err)
+	err = db.CMSMerge(tn, dest, [][]byte{key1, []byte("test:testdb_cms_merge_not_exist")}, []int64{1, 1})
+	assert.Equal(t, ErrCMSNotFound, err)
+	// the dest should not be changed if failed
+	rets, err = db.CMSQuery(dest, []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{7, 2, 8}, rets)
+}
+
+func TestCMSExpire(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_cms_expire")
+	tn := time.Now().UnixNano()
+	err := db.CMSInitByDim(tn, key, 100, 5)
+	assert.Nil(t, err)
+	_, err = db.CMSIncrBy(tn, key, [][]byte{[]byte("a")}, []int64{1})
+	assert.Nil(t, err)
+	n, err := db.CMSExpire(tn, key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	time.Sleep(time.Second * 2)
+	_, err = db.CMSQuery(key, []byte("a"))
+	assert.Equal(t, ErrCMSNotFound, err)
+
+	// recreate after expired should not see the old data
+	err = db.CMSInitByDim(time.Now().UnixNano(), key, 100, 5)
+	assert.Nil(t, err)
+	rets, err := db.CMSQuery(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0}, rets)
+	ttl, err := db.CMSTtl(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), ttl)
+}
+
+func TestCMSExpireWithBatchApply(t *testing.T) {
+	db := getTestDBWithExpirationPolicy(t, common.LocalDeletion)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_cms_expire_batch")
+	key2 := []byte("test:testdb_cms_expire_batch2")
+	tn := time.Now().UnixNano()
+	for _, k := range [][]byte{key, key2} {
+		err := db.CMSInitByDim(tn, k, 100, 5)
+		assert.Nil(t, err)
+		_, err = db.CMSIncrBy(tn, k, [][]byte{[]byte("a")}, []int64{1})
+		assert.Nil(t, err)
+	}
+	n, err := db.CMSExpire(tn, key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	time.Sleep(time.Second * 2)
+
+	// the expired sketch deletion should wait the pending batch committed
+	err = db.BeginBatchWrite()
+	assert.Nil(t, err)
+	_, err = db.CMSIncrBy(tn+1, key2, [][]byte{[]byte("a")}, []int64{1})
+	assert.Nil(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runTTLCheckerOnce(t, db)
+	}()
+	select {
+	case <-done:
+		t.Fatal("the expired sketch deleted while the batch is not committed")
+	case <-time.After(time.Millisecond * 100):
+	}
+	err = db.CommitBatchWrite()
+	assert.Nil(t, err)
+	<-done
+	db.LockApply()
+	db.sketchCache.Flush()
+	db.UnlockApply()
+
+	_, err = db.CMSQuery(key, []byte("a"))
+	assert.Equal(t, ErrCMSNotFound, err)
+	// the dirty sketch cache should not write back the deleted data
+	start, stop, err := extEncodeDataRange(CMSMetaExtType+1, []byte("test"), key[len("test:"):])
+	assert.Nil(t, err)
+	it, err := db.NewDBRangeIterator(start, stop, common.RangeROpen, false)
+	assert.Nil(t, err)
+	assert.False(t, it.Valid())
+	it.Close()
+	rets, err := db.CMSQuery(key2, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2}, rets)
+}
@@ -0,0 +1,809 @@
+package rockredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// The columnar table stores the declared hash fields column-wise per row group,
+// the hash data is still stored as usual for the hash commands.
+// table meta: ColumnType|colTableMetaSub|table|:|name|: -> current row group id
+// row: ColumnType|colRowSub|table|:|name|:|pk -> row group id|row
+// row group: ColumnType|colGroupSub|table|:|name|:|row group id -> row number|live rows bitmap
+// column: ColumnType|colDataSub|table|:|name|:|column len|column|row group id -> column chunk
+// The new row is always appended to the current row group, and the row group will
+// be removed after all the rows in it are deleted.
+
+const (
+	colTableMetaSub byte = 1
+	colRowSub       byte = 2
+	colGroupSub     byte = 3
+	colDataSub      byte = 4
+	colKeySep       byte = ':'
+)
+
+var (
+	errColumnKey          = errors.New("invalid column table key")
+	ErrColumnNotDeclared  = errors.New("the field is not declared in the columnar table")
+	ErrColumnAggSumNonNum = errors.New("the aggregation function need a field")
+)
+
+type ColumnAggFunc int
+
+const (
+	ColumnAggCount ColumnAggFunc = iota
+	ColumnAggSum
+	ColumnAggMin
+	ColumnAggMax
+	ColumnAggAvg
+)
+
+// the field is nil for count(*)
+type ColumnAggregation struct {
+	Func  ColumnAggFunc
+	Field []byte
+}
+
+type ColumnCondOp int
+
+const (
+	ColumnCondEQ ColumnCondOp = iota
+	ColumnCondNE
+	ColumnCondGT
+	ColumnCondGE
+	ColumnCondLT
+	ColumnCondLE
+)
+
+// the value is compared as number if both the value in condition and the column
+// value are numbers, otherwise they are compared as bytes. The null value never matches.
+type ColumnCondition struct {
+	Field []byte
+	Op    ColumnCondOp
+	Value []byte
+}
+
+// ColumnAggValue is the partial aggregation result which can be merged across
+// the partitions. For count the Count is the number of the matched rows or non-null
+// values, and for others the Count is the number of the numeric values.
+type ColumnAggValue struct {
+	Count int64
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+func (v *ColumnAggValue) addNum(n float64) {
+	if v.Count == 0 || n < v.Min {
+		v.Min = n
+	}
+	if v.Count == 0 || n > v.Max {
+		v.Max = n
+	}
+	v.Count++
+	v.Sum += n
+}
+
+func (v *ColumnAggValue) Merge(o ColumnAggValue) {
+	if o.Count == 0 {
+		return
+	}
+	if v.Count == 0 || o.Min < v.Min {
+		v.Min = o.Min
+	}
+	if v.Count == 0 || o.Max > v.Max {
+		v.Max = o.Max
+	}
+	v.Count += o.Count
+	v.Sum += o.Sum
+}
+
+// Result return the final result of the aggregation function, false will be returned
+// if there is no value for min, max and avg.
+func (v *ColumnAggValue) Result(fn ColumnAggFunc) (float64, bool) {
+	switch fn {
+	case ColumnAggCount:
+		return float64(v.Count), true
+	case ColumnAggSum:
+		return v.Sum, true
+	}
+	if v.Count == 0 {
+		return 0, false
+	}
+	switch fn {
+	case ColumnAggMin:
+		return v.Min, true
+	case ColumnAggMax:
+		return v.Max, true
+	case ColumnAggAvg:
+		return v.Sum / float64(v.Count), true
+	}
+	return 0, false
+}
+
+// the key is nil for the rows which has null value for the group field,
+// and it is also nil if there is no group by.
+type ColumnAggGroup struct {
+	Key    []byte
+	Values []ColumnAggValue
+}
+
+// the null group is the first
+func SortColumnAggGroups(groups []ColumnAggGroup) {
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Key == nil || groups[j].Key == nil {
+			return groups[i].Key == nil && groups[j].Key != nil
+		}
+		return bytes.Compare(groups[i].Key, groups[j].Key) < 0
+	})
+}
+
+func encodeColumnTablePrefix(subType byte, table []byte, name []byte) []byte {
+	tmpkey := make([]byte, 2+2+len(table)+1+2+len(name)+1)
+	pos := 0
+	tmpkey[pos] = ColumnType
+	pos++
+	tmpkey[pos] = subType
+	pos++
+	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
+	pos += 2
+	copy(tmpkey[pos:], table)
+	pos += len(table)
+	tmpkey[pos] = colKeySep
+	pos++
+	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(name)))
+	pos += 2
+	copy(tmpkey[pos:], name)
+	pos += len(name)
+	tmpkey[pos] = colKeySep
+	return tmpkey
+}
+
+func encodeColumnTableStopKey(subType byte, table []byte, name []byte) []byte {
+	k := encodeColumnTablePrefix(subType, table, name)
+	k[len(k)-1] = k[len(k)-1] + 1
+	return k
+}
+
+func encodeColumnRowKey(table []byte, name []byte, pk []byte) []byte {
+	return append(encodeColumnTablePrefix(colRowSub, table, name), pk...)
+}
+
+func encodeColumnGroupKey(table []byte, name []byte, gid uint64) []byte {
+	k := encodeColumnTablePrefix(colGroupSub, table, name)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], gid)
+	return append(k, buf[:]...)
+}
+
+func decodeColumnGroupKey(prefixLen int, k []byte) (uint64, error) {
+	if len(k) != prefixLen+8 || k[0] != ColumnType || k[1] != colGroupSub {
+		return 0, errColumnKey
+	}
+	return binary.BigEndian.Uint64(k[prefixLen:]), nil
+}
+
+func encodeColumnDataKey(table []byte, name []byte, column []byte, gid uint64) []byte {
+	k := encodeColumnTablePrefix(colDataSub, table, name)
+	var buf [8]byte
+	binary.BigEndian.PutUint16(buf[:], uint16(len(column)))
+	k = append(k, buf[:2]...)
+	k = append(k, column...)
+	binary.BigEndian.PutUint64(buf[:], gid)
+	return append(k, buf[:]...)
+}
+
+func encodeColumnRowValue(gid uint64, row int) []byte {
+	buf := make([]byte, binary.MaxVarintLen64*2)
+	pos := binary.PutUvarint(buf, gid)
+	pos += binary.PutUvarint(buf[pos:], uint64(row))
+	return buf[:pos]
+}
+
+func decodeColumnRowValue(v []byte) (uint64, int, error) {
+	gid, n := binary.Uvarint(v)
+	if n <= 0 {
+		return 0, 0, errColumnChunkData
+	}
+	row, n2 := binary.Uvarint(v[n:])
+	if n2 <= 0 || row >= columnRowGroupSize {
+		return 0, 0, errColumnChunkData
+	}
+	return gid, int(row), nil
+}
+
+type ColumnTable struct {
+	Table []byte
+	ColumnTableInfo
+	// the row group data may be changed by several writes in the same write batch,
+	// so the changed data not committed should be read from here.
+	pendingMu sync.Mutex
+	pending   map[string][]byte
+}
+
+func (self *ColumnTable) columnIndex(field []byte) int {
+	for i, c := range self.Columns {
+		if bytes.Equal(c, field) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (self *ColumnTable) hasColumn(fields [][]byte) bool {
+	for _, f := range fields {
+		if self.columnIndex(f) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *ColumnTable) getData(db *RockDB, key []byte) ([]byte, error) {
+	self.pendingMu.Lock()
+	v, ok := self.pending[string(key)]
+	self.pendingMu.Unlock()
+	if ok {
+		return v, nil
+	}
+	return db.GetBytesNoLock(key)
+}
+
+func (self *ColumnTable) putData(db *RockDB, key []byte, value []byte, wb engine.WriteBatch) {
+	self.pendingMu.Lock()
+	if self.pending == nil {
+		self.pending = make(map[string][]byte)
+	}
+	self.pending[string(key)] = value
+	self.pendingMu.Unlock()
+	db.indexMgr.addPendingColumnTable(self)
+	wb.Put(key, value)
+}
+
+func (self *ColumnTable) deleteData(db *RockDB, key []byte, wb engine.WriteBatch) {
+	self.pendingMu.Lock()
+	if self.pending == nil {
+		self.pending = make(map[string][]byte)
+	}
+	self.pending[string(key)] = nil
+	self.pendingMu.Unlock()
+	db.indexMgr.addPendingColumnTable(self)
+	wb.Delete(key)
+}
+
+// write all the pending data to the write batch, so the latest data will be committed
+// even the data is changed by other write batch after it was put into this write batch.
+func (self *ColumnTable) flushPending(wb engine.WriteBatch) {
+	self.pendingMu.Lock()
+	defer self.pendingMu.Unlock()
+	for k, v := range self.pending {
+		if v == nil {
+			wb.Delete([]byte(k))
+		} else {
+			wb.Put([]byte(k), v)
+		}
+	}
+}
+
+func (self *ColumnTable) hasPending() bool {
+	self.pendingMu.Lock()
+	defer self.pendingMu.Unlock()
+	return len(self.pending) > 0
+}
+
+func (self *ColumnTable) resetPending() {
+	self.pendingMu.Lock()
+	self.pending = nil
+	self.pendingMu.Unlock()
+}
+
+// commit the write batch which is not the batched db write batch, should be called in lock
+func (self *ColumnTable) commitSeparated(db *RockDB, wb engine.WriteBatch) error {
+	self.flushPending(wb)
+	err := db.rockEng.Write(wb)
+	if err != nil {
+		return err
+	}
+	// the pending data should be kept until the batched write is committed
+	if atomic.LoadInt32(&db.isBatching) == 0 {
+		self.resetPending()
+	}
+	return nil
+}
+
+func (self *ColumnTable) getCurrentGroup(db *RockDB) (uint64, error) {
+	v, err := self.getData(db, encodeColumnTablePrefix(colTableMetaSub, self.Table, self.Name))
+	if err != nil || v == nil {
+		return 0, err
+	}
+	gid, n := binary.Uvarint(v)
+	if n <= 0 {
+		return 0, errColumnChunkData
+	}
+	return gid, nil
+}
+
+func (self *ColumnTable) getGroup(db *RockDB, gid uint64) (*columnRowGroup, error) {
+	v, err := self.getData(db, encodeColumnGroupKey(self.Table, self.Name, gid))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return &columnRowGroup{}, nil
+	}
+	return decodeColumnRowGroup(v)
+}
+
+func (self *ColumnTable) getChunk(db *RockDB, column []byte, gid uint64) (*columnChunk, error) {
+	v, err := self.getData(db, encodeColumnDataKey(self.Table, self.Name, column, gid))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return &columnChunk{}, nil
+	}
+	return decodeColumnChunk(v)
+}
+
+func (self *ColumnTable) allocRow(db *RockDB, pk []byte, wb engine.WriteBatch) (uint64, int, error) {
+	gid, err := self.getCurrentGroup(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	group, err := self.getGroup(db, gid)
+	if err != nil {
+		return 0, 0, err
+	}
+	if group.rowNum >= columnRowGroupSize {
+		gid++
+		group = &columnRowGroup{}
+		var buf [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(buf[:], gid)
+		self.putData(db, encodeColumnTablePrefix(colTableMetaSub, self.Table, self.Name), buf[:n], wb)
+	}
+	row := group.rowNum
+	group.rowNum++
+	group.setLive(row, true)
+	self.putData(db, encodeColumnGroupKey(self.Table, self.Name, gid), group.encode(), wb)
+	self.putData(db, encodeColumnRowKey(self.Table, self.Name, pk), encodeColumnRowValue(gid, row), wb)
+	return gid, row, nil
+}
+
+// UpdateRow update the values of all the columns for the row, the nil value means null,
+// and the row will be removed if all the values are null.
+func (self *ColumnTable) UpdateRow(db *RockDB, pk []byte, values [][]byte, wb engine.WriteBatch) error {
+	if self.State == DeletedIndex {
+		return nil
+	}
+	allNull := true
+	for _, v := range values {
+		if v != nil {
+			allNull = false
+			break
+		}
+	}
+	if allNull {
+		return self.RemoveRow(db, pk, wb)
+	}
+	v, err := self.getData(db, encodeColumnRowKey(self.Table, self.Name, pk))
+	if err != nil {
+		return err
+	}
+	var gid uint64
+	var row int
+	if v == nil {
+		gid, row, err = self.allocRow(db, pk, wb)
+	} else {
+		gid, row, err = decodeColumnRowValue(v)
+	}
+	if err != nil {
+		return err
+	}
+	for i, column := range self.Columns {
+		chunk, err := self.getChunk(db, column, gid)
+		if err != nil {
+			return err
+		}
+		old := chunk.get(row)
+		if (old == nil) == (values[i] == nil) && bytes.Equal(old, values[i]) {
+			continue
+		}
+		chunk.set(row, values[i])
+		dk := encodeColumnDataKey(self.Table, self.Name, column, gid)
+		if chunk.isAllNull() {
+			self.deleteData(db, dk, wb)
+		} else {
+			self.putData(db, dk, chunk.encode(), wb)
+		}
+	}
+	return nil
+}
+
+func (self *ColumnTable) RemoveRow(db *RockDB, pk []byte, wb engine.WriteBatch) error {
+	if self.State == DeletedIndex {
+		return nil
+	}
+	rk := encodeColumnRowKey(self.Table, self.Name, pk)
+	v, err := self.getData(db, rk)
+	if err != nil || v == nil {
+		return err
+	}
+	gid, row, err := decodeColumnRowValue(v)
+	if err != nil {
+		return err
+	}
+	for _, column := range self.Columns {
+		chunk, err := self.getChunk(db, column, gid)
+		if err != nil {
+			return err
+		}
+		if chunk.get(row) == nil {
+			continue
+		}
+		chunk.set(row, nil)
+		dk := encodeColumnDataKey(self.Table, self.Name, column, gid)
+		if chunk.isAllNull() {
+			self.deleteData(db, dk, wb)
+		} else {
+			self.putData(db, dk, chunk.encode(), wb)
+		}
+	}
+	self.deleteData(db, rk, wb)
+
+	group, err := self.getGroup(db, gid)
+	if err != nil {
+		return err
+	}
+	group.setLive(row, false)
+	curGid, err := self.getCurrentGroup(db)
+	if err != nil {
+		return err
+	}
+	gk := encodeColumnGroupKey(self.Table, self.Name, gid)
+	if gid != curGid && group.liveNum() == 0 {
+		// no row will be added to the old row group
+		self.deleteData(db, gk, wb)
+	} else {
+		self.putData(db, gk, group.encode(), wb)
+	}
+	return nil
+}
+
+func (self *ColumnTable) cleanAll(db *RockDB, stopChan chan struct{}) error {
+	dbLog.Infof("begin clean column table: %v-%v", string(self.Table), string(self.Name))
+
+	wb := db.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	for _, subType := range []byte{colTableMetaSub, colRowSub, colGroupSub, colDataSub} {
+		min := encodeColumnTablePrefix(subType, self.Table, self.Name)
+		max := encodeColumnTableStopKey(subType, self.Table, self.Name)
+		wb.DeleteRange(min, max)
+	}
+	// the table meta key is the same as the prefix
+	wb.Delete(encodeColumnTablePrefix(colTableMetaSub, self.Table, self.Name))
+
+	err := db.rockEng.Write(wb)
+	if err != nil {
+		dbLog.Infof("clean column table %v, %v error: %v", string(self.Table), string(self.Name), err)
+	} else {
+		dbLog.Infof("clean column table: %v-%v done", string(self.Table), string(self.Name))
+	}
+	self.resetPending()
+	return err
+}
+
+type columnCondMatcher struct {
+	column   int
+	cond     ColumnCondition
+	condNum  float64
+	isNumber bool
+}
+
+func (m *columnCondMatcher) match(v []byte) bool {
+	if v == nil {
+		return false
+	}
+	var c int
+	if n, err := strconv.ParseFloat(string(v), 64); m.isNumber && err == nil {
+		if n < m.condNum {
+			c = -1
+		} else if n > m.condNum {
+			c = 1
+		}
+	} else {
+		c = bytes.Compare(v, m.cond.Value)
+	}
+	switch m.cond.Op {
+	case ColumnCondEQ:
+		return c == 0
+	case ColumnCondNE:
+		return c != 0
+	case ColumnCondGT:
+		return c > 0
+	case ColumnCondGE:
+		return c >= 0
+	case ColumnCondLT:
+		return c < 0
+	case ColumnCondLE:
+		return c <= 0
+	}
+	return false
+}
+
+type columnNum struct {
+	v  float64
+	ok bool
+}
+
+// the condition and the number parsing are evaluated only once for each value in the dictionary
+func columnDictMatches(chunk *columnChunk, m *columnCondMatcher) []bool {
+	rets := make([]bool, len(chunk.dict)+1)
+	for i, v := range chunk.dict {
+		rets[i+1] = m.match(v)
+	}
+	return rets
+}
+
+func columnDictNums(chunk *columnChunk) []columnNum {
+	rets := make([]columnNum, len(chunk.dict)+1)
+	for i, v := range chunk.dict {
+		n, err := strconv.ParseFloat(string(v), 64)
+		rets[i+1] = columnNum{v: n, ok: err == nil}
+	}
+	return rets
+}
+
+func (self *ColumnTable) aggregate(db *RockDB, aggs []ColumnAggregation, conds []ColumnCondition,
+	groupBy []byte) ([]ColumnAggGroup, error) {
+	matchers := make([]*columnCondMatcher, 0, len(conds))
+	for _, cond := range conds {
+		ci := self.columnIndex(cond.Field)
+		if ci < 0 {
+			return nil, ErrColumnNotDeclared
+		}
+		n, err := strconv.ParseFloat(string(cond.Value), 64)
+		matchers = append(matchers, &columnCondMatcher{column: ci, cond: cond, condNum: n, isNumber: err == nil})
+	}
+	aggColumns := make([]int, len(aggs))
+	for i, agg := range aggs {
+		aggColumns[i] = -1
+		if agg.Field == nil {
+			if agg.Func != ColumnAggCount {
+				return nil, ErrColumnAggSumNonNum
+			}
+			continue
+		}
+		aggColumns[i] = self.columnIndex(agg.Field)
+		if aggColumns[i] < 0 {
+			return nil, ErrColumnNotDeclared
+		}
+	}
+	groupColumn := -1
+	if groupBy != nil {
+		groupColumn = self.columnIndex(groupBy)
+		if groupColumn < 0 {
+			return nil, ErrColumnNotDeclared
+		}
+	}
+
+	groups := make(map[string]*ColumnAggGroup)
+	var nullGroup *ColumnAggGroup
+	getGroup := func(key []byte) *ColumnAggGroup {
+		if key == nil {
+			if nullGroup == nil {
+				nullGroup = &ColumnAggGroup{Values: make([]ColumnAggValue, len(aggs))}
+			}
+			return nullGroup
+		}
+		g, ok := groups[string(key)]
+		if !ok {
+			g = &ColumnAggGroup{Key: append([]byte{}, key...), Values: make([]ColumnAggValue, len(aggs))}
+			groups[string(key)] = g
+		}
+		return g
+	}
+	if groupColumn < 0 {
+		// the aggregation without group by should always return one result
+		getGroup(nil)
+	}
+
+	min := encodeColumnTablePrefix(colGroupSub, self.Table, self.Name)
+	max := encodeColumnTableStopKey(colGroupSub, self.Table, self.Name)
+	it, err := db.NewDBRangeIterator(min, max, common.RangeROpen, false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		gid, err := decodeColumnGroupKey(len(min), it.Key())
+		if err != nil {
+			continue
+		}
+		group, err := decodeColumnRowGroup(it.Value())
+		if err != nil {
+			dbLog.Infof("column table %v-%v row group %v invalid: %v", string(self.Table), string(self.Name), gid, err)
+			continue
+		}
+		chunks := make(map[int]*columnChunk)
+		loadChunk := func(ci int) (*columnChunk, error) {
+			if c, ok := chunks[ci]; ok {
+				return c, nil
+			}
+			v, err := db.GetBytes(encodeColumnDataKey(self.Table, self.Name, self.Columns[ci], gid))
+			if err != nil {
+				return nil, err
+			}
+			c := &columnChunk{}
+			if v != nil {
+				c, err = decodeColumnChunk(v)
+				if err != nil {
+					return nil, err
+				}
+			}
+			chunks[ci] = c
+			return c, nil
+		}
+		condChunks := make([]*columnChunk, len(matchers))
+		condMatches := make([][]bool, len(matchers))
+		for i, m := range matchers {
+			c, err := loadChunk(m.column)
+			if err != nil {
+				return nil, err
+			}
+			condChunks[i] = c
+			condMatches[i] = columnDictMatches(c, m)
+		}
+		aggChunks := make([]*columnChunk, len(aggs))
+		aggNums := make([][]columnNum, len(aggs))
+		for i, ci := range aggColumns {
+			if ci < 0 {
+				continue
+			}
+			c, err := loadChunk(ci)
+			if err != nil {
+				return nil, err
+			}
+			aggChunks[i] = c
+			if aggs[i].Func != ColumnAggCount {
+				aggNums[i] = columnDictNums(c)
+			}
+		}
+		var groupChunk *columnChunk
+		if groupColumn >= 0 {
+			groupChunk, err = loadChunk(groupColumn)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for row := 0; row < group.rowNum; row++ {
+			if !group.isLive(row) {
+				continue
+			}
+			matched := true
+			for i, c := range condChunks {
+				if row >= len(c.ids) || !condMatches[i][c.ids[row]] {
+					matched = false
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+			var g *ColumnAggGroup
+			if groupChunk != nil {
+				g = getGroup(groupChunk.get(row))
+			} else {
+				g = getGroup(nil)
+			}
+			for i, agg := range aggs {
+				c := aggChunks[i]
+				if c == nil {
+					// count(*)
+					g.Values[i].Count++
+					continue
+				}
+				if row >= len(c.ids) || c.ids[row] == 0 {
+					continue
+				}
+				if agg.Func == ColumnAggCount {
+					g.Values[i].Count++
+					continue
+				}
+				n := aggNums[i][c.ids[row]]
+				if n.ok {
+					g.Values[i].addNum(n.v)
+				}
+			}
+		}
+	}
+	rets := make([]ColumnAggGroup, 0, len(groups)+1)
+	if nullGroup != nil {
+		rets = append(rets, *nullGroup)
+	}
+	for _, g := range groups {
+		rets = append(rets, *g)
+	}
+	SortColumnAggGroups(rets)
+	return rets, nil
+}
+
+// update the row in the columnar table for the changed hash fields, the nil value
+// means the field is deleted, and the other columns will be read from db.
+func (db *RockDB) hsetColumnUpdate(tableIndexes *TableIndexContainer, hkey []byte,
+	fields [][]byte, values [][]byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil || len(fields) == 0 {
+		return nil
+	}
+	ct := tableIndexes.GetColumnTableNoLock()
+	if ct == nil || !ct.hasColumn(fields) {
+		return nil
+	}
+	rowValues, err := db.HMget(hkey, ct.Columns...)
+	if err != nil {
+		return err
+	}
+	for i, column := range ct.Columns {
+		for j, f := range fields {
+			if bytes.Equal(column, f) {
+				rowValues[i] = values[j]
+			}
+		}
+	}
+	if wb == db.wb {
+		return ct.UpdateRow(db, hkey, rowValues, wb)
+	}
+	// the separated write batch may be committed after the batched db write batch
+	// which has the newer row group data, so we commit the column data at once.
+	cwb := db.rockEng.NewWriteBatch()
+	defer cwb.Destroy()
+	err = ct.UpdateRow(db, hkey, rowValues, cwb)
+	if err != nil {
+		return err
+	}
+	return ct.commitSeparated(db, cwb)
+}
+
+func (db *RockDB) hsetColumnRemove(tableIndexes *TableIndexContainer, hkey []byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil {
+		return nil
+	}
+	ct := tableIndexes.GetColumnTableNoLock()
+	if ct == nil {
+		return nil
+	}
+	if wb == db.wb {
+		return ct.RemoveRow(db, hkey, wb)
+	}
+	cwb := db.rockEng.NewWriteBatch()
+	defer cwb.Destroy()
+	err := ct.RemoveRow(db, hkey, cwb)
+	if err != nil {
+		return err
+	}
+	return ct.commitSeparated(db, cwb)
+}
+
+// ColumnAggregate aggregate the columns for the rows matching all the conditions in the columnar table,
+// and the results are grouped by the group field if it is not nil.
+func (db *RockDB) ColumnAggregate(table []byte, aggs []ColumnAggregation, conds []ColumnCondition,
+	groupBy []byte) ([]ColumnAggGroup, error) {
+	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
+	if tableIndexes == nil {
+		return nil, ErrIndexTableNotExist
+	}
+	tableIndexes.RLock()
+	ct := tableIndexes.GetColumnTableForReadNoLock()
+	tableIndexes.RUnlock()
+	if ct == nil {
+		return nil, ErrIndexNotExist
+	}
+	return ct.aggregate(db, aggs, conds, groupBy)
+}
@@ -0,0 +1,239 @@
+package rockredis
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func waitColumnTableBuildDone(t *testing.T, db *RockDB, table string, name string) {
+	buildStart := time.Now()
+	for {
+		time.Sleep(time.Millisecond * 10)
+		tableIndexes := db.indexMgr.GetTableIndexes(table)
+		assert.NotNil(t, tableIndexes)
+		tableIndexes.Lock()
+		state := tableIndexes.columnTables[name].State
+		tableIndexes.Unlock()
+		if state == BuildDoneIndex {
+			break
+		} else if time.Since(buildStart) > time.Second*10 {
+			t.Errorf("building column table timeout")
+			break
+		}
+	}
+}
+
+func TestColumnChunkCodec(t *testing.T) {
+	var c columnChunk
+	c.set(0, []byte("a"))
+	c.set(1, []byte("a"))
+	c.set(3, []byte("b"))
+	c.set(4, []byte(""))
+	c.set(1, nil)
+	c.set(0, []byte("c"))
+	assert.Equal(t, 5, c.rowNum())
+
+	dc, err := decodeColumnChunk(c.encode())
+	assert.Nil(t, err)
+	assert.Equal(t, 5, dc.rowNum())
+	// the unused value should be removed from the dictionary
+	assert.Equal(t, 3, len(dc.dict))
+	assert.Equal(t, []byte("c"), dc.get(0))
+	assert.Nil(t, dc.get(1))
+	assert.Nil(t, dc.get(2))
+	assert.Equal(t, []byte("b"), dc.get(3))
+	assert.Equal(t, []byte(""), dc.get(4))
+	assert.Nil(t, dc.get(100))
+	assert.False(t, dc.isAllNull())
+	assert.Equal(t, c.encode(), dc.encode())
+
+	_, err = decodeColumnChunk(c.encode()[:4])
+	assert.NotNil(t, err)
+
+	var g columnRowGroup
+	g.rowNum = 10
+	g.setLive(1, true)
+	g.setLive(9, true)
+	g.setLive(1, false)
+	dg, err := decodeColumnRowGroup(g.encode())
+	assert.Nil(t, err)
+	assert.Equal(t, 10, dg.rowNum)
+	assert.Equal(t, 1, dg.liveNum())
+	assert.True(t, dg.isLive(9))
+	assert.False(t, dg.isLive(1))
+}
+
+func TestHashColumnTableAggregate(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := "test_col"
+	// the data written before the column table added should be stored while building
+	for i := 0; i < columnRowGroupSize+10; i++ {
+		city := "hz"
+		if i%2 == 0 {
+			city = "sh"
+		}
+		err := db.HMset(0, []byte(table+":"+strconv.Itoa(i)),
+			common.KVRecord{Key: []byte("city"), Value: []byte(city)},
+			common.KVRecord{Key: []byte("age"), Value: []byte(strconv.Itoa(i % 100))},
+			common.KVRecord{Key: []byte("other"), Value: []byte("not stored")})
+		assert.Nil(t, err)
+	}
+
+	ct := &common.ColumnTableSchema{
+		Name:    "col_table",
+		Columns: []string{"city", "age", "score"},
+		State:   common.InitIndex,
+	}
+	err := db.AddColumnTable(table, ct)
+	assert.Nil(t, err)
+	aggs := []ColumnAggregation{{Func: ColumnAggCount}}
+	_, err = db.ColumnAggregate([]byte(table), aggs, nil, nil)
+	assert.Equal(t, ErrIndexNotExist, err)
+	ct.State = common.BuildingIndex
+	err = db.UpdateColumnTableState(table, ct)
+	assert.Nil(t, err)
+	waitColumnTableBuildDone(t, db, table, ct.Name)
+
+	rets, err := db.ColumnAggregate([]byte(table), aggs, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, int64(columnRowGroupSize+10), rets[0].Values[0].Count)
+
+	aggs = []ColumnAggregation{
+		{Func: ColumnAggCount},
+		{Func: ColumnAggSum, Field: []byte("age")},
+		{Func: ColumnAggMin, Field: []byte("age")},
+		{Func: ColumnAggMax, Field: []byte("age")},
+		{Func: ColumnAggAvg, Field: []byte("score")},
+	}
+	conds := []ColumnCondition{{Field: []byte("age"), Op: ColumnCondLT, Value: []byte("10")}}
+	rets, err = db.ColumnAggregate([]byte(table), aggs, conds, []byte("city"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rets))
+	// 0-9, 100-109, ... 1000-1009, 1024-1033 (24-33 not matched)
+	assert.Equal(t, []byte("hz"), rets[0].Key)
+	assert.Equal(t, []byte("sh"), rets[1].Key)
+	assert.Equal(t, int64(55), rets[0].Values[0].Count)
+	assert.Equal(t, int64(55), rets[1].Values[0].Count)
+	v, ok := rets[0].Values[1].Result(ColumnAggSum)
+	assert.True(t, ok)
+	assert.Equal(t, float64(25*11), v)
+	v, _ = rets[0].Values[2].Result(ColumnAggMin)
+	assert.Equal(t, float64(1), v)
+	v, _ = rets[1].Values[3].Result(ColumnAggMax)
+	assert.Equal(t, float64(8), v)
+	_, ok = rets[0].Values[4].Result(ColumnAggAvg)
+	assert.False(t, ok)
+
+	// the write after build should be updated
+	key1 := []byte(table + ":1")
+	_, err = db.HSet(0, false, key1, []byte("score"), []byte("90.5"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, key1, []byte("city"), []byte("bj"))
+	assert.Nil(t, err)
+	newKey := []byte(table + ":new")
+	_, err = db.HSet(0, false, newKey, []byte("score"), []byte("70.5"))
+	assert.Nil(t, err)
+	aggs = []ColumnAggregation{{Func: ColumnAggCount, Field: []byte("score")}, {Func: ColumnAggAvg, Field: []byte("score")}}
+	rets, err = db.ColumnAggregate([]byte(table), aggs, nil, []byte("city"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(rets))
+	assert.Nil(t, rets[0].Key)
+	assert.Equal(t, int64(1), rets[0].Values[0].Count)
+	assert.Equal(t, []byte("bj"), rets[1].Key)
+	v, _ = rets[1].Values[1].Result(ColumnAggAvg)
+	assert.Equal(t, 90.5, v)
+
+	conds = []ColumnCondition{{Field: []byte("city"), Op: ColumnCondEQ, Value: []byte("bj")}}
+	rets, err = db.ColumnAggregate([]byte(table), []ColumnAggregation{{Func: ColumnAggCount}}, conds, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rets[0].Values[0].Count)
+
+	_, err = db.HDel(0, key1, []byte("city"), []byte("age"), []byte("score"))
+	assert.Nil(t, err)
+	rets, err = db.ColumnAggregate([]byte(table), []ColumnAggregation{{Func: ColumnAggCount}}, conds, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rets[0].Values[0].Count)
+	// the row only has other fields should be removed from the column table
+	rets, err = db.ColumnAggregate([]byte(table), []ColumnAggregation{{Func: ColumnAggCount}}, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(columnRowGroupSize+10), rets[0].Values[0].Count)
+
+	_, err = db.HClear(0, newKey)
+	assert.Nil(t, err)
+	rets, err = db.ColumnAggregate([]byte(table), []ColumnAggregation{{Func: ColumnAggCount}}, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(columnRowGroupSize+9), rets[0].Values[0].Count)
+
+	_, err = db.ColumnAggregate([]byte(table), []ColumnAggregation{{Func: ColumnAggSum, Field: []byte("other")}}, nil, nil)
+	assert.Equal(t, ErrColumnNotDeclared, err)
+
+	ct.State = common.ReadyIndex
+	err = db.UpdateColumnTableState(table, ct)
+	assert.Nil(t, err)
+	schema, err := db.GetIndexSchema(table)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(schema.ColumnTables))
+	assert.Equal(t, ct.Columns, schema.ColumnTables[0].Columns)
+	assert.Equal(t, common.ReadyIndex, schema.ColumnTables[0].State)
+
+	ct.State = common.DeletedIndex
+	err = db.UpdateColumnTableState(table, ct)
+	assert.Nil(t, err)
+	_, err = db.ColumnAggregate([]byte(table), []ColumnAggregation{{Func: ColumnAggCount}}, nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestHashColumnTableBatchWrite(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := "test_col_batch"
+	ct := &common.ColumnTableSchema{
+		Name:    "col_table",
+		Columns: []string{"v"},
+		State:   common.InitIndex,
+	}
+	err := db.AddColumnTable(table, ct)
+	assert.Nil(t, err)
+	ct.State = common.BuildingIndex
+	err = db.UpdateColumnTableState(table, ct)
+	assert.Nil(t, err)
+	waitColumnTableBuildDone(t, db, table, ct.Name)
+
+	// the rows in the same batch share the row group
+	err = db.BeginBatchWrite()
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		err = db.HMset(0, []byte(table+":"+strconv.Itoa(i)), common.KVRecord{Key: []byte("v"), Value: []byte(strconv.Itoa(i))})
+		assert.Nil(t, err)
+	}
+	err = db.CommitBatchWrite()
+	assert.Nil(t, err)
+	aggs := []ColumnAggregation{{Func: ColumnAggCount}, {Func: ColumnAggSum, Field: []byte("v")}}
+	rets, err := db.ColumnAggregate([]byte(table), aggs, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), rets[0].Values[0].Count)
+	assert.Equal(t, float64(45), rets[0].Values[1].Sum)
+
+	err = db.BeginBatchWrite()
+	assert.Nil(t, err)
+	err = db.HMset(0, []byte(table+":100"), common.KVRecord{Key: []byte("v"), Value: []byte("100")})
+	assert.Nil(t, err)
+	db.AbortBatch()
+	err = db.HMset(0, []byte(table+":11"), common.KVRecord{Key: []byte("v"), Value: []byte("11")})
+	assert.Nil(t, err)
+	rets, err = db.ColumnAggregate([]byte(table), aggs, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), rets[0].Values[0].Count)
+	assert.Equal(t, float64(56), rets[0].Values[1].Sum)
+}
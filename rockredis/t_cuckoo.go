@@ -0,0 +1,382 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// The cuckoo filter is made of several sub filters, a new sub filter will be added
+// with larger capacity if the item can not be inserted into the last one.
+// Each sub filter is split into chunks with fixed size, and both the candidate buckets
+// for an item are in the same chunk, so the relocation while inserting only happens in
+// one chunk and we need rewrite only one chunk while adding an item to a huge filter.
+// key:version:filter index:chunk index -> buckets
+// each bucket has cuckooBucketSlots fingerprints with 2 bytes, and 0 means empty slot.
+
+const (
+	cuckooChunkBytes       = 1024
+	cuckooBucketSlots      = 4
+	cuckooFpBytes          = 2
+	cuckooBucketBytes      = cuckooBucketSlots * cuckooFpBytes
+	cuckooChunkBuckets     = cuckooChunkBytes / cuckooBucketBytes
+	cuckooMaxKicks         = 500
+	maxCuckooSubFilters    = 32
+	maxCuckooCapacity      = 1 << 32
+	DefaultCuckooCapacity  = 1024
+	DefaultCuckooExpansion = 1
+)
+
+var (
+	ErrCuckooFull     = errors.New("ERR filter is full")
+	ErrCuckooCapacity = errors.New("ERR (capacity should be larger than 0)")
+	errCuckooMeta     = errors.New("invalid cuckoo filter meta")
+)
+
+type cuckooSubFilter struct {
+	Chunks int64
+	Count  int64
+}
+
+type cuckooMeta struct {
+	Capacity  int64
+	Expansion int64
+	Deleted   int64
+	Filters   []cuckooSubFilter
+}
+
+func (cm *cuckooMeta) encode() []byte {
+	buf := make([]byte, 8*3+2+len(cm.Filters)*8*2)
+	binary.BigEndian.PutUint64(buf, uint64(cm.Capacity))
+	binary.BigEndian.PutUint64(buf[8:], uint64(cm.Expansion))
+	binary.BigEndian.PutUint64(buf[16:], uint64(cm.Deleted))
+	binary.BigEndian.PutUint16(buf[24:], uint16(len(cm.Filters)))
+	pos := 26
+	for _, f := range cm.Filters {
+		binary.BigEndian.PutUint64(buf[pos:], uint64(f.Chunks))
+		binary.BigEndian.PutUint64(buf[pos+8:], uint64(f.Count))
+		pos += 16
+	}
+	return buf
+}
+
+func decodeCuckooMeta(v []byte) (*cuckooMeta, error) {
+	if len(v) < 26 {
+		return nil, errCuckooMeta
+	}
+	var cm cuckooMeta
+	cm.Capacity = int64(binary.BigEndian.Uint64(v))
+	cm.Expansion = int64(binary.BigEndian.Uint64(v[8:]))
+	cm.Deleted = int64(binary.BigEndian.Uint64(v[16:]))
+	n := int(binary.BigEndian.Uint16(v[24:]))
+	if len(v) < 26+n*16 {
+		return nil, errCuckooMeta
+	}
+	pos := 26
+	cm.Filters = make([]cuckooSubFilter, n)
+	for i := 0; i < n; i++ {
+		cm.Filters[i].Chunks = int64(binary.BigEndian.Uint64(v[pos:]))
+		cm.Filters[i].Count = int64(binary.BigEndian.Uint64(v[pos+8:]))
+		pos += 16
+	}
+	return &cm, nil
+}
+
+func (cm *cuckooMeta) grow() error {
+	n := len(cm.Filters)
+	if n >= maxCuckooSubFilters {
+		return ErrCuckooFull
+	}
+	capacity := cm.Capacity
+	for i := 0; i < n && capacity < maxCuckooCapacity; i++ {
+		capacity *= cm.Expansion
+	}
+	chunks := (capacity + cuckooChunkBuckets*cuckooBucketSlots - 1) / (cuckooChunkBuckets * cuckooBucketSlots)
+	if chunks < 1 {
+		chunks = 1
+	}
+	cm.Filters = append(cm.Filters, cuckooSubFilter{Chunks: chunks})
+	return nil
+}
+
+type cuckooItemHash struct {
+	chunkHash uint64
+	i1        uint32
+	fp        uint16
+}
+
+func hashCuckooItem(item []byte) cuckooItemHash {
+	h1, h2 := murmur3.Sum128(item)
+	fp := uint16(h2 >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	return cuckooItemHash{
+		chunkHash: h1,
+		i1:        uint32(h2) % cuckooChunkBuckets,
+		fp:        fp,
+	}
+}
+
+func cuckooAltIndex(i uint32, fp uint16) uint32 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], fp)
+	return (i ^ murmur3.Sum32(b[:])) % cuckooChunkBuckets
+}
+
+func (f *cuckooSubFilter) chunkIndex(h cuckooItemHash) int64 {
+	return int64(h.chunkHash % uint64(f.Chunks))
+}
+
+func cuckooGetFp(chunk []byte, bucket uint32, slot int) uint16 {
+	pos := int(bucket)*cuckooBucketBytes + slot*cuckooFpBytes
+	return binary.BigEndian.Uint16(chunk[pos:])
+}
+
+func cuckooSetFp(chunk []byte, bucket uint32, slot int, fp uint16) {
+	pos := int(bucket)*cuckooBucketBytes + slot*cuckooFpBytes
+	binary.BigEndian.PutUint16(chunk[pos:], fp)
+}
+
+func cuckooInsertToBucket(chunk []byte, bucket uint32, fp uint16) bool {
+	for s := 0; s < cuckooBucketSlots; s++ {
+		if cuckooGetFp(chunk, bucket, s) == 0 {
+			cuckooSetFp(chunk, bucket, s, fp)
+			return true
+		}
+	}
+	return false
+}
+
+func cuckooCountInBucket(chunk []byte, bucket uint32, fp uint16) int64 {
+	cnt := int64(0)
+	for s := 0; s < cuckooBucketSlots; s++ {
+		if cuckooGetFp(chunk, bucket, s) == fp {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func cuckooDeleteFromBucket(chunk []byte, bucket uint32, fp uint16) bool {
+	for s := 0; s < cuckooBucketSlots; s++ {
+		if cuckooGetFp(chunk, bucket, s) == fp {
+			cuckooSetFp(chunk, bucket, s, 0)
+			return true
+		}
+	}
+	return false
+}
+
+// insert the fingerprint into the chunk, the chunk will not be changed if failed.
+// Note the victim to kick out should be deterministic since all the replicas should
+// have the same result.
+func cuckooInsert(chunk []byte, h cuckooItemHash) bool {
+	i2 := cuckooAltIndex(h.i1, h.fp)
+	if cuckooInsertToBucket(chunk, h.i1, h.fp) || cuckooInsertToBucket(chunk, i2, h.fp) {
+		return true
+	}
+	tmp := make([]byte, len(chunk))
+	copy(tmp, chunk)
+	fp := h.fp
+	i := h.i1
+	if h.fp&1 == 1 {
+		i = i2
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		slot := (n + int(fp)) % cuckooBucketSlots
+		victim := cuckooGetFp(tmp, i, slot)
+		cuckooSetFp(tmp, i, slot, fp)
+		fp = victim
+		i = cuckooAltIndex(i, fp)
+		if cuckooInsertToBucket(tmp, i, fp) {
+			copy(chunk, tmp)
+			return true
+		}
+	}
+	return false
+}
+
+func (db *RockDB) getCuckooMeta(ts int64, key []byte, useLock bool) (*extMeta, *cuckooMeta, error) {
+	m, err := db.extGetMeta(ts, CuckooMetaExtType, key, useLock)
+	if err != nil || m == nil {
+		return nil, nil, err
+	}
+	cm, err := decodeCuckooMeta(m.Data)
+	return m, cm, err
+}
+
+func (db *RockDB) getCuckooMetaForWrite(ts int64, key []byte, capacity int64, expansion int64) (*extMeta, *cuckooMeta, bool, error) {
+	m, created, err := db.extGetMetaForWrite(ts, CuckooMetaExtType, key, db.wb)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !created {
+		cm, err := decodeCuckooMeta(m.Data)
+		return m, cm, false, err
+	}
+	cm := &cuckooMeta{
+		Capacity:  capacity,
+		Expansion: expansion,
+	}
+	err = cm.grow()
+	return m, cm, true, err
+}
+
+// CFReserve create an empty cuckoo filter with the initial capacity
+func (db *RockDB) CFReserve(ts int64, key []byte, capacity int64, expansion int64) error {
+	if capacity <= 0 || capacity > maxCuckooCapacity {
+		return ErrCuckooCapacity
+	}
+	if expansion < 1 {
+		return ErrBloomExpansion
+	}
+	m, cm, created, err := db.getCuckooMetaForWrite(ts, key, capacity, expansion)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return ErrBloomExist
+	}
+	m.Data = cm.encode()
+	db.extSetMeta(CuckooMetaExtType, key, m, db.wb)
+	return db.MaybeCommitBatch()
+}
+
+// CFAdd add the item to the cuckoo filter, the filter will be created with default params if not exist.
+// The same item can be added multiple times.
+func (db *RockDB) CFAdd(ts int64, key []byte, item []byte) (int64, error) {
+	m, cm, _, err := db.getCuckooMetaForWrite(ts, key, DefaultCuckooCapacity, DefaultCuckooExpansion)
+	if err != nil {
+		return 0, err
+	}
+	cache, err := db.newBloomChunkCache(key, m.Ver)
+	if err != nil {
+		return 0, err
+	}
+	h := hashCuckooItem(item)
+	fi := len(cm.Filters) - 1
+	f := &cm.Filters[fi]
+	ck, chunk, err := cache.get(CuckooDataExtType, int64(fi), f.chunkIndex(h), cuckooChunkBytes, false)
+	if err != nil {
+		return 0, err
+	}
+	if !cuckooInsert(chunk, h) {
+		if err := cm.grow(); err != nil {
+			return 0, err
+		}
+		fi = len(cm.Filters) - 1
+		f = &cm.Filters[fi]
+		ck, chunk, err = cache.get(CuckooDataExtType, int64(fi), f.chunkIndex(h), cuckooChunkBytes, false)
+		if err != nil {
+			return 0, err
+		}
+		if !cuckooInsert(chunk, h) {
+			return 0, ErrCuckooFull
+		}
+	}
+	f.Count++
+	cache.markDirty(ck)
+	cache.flush(db.wb)
+	m.Data = cm.encode()
+	db.extSetMeta(CuckooMetaExtType, key, m, db.wb)
+	err = db.MaybeCommitBatch()
+	return 1, err
+}
+
+// CFDel delete one occurrence of the item from the cuckoo filter, return 1 if deleted
+func (db *RockDB) CFDel(ts int64, key []byte, item []byte) (int64, error) {
+	m, cm, err := db.getCuckooMeta(ts, key, false)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		return 0, ErrBloomNotFound
+	}
+	cache, err := db.newBloomChunkCache(key, m.Ver)
+	if err != nil {
+		return 0, err
+	}
+	h := hashCuckooItem(item)
+	i2 := cuckooAltIndex(h.i1, h.fp)
+	// delete from the newest filter first
+	for fi := len(cm.Filters) - 1; fi >= 0; fi-- {
+		f := &cm.Filters[fi]
+		ck, chunk, err := cache.get(CuckooDataExtType, int64(fi), f.chunkIndex(h), cuckooChunkBytes, false)
+		if err != nil {
+			return 0, err
+		}
+		if cuckooDeleteFromBucket(chunk, h.i1, h.fp) || cuckooDeleteFromBucket(chunk, i2, h.fp) {
+			f.Count--
+			cm.Deleted++
+			cache.markDirty(ck)
+			cache.flush(db.wb)
+			m.Data = cm.encode()
+			db.extSetMeta(CuckooMetaExtType, key, m, db.wb)
+			err = db.MaybeCommitBatch()
+			return 1, err
+		}
+	}
+	return 0, nil
+}
+
+// CFCount return the number of times the item may be in the cuckoo filter
+func (db *RockDB) CFCount(key []byte, item []byte) (int64, error) {
+	m, cm, err := db.getCuckooMeta(time.Now().UnixNano(), key, true)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	cache, err := db.newBloomChunkCache(key, m.Ver)
+	if err != nil {
+		return 0, err
+	}
+	h := hashCuckooItem(item)
+	i2 := cuckooAltIndex(h.i1, h.fp)
+	total := int64(0)
+	for fi := range cm.Filters {
+		f := &cm.Filters[fi]
+		_, chunk, err := cache.get(CuckooDataExtType, int64(fi), f.chunkIndex(h), cuckooChunkBytes, true)
+		if err != nil {
+			return 0, err
+		}
+		total += cuckooCountInBucket(chunk, h.i1, h.fp)
+		if i2 != h.i1 {
+			total += cuckooCountInBucket(chunk, i2, h.fp)
+		}
+	}
+	return total, nil
+}
+
+// CFExists check whether the item may exist in the cuckoo filter
+func (db *RockDB) CFExists(key []byte, item []byte) (int64, error) {
+	n, err := db.CFCount(key, item)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (db *RockDB) CFClear(ts int64, key []byte) (int64, error) {
+	return db.extDelete(ts, CuckooMetaExtType, key)
+}
+
+func (db *RockDB) CFKeyExists(key []byte) (int64, error) {
+	return db.extKeyExists(CuckooMetaExtType, key)
+}
+
+func (db *RockDB) CFExpire(ts int64, key []byte, ttlSec int64) (int64, error) {
+	return db.extExpire(ts, CuckooMetaExtType, key, ttlSec)
+}
+
+func (db *RockDB) CFPersist(ts int64, key []byte) (int64, error) {
+	return db.extPersist(ts, CuckooMetaExtType, key)
+}
+
+func (db *RockDB) CFTtl(key []byte) (int64, error) {
+	return db.extTTL(CuckooMetaExtType, key)
+}
@@ -0,0 +1,92 @@
+package rockredis
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCuckooFilter(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_cuckoo")
+	tn := time.Now().UnixNano()
+	err := db.CFReserve(tn, key, 1000, 2)
+	assert.Nil(t, err)
+	err = db.CFReserve(tn, key, 1000, 2)
+	assert.Equal(t, ErrBloomExist, err)
+
+	n := 5000
+	for i := 0; i < n; i++ {
+		_, err := db.CFAdd(tn, key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < n; i++ {
+		ret, err := db.CFExists(key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), ret)
+	}
+	fp := 0
+	for i := 0; i < n; i++ {
+		ret, err := db.CFExists(key, []byte(fmt.Sprintf("other-%d", i)))
+		assert.Nil(t, err)
+		fp += int(ret)
+	}
+	assert.True(t, float64(fp)/float64(n) < 0.01, fp)
+
+	_, err = db.CFAdd(tn, key, []byte("dup"))
+	assert.Nil(t, err)
+	_, err = db.CFAdd(tn, key, []byte("dup"))
+	assert.Nil(t, err)
+	cnt, err := db.CFCount(key, []byte("dup"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), cnt)
+	cnt, err = db.CFDel(tn, key, []byte("dup"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	cnt, err = db.CFCount(key, []byte("dup"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	for i := 0; i < n; i++ {
+		cnt, err := db.CFDel(tn, key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), cnt)
+	}
+	cnt, err = db.CFDel(tn, []byte("test:testdb_cuckoo_not_exist"), []byte("dup"))
+	assert.Equal(t, ErrBloomNotFound, err)
+
+	cnt, err = db.CFExpire(tn, key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	ttl, err := db.CFTtl(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= 10)
+	cnt, err = db.CFClear(tn, key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cnt)
+	cnt, err = db.CFKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+}
+
+func TestCuckooInsertKeepChunkIfFailed(t *testing.T) {
+	chunk := make([]byte, cuckooChunkBytes)
+	h := hashCuckooItem([]byte("item"))
+	inserted := 0
+	for i := 0; i < cuckooChunkBuckets*cuckooBucketSlots; i++ {
+		if cuckooInsert(chunk, h) {
+			inserted++
+		}
+	}
+	// the same fingerprint can only be inserted into the 2 candidate buckets
+	assert.Equal(t, 2*cuckooBucketSlots, inserted)
+	i2 := cuckooAltIndex(h.i1, h.fp)
+	assert.Equal(t, int64(cuckooBucketSlots), cuckooCountInBucket(chunk, h.i1, h.fp))
+	assert.Equal(t, int64(cuckooBucketSlots), cuckooCountInBucket(chunk, i2, h.fp))
+}
@@ -0,0 +1,374 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// the extanded data types are all stored with the prefix ExtandType and a sub type,
+// each extanded data type has a meta sub type and a data sub type (always the meta sub type + 1).
+// meta key: ExtandType|metaSubType|meta:|key
+// data key: ExtandType|dataSubType|tableLen|table|:|memcmp(rk, :, version, ...)
+// the version of the data is the create time of the key, so the old data will not be visible
+// after the key is expired and recreated, and all the data of the key can be range deleted.
+// the expire time is stored in the meta value and the key will be deleted by the ttl checker
+// using the exp table with the data type ExtandType.
+const (
+	BloomMetaExtType  byte = 1
+	BloomDataExtType  byte = 2
+	CuckooMetaExtType byte = 3
+	CuckooDataExtType byte = 4
+	CMSMetaExtType    byte = 5
+	CMSDataExtType    byte = 6
+	TopKMetaExtType   byte = 7
+	TopKDataExtType   byte = 8
+	TSMetaExtType     byte = 9
+	TSDataExtType     byte = 10
+	// the manifest of the chunked kv and json value is stored in the kv and json value,
+	// so there is no meta sub type for the chunks (11 and 13 are reserved).
+	KVChunkExtType   byte = 12
+	JSONChunkExtType byte = 14
+	StageMetaExtType byte = 15
+	StageDataExtType byte = 16
+)
+
+const extMetaHeaderLen = 8 + 8
+
+var (
+	errExtMetaKey   = errors.New("invalid extanded type meta key")
+	errExtMetaValue = errors.New("invalid extanded type meta value")
+	errExtDataKey   = errors.New("invalid extanded type data key")
+)
+
+var extTypeName = map[byte]string{
+	BloomMetaExtType:  "bloom",
+	CuckooMetaExtType: "cuckoo",
+	CMSMetaExtType:    "cms",
+	TopKMetaExtType:   "topk",
+	TSMetaExtType:     "ts",
+}
+
+type extMeta struct {
+	// the create time of the key, used as the version of the data
+	Ver int64
+	// expire time in seconds, 0 means no expire
+	ExpireAt int64
+	Data     []byte
+}
+
+func (m *extMeta) isExpired(ts int64) bool {
+	return m.ExpireAt > 0 && m.ExpireAt <= ts/int64(time.Second)
+}
+
+func (m *extMeta) encode() []byte {
+	buf := make([]byte, extMetaHeaderLen+len(m.Data))
+	binary.BigEndian.PutUint64(buf, uint64(m.Ver))
+	binary.BigEndian.PutUint64(buf[8:], uint64(m.ExpireAt))
+	copy(buf[extMetaHeaderLen:], m.Data)
+	return buf
+}
+
+func decodeExtMeta(v []byte) (*extMeta, error) {
+	if len(v) < extMetaHeaderLen {
+		return nil, errExtMetaValue
+	}
+	var m extMeta
+	m.Ver = int64(binary.BigEndian.Uint64(v))
+	m.ExpireAt = int64(binary.BigEndian.Uint64(v[8:]))
+	m.Data = v[extMetaHeaderLen:]
+	return &m, nil
+}
+
+func extEncodeMetaKey(metaType byte, key []byte) []byte {
+	buf := make([]byte, 2+len(metaPrefix)+len(key))
+	buf[0] = ExtandType
+	buf[1] = metaType
+	pos := 2
+	copy(buf[pos:], metaPrefix)
+	pos += len(metaPrefix)
+	copy(buf[pos:], key)
+	return buf
+}
+
+func extDecodeMetaKey(ek []byte) (byte, []byte, error) {
+	if len(ek) < 2+len(metaPrefix) || ek[0] != ExtandType {
+		return 0, nil, errExtMetaKey
+	}
+	return ek[1], ek[2+len(metaPrefix):], nil
+}
+
+func extEncodeDataPrefix(dataType byte, table []byte) []byte {
+	buf := make([]byte, 2+2+len(table)+1)
+	buf[0] = ExtandType
+	buf[1] = dataType
+	pos := 2
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(table)))
+	pos += 2
+	copy(buf[pos:], table)
+	pos += len(table)
+	buf[pos] = tableStartSep
+	return buf
+}
+
+// encode the data key for extanded type, the vals will be appended to the key, version
+func extEncodeDataKey(dataType byte, table []byte, rk []byte, ver int64, vals ...interface{}) ([]byte, error) {
+	buf := extEncodeDataPrefix(dataType, table)
+	args := make([]interface{}, 0, 3+len(vals))
+	args = append(args, rk, colStartSep, ver)
+	args = append(args, vals...)
+	return EncodeMemCmpKey(buf, args...)
+}
+
+func extDecodeDataKey(ek []byte) (byte, []byte, []byte, []interface{}, error) {
+	if len(ek) < 2+2 || ek[0] != ExtandType {
+		return 0, nil, nil, nil, errExtDataKey
+	}
+	tableLen := int(binary.BigEndian.Uint16(ek[2:]))
+	pos := 4 + tableLen
+	if pos+1 > len(ek) || ek[pos] != tableStartSep {
+		return 0, nil, nil, nil, errExtDataKey
+	}
+	table := ek[4:pos]
+	vals, err := Decode(ek[pos+1:], 5)
+	if err != nil {
+		return 0, nil, nil, nil, err
+	}
+	if len(vals) < 3 {
+		return 0, nil, nil, nil, errExtDataKey
+	}
+	rk, _ := vals[0].([]byte)
+	return ek[1], table, rk, vals[2:], nil
+}
+
+// the range for all the data (all versions) of the key
+func extEncodeDataRange(dataType byte, table []byte, rk []byte) ([]byte, []byte, error) {
+	prefix := extEncodeDataPrefix(dataType, table)
+	start, err := EncodeMemCmpKey(prefix, rk, colStartSep)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix = extEncodeDataPrefix(dataType, table)
+	stop, err := EncodeMemCmpKey(prefix, rk, colStartSep+1)
+	return start, stop, err
+}
+
+func extEncodeExpKey(metaType byte, key []byte) []byte {
+	buf := make([]byte, 1+len(key))
+	buf[0] = metaType
+	copy(buf[1:], key)
+	return buf
+}
+
+// get the meta of the extanded type, nil will be returned if not exist or expired
+func (db *RockDB) extGetMeta(ts int64, metaType byte, key []byte, useLock bool) (*extMeta, error) {
+	mk := extEncodeMetaKey(metaType, key)
+	var v []byte
+	var err error
+	if useLock {
+		v, err = db.GetBytes(mk)
+	} else {
+		v, err = db.GetBytesNoLock(mk)
+	}
+	if err != nil || v == nil {
+		return nil, err
+	}
+	m, err := decodeExtMeta(v)
+	if err != nil {
+		return nil, err
+	}
+	if m.isExpired(ts) {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// get the meta for write, if the key is expired, the old data will be deleted and a new meta
+// will be returned. The bool returned will be true if the key is created
+func (db *RockDB) extGetMetaForWrite(ts int64, metaType byte, key []byte, wb engine.WriteBatch) (*extMeta, bool, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := checkKeySize(rk); err != nil {
+		return nil, false, err
+	}
+	mk := extEncodeMetaKey(metaType, key)
+	v, err := db.GetBytesNoLock(mk)
+	if err != nil {
+		return nil, false, err
+	}
+	if v != nil {
+		m, err := decodeExtMeta(v)
+		if err != nil {
+			return nil, false, err
+		}
+		if !m.isExpired(ts) {
+			return m, false, nil
+		}
+		// the new data will use a new version, so we can delete the old data directly
+		if err := db.extDeleteData(metaType, key, m, wb); err != nil {
+			return nil, false, err
+		}
+	} else {
+		db.IncrTableKeyCount(table, 1, wb)
+	}
+	return &extMeta{Ver: ts}, true, nil
+}
+
+func (db *RockDB) extSetMeta(metaType byte, key []byte, m *extMeta, wb engine.WriteBatch) {
+	wb.Put(extEncodeMetaKey(metaType, key), m.encode())
+}
+
+func (db *RockDB) extDeleteData(metaType byte, key []byte, m *extMeta, wb engine.WriteBatch) error {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return err
+	}
+	start, stop, err := extEncodeDataRange(metaType+1, table, rk)
+	if err != nil {
+		return err
+	}
+	wb.DeleteRange(start, stop)
+	if isSketchExtType(metaType) {
+		db.sketchCache.Del(metaType, key)
+	}
+	if m.ExpireAt > 0 {
+		ek := extEncodeExpKey(metaType, key)
+		wb.Delete(expEncodeTimeKey(ExtandType, ek, m.ExpireAt))
+		wb.Delete(expEncodeMetaKey(ExtandType, ek))
+	}
+	return nil
+}
+
+// delete the key for the extanded type, return 1 if the key exist
+func (db *RockDB) extDelete(ts int64, metaType byte, key []byte) (int64, error) {
+	table, _, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return 0, err
+	}
+	mk := extEncodeMetaKey(metaType, key)
+	v, err := db.GetBytesNoLock(mk)
+	if err != nil || v == nil {
+		return 0, err
+	}
+	m, err := decodeExtMeta(v)
+	if err != nil {
+		return 0, err
+	}
+	wb := db.wb
+	if err := db.extDeleteData(metaType, key, m, wb); err != nil {
+		return 0, err
+	}
+	wb.Delete(mk)
+	db.IncrTableKeyCount(table, -1, wb)
+	err = db.MaybeCommitBatch()
+	if m.isExpired(ts) {
+		return 0, err
+	}
+	return 1, err
+}
+
+func (db *RockDB) extKeyExists(metaType byte, key []byte) (int64, error) {
+	m, err := db.extGetMeta(time.Now().UnixNano(), metaType, key, true)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// set the expire time in seconds for the extanded type key, 0 will be returned if the key not exist
+func (db *RockDB) extExpire(ts int64, metaType byte, key []byte, duration int64) (int64, error) {
+	m, err := db.extGetMeta(ts, metaType, key, false)
+	if err != nil || m == nil {
+		return 0, err
+	}
+	when := ts/int64(time.Second) + duration
+	if when >= int64(math.MaxUint32-1) {
+		return 0, errExpOverflow
+	}
+	wb := db.wb
+	ek := extEncodeExpKey(metaType, key)
+	emk := expEncodeMetaKey(ExtandType, ek)
+	if m.ExpireAt > 0 {
+		wb.Delete(expEncodeTimeKey(ExtandType, ek, m.ExpireAt))
+	}
+	m.ExpireAt = when
+	wb.Put(expEncodeTimeKey(ExtandType, ek, when), emk)
+	wb.Put(emk, nil)
+	db.extSetMeta(metaType, key, m, wb)
+	db.setNextCheckTime(when, false)
+	err = db.MaybeCommitBatch()
+	return 1, err
+}
+
+func (db *RockDB) extPersist(ts int64, metaType byte, key []byte) (int64, error) {
+	m, err := db.extGetMeta(ts, metaType, key, false)
+	if err != nil || m == nil || m.ExpireAt == 0 {
+		return 0, err
+	}
+	wb := db.wb
+	ek := extEncodeExpKey(metaType, key)
+	wb.Delete(expEncodeTimeKey(ExtandType, ek, m.ExpireAt))
+	wb.Delete(expEncodeMetaKey(ExtandType, ek))
+	m.ExpireAt = 0
+	db.extSetMeta(metaType, key, m, wb)
+	err = db.MaybeCommitBatch()
+	return 1, err
+}
+
+// return the ttl in seconds, -1 if not exist or no ttl
+func (db *RockDB) extTTL(metaType byte, key []byte) (int64, error) {
+	tn := time.Now().UnixNano()
+	m, err := db.extGetMeta(tn, metaType, key, true)
+	if err != nil || m == nil || m.ExpireAt == 0 {
+		return -1, err
+	}
+	return m.ExpireAt - tn/int64(time.Second), nil
+}
+
+// delete the expired key of the extanded type found by the ttl checker, the key will
+// be deleted only if the expire time in meta matches the time key.
+// It is called outside raft, so it should hold the apply lock to avoid the dirty sketch
+// cache flushed by the raft apply writing back the deleted data.
+func (db *RockDB) extDelExpired(tk []byte, mk []byte, ek []byte, wb engine.WriteBatch) error {
+	db.LockApply()
+	defer db.UnlockApply()
+	defer wb.Clear()
+	_, _, when, err := expDecodeTimeKey(tk)
+	if err != nil {
+		return err
+	}
+	if len(ek) < 1 {
+		return errExtMetaKey
+	}
+	metaType := ek[0]
+	key := ek[1:]
+	table, _, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return err
+	}
+	wb.Delete(tk)
+	emk := extEncodeMetaKey(metaType, key)
+	v, err := db.GetBytes(emk)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		m, err := decodeExtMeta(v)
+		if err != nil {
+			return err
+		}
+		if m.ExpireAt == when {
+			if err := db.extDeleteData(metaType, key, m, wb); err != nil {
+				return err
+			}
+			wb.Delete(emk)
+			db.IncrTableKeyCount(table, -1, wb)
+		}
+	}
+	return db.rockEng.Write(wb)
+}
@@ -0,0 +1,620 @@
+package rockredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// The full text index is an inverted index stored with the FullTextIndexDataType.
+// posting: FullTextIndexDataType|ftPostingDataType|table|:|indexname|:|memcmp(term, :, pk) -> term frequency
+// doc: FullTextIndexDataType|ftDocDataType|table|:|indexname|:|pk -> doc length|term number|(term, term frequency)...
+// The doc record is used to remove the old postings while the doc is updated
+// and to get the doc length while scoring.
+
+const (
+	ftPostingDataType byte = 1
+	ftDocDataType     byte = 2
+	ftIndexStartSep   byte = ':'
+)
+
+// the parameters for the BM25 score
+const (
+	ftBM25K1 = 1.2
+	ftBM25B  = 0.75
+)
+
+var (
+	errFullTextIndexKey   = errors.New("invalid full text index key")
+	errFullTextDocData    = errors.New("invalid full text doc data")
+	ErrFullTextQueryEmpty = errors.New("no valid term in the full text query")
+)
+
+func encodeFullTextIndexPrefix(subType byte, table []byte, indexName []byte) []byte {
+	tmpkey := make([]byte, 2+2+len(table)+1+2+len(indexName)+1)
+	pos := 0
+	tmpkey[pos] = FullTextIndexDataType
+	pos++
+	tmpkey[pos] = subType
+	pos++
+	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
+	pos += 2
+	copy(tmpkey[pos:], table)
+	pos += len(table)
+	tmpkey[pos] = ftIndexStartSep
+	pos++
+	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(indexName)))
+	pos += 2
+	copy(tmpkey[pos:], indexName)
+	pos += len(indexName)
+	tmpkey[pos] = ftIndexStartSep
+	return tmpkey
+}
+
+func encodeFullTextIndexStopKey(subType byte, table []byte, indexName []byte) []byte {
+	k := encodeFullTextIndexPrefix(subType, table, indexName)
+	k[len(k)-1] = k[len(k)-1] + 1
+	return k
+}
+
+func encodeFullTextPostingKey(table []byte, indexName []byte, term []byte, pk []byte, stopKey bool) ([]byte, error) {
+	prefix := encodeFullTextIndexPrefix(ftPostingDataType, table, indexName)
+	sep := int32(ftIndexStartSep)
+	if stopKey {
+		sep = int32(ftIndexStartSep + 1)
+	}
+	return EncodeMemCmpKey(prefix, term, sep, pk)
+}
+
+func decodeFullTextPostingKey(prefixLen int, rawKey []byte) ([]byte, []byte, error) {
+	if len(rawKey) <= prefixLen || rawKey[0] != FullTextIndexDataType || rawKey[1] != ftPostingDataType {
+		return nil, nil, errFullTextIndexKey
+	}
+	rets, err := Decode(rawKey[prefixLen:], 3)
+	if err != nil {
+		return nil, nil, err
+	}
+	term, ok := rets[0].([]byte)
+	if !ok {
+		return nil, nil, errFullTextIndexKey
+	}
+	pk, ok := rets[2].([]byte)
+	if !ok {
+		return nil, nil, errFullTextIndexKey
+	}
+	return term, pk, nil
+}
+
+func encodeFullTextDocKey(table []byte, indexName []byte, pk []byte) []byte {
+	prefix := encodeFullTextIndexPrefix(ftDocDataType, table, indexName)
+	return append(prefix, pk...)
+}
+
+type ftTermFreq struct {
+	term string
+	tf   int64
+}
+
+// the terms are sorted to make the doc data the same on all the replicas
+func encodeFullTextDoc(docLen int64, terms map[string]int64) []byte {
+	sorted := make([]ftTermFreq, 0, len(terms))
+	size := binary.MaxVarintLen64 * 2
+	for t, tf := range terms {
+		sorted = append(sorted, ftTermFreq{term: t, tf: tf})
+		size += len(t) + binary.MaxVarintLen64*2
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].term < sorted[j].term
+	})
+	buf := make([]byte, size)
+	pos := binary.PutUvarint(buf, uint64(docLen))
+	pos += binary.PutUvarint(buf[pos:], uint64(len(sorted)))
+	for _, t := range sorted {
+		pos += binary.PutUvarint(buf[pos:], uint64(len(t.term)))
+		pos += copy(buf[pos:], t.term)
+		pos += binary.PutUvarint(buf[pos:], uint64(t.tf))
+	}
+	return buf[:pos]
+}
+
+func decodeFullTextDocLen(v []byte) (int64, error) {
+	docLen, n := binary.Uvarint(v)
+	if n <= 0 {
+		return 0, errFullTextDocData
+	}
+	return int64(docLen), nil
+}
+
+func decodeFullTextDoc(v []byte) (int64, map[string]int64, error) {
+	docLen, n := binary.Uvarint(v)
+	if n <= 0 {
+		return 0, nil, errFullTextDocData
+	}
+	pos := n
+	cnt, n := binary.Uvarint(v[pos:])
+	if n <= 0 || cnt > uint64(len(v)) {
+		return 0, nil, errFullTextDocData
+	}
+	pos += n
+	terms := make(map[string]int64, cnt)
+	for i := uint64(0); i < cnt; i++ {
+		l, n := binary.Uvarint(v[pos:])
+		if n <= 0 || uint64(len(v)-pos-n) < l {
+			return 0, nil, errFullTextDocData
+		}
+		pos += n
+		term := string(v[pos : pos+int(l)])
+		pos += int(l)
+		tf, n := binary.Uvarint(v[pos:])
+		if n <= 0 {
+			return 0, nil, errFullTextDocData
+		}
+		pos += n
+		terms[term] = int64(tf)
+	}
+	return int64(docLen), terms, nil
+}
+
+// get the texts for the full text index from the json paths, all the string and
+// number values under the path will be indexed.
+func getJSONFullTextValues(jdata []byte, paths [][]byte) [][]byte {
+	texts := make([][]byte, 0, len(paths))
+	var collect func(r gjson.Result)
+	collect = func(r gjson.Result) {
+		switch r.Type {
+		case gjson.String, gjson.Number:
+			texts = append(texts, []byte(r.String()))
+		case gjson.JSON:
+			r.ForEach(func(_, v gjson.Result) bool {
+				collect(v)
+				return true
+			})
+		}
+	}
+	for _, p := range paths {
+		jpath := convertJSONPath(p)
+		if isJSONPath(jpath) {
+			rets, err := queryJSONPath(jdata, jpath)
+			if err != nil {
+				continue
+			}
+			for _, r := range rets {
+				collect(r)
+			}
+			continue
+		}
+		collect(getJSONPathResult(jdata, jpath))
+	}
+	return texts
+}
+
+type FullTextSearchResult struct {
+	PKey  []byte
+	Score float64
+}
+
+type FullTextIndex struct {
+	Table []byte
+	FullTextIndexInfo
+	// the stats for the BM25 score, it will be loaded from the doc records
+	// while searching and updated while writing, and it will be reloaded
+	// if the write batch is aborted.
+	statsLoaded bool
+	docNum      int64
+	totalLen    int64
+}
+
+func (self *FullTextIndex) hasHashField(fields [][]byte) bool {
+	for _, f := range fields {
+		for _, hf := range self.HashFields {
+			if bytes.Equal(f, hf) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UpdateDoc update the postings of the doc using the new texts, nil texts means the doc is removed.
+func (self *FullTextIndex) UpdateDoc(db *RockDB, pk []byte, texts [][]byte, wb engine.WriteBatch) error {
+	if self.State == DeletedIndex {
+		return nil
+	}
+	terms, docLen := fullTextTermFreqs(texts)
+	docKey := encodeFullTextDocKey(self.Table, self.Name, pk)
+	oldV, err := db.GetBytesNoLock(docKey)
+	if err != nil {
+		return err
+	}
+	var oldLen int64
+	var oldTerms map[string]int64
+	if oldV != nil {
+		oldLen, oldTerms, err = decodeFullTextDoc(oldV)
+		if err != nil {
+			return err
+		}
+	}
+	for t := range oldTerms {
+		if _, ok := terms[t]; ok {
+			continue
+		}
+		k, err := encodeFullTextPostingKey(self.Table, self.Name, []byte(t), pk, false)
+		if err != nil {
+			return err
+		}
+		wb.Delete(k)
+	}
+	var buf [binary.MaxVarintLen64]byte
+	for t, tf := range terms {
+		if oldTerms[t] == tf {
+			continue
+		}
+		k, err := encodeFullTextPostingKey(self.Table, self.Name, []byte(t), pk, false)
+		if err != nil {
+			return err
+		}
+		n := binary.PutUvarint(buf[:], uint64(tf))
+		wb.Put(k, buf[:n])
+	}
+	if docLen == 0 {
+		if oldV != nil {
+			wb.Delete(docKey)
+		}
+	} else {
+		wb.Put(docKey, encodeFullTextDoc(docLen, terms))
+	}
+	if self.statsLoaded {
+		if oldV != nil {
+			self.docNum--
+			self.totalLen -= oldLen
+		}
+		if docLen > 0 {
+			self.docNum++
+			self.totalLen += docLen
+		}
+	}
+	return nil
+}
+
+func (self *FullTextIndex) RemoveDoc(db *RockDB, pk []byte, wb engine.WriteBatch) error {
+	return self.UpdateDoc(db, pk, nil, wb)
+}
+
+func (self *FullTextIndex) loadStats(db *RockDB) error {
+	min := encodeFullTextIndexPrefix(ftDocDataType, self.Table, self.Name)
+	max := encodeFullTextIndexStopKey(ftDocDataType, self.Table, self.Name)
+	it, err := db.NewDBRangeIterator(min, max, common.RangeROpen, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	var docNum int64
+	var totalLen int64
+	for ; it.Valid(); it.Next() {
+		docLen, err := decodeFullTextDocLen(it.RefValue())
+		if err != nil {
+			continue
+		}
+		docNum++
+		totalLen += docLen
+	}
+	self.docNum = docNum
+	self.totalLen = totalLen
+	self.statsLoaded = true
+	return nil
+}
+
+// return the pk and term frequency for all the docs containing the term
+func (self *FullTextIndex) getPostings(db *RockDB, term string) (map[string]int64, error) {
+	min, err := encodeFullTextPostingKey(self.Table, self.Name, []byte(term), nil, false)
+	if err != nil {
+		return nil, err
+	}
+	max, err := encodeFullTextPostingKey(self.Table, self.Name, []byte(term), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	prefixLen := len(encodeFullTextIndexPrefix(ftPostingDataType, self.Table, self.Name))
+	it, err := db.NewDBRangeIterator(min, max, common.RangeROpen, false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	postings := make(map[string]int64)
+	for ; it.Valid(); it.Next() {
+		_, pk, err := decodeFullTextPostingKey(prefixLen, it.Key())
+		if err != nil {
+			continue
+		}
+		tf, n := binary.Uvarint(it.RefValue())
+		if n <= 0 {
+			continue
+		}
+		postings[string(pk)] = int64(tf)
+	}
+	return postings, nil
+}
+
+// FullTextSearchStats is the stats used for the BM25 score. The stats of all the
+// partitions can be merged to rank the search results of all the partitions
+// with the same idf and average doc length.
+type FullTextSearchStats struct {
+	DocNum   int64            `json:"doc_num"`
+	TotalLen int64            `json:"total_len"`
+	DocFreqs map[string]int64 `json:"doc_freqs"`
+}
+
+// Merge add the stats of other partition to this one
+func (self *FullTextSearchStats) Merge(other *FullTextSearchStats) {
+	if other == nil {
+		return
+	}
+	self.DocNum += other.DocNum
+	self.TotalLen += other.TotalLen
+	if self.DocFreqs == nil {
+		self.DocFreqs = make(map[string]int64, len(other.DocFreqs))
+	}
+	for t, df := range other.DocFreqs {
+		self.DocFreqs[t] += df
+	}
+}
+
+type ftTermPostings struct {
+	term     string
+	postings map[string]int64
+}
+
+// SearchRec return the docs matching all the terms in the query sorted by the BM25 score,
+// and the total number of the matched docs is also returned. The doc freq of the term
+// in the stats will be used for the idf if any, otherwise the local doc freq is used.
+func (self *FullTextIndex) SearchRec(db *RockDB, stats *FullTextSearchStats,
+	query []byte, offset int, limit int) (int64, []FullTextSearchResult, error) {
+	terms := tokenizeFullTextQuery(query)
+	if len(terms) == 0 {
+		return 0, nil, ErrFullTextQueryEmpty
+	}
+	postingList := make([]ftTermPostings, 0, len(terms))
+	for _, t := range terms {
+		postings, err := self.getPostings(db, t)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(postings) == 0 {
+			return 0, nil, nil
+		}
+		postingList = append(postingList, ftTermPostings{term: t, postings: postings})
+	}
+	// iterate the docs from the shortest postings to find the docs contain all terms
+	sort.Slice(postingList, func(i, j int) bool {
+		return len(postingList[i].postings) < len(postingList[j].postings)
+	})
+	avgLen := float64(1)
+	if stats.DocNum > 0 && stats.TotalLen > 0 {
+		avgLen = float64(stats.TotalLen) / float64(stats.DocNum)
+	}
+	idfs := make([]float64, len(postingList))
+	for i, tp := range postingList {
+		df := float64(len(tp.postings))
+		if gdf, ok := stats.DocFreqs[tp.term]; ok && float64(gdf) > df {
+			df = float64(gdf)
+		}
+		n := float64(stats.DocNum)
+		if n < df {
+			n = df
+		}
+		idfs[i] = math.Log(1 + (n-df+0.5)/(df+0.5))
+	}
+	results := make([]FullTextSearchResult, 0, len(postingList[0].postings))
+	for pk := range postingList[0].postings {
+		matched := true
+		for _, tp := range postingList[1:] {
+			if _, ok := tp.postings[pk]; !ok {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		v, err := db.GetBytes(encodeFullTextDocKey(self.Table, self.Name, []byte(pk)))
+		if err != nil || v == nil {
+			continue
+		}
+		docLen, err := decodeFullTextDocLen(v)
+		if err != nil {
+			continue
+		}
+		var score float64
+		for i, tp := range postingList {
+			tf := float64(tp.postings[pk])
+			score += idfs[i] * tf * (ftBM25K1 + 1) /
+				(tf + ftBM25K1*(1-ftBM25B+ftBM25B*float64(docLen)/avgLen))
+		}
+		results = append(results, FullTextSearchResult{PKey: []byte(pk), Score: score})
+	}
+	SortFullTextSearchResults(results)
+	total := int64(len(results))
+	if offset >= len(results) {
+		return total, nil, nil
+	}
+	results = results[offset:]
+	if limit >= 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return total, results, nil
+}
+
+// SortFullTextSearchResults sort the results by score desc, and the results with
+// the same score will be sorted by the key
+func SortFullTextSearchResults(results []FullTextSearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return bytes.Compare(results[i].PKey, results[j].PKey) < 0
+	})
+}
+
+func (self *FullTextIndex) cleanAll(db *RockDB, stopChan chan struct{}) error {
+	dbLog.Infof("begin clean full text index: %v-%v", string(self.Table), string(self.Name))
+
+	wb := db.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	for _, subType := range []byte{ftPostingDataType, ftDocDataType} {
+		min := encodeFullTextIndexPrefix(subType, self.Table, self.Name)
+		max := encodeFullTextIndexStopKey(subType, self.Table, self.Name)
+		wb.DeleteRange(min, max)
+	}
+
+	err := db.rockEng.Write(wb)
+	if err != nil {
+		dbLog.Infof("clean full text index %v, %v error: %v", string(self.Table), string(self.Name), err)
+	} else {
+		dbLog.Infof("clean full text index: %v-%v done", string(self.Table), string(self.Name))
+	}
+	return err
+}
+
+// update the full text indexes of the hash for the changed fields, the nil value
+// means the field is deleted, and the other indexed fields will be read from db.
+func (db *RockDB) hsetFullTextUpdate(tableIndexes *TableIndexContainer, hkey []byte,
+	fields [][]byte, values [][]byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil || len(fields) == 0 {
+		return nil
+	}
+	for _, index := range tableIndexes.GetFullTextIndexesNoLock() {
+		if len(index.HashFields) == 0 || !index.hasHashField(fields) {
+			continue
+		}
+		texts, err := db.HMget(hkey, index.HashFields...)
+		if err != nil {
+			return err
+		}
+		for i, hf := range index.HashFields {
+			for j, f := range fields {
+				if bytes.Equal(hf, f) {
+					texts[i] = values[j]
+				}
+			}
+		}
+		err = index.UpdateDoc(db, hkey, texts, wb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *RockDB) hsetFullTextRemove(tableIndexes *TableIndexContainer, hkey []byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil {
+		return nil
+	}
+	for _, index := range tableIndexes.GetFullTextIndexesNoLock() {
+		if len(index.HashFields) == 0 {
+			continue
+		}
+		err := index.RemoveDoc(db, hkey, wb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update the full text indexes of the json key using the new json data,
+// the nil data means the json key is deleted.
+func (db *RockDB) jsonFullTextUpdate(tableIndexes *TableIndexContainer, key []byte,
+	jdata []byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil {
+		return nil
+	}
+	for _, index := range tableIndexes.GetFullTextIndexesNoLock() {
+		if len(index.JsonPaths) == 0 {
+			continue
+		}
+		var texts [][]byte
+		if jdata != nil {
+			texts = getJSONFullTextValues(jdata, index.JsonPaths)
+		}
+		err := index.UpdateDoc(db, key, texts, wb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *RockDB) getFullTextIndexForSearch(table []byte) (*FullTextIndex, int64, int64, error) {
+	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
+	if tableIndexes == nil {
+		return nil, 0, 0, ErrIndexTableNotExist
+	}
+	tableIndexes.Lock()
+	defer tableIndexes.Unlock()
+	index := tableIndexes.GetFullTextIndexForSearchNoLock()
+	if index == nil {
+		return nil, 0, 0, ErrIndexNotExist
+	}
+	if !index.statsLoaded {
+		err := index.loadStats(db)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	return index, index.docNum, index.totalLen, nil
+}
+
+// FullTextIndexStats return the local stats of the full text index of the table for
+// the terms in the query, the stats of all the partitions should be merged and passed
+// to the search to get the scores comparable across the partitions.
+func (db *RockDB) FullTextIndexStats(table []byte, query []byte) (*FullTextSearchStats, error) {
+	terms := tokenizeFullTextQuery(query)
+	if len(terms) == 0 {
+		return nil, ErrFullTextQueryEmpty
+	}
+	index, docNum, totalLen, err := db.getFullTextIndexForSearch(table)
+	if err != nil {
+		return nil, err
+	}
+	stats := &FullTextSearchStats{
+		DocNum:   docNum,
+		TotalLen: totalLen,
+		DocFreqs: make(map[string]int64, len(terms)),
+	}
+	for _, t := range terms {
+		postings, err := index.getPostings(db, t)
+		if err != nil {
+			return nil, err
+		}
+		stats.DocFreqs[t] = int64(len(postings))
+	}
+	return stats, nil
+}
+
+// FullTextIndexSearch search the full text index of the table, the keys for the docs
+// matching all the terms in the query will be returned sorted by the BM25 score.
+// The global stats merged from all the partitions will be used for the score if not nil,
+// otherwise the local stats is used.
+func (db *RockDB) FullTextIndexSearch(table []byte, query []byte, global *FullTextSearchStats,
+	offset int, limit int) (int64, []FullTextSearchResult, error) {
+	index, docNum, totalLen, err := db.getFullTextIndexForSearch(table)
+	if err != nil {
+		return 0, nil, err
+	}
+	stats := global
+	if stats == nil {
+		stats = &FullTextSearchStats{DocNum: docNum, TotalLen: totalLen}
+	}
+	if dbLog.Level() >= common.LOG_DEBUG {
+		dbLog.Debugf("begin search full text index: %v-%v, %v, docs: %v",
+			string(table), string(index.Name), strings.TrimSpace(string(query)), stats.DocNum)
+	}
+	return index.SearchRec(db, stats, query, offset, limit)
+}
@@ -0,0 +1,263 @@
+package rockredis
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func waitFullTextIndexBuildDone(t *testing.T, db *RockDB, table string, name string) {
+	buildStart := time.Now()
+	for {
+		time.Sleep(time.Millisecond * 10)
+		tableIndexes := db.indexMgr.GetTableIndexes(table)
+		assert.NotNil(t, tableIndexes)
+		tableIndexes.Lock()
+		state := tableIndexes.fullTextIndexes[name].State
+		tableIndexes.Unlock()
+		if state == BuildDoneIndex {
+			break
+		} else if time.Since(buildStart) > time.Second*10 {
+			t.Errorf("building index timeout")
+			break
+		}
+	}
+}
+
+func TestFullTextTokenize(t *testing.T) {
+	terms, total := fullTextTermFreqs([][]byte{[]byte("Hello, World! hello-world2 中文"), []byte("a\xffb")})
+	assert.Equal(t, int64(8), total)
+	assert.Equal(t, map[string]int64{"hello": 2, "world": 1, "world2": 1, "中": 1, "文": 1, "a": 1, "b": 1}, terms)
+	assert.Equal(t, []string{"quick", "fox"}, tokenizeFullTextQuery([]byte(" Quick fox, quick!")))
+	assert.Equal(t, 0, len(tokenizeFullTextQuery([]byte("!@# $"))))
+}
+
+func TestHashFullTextIndexSearch(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := "test_ft"
+	doc1 := []byte(table + ":doc1")
+	doc2 := []byte(table + ":doc2")
+	doc3 := []byte(table + ":doc3")
+	// the data written before the index added should be indexed while building
+	err := db.HMset(0, doc1, common.KVRecord{Key: []byte("title"), Value: []byte("Hello World")},
+		common.KVRecord{Key: []byte("body"), Value: []byte("the quick brown fox")})
+	assert.Nil(t, err)
+	err = db.HMset(0, doc2, common.KVRecord{Key: []byte("title"), Value: []byte("hello")},
+		common.KVRecord{Key: []byte("body"), Value: []byte("lazy dog")},
+		common.KVRecord{Key: []byte("other"), Value: []byte("not indexed")})
+	assert.Nil(t, err)
+
+	ftindex := &common.FullTextIndexSchema{
+		Name:       "ft_index",
+		HashFields: []string{"title", "body"},
+		State:      common.InitIndex,
+	}
+	err = db.AddFullTextIndex(table, ftindex)
+	assert.Nil(t, err)
+	_, _, err = db.FullTextIndexSearch([]byte(table), []byte("hello"), nil, 0, -1)
+	assert.Equal(t, ErrIndexNotExist, err)
+	ftindex.State = common.BuildingIndex
+	err = db.UpdateFullTextIndexState(table, ftindex)
+	assert.Nil(t, err)
+	waitFullTextIndexBuildDone(t, db, table, ftindex.Name)
+
+	total, rets, err := db.FullTextIndexSearch([]byte(table), []byte("hello"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, 2, len(rets))
+	// the shorter doc should have the higher score
+	assert.Equal(t, doc2, rets[0].PKey)
+	assert.Equal(t, doc1, rets[1].PKey)
+	assert.True(t, rets[0].Score > rets[1].Score)
+
+	total, rets, err = db.FullTextIndexSearch([]byte(table), []byte("HELLO world"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, doc1, rets[0].PKey)
+	total, _, err = db.FullTextIndexSearch([]byte(table), []byte("indexed"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+	_, _, err = db.FullTextIndexSearch([]byte(table), []byte("!!"), nil, 0, -1)
+	assert.Equal(t, ErrFullTextQueryEmpty, err)
+
+	_, err = db.HSet(0, false, doc3, []byte("title"), []byte("你好世界 hello"))
+	assert.Nil(t, err)
+	total, rets, err = db.FullTextIndexSearch([]byte(table), []byte("世界"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, doc3, rets[0].PKey)
+	total, rets, err = db.FullTextIndexSearch([]byte(table), []byte("hello"), nil, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, 1, len(rets))
+
+	// update the field should remove the old terms
+	_, err = db.HSet(0, false, doc1, []byte("body"), []byte("slow turtle"))
+	assert.Nil(t, err)
+	total, _, err = db.FullTextIndexSearch([]byte(table), []byte("fox"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+	total, rets, err = db.FullTextIndexSearch([]byte(table), []byte("turtle"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, doc1, rets[0].PKey)
+
+	_, err = db.HDel(0, doc3, []byte("title"))
+	assert.Nil(t, err)
+	total, _, err = db.FullTextIndexSearch([]byte(table), []byte("世界"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+
+	_, err = db.HClear(0, doc1)
+	assert.Nil(t, err)
+	total, rets, err = db.FullTextIndexSearch([]byte(table), []byte("hello"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, doc2, rets[0].PKey)
+
+	ftindex.State = common.ReadyIndex
+	err = db.UpdateFullTextIndexState(table, ftindex)
+	assert.Nil(t, err)
+	schema, err := db.GetIndexSchema(table)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(schema.FullTextIndexes))
+	assert.Equal(t, ftindex.Name, schema.FullTextIndexes[0].Name)
+	assert.Equal(t, common.ReadyIndex, schema.FullTextIndexes[0].State)
+
+	ftindex.State = common.DeletedIndex
+	err = db.UpdateFullTextIndexState(table, ftindex)
+	assert.Nil(t, err)
+	_, _, err = db.FullTextIndexSearch([]byte(table), []byte("hello"), nil, 0, -1)
+	assert.NotNil(t, err)
+}
+
+func TestJSONFullTextIndexSearch(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := "test_ft_json"
+	key1 := []byte(table + ":1")
+	key2 := []byte(table + ":2")
+	_, err := db.JSet(0, key1, []byte(""), []byte(`{"name":"red apple","tags":["fruit","sweet"],"price":10}`))
+	assert.Nil(t, err)
+
+	ftindex := &common.FullTextIndexSchema{
+		Name:      "ft_json_index",
+		JSONPaths: []string{"name", "tags"},
+		State:     common.InitIndex,
+	}
+	err = db.AddFullTextIndex(table, ftindex)
+	assert.Nil(t, err)
+	ftindex.State = common.BuildingIndex
+	err = db.UpdateFullTextIndexState(table, ftindex)
+	assert.Nil(t, err)
+	waitFullTextIndexBuildDone(t, db, table, ftindex.Name)
+
+	_, err = db.JSet(0, key2, []byte(""), []byte(`{"name":"green apple","tags":["fruit","sour"]}`))
+	assert.Nil(t, err)
+	total, rets, err := db.FullTextIndexSearch([]byte(table), []byte("apple fruit"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, 2, len(rets))
+	total, rets, err = db.FullTextIndexSearch([]byte(table), []byte("sweet"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, key1, rets[0].PKey)
+	// the field not indexed should not be searched
+	total, _, err = db.FullTextIndexSearch([]byte(table), []byte("10"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+
+	_, err = db.JSet(0, key1, []byte("name"), []byte(`"yellow banana"`))
+	assert.Nil(t, err)
+	total, rets, err = db.FullTextIndexSearch([]byte(table), []byte("apple"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, key2, rets[0].PKey)
+
+	_, err = db.JDel(0, key2, []byte(""))
+	assert.Nil(t, err)
+	total, _, err = db.FullTextIndexSearch([]byte(table), []byte("apple"), nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), total)
+}
+
+func TestFullTextIndexSearchWithGlobalStats(t *testing.T) {
+	table := "test_ft_stats"
+	docs := []string{"hello world", "hello hello dog", "quick fox", "lazy dog jumps", "hello fox"}
+	newFullTextDB := func(docIndexes ...int) *RockDB {
+		db := getTestDB(t)
+		ftindex := &common.FullTextIndexSchema{
+			Name:       "ft_index",
+			HashFields: []string{"title"},
+			State:      common.InitIndex,
+		}
+		err := db.AddFullTextIndex(table, ftindex)
+		assert.Nil(t, err)
+		ftindex.State = common.BuildingIndex
+		err = db.UpdateFullTextIndexState(table, ftindex)
+		assert.Nil(t, err)
+		waitFullTextIndexBuildDone(t, db, table, ftindex.Name)
+		for _, i := range docIndexes {
+			err = db.HMset(0, []byte(table+":"+strconv.Itoa(i)),
+				common.KVRecord{Key: []byte("title"), Value: []byte(docs[i])})
+			assert.Nil(t, err)
+		}
+		return db
+	}
+	// all the docs in one db, and the docs splitted to two partitions
+	dbAll := newFullTextDB(0, 1, 2, 3, 4)
+	defer os.RemoveAll(dbAll.cfg.DataDir)
+	defer dbAll.Close()
+	db1 := newFullTextDB(0, 1)
+	defer os.RemoveAll(db1.cfg.DataDir)
+	defer db1.Close()
+	db2 := newFullTextDB(2, 3, 4)
+	defer os.RemoveAll(db2.cfg.DataDir)
+	defer db2.Close()
+
+	query := []byte("hello")
+	_, err := db1.FullTextIndexStats([]byte(table), []byte("!!"))
+	assert.Equal(t, ErrFullTextQueryEmpty, err)
+	statsAll, err := dbAll.FullTextIndexStats([]byte(table), query)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), statsAll.DocNum)
+	assert.Equal(t, map[string]int64{"hello": 3}, statsAll.DocFreqs)
+	var global FullTextSearchStats
+	for _, db := range []*RockDB{db1, db2} {
+		stats, err := db.FullTextIndexStats([]byte(table), query)
+		assert.Nil(t, err)
+		global.Merge(stats)
+	}
+	assert.Equal(t, *statsAll, global)
+
+	_, expected, err := dbAll.FullTextIndexSearch([]byte(table), query, nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(expected))
+	// the scores with the local stats are not comparable across the partitions
+	_, localRets, err := db1.FullTextIndexSearch([]byte(table), query, nil, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(localRets))
+	assert.NotEqual(t, expected[0].Score, localRets[0].Score)
+
+	merged := make([]FullTextSearchResult, 0)
+	for _, db := range []*RockDB{db1, db2} {
+		_, rets, err := db.FullTextIndexSearch([]byte(table), query, &global, 0, -1)
+		assert.Nil(t, err)
+		merged = append(merged, rets...)
+	}
+	SortFullTextSearchResults(merged)
+	assert.Equal(t, len(expected), len(merged))
+	for i := range expected {
+		assert.Equal(t, expected[i].PKey, merged[i].PKey)
+		assert.InDelta(t, expected[i].Score, merged[i].Score, 1e-9)
+	}
+}
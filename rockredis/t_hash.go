@@ -101,7 +101,7 @@ func hEncodeStopKey(table []byte, key []byte) []byte {
 
 // return if we create the new field or override it
 func (db *RockDB) hSetField(ts int64, checkNX bool, hkey []byte, field []byte, value []byte,
-	wb engine.WriteBatch, hindex *HsetIndex) (int64, error) {
+	wb engine.WriteBatch, tableIndexes *TableIndexContainer) (int64, error) {
 	created := int64(1)
 	keyInfo, err := db.prepareHashKeyForWrite(ts, hkey, field)
 	if err != nil {
@@ -119,7 +119,12 @@ func (db *RockDB) hSetField(ts int64, checkNX bool, hkey []byte, field []byte, v
 		if checkNX || bytes.Equal(oldV, value) {
 			return created, nil
 		}
-	} else {
+	}
+	err = db.hsetUniqueIndexCheck(tableIndexes, hkey, [][]byte{field}, [][]byte{value[:len(value)-tsLen]})
+	if err != nil {
+		return 0, err
+	}
+	if oldV == nil {
 		newNum, err := db.hIncrSize(hkey, keyInfo.OldHeader, 1, wb)
 		if err != nil {
 			return 0, err
@@ -137,16 +142,30 @@ func (db *RockDB) hSetField(ts int64, checkNX bool, hkey []byte, field []byte, v
 
 	wb.Put(ek, value)
 
-	if hindex != nil {
+	if tableIndexes == nil {
+		return created, nil
+	}
+	if hindex := tableIndexes.GetHIndexNoLock(string(field)); hindex != nil {
 		if len(oldV) >= tsLen {
 			oldV = oldV[:len(oldV)-tsLen]
 		}
-		err = hindex.UpdateRec(oldV, value[:len(value)-tsLen], hkey, wb)
+		err = hindex.UpdateRec(db, oldV, value[:len(value)-tsLen], hkey, wb)
 		if err != nil {
 			return created, err
 		}
 	}
-
+	err = db.hsetCompositeIndexUpdate(tableIndexes, hkey, [][]byte{field}, [][]byte{value[:len(value)-tsLen]}, wb)
+	if err != nil {
+		return created, err
+	}
+	err = db.hsetFullTextUpdate(tableIndexes, hkey, [][]byte{field}, [][]byte{value[:len(value)-tsLen]}, wb)
+	if err != nil {
+		return created, err
+	}
+	err = db.hsetColumnUpdate(tableIndexes, hkey, [][]byte{field}, [][]byte{value[:len(value)-tsLen]}, wb)
+	if err != nil {
+		return created, err
+	}
 	return created, nil
 }
 
@@ -194,12 +213,27 @@ func (db *RockDB) HSet(ts int64, checkNX bool, key []byte, field []byte, ovalue
 		return 0, err
 	}
 
+	if schema := db.indexMgr.GetTableSchema(string(table)); schema != nil {
+		// the default fields should be written together while creating the hash
+		args := []common.KVRecord{{Key: field, Value: ovalue}}
+		if fvs := schema.FillHashDefaults(args); len(fvs) > len(args) {
+			oldh, expired, err := db.hHeaderMeta(ts, key, false)
+			if err != nil {
+				return 0, err
+			}
+			if expired || oldh.UserData == nil {
+				if err := db.HMset(ts, key, fvs...); err != nil {
+					return 0, err
+				}
+				return 1, nil
+			}
+		}
+	}
+
 	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
-	var hindex *HsetIndex
 	if tableIndexes != nil {
 		tableIndexes.Lock()
 		defer tableIndexes.Unlock()
-		hindex = tableIndexes.GetHIndexNoLock(string(field))
 	}
 
 	var value []byte
@@ -209,7 +243,7 @@ func (db *RockDB) HSet(ts int64, checkNX bool, key []byte, field []byte, ovalue
 		value = db.writeTmpBuf[:len(ovalue)]
 	}
 	copy(value, ovalue)
-	created, err := db.hSetField(ts, checkNX, key, field, value, db.wb, hindex)
+	created, err := db.hSetField(ts, checkNX, key, field, value, db.wb, tableIndexes)
 	if err != nil {
 		return 0, err
 	}
@@ -238,6 +272,20 @@ func (db *RockDB) HMset(ts int64, key []byte, args ...common.KVRecord) error {
 	if tableIndexes != nil {
 		tableIndexes.Lock()
 		defer tableIndexes.Unlock()
+		if tableIndexes.tableSchema != nil && keyInfo.IsNotExistOrExpired() {
+			// the default fields should be written together while creating the hash
+			args = tableIndexes.tableSchema.FillHashDefaults(args)
+		}
+		fields := make([][]byte, 0, len(args))
+		values := make([][]byte, 0, len(args))
+		for _, arg := range args {
+			fields = append(fields, arg.Key)
+			values = append(values, arg.Value)
+		}
+		err = db.hsetUniqueIndexCheck(tableIndexes, key, fields, values)
+		if err != nil {
+			return err
+		}
 	}
 
 	var num int64
@@ -267,13 +315,33 @@ func (db *RockDB) HMset(ts int64, key []byte, args ...common.KVRecord) error {
 				if len(oldV) >= tsLen {
 					oldV = oldV[:len(oldV)-tsLen]
 				}
-				err = hindex.UpdateRec(oldV, value[:len(value)-tsLen], key, db.wb)
+				err = hindex.UpdateRec(db, oldV, value[:len(value)-tsLen], key, db.wb)
 				if err != nil {
 					return err
 				}
 			}
 		}
 	}
+	if tableIndexes != nil {
+		fields := make([][]byte, 0, len(args))
+		values := make([][]byte, 0, len(args))
+		for _, arg := range args {
+			fields = append(fields, arg.Key)
+			values = append(values, arg.Value)
+		}
+		err = db.hsetCompositeIndexUpdate(tableIndexes, key, fields, values, db.wb)
+		if err != nil {
+			return err
+		}
+		err = db.hsetFullTextUpdate(tableIndexes, key, fields, values, db.wb)
+		if err != nil {
+			return err
+		}
+		err = db.hsetColumnUpdate(tableIndexes, key, fields, values, db.wb)
+		if err != nil {
+			return err
+		}
+	}
 	newNum, err := db.hIncrSize(key, keyInfo.OldHeader, num, db.wb)
 	if err != nil {
 		return err
@@ -431,6 +499,7 @@ func (db *RockDB) HDel(ts int64, key []byte, args ...[]byte) (int64, error) {
 
 	var num int64 = 0
 	var newNum int64 = -1
+	var delFields [][]byte
 	for i := 0; i < len(args); i++ {
 		if err := checkKeySubKey(rk, args[i]); err != nil {
 			return 0, err
@@ -449,11 +518,26 @@ func (db *RockDB) HDel(ts int64, key []byte, args ...[]byte) (int64, error) {
 					if len(oldV) >= tsLen {
 						oldV = oldV[:len(oldV)-tsLen]
 					}
-					hindex.RemoveRec(oldV, key, wb)
+					hindex.RemoveRec(db, oldV, key, wb)
 				}
+				delFields = append(delFields, args[i])
 			}
 		}
 	}
+	if len(delFields) > 0 {
+		err = db.hsetCompositeIndexUpdate(tableIndexes, key, delFields, make([][]byte, len(delFields)), wb)
+		if err != nil {
+			return 0, err
+		}
+		err = db.hsetFullTextUpdate(tableIndexes, key, delFields, make([][]byte, len(delFields)), wb)
+		if err != nil {
+			return 0, err
+		}
+		err = db.hsetColumnUpdate(tableIndexes, key, delFields, make([][]byte, len(delFields)), wb)
+		if err != nil {
+			return 0, err
+		}
+	}
 
 	if newNum, err = db.hIncrSize(key, oldh, -num, wb); err != nil {
 		return 0, err
@@ -508,7 +592,7 @@ func (db *RockDB) hDeleteAll(ts int64, hkey []byte, hlen int64, wb engine.WriteB
 					if len(oldV) >= tsLen {
 						oldV = oldV[:len(oldV)-tsLen]
 					}
-					hindex.RemoveRec(oldV, hkey, wb)
+					hindex.RemoveRec(db, oldV, hkey, wb)
 				}
 			}
 		}
@@ -516,7 +600,15 @@ func (db *RockDB) hDeleteAll(ts int64, hkey []byte, hlen int64, wb engine.WriteB
 	if hlen > RangeDeleteNum {
 		wb.DeleteRange(start, stop)
 	}
-	return nil
+	err = db.hsetCompositeIndexRemove(tableIndexes, hkey, wb)
+	if err != nil {
+		return err
+	}
+	err = db.hsetFullTextRemove(tableIndexes, hkey, wb)
+	if err != nil {
+		return err
+	}
+	return db.hsetColumnRemove(tableIndexes, hkey, wb)
 }
 
 func (db *RockDB) HClear(ts int64, hkey []byte) (int64, error) {
@@ -609,13 +701,16 @@ func (db *RockDB) HIncrBy(ts int64, key []byte, field []byte, delta int64) (int6
 	if err != nil {
 		return 0, err
 	}
+	if fv == nil && db.indexMgr.GetTableSchema(string(table)) != nil {
+		// the default fields should be written if the hash is created
+		_, err = db.HSet(ts, false, key, field, FormatInt64ToSlice(delta))
+		return delta, err
+	}
 
 	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
-	var hindex *HsetIndex
 	if tableIndexes != nil {
 		tableIndexes.Lock()
 		defer tableIndexes.Unlock()
-		hindex = tableIndexes.GetHIndexNoLock(string(field))
 	}
 	wb := db.wb
 
@@ -631,7 +726,7 @@ func (db *RockDB) HIncrBy(ts int64, key []byte, field []byte, delta int64) (int6
 
 	n += delta
 
-	_, err = db.hSetField(ts, false, key, field, FormatInt64ToSlice(n), wb, hindex)
+	_, err = db.hSetField(ts, false, key, field, FormatInt64ToSlice(n), wb, tableIndexes)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,293 @@
+package rockredis
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+var (
+	errCompositeValueNum = errors.New("invalid value number for composite index")
+)
+
+// The composite index key is the concatenation of the memcmp encoded values of the
+// ordered fields, so the entries with the same leading field values are stored together.
+// table:indexname:v1,v2,...,sep,pk
+// The hash key will not be indexed if any field of the composite index is missing.
+
+func (self *HsetIndex) IsComposite() bool {
+	return len(self.CompositeFields) > 0
+}
+
+func (self *HsetIndex) compositeFieldNames() [][]byte {
+	fields := make([][]byte, 0, len(self.CompositeFields))
+	for _, f := range self.CompositeFields {
+		fields = append(fields, f.Field)
+	}
+	return fields
+}
+
+func (self *HsetIndex) hasCompositeField(fields [][]byte) bool {
+	for _, cf := range self.CompositeFields {
+		for _, f := range fields {
+			if bytes.Equal(cf.Field, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func encodeCompositeFieldValue(vt IndexPropertyDType, value []byte) (interface{}, error) {
+	if vt == Int64V || vt == Int32V {
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return nil, ErrIndexValueNotNumber
+		}
+		return n, nil
+	}
+	return value, nil
+}
+
+// convert the field values to the values for memcmp encoding,
+// nil will be returned if any field value is missing.
+func (self *HsetIndex) compositeEncodeValues(values [][]byte) ([]interface{}, error) {
+	if len(values) != len(self.CompositeFields) {
+		return nil, errCompositeValueNum
+	}
+	vals := make([]interface{}, 0, len(values)+2)
+	for i, v := range values {
+		if len(v) == 0 {
+			return nil, nil
+		}
+		ev, err := encodeCompositeFieldValue(self.CompositeFields[i].ValueType, v)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, ev)
+	}
+	return vals, nil
+}
+
+func (self *HsetIndex) encodeCompositeKey(vals []interface{}, pk []byte) ([]byte, error) {
+	tmpkey := encodeHsetIndexStartKey(self.dataType(), self.Table, self.Name)
+	vals = append(vals, int32(hindexStartSep), pk)
+	return EncodeMemCmpKey(tmpkey, vals...)
+}
+
+func (self *HsetIndex) decodeCompositeKey(rawKey []byte) ([]interface{}, []byte, error) {
+	prefix := encodeHsetIndexStartKey(self.dataType(), self.Table, self.Name)
+	if !bytes.HasPrefix(rawKey, prefix) {
+		return nil, nil, errHsetIndexKey
+	}
+	n := len(self.CompositeFields)
+	rets, err := Decode(rawKey[len(prefix):], n+2)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rets) != n+2 {
+		return nil, nil, errHsetIndexKey
+	}
+	pk, ok := rets[n+1].([]byte)
+	if !ok {
+		//for unique index, no pk key in index key
+		if rets[n+1] != nil {
+			return nil, nil, ErrIndexValueType
+		}
+		pk = nil
+	}
+	return rets[:n], pk, nil
+}
+
+func (self *HsetIndex) UpdateCompositeRec(db *RockDB, oldValues [][]byte, values [][]byte, pk []byte, wb engine.WriteBatch) error {
+	if self.State == DeletedIndex {
+		return nil
+	}
+	pkkey := pk
+	pkvalue := emptyValue
+	if self.Unique == 1 {
+		pkkey = nil
+		pkvalue = pk
+	}
+	var newKey []byte
+	if values != nil {
+		vals, err := self.compositeEncodeValues(values)
+		if err != nil {
+			return err
+		}
+		if vals != nil {
+			newKey, err = self.encodeCompositeKey(vals, pkkey)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if oldValues != nil {
+		// ignore the invalid old values since they are never indexed
+		vals, _ := self.compositeEncodeValues(oldValues)
+		if vals != nil {
+			oldKey, err := self.encodeCompositeKey(vals, pkkey)
+			if err == nil {
+				if bytes.Equal(oldKey, newKey) {
+					return nil
+				}
+				// the unique key owned by another pk should be kept
+				if self.Unique != 1 || self.isUniqueOwner(db, oldKey, pk) {
+					wb.Delete(oldKey)
+					self.markUniquePending(oldKey, nil)
+				}
+			}
+		}
+	}
+	if newKey != nil {
+		wb.Put(newKey, pkvalue)
+		self.markUniquePending(newKey, pk)
+	}
+	return nil
+}
+
+func (self *HsetIndex) RemoveCompositeRec(db *RockDB, oldValues [][]byte, pk []byte, wb engine.WriteBatch) {
+	self.UpdateCompositeRec(db, oldValues, nil, pk, wb)
+}
+
+// the prefix values are used as the equal condition for the leading fields and
+// the start and end key is the range for the next field.
+func (self *HsetIndex) searchCompositeRec(db *RockDB, cond *IndexCondition, countOnly bool) (int64, []HIndexResp, error) {
+	var n int64
+	pkList := make([]HIndexResp, 0, 32)
+	fieldNum := len(self.CompositeFields)
+	prefixNum := len(cond.PrefixValues)
+	if prefixNum > fieldNum {
+		return n, nil, errCompositeValueNum
+	}
+	hasRange := cond.StartKey != nil || cond.EndKey != nil
+	if prefixNum == fieldNum && hasRange {
+		return n, nil, errCompositeValueNum
+	}
+	vals := make([]interface{}, 0, prefixNum)
+	for i, v := range cond.PrefixValues {
+		ev, err := encodeCompositeFieldValue(self.CompositeFields[i].ValueType, v)
+		if err != nil {
+			return n, nil, err
+		}
+		vals = append(vals, ev)
+	}
+	base, err := EncodeMemCmpKey(encodeHsetIndexStartKey(self.dataType(), self.Table, self.Name), vals...)
+	if err != nil {
+		return n, nil, err
+	}
+	// the max flag is larger than any encoded value, so base+max is larger than
+	// all the keys prefixed by base
+	min := base
+	max, _ := EncodeMaxKey(append([]byte{}, base...))
+	if hasRange {
+		vt := self.CompositeFields[prefixNum].ValueType
+		if cond.StartKey != nil {
+			sv, err := encodeCompositeFieldValue(vt, cond.StartKey)
+			if err != nil {
+				return n, nil, err
+			}
+			min, err = EncodeMemCmpKey(append([]byte{}, base...), sv)
+			if err != nil {
+				return n, nil, err
+			}
+			if !cond.IncludeStart {
+				min, _ = EncodeMaxKey(min)
+			}
+		}
+		if cond.EndKey != nil {
+			ev, err := encodeCompositeFieldValue(vt, cond.EndKey)
+			if err != nil {
+				return n, nil, err
+			}
+			max, err = EncodeMemCmpKey(append([]byte{}, base...), ev)
+			if err != nil {
+				return n, nil, err
+			}
+			if cond.IncludeEnd {
+				max, _ = EncodeMaxKey(max)
+			}
+		}
+	}
+	if dbLog.Level() >= common.LOG_DEBUG {
+		dbLog.Debugf("begin search composite index: %v-%v-%v, %v~%v", string(self.Table), string(self.Name), string(self.IndexField), min, max)
+	}
+	it, err := db.NewDBRangeLimitIterator(min, max, common.RangeClose, cond.Offset, cond.Limit, false)
+	if err != nil {
+		return n, nil, err
+	}
+	defer it.Close()
+	lastVT := self.CompositeFields[fieldNum-1].ValueType
+	for ; it.Valid(); it.Next() {
+		n++
+		if countOnly {
+			continue
+		}
+		values, pk, err := self.decodeCompositeKey(it.Key())
+		if err != nil {
+			continue
+		}
+		if self.Unique == 1 {
+			pk = it.Value()
+		}
+		// the value of the last field is returned as the index value
+		resp := HIndexResp{PKey: pk, IndexValueType: lastVT}
+		switch lv := values[fieldNum-1].(type) {
+		case int64:
+			resp.IndexIntValue = lv
+		case []byte:
+			resp.IndexValue = lv
+		}
+		pkList = append(pkList, resp)
+	}
+	return n, pkList, nil
+}
+
+// update the composite indexes which contain any of the changed fields,
+// the nil value means the field is deleted.
+func (db *RockDB) hsetCompositeIndexUpdate(tableIndexes *TableIndexContainer, hkey []byte,
+	fields [][]byte, values [][]byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil || len(fields) == 0 {
+		return nil
+	}
+	for _, index := range tableIndexes.GetCompositeHIndexesNoLock() {
+		if !index.hasCompositeField(fields) {
+			continue
+		}
+		oldValues, err := db.HMget(hkey, index.compositeFieldNames()...)
+		if err != nil {
+			return err
+		}
+		newValues := make([][]byte, len(oldValues))
+		copy(newValues, oldValues)
+		for i, cf := range index.CompositeFields {
+			for j, f := range fields {
+				if bytes.Equal(cf.Field, f) {
+					newValues[i] = values[j]
+				}
+			}
+		}
+		err = index.UpdateCompositeRec(db, oldValues, newValues, hkey, wb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *RockDB) hsetCompositeIndexRemove(tableIndexes *TableIndexContainer, hkey []byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil {
+		return nil
+	}
+	for _, index := range tableIndexes.GetCompositeHIndexesNoLock() {
+		oldValues, err := db.HMget(hkey, index.compositeFieldNames()...)
+		if err != nil {
+			return err
+		}
+		index.RemoveCompositeRec(db, oldValues, hkey, wb)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// the expire time for the fields in the hash is stored in the exp table
+// using the data type HFieldExpType, the meta value will store the expire time in milliseconds
+// and the write timestamp of the field value. If the field is overwritten after the
+// expire is set, the write timestamp will be changed and the ttl of the field
+// will be treated as removed.
+// Note: the expired fields will be removed by the ttl checker, so it may be
+// still readable for a while after expired.
+
+var (
+	errHFieldExpKey  = errors.New("invalid hash field expire key")
+	errHFieldExpMeta = errors.New("invalid hash field expire meta")
+)
+
+const hfieldExpMetaLen = 8 + 8
+
+/*
+the coded format of the hash field key in the exp table:
+bytes:  -0-1-|-2----------x-|-x+1-------y-|
+data :  keylen|     key     |    field    |
+*/
+func hfEncodeExpKey(key []byte, field []byte) []byte {
+	buf := make([]byte, 2+len(key)+len(field))
+	binary.BigEndian.PutUint16(buf, uint16(len(key)))
+	copy(buf[2:], key)
+	copy(buf[2+len(key):], field)
+	return buf
+}
+
+func hfDecodeExpKey(fk []byte) ([]byte, []byte, error) {
+	if len(fk) < 2 {
+		return nil, nil, errHFieldExpKey
+	}
+	keyLen := int(binary.BigEndian.Uint16(fk))
+	if 2+keyLen > len(fk) {
+		return nil, nil, errHFieldExpKey
+	}
+	return fk[2 : 2+keyLen], fk[2+keyLen:], nil
+}
+
+func hfEncodeExpMeta(expireAtMs int64, fieldTs int64) []byte {
+	buf := make([]byte, hfieldExpMetaLen)
+	binary.BigEndian.PutUint64(buf, uint64(expireAtMs))
+	binary.BigEndian.PutUint64(buf[8:], uint64(fieldTs))
+	return buf
+}
+
+func hfDecodeExpMeta(v []byte) (int64, int64, error) {
+	if len(v) != hfieldExpMetaLen {
+		return 0, 0, errHFieldExpMeta
+	}
+	return int64(binary.BigEndian.Uint64(v)), int64(binary.BigEndian.Uint64(v[8:])), nil
+}
+
+// the exp table is checked in seconds, so we round up to make sure the field is
+// removed after the expire time
+func hfExpireSeconds(expireAtMs int64) int64 {
+	return (expireAtMs + int64(time.Second/time.Millisecond) - 1) / int64(time.Second/time.Millisecond)
+}
+
+// the write timestamp of the field is appended to the raw field value
+func hfieldWriteTs(rawV []byte) int64 {
+	if len(rawV) < tsLen {
+		return 0
+	}
+	ts, _ := Int64(rawV[len(rawV)-tsLen:], nil)
+	return ts
+}
+
+// return the field expire meta if the ttl is still valid for the current field value
+func (db *RockDB) hfieldExpMeta(mk []byte, rawV []byte, useLock bool) (int64, bool, error) {
+	var metaV []byte
+	var err error
+	if useLock {
+		metaV, err = db.GetBytes(mk)
+	} else {
+		metaV, err = db.GetBytesNoLock(mk)
+	}
+	if err != nil || metaV == nil {
+		return 0, false, err
+	}
+	expireAt, fieldTs, err := hfDecodeExpMeta(metaV)
+	if err != nil {
+		return 0, false, err
+	}
+	return expireAt, fieldTs == hfieldWriteTs(rawV), nil
+}
+
+// HFieldPExpire set the expire duration in milliseconds for the fields in hash, for each field return
+// -2 if the field not exist, 1 if the expire is set, 2 if the field is deleted since the
+// duration is not positive
+func (db *RockDB) HFieldPExpire(ts int64, key []byte, duration int64, fields ...[]byte) ([]int64, error) {
+	if len(fields) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	expireAt := ts/int64(time.Millisecond) + duration
+	if duration > 0 && (expireAt < 0 || hfExpireSeconds(expireAt) >= int64(math.MaxUint32-1)) {
+		return nil, errExpOverflow
+	}
+	rets := make([]int64, len(fields))
+	delFields := make([][]byte, 0)
+	wb := db.wb
+	for i, field := range fields {
+		rawV, err := db.hGetRawFieldValue(ts, key, field, true, false)
+		if err != nil {
+			return nil, err
+		}
+		if rawV == nil {
+			rets[i] = -2
+			continue
+		}
+		fk := hfEncodeExpKey(key, field)
+		mk := expEncodeMetaKey(HFieldExpType, fk)
+		oldMeta, err := db.GetBytesNoLock(mk)
+		if err != nil {
+			return nil, err
+		}
+		if oldExpireAt, _, err := hfDecodeExpMeta(oldMeta); err == nil {
+			wb.Delete(expEncodeTimeKey(HFieldExpType, fk, hfExpireSeconds(oldExpireAt)))
+		}
+		if duration <= 0 {
+			wb.Delete(mk)
+			delFields = append(delFields, field)
+			rets[i] = 2
+			continue
+		}
+		when := hfExpireSeconds(expireAt)
+		wb.Put(expEncodeTimeKey(HFieldExpType, fk, when), mk)
+		wb.Put(mk, hfEncodeExpMeta(expireAt, hfieldWriteTs(rawV)))
+		db.setNextCheckTime(when, false)
+		rets[i] = 1
+	}
+	if len(delFields) > 0 {
+		_, err := db.HDel(ts, key, delFields...)
+		return rets, err
+	}
+	err := db.MaybeCommitBatch()
+	return rets, err
+}
+
+// HFieldPTTL return the ttl in milliseconds for the fields in hash, for each field return
+// -2 if the field not exist (or already expired), -1 if the field has no ttl
+func (db *RockDB) HFieldPTTL(key []byte, fields ...[]byte) ([]int64, error) {
+	if len(fields) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	tn := time.Now().UnixNano()
+	rets := make([]int64, len(fields))
+	for i, field := range fields {
+		rawV, err := db.hGetRawFieldValue(tn, key, field, true, true)
+		if err != nil {
+			return nil, err
+		}
+		if rawV == nil {
+			rets[i] = -2
+			continue
+		}
+		mk := expEncodeMetaKey(HFieldExpType, hfEncodeExpKey(key, field))
+		expireAt, valid, err := db.hfieldExpMeta(mk, rawV, true)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
+			rets[i] = -1
+			continue
+		}
+		left := expireAt - tn/int64(time.Millisecond)
+		if left <= 0 {
+			rets[i] = -2
+		} else {
+			rets[i] = left
+		}
+	}
+	return rets, nil
+}
+
+// HFieldTTL is the same as HFieldPTTL but the ttl is in seconds
+func (db *RockDB) HFieldTTL(key []byte, fields ...[]byte) ([]int64, error) {
+	rets, err := db.HFieldPTTL(key, fields...)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range rets {
+		if v > 0 {
+			rets[i] = (v + 500) / int64(time.Second/time.Millisecond)
+		}
+	}
+	return rets, nil
+}
+
+// HFieldPersist remove the ttl for the fields in hash, for each field return
+// -2 if the field not exist, -1 if the field has no ttl, 1 if the ttl is removed
+func (db *RockDB) HFieldPersist(ts int64, key []byte, fields ...[]byte) ([]int64, error) {
+	if len(fields) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	rets := make([]int64, len(fields))
+	wb := db.wb
+	for i, field := range fields {
+		rawV, err := db.hGetRawFieldValue(ts, key, field, true, false)
+		if err != nil {
+			return nil, err
+		}
+		if rawV == nil {
+			rets[i] = -2
+			continue
+		}
+		fk := hfEncodeExpKey(key, field)
+		mk := expEncodeMetaKey(HFieldExpType, fk)
+		expireAt, valid, err := db.hfieldExpMeta(mk, rawV, false)
+		if err != nil {
+			return nil, err
+		}
+		rets[i] = -1
+		if expireAt > 0 {
+			// the stale ttl for the overwritten field can be removed too
+			wb.Delete(expEncodeTimeKey(HFieldExpType, fk, hfExpireSeconds(expireAt)))
+			wb.Delete(mk)
+			if valid {
+				rets[i] = 1
+			}
+		}
+	}
+	err := db.MaybeCommitBatch()
+	return rets, err
+}
+
+// delete the expired hash field found by the ttl checker, the field will be deleted only if
+// the expire meta still matches the time key and the field is not overwritten after the expire is set.
+// It is called outside raft, so it should hold the apply lock to avoid updating the
+// hash size and indexes concurrently with the raft apply.
+func (db *RockDB) hDelExpiredField(tk []byte, mk []byte, fk []byte, wb engine.WriteBatch) error {
+	db.LockApply()
+	defer db.UnlockApply()
+	defer wb.Clear()
+	_, _, when, err := expDecodeTimeKey(tk)
+	if err != nil {
+		return err
+	}
+	hkey, field, err := hfDecodeExpKey(fk)
+	if err != nil {
+		return err
+	}
+	wb.Delete(tk)
+	metaV, err := db.GetBytes(mk)
+	if err != nil {
+		return err
+	}
+	expireAt, fieldTs, err := hfDecodeExpMeta(metaV)
+	if err != nil || hfExpireSeconds(expireAt) != when {
+		// the ttl of field has been changed or removed
+		return db.rockEng.Write(wb)
+	}
+	wb.Delete(mk)
+
+	keyInfo, err := db.GetCollVersionKey(0, HashType, hkey, true)
+	if err != nil {
+		return err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return db.rockEng.Write(wb)
+	}
+	table := keyInfo.Table
+	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
+	if tableIndexes != nil {
+		tableIndexes.Lock()
+		defer tableIndexes.Unlock()
+	}
+	ek := hEncodeHashKey(table, keyInfo.VerKey, field)
+	oldV, err := db.GetBytes(ek)
+	if err != nil {
+		return err
+	}
+	if oldV == nil || hfieldWriteTs(oldV) != fieldTs {
+		return db.rockEng.Write(wb)
+	}
+	wb.Delete(ek)
+	if tableIndexes != nil {
+		if hindex := tableIndexes.GetHIndexNoLock(string(field)); hindex != nil {
+			hindex.RemoveRec(db, oldV[:len(oldV)-tsLen], hkey, wb)
+		}
+		err = db.hsetCompositeIndexUpdate(tableIndexes, hkey, [][]byte{field}, [][]byte{nil}, wb)
+		if err != nil {
+			return err
+		}
+		err = db.hsetFullTextUpdate(tableIndexes, hkey, [][]byte{field}, [][]byte{nil}, wb)
+		if err != nil {
+			return err
+		}
+		err = db.hsetColumnUpdate(tableIndexes, hkey, [][]byte{field}, [][]byte{nil}, wb)
+		if err != nil {
+			return err
+		}
+	}
+	newNum, err := db.hIncrSize(hkey, keyInfo.OldHeader, -1, wb)
+	if err != nil {
+		return err
+	}
+	if newNum == 0 {
+		db.IncrTableKeyCount(table, -1, wb)
+		db.delExpire(HashType, hkey, nil, false, wb)
+	}
+	db.topLargeCollKeys.Update(hkey, int(newNum))
+	return db.rockEng.Write(wb)
+}
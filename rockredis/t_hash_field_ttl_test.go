@@ -0,0 +1,154 @@
+package rockredis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func runTTLCheckerOnce(t *testing.T, db *RockDB) {
+	var checker *TTLChecker
+	switch exp := db.expiration.(type) {
+	case *localExpiration:
+		checker = exp.TTLChecker
+	case *compactExpiration:
+		checker = exp.localExp.TTLChecker
+	}
+	buf := newLocalBatchedBuffer(db, 100)
+	defer buf.Destroy()
+	err := checker.check(buf, make(chan struct{}))
+	assert.Nil(t, err)
+	buf.commit()
+}
+
+func TestHashFieldTTL(t *testing.T) {
+	policies := []common.ExpirationPolicy{common.LocalDeletion, common.WaitCompact}
+	for _, p := range policies {
+		testHashFieldTTL(t, p)
+	}
+}
+
+func testHashFieldTTL(t *testing.T, policy common.ExpirationPolicy) {
+	db := getTestDBWithExpirationPolicy(t, policy)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_hash_field_ttl")
+	f0 := []byte("f0")
+	f1 := []byte("f1")
+	f2 := []byte("f2")
+	fNotExist := []byte("f_not_exist")
+	tn := time.Now().UnixNano()
+	err := db.HMset(tn, key, common.KVRecord{Key: f0, Value: []byte("v0")},
+		common.KVRecord{Key: f1, Value: []byte("v1")},
+		common.KVRecord{Key: f2, Value: []byte("v2")})
+	assert.Nil(t, err)
+
+	rets, err := db.HFieldPExpire(tn, key, 1000, f0, f1, f2, fNotExist)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 1, 1, -2}, rets)
+
+	rets, err = db.HFieldPTTL(key, f0, fNotExist)
+	assert.Nil(t, err)
+	assert.True(t, rets[0] > 0 && rets[0] <= 1000, rets)
+	assert.Equal(t, int64(-2), rets[1])
+
+	// persist field f1 and overwrite field f2 should remove the ttl
+	rets, err = db.HFieldPersist(tn, key, f1, fNotExist)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, -2}, rets)
+	rets, err = db.HFieldPersist(tn, key, f1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{-1}, rets)
+	_, err = db.HSet(tn+1, false, key, f2, []byte("v2_new"))
+	assert.Nil(t, err)
+	rets, err = db.HFieldTTL(key, f0, f1, f2)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, -1, -1}, rets)
+
+	// not expired yet
+	runTTLCheckerOnce(t, db)
+	n, err := db.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+
+	time.Sleep(time.Second * 2)
+	runTTLCheckerOnce(t, db)
+	n, err = db.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	v, err := db.HGet(key, f0)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	v, err = db.HGet(key, f2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2_new"), v)
+
+	// expire with non-positive duration will delete the field
+	rets, err = db.HFieldPExpire(tn, key, 0, f1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2}, rets)
+	tn = time.Now().UnixNano()
+	rets, err = db.HFieldPExpire(tn, key, 10, f2)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1}, rets)
+	time.Sleep(time.Second * 2)
+	runTTLCheckerOnce(t, db)
+	n, err = db.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.HKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.GetTableKeyCount([]byte("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestHashFieldTTLWithBatchApply(t *testing.T) {
+	db := getTestDBWithExpirationPolicy(t, common.LocalDeletion)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_hash_field_ttl_batch")
+	tn := time.Now().UnixNano()
+	err := db.HMset(tn, key, common.KVRecord{Key: []byte("f0"), Value: []byte("v0")},
+		common.KVRecord{Key: []byte("f1"), Value: []byte("v1")})
+	assert.Nil(t, err)
+	rets, err := db.HFieldPExpire(tn, key, 10, []byte("f0"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1}, rets)
+	time.Sleep(time.Second * 2)
+
+	// the expired field deletion should wait the pending batch committed
+	err = db.BeginBatchWrite()
+	assert.Nil(t, err)
+	err = db.HMset(tn+1, key, common.KVRecord{Key: []byte("f2"), Value: []byte("v2")})
+	assert.Nil(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runTTLCheckerOnce(t, db)
+	}()
+	select {
+	case <-done:
+		t.Fatal("the expired field deleted while the batch is not committed")
+	case <-time.After(time.Millisecond * 100):
+	}
+	err = db.CommitBatchWrite()
+	assert.Nil(t, err)
+	<-done
+
+	n, err := db.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	v, err := db.HGet(key, []byte("f0"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	v, err = db.HGet(key, []byte("f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), v)
+}
@@ -20,17 +20,18 @@ var (
 	ErrIndexDeleted        = errors.New("index is deleted")
 	ErrIndexValueNotNumber = errors.New("invalid value for number")
 	ErrIndexValueType      = errors.New("invalid index value type")
+	ErrIndexUniqueConflict = errors.New("duplicate value for unique index")
 	errHsetIndexKey        = errors.New("invalid hset index key")
 	emptyValue             = []byte("")
 )
 
-func encodeHsetIndexNumberKey(table []byte, indexName []byte,
+func encodeHsetIndexNumberKey(dt byte, table []byte, indexName []byte,
 	indexValue int64, pk []byte, stopKey bool) ([]byte, error) {
 	tmpkey := make([]byte, 2+2+len(table)+1+2+len(indexName)+1)
 	pos := 0
 	tmpkey[pos] = IndexDataType
 	pos++
-	tmpkey[pos] = hsetIndexDataType
+	tmpkey[pos] = dt
 	pos++
 
 	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
@@ -56,13 +57,13 @@ func encodeHsetIndexNumberKey(table []byte, indexName []byte,
 	return tmpkey, err
 }
 
-func encodeHsetIndexStringKey(table []byte, indexName []byte,
+func encodeHsetIndexStringKey(dt byte, table []byte, indexName []byte,
 	indexValue []byte, pk []byte, stopKey bool) ([]byte, error) {
 	tmpkey := make([]byte, 2+2+len(table)+1+2+len(indexName)+1)
 	pos := 0
 	tmpkey[pos] = IndexDataType
 	pos++
-	tmpkey[pos] = hsetIndexDataType
+	tmpkey[pos] = dt
 	pos++
 	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
 	pos += 2
@@ -85,12 +86,12 @@ func encodeHsetIndexStringKey(table []byte, indexName []byte,
 	return tmpkey, err
 }
 
-func decodeHsetIndexNumberKey(rawKey []byte) ([]byte, []byte, int64, []byte, error) {
+func decodeHsetIndexNumberKey(dt byte, rawKey []byte) ([]byte, []byte, int64, []byte, error) {
 	pos := 0
 	if len(rawKey) < pos+2+2+1+2+1 {
 		return nil, nil, 0, nil, errHsetIndexKey
 	}
-	if rawKey[0] != IndexDataType || rawKey[1] != hsetIndexDataType {
+	if rawKey[0] != IndexDataType || rawKey[1] != dt {
 		return nil, nil, 0, nil, errHsetIndexKey
 	}
 	pos += 2
@@ -137,12 +138,12 @@ func decodeHsetIndexNumberKey(rawKey []byte) ([]byte, []byte, int64, []byte, err
 	return table, indexName, iv, pk, err
 }
 
-func decodeHsetIndexStringKey(rawKey []byte) ([]byte, []byte, []byte, []byte, error) {
+func decodeHsetIndexStringKey(dt byte, rawKey []byte) ([]byte, []byte, []byte, []byte, error) {
 	pos := 0
 	if len(rawKey) < pos+2+2+1+2+1 {
 		return nil, nil, nil, nil, errHsetIndexKey
 	}
-	if rawKey[0] != IndexDataType || rawKey[1] != hsetIndexDataType {
+	if rawKey[0] != IndexDataType || rawKey[1] != dt {
 		return nil, nil, nil, nil, errHsetIndexKey
 	}
 	pos += 2
@@ -189,12 +190,12 @@ func decodeHsetIndexStringKey(rawKey []byte) ([]byte, []byte, []byte, []byte, er
 	return table, indexName, indexValue, pk, nil
 }
 
-func encodeHsetIndexStartKey(table []byte, indexName []byte) []byte {
+func encodeHsetIndexStartKey(dt byte, table []byte, indexName []byte) []byte {
 	tmpkey := make([]byte, 2+2+len(table)+1+2+len(indexName)+1)
 	pos := 0
 	tmpkey[pos] = IndexDataType
 	pos++
-	tmpkey[pos] = hsetIndexDataType
+	tmpkey[pos] = dt
 	pos++
 
 	binary.BigEndian.PutUint16(tmpkey[pos:], uint16(len(table)))
@@ -211,38 +212,38 @@ func encodeHsetIndexStartKey(table []byte, indexName []byte) []byte {
 	return tmpkey
 }
 
-func encodeHsetIndexStopKey(table []byte, indexName []byte) []byte {
-	k := encodeHsetIndexStartKey(table, indexName)
+func encodeHsetIndexStopKey(dt byte, table []byte, indexName []byte) []byte {
+	k := encodeHsetIndexStartKey(dt, table, indexName)
 	k[len(k)-1] = k[len(k)-1] + 1
 	return k
 }
 
-func encodeHsetIndexNumberStartKey(table []byte, indexName []byte, indexValue int64) ([]byte, error) {
-	return encodeHsetIndexNumberKey(table, indexName, indexValue, nil, false)
+func encodeHsetIndexNumberStartKey(dt byte, table []byte, indexName []byte, indexValue int64) ([]byte, error) {
+	return encodeHsetIndexNumberKey(dt, table, indexName, indexValue, nil, false)
 }
 
-func encodeHsetIndexNumberStopKey(table []byte, indexName []byte, indexValue int64) ([]byte, error) {
-	k, err := encodeHsetIndexNumberKey(table, indexName, indexValue, nil, true)
+func encodeHsetIndexNumberStopKey(dt byte, table []byte, indexName []byte, indexValue int64) ([]byte, error) {
+	k, err := encodeHsetIndexNumberKey(dt, table, indexName, indexValue, nil, true)
 	if err != nil {
 		return nil, err
 	}
 	return k, nil
 }
 
-func encodeHsetIndexStringStartKey(table []byte, indexName []byte, indexValue []byte) ([]byte, error) {
-	return encodeHsetIndexStringKey(table, indexName, indexValue, nil, false)
+func encodeHsetIndexStringStartKey(dt byte, table []byte, indexName []byte, indexValue []byte) ([]byte, error) {
+	return encodeHsetIndexStringKey(dt, table, indexName, indexValue, nil, false)
 }
 
-func encodeHsetIndexStringStopKey(table []byte, indexName []byte, indexValue []byte) ([]byte, error) {
-	k, err := encodeHsetIndexStringKey(table, indexName, indexValue, nil, true)
+func encodeHsetIndexStringStopKey(dt byte, table []byte, indexName []byte, indexValue []byte) ([]byte, error) {
+	k, err := encodeHsetIndexStringKey(dt, table, indexName, indexValue, nil, true)
 	if err != nil {
 		return nil, err
 	}
 	return k, nil
 }
 
-func hsetIndexAddNumberRec(table []byte, indexName []byte, indexValue int64, pk []byte, pkvalue []byte, wb engine.WriteBatch) error {
-	dbkey, err := encodeHsetIndexNumberKey(table, indexName, indexValue, pk, false)
+func hsetIndexAddNumberRec(dt byte, table []byte, indexName []byte, indexValue int64, pk []byte, pkvalue []byte, wb engine.WriteBatch) error {
+	dbkey, err := encodeHsetIndexNumberKey(dt, table, indexName, indexValue, pk, false)
 	if err != nil {
 		return err
 	}
@@ -250,8 +251,8 @@ func hsetIndexAddNumberRec(table []byte, indexName []byte, indexValue int64, pk
 	return nil
 }
 
-func hsetIndexRemoveNumberRec(table []byte, indexName []byte, indexValue int64, pk []byte, wb engine.WriteBatch) error {
-	dbkey, err := encodeHsetIndexNumberKey(table, indexName, indexValue, pk, false)
+func hsetIndexRemoveNumberRec(dt byte, table []byte, indexName []byte, indexValue int64, pk []byte, wb engine.WriteBatch) error {
+	dbkey, err := encodeHsetIndexNumberKey(dt, table, indexName, indexValue, pk, false)
 	if err != nil {
 		return err
 	}
@@ -259,8 +260,8 @@ func hsetIndexRemoveNumberRec(table []byte, indexName []byte, indexValue int64,
 	return nil
 }
 
-func hsetIndexAddStringRec(table []byte, indexName []byte, indexValue []byte, pk []byte, pkvalue []byte, wb engine.WriteBatch) error {
-	dbkey, err := encodeHsetIndexStringKey(table, indexName, indexValue, pk, false)
+func hsetIndexAddStringRec(dt byte, table []byte, indexName []byte, indexValue []byte, pk []byte, pkvalue []byte, wb engine.WriteBatch) error {
+	dbkey, err := encodeHsetIndexStringKey(dt, table, indexName, indexValue, pk, false)
 	if err != nil {
 		return err
 	}
@@ -268,8 +269,8 @@ func hsetIndexAddStringRec(table []byte, indexName []byte, indexValue []byte, pk
 	return nil
 }
 
-func hsetIndexRemoveStringRec(table []byte, indexName []byte, indexValue []byte, pk []byte, wb engine.WriteBatch) error {
-	dbkey, err := encodeHsetIndexStringKey(table, indexName, indexValue, pk, false)
+func hsetIndexRemoveStringRec(dt byte, table []byte, indexName []byte, indexValue []byte, pk []byte, wb engine.WriteBatch) error {
+	dbkey, err := encodeHsetIndexStringKey(dt, table, indexName, indexValue, pk, false)
 	if err != nil {
 		return err
 	}
@@ -291,12 +292,12 @@ func (db *RockDB) hsetIndexAddFieldRecs(pk []byte, fieldList [][]byte, valueList
 			continue
 		}
 
-		err = hindex.UpdateRec(nil, valueList[i], pk, wb)
+		err = hindex.UpdateRec(db, nil, valueList[i], pk, wb)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	return db.hsetCompositeIndexUpdate(db.indexMgr.GetTableIndexes(string(table)), pk, fieldList, valueList, wb)
 }
 
 func (db *RockDB) hsetIndexUpdateFieldRecs(pk []byte, fieldList [][]byte, valueList [][]byte, wb engine.WriteBatch) error {
@@ -317,12 +318,13 @@ func (db *RockDB) hsetIndexUpdateFieldRecs(pk []byte, fieldList [][]byte, valueL
 		if err != nil {
 			continue
 		}
-		err = hindex.UpdateRec(oldvalues[i], valueList[i], pk, wb)
+		err = hindex.UpdateRec(db, oldvalues[i], valueList[i], pk, wb)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	// the composite index should be updated if any member field is changed
+	return db.hsetCompositeIndexUpdate(db.indexMgr.GetTableIndexes(string(table)), pk, fieldList, valueList, wb)
 }
 
 func (db *RockDB) hsetIndexAddRec(pk []byte, field []byte, value []byte, wb engine.WriteBatch) error {
@@ -336,7 +338,7 @@ func (db *RockDB) hsetIndexAddRec(pk []byte, field []byte, value []byte, wb engi
 		return err
 	}
 
-	return hindex.UpdateRec(nil, value, pk, wb)
+	return hindex.UpdateRec(db, nil, value, pk, wb)
 }
 
 func (db *RockDB) hsetIndexUpdateRec(pk []byte, field []byte, value []byte, wb engine.WriteBatch) error {
@@ -355,7 +357,7 @@ func (db *RockDB) hsetIndexUpdateRec(pk []byte, field []byte, value []byte, wb e
 		return err
 	}
 
-	return hindex.UpdateRec(oldvalue, value, pk, wb)
+	return hindex.UpdateRec(db, oldvalue, value, pk, wb)
 }
 
 func (self *RockDB) hsetIndexRemoveRec(pk []byte, field []byte, value []byte, wb engine.WriteBatch) error {
@@ -368,7 +370,7 @@ func (self *RockDB) hsetIndexRemoveRec(pk []byte, field []byte, value []byte, wb
 	if err != nil {
 		return err
 	}
-	hindex.RemoveRec(value, pk, wb)
+	hindex.RemoveRec(self, value, pk, wb)
 	return nil
 }
 
@@ -386,8 +388,8 @@ func (db *RockDB) HsetIndexSearch(table []byte, field []byte, cond *IndexConditi
 	return hindex.ValueType, n, ret, err
 }
 
-// TODO: handle IN, LIKE, NOT equal condition in future
-// handle index condition combine (AND, OR)
+// IndexCondition is the range condition for one index scan, the IN, LIKE and NOT equal
+// conditions are planned to the range scans and filters in HsetIndexQuery
 type IndexCondition struct {
 	StartKey     []byte
 	IncludeStart bool
@@ -396,56 +398,104 @@ type IndexCondition struct {
 	Offset       int
 	PKOffset     []byte
 	Limit        int
+	// only for the composite index, the equal values for the leading fields,
+	// and the StartKey and EndKey is the range for the next field.
+	PrefixValues [][]byte
 }
 
 type HIndexResp struct {
 	PKey          []byte
 	IndexValue    []byte
 	IndexIntValue int64
+	// the value type of the index this result comes from
+	IndexValueType IndexPropertyDType
 }
 
 type HsetIndex struct {
 	Table []byte
 	HsetIndexInfo
+	// the data type in the index key, the json index shares the same
+	// key layout with the hash index
+	indexDataType byte
+	// the unique keys changed in the uncommitted batched write
+	uniquePending *uniquePendingKeys
+}
+
+func (self *HsetIndex) dataType() byte {
+	if self.indexDataType == 0 {
+		return hsetIndexDataType
+	}
+	return self.indexDataType
 }
 
 func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly bool) (int64, []HIndexResp, error) {
+	if self.IsComposite() {
+		return self.searchCompositeRec(db, cond, countOnly)
+	}
 	var n int64
 	pkList := make([]HIndexResp, 0, 32)
+	min, max, rt, err := self.searchRange(cond)
+	if err != nil {
+		return n, nil, err
+	}
+	if dbLog.Level() >= common.LOG_DEBUG {
+		dbLog.Debugf("begin search index: %v-%v-%v, %v~%v", string(self.Table), string(self.Name), string(self.IndexField), min, max)
+	}
+	it, err := db.NewDBRangeLimitIterator(min, max, rt, cond.Offset, cond.Limit, false)
+	if err != nil {
+		return n, nil, err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		n++
+		if countOnly {
+			continue
+		}
+		resp, err := self.decodeSearchRec(it.Key(), it.Value())
+		if err != nil {
+			continue
+		}
+		pkList = append(pkList, resp)
+	}
+	return n, pkList, nil
+}
+
+// the index key range for the condition
+func (self *HsetIndex) searchRange(cond *IndexCondition) ([]byte, []byte, uint8, error) {
 	var min []byte
 	var max []byte
 	rt := common.RangeClose
 	if cond.StartKey == nil {
-		min = encodeHsetIndexStartKey(self.Table, self.Name)
+		min = encodeHsetIndexStartKey(self.dataType(), self.Table, self.Name)
 	}
 	if cond.EndKey == nil {
-		max = encodeHsetIndexStopKey(self.Table, self.Name)
+		max = encodeHsetIndexStopKey(self.dataType(), self.Table, self.Name)
 	}
 	if self.ValueType == Int64V || self.ValueType == Int32V {
 		if cond.StartKey != nil {
 			sn, err := strconv.ParseInt(string(cond.StartKey), 10, 64)
 			if err != nil {
-				return n, nil, err
+				return nil, nil, rt, err
 			}
 			if !cond.IncludeStart {
 				sn++
 			}
-			min, err = encodeHsetIndexNumberStartKey(self.Table, self.Name, sn)
+			min, err = encodeHsetIndexNumberStartKey(self.dataType(), self.Table, self.Name, sn)
 			if err != nil {
-				return n, nil, err
+				return nil, nil, rt, err
 			}
 		}
 		if cond.EndKey != nil {
 			en, err := strconv.ParseInt(string(cond.EndKey), 10, 64)
 			if err != nil {
-				return n, nil, err
+				return nil, nil, rt, err
 			}
 			if !cond.IncludeEnd {
 				en--
 			}
-			max, err = encodeHsetIndexNumberStopKey(self.Table, self.Name, en)
+			max, err = encodeHsetIndexNumberStopKey(self.dataType(), self.Table, self.Name, en)
 			if err != nil {
-				return n, nil, err
+				return nil, nil, rt, err
 			}
 		}
 	} else if self.ValueType == StringV {
@@ -461,70 +511,60 @@ func (self *HsetIndex) SearchRec(db *RockDB, cond *IndexCondition, countOnly boo
 		var err error
 		if cond.StartKey != nil {
 			if (rt & common.RangeLOpen) > 0 {
-				min, err = encodeHsetIndexStringStopKey(self.Table, self.Name, cond.StartKey)
+				min, err = encodeHsetIndexStringStopKey(self.dataType(), self.Table, self.Name, cond.StartKey)
 				if err != nil {
-					return n, nil, err
+					return nil, nil, rt, err
 				}
 			} else {
-				min, err = encodeHsetIndexStringStartKey(self.Table, self.Name, cond.StartKey)
+				min, err = encodeHsetIndexStringStartKey(self.dataType(), self.Table, self.Name, cond.StartKey)
 				if err != nil {
-					return n, nil, err
+					return nil, nil, rt, err
 				}
 			}
 		}
 		if cond.EndKey != nil {
 			if (rt & common.RangeROpen) > 0 {
-				max, err = encodeHsetIndexStringStartKey(self.Table, self.Name, cond.EndKey)
+				max, err = encodeHsetIndexStringStartKey(self.dataType(), self.Table, self.Name, cond.EndKey)
 				if err != nil {
-					return n, nil, err
+					return nil, nil, rt, err
 				}
 			} else {
-				max, err = encodeHsetIndexStringStopKey(self.Table, self.Name, cond.EndKey)
+				max, err = encodeHsetIndexStringStopKey(self.dataType(), self.Table, self.Name, cond.EndKey)
 				if err != nil {
-					return n, nil, err
+					return nil, nil, rt, err
 				}
 			}
 		}
 	}
-	if dbLog.Level() >= common.LOG_DEBUG {
-		dbLog.Debugf("begin search index: %v-%v-%v, %v~%v", string(self.Table), string(self.Name), string(self.IndexField), min, max)
+	return min, max, rt, nil
+}
+
+func (self *HsetIndex) decodeSearchRec(key []byte, value []byte) (HIndexResp, error) {
+	var pk []byte
+	var iv []byte
+	var nv int64
+	var err error
+	if self.ValueType == Int64V || self.ValueType == Int32V {
+		_, _, nv, pk, err = decodeHsetIndexNumberKey(self.dataType(), key)
+	} else if self.ValueType == StringV {
+		_, _, iv, pk, err = decodeHsetIndexStringKey(self.dataType(), key)
+	} else {
+		err = ErrIndexValueType
 	}
-	it, err := db.NewDBRangeLimitIterator(min, max, rt, cond.Offset, cond.Limit, false)
 	if err != nil {
-		return n, nil, err
+		return HIndexResp{}, err
 	}
-	defer it.Close()
-	for ; it.Valid(); it.Next() {
-		n++
-		if countOnly {
-			continue
-		}
-		var pk []byte
-		var iv []byte
-		var nv int64
-		if self.ValueType == Int64V || self.ValueType == Int32V {
-			_, _, nv, pk, err = decodeHsetIndexNumberKey(it.Key())
-		} else if self.ValueType == StringV {
-			_, _, iv, pk, err = decodeHsetIndexStringKey(it.Key())
-		} else {
-			continue
-		}
-		if err != nil {
-			continue
-		}
-		if self.Unique == 1 {
-			pk = it.Value()
-		}
-		if dbLog.Level() > common.LOG_DETAIL {
-			dbLog.Debugf("matched index: %v, %v, %v", it.Key(), string(pk), string(iv))
-		}
-		pkList = append(pkList, HIndexResp{PKey: pk, IndexValue: iv, IndexIntValue: nv})
+	if self.Unique == 1 {
+		pk = value
 	}
-	return n, pkList, nil
+	if dbLog.Level() > common.LOG_DETAIL {
+		dbLog.Debugf("matched index: %v, %v, %v", key, string(pk), string(iv))
+	}
+	return HIndexResp{PKey: pk, IndexValue: iv, IndexIntValue: nv, IndexValueType: self.ValueType}, nil
 }
 
-func (self *HsetIndex) UpdateRec(oldvalue []byte, value []byte, pk []byte, wb engine.WriteBatch) error {
-	if self.State == DeletedIndex {
+func (self *HsetIndex) UpdateRec(db *RockDB, oldvalue []byte, value []byte, pk []byte, wb engine.WriteBatch) error {
+	if self.State == DeletedIndex || self.IsComposite() {
 		return nil
 	}
 	pkkey := pk
@@ -534,7 +574,7 @@ func (self *HsetIndex) UpdateRec(oldvalue []byte, value []byte, pk []byte, wb en
 		pkvalue = pk
 	}
 	if oldvalue != nil {
-		self.RemoveRec(oldvalue, pkkey, wb)
+		self.RemoveRec(db, oldvalue, pk, wb)
 	}
 	if len(value) == 0 {
 		return nil
@@ -544,22 +584,36 @@ func (self *HsetIndex) UpdateRec(oldvalue []byte, value []byte, pk []byte, wb en
 		if err != nil {
 			return err
 		}
-		hsetIndexAddNumberRec(self.Table, self.Name, n, pkkey, pkvalue, wb)
+		hsetIndexAddNumberRec(self.dataType(), self.Table, self.Name, n, pkkey, pkvalue, wb)
 	} else if self.ValueType == StringV {
 		if self.PrefixLen > 0 && int32(len(value)) > self.PrefixLen {
 			value = value[:self.PrefixLen]
 		}
-		hsetIndexAddStringRec(self.Table, self.Name, value, pkkey, pkvalue, wb)
+		hsetIndexAddStringRec(self.dataType(), self.Table, self.Name, value, pkkey, pkvalue, wb)
+	}
+	if self.Unique == 1 {
+		ukey, _ := self.uniqueKey(value)
+		self.markUniquePending(ukey, pk)
 	}
 	return nil
 }
 
-func (self *HsetIndex) RemoveRec(value []byte, pk []byte, wb engine.WriteBatch) {
-	if value == nil {
+func (self *HsetIndex) RemoveRec(db *RockDB, value []byte, pk []byte, wb engine.WriteBatch) {
+	if value == nil || self.IsComposite() {
 		return
 	}
 	if self.Unique == 1 {
+		ukey, err := self.uniqueKey(value)
+		if err != nil {
+			return
+		}
+		// the duplicated value skipped while building is not indexed for this pk,
+		// and the unique key owned by another pk should be kept
+		if !self.isUniqueOwner(db, ukey, pk) {
+			return
+		}
 		pk = nil
+		self.markUniquePending(ukey, nil)
 	}
 	if self.ValueType == Int64V || self.ValueType == Int32V {
 		n, err := strconv.ParseInt(string(value), 10, 64)
@@ -567,19 +621,19 @@ func (self *HsetIndex) RemoveRec(value []byte, pk []byte, wb engine.WriteBatch)
 			return
 		}
 
-		hsetIndexRemoveNumberRec(self.Table, self.Name, n, pk, wb)
+		hsetIndexRemoveNumberRec(self.dataType(), self.Table, self.Name, n, pk, wb)
 	} else if self.ValueType == StringV {
 		if self.PrefixLen > 0 && int32(len(value)) > self.PrefixLen {
 			value = value[:self.PrefixLen]
 		}
 
-		hsetIndexRemoveStringRec(self.Table, self.Name, value, pk, wb)
+		hsetIndexRemoveStringRec(self.dataType(), self.Table, self.Name, value, pk, wb)
 	}
 }
 
 func (self *HsetIndex) cleanAll(db *RockDB, stopChan chan struct{}) error {
-	min := encodeHsetIndexStartKey(self.Table, self.Name)
-	max := encodeHsetIndexStopKey(self.Table, self.Name)
+	min := encodeHsetIndexStartKey(self.dataType(), self.Table, self.Name)
+	max := encodeHsetIndexStopKey(self.dataType(), self.Table, self.Name)
 
 	dbLog.Infof("begin clean index: %v-%v-%v", string(self.Table), string(self.Name), string(self.IndexField))
 
@@ -620,6 +620,134 @@ func TestHashIndexStringVMultiEqual(t *testing.T) {
 }
 
 func TestHashIndexStringVUnique(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	var hindex HsetIndex
+	hindex.Table = []byte("test")
+	hindex.Name = []byte("index1")
+	hindex.IndexField = []byte("index_test_stringfield")
+	hindex.Unique = 1
+	hindex.ValueType = StringV
+
+	// the duplicated values written before the index added are ignored while building
+	_, err := db.HSet(0, false, []byte("test:key0"), hindex.IndexField, []byte("dup"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key1"), hindex.IndexField, []byte("dup"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key5"), hindex.IndexField, []byte("dup"))
+	assert.Nil(t, err)
+
+	err = db.indexMgr.AddHsetIndex(db, &hindex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), BuildingIndex)
+	assert.Nil(t, err)
+	buildStart := time.Now()
+	for {
+		time.Sleep(time.Millisecond * 10)
+		hindex, err := db.indexMgr.GetHsetIndex(string(hindex.Table), string(hindex.IndexField))
+		assert.Nil(t, err)
+		if hindex.State == BuildDoneIndex {
+			break
+		} else if time.Since(buildStart) > time.Second*10 {
+			t.Errorf("building index timeout")
+			break
+		}
+	}
+	err = db.indexMgr.UpdateHsetIndexState(db, string(hindex.Table), string(hindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+
+	search := func(v string) []string {
+		_, _, rets, err := db.HsetIndexSearch(hindex.Table, hindex.IndexField, &IndexCondition{StartKey: []byte(v),
+			IncludeStart: true, EndKey: []byte(v), IncludeEnd: true, Limit: -1}, false)
+		assert.Nil(t, err)
+		keys := make([]string, 0, len(rets))
+		for _, r := range rets {
+			keys = append(keys, string(r.PKey))
+		}
+		return keys
+	}
+	assert.Equal(t, []string{"test:key0"}, search("dup"))
+
+	_, err = db.HSet(0, false, []byte("test:key2"), hindex.IndexField, []byte("dup"))
+	assert.Equal(t, ErrIndexUniqueConflict, err)
+	// the failed write should not be applied
+	v, err := db.HGet([]byte("test:key2"), hindex.IndexField)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	err = db.HMset(0, []byte("test:key2"), common.KVRecord{Key: []byte("other"), Value: []byte("1")},
+		common.KVRecord{Key: hindex.IndexField, Value: []byte("dup")})
+	assert.Equal(t, ErrIndexUniqueConflict, err)
+	n, err := db.HLen([]byte("test:key2"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	// rewrite the same value for the owner is allowed
+	_, err = db.HSet(0, false, []byte("test:key0"), hindex.IndexField, []byte("dup"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key2"), hindex.IndexField, []byte("v2"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key0"), hindex.IndexField, []byte("v0"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key2"), hindex.IndexField, []byte("dup"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test:key2"}, search("dup"))
+	assert.Equal(t, []string{"test:key0"}, search("v0"))
+	// the duplicated values skipped while building should not remove the index of the owner
+	_, err = db.HSet(0, false, []byte("test:key1"), hindex.IndexField, []byte("v1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test:key2"}, search("dup"))
+	assert.Equal(t, []string{"test:key1"}, search("v1"))
+	_, err = db.HDel(0, []byte("test:key5"), hindex.IndexField)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test:key2"}, search("dup"))
+
+	// the uncommitted changes in the batched write should be checked
+	err = db.BeginBatchWrite()
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key3"), hindex.IndexField, []byte("v3"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key4"), hindex.IndexField, []byte("v3"))
+	assert.Equal(t, ErrIndexUniqueConflict, err)
+	assert.False(t, IsNeedAbortError(err))
+	_, err = db.HDel(0, []byte("test:key0"), hindex.IndexField)
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:key4"), hindex.IndexField, []byte("v0"))
+	assert.Nil(t, err)
+	err = db.CommitBatchWrite()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"test:key3"}, search("v3"))
+	assert.Equal(t, []string{"test:key4"}, search("v0"))
+	_, err = db.HSet(0, false, []byte("test:key0"), hindex.IndexField, []byte("v3"))
+	assert.Equal(t, ErrIndexUniqueConflict, err)
+
+	// the unique composite index
+	var cindex HsetIndex
+	cindex.Table = []byte("test")
+	cindex.Name = []byte("tenant_user")
+	cindex.IndexField = []byte("tenant_id,user_name")
+	cindex.Unique = 1
+	cindex.CompositeFields = []HsetIndexField{
+		{Field: []byte("tenant_id"), ValueType: StringV},
+		{Field: []byte("user_name"), ValueType: StringV},
+	}
+	err = db.indexMgr.AddHsetIndex(db, &cindex)
+	assert.Nil(t, err)
+	err = db.indexMgr.UpdateHsetIndexState(db, string(cindex.Table), string(cindex.IndexField), ReadyIndex)
+	assert.Nil(t, err)
+	err = db.HMset(0, []byte("test:ukey1"), common.KVRecord{Key: []byte("tenant_id"), Value: []byte("t1")},
+		common.KVRecord{Key: []byte("user_name"), Value: []byte("u1")})
+	assert.Nil(t, err)
+	err = db.HMset(0, []byte("test:ukey2"), common.KVRecord{Key: []byte("tenant_id"), Value: []byte("t2")},
+		common.KVRecord{Key: []byte("user_name"), Value: []byte("u1")})
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:ukey2"), []byte("tenant_id"), []byte("t1"))
+	assert.Equal(t, ErrIndexUniqueConflict, err)
+	_, err = db.HSet(0, false, []byte("test:ukey1"), []byte("user_name"), []byte("u2"))
+	assert.Nil(t, err)
+	_, err = db.HSet(0, false, []byte("test:ukey2"), []byte("tenant_id"), []byte("t1"))
+	assert.Nil(t, err)
 }
 
 func TestHashIndexInt64V(t *testing.T) {
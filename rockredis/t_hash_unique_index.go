@@ -0,0 +1,192 @@
+package rockredis
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+)
+
+// The unique index key has no pk and the pk is stored as the value,
+// table:indexname:value:sep -> pk
+// so the owner of the indexed value can be read by the index key. The write which
+// will index the same value for another hash key is rejected before any change is
+// written to the write batch.
+// The uniqueness is only guaranteed in the same partition, since the writes to
+// different partitions are committed in the different raft groups.
+//
+// The global unique mode (common.GlobalUniqueIndex) is deferred to a follow-up and
+// rejected while adding the index. It needs:
+//  - the unique key stored in the partition chosen by the hash of the indexed value
+//    instead of the partition of the hash key
+//  - a two-partition commit for the write: reserve the unique key in the index
+//    partition with a transaction id through raft, apply the hash write in the data
+//    partition, then commit or abort the reservation, and the same for removing the
+//    old value while the field is changed
+//  - a resolver outside the raft apply for the reservations left by a crashed
+//    coordinator, which checks the hash key in the data partition
+// The staging of the chunked proposals only commits in one raft group, so it can not
+// be used for the two-partition commit directly.
+
+// the unique index keys changed in the uncommitted write batch, the batched writes
+// can not be read from db until committed, so the latest owner is tracked here.
+// nil pk means the unique key is removed in the write batch.
+type uniquePendingKeys struct {
+	sync.Mutex
+	keys map[string][]byte
+}
+
+func (p *uniquePendingKeys) set(key []byte, pk []byte) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	if p.keys == nil {
+		p.keys = make(map[string][]byte)
+	}
+	if pk != nil {
+		pk = append([]byte{}, pk...)
+	}
+	p.keys[string(key)] = pk
+	p.Unlock()
+}
+
+func (p *uniquePendingKeys) get(key []byte) ([]byte, bool) {
+	if p == nil {
+		return nil, false
+	}
+	p.Lock()
+	pk, ok := p.keys[string(key)]
+	p.Unlock()
+	return pk, ok
+}
+
+func (p *uniquePendingKeys) reset() {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	if len(p.keys) > 0 {
+		p.keys = nil
+	}
+	p.Unlock()
+}
+
+func (self *HsetIndex) uniqueKey(value []byte) ([]byte, error) {
+	if self.ValueType == Int64V || self.ValueType == Int32V {
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return encodeHsetIndexNumberKey(self.dataType(), self.Table, self.Name, n, nil, false)
+	} else if self.ValueType == StringV {
+		if self.PrefixLen > 0 && int32(len(value)) > self.PrefixLen {
+			value = value[:self.PrefixLen]
+		}
+		return encodeHsetIndexStringKey(self.dataType(), self.Table, self.Name, value, nil, false)
+	}
+	return nil, ErrIndexValueType
+}
+
+func (self *HsetIndex) markUniquePending(key []byte, pk []byte) {
+	if self.Unique != 1 || key == nil {
+		return
+	}
+	self.uniquePending.set(key, pk)
+}
+
+func (self *HsetIndex) getUniqueOwner(db *RockDB, key []byte) ([]byte, error) {
+	owner, ok := self.uniquePending.get(key)
+	if ok {
+		return owner, nil
+	}
+	return db.GetBytesNoLock(key)
+}
+
+func (self *HsetIndex) checkUniqueKey(db *RockDB, key []byte, pk []byte) error {
+	owner, err := self.getUniqueOwner(db, key)
+	if err != nil {
+		return err
+	}
+	if owner != nil && !bytes.Equal(owner, pk) {
+		return ErrIndexUniqueConflict
+	}
+	return nil
+}
+
+// the unique key can be removed only by the owner, since the duplicated values
+// skipped while building the index are not indexed.
+func (self *HsetIndex) isUniqueOwner(db *RockDB, key []byte, pk []byte) bool {
+	owner, err := self.getUniqueOwner(db, key)
+	if err != nil {
+		dbLog.Infof("read unique index %s owner failed: %v", string(self.Name), err)
+		return false
+	}
+	return bytes.Equal(owner, pk)
+}
+
+// check whether the value is indexed by another hash key in the unique index
+func (self *HsetIndex) checkUniqueRec(db *RockDB, value []byte, pk []byte) error {
+	if self.Unique != 1 || self.State == DeletedIndex || self.IsComposite() || len(value) == 0 {
+		return nil
+	}
+	key, err := self.uniqueKey(value)
+	if err != nil {
+		return err
+	}
+	return self.checkUniqueKey(db, key, pk)
+}
+
+func (self *HsetIndex) checkUniqueCompositeRec(db *RockDB, values [][]byte, pk []byte) error {
+	if self.Unique != 1 || self.State == DeletedIndex {
+		return nil
+	}
+	vals, err := self.compositeEncodeValues(values)
+	if err != nil || vals == nil {
+		return err
+	}
+	key, err := self.encodeCompositeKey(vals, nil)
+	if err != nil {
+		return err
+	}
+	return self.checkUniqueKey(db, key, pk)
+}
+
+// check the unique indexes for the changed hash fields before anything is written,
+// so the write batch is not touched if any value is duplicated.
+func (db *RockDB) hsetUniqueIndexCheck(tableIndexes *TableIndexContainer, hkey []byte,
+	fields [][]byte, values [][]byte) error {
+	if tableIndexes == nil || len(fields) == 0 {
+		return nil
+	}
+	for i, f := range fields {
+		hindex := tableIndexes.GetHIndexNoLock(string(f))
+		if hindex == nil {
+			continue
+		}
+		err := hindex.checkUniqueRec(db, values[i], hkey)
+		if err != nil {
+			return err
+		}
+	}
+	for _, index := range tableIndexes.GetCompositeHIndexesNoLock() {
+		if index.Unique != 1 || !index.hasCompositeField(fields) {
+			continue
+		}
+		newValues, err := db.HMget(hkey, index.compositeFieldNames()...)
+		if err != nil {
+			return err
+		}
+		for i, cf := range index.CompositeFields {
+			for j, f := range fields {
+				if bytes.Equal(cf.Field, f) {
+					newValues[i] = values[j]
+				}
+			}
+		}
+		err = index.checkUniqueCompositeRec(db, newValues, hkey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,7 +2,10 @@ package rockredis
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/tidwall/gjson"
@@ -14,10 +17,18 @@ var (
 	jSep                = byte(':')
 	errJSONPathNotArray = errors.New("json path is not array")
 	errInvalidJSONValue = errors.New("invalid json value")
+
+	errJSONKeyNotExist          = errors.New("json key not exist")
+	errJSONPathNotNumber        = errors.New("json path is not number")
+	errJSONPathNotString        = errors.New("json path is not string")
+	errJSONPathNotBool          = errors.New("json path is not boolean")
+	errJSONNumberOverflow       = errors.New("json number overflow")
+	errJSONArrayIndexOutOfRange = errors.New("json array index out of range")
 )
 
+// the json value larger than MaxValueSize will be stored as chunks
 func checkJSONValueSize(value []byte) error {
-	if len(value) > MaxValueSize*2 {
+	if len(value) > MaxChunkedValueSize {
 		return errValueSize
 	}
 
@@ -29,14 +40,72 @@ func convertJSONPath(path []byte) string {
 		return ""
 	}
 	// handle the compatible between redis json and sjson/gjson lib
-	jpath := string(path)
-	strings.TrimSpace(jpath)
+	jpath := strings.TrimSpace(string(path))
 	if len(jpath) > 0 && jpath[0] == '.' {
 		jpath = jpath[1:]
 	}
+	if isJSONPath(jpath) {
+		// convert to gjson path if possible, otherwise it should be queried as JSONPath
+		segs, err := parseJSONPath(jpath)
+		if err != nil {
+			return jpath
+		}
+		if gpath, ok := jsonPathToGJSONPath(segs); ok {
+			return gpath
+		}
+	}
 	return jpath
 }
 
+func convertJSONWritePath(path []byte) (string, error) {
+	jpath := convertJSONPath(path)
+	if isJSONPath(jpath) {
+		return "", errJSONPathNotSupport
+	}
+	// the escaped key converted from JSONPath can not be updated by sjson correctly
+	if strings.Contains(jpath, "\\") && isJSONPath(strings.TrimPrefix(string(path), ".")) {
+		return "", errJSONPathNotSupport
+	}
+	return jpath, nil
+}
+
+// get the json value at the path, the first will be returned if the JSONPath has several matches
+func getJSONPathResult(jdata []byte, jpath string) gjson.Result {
+	if jpath == "" {
+		return gjson.ParseBytes(jdata)
+	}
+	if isJSONPath(jpath) {
+		rets, err := queryJSONPath(jdata, jpath)
+		if err != nil || len(rets) == 0 {
+			return gjson.Result{}
+		}
+		return rets[0]
+	}
+	return gjson.GetBytes(jdata, jpath)
+}
+
+// get the string value at the path, for the JSONPath (begin with $) all the matched
+// values will be returned as json array.
+func getJSONPathString(jdata []byte, path []byte) (string, bool) {
+	if isJSONPath(strings.TrimSpace(string(path))) {
+		rets, err := queryJSONPath(jdata, strings.TrimSpace(string(path)))
+		if err != nil {
+			return "", false
+		}
+		raws := make([]string, 0, len(rets))
+		for _, r := range rets {
+			raws = append(raws, r.Raw)
+		}
+		return "[" + strings.Join(raws, ",") + "]", true
+	}
+	jpath := convertJSONPath(path)
+	if jpath == "" {
+		return string(jdata), jdata != nil
+	}
+	r := getJSONPathResult(jdata, jpath)
+	return r.String(), r.Exists()
+}
+
 func encodeJSONKey(table []byte, key []byte) ([]byte, error) {
 	buf := make([]byte, getDataTablePrefixBufLen(JSONType, table))
 	pos := encodeDataTablePrefixToBuf(buf, JSONType, table)
@@ -88,17 +157,28 @@ func (db *RockDB) getOldJSON(table []byte, rk []byte) ([]byte, []byte, bool, err
 	if err != nil {
 		return nil, nil, false, err
 	}
-	oldV, err := db.GetBytesNoLock(ek)
-	if err != nil {
-		return ek, nil, false, err
-	}
-	if oldV == nil {
-		return ek, oldV, false, nil
-	}
-	if len(oldV) >= tsLen {
-		oldV = oldV[:len(oldV)-tsLen]
+	for i := 0; ; i++ {
+		oldV, err := db.GetBytesNoLock(ek)
+		if err != nil {
+			return ek, nil, false, err
+		}
+		if oldV == nil {
+			return ek, oldV, false, nil
+		}
+		if len(oldV) >= tsLen {
+			oldV = oldV[:len(oldV)-tsLen]
+		}
+		m := decodeChunkManifest(oldV)
+		if m == nil {
+			return ek, oldV, true, nil
+		}
+		oldV, err = db.readChunkedValue(JSONChunkExtType, table, rk, m, 0, m.Size-1)
+		if err == errChunkNotFound && i < chunkReadRetry {
+			// overwritten while reading, read the new value again
+			continue
+		}
+		return ek, oldV, err == nil, err
 	}
-	return ek, oldV, true, nil
 }
 
 func (db *RockDB) JSet(ts int64, key []byte, path []byte, value []byte) (int64, error) {
@@ -113,23 +193,32 @@ func (db *RockDB) JSet(ts int64, key []byte, path []byte, value []byte) (int64,
 
 	// index lock should before any db read or write since it may be changed by indexing
 	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
-	var index *JSONIndex
 	if tableIndexes != nil {
 		tableIndexes.Lock()
 		defer tableIndexes.Unlock()
-		index = tableIndexes.GetJSONIndexNoLock(string(path))
 	}
 
 	ek, oldV, isExist, err := db.getOldJSON(table, rk)
 	if err != nil {
 		return 0, err
 	}
+	origV := oldV
 
-	oldV, err = db.jSetPath(oldV, convertJSONPath(path), value)
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return 0, err
+	}
+	oldV, err = db.jSetPath(oldV, jpath, value)
 	if err != nil {
 		return 0, err
 	}
-	// json value can be two times large since it can be read partially.
+	if (!isExist || jpath == "") && tableIndexes != nil && tableIndexes.tableSchema != nil {
+		// fill the default fields while the json is created or replaced
+		oldV, err = tableIndexes.tableSchema.FillJSONDefaults(oldV)
+		if err != nil {
+			return 0, err
+		}
+	}
 	if err := checkJSONValueSize(oldV); err != nil {
 		return 0, err
 	}
@@ -137,14 +226,21 @@ func (db *RockDB) JSet(ts int64, key []byte, path []byte, value []byte) (int64,
 		dbLog.Infof("invalid json: %v", string(value))
 		return 0, errInvalidJSONValue
 	}
-	// TODO: update index for path
-	_ = index
 	if !isExist {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
-	tsBuf := PutInt64(ts)
-	oldV = append(oldV, tsBuf...)
-	db.wb.Put(ek, oldV)
+	err = db.jsonIndexUpdate(tableIndexes, key, origV, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
+	err = db.jsonFullTextUpdate(tableIndexes, key, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
+	err = db.putJSONValue(ts, table, rk, ek, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
 	err = db.CommitBatchWrite()
 	if isExist {
 		return 0, err
@@ -173,18 +269,17 @@ func (db *RockDB) JMset(ts int64, key []byte, args ...common.KVRecord) error {
 	if err != nil {
 		return err
 	}
+	origV := oldV
 
 	for i := 0; i < len(args); i++ {
 		path := args[i].Key
-		oldV, err = db.jSetPath(oldV, convertJSONPath(path), args[i].Value)
-		if tableIndexes != nil {
-			if index := tableIndexes.GetJSONIndexNoLock(string(path)); index != nil {
-				//oldPathV := gjson.GetBytes(oldV, string(path))
-				//err = index.UpdateRec(oldPathV, args[i].Value, key, db.wb)
-				//if err != nil {
-				//	return err
-				//}
-			}
+		jpath, err := convertJSONWritePath(path)
+		if err != nil {
+			return err
+		}
+		oldV, err = db.jSetPath(oldV, jpath, args[i].Value)
+		if err != nil {
+			return err
 		}
 	}
 	if err := checkJSONValueSize(oldV); err != nil {
@@ -193,9 +288,20 @@ func (db *RockDB) JMset(ts int64, key []byte, args ...common.KVRecord) error {
 	if !gjson.Valid(string(oldV)) {
 		return errInvalidJSONValue
 	}
-	tsBuf := PutInt64(ts)
-	oldV = append(oldV, tsBuf...)
-	db.wb.Put(ek, oldV)
+	// the indexed path may be changed by any of the paths, such as the parent object,
+	// so we compare the whole old and new json for the indexes.
+	err = db.jsonIndexUpdate(tableIndexes, key, origV, oldV, db.wb)
+	if err != nil {
+		return err
+	}
+	err = db.jsonFullTextUpdate(tableIndexes, key, oldV, db.wb)
+	if err != nil {
+		return err
+	}
+	err = db.putJSONValue(ts, table, rk, ek, oldV, db.wb)
+	if err != nil {
+		return err
+	}
 	if !isExist {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
@@ -203,8 +309,29 @@ func (db *RockDB) JMset(ts int64, key []byte, args ...common.KVRecord) error {
 	return err
 }
 
-func (db *RockDB) JMGet(path []byte, keys ...[]byte) ([]string, error) {
-	return nil, nil
+// JMGet get the same path from several json keys, nil will be returned for the not exist key or path
+func (db *RockDB) JMGet(path []byte, keys ...[]byte) ([][]byte, error) {
+	if len(keys) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	vals := make([][]byte, len(keys))
+	for i, key := range keys {
+		table, rk, err := extractTableFromRedisKey(key)
+		if err != nil {
+			return nil, err
+		}
+		_, oldV, isExist, err := db.getOldJSON(table, rk)
+		if err != nil {
+			return nil, err
+		}
+		if !isExist {
+			continue
+		}
+		if v, ok := getJSONPathString(oldV, path); ok {
+			vals[i] = []byte(v)
+		}
+	}
+	return vals, nil
 }
 
 func (db *RockDB) JType(key []byte, path []byte) (string, error) {
@@ -216,11 +343,7 @@ func (db *RockDB) JType(key []byte, path []byte) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	jpath := convertJSONPath(path)
-	r := gjson.GetBytes(oldV, jpath)
-	if jpath == "" {
-		r = gjson.ParseBytes(oldV)
-	}
+	r := getJSONPathResult(oldV, convertJSONPath(path))
 	if !r.Exists() {
 		return "null", nil
 	}
@@ -242,19 +365,11 @@ func (db *RockDB) JGet(key []byte, paths ...[]byte) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	tmp := make([]string, len(paths))
+	rets := make([]string, len(paths))
 	for i, path := range paths {
-		tmp[i] = convertJSONPath(path)
+		rets[i], _ = getJSONPathString(oldV, path)
 	}
-	rets := gjson.GetManyBytes(oldV, tmp...)
-	for i := 0; i < len(tmp); i++ {
-		if tmp[i] == "" {
-			tmp[i] = string(oldV)
-		} else {
-			tmp[i] = rets[i].String()
-		}
-	}
-	return tmp, nil
+	return rets, nil
 }
 
 func (db *RockDB) JDel(ts int64, key []byte, path []byte) (int64, error) {
@@ -262,6 +377,10 @@ func (db *RockDB) JDel(ts int64, key []byte, path []byte) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return 0, err
+	}
 	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
 	if tableIndexes != nil {
 		tableIndexes.Lock()
@@ -276,11 +395,21 @@ func (db *RockDB) JDel(ts int64, key []byte, path []byte) (int64, error) {
 		return 0, nil
 	}
 
-	jpath := convertJSONPath(path)
 	if jpath == "" {
 		// delete whole json
-		db.wb.Delete(ek)
+		err = db.delJSONValue(table, rk, ek, db.wb)
+		if err != nil {
+			return 0, err
+		}
 		db.IncrTableKeyCount(table, -1, db.wb)
+		err = db.jsonIndexUpdate(tableIndexes, key, oldV, nil, db.wb)
+		if err != nil {
+			return 0, err
+		}
+		err = db.jsonFullTextUpdate(tableIndexes, key, nil, db.wb)
+		if err != nil {
+			return 0, err
+		}
 	} else {
 		newV, err := sjson.DeleteBytes(oldV, jpath)
 		if err != nil {
@@ -289,10 +418,19 @@ func (db *RockDB) JDel(ts int64, key []byte, path []byte) (int64, error) {
 		if bytes.Equal(newV, oldV) {
 			return 0, nil
 		}
+		err = db.jsonIndexUpdate(tableIndexes, key, oldV, newV, db.wb)
+		if err != nil {
+			return 0, err
+		}
 		oldV = newV
-		tsBuf := PutInt64(ts)
-		oldV = append(oldV, tsBuf...)
-		db.wb.Put(ek, oldV)
+		err = db.jsonFullTextUpdate(tableIndexes, key, oldV, db.wb)
+		if err != nil {
+			return 0, err
+		}
+		err = db.putJSONValue(ts, table, rk, ek, oldV, db.wb)
+		if err != nil {
+			return 0, err
+		}
 	}
 	err = db.CommitBatchWrite()
 	return 1, err
@@ -316,6 +454,10 @@ func (db *RockDB) JArrayAppend(ts int64, key []byte, path []byte, jsons ...[]byt
 	if err != nil {
 		return 0, err
 	}
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return 0, err
+	}
 	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
 	if tableIndexes != nil {
 		tableIndexes.Lock()
@@ -325,11 +467,8 @@ func (db *RockDB) JArrayAppend(ts int64, key []byte, path []byte, jsons ...[]byt
 	if err != nil {
 		return 0, err
 	}
-	jpath := convertJSONPath(path)
-	oldPath := gjson.GetBytes(oldV, jpath)
-	if jpath == "" {
-		oldPath = gjson.ParseBytes(oldV)
-	}
+	origV := oldV
+	oldPath := getJSONPathResult(oldV, jpath)
 	arrySize := 0
 	if oldPath.Exists() && !oldPath.IsArray() {
 		return 0, errJSONPathNotArray
@@ -353,9 +492,18 @@ func (db *RockDB) JArrayAppend(ts int64, key []byte, path []byte, jsons ...[]byt
 	if !gjson.Valid(string(oldV)) {
 		return 0, errInvalidJSONValue
 	}
-	tsBuf := PutInt64(ts)
-	oldV = append(oldV, tsBuf...)
-	db.wb.Put(ek, oldV)
+	err = db.jsonIndexUpdate(tableIndexes, key, origV, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
+	err = db.jsonFullTextUpdate(tableIndexes, key, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
+	err = db.putJSONValue(ts, table, rk, ek, oldV, db.wb)
+	if err != nil {
+		return 0, err
+	}
 	if !isExist {
 		db.IncrTableKeyCount(table, 1, db.wb)
 	}
@@ -368,6 +516,10 @@ func (db *RockDB) JArrayPop(ts int64, key []byte, path []byte) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return "", err
+	}
 	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
 	if tableIndexes != nil {
 		tableIndexes.Lock()
@@ -380,13 +532,7 @@ func (db *RockDB) JArrayPop(ts int64, key []byte, path []byte) (string, error) {
 	if !isExist {
 		return "", nil
 	}
-	jpath := convertJSONPath(path)
-	var oldJSON gjson.Result
-	if jpath == "" {
-		oldJSON = gjson.ParseBytes(oldV)
-	} else {
-		oldJSON = gjson.GetBytes(oldV, jpath)
-	}
+	oldJSON := getJSONPathResult(oldV, jpath)
 	if !oldJSON.Exists() {
 		return "", nil
 	}
@@ -404,36 +550,45 @@ func (db *RockDB) JArrayPop(ts int64, key []byte, path []byte) (string, error) {
 		jpath += ".-1"
 	}
 	poped := oldJSON.Array()[arrySize-1].String()
-	oldV, err = sjson.DeleteBytes(oldV, jpath)
+	newV, err := sjson.DeleteBytes(oldV, jpath)
+	if err != nil {
+		return "", err
+	}
+	err = db.jsonIndexUpdate(tableIndexes, key, oldV, newV, db.wb)
+	if err != nil {
+		return "", err
+	}
+	oldV = newV
+	err = db.jsonFullTextUpdate(tableIndexes, key, oldV, db.wb)
+	if err != nil {
+		return "", err
+	}
+	err = db.putJSONValue(ts, table, rk, ek, oldV, db.wb)
 	if err != nil {
 		return "", err
 	}
-	tsBuf := PutInt64(ts)
-	oldV = append(oldV, tsBuf...)
-	db.wb.Put(ek, oldV)
 	err = db.CommitBatchWrite()
 	return poped, err
 }
 
-func (db *RockDB) JArrayLen(key []byte, path []byte) (int64, error) {
+// get the json value at the path for read, not exist result will be returned if the key not exist
+func (db *RockDB) jGetPathResult(key []byte, path []byte) (gjson.Result, error) {
 	table, rk, err := extractTableFromRedisKey(key)
 	if err != nil {
-		return 0, err
+		return gjson.Result{}, err
 	}
 	_, oldV, isExist, err := db.getOldJSON(table, rk)
+	if err != nil || !isExist {
+		return gjson.Result{}, err
+	}
+	return getJSONPathResult(oldV, convertJSONPath(path)), nil
+}
+
+func (db *RockDB) JArrayLen(key []byte, path []byte) (int64, error) {
+	jsonData, err := db.jGetPathResult(key, path)
 	if err != nil {
 		return 0, err
 	}
-	if !isExist {
-		return 0, nil
-	}
-	jpath := convertJSONPath(path)
-	var jsonData gjson.Result
-	if jpath == "" {
-		jsonData = gjson.ParseBytes(oldV)
-	} else {
-		jsonData = gjson.GetBytes(oldV, jpath)
-	}
 	if !jsonData.Exists() || !jsonData.IsArray() {
 		return 0, nil
 	}
@@ -442,24 +597,10 @@ func (db *RockDB) JArrayLen(key []byte, path []byte) (int64, error) {
 }
 
 func (db *RockDB) JObjLen(key []byte, path []byte) (int64, error) {
-	table, rk, err := extractTableFromRedisKey(key)
+	jsonData, err := db.jGetPathResult(key, path)
 	if err != nil {
 		return 0, err
 	}
-	_, oldV, isExist, err := db.getOldJSON(table, rk)
-	if err != nil {
-		return 0, err
-	}
-	if !isExist {
-		return 0, nil
-	}
-	jpath := convertJSONPath(path)
-	var jsonData gjson.Result
-	if jpath == "" {
-		jsonData = gjson.ParseBytes(oldV)
-	} else {
-		jsonData = gjson.GetBytes(oldV, jpath)
-	}
 	if !jsonData.Exists() || !jsonData.IsObject() {
 		return 0, nil
 	}
@@ -468,24 +609,10 @@ func (db *RockDB) JObjLen(key []byte, path []byte) (int64, error) {
 }
 
 func (db *RockDB) JObjKeys(key []byte, path []byte) ([]string, error) {
-	table, rk, err := extractTableFromRedisKey(key)
-	if err != nil {
-		return nil, err
-	}
-	_, oldV, isExist, err := db.getOldJSON(table, rk)
+	jsonData, err := db.jGetPathResult(key, path)
 	if err != nil {
 		return nil, err
 	}
-	if !isExist {
-		return nil, nil
-	}
-	jpath := convertJSONPath(path)
-	var jsonData gjson.Result
-	if jpath == "" {
-		jsonData = gjson.ParseBytes(oldV)
-	} else {
-		jsonData = gjson.GetBytes(oldV, jpath)
-	}
 	if !jsonData.Exists() || !jsonData.IsObject() {
 		return nil, nil
 	}
@@ -496,3 +623,430 @@ func (db *RockDB) JObjKeys(key []byte, path []byte) ([]string, error) {
 	}
 	return keys, nil
 }
+
+// update the json value of the key, the modify func should return the new json data and
+// whether it is changed. errJSONKeyNotExist will be returned if the key is not exist and
+// createIfMissing is false.
+func (db *RockDB) jUpdate(ts int64, key []byte, createIfMissing bool,
+	modify func(oldV []byte) ([]byte, bool, error)) error {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return err
+	}
+	tableIndexes := db.indexMgr.GetTableIndexes(string(table))
+	if tableIndexes != nil {
+		tableIndexes.Lock()
+		defer tableIndexes.Unlock()
+	}
+	ek, oldV, isExist, err := db.getOldJSON(table, rk)
+	if err != nil {
+		return err
+	}
+	if !isExist && !createIfMissing {
+		return errJSONKeyNotExist
+	}
+	newV, changed, err := modify(oldV)
+	if err != nil || !changed {
+		return err
+	}
+	if !isExist && tableIndexes != nil && tableIndexes.tableSchema != nil {
+		// fill the default fields while the json is created
+		newV, err = tableIndexes.tableSchema.FillJSONDefaults(newV)
+		if err != nil {
+			return err
+		}
+	}
+	if err := checkJSONValueSize(newV); err != nil {
+		return err
+	}
+	if !gjson.Valid(string(newV)) {
+		return errInvalidJSONValue
+	}
+	err = db.jsonIndexUpdate(tableIndexes, key, oldV, newV, db.wb)
+	if err != nil {
+		return err
+	}
+	err = db.jsonFullTextUpdate(tableIndexes, key, newV, db.wb)
+	if err != nil {
+		return err
+	}
+	err = db.putJSONValue(ts, table, rk, ek, newV, db.wb)
+	if err != nil {
+		return err
+	}
+	if !isExist {
+		db.IncrTableKeyCount(table, 1, db.wb)
+	}
+	return db.CommitBatchWrite()
+}
+
+func calcJSONNumber(v1 string, v2 string, mult bool) (string, error) {
+	i1, err1 := strconv.ParseInt(v1, 10, 64)
+	i2, err2 := strconv.ParseInt(v2, 10, 64)
+	if err1 == nil && err2 == nil {
+		// use float if overflow
+		if mult {
+			r := i1 * i2
+			if i1 == 0 || (r/i1 == i2 && !(i1 == -1 && i2 == math.MinInt64)) {
+				return strconv.FormatInt(r, 10), nil
+			}
+		} else {
+			r := i1 + i2
+			if (r > i1) == (i2 > 0) {
+				return strconv.FormatInt(r, 10), nil
+			}
+		}
+	}
+	f1, err := strconv.ParseFloat(v1, 64)
+	if err != nil {
+		return "", errJSONPathNotNumber
+	}
+	f2, err := strconv.ParseFloat(v2, 64)
+	if err != nil {
+		return "", errInvalidJSONValue
+	}
+	var r float64
+	if mult {
+		r = f1 * f2
+	} else {
+		r = f1 + f2
+	}
+	if math.IsInf(r, 0) || math.IsNaN(r) {
+		return "", errJSONNumberOverflow
+	}
+	return strconv.FormatFloat(r, 'g', -1, 64), nil
+}
+
+func (db *RockDB) jNumOp(ts int64, key []byte, path []byte, num []byte, mult bool) ([]byte, error) {
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret string
+	err = db.jUpdate(ts, key, false, func(oldV []byte) ([]byte, bool, error) {
+		r := getJSONPathResult(oldV, jpath)
+		if r.Type != gjson.Number {
+			return nil, false, errJSONPathNotNumber
+		}
+		var err error
+		ret, err = calcJSONNumber(r.Raw, string(num), mult)
+		if err != nil {
+			return nil, false, err
+		}
+		newV, err := db.jSetPath(oldV, jpath, []byte(ret))
+		return newV, true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(ret), nil
+}
+
+// JNumIncrBy increase the number at path and return the new number
+func (db *RockDB) JNumIncrBy(ts int64, key []byte, path []byte, num []byte) ([]byte, error) {
+	return db.jNumOp(ts, key, path, num, false)
+}
+
+// JNumMultBy multiply the number at path and return the new number
+func (db *RockDB) JNumMultBy(ts int64, key []byte, path []byte, num []byte) ([]byte, error) {
+	return db.jNumOp(ts, key, path, num, true)
+}
+
+// JStrAppend append the json string to the string at path, return the new string length
+func (db *RockDB) JStrAppend(ts int64, key []byte, path []byte, value []byte) (int64, error) {
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return 0, err
+	}
+	appended := gjson.ParseBytes(value)
+	if appended.Type != gjson.String || !gjson.Valid(string(value)) {
+		return 0, errInvalidJSONValue
+	}
+	var length int64
+	err = db.jUpdate(ts, key, false, func(oldV []byte) ([]byte, bool, error) {
+		r := getJSONPathResult(oldV, jpath)
+		if r.Type != gjson.String {
+			return nil, false, errJSONPathNotString
+		}
+		newStr := r.String() + appended.String()
+		length = int64(len(newStr))
+		raw, err := json.Marshal(newStr)
+		if err != nil {
+			return nil, false, err
+		}
+		newV, err := db.jSetPath(oldV, jpath, raw)
+		return newV, true, err
+	})
+	return length, err
+}
+
+// JStrLen return the length of the string at path, 0 if not exist or not string
+func (db *RockDB) JStrLen(key []byte, path []byte) (int64, error) {
+	jsonData, err := db.jGetPathResult(key, path)
+	if err != nil {
+		return 0, err
+	}
+	if jsonData.Type != gjson.String {
+		return 0, nil
+	}
+	return int64(len(jsonData.String())), nil
+}
+
+func buildJSONArray(elems []string) []byte {
+	return []byte("[" + strings.Join(elems, ",") + "]")
+}
+
+func jsonArrayRaws(arr []gjson.Result) []string {
+	raws := make([]string, 0, len(arr))
+	for _, e := range arr {
+		raws = append(raws, e.Raw)
+	}
+	return raws
+}
+
+// JArrayInsert insert the jsons before the index in the array at path (negative index is
+// counted from the end), return the new array length
+func (db *RockDB) JArrayInsert(ts int64, key []byte, path []byte, index int64, jsons ...[]byte) (int64, error) {
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range jsons {
+		if !gjson.Valid(string(v)) {
+			return 0, errInvalidJSONValue
+		}
+	}
+	var length int64
+	err = db.jUpdate(ts, key, false, func(oldV []byte) ([]byte, bool, error) {
+		r := getJSONPathResult(oldV, jpath)
+		if !r.IsArray() {
+			return nil, false, errJSONPathNotArray
+		}
+		raws := jsonArrayRaws(r.Array())
+		pos := index
+		if pos < 0 {
+			pos += int64(len(raws))
+		}
+		if pos < 0 || pos > int64(len(raws)) {
+			return nil, false, errJSONArrayIndexOutOfRange
+		}
+		elems := make([]string, 0, len(raws)+len(jsons))
+		elems = append(elems, raws[:pos]...)
+		for _, v := range jsons {
+			elems = append(elems, string(v))
+		}
+		elems = append(elems, raws[pos:]...)
+		length = int64(len(elems))
+		newV, err := db.jSetPath(oldV, jpath, buildJSONArray(elems))
+		return newV, true, err
+	})
+	return length, err
+}
+
+func isJSONValueEqual(a gjson.Result, b gjson.Result) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	switch a.Type {
+	case gjson.Number:
+		return a.Float() == b.Float()
+	case gjson.String:
+		return a.String() == b.String()
+	case gjson.JSON:
+		return a.Raw == b.Raw
+	default:
+		return true
+	}
+}
+
+// JArrayIndex return the first index of the json scalar value in the array at path,
+// the search range is [start, stop), stop 0 means the end of the array. -1 will be
+// returned if not found.
+func (db *RockDB) JArrayIndex(key []byte, path []byte, value []byte, start int64, stop int64) (int64, error) {
+	if !gjson.Valid(string(value)) {
+		return -1, errInvalidJSONValue
+	}
+	jsonData, err := db.jGetPathResult(key, path)
+	if err != nil {
+		return -1, err
+	}
+	if !jsonData.IsArray() {
+		return -1, nil
+	}
+	arr := jsonData.Array()
+	size := int64(len(arr))
+	if start < 0 {
+		start += size
+		if start < 0 {
+			start = 0
+		}
+	}
+	if stop <= 0 {
+		stop += size
+	}
+	if stop > size {
+		stop = size
+	}
+	v := gjson.ParseBytes(value)
+	for i := start; i < stop; i++ {
+		if isJSONValueEqual(arr[i], v) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// JArrayTrim trim the array at path to the range [start, stop], return the new array length
+func (db *RockDB) JArrayTrim(ts int64, key []byte, path []byte, start int64, stop int64) (int64, error) {
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return 0, err
+	}
+	var length int64
+	err = db.jUpdate(ts, key, false, func(oldV []byte) ([]byte, bool, error) {
+		r := getJSONPathResult(oldV, jpath)
+		if !r.IsArray() {
+			return nil, false, errJSONPathNotArray
+		}
+		raws := jsonArrayRaws(r.Array())
+		size := int64(len(raws))
+		s, e := start, stop
+		if s < 0 {
+			s += size
+			if s < 0 {
+				s = 0
+			}
+		}
+		if e < 0 {
+			e += size
+		}
+		if e >= size {
+			e = size - 1
+		}
+		if s >= size || s > e {
+			raws = raws[:0]
+		} else {
+			raws = raws[s : e+1]
+		}
+		length = int64(len(raws))
+		newV, err := db.jSetPath(oldV, jpath, buildJSONArray(raws))
+		return newV, true, err
+	})
+	return length, err
+}
+
+// JToggle toggle the boolean value at path and return the new value
+func (db *RockDB) JToggle(ts int64, key []byte, path []byte) (bool, error) {
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return false, err
+	}
+	var ret bool
+	err = db.jUpdate(ts, key, false, func(oldV []byte) ([]byte, bool, error) {
+		r := getJSONPathResult(oldV, jpath)
+		if r.Type != gjson.True && r.Type != gjson.False {
+			return nil, false, errJSONPathNotBool
+		}
+		ret = r.Type == gjson.False
+		newV, err := db.jSetPath(oldV, jpath, []byte(strconv.FormatBool(ret)))
+		return newV, true, err
+	})
+	return ret, err
+}
+
+// JClear clear the array or object to empty and set the number to 0 at path,
+// return 1 if the value is cleared.
+func (db *RockDB) JClear(ts int64, key []byte, path []byte) (int64, error) {
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return 0, err
+	}
+	var cnt int64
+	err = db.jUpdate(ts, key, false, func(oldV []byte) ([]byte, bool, error) {
+		r := getJSONPathResult(oldV, jpath)
+		var cleared string
+		switch {
+		case r.IsArray() && len(r.Array()) > 0:
+			cleared = "[]"
+		case r.IsObject() && len(r.Map()) > 0:
+			cleared = "{}"
+		case r.Type == gjson.Number && r.Float() != 0:
+			cleared = "0"
+		default:
+			return nil, false, nil
+		}
+		cnt = 1
+		newV, err := db.jSetPath(oldV, jpath, []byte(cleared))
+		return newV, true, err
+	})
+	if err == errJSONKeyNotExist {
+		return 0, nil
+	}
+	return cnt, err
+}
+
+type jsonObjectField struct {
+	rawKey string
+	key    string
+	value  string
+}
+
+// merge the patch to the target json value using RFC 7396 and return the merged raw json,
+// the fields order of the target will be kept and the new fields will be appended.
+func jsonMergePatch(target gjson.Result, patch gjson.Result) string {
+	if !patch.IsObject() {
+		return patch.Raw
+	}
+	fields := make([]jsonObjectField, 0, 8)
+	if target.IsObject() {
+		target.ForEach(func(k, v gjson.Result) bool {
+			fields = append(fields, jsonObjectField{rawKey: k.Raw, key: k.String(), value: v.Raw})
+			return true
+		})
+	}
+	patch.ForEach(func(k, v gjson.Result) bool {
+		pos := -1
+		for i, f := range fields {
+			if f.key == k.String() {
+				pos = i
+				break
+			}
+		}
+		if v.Type == gjson.Null {
+			if pos >= 0 {
+				fields = append(fields[:pos], fields[pos+1:]...)
+			}
+			return true
+		}
+		if pos >= 0 {
+			fields[pos].value = jsonMergePatch(gjson.Parse(fields[pos].value), v)
+		} else {
+			fields = append(fields, jsonObjectField{rawKey: k.Raw, key: k.String(),
+				value: jsonMergePatch(gjson.Result{}, v)})
+		}
+		return true
+	})
+	elems := make([]string, 0, len(fields))
+	for _, f := range fields {
+		elems = append(elems, f.rawKey+":"+f.value)
+	}
+	return "{" + strings.Join(elems, ",") + "}"
+}
+
+// JMerge merge the json value to the path using the RFC 7396 json merge patch,
+// the key will be created if not exist and the path is root.
+func (db *RockDB) JMerge(ts int64, key []byte, path []byte, value []byte) error {
+	jpath, err := convertJSONWritePath(path)
+	if err != nil {
+		return err
+	}
+	if !gjson.Valid(string(value)) {
+		return errInvalidJSONValue
+	}
+	patch := gjson.ParseBytes(value)
+	return db.jUpdate(ts, key, jpath == "", func(oldV []byte) ([]byte, bool, error) {
+		merged := jsonMergePatch(getJSONPathResult(oldV, jpath), patch)
+		newV, err := db.jSetPath(oldV, jpath, []byte(merged))
+		return newV, true, err
+	})
+}
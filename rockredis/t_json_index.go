@@ -0,0 +1,75 @@
+package rockredis
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// get the value at the json path for the query filter, nil will be returned if the path
+// is not exist or the value is not a scalar.
+func getJSONIndexValue(jdata []byte, jpath string) []byte {
+	if jdata == nil {
+		return nil
+	}
+	r := getJSONPathResult(jdata, jpath)
+	switch r.Type {
+	case gjson.String:
+		return []byte(r.Str)
+	case gjson.Number, gjson.True, gjson.False:
+		return []byte(r.Raw)
+	}
+	return nil
+}
+
+// the json value is schemaless, so the value which can not be converted to the
+// index value type will be ignored instead of failing the write.
+func (self *JSONIndex) indexValue(jdata []byte) []byte {
+	v := getJSONIndexValue(jdata, string(self.IndexField))
+	if v == nil {
+		return nil
+	}
+	if self.ValueType == Int64V || self.ValueType == Int32V {
+		if _, err := strconv.ParseInt(string(v), 10, 64); err != nil {
+			return nil
+		}
+	}
+	return v
+}
+
+// update the json indexes using the whole old and new json data, the nil data
+// means the json key is not exist.
+func (db *RockDB) jsonIndexUpdate(tableIndexes *TableIndexContainer, key []byte,
+	oldJSON []byte, newJSON []byte, wb engine.WriteBatch) error {
+	if tableIndexes == nil {
+		return nil
+	}
+	for _, index := range tableIndexes.GetJSONIndexesNoLock() {
+		oldV := index.indexValue(oldJSON)
+		newV := index.indexValue(newJSON)
+		if bytes.Equal(oldV, newV) {
+			continue
+		}
+		err := index.UpdateRec(db, oldV, newV, key, wb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONIndexSearch return the json keys for matching path value
+func (db *RockDB) JSONIndexSearch(table []byte, path []byte, cond *IndexCondition, countOnly bool) (IndexPropertyDType, int64, []HIndexResp, error) {
+	jindex, err := db.getIndexer().GetJSONIndex(string(table), string(path))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if jindex.State == DeletedIndex {
+		return jindex.ValueType, 0, nil, ErrIndexDeleted
+	}
+
+	n, ret, err := jindex.SearchRec(db, cond, countOnly)
+	return jindex.ValueType, n, ret, err
+}
@@ -0,0 +1,206 @@
+package rockredis
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func waitJSONIndexBuildDone(t *testing.T, db *RockDB, table string, path string) {
+	buildStart := time.Now()
+	for {
+		time.Sleep(time.Millisecond * 10)
+		tableIndexes := db.indexMgr.GetTableIndexes(table)
+		assert.NotNil(t, tableIndexes)
+		tableIndexes.Lock()
+		state := tableIndexes.jsonIndexes[convertJSONPath([]byte(path))].State
+		tableIndexes.Unlock()
+		if state == BuildDoneIndex {
+			break
+		} else if time.Since(buildStart) > time.Second*10 {
+			t.Errorf("building index timeout")
+			break
+		}
+	}
+}
+
+func TestJSONIndexQuery(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := "test_json_index"
+	keyOf := func(i int) []byte {
+		return []byte(table + ":" + strconv.Itoa(i))
+	}
+	// the data written before the index added should be indexed while building
+	for i := 0; i < 5; i++ {
+		doc := `{"name":"user` + strconv.Itoa(i) + `","age":` + strconv.Itoa(20+i) +
+			`,"address":{"city":"c` + strconv.Itoa(i%2) + `"},"tags":[]}`
+		_, err := db.JSet(0, keyOf(i), []byte(""), []byte(doc))
+		assert.Nil(t, err)
+	}
+
+	jindexes := []*common.JSONIndexSchema{
+		{Name: "age_index", Path: "age", ValueType: common.Int64V},
+		{Name: "city_index", Path: "$.address.city", ValueType: common.StringV},
+		{Name: "tag_index", Path: "tags.0", ValueType: common.StringV},
+	}
+	for _, jindex := range jindexes {
+		err := db.AddJSONIndex(table, jindex)
+		assert.Nil(t, err)
+		jindex.State = common.BuildingIndex
+		err = db.UpdateJSONIndexState(table, jindex)
+		assert.Nil(t, err)
+		waitJSONIndexBuildDone(t, db, table, jindex.Path)
+	}
+	err := db.AddJSONIndex(table, &common.JSONIndexSchema{Name: "all_names", Path: "$..name", ValueType: common.StringV})
+	assert.Equal(t, errJSONPathNotSupport, err)
+	schema, err := db.GetIndexSchema(table)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(schema.JSONIndexes))
+
+	query := func(where string) []string {
+		expr, err := ParseIndexQueryWhere([]byte(where))
+		assert.Nil(t, err, where)
+		rets, err := db.JSONIndexQuery([]byte(table), expr, 0, -1)
+		assert.Nil(t, err, where)
+		keys := make([]string, 0, len(rets))
+		for _, r := range rets {
+			keys = append(keys, string(r.PKey))
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	keysOf := func(ids ...int) []string {
+		keys := make([]string, 0, len(ids))
+		for _, i := range ids {
+			keys = append(keys, string(keyOf(i)))
+		}
+		return keys
+	}
+
+	assert.Equal(t, keysOf(2, 3, 4), query("age >= 22"))
+	assert.Equal(t, keysOf(0, 2), query("address.city = c0 and age < 24"))
+	assert.Equal(t, keysOf(1, 3), query("$.address.city = 'c1'"))
+	_, _, rets, err := db.JSONIndexSearch([]byte(table), []byte("age"),
+		&IndexCondition{StartKey: []byte("24"), IncludeStart: true, Limit: -1}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, int64(24), rets[0].IndexIntValue)
+
+	_, err = db.JSet(0, keyOf(0), []byte("age"), []byte("30"))
+	assert.Nil(t, err)
+	assert.Equal(t, keysOf(0), query("age > 25"))
+	// change the parent of the indexed path
+	_, err = db.JSet(0, keyOf(1), []byte("address"), []byte(`{"city":"c0"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, keysOf(0, 1, 2, 4), query("address.city = c0"))
+
+	_, err = db.JArrayAppend(0, keyOf(4), []byte("tags"), []byte(`"vip"`))
+	assert.Nil(t, err)
+	assert.Equal(t, keysOf(4), query("tags.0 = vip"))
+	assert.Equal(t, keysOf(1, 4), query("tags.0 = vip or age = 21"))
+
+	// the value not matching the index type will not be indexed
+	_, err = db.JSet(0, keyOf(1), []byte("age"), []byte(`"unknown"`))
+	assert.Nil(t, err)
+	assert.Equal(t, keysOf(0, 2, 3, 4), query("age < 100"))
+
+	_, err = db.JDel(0, keyOf(3), []byte("age"))
+	assert.Nil(t, err)
+	assert.Equal(t, keysOf(0, 2, 4), query("age >= 22"))
+	_, err = db.JDel(0, keyOf(2), []byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, keysOf(0, 4), query("age >= 22"))
+	assert.Equal(t, keysOf(0, 1, 4), query("address.city = c0"))
+
+	_, err = db.JArrayPop(0, keyOf(4), []byte("tags"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(query("tags.0 = vip")))
+
+	// the hash index should not be used for json query
+	expr, err := ParseIndexQueryWhere([]byte("name = user0"))
+	assert.Nil(t, err)
+	_, err = db.JSONIndexQuery([]byte(table), expr, 0, -1)
+	assert.Equal(t, ErrIndexNotExist, err)
+}
+
+func TestJSONIndexPathNormalize(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := "test_json_index_path"
+	for i := 0; i < 3; i++ {
+		doc := `{"age":` + strconv.Itoa(20+i) + `,"address":{"city":"c` + strconv.Itoa(i) + `"}}`
+		_, err := db.JSet(0, []byte(table+":"+strconv.Itoa(i)), []byte(""), []byte(doc))
+		assert.Nil(t, err)
+	}
+	jindex := &common.JSONIndexSchema{Name: "age_index", Path: " $.age ", ValueType: common.Int64V}
+	err := db.AddJSONIndex(table, jindex)
+	assert.Nil(t, err)
+	// the same path in other forms should be the same index
+	for _, p := range []string{"age", ".age", "$['age']"} {
+		err = db.AddJSONIndex(table, &common.JSONIndexSchema{Name: "dup_index", Path: p, ValueType: common.Int64V})
+		assert.Equal(t, ErrIndexExist, err, p)
+	}
+	jindex.Path = "age"
+	jindex.State = common.BuildingIndex
+	err = db.UpdateJSONIndexState(table, jindex)
+	assert.Nil(t, err)
+	waitJSONIndexBuildDone(t, db, table, "$.age")
+
+	err = db.AddJSONIndex(table, &common.JSONIndexSchema{Name: "city_index", Path: "address.city", ValueType: common.StringV})
+	assert.Nil(t, err)
+	err = db.UpdateJSONIndexState(table, &common.JSONIndexSchema{Name: "city_index", Path: "$.address.city", State: common.BuildingIndex})
+	assert.Nil(t, err)
+	waitJSONIndexBuildDone(t, db, table, ".address.city")
+
+	for _, p := range []string{"age", ".age", "$.age", " $.age", "$['age']"} {
+		_, _, rets, err := db.JSONIndexSearch([]byte(table), []byte(p),
+			&IndexCondition{StartKey: []byte("21"), IncludeStart: true, Limit: -1}, false)
+		assert.Nil(t, err, p)
+		assert.Equal(t, 2, len(rets), p)
+	}
+	for _, p := range []string{"address.city", "$.address.city", "$.address['city']"} {
+		_, _, rets, err := db.JSONIndexSearch([]byte(table), []byte(p),
+			&IndexCondition{StartKey: []byte("c1"), IncludeStart: true, EndKey: []byte("c1"), IncludeEnd: true, Limit: -1}, false)
+		assert.Nil(t, err, p)
+		assert.Equal(t, 1, len(rets), p)
+	}
+
+	// the stored indexes should be loaded with the normalized path
+	indexes := db.indexMgr.GetTableIndexes(table)
+	indexes.RLock()
+	data, err := indexes.marshalJSONIndexes()
+	indexes.RUnlock()
+	assert.Nil(t, err)
+	loaded := NewIndexContainer()
+	err = loaded.unmarshalJSONIndexes([]byte(table), data)
+	assert.Nil(t, err)
+	assert.NotNil(t, loaded.GetJSONIndexNoLock("$.age"))
+	assert.NotNil(t, loaded.GetJSONIndexNoLock("address.city"))
+
+	jindex.Path = ".age"
+	jindex.State = common.DeletedIndex
+	err = db.UpdateJSONIndexState(table, jindex)
+	assert.Nil(t, err)
+	start := time.Now()
+	for {
+		_, err = db.indexMgr.GetJSONIndex(table, "age")
+		if err == ErrIndexNotExist {
+			break
+		}
+		if time.Since(start) > time.Second*10 {
+			t.Errorf("deleting index timeout")
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
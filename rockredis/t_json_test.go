@@ -2,6 +2,7 @@ package rockredis
 
 import (
 	"os"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -369,3 +370,267 @@ func TestDBJSONKeyArrayOp(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, int64(0), n)
 }
+
+func TestJSONPathQuery(t *testing.T) {
+	jdata := []byte(`{"a":{"name":"n1","b":[{"name":"n2"},{"x":1}]},"name":"n0","c.d":2,"arr":[1,2,3]}`)
+	tests := []struct {
+		path string
+		rets []string
+	}{
+		{"$", []string{string(jdata)}},
+		{"$.name", []string{`"n0"`}},
+		{"$.a.name", []string{`"n1"`}},
+		{"$['c.d']", []string{"2"}},
+		{"$.arr[1]", []string{"2"}},
+		{"$.arr[-1]", []string{"3"}},
+		{"$.arr[*]", []string{"1", "2", "3"}},
+		{"$..name", []string{`"n0"`, `"n1"`, `"n2"`}},
+		{"$.a..name", []string{`"n1"`, `"n2"`}},
+		{"$..b[1].x", []string{"1"}},
+		{"$.notexist", []string{}},
+	}
+	for _, tt := range tests {
+		rets, err := queryJSONPath(jdata, tt.path)
+		assert.Nil(t, err, tt.path)
+		raws := make([]string, 0, len(rets))
+		for _, r := range rets {
+			raws = append(raws, r.Raw)
+		}
+		sort.Strings(raws)
+		assert.Equal(t, tt.rets, raws, tt.path)
+	}
+	for _, p := range []string{"$.", "$[", "$[abc]", "$['a'", "a.b"} {
+		_, err := queryJSONPath(jdata, p)
+		assert.Equal(t, errInvalidJSONPath, err, p)
+	}
+
+	assert.Equal(t, "a.b.0", convertJSONPath([]byte("$.a.b[0]")))
+	assert.Equal(t, `c\.d`, convertJSONPath([]byte("$['c.d']")))
+	assert.Equal(t, "", convertJSONPath([]byte("$")))
+	assert.Equal(t, "$..a", convertJSONPath([]byte("$..a")))
+	_, err := convertJSONWritePath([]byte("$..a"))
+	assert.Equal(t, errJSONPathNotSupport, err)
+	_, err = convertJSONWritePath([]byte("$.a[*]"))
+	assert.Equal(t, errJSONPathNotSupport, err)
+	assert.Equal(t, "2", gjson.Get(string(jdata), convertJSONPath([]byte("$['c.d']"))).Raw)
+}
+
+func TestDBJSONPathGet(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	key := []byte("test:jsonkey_path_test")
+	key2 := []byte("test:jsonkey_path_test2")
+
+	_, err := db.JSet(0, key, []byte(""), []byte(`{"a":{"name":"n1"},"name":"n0","arr":[1,2]}`))
+	assert.Nil(t, err)
+	_, err = db.JSet(0, key2, []byte(""), []byte(`{"name":"n2"}`))
+	assert.Nil(t, err)
+
+	rets, err := db.JGet(key, []byte("$..name"), []byte("$.a.name"), []byte("a.name"), []byte("$.notexist"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`["n0","n1"]`, `["n1"]`, "n1", "[]"}, rets)
+
+	typeStr, err := db.JType(key, []byte("$.arr"))
+	assert.Nil(t, err)
+	assert.Equal(t, "array", typeStr)
+	n, err := db.JArrayLen(key, []byte("$.arr"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = db.JArrayAppend(0, key, []byte("$.arr"), []byte("3"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	_, err = db.JArrayAppend(0, key, []byte("$..arr"), []byte("3"))
+	assert.Equal(t, errJSONPathNotSupport, err)
+	_, err = db.JSet(0, key, []byte("$..name"), []byte(`"n"`))
+	assert.Equal(t, errJSONPathNotSupport, err)
+
+	vals, err := db.JMGet([]byte("name"), key, []byte("test:jsonkey_path_notexist"), key2)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("n0"), nil, []byte("n2")}, vals)
+	vals, err = db.JMGet([]byte("$..name"), key, key2)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte(`["n0","n1"]`), []byte(`["n2"]`)}, vals)
+	vals, err = db.JMGet([]byte("a.notexist"), key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{nil}, vals)
+}
+
+func TestDBJSONNumAndStrOp(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	key := []byte("test:jsonkey_num_str_test")
+
+	_, err := db.JNumIncrBy(0, key, []byte("a"), []byte("1"))
+	assert.Equal(t, errJSONKeyNotExist, err)
+
+	_, err = db.JSet(0, key, []byte(""), []byte(`{"a":1,"f":1.5,"s":"hello","b":true}`))
+	assert.Nil(t, err)
+
+	v, err := db.JNumIncrBy(0, key, []byte("a"), []byte("2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "3", string(v))
+	v, err = db.JNumMultBy(0, key, []byte("$.a"), []byte("3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "9", string(v))
+	v, err = db.JNumIncrBy(0, key, []byte("f"), []byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2.5", string(v))
+	v, err = db.JNumMultBy(0, key, []byte("a"), []byte("0.5"))
+	assert.Nil(t, err)
+	assert.Equal(t, "4.5", string(v))
+	_, err = db.JNumIncrBy(0, key, []byte("s"), []byte("1"))
+	assert.Equal(t, errJSONPathNotNumber, err)
+	_, err = db.JNumIncrBy(0, key, []byte("a"), []byte("abc"))
+	assert.Equal(t, errInvalidJSONValue, err)
+
+	v, err = db.JNumIncrBy(0, key, []byte("a"), []byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "5.5", string(v))
+	_, err = db.JSet(0, key, []byte("big"), []byte("9223372036854775807"))
+	assert.Nil(t, err)
+	v, err = db.JNumIncrBy(0, key, []byte("big"), []byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "9.223372036854776e+18", string(v))
+
+	n, err := db.JStrAppend(0, key, []byte("s"), []byte(`" world"`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), n)
+	n, err = db.JStrLen(key, []byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), n)
+	rets, err := db.JGet(key, []byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", rets[0])
+	_, err = db.JStrAppend(0, key, []byte("s"), []byte(`world`))
+	assert.Equal(t, errInvalidJSONValue, err)
+	_, err = db.JStrAppend(0, key, []byte("a"), []byte(`"world"`))
+	assert.Equal(t, errJSONPathNotString, err)
+	n, err = db.JStrLen(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+
+	b, err := db.JToggle(0, key, []byte("b"))
+	assert.Nil(t, err)
+	assert.False(t, b)
+	b, err = db.JToggle(0, key, []byte("b"))
+	assert.Nil(t, err)
+	assert.True(t, b)
+	_, err = db.JToggle(0, key, []byte("a"))
+	assert.Equal(t, errJSONPathNotBool, err)
+}
+
+func TestDBJSONArrayInsertTrimIndex(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	key := []byte("test:jsonkey_array_insert_test")
+
+	_, err := db.JSet(0, key, []byte(""), []byte(`{"arr":[1,2,3],"s":"str"}`))
+	assert.Nil(t, err)
+
+	n, err := db.JArrayInsert(0, key, []byte("arr"), 1, []byte(`"a"`), []byte(`{"b":1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	rets, err := db.JGet(key, []byte("arr"))
+	assert.Nil(t, err)
+	assert.Equal(t, `[1,"a",{"b":1},2,3]`, rets[0])
+	n, err = db.JArrayInsert(0, key, []byte("arr"), -1, []byte(`4`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), n)
+	n, err = db.JArrayInsert(0, key, []byte("arr"), 6, []byte(`5`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), n)
+	rets, err = db.JGet(key, []byte("arr"))
+	assert.Nil(t, err)
+	assert.Equal(t, `[1,"a",{"b":1},2,4,3,5]`, rets[0])
+	_, err = db.JArrayInsert(0, key, []byte("arr"), 8, []byte(`5`))
+	assert.Equal(t, errJSONArrayIndexOutOfRange, err)
+	_, err = db.JArrayInsert(0, key, []byte("s"), 0, []byte(`5`))
+	assert.Equal(t, errJSONPathNotArray, err)
+	_, err = db.JArrayInsert(0, key, []byte("arr"), 0, []byte(`invalid`))
+	assert.Equal(t, errInvalidJSONValue, err)
+
+	idx, err := db.JArrayIndex(key, []byte("arr"), []byte(`"a"`), 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), idx)
+	idx, err = db.JArrayIndex(key, []byte("arr"), []byte(`3`), 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), idx)
+	idx, err = db.JArrayIndex(key, []byte("arr"), []byte(`3`), 0, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), idx)
+	idx, err = db.JArrayIndex(key, []byte("arr"), []byte(`1`), -6, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), idx)
+	idx, err = db.JArrayIndex(key, []byte("s"), []byte(`1`), 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), idx)
+
+	n, err = db.JArrayTrim(0, key, []byte("arr"), 1, -2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	rets, err = db.JGet(key, []byte("arr"))
+	assert.Nil(t, err)
+	assert.Equal(t, `["a",{"b":1},2,4,3]`, rets[0])
+	n, err = db.JArrayTrim(0, key, []byte("arr"), 2, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	n, err = db.JArrayTrim(0, key, []byte("arr"), 2, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.JArrayLen(key, []byte("arr"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestDBJSONClearAndMerge(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+	key := []byte("test:jsonkey_clear_merge_test")
+
+	n, err := db.JClear(0, key, []byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	err = db.JMerge(0, key, []byte("a"), []byte(`{"b":1}`))
+	assert.Equal(t, errJSONKeyNotExist, err)
+
+	err = db.JMerge(0, key, []byte(""), []byte(`{"a":{"b":1,"c":[1,2]},"n":1,"s":"str","d":null}`))
+	assert.Nil(t, err)
+	rets, err := db.JGet(key, []byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":{"b":1,"c":[1,2]},"n":1,"s":"str"}`, rets[0])
+
+	err = db.JMerge(0, key, []byte(""), []byte(`{"a":{"b":null,"c":[3],"e":{"f":1}},"s":null,"x.y":1}`))
+	assert.Nil(t, err)
+	rets, err = db.JGet(key, []byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":{"c":[3],"e":{"f":1}},"n":1,"x.y":1}`, rets[0])
+	err = db.JMerge(0, key, []byte("a.e"), []byte(`{"g":2}`))
+	assert.Nil(t, err)
+	err = db.JMerge(0, key, []byte("$.n"), []byte(`{"g":2}`))
+	assert.Nil(t, err)
+	rets, err = db.JGet(key, []byte("a.e"), []byte("n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`{"f":1,"g":2}`, `{"g":2}`}, rets)
+
+	n, err = db.JClear(0, key, []byte("a.c"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.JClear(0, key, []byte("a.c"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = db.JClear(0, key, []byte("n"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = db.JClear(0, key, []byte("$['x.y']"))
+	assert.Equal(t, errJSONPathNotSupport, err)
+	n, err = db.JClear(0, key, []byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	rets, err = db.JGet(key, []byte(""))
+	assert.Nil(t, err)
+	assert.Equal(t, `{}`, rets[0])
+}
@@ -1,7 +1,6 @@
 package rockredis
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -256,6 +255,11 @@ func (db *RockDB) incr(ts int64, key []byte, delta int64) (int64, error) {
 	if realV == nil || keyInfo.Expired {
 		// expired will rewrite old, which should not change table counter
 		created = (realV == nil)
+		if old := decodeChunkManifest(realV); old != nil {
+			if err := db.delKVValueChunks(key, old, db.wb); err != nil {
+				return 0, err
+			}
+		}
 	} else {
 		n, err = StrInt64(realV, err)
 		if err != nil {
@@ -283,9 +287,17 @@ func (db *RockDB) kvDel(key []byte, wb engine.WriteBatch) (int64, error) {
 		return 0, err
 	}
 	delCnt := int64(1)
+	old, vok, err := db.getKVChunkManifestNoLock(key)
+	if err != nil {
+		return 0, err
+	}
+	if old != nil {
+		if err := db.delKVValueChunks(rawKey, old, wb); err != nil {
+			return 0, err
+		}
+	}
 	if db.cfg.EnableTableCounter {
 		if !db.cfg.EstimateTableCounter {
-			vok, _ := db.ExistNoLock(key)
 			if vok {
 				db.IncrTableKeyCount(table, -1, wb)
 			} else {
@@ -303,13 +315,22 @@ func (db *RockDB) kvDel(key []byte, wb engine.WriteBatch) (int64, error) {
 }
 
 func (db *RockDB) KVDelWithBatch(key []byte, wb engine.WriteBatch) error {
+	rawKey := key
 	table, key, err := convertRedisKeyToDBKVKey(key)
 	if err != nil {
 		return err
 	}
+	old, vok, err := db.getKVChunkManifestNoLock(key)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		if err := db.delKVValueChunks(rawKey, old, wb); err != nil {
+			return err
+		}
+	}
 	if db.cfg.EnableTableCounter {
 		if !db.cfg.EstimateTableCounter {
-			vok, _ := db.ExistNoLock(key)
 			if vok {
 				db.IncrTableKeyCount(table, -1, wb)
 			}
@@ -397,42 +418,65 @@ func (db *RockDB) KVGetVer(key []byte) (int64, error) {
 
 func (db *RockDB) GetValueWithOpNoLock(rawKey []byte,
 	op func([]byte) error) error {
-	_, key, err := convertRedisKeyToDBKVKey(rawKey)
-	if err != nil {
-		return err
-	}
-	return db.rockEng.GetValueWithOpNoLock(key, func(v []byte) error {
-		ts := time.Now().UnixNano()
-		expired, realV, err := db.getAndCheckExpRealValue(ts, rawKey, v, false)
-		if err != nil {
-			return err
-		}
-		if expired {
-			realV = nil
-		}
-		return op(realV)
-	})
+	return db.getValueWithOp(rawKey, false, op)
 }
 
 func (db *RockDB) GetValueWithOp(rawKey []byte,
 	op func([]byte) error) error {
-	_, key, err := convertRedisKeyToDBKVKey(rawKey)
-	if err != nil {
-		return err
-	}
-	return db.rockEng.GetValueWithOp(key, func(v []byte) error {
-		ts := time.Now().UnixNano()
-		expired, realV, err := db.getAndCheckExpRealValue(ts, rawKey, v, false)
-		if err != nil {
-			return err
+	return db.getValueWithOp(rawKey, true, op)
+}
+
+// the chunked value will be assembled before passed to op, use GetValueWithChunkOp to avoid
+// assembling the large value.
+func (db *RockDB) getValueWithOp(rawKey []byte, useLock bool,
+	op func([]byte) error) error {
+	var buf []byte
+	return db.kvGetWithChunkOp(rawKey, useLock, 0, -1, func(size int64, data []byte) error {
+		if size < 0 {
+			return op(nil)
 		}
-		if expired {
-			realV = nil
+		if buf == nil && int64(len(data)) == size {
+			return op(data)
 		}
-		return op(realV)
+		if buf == nil {
+			buf = make([]byte, 0, size)
+		}
+		buf = append(buf, data...)
+		if int64(len(buf)) == size {
+			return op(buf)
+		}
+		return nil
 	})
 }
 
+// GetValueWithChunkOp read the kv value and call the op for each chunk of the value, the op will be
+// called only once if the value is not chunked. The size passed to op is the total size of the value
+// and -1 means the key is not exist. The data passed to op is only valid until op returns.
+func (db *RockDB) GetValueWithChunkOp(rawKey []byte, op func(size int64, data []byte) error) error {
+	return db.kvGetWithChunkOp(rawKey, true, 0, -1, op)
+}
+
+func (db *RockDB) GetValueWithChunkOpNoLock(rawKey []byte, op func(size int64, data []byte) error) error {
+	return db.kvGetWithChunkOp(rawKey, false, 0, -1, op)
+}
+
+// read the kv value in [start, end], only the chunks involved will be read for the chunked value
+func (db *RockDB) kvGetRange(rawKey []byte, useLock bool, start int64, end int64) ([]byte, error) {
+	var v []byte
+	err := db.kvGetWithChunkOp(rawKey, useLock, start, end, func(size int64, data []byte) error {
+		if v == nil {
+			s, e := getRange(start, end, size)
+			if s > e {
+				return nil
+			}
+			v = make([]byte, 0, e-s+1)
+		}
+		v = append(v, data...)
+		return nil
+	})
+	return v, err
+}
+
 func (db *RockDB) KVGet(key []byte) ([]byte, error) {
 	tn := time.Now().UnixNano()
 	keyInfo, v, err := db.getDBKVRealValueAndHeader(tn, key, true)
@@ -442,6 +486,9 @@ func (db *RockDB) KVGet(key []byte) ([]byte, error) {
 	if keyInfo.Expired || v == nil {
 		return nil, nil
 	}
+	if decodeChunkManifest(v) != nil {
+		return db.kvGetRange(key, true, 0, -1)
+	}
 	return v, err
 }
 
@@ -476,6 +523,8 @@ func (db *RockDB) MGet(keys ...[]byte) ([][]byte, []error) {
 				errs[i] = err
 			} else if expired {
 				valueList[i] = nil
+			} else if decodeChunkManifest(realV) != nil {
+				valueList[i], errs[i] = db.kvGetRange(keys[i], true, 0, -1)
 			} else {
 				valueList[i] = realV
 			}
@@ -497,20 +546,32 @@ func (db *RockDB) MSet(ts int64, args ...common.KVRecord) error {
 	var value []byte
 	tableCnt := make(map[string]int)
 	var table []byte
+	// only the last value of the same key will be written, so the chunks of the
+	// skipped value will not be left in db.
+	lastIndex := make(map[string]int, len(args))
+	for i := 0; i < len(args); i++ {
+		lastIndex[string(args[i].Key)] = i
+	}
 
 	for i := 0; i < len(args); i++ {
 		table, key, err = convertRedisKeyToDBKVKey(args[i].Key)
 		if err != nil {
 			return err
-		} else if err = checkValueSize(args[i].Value); err != nil {
+		} else if err = checkKVValueSize(args[i].Value); err != nil {
+			return err
+		}
+		if lastIndex[string(args[i].Key)] != i {
+			continue
+		}
+		old, vok, err := db.getKVChunkManifestNoLock(key)
+		if err != nil {
 			return err
 		}
 		value = value[:0]
 		value = append(value, args[i].Value...)
 		if db.cfg.EnableTableCounter {
-			vok := false
-			if !db.cfg.EstimateTableCounter {
-				vok, _ = db.ExistNoLock(key)
+			if db.cfg.EstimateTableCounter {
+				vok = false
 			}
 			if !vok {
 				n := tableCnt[string(table)]
@@ -518,6 +579,10 @@ func (db *RockDB) MSet(ts int64, args ...common.KVRecord) error {
 				tableCnt[string(table)] = n
 			}
 		}
+		value, err = db.replaceKVValueChunks(ts, args[i].Key, old, value, db.wb)
+		if err != nil {
+			return err
+		}
 		value, err = db.resetWithNewKVValue(ts, args[i].Key, value, 0, db.wb)
 		if err != nil {
 			return err
@@ -537,7 +602,7 @@ func (db *RockDB) KVSet(ts int64, rawKey []byte, value []byte) error {
 }
 
 func (db *RockDB) KVSetWithOpts(ts int64, rawKey []byte, value []byte, duration int64, createOnly bool, updateOnly bool) (int64, error) {
-	if err := checkValueSize(value); err != nil {
+	if err := checkKVValueSize(value); err != nil {
 		return 0, err
 	}
 	keyInfo, realV, err := db.prepareKVValueForWrite(ts, rawKey, false)
@@ -555,6 +620,10 @@ func (db *RockDB) KVSetWithOpts(ts int64, rawKey []byte, value []byte, duration
 	if realV == nil && !keyInfo.Expired {
 		db.IncrTableKeyCount(keyInfo.Table, 1, db.wb)
 	}
+	value, err = db.replaceKVValueChunks(ts, rawKey, decodeChunkManifest(realV), value, db.wb)
+	if err != nil {
+		return 0, err
+	}
 	// prepare for write will renew the expire data on expired value,
 	// however, we still need del the old expire meta data since it may store the
 	// expire meta data in different place under different expire policy.
@@ -568,18 +637,25 @@ func (db *RockDB) setKV(ts int64, rawKey []byte, value []byte, duration int64) e
 	table, key, err := convertRedisKeyToDBKVKey(rawKey)
 	if err != nil {
 		return err
-	} else if err = checkValueSize(value); err != nil {
+	} else if err = checkKVValueSize(value); err != nil {
+		return err
+	}
+	old, found, err := db.getKVChunkManifestNoLock(key)
+	if err != nil {
 		return err
 	}
 	if db.cfg.EnableTableCounter {
-		found := false
-		if !db.cfg.EstimateTableCounter {
-			found, _ = db.ExistNoLock(key)
+		if db.cfg.EstimateTableCounter {
+			found = false
 		}
 		if !found {
 			db.IncrTableKeyCount(table, 1, db.wb)
 		}
 	}
+	value, err = db.replaceKVValueChunks(ts, rawKey, old, value, db.wb)
+	if err != nil {
+		return err
+	}
 	value, err = db.resetWithNewKVValue(ts, rawKey, value, duration, db.wb)
 	if err != nil {
 		return err
@@ -591,17 +667,27 @@ func (db *RockDB) setKV(ts int64, rawKey []byte, value []byte, duration int64) e
 }
 
 func (db *RockDB) KVGetSet(ts int64, rawKey []byte, value []byte) ([]byte, error) {
-	if err := checkValueSize(value); err != nil {
+	if err := checkKVValueSize(value); err != nil {
 		return nil, err
 	}
 	keyInfo, realOldV, err := db.getDBKVRealValueAndHeader(ts, rawKey, false)
 	if err != nil {
 		return nil, err
 	}
+	old := decodeChunkManifest(realOldV)
 	if realOldV == nil && !keyInfo.Expired {
 		db.IncrTableKeyCount(keyInfo.Table, 1, db.wb)
 	} else if keyInfo.Expired {
 		realOldV = nil
+	} else if old != nil {
+		realOldV, err = db.resolveKVChunkedValueNoLock(rawKey, realOldV)
+		if err != nil {
+			return nil, err
+		}
+	}
+	value, err = db.replaceKVValueChunks(ts, rawKey, old, value, db.wb)
+	if err != nil {
+		return nil, err
 	}
 	value, err = db.resetWithNewKVValue(ts, rawKey, value, 0, db.wb)
 	db.wb.Put(keyInfo.VerKey, value)
@@ -623,7 +709,7 @@ func (db *RockDB) SetNX(ts int64, rawKey []byte, value []byte) (int64, error) {
 }
 
 func (db *RockDB) SetIfEQ(ts int64, rawKey []byte, oldV []byte, value []byte, duration int64) (int64, error) {
-	if err := checkValueSize(value); err != nil {
+	if err := checkKVValueSize(value); err != nil {
 		return 0, err
 	}
 	keyInfo, realV, err := db.prepareKVValueForWrite(ts, rawKey, false)
@@ -631,13 +717,21 @@ func (db *RockDB) SetIfEQ(ts int64, rawKey []byte, oldV []byte, value []byte, du
 		return 0, err
 	}
 	var n int64 = 1
+	equal, err := db.isKVValueEqualNoLock(rawKey, realV, oldV)
+	if err != nil {
+		return 0, err
+	}
 
-	if !bytes.Equal(realV, oldV) && !keyInfo.Expired {
+	if !equal && !keyInfo.Expired {
 		n = 0
 	} else {
 		if realV == nil && !keyInfo.Expired {
 			db.IncrTableKeyCount(keyInfo.Table, 1, db.wb)
 		}
+		value, err = db.replaceKVValueChunks(ts, rawKey, decodeChunkManifest(realV), value, db.wb)
+		if err != nil {
+			return 0, err
+		}
 		// prepare for write will renew the expire data on expired value,
 		// however, we still need del the old expire meta data since it may store the
 		// expire meta data in different place under different expire policy.
@@ -654,8 +748,12 @@ func (db *RockDB) DelIfEQ(ts int64, rawKey []byte, oldV []byte) (int64, error) {
 		return 0, err
 	}
 	var n int64 = 1
+	equal, err := db.isKVValueEqualNoLock(rawKey, realV, oldV)
+	if err != nil {
+		return 0, err
+	}
 
-	if !bytes.Equal(realV, oldV) && !keyInfo.Expired {
+	if !equal && !keyInfo.Expired {
 		n = 0
 	} else {
 		return db.DelKeys(rawKey)
@@ -667,23 +765,26 @@ func (db *RockDB) SetRange(ts int64, rawKey []byte, offset int, value []byte) (i
 	if len(value) == 0 {
 		return 0, nil
 	}
-	if len(value)+offset > MaxValueSize {
+	if len(value)+offset > MaxChunkedValueSize {
 		return 0, errValueSize
 	}
 	keyInfo, realV, err := db.prepareKVValueForWrite(ts, rawKey, false)
 	if err != nil {
 		return 0, err
 	}
+	_, rk, err := extractTableFromRedisKey(rawKey)
+	if err != nil {
+		return 0, err
+	}
 
 	if realV == nil && !keyInfo.Expired {
 		db.IncrTableKeyCount(keyInfo.Table, 1, db.wb)
 	}
-	extra := offset + len(value) - len(realV)
-	if extra > 0 {
-		realV = append(realV, make([]byte, extra)...)
+	// only the chunks involved will be rewritten if the value is chunked
+	realV, retn, err := db.setRangeMaybeChunked(KVChunkExtType, ts, keyInfo.Table, rk, realV, int64(offset), value, db.wb)
+	if err != nil {
+		return 0, err
 	}
-	copy(realV[offset:], value)
-	retn := len(realV)
 
 	realV = db.encodeRealValueToDBRawValue(ts, keyInfo.OldHeader, realV)
 	db.wb.Put(keyInfo.VerKey, realV)
@@ -720,29 +821,19 @@ func getRange(start int64, end int64, valLen int64) (int64, int64) {
 }
 
 func (db *RockDB) GetRange(key []byte, start int64, end int64) ([]byte, error) {
-	value, err := db.KVGet(key)
-	if err != nil {
-		return nil, err
-	}
-
-	valLen := int64(len(value))
-
-	start, end = getRange(start, end, valLen)
-
-	if start > end {
-		return nil, nil
-	}
-	return value[start : end+1], nil
+	return db.kvGetRange(key, true, start, end)
 }
 
 func (db *RockDB) StrLen(key []byte) (int64, error) {
-	v, err := db.KVGet(key)
+	tn := time.Now().UnixNano()
+	keyInfo, v, err := db.getDBKVRealValueAndHeader(tn, key, true)
 	if err != nil {
 		return 0, err
 	}
-
-	n := len(v)
-	return int64(n), nil
+	if keyInfo.Expired || v == nil {
+		return 0, nil
+	}
+	return chunkedValueLen(v), nil
 }
 
 func (db *RockDB) Append(ts int64, rawKey []byte, value []byte) (int64, error) {
@@ -754,15 +845,23 @@ func (db *RockDB) Append(ts int64, rawKey []byte, value []byte) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	if len(realV)+len(value) > MaxValueSize {
+	oldLen := chunkedValueLen(realV)
+	if oldLen+int64(len(value)) > MaxChunkedValueSize {
 		return 0, errValueSize
 	}
+	_, rk, err := extractTableFromRedisKey(rawKey)
+	if err != nil {
+		return 0, err
+	}
 	if realV == nil && !keyInfo.Expired {
 		db.IncrTableKeyCount(keyInfo.Table, 1, db.wb)
 	}
 
-	newLen := len(realV) + len(value)
-	realV = append(realV, value...)
+	// only the last chunk will be rewritten if the value is chunked
+	realV, newLen, err := db.setRangeMaybeChunked(KVChunkExtType, ts, keyInfo.Table, rk, realV, oldLen, value, db.wb)
+	if err != nil {
+		return 0, err
+	}
 	dbv := db.encodeRealValueToDBRawValue(ts, keyInfo.OldHeader, realV)
 	// TODO: do we need make sure delete the old expire meta to avoid expire the rewritten new data?
 
@@ -792,26 +891,54 @@ func (db *RockDB) BitSetOld(ts int64, key []byte, offset int64, on int) (int64,
 	if realV == nil && !keyInfo.Expired {
 		db.IncrTableKeyCount(keyInfo.Table, 1, db.wb)
 	}
+	_, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return 0, err
+	}
+	m := decodeChunkManifest(realV)
 	if keyInfo.Expired {
+		if m != nil {
+			if err := db.delValueChunks(KVChunkExtType, keyInfo.Table, rk, m, db.wb); err != nil {
+				return 0, err
+			}
+		}
 		realV = nil
+		m = nil
 	}
 
 	byteOffset := int(uint32(offset) >> 3)
-	expandLen := byteOffset + 1 - len(realV)
-	if expandLen > 0 {
-		if on == 0 {
-			// not changed
-			return 0, nil
+	var byteVal byte
+	if m != nil {
+		// the chunked value is larger than the max bit offset
+		chunk, err := db.getValueChunkNoLock(KVChunkExtType, keyInfo.Table, rk, m, int64(byteOffset)/m.ChunkSize)
+		if err != nil {
+			return 0, err
 		}
-		realV = append(realV, make([]byte, expandLen)...)
+		byteVal = chunk[int64(byteOffset)%m.ChunkSize]
+	} else {
+		expandLen := byteOffset + 1 - len(realV)
+		if expandLen > 0 {
+			if on == 0 {
+				// not changed
+				return 0, nil
+			}
+			realV = append(realV, make([]byte, expandLen)...)
+		}
+		byteVal = realV[byteOffset]
 	}
-	byteVal := realV[byteOffset]
 	bit := 7 - uint8(uint32(offset)&0x7)
 	oldBit := byteVal & (1 << bit)
 
 	byteVal &= ^(1 << bit)
 	byteVal |= (uint8(on&0x1) << bit)
-	realV[byteOffset] = byteVal
+	if m != nil {
+		realV, _, err = db.setRangeMaybeChunked(KVChunkExtType, ts, keyInfo.Table, rk, realV, int64(byteOffset), []byte{byteVal}, db.wb)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		realV[byteOffset] = byteVal
+	}
 
 	realV = db.encodeRealValueToDBRawValue(ts, keyInfo.OldHeader, realV)
 	db.wb.Put(keyInfo.VerKey, realV)
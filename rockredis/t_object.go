@@ -0,0 +1,263 @@
+package rockredis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+const (
+	// max fields to scan while finding the last modify time of hash
+	// since the hash meta has no modify time
+	maxIdleScanFields = 1024
+)
+
+var errObjectType = errors.New("unsupported object type")
+
+// the type order used while detecting the type of key
+var objectDetectTypes = []byte{KVType, HashType, ListType, SetType, ZSetType, BitmapType, JSONType}
+
+// KeyObjectInfo is the internal storage info for a key
+type KeyObjectInfo struct {
+	Type     string
+	Encoding string
+	// the approximate size on disk (include the meta)
+	Size int64
+	// element number for collection, 1 for kv and json
+	Count int64
+	// the last modify time in nano seconds, 0 if unknown
+	ModifyTime int64
+}
+
+// IdleTime return the seconds since last modified, -1 if unknown
+func (info *KeyObjectInfo) IdleTime(now int64) int64 {
+	if info.ModifyTime <= 0 {
+		return -1
+	}
+	idle := (now - info.ModifyTime) / int64(time.Second)
+	if idle < 0 {
+		idle = 0
+	}
+	return idle
+}
+
+// ObjectTypeFromName convert the type name to data type, used to specify the
+// type explicitly if the same key exist in several types.
+func ObjectTypeFromName(n string) (byte, error) {
+	if n == "bitmap" {
+		return BitmapType, nil
+	}
+	for dt, name := range TypeName {
+		if name == n && dt != HSizeType && dt != LMetaType &&
+			dt != ZSizeType && dt != ZScoreType && dt != SSizeType {
+			return dt, nil
+		}
+	}
+	return NoneType, errObjectType
+}
+
+func headerEncodingName(h *headerMetaValue, enc string) string {
+	if h != nil && h.Ver == byte(common.ValueHeaderV1) {
+		return "v1-" + enc
+	}
+	return "legacy-" + enc
+}
+
+// KeyObject return the object info for the key of the given type,
+// nil will be returned if the key is not exist in the type.
+func (db *RockDB) KeyObject(dt byte, key []byte) (*KeyObjectInfo, error) {
+	if err := checkKeySize(key); err != nil {
+		return nil, err
+	}
+	switch dt {
+	case KVType:
+		return db.kvObject(key)
+	case HashType, SetType, ZSetType, ListType, BitmapType:
+		return db.collObject(dt, key)
+	case JSONType:
+		return db.jsonObject(key)
+	default:
+		return nil, errObjectType
+	}
+}
+
+// DetectKeyObject will return the object info for the first type which the key exist.
+// Since the same key can exist in different types, the kv type will be checked first.
+func (db *RockDB) DetectKeyObject(key []byte) (*KeyObjectInfo, error) {
+	for _, dt := range objectDetectTypes {
+		info, err := db.KeyObject(dt, key)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			return info, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *RockDB) kvObject(key []byte) (*KeyObjectInfo, error) {
+	tn := time.Now().UnixNano()
+	_, ek, v, expired, err := db.getRawDBKVValue(tn, key, true)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil || expired {
+		return nil, nil
+	}
+	var mts uint64
+	if len(v) >= tsLen {
+		mts, err = Uint64(v[len(v)-tsLen:], nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	realV, h, err := db.decodeDBRawValueToRealValue(v)
+	if err != nil {
+		return nil, err
+	}
+	enc := "raw"
+	size := int64(len(ek) + len(v))
+	if m := decodeChunkManifest(realV); m != nil {
+		enc = "chunked"
+		size += m.Size
+	}
+	return &KeyObjectInfo{
+		Type:       TypeName[KVType],
+		Encoding:   headerEncodingName(h, enc),
+		Size:       size,
+		Count:      1,
+		ModifyTime: int64(mts),
+	}, nil
+}
+
+func (db *RockDB) jsonObject(key []byte) (*KeyObjectInfo, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return nil, err
+	}
+	ek, err := encodeJSONKey(table, rk)
+	if err != nil {
+		return nil, err
+	}
+	v, err := db.GetBytes(ek)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	var mts uint64
+	enc := "raw-json"
+	size := int64(len(ek) + len(v))
+	if len(v) >= tsLen {
+		mts, err = Uint64(v[len(v)-tsLen:], nil)
+		if err != nil {
+			return nil, err
+		}
+		if m := decodeChunkManifest(v[:len(v)-tsLen]); m != nil {
+			enc = "chunked-json"
+			size += m.Size
+		}
+	}
+	return &KeyObjectInfo{
+		Type:       TypeName[JSONType],
+		Encoding:   enc,
+		Size:       size,
+		Count:      1,
+		ModifyTime: int64(mts),
+	}, nil
+}
+
+func (db *RockDB) collObject(dt byte, key []byte) (*KeyObjectInfo, error) {
+	tn := time.Now().UnixNano()
+	keyInfo, err := db.getCollVerKeyForRange(tn, dt, key, true)
+	if err != nil {
+		return nil, err
+	}
+	if keyInfo.IsNotExistOrExpired() {
+		return nil, nil
+	}
+	info := &KeyObjectInfo{}
+	meta := keyInfo.MetaData()
+	switch dt {
+	case HashType:
+		info.Type = TypeName[HashType]
+		info.Encoding = headerEncodingName(keyInfo.OldHeader, "hashtable")
+		info.Count, err = Int64(meta, nil)
+	case SetType:
+		info.Type = TypeName[SetType]
+		info.Encoding = headerEncodingName(keyInfo.OldHeader, "hashtable")
+		info.Count, info.ModifyTime, err = parseZMeta(meta)
+	case ZSetType:
+		info.Type = TypeName[ZSetType]
+		info.Encoding = headerEncodingName(keyInfo.OldHeader, "skiplist")
+		info.Count, info.ModifyTime, err = parseZMeta(meta)
+	case ListType:
+		info.Type = TypeName[ListType]
+		info.Encoding = headerEncodingName(keyInfo.OldHeader, "quicklist")
+		var headSeq, tailSeq int64
+		headSeq, tailSeq, info.Count, info.ModifyTime, err = parseListMeta(meta)
+		keyInfo.RangeStart = lEncodeListKey(keyInfo.Table, keyInfo.VerKey, headSeq)
+		keyInfo.RangeEnd = lEncodeListKey(keyInfo.Table, keyInfo.VerKey, tailSeq+1)
+	case BitmapType:
+		info.Type = "bitmap"
+		info.Encoding = headerEncodingName(keyInfo.OldHeader, "chunked")
+		// the bitmap size is the max bytes, we use the max chunk number as the element count
+		var bmSize int64
+		bmSize, info.ModifyTime, err = parseZMeta(meta)
+		info.Count = (bmSize + bitmapSegBytes - 1) / bitmapSegBytes
+		if err == nil {
+			keyInfo.RangeStart, err = encodeBitmapStartKey(keyInfo.Table, keyInfo.VerKey, 0)
+		}
+		if err == nil {
+			keyInfo.RangeEnd, err = encodeBitmapStopKey(keyInfo.Table, keyInfo.VerKey)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	rgs := []engine.CRange{{Start: keyInfo.RangeStart, Limit: keyInfo.RangeEnd}}
+	if dt == ZSetType {
+		rgs = append(rgs, engine.CRange{
+			Start: zEncodeStartSetKey(keyInfo.Table, keyInfo.VerKey),
+			Limit: zEncodeStopSetKey(keyInfo.Table, keyInfo.VerKey),
+		})
+	}
+	sList := db.rockEng.GetApproximateSizes(rgs, true)
+	for _, s := range sList {
+		info.Size += int64(s)
+	}
+	info.Size += int64(len(encodeMetaKey(dt, key)) + keyInfo.OldHeader.hdlen() + len(meta))
+	if dt == HashType {
+		info.ModifyTime, err = db.hLastModifyTime(keyInfo.RangeStart, keyInfo.RangeEnd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// hash meta has no modify time, so we find the newest field modify time,
+// for large hash only the first fields will be checked.
+func (db *RockDB) hLastModifyTime(start []byte, stop []byte) (int64, error) {
+	it, err := db.NewDBRangeLimitIterator(start, stop, common.RangeROpen, 0, maxIdleScanFields, false)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	var last int64
+	for ; it.Valid(); it.Next() {
+		v := it.RefValue()
+		if len(v) < tsLen {
+			continue
+		}
+		ts, err := Int64(v[len(v)-tsLen:], nil)
+		if err != nil {
+			return 0, err
+		}
+		if ts > last {
+			last = ts
+		}
+	}
+	return last, nil
+}
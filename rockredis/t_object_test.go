@@ -0,0 +1,84 @@
+package rockredis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func TestKeyObjectInfo(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	tn := time.Now().UnixNano() - int64(time.Second*10)
+	key := []byte("test:test_object_key")
+	info, err := db.DetectKeyObject(key)
+	assert.Nil(t, err)
+	assert.Nil(t, info)
+
+	err = db.KVSet(tn, key, []byte("hello"))
+	assert.Nil(t, err)
+	err = db.HMset(tn, key, common.KVRecord{Key: []byte("f1"), Value: []byte("v1")},
+		common.KVRecord{Key: []byte("f2"), Value: []byte("v2")})
+	assert.Nil(t, err)
+	_, err = db.RPush(tn, key, []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	_, err = db.SAdd(tn, key, []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	_, err = db.ZAdd(tn, key, common.ScorePair{Score: 1, Member: []byte("a")})
+	assert.Nil(t, err)
+	_, err = db.BitSetV2(tn, key, bitmapSegBits*2, 1)
+	assert.Nil(t, err)
+	_, err = db.JSet(tn, key, []byte(""), []byte(`{"a":1}`))
+	assert.Nil(t, err)
+
+	// kv should be detected first
+	info, err = db.DetectKeyObject(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "kv", info.Type)
+
+	cases := []struct {
+		dt    byte
+		tp    string
+		count int64
+	}{
+		{KVType, "kv", 1},
+		{HashType, "hash", 2},
+		{ListType, "list", 3},
+		{SetType, "set", 2},
+		{ZSetType, "zset", 1},
+		{BitmapType, "bitmap", 3},
+		{JSONType, "json", 1},
+	}
+	for _, c := range cases {
+		info, err := db.KeyObject(c.dt, key)
+		assert.Nil(t, err)
+		assert.NotNil(t, info, c.tp)
+		assert.Equal(t, c.tp, info.Type)
+		assert.Equal(t, c.count, info.Count, c.tp)
+		assert.True(t, info.Size > int64(len(key)), c.tp)
+		assert.NotEqual(t, "", info.Encoding)
+		assert.Equal(t, tn, info.ModifyTime, c.tp)
+		assert.True(t, info.IdleTime(time.Now().UnixNano()) >= 10, c.tp)
+
+		dt, err := ObjectTypeFromName(c.tp)
+		assert.Nil(t, err)
+		assert.Equal(t, c.dt, dt)
+	}
+	_, err = ObjectTypeFromName("hsize")
+	assert.Equal(t, errObjectType, err)
+
+	info, err = db.KeyObject(BitmapType, key)
+	assert.Nil(t, err)
+	assert.Contains(t, info.Encoding, "chunked")
+
+	_, err = db.DelKeys(key)
+	assert.Nil(t, err)
+	info, err = db.DetectKeyObject(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "hash", info.Type)
+}
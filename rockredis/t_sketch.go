@@ -0,0 +1,311 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/spaolacci/murmur3"
+	"github.com/youzan/ZanRedisDB/slow"
+)
+
+// The probabilistic sketch types (count-min sketch and top-k) are stored as an array of
+// 64 bits cells split into chunks with fixed size, and an extra value for the
+// other data of the sketch (such as the total count for cms or the heap for top-k).
+// key:version:chunk index -> cells in chunk
+// key:version:-1 -> extra data
+// Since the sketch will be updated very frequently, the sketch will be cached in memory
+// like the hll, and only the dirty chunks will be flushed to db while evicted from the
+// write cache or while the db is backuped (the raft snapshot).
+
+const (
+	sketchChunkBytes       = 1024
+	sketchChunkCells       = sketchChunkBytes / 8
+	sketchExtraChunk int64 = -1
+	// the sketch is cached in memory, so we need limit the size of it
+	maxSketchCells = 1 << 20
+)
+
+var errSketchData = errors.New("invalid sketch data")
+
+type sketchCacheItem struct {
+	sync.Mutex
+	ver         int64
+	cells       []uint64
+	extra       []byte
+	dirtyChunks map[int64]bool
+	extraDirty  bool
+	dirty       bool
+	deleting    bool
+}
+
+func newSketchItem(ver int64, cellNum int64) *sketchCacheItem {
+	return &sketchCacheItem{
+		ver:         ver,
+		cells:       make([]uint64, cellNum),
+		dirtyChunks: make(map[int64]bool),
+	}
+}
+
+// should be called with lock
+func (item *sketchCacheItem) setCell(i int64, v uint64) {
+	item.cells[i] = v
+	item.dirtyChunks[i/sketchChunkCells] = true
+	item.dirty = true
+}
+
+// should be called with lock
+func (item *sketchCacheItem) setExtra(extra []byte) {
+	item.extra = extra
+	item.extraDirty = true
+	item.dirty = true
+}
+
+// should be called with lock
+func (item *sketchCacheItem) setAllDirty() {
+	for i := int64(0); i*sketchChunkCells < int64(len(item.cells)); i++ {
+		item.dirtyChunks[i] = true
+	}
+	item.extraDirty = true
+	item.dirty = true
+}
+
+func (item *sketchCacheItem) encodeChunk(chunk int64) []byte {
+	start := chunk * sketchChunkCells
+	end := start + sketchChunkCells
+	if end > int64(len(item.cells)) {
+		end = int64(len(item.cells))
+	}
+	buf := make([]byte, (end-start)*8)
+	for i := start; i < end; i++ {
+		binary.BigEndian.PutUint64(buf[(i-start)*8:], item.cells[i])
+	}
+	return buf
+}
+
+func (item *sketchCacheItem) decodeChunk(chunk int64, buf []byte) error {
+	if len(buf)%8 != 0 {
+		return errSketchData
+	}
+	start := chunk * sketchChunkCells
+	for i := 0; i*8 < len(buf); i++ {
+		if start+int64(i) >= int64(len(item.cells)) {
+			return errSketchData
+		}
+		item.cells[start+int64(i)] = binary.BigEndian.Uint64(buf[i*8:])
+	}
+	return nil
+}
+
+func sketchCacheKey(metaType byte, key []byte) string {
+	return string(metaType) + string(key)
+}
+
+type sketchCache struct {
+	dirtyWriteCache *lru.Cache
+	// the read cache is separated as the hll cache, so the read command will not
+	// modify the db
+	rl        sync.RWMutex
+	readCache *lru.Cache
+	db        *RockDB
+}
+
+func newSketchCache(size int, wsize int, db *RockDB) (*sketchCache, error) {
+	c := &sketchCache{
+		db: db,
+	}
+	var err error
+	c.readCache, err = lru.NewWithEvict(size, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.dirtyWriteCache, err = lru.NewWithEvict(wsize, c.onEvicted)
+	return c, err
+}
+
+// must be called in raft commit loop with the apply lock held
+func (c *sketchCache) Flush() {
+	start := time.Now()
+	c.dirtyWriteCache.Purge()
+	cost := time.Since(start)
+	if cost > time.Millisecond*100 {
+		dbLog.Infof("flush sketch cache cost: %v", cost)
+	}
+}
+
+// must be called in raft commit loop
+func (c *sketchCache) onEvicted(rawKey interface{}, value interface{}) {
+	item, ok := value.(*sketchCacheItem)
+	if !ok {
+		return
+	}
+	cachedKey := rawKey.(string)
+	if len(cachedKey) < 1 {
+		return
+	}
+	metaType := cachedKey[0]
+	key := []byte(cachedKey[1:])
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		dbLog.Warningf("key invalid %v : %v", cachedKey, err.Error())
+		return
+	}
+	s := time.Now()
+	wb := c.db.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	item.Lock()
+	if item.deleting || !item.dirty {
+		item.Unlock()
+		return
+	}
+	for chunk := range item.dirtyChunks {
+		ck, err := extEncodeDataKey(metaType+1, table, rk, item.ver, chunk)
+		if err != nil {
+			item.Unlock()
+			dbLog.Warningf("failed to encode %v sketch chunk: %v", cachedKey, err.Error())
+			return
+		}
+		wb.Put(ck, item.encodeChunk(chunk))
+	}
+	if item.extraDirty {
+		ck, err := extEncodeDataKey(metaType+1, table, rk, item.ver, sketchExtraChunk)
+		if err != nil {
+			item.Unlock()
+			dbLog.Warningf("failed to encode %v sketch extra data: %v", cachedKey, err.Error())
+			return
+		}
+		wb.Put(ck, item.extra)
+	}
+	item.dirtyChunks = make(map[int64]bool)
+	item.extraDirty = false
+	item.dirty = false
+	item.Unlock()
+	c.db.rockEng.Write(wb)
+	cost := time.Since(s)
+	slow.LogSlowDBWrite(cost, slow.NewSlowLogInfo(c.db.cfg.DataDir, cachedKey[1:], "flush sketch"))
+	c.readCache.Add(cachedKey, item)
+}
+
+func (c *sketchCache) Get(metaType byte, key []byte) (*sketchCacheItem, bool) {
+	ck := sketchCacheKey(metaType, key)
+	v, ok := c.dirtyWriteCache.Get(ck)
+	if !ok {
+		v, ok = c.readCache.Get(ck)
+		if !ok {
+			return nil, false
+		}
+	}
+	item, ok := v.(*sketchCacheItem)
+	if !ok {
+		return nil, false
+	}
+	return item, true
+}
+
+// make sure dirty write is not added
+func (c *sketchCache) AddToReadCache(metaType byte, key []byte, item *sketchCacheItem) {
+	c.readCache.Add(sketchCacheKey(metaType, key), item)
+}
+
+func (c *sketchCache) AddDirtyWrite(metaType byte, key []byte, item *sketchCacheItem) {
+	ck := sketchCacheKey(metaType, key)
+	c.dirtyWriteCache.Add(ck, item)
+	c.readCache.Remove(ck)
+}
+
+func (c *sketchCache) Del(metaType byte, key []byte) {
+	ck := sketchCacheKey(metaType, key)
+	v, ok := c.dirtyWriteCache.Peek(ck)
+	if ok {
+		item, ok := v.(*sketchCacheItem)
+		if ok {
+			item.Lock()
+			item.deleting = true
+			item.Unlock()
+		}
+		c.dirtyWriteCache.Remove(ck)
+	}
+	c.readCache.Remove(ck)
+}
+
+func isSketchExtType(metaType byte) bool {
+	return metaType == CMSMetaExtType || metaType == TopKMetaExtType
+}
+
+func (db *RockDB) loadSketchItem(metaType byte, key []byte, ver int64, cellNum int64, useLock bool) (*sketchCacheItem, error) {
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return nil, err
+	}
+	getF := db.GetBytesNoLock
+	if useLock {
+		getF = db.GetBytes
+	}
+	item := newSketchItem(ver, cellNum)
+	for chunk := int64(0); chunk*sketchChunkCells < cellNum; chunk++ {
+		ck, err := extEncodeDataKey(metaType+1, table, rk, ver, chunk)
+		if err != nil {
+			return nil, err
+		}
+		v, err := getF(ck)
+		if err != nil {
+			return nil, err
+		}
+		if err := item.decodeChunk(chunk, v); err != nil {
+			return nil, err
+		}
+	}
+	ck, err := extEncodeDataKey(metaType+1, table, rk, ver, sketchExtraChunk)
+	if err != nil {
+		return nil, err
+	}
+	item.extra, err = getF(ck)
+	return item, err
+}
+
+// get the cached sketch for write, must be called in raft commit loop
+func (db *RockDB) getSketchItemForWrite(metaType byte, key []byte, ver int64, cellNum int64) (*sketchCacheItem, error) {
+	item, ok := db.sketchCache.Get(metaType, key)
+	if ok && item.ver == ver {
+		return item, nil
+	}
+	return db.loadSketchItem(metaType, key, ver, cellNum, false)
+}
+
+func (db *RockDB) getSketchItemForRead(metaType byte, key []byte, ver int64, cellNum int64) (*sketchCacheItem, error) {
+	item, ok := db.sketchCache.Get(metaType, key)
+	if ok && item.ver == ver {
+		return item, nil
+	}
+	// avoid loading from db while the dirty write is adding to cache
+	db.sketchCache.rl.RLock()
+	defer db.sketchCache.rl.RUnlock()
+	item, ok = db.sketchCache.Get(metaType, key)
+	if ok && item.ver == ver {
+		return item, nil
+	}
+	item, err := db.loadSketchItem(metaType, key, ver, cellNum, true)
+	if err != nil {
+		return nil, err
+	}
+	db.sketchCache.AddToReadCache(metaType, key, item)
+	return item, nil
+}
+
+func (db *RockDB) addSketchDirtyWrite(metaType byte, key []byte, item *sketchCacheItem) {
+	db.sketchCache.rl.Lock()
+	db.sketchCache.AddDirtyWrite(metaType, key, item)
+	db.sketchCache.rl.Unlock()
+}
+
+// the hash values for the sketch row, using the double hashing to generate hashes for each row
+func sketchHashes(item []byte) (uint64, uint64) {
+	h1, h2 := murmur3.Sum128(item)
+	return h1, h2 | 1
+}
+
+func sketchRowIndex(h1 uint64, h2 uint64, row int64, width int64) int64 {
+	return row*width + int64((h1+uint64(row)*h2)%uint64(width))
+}
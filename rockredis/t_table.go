@@ -33,6 +33,9 @@ var metaPrefix = []byte("meta" + string(metaSep))
 const (
 	hsetIndexMeta     byte = 1
 	jsonIndexMeta     byte = 2
+	fullTextIndexMeta byte = 3
+	columnTableMeta   byte = 4
+	tableSchemaMeta   byte = 5
 	hsetIndexDataType byte = 1
 	jsonIndexDataType byte = 2
 )
@@ -247,9 +250,29 @@ func encodeTableIndexMetaStopKey(itype byte) []byte {
 }
 
 func (db *RockDB) GetHsetIndexTables() [][]byte {
+	return db.getIndexTables(hsetIndexMeta)
+}
+
+func (db *RockDB) GetJSONIndexTables() [][]byte {
+	return db.getIndexTables(jsonIndexMeta)
+}
+
+func (db *RockDB) GetFullTextIndexTables() [][]byte {
+	return db.getIndexTables(fullTextIndexMeta)
+}
+
+func (db *RockDB) GetColumnTables() [][]byte {
+	return db.getIndexTables(columnTableMeta)
+}
+
+func (db *RockDB) GetSchemaTables() [][]byte {
+	return db.getIndexTables(tableSchemaMeta)
+}
+
+func (db *RockDB) getIndexTables(itype byte) [][]byte {
 	ch := make([][]byte, 0, 100)
-	s := encodeTableIndexMetaStartKey(hsetIndexMeta)
-	e := encodeTableIndexMetaStopKey(hsetIndexMeta)
+	s := encodeTableIndexMetaStartKey(itype)
+	e := encodeTableIndexMetaStopKey(itype)
 	it, err := db.NewDBRangeIterator(s, e, common.RangeOpen, false)
 	if err != nil {
 		return nil
@@ -282,3 +305,66 @@ func (db *RockDB) SetTableHsetIndexValue(table []byte, value []byte) error {
 	wb.Put(key, value)
 	return db.rockEng.Write(wb)
 }
+
+func (db *RockDB) GetTableJSONIndexValue(table []byte) ([]byte, error) {
+	key := encodeTableIndexMetaKey(table, jsonIndexMeta)
+	return db.GetBytes(key)
+}
+
+func (db *RockDB) SetTableJSONIndexValue(table []byte, value []byte) error {
+	// this may not run in raft loop
+	// so we should use new db write batch here
+	key := encodeTableIndexMetaKey(table, jsonIndexMeta)
+	wb := db.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(key, value)
+	return db.rockEng.Write(wb)
+}
+
+func (db *RockDB) GetTableFullTextIndexValue(table []byte) ([]byte, error) {
+	key := encodeTableIndexMetaKey(table, fullTextIndexMeta)
+	return db.GetBytes(key)
+}
+
+func (db *RockDB) SetTableFullTextIndexValue(table []byte, value []byte) error {
+	// this may not run in raft loop
+	// so we should use new db write batch here
+	key := encodeTableIndexMetaKey(table, fullTextIndexMeta)
+	wb := db.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(key, value)
+	return db.rockEng.Write(wb)
+}
+
+func (db *RockDB) GetTableColumnTableValue(table []byte) ([]byte, error) {
+	key := encodeTableIndexMetaKey(table, columnTableMeta)
+	return db.GetBytes(key)
+}
+
+func (db *RockDB) SetTableColumnTableValue(table []byte, value []byte) error {
+	// this may not run in raft loop
+	// so we should use new db write batch here
+	key := encodeTableIndexMetaKey(table, columnTableMeta)
+	wb := db.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	wb.Put(key, value)
+	return db.rockEng.Write(wb)
+}
+
+func (db *RockDB) GetTableSchemaValue(table []byte) ([]byte, error) {
+	key := encodeTableIndexMetaKey(table, tableSchemaMeta)
+	return db.GetBytes(key)
+}
+
+// set the table schema, the schema will be removed if the value is nil
+func (db *RockDB) SetTableSchemaValue(table []byte, value []byte) error {
+	key := encodeTableIndexMetaKey(table, tableSchemaMeta)
+	wb := db.rockEng.NewWriteBatch()
+	defer wb.Destroy()
+	if value == nil {
+		wb.Delete(key)
+	} else {
+		wb.Put(key, value)
+	}
+	return db.rockEng.Write(wb)
+}
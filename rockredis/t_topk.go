@@ -0,0 +1,352 @@
+package rockredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// Top-K is implemented using the HeavyKeeper algorithm, the buckets are stored in the
+// sketch cells (high 32 bits for the fingerprint and low 32 bits for the count),
+// and the min heap of the top k items is stored in the sketch extra data.
+// The random used for decay is computed from the hash of the bucket state, so all the
+// replicas will have the same result.
+
+const (
+	maxTopK              = 1000
+	DefaultTopKWidth     = 8
+	DefaultTopKDepth     = 7
+	DefaultTopKDecay     = 0.9
+	topkDecayLookupTable = 256
+)
+
+var (
+	ErrTopKExist      = errors.New("ERR TopK: key already exists")
+	ErrTopKNotFound   = errors.New("ERR TopK: key does not exist")
+	ErrTopKInvalidK   = errors.New("ERR TopK: invalid k")
+	ErrTopKInvalidDim = errors.New("ERR TopK: invalid width/depth")
+	ErrTopKDecay      = errors.New("ERR TopK: decay should be larger than 0 and no more than 1")
+	errTopKMeta       = errors.New("invalid topk meta")
+	errTopKHeap       = errors.New("invalid topk heap data")
+)
+
+type topkMeta struct {
+	K     int64
+	Width int64
+	Depth int64
+	Decay float64
+}
+
+func (tm *topkMeta) encode() []byte {
+	buf := make([]byte, 8*4)
+	binary.BigEndian.PutUint64(buf, uint64(tm.K))
+	binary.BigEndian.PutUint64(buf[8:], uint64(tm.Width))
+	binary.BigEndian.PutUint64(buf[16:], uint64(tm.Depth))
+	binary.BigEndian.PutUint64(buf[24:], math.Float64bits(tm.Decay))
+	return buf
+}
+
+func decodeTopKMeta(v []byte) (*topkMeta, error) {
+	if len(v) < 8*4 {
+		return nil, errTopKMeta
+	}
+	var tm topkMeta
+	tm.K = int64(binary.BigEndian.Uint64(v))
+	tm.Width = int64(binary.BigEndian.Uint64(v[8:]))
+	tm.Depth = int64(binary.BigEndian.Uint64(v[16:]))
+	tm.Decay = math.Float64frombits(binary.BigEndian.Uint64(v[24:]))
+	if tm.K <= 0 || tm.Width <= 0 || tm.Depth <= 0 {
+		return nil, errTopKMeta
+	}
+	return &tm, nil
+}
+
+func (tm *topkMeta) cells() int64 {
+	return tm.Width * tm.Depth
+}
+
+// TopKItem is the item in the top k list
+type TopKItem struct {
+	Item  []byte
+	Count int64
+}
+
+func encodeTopKHeap(heap []TopKItem) []byte {
+	size := 4
+	for _, e := range heap {
+		size += 8 + 4 + len(e.Item)
+	}
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf, uint32(len(heap)))
+	pos := 4
+	for _, e := range heap {
+		binary.BigEndian.PutUint64(buf[pos:], uint64(e.Count))
+		pos += 8
+		binary.BigEndian.PutUint32(buf[pos:], uint32(len(e.Item)))
+		pos += 4
+		copy(buf[pos:], e.Item)
+		pos += len(e.Item)
+	}
+	return buf
+}
+
+func decodeTopKHeap(v []byte) ([]TopKItem, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	if len(v) < 4 {
+		return nil, errTopKHeap
+	}
+	n := int(binary.BigEndian.Uint32(v))
+	heap := make([]TopKItem, 0, n)
+	pos := 4
+	for i := 0; i < n; i++ {
+		if pos+12 > len(v) {
+			return nil, errTopKHeap
+		}
+		cnt := int64(binary.BigEndian.Uint64(v[pos:]))
+		pos += 8
+		l := int(binary.BigEndian.Uint32(v[pos:]))
+		pos += 4
+		if pos+l > len(v) {
+			return nil, errTopKHeap
+		}
+		heap = append(heap, TopKItem{Item: v[pos : pos+l], Count: cnt})
+		pos += l
+	}
+	return heap, nil
+}
+
+func topkFindInHeap(heap []TopKItem, elem []byte) int {
+	for i := range heap {
+		if bytes.Equal(heap[i].Item, elem) {
+			return i
+		}
+	}
+	return -1
+}
+
+// return the index of the min item in heap, the first one will be used if the counts are the same
+func topkHeapMin(heap []TopKItem) int {
+	minIdx := -1
+	for i := range heap {
+		if minIdx < 0 || heap[i].Count < heap[minIdx].Count {
+			minIdx = i
+		}
+	}
+	return minIdx
+}
+
+// the deterministic random in [0, 1) computed from the bucket state
+func topkChance(fp uint32, row int64, cnt uint32, incr uint64) float64 {
+	var b [24]byte
+	binary.BigEndian.PutUint32(b[:], fp)
+	binary.BigEndian.PutUint32(b[4:], cnt)
+	binary.BigEndian.PutUint64(b[8:], uint64(row))
+	binary.BigEndian.PutUint64(b[16:], incr)
+	return float64(murmur3.Sum64(b[:])>>11) / float64(1<<53)
+}
+
+func topkDecay(decay float64, cnt uint32) float64 {
+	if cnt < topkDecayLookupTable {
+		return math.Pow(decay, float64(cnt))
+	}
+	return 0
+}
+
+// add the item to the buckets and update the heap, the expelled item from
+// the heap will be returned if any
+func (tm *topkMeta) add(item *sketchCacheItem, heap []TopKItem, elem []byte, incr uint64) ([]TopKItem, []byte) {
+	h1, h2 := sketchHashes(elem)
+	fp := uint32(h1 >> 32)
+	maxCount := uint32(0)
+	for r := int64(0); r < tm.Depth; r++ {
+		idx := sketchRowIndex(h1, h2, r, tm.Width)
+		bfp := uint32(item.cells[idx] >> 32)
+		cnt := uint32(item.cells[idx])
+		if cnt == 0 {
+			bfp = fp
+			cnt = uint32(incr)
+		} else if bfp == fp {
+			if uint64(cnt)+incr > math.MaxUint32 {
+				cnt = math.MaxUint32
+			} else {
+				cnt += uint32(incr)
+			}
+		} else {
+			for local := incr; local > 0; local-- {
+				if topkChance(bfp, r, cnt, local) < topkDecay(tm.Decay, cnt) {
+					cnt--
+					if cnt == 0 {
+						bfp = fp
+						cnt = uint32(local)
+						break
+					}
+				}
+			}
+		}
+		if bfp == fp && cnt > maxCount {
+			maxCount = cnt
+		}
+		item.setCell(idx, uint64(bfp)<<32|uint64(cnt))
+	}
+	if maxCount == 0 {
+		return heap, nil
+	}
+	if pos := topkFindInHeap(heap, elem); pos >= 0 {
+		heap[pos].Count = int64(maxCount)
+		return heap, nil
+	}
+	newItem := TopKItem{Item: append([]byte{}, elem...), Count: int64(maxCount)}
+	if int64(len(heap)) < tm.K {
+		return append(heap, newItem), nil
+	}
+	minIdx := topkHeapMin(heap)
+	if int64(maxCount) < heap[minIdx].Count {
+		return heap, nil
+	}
+	expelled := heap[minIdx].Item
+	heap[minIdx] = newItem
+	return heap, expelled
+}
+
+func (db *RockDB) getTopKMeta(ts int64, key []byte, useLock bool) (*extMeta, *topkMeta, error) {
+	m, err := db.extGetMeta(ts, TopKMetaExtType, key, useLock)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m == nil {
+		return nil, nil, ErrTopKNotFound
+	}
+	tm, err := decodeTopKMeta(m.Data)
+	return m, tm, err
+}
+
+// TopKReserve create the top-k with the width and depth of the buckets and the decay
+func (db *RockDB) TopKReserve(ts int64, key []byte, k int64, width int64, depth int64, decay float64) error {
+	if k <= 0 || k > maxTopK {
+		return ErrTopKInvalidK
+	}
+	if width <= 0 || depth <= 0 || width > maxSketchCells || width*depth > maxSketchCells {
+		return ErrTopKInvalidDim
+	}
+	if decay <= 0 || decay > 1 {
+		return ErrTopKDecay
+	}
+	wb := db.wb
+	m, created, err := db.extGetMetaForWrite(ts, TopKMetaExtType, key, wb)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return ErrTopKExist
+	}
+	tm := &topkMeta{K: k, Width: width, Depth: depth, Decay: decay}
+	m.Data = tm.encode()
+	db.extSetMeta(TopKMetaExtType, key, m, wb)
+	return db.MaybeCommitBatch()
+}
+
+// TopKAdd add the items to the top-k, for each item the expelled item from the top k list
+// will be returned, nil if no item expelled.
+func (db *RockDB) TopKAdd(ts int64, key []byte, elems ...[]byte) ([][]byte, error) {
+	if len(elems) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	m, tm, err := db.getTopKMeta(ts, key, false)
+	if err != nil {
+		return nil, err
+	}
+	item, err := db.getSketchItemForWrite(TopKMetaExtType, key, m.Ver, tm.cells())
+	if err != nil {
+		return nil, err
+	}
+	item.Lock()
+	heap, err := decodeTopKHeap(item.extra)
+	if err != nil {
+		item.Unlock()
+		return nil, err
+	}
+	rets := make([][]byte, len(elems))
+	for i, elem := range elems {
+		heap, rets[i] = tm.add(item, heap, elem, 1)
+	}
+	item.setExtra(encodeTopKHeap(heap))
+	item.Unlock()
+	db.addSketchDirtyWrite(TopKMetaExtType, key, item)
+	return rets, nil
+}
+
+// TopKQuery check whether the items are in the top k list
+func (db *RockDB) TopKQuery(key []byte, elems ...[]byte) ([]int64, error) {
+	if len(elems) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	heap, err := db.getTopKHeap(key)
+	if err != nil {
+		return nil, err
+	}
+	rets := make([]int64, len(elems))
+	for i, elem := range elems {
+		if topkFindInHeap(heap, elem) >= 0 {
+			rets[i] = 1
+		}
+	}
+	return rets, nil
+}
+
+// TopKList return the items in the top k list, ordered by count desc
+func (db *RockDB) TopKList(key []byte) ([]TopKItem, error) {
+	heap, err := db.getTopKHeap(key)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(heap, func(i, j int) bool {
+		if heap[i].Count == heap[j].Count {
+			return bytes.Compare(heap[i].Item, heap[j].Item) < 0
+		}
+		return heap[i].Count > heap[j].Count
+	})
+	return heap, nil
+}
+
+func (db *RockDB) getTopKHeap(key []byte) ([]TopKItem, error) {
+	m, tm, err := db.getTopKMeta(time.Now().UnixNano(), key, true)
+	if err != nil {
+		return nil, err
+	}
+	item, err := db.getSketchItemForRead(TopKMetaExtType, key, m.Ver, tm.cells())
+	if err != nil {
+		return nil, err
+	}
+	item.Lock()
+	// the extra data will be replaced while changed, so it is safe to decode without lock
+	extra := item.extra
+	item.Unlock()
+	return decodeTopKHeap(extra)
+}
+
+func (db *RockDB) TopKClear(ts int64, key []byte) (int64, error) {
+	return db.extDelete(ts, TopKMetaExtType, key)
+}
+
+func (db *RockDB) TopKKeyExists(key []byte) (int64, error) {
+	return db.extKeyExists(TopKMetaExtType, key)
+}
+
+func (db *RockDB) TopKExpire(ts int64, key []byte, ttlSec int64) (int64, error) {
+	return db.extExpire(ts, TopKMetaExtType, key, ttlSec)
+}
+
+func (db *RockDB) TopKPersist(ts int64, key []byte) (int64, error) {
+	return db.extPersist(ts, TopKMetaExtType, key)
+}
+
+func (db *RockDB) TopKTtl(key []byte) (int64, error) {
+	return db.extTTL(TopKMetaExtType, key)
+}
@@ -0,0 +1,77 @@
+package rockredis
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopK(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_topk")
+	tn := time.Now().UnixNano()
+	err := db.TopKReserve(tn, key, 3, 50, 5, 0.9)
+	assert.Nil(t, err)
+	err = db.TopKReserve(tn, key, 3, 50, 5, 0.9)
+	assert.Equal(t, ErrTopKExist, err)
+	err = db.TopKReserve(tn, []byte("test:testdb_topk_invalid"), 0, 50, 5, 0.9)
+	assert.Equal(t, ErrTopKInvalidK, err)
+	err = db.TopKReserve(tn, []byte("test:testdb_topk_invalid"), 3, 50, 5, 1.1)
+	assert.Equal(t, ErrTopKDecay, err)
+	_, err = db.TopKAdd(tn, []byte("test:testdb_topk_not_exist"), []byte("a"))
+	assert.Equal(t, ErrTopKNotFound, err)
+
+	rets, err := db.TopKAdd(tn, key, []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{nil, nil, nil}, rets)
+	// d will expel the item with min count after it becomes heavier
+	var expelled [][]byte
+	for i := 0; i < 10; i++ {
+		rets, err = db.TopKAdd(tn, key, []byte("a"), []byte("b"), []byte("d"), []byte("d"))
+		assert.Nil(t, err)
+		for _, r := range rets {
+			if r != nil {
+				expelled = append(expelled, r)
+			}
+		}
+	}
+	assert.Equal(t, [][]byte{[]byte("c")}, expelled)
+
+	for i := 0; i < 1000; i++ {
+		_, err = db.TopKAdd(tn, key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+	}
+	qrets, err := db.TopKQuery(key, []byte("a"), []byte("c"), []byte("d"), []byte("item-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 0, 1, 0}, qrets)
+	list, err := db.TopKList(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(list))
+	assert.Equal(t, []byte("d"), list[0].Item)
+	assert.Equal(t, int64(20), list[0].Count)
+	assert.Equal(t, []byte("a"), list[1].Item)
+	assert.Equal(t, []byte("b"), list[2].Item)
+
+	// flush the cache and reload from db
+	db.sketchCache.Flush()
+	db.sketchCache, err = newSketchCache(SketchReadCacheSize, SketchWriteCacheSize, db)
+	assert.Nil(t, err)
+	list2, err := db.TopKList(key)
+	assert.Nil(t, err)
+	assert.Equal(t, list, list2)
+
+	n, err := db.TopKClear(tn, key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.TopKKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	_, err = db.TopKList(key)
+	assert.Equal(t, ErrTopKNotFound, err)
+}
@@ -0,0 +1,1010 @@
+package rockredis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/engine"
+)
+
+// The time series samples are split into chunks by the time bucket (chunk duration),
+// each chunk is compressed and stored as the data of the extanded type.
+// key:version:bucket start -> compressed samples in the bucket
+// The retention, labels and the compaction rules are stored in the meta. While the
+// sample is added in the raft apply, the compaction rules will aggregate the
+// samples in the current bucket, and write the aggregated sample to the destination
+// series once the bucket is closed by the newer sample.
+
+const (
+	// the default chunk duration in milliseconds
+	DefaultTSChunkDuration = 3600 * 1000
+	maxTSLabels            = 64
+)
+
+var (
+	ErrTSExist          = errors.New("ERR TSDB: key already exists")
+	ErrTSNotFound       = errors.New("ERR TSDB: the key does not exist")
+	ErrTSTimestamp      = errors.New("ERR TSDB: invalid timestamp")
+	ErrTSTooOld         = errors.New("ERR TSDB: Timestamp is older than retention")
+	ErrTSRetention      = errors.New("ERR TSDB: invalid retention")
+	ErrTSChunkDuration  = errors.New("ERR TSDB: invalid chunk duration")
+	ErrTSLabels         = errors.New("ERR TSDB: invalid labels")
+	ErrTSAggregation    = errors.New("ERR TSDB: unknown aggregation type")
+	ErrTSBucket         = errors.New("ERR TSDB: invalid time bucket")
+	ErrTSRuleExist      = errors.New("ERR TSDB: the destination key already has a src rule")
+	ErrTSRuleNotFound   = errors.New("ERR TSDB: compaction rule does not exist")
+	ErrTSRuleSameKey    = errors.New("ERR TSDB: the source key and destination key should be different")
+	ErrTSRuleCompaction = errors.New("ERR TSDB: the source key or destination key is already used by other rules")
+	errTSMeta           = errors.New("invalid time series meta")
+)
+
+const (
+	tsAggAvg byte = iota + 1
+	tsAggMin
+	tsAggMax
+	tsAggSum
+	tsAggCount
+)
+
+var tsAggNames = map[byte]string{
+	tsAggAvg:   "avg",
+	tsAggMin:   "min",
+	tsAggMax:   "max",
+	tsAggSum:   "sum",
+	tsAggCount: "count",
+}
+
+func parseTSAggType(name string) (byte, error) {
+	lname := strings.ToLower(name)
+	for t, n := range tsAggNames {
+		if n == lname {
+			return t, nil
+		}
+	}
+	return 0, ErrTSAggregation
+}
+
+type tsAggState struct {
+	Count int64
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+func (s *tsAggState) add(v float64) {
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Sum += v
+	s.Count++
+}
+
+func (s *tsAggState) value(aggType byte) float64 {
+	switch aggType {
+	case tsAggAvg:
+		return s.Sum / float64(s.Count)
+	case tsAggMin:
+		return s.Min
+	case tsAggMax:
+		return s.Max
+	case tsAggSum:
+		return s.Sum
+	case tsAggCount:
+		return float64(s.Count)
+	}
+	return 0
+}
+
+// TSLabel is the label for the time series
+type TSLabel struct {
+	Name  string
+	Value string
+}
+
+type tsRule struct {
+	Dest    []byte
+	AggType byte
+	Bucket  int64
+	// the start time of the bucket currently aggregating
+	CurStart int64
+	State    tsAggState
+}
+
+type tsMeta struct {
+	Retention     int64
+	ChunkDuration int64
+	Samples       int64
+	LastTs        int64
+	LastValue     float64
+	Labels        []TSLabel
+	// the source key if this series is the destination of a compaction rule
+	Src   []byte
+	Rules []tsRule
+}
+
+type tsEncoder struct {
+	bytes.Buffer
+}
+
+func (e *tsEncoder) putInt(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	e.Write(buf[:n])
+}
+
+func (e *tsEncoder) putFloat(v float64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	e.Write(buf[:])
+}
+
+func (e *tsEncoder) putBytes(v []byte) {
+	e.putInt(int64(len(v)))
+	e.Write(v)
+}
+
+type tsDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *tsDecoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errTSMeta
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *tsDecoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < 8 {
+		d.err = errTSMeta
+		return 0
+	}
+	v := math.Float64frombits(binary.BigEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *tsDecoder) bytes() []byte {
+	l := d.int()
+	if d.err != nil {
+		return nil
+	}
+	if l < 0 || int64(len(d.buf)) < l {
+		d.err = errTSMeta
+		return nil
+	}
+	v := d.buf[:l]
+	d.buf = d.buf[l:]
+	return v
+}
+
+func (tm *tsMeta) encode() []byte {
+	var e tsEncoder
+	e.putInt(tm.Retention)
+	e.putInt(tm.ChunkDuration)
+	e.putInt(tm.Samples)
+	e.putInt(tm.LastTs)
+	e.putFloat(tm.LastValue)
+	e.putInt(int64(len(tm.Labels)))
+	for _, l := range tm.Labels {
+		e.putBytes([]byte(l.Name))
+		e.putBytes([]byte(l.Value))
+	}
+	e.putBytes(tm.Src)
+	e.putInt(int64(len(tm.Rules)))
+	for _, r := range tm.Rules {
+		e.putBytes(r.Dest)
+		e.putInt(int64(r.AggType))
+		e.putInt(r.Bucket)
+		e.putInt(r.CurStart)
+		e.putInt(r.State.Count)
+		e.putFloat(r.State.Sum)
+		e.putFloat(r.State.Min)
+		e.putFloat(r.State.Max)
+	}
+	return e.Bytes()
+}
+
+func decodeTSMeta(v []byte) (*tsMeta, error) {
+	d := &tsDecoder{buf: v}
+	var tm tsMeta
+	tm.Retention = d.int()
+	tm.ChunkDuration = d.int()
+	tm.Samples = d.int()
+	tm.LastTs = d.int()
+	tm.LastValue = d.float()
+	n := d.int()
+	if n < 0 || n > maxTSLabels {
+		return nil, errTSMeta
+	}
+	for i := int64(0); i < n && d.err == nil; i++ {
+		name := d.bytes()
+		value := d.bytes()
+		tm.Labels = append(tm.Labels, TSLabel{Name: string(name), Value: string(value)})
+	}
+	if src := d.bytes(); len(src) > 0 {
+		tm.Src = append([]byte{}, src...)
+	}
+	n = d.int()
+	if n < 0 || n > MAX_BATCH_NUM {
+		return nil, errTSMeta
+	}
+	for i := int64(0); i < n && d.err == nil; i++ {
+		var r tsRule
+		r.Dest = append([]byte{}, d.bytes()...)
+		r.AggType = byte(d.int())
+		r.Bucket = d.int()
+		r.CurStart = d.int()
+		r.State.Count = d.int()
+		r.State.Sum = d.float()
+		r.State.Min = d.float()
+		r.State.Max = d.float()
+		tm.Rules = append(tm.Rules, r)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if tm.ChunkDuration <= 0 {
+		return nil, errTSMeta
+	}
+	return &tm, nil
+}
+
+func (tm *tsMeta) bucket(ts int64) int64 {
+	return ts - ts%tm.ChunkDuration
+}
+
+// the min timestamp which is not out of the retention
+func (tm *tsMeta) minRetainedTs() int64 {
+	if tm.Retention <= 0 || tm.Samples == 0 || tm.LastTs <= tm.Retention {
+		return 0
+	}
+	return tm.LastTs - tm.Retention
+}
+
+func (tm *tsMeta) matchLabels(filters []TSLabelFilter) bool {
+	for _, f := range filters {
+		found := false
+		for _, l := range tm.Labels {
+			if l.Name == f.Name {
+				found = l.Value == f.Value
+				break
+			}
+		}
+		if found == f.NotEqual {
+			return false
+		}
+	}
+	return true
+}
+
+// TSCreateOptions is the options used while creating the time series
+type TSCreateOptions struct {
+	// retention in milliseconds, 0 means no retention
+	Retention     int64
+	ChunkDuration int64
+	Labels        []TSLabel
+}
+
+func (opts *TSCreateOptions) check() error {
+	if opts.Retention < 0 {
+		return ErrTSRetention
+	}
+	if opts.ChunkDuration < 0 {
+		return ErrTSChunkDuration
+	}
+	if len(opts.Labels) > maxTSLabels {
+		return ErrTSLabels
+	}
+	for _, l := range opts.Labels {
+		if l.Name == "" {
+			return ErrTSLabels
+		}
+	}
+	return nil
+}
+
+// TSLabelFilter is used to filter the time series by label, the series
+// without the label will be treated as not equal.
+type TSLabelFilter struct {
+	Name     string
+	Value    string
+	NotEqual bool
+}
+
+// TSRangeOptions is the options for range query, no aggregation if the AggType is empty
+type TSRangeOptions struct {
+	AggType string
+	// the time bucket in milliseconds for aggregation
+	Bucket int64
+	// max number of the samples returned, 0 means no limit
+	Count   int64
+	Reverse bool
+}
+
+// TSRuleInfo is the compaction rule info
+type TSRuleInfo struct {
+	Dest    []byte
+	AggType string
+	Bucket  int64
+}
+
+// TSInfo is the information returned by ts.info
+type TSInfo struct {
+	Samples        int64
+	FirstTimestamp int64
+	LastTimestamp  int64
+	Retention      int64
+	ChunkDuration  int64
+	Labels         []TSLabel
+	Src            []byte
+	Rules          []TSRuleInfo
+}
+
+// TSRangeResult is the range query result for each series in the mrange
+type TSRangeResult struct {
+	Key     []byte
+	Labels  []TSLabel
+	Samples []TSSample
+}
+
+type tsSeries struct {
+	key     []byte
+	table   []byte
+	rk      []byte
+	m       *extMeta
+	tm      *tsMeta
+	created bool
+	// the loaded chunks in this write, and the dirty chunks need to be written
+	chunks map[int64][]TSSample
+	dirty  map[int64]bool
+}
+
+// tsWriter holds all the changes to the time series in a single write command, and
+// write all of them to the write batch at the end, so the samples added to the same chunk
+// or the compaction to the same destination can be handled correctly and no partial
+// changes will be written if any error happened.
+type tsWriter struct {
+	db     *RockDB
+	ts     int64
+	series map[string]*tsSeries
+	// keep the order of the series to write
+	keys []string
+}
+
+func newTSWriter(db *RockDB, ts int64) *tsWriter {
+	return &tsWriter{
+		db:     db,
+		ts:     ts,
+		series: make(map[string]*tsSeries),
+	}
+}
+
+// get the time series for write, if not exist and opts is not nil, it will be created.
+// nil will be returned if the key not exist and no create options.
+func (w *tsWriter) getSeries(key []byte, opts *TSCreateOptions) (*tsSeries, error) {
+	if s, ok := w.series[string(key)]; ok {
+		return s, nil
+	}
+	m, err := w.db.extGetMeta(w.ts, TSMetaExtType, key, false)
+	if err != nil {
+		return nil, err
+	}
+	var tm *tsMeta
+	created := false
+	if m == nil {
+		if opts == nil {
+			return nil, nil
+		}
+		if err := opts.check(); err != nil {
+			return nil, err
+		}
+		// create later while writing since it may delete the expired data in write batch
+		m = &extMeta{Ver: w.ts}
+		tm = &tsMeta{
+			Retention:     opts.Retention,
+			ChunkDuration: opts.ChunkDuration,
+			Labels:        opts.Labels,
+		}
+		if tm.ChunkDuration == 0 {
+			tm.ChunkDuration = DefaultTSChunkDuration
+		}
+		created = true
+	} else {
+		tm, err = decodeTSMeta(m.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return nil, err
+	}
+	s := &tsSeries{
+		key:     key,
+		table:   table,
+		rk:      rk,
+		m:       m,
+		tm:      tm,
+		created: created,
+		chunks:  make(map[int64][]TSSample),
+		dirty:   make(map[int64]bool),
+	}
+	w.series[string(key)] = s
+	w.keys = append(w.keys, string(key))
+	return s, nil
+}
+
+func (w *tsWriter) loadChunk(s *tsSeries, bucket int64) ([]TSSample, error) {
+	if samples, ok := s.chunks[bucket]; ok {
+		return samples, nil
+	}
+	if s.created {
+		return nil, nil
+	}
+	ck, err := extEncodeDataKey(TSDataExtType, s.table, s.rk, s.m.Ver, bucket)
+	if err != nil {
+		return nil, err
+	}
+	v, err := w.db.GetBytesNoLock(ck)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := decodeTSChunk(v)
+	if err != nil {
+		return nil, err
+	}
+	s.chunks[bucket] = samples
+	return samples, nil
+}
+
+// add the sample to the series, the sample with the same timestamp will be replaced
+func (w *tsWriter) addSample(s *tsSeries, ts int64, v float64) error {
+	if ts < 0 {
+		return ErrTSTimestamp
+	}
+	tm := s.tm
+	if ts < tm.minRetainedTs() {
+		return ErrTSTooOld
+	}
+	bucket := tm.bucket(ts)
+	samples, err := w.loadChunk(s, bucket)
+	if err != nil {
+		return err
+	}
+	pos := sort.Search(len(samples), func(i int) bool {
+		return samples[i].Ts >= ts
+	})
+	isNew := true
+	if pos < len(samples) && samples[pos].Ts == ts {
+		samples[pos].Value = v
+		isNew = false
+	} else {
+		samples = append(samples, TSSample{})
+		copy(samples[pos+1:], samples[pos:])
+		samples[pos] = TSSample{Ts: ts, Value: v}
+	}
+	s.chunks[bucket] = samples
+	s.dirty[bucket] = true
+	if tm.Samples == 0 || ts >= tm.LastTs {
+		tm.LastTs = ts
+		tm.LastValue = v
+	}
+	if !isNew {
+		return nil
+	}
+	tm.Samples++
+	for i := range tm.Rules {
+		if err := w.applyRule(s, &tm.Rules[i], ts, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggregate the sample for the compaction rule, the aggregated sample will be added to
+// the destination while the bucket is closed. The samples older than the current bucket
+// will be ignored.
+func (w *tsWriter) applyRule(src *tsSeries, r *tsRule, ts int64, v float64) error {
+	start := ts - ts%r.Bucket
+	if r.State.Count > 0 && start != r.CurStart {
+		if start < r.CurStart {
+			return nil
+		}
+		dest, err := w.getSeries(r.Dest, nil)
+		if err != nil {
+			return err
+		}
+		// the destination may be deleted or recreated
+		if dest != nil && bytes.Equal(dest.tm.Src, src.key) {
+			if err := w.addSample(dest, r.CurStart, r.State.value(r.AggType)); err != nil {
+				return err
+			}
+		}
+		r.State = tsAggState{}
+	}
+	if r.State.Count == 0 {
+		r.CurStart = start
+	}
+	r.State.add(v)
+	return nil
+}
+
+// delete the chunks out of the retention
+func (w *tsWriter) trimRetention(s *tsSeries, wb engine.WriteBatch) error {
+	minTs := s.tm.minRetainedTs()
+	if minTs <= 0 {
+		return nil
+	}
+	// the chunks before this bucket are all out of the retention
+	endBucket := s.tm.bucket(minTs)
+	deleted := make(map[int64]int64)
+	if !s.created {
+		start, err := extEncodeDataKey(TSDataExtType, s.table, s.rk, s.m.Ver, int64(0))
+		if err != nil {
+			return err
+		}
+		end, err := extEncodeDataKey(TSDataExtType, s.table, s.rk, s.m.Ver, endBucket)
+		if err != nil {
+			return err
+		}
+		it, err := w.db.NewDBRangeIterator(start, end, common.RangeROpen, false)
+		if err != nil {
+			return err
+		}
+		for ; it.Valid(); it.Next() {
+			// the decoded values are the version and the bucket
+			_, _, _, vals, err := extDecodeDataKey(it.RefKey())
+			if err != nil || len(vals) < 2 {
+				continue
+			}
+			bucket, ok := vals[1].(int64)
+			if !ok {
+				continue
+			}
+			cnt, err := tsChunkCount(it.RefValue())
+			if err != nil {
+				it.Close()
+				return err
+			}
+			deleted[bucket] = cnt
+		}
+		it.Close()
+		if len(deleted) > 0 {
+			wb.DeleteRange(start, end)
+		}
+	}
+	for bucket, samples := range s.chunks {
+		if bucket < endBucket {
+			deleted[bucket] = int64(len(samples))
+			delete(s.chunks, bucket)
+			delete(s.dirty, bucket)
+		}
+	}
+	for _, cnt := range deleted {
+		s.tm.Samples -= cnt
+	}
+	if s.tm.Samples < 0 {
+		s.tm.Samples = 0
+	}
+	return nil
+}
+
+func (w *tsWriter) commit() error {
+	wb := w.db.wb
+	for _, k := range w.keys {
+		s := w.series[k]
+		if s.created {
+			m, created, err := w.db.extGetMetaForWrite(w.ts, TSMetaExtType, s.key, wb)
+			if err != nil {
+				return err
+			}
+			if !created {
+				return ErrTSExist
+			}
+			s.m.Ver = m.Ver
+		}
+		if err := w.trimRetention(s, wb); err != nil {
+			return err
+		}
+		buckets := make([]int64, 0, len(s.dirty))
+		for b := range s.dirty {
+			buckets = append(buckets, b)
+		}
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+		for _, b := range buckets {
+			ck, err := extEncodeDataKey(TSDataExtType, s.table, s.rk, s.m.Ver, b)
+			if err != nil {
+				return err
+			}
+			wb.Put(ck, encodeTSChunk(s.chunks[b]))
+		}
+		s.m.Data = s.tm.encode()
+		w.db.extSetMeta(TSMetaExtType, s.key, s.m, wb)
+	}
+	return w.db.MaybeCommitBatch()
+}
+
+// TSCreate create the time series with the retention, chunk duration and labels
+func (db *RockDB) TSCreate(ts int64, key []byte, opts *TSCreateOptions) error {
+	if opts == nil {
+		opts = &TSCreateOptions{}
+	}
+	w := newTSWriter(db, ts)
+	s, err := w.getSeries(key, opts)
+	if err != nil {
+		return err
+	}
+	if !s.created {
+		return ErrTSExist
+	}
+	return w.commit()
+}
+
+// TSAdd add the sample to the series, the series will be created using the options if
+// not exist. The timestamp of the sample is returned.
+func (db *RockDB) TSAdd(ts int64, key []byte, sampleTs int64, v float64, opts *TSCreateOptions) (int64, error) {
+	if opts == nil {
+		opts = &TSCreateOptions{}
+	}
+	w := newTSWriter(db, ts)
+	s, err := w.getSeries(key, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.addSample(s, sampleTs, v); err != nil {
+		return 0, err
+	}
+	return sampleTs, w.commit()
+}
+
+// TSMAdd add the samples to multi series, all the series should be created before, and no sample will
+// be added if any error happened.
+func (db *RockDB) TSMAdd(ts int64, keys [][]byte, sampleTss []int64, vals []float64) ([]int64, error) {
+	if len(keys) > MAX_BATCH_NUM {
+		return nil, errTooMuchBatchSize
+	}
+	if len(keys) != len(sampleTss) || len(keys) != len(vals) {
+		return nil, common.ErrInvalidArgs
+	}
+	w := newTSWriter(db, ts)
+	for i, key := range keys {
+		s, err := w.getSeries(key, nil)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			return nil, ErrTSNotFound
+		}
+		if err := w.addSample(s, sampleTss[i], vals[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sampleTss, w.commit()
+}
+
+// TSCreateRule create the compaction rule from the source to the destination, both the series should be
+// created before and should be in the same partition.
+func (db *RockDB) TSCreateRule(ts int64, src []byte, dest []byte, aggType string, bucket int64) error {
+	at, err := parseTSAggType(aggType)
+	if err != nil {
+		return err
+	}
+	if bucket <= 0 {
+		return ErrTSBucket
+	}
+	if bytes.Equal(src, dest) {
+		return ErrTSRuleSameKey
+	}
+	w := newTSWriter(db, ts)
+	srcS, err := w.getSeries(src, nil)
+	if err != nil {
+		return err
+	}
+	destS, err := w.getSeries(dest, nil)
+	if err != nil {
+		return err
+	}
+	if srcS == nil || destS == nil {
+		return ErrTSNotFound
+	}
+	// no compaction chain is allowed
+	if len(srcS.tm.Src) > 0 || len(destS.tm.Rules) > 0 {
+		return ErrTSRuleCompaction
+	}
+	if len(destS.tm.Src) > 0 {
+		oldSrc, err := w.getSeries(destS.tm.Src, nil)
+		if err != nil {
+			return err
+		}
+		if oldSrc != nil && oldSrc.tm.findRule(dest) >= 0 {
+			return ErrTSRuleExist
+		}
+	}
+	if srcS.tm.findRule(dest) >= 0 {
+		return ErrTSRuleExist
+	}
+	srcS.tm.Rules = append(srcS.tm.Rules, tsRule{
+		Dest:    dest,
+		AggType: at,
+		Bucket:  bucket,
+	})
+	destS.tm.Src = src
+	return w.commit()
+}
+
+func (tm *tsMeta) findRule(dest []byte) int {
+	for i, r := range tm.Rules {
+		if bytes.Equal(r.Dest, dest) {
+			return i
+		}
+	}
+	return -1
+}
+
+// TSDeleteRule delete the compaction rule from the source to the destination
+func (db *RockDB) TSDeleteRule(ts int64, src []byte, dest []byte) error {
+	w := newTSWriter(db, ts)
+	srcS, err := w.getSeries(src, nil)
+	if err != nil {
+		return err
+	}
+	if srcS == nil {
+		return ErrTSNotFound
+	}
+	idx := srcS.tm.findRule(dest)
+	if idx < 0 {
+		return ErrTSRuleNotFound
+	}
+	srcS.tm.Rules = append(srcS.tm.Rules[:idx], srcS.tm.Rules[idx+1:]...)
+	destS, err := w.getSeries(dest, nil)
+	if err != nil {
+		return err
+	}
+	if destS != nil && bytes.Equal(destS.tm.Src, src) {
+		destS.tm.Src = nil
+	}
+	return w.commit()
+}
+
+func (db *RockDB) getTSMeta(key []byte) (*extMeta, *tsMeta, error) {
+	m, err := db.extGetMeta(time.Now().UnixNano(), TSMetaExtType, key, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m == nil {
+		return nil, nil, ErrTSNotFound
+	}
+	tm, err := decodeTSMeta(m.Data)
+	return m, tm, err
+}
+
+// TSGet return the last sample, nil if no sample in the series
+func (db *RockDB) TSGet(key []byte) (*TSSample, error) {
+	_, tm, err := db.getTSMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	if tm.Samples == 0 {
+		return nil, nil
+	}
+	return &TSSample{Ts: tm.LastTs, Value: tm.LastValue}, nil
+}
+
+// TSInfo return the information of the series
+func (db *RockDB) TSInfo(key []byte) (*TSInfo, error) {
+	m, tm, err := db.getTSMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	info := &TSInfo{
+		Samples:       tm.Samples,
+		LastTimestamp: tm.LastTs,
+		Retention:     tm.Retention,
+		ChunkDuration: tm.ChunkDuration,
+		Labels:        tm.Labels,
+		Src:           tm.Src,
+	}
+	if tm.Samples > 0 {
+		first, err := db.tsRange(key, m, tm, 0, math.MaxInt64, &TSRangeOptions{Count: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(first) > 0 {
+			info.FirstTimestamp = first[0].Ts
+		}
+	}
+	for _, r := range tm.Rules {
+		info.Rules = append(info.Rules, TSRuleInfo{
+			Dest:    r.Dest,
+			AggType: tsAggNames[r.AggType],
+			Bucket:  r.Bucket,
+		})
+	}
+	return info, nil
+}
+
+// TSRange return the samples in the range [start, end], the samples will be aggregated by
+// the time bucket if the aggregation type is given.
+func (db *RockDB) TSRange(key []byte, start int64, end int64, opts *TSRangeOptions) ([]TSSample, error) {
+	if opts == nil {
+		opts = &TSRangeOptions{}
+	}
+	m, tm, err := db.getTSMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	return db.tsRange(key, m, tm, start, end, opts)
+}
+
+func (db *RockDB) tsRange(key []byte, m *extMeta, tm *tsMeta, start int64, end int64, opts *TSRangeOptions) ([]TSSample, error) {
+	var aggType byte
+	if opts.AggType != "" {
+		var err error
+		aggType, err = parseTSAggType(opts.AggType)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Bucket <= 0 {
+			return nil, ErrTSBucket
+		}
+	}
+	if minTs := tm.minRetainedTs(); start < minTs {
+		start = minTs
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > end || tm.Samples == 0 {
+		return nil, nil
+	}
+	table, rk, err := extractTableFromRedisKey(key)
+	if err != nil {
+		return nil, err
+	}
+	minKey, err := extEncodeDataKey(TSDataExtType, table, rk, m.Ver, tm.bucket(start))
+	if err != nil {
+		return nil, err
+	}
+	maxKey, err := extEncodeDataKey(TSDataExtType, table, rk, m.Ver, tm.bucket(end))
+	if err != nil {
+		return nil, err
+	}
+	it, err := db.NewDBRangeIterator(minKey, maxKey, common.RangeClose, opts.Reverse)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	rets := make([]TSSample, 0)
+	var agg tsAggState
+	var aggStart int64
+	isFull := func() bool {
+		return opts.Count > 0 && int64(len(rets)) >= opts.Count
+	}
+	for ; it.Valid() && !isFull(); it.Next() {
+		samples, err := decodeTSChunk(it.RefValue())
+		if err != nil {
+			return nil, err
+		}
+		for i := range samples {
+			s := samples[i]
+			if opts.Reverse {
+				s = samples[len(samples)-1-i]
+			}
+			if s.Ts < start || s.Ts > end {
+				continue
+			}
+			if aggType == 0 {
+				rets = append(rets, s)
+				if isFull() {
+					break
+				}
+				continue
+			}
+			bs := s.Ts - s.Ts%opts.Bucket
+			if agg.Count > 0 && bs != aggStart {
+				rets = append(rets, TSSample{Ts: aggStart, Value: agg.value(aggType)})
+				agg = tsAggState{}
+				if isFull() {
+					break
+				}
+			}
+			aggStart = bs
+			agg.add(s.Value)
+		}
+	}
+	if agg.Count > 0 && !isFull() {
+		rets = append(rets, TSSample{Ts: aggStart, Value: agg.value(aggType)})
+	}
+	return rets, nil
+}
+
+// TSMRange query the range for all the series in the table matched the label filters.
+func (db *RockDB) TSMRange(table []byte, start int64, end int64, filters []TSLabelFilter,
+	opts *TSRangeOptions) ([]TSRangeResult, error) {
+	if opts == nil {
+		opts = &TSRangeOptions{}
+	}
+	prefix := extEncodeMetaKey(TSMetaExtType, append(append([]byte{}, table...), tableStartSep))
+	minKey := prefix
+	maxKey := append(append([]byte{}, prefix[:len(prefix)-1]...), tableStartSep+1)
+	it, err := db.NewDBRangeIterator(minKey, maxKey, common.RangeROpen, false)
+	if err != nil {
+		return nil, err
+	}
+	type matchedSeries struct {
+		key []byte
+		m   *extMeta
+		tm  *tsMeta
+	}
+	tn := time.Now().UnixNano()
+	matched := make([]matchedSeries, 0)
+	for ; it.Valid(); it.Next() {
+		_, key, err := extDecodeMetaKey(it.Key())
+		if err != nil {
+			continue
+		}
+		m, err := decodeExtMeta(it.Value())
+		if err != nil || m.isExpired(tn) {
+			continue
+		}
+		tm, err := decodeTSMeta(m.Data)
+		if err != nil {
+			continue
+		}
+		if !tm.matchLabels(filters) {
+			continue
+		}
+		matched = append(matched, matchedSeries{key: key, m: m, tm: tm})
+	}
+	it.Close()
+	rets := make([]TSRangeResult, 0, len(matched))
+	for _, s := range matched {
+		samples, err := db.tsRange(s.key, s.m, s.tm, start, end, opts)
+		if err != nil {
+			return nil, err
+		}
+		rets = append(rets, TSRangeResult{Key: s.key, Labels: s.tm.Labels, Samples: samples})
+	}
+	return rets, nil
+}
+
+func (db *RockDB) TSClear(ts int64, key []byte) (int64, error) {
+	return db.extDelete(ts, TSMetaExtType, key)
+}
+
+func (db *RockDB) TSKeyExists(key []byte) (int64, error) {
+	return db.extKeyExists(TSMetaExtType, key)
+}
+
+func (db *RockDB) TSExpire(ts int64, key []byte, ttlSec int64) (int64, error) {
+	return db.extExpire(ts, TSMetaExtType, key, ttlSec)
+}
+
+func (db *RockDB) TSPersist(ts int64, key []byte) (int64, error) {
+	return db.extPersist(ts, TSMetaExtType, key)
+}
+
+func (db *RockDB) TSTtl(key []byte) (int64, error) {
+	return db.extTTL(TSMetaExtType, key)
+}
@@ -0,0 +1,310 @@
+package rockredis
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTSChunkEncodeDecode(t *testing.T) {
+	samples := make([]TSSample, 0, 1000)
+	ts := int64(1600000000000)
+	v := 100.0
+	for i := 0; i < 1000; i++ {
+		switch i % 4 {
+		case 0:
+			ts += 1000
+		case 1:
+			ts += int64(rand.Intn(100000))
+		case 2:
+			ts += math.MaxInt32
+		default:
+			ts++
+		}
+		if i%3 == 0 {
+			v += rand.Float64()
+		} else if i%5 == 0 {
+			v = -v
+		}
+		samples = append(samples, TSSample{Ts: ts, Value: v})
+	}
+	for _, n := range []int{0, 1, 2, 3, 10, len(samples)} {
+		buf := encodeTSChunk(samples[:n])
+		cnt, err := tsChunkCount(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(n), cnt)
+		decoded, err := decodeTSChunk(buf)
+		assert.Nil(t, err)
+		if n == 0 {
+			assert.Equal(t, 0, len(decoded))
+			continue
+		}
+		assert.Equal(t, samples[:n], decoded)
+	}
+	// the regular samples should be compressed
+	regular := make([]TSSample, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		regular = append(regular, TSSample{Ts: int64(i) * 1000, Value: 1})
+	}
+	buf := encodeTSChunk(regular)
+	assert.True(t, len(buf) < 300, "compressed size: %v", len(buf))
+	_, err := decodeTSChunk(buf[:len(buf)/2])
+	assert.NotNil(t, err)
+}
+
+func TestTSAddAndRange(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_ts")
+	tn := time.Now().UnixNano()
+	opts := &TSCreateOptions{ChunkDuration: 100, Labels: []TSLabel{{Name: "host", Value: "h1"}}}
+	err := db.TSCreate(tn, key, opts)
+	assert.Nil(t, err)
+	err = db.TSCreate(tn, key, opts)
+	assert.Equal(t, ErrTSExist, err)
+	_, err = db.TSRange([]byte("test:testdb_ts_not_exist"), 0, 100, nil)
+	assert.Equal(t, ErrTSNotFound, err)
+	_, err = db.TSMAdd(tn, [][]byte{key, []byte("test:testdb_ts_not_exist")}, []int64{1, 1}, []float64{1, 1})
+	assert.Equal(t, ErrTSNotFound, err)
+	v, err := db.TSGet(key)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	for i := int64(0); i < 1000; i += 10 {
+		ret, err := db.TSAdd(tn, key, i, float64(i), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, i, ret)
+	}
+	_, err = db.TSAdd(tn, key, -1, 1, nil)
+	assert.Equal(t, ErrTSTimestamp, err)
+	// out of order and duplicate
+	_, err = db.TSAdd(tn, key, 5, 5, nil)
+	assert.Nil(t, err)
+	_, err = db.TSAdd(tn, key, 10, 11, nil)
+	assert.Nil(t, err)
+	rets, err := db.TSMAdd(tn, [][]byte{key, key}, []int64{995, 15}, []float64{995, 15})
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{995, 15}, rets)
+
+	v, err = db.TSGet(key)
+	assert.Nil(t, err)
+	assert.Equal(t, &TSSample{Ts: 995, Value: 995}, v)
+	info, err := db.TSInfo(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(103), info.Samples)
+	assert.Equal(t, int64(0), info.FirstTimestamp)
+	assert.Equal(t, int64(995), info.LastTimestamp)
+	assert.Equal(t, int64(100), info.ChunkDuration)
+	assert.Equal(t, opts.Labels, info.Labels)
+
+	samples, err := db.TSRange(key, 0, 20, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{0, 0}, {5, 5}, {10, 11}, {15, 15}, {20, 20}}, samples)
+	samples, err = db.TSRange(key, 0, math.MaxInt64, &TSRangeOptions{Reverse: true, Count: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{995, 995}, {990, 990}, {980, 980}}, samples)
+	samples, err = db.TSRange(key, 95, 215, &TSRangeOptions{Count: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{100, 100}, {110, 110}, {120, 120}}, samples)
+
+	samples, err = db.TSRange(key, 0, 299, &TSRangeOptions{AggType: "avg", Bucket: 100})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(samples))
+	assert.Equal(t, TSSample{Ts: 100, Value: 145}, samples[1])
+	samples, err = db.TSRange(key, 0, 299, &TSRangeOptions{AggType: "count", Bucket: 100, Reverse: true, Count: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{200, 10}, {100, 10}}, samples)
+	samples, err = db.TSRange(key, 0, 99, &TSRangeOptions{AggType: "max", Bucket: 50})
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{0, 40}, {50, 90}}, samples)
+	samples, err = db.TSRange(key, 0, 99, &TSRangeOptions{AggType: "min", Bucket: 50})
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{0, 0}, {50, 50}}, samples)
+	samples, err = db.TSRange(key, 0, 49, &TSRangeOptions{AggType: "sum", Bucket: 50})
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{0, 0 + 5 + 11 + 15 + 20 + 30 + 40}}, samples)
+	_, err = db.TSRange(key, 0, 99, &TSRangeOptions{AggType: "unknown", Bucket: 50})
+	assert.Equal(t, ErrTSAggregation, err)
+
+	n, err := db.TSExpire(tn, key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	ttl, err := db.TSTtl(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl <= 10 && ttl > 0)
+	n, err = db.TSPersist(tn, key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.TSClear(tn, key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = db.TSKeyExists(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	// auto created by add
+	_, err = db.TSAdd(tn, key, 1, 1, &TSCreateOptions{Retention: 100})
+	assert.Nil(t, err)
+	samples, err = db.TSRange(key, 0, 100, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{1, 1}}, samples)
+}
+
+func TestTSRetention(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	key := []byte("test:testdb_ts_retention")
+	tn := time.Now().UnixNano()
+	err := db.TSCreate(tn, key, &TSCreateOptions{Retention: 1000, ChunkDuration: 100})
+	assert.Nil(t, err)
+	for i := int64(0); i < 1000; i++ {
+		_, err = db.TSAdd(tn, key, i, float64(i), nil)
+		assert.Nil(t, err)
+	}
+	info, err := db.TSInfo(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000), info.Samples)
+	_, err = db.TSAdd(tn, key, 2550, 1, nil)
+	assert.Nil(t, err)
+	// the chunks before 1500 should be deleted
+	info, err = db.TSInfo(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), info.Samples)
+	assert.Equal(t, int64(2550), info.FirstTimestamp)
+	_, err = db.TSAdd(tn, key, 1549, 1, nil)
+	assert.Equal(t, ErrTSTooOld, err)
+	_, err = db.TSAdd(tn, key, 1550, 1, nil)
+	assert.Nil(t, err)
+	samples, err := db.TSRange(key, 0, math.MaxInt64, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{1550, 1}, {2550, 1}}, samples)
+	_, err = db.TSAdd(tn, key, 2560, 1, nil)
+	assert.Nil(t, err)
+	// the sample out of retention should not be returned even the chunk is not deleted
+	samples, err = db.TSRange(key, 0, math.MaxInt64, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{2550, 1}, {2560, 1}}, samples)
+	info, err = db.TSInfo(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), info.Samples)
+}
+
+func TestTSCompactionRule(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	src := []byte("test:testdb_ts_src")
+	dest := []byte("test:testdb_ts_dest")
+	dest2 := []byte("test:testdb_ts_dest2")
+	tn := time.Now().UnixNano()
+	for _, k := range [][]byte{src, dest, dest2} {
+		err := db.TSCreate(tn, k, nil)
+		assert.Nil(t, err)
+	}
+	err := db.TSCreateRule(tn, src, []byte("test:testdb_ts_not_exist"), "avg", 10)
+	assert.Equal(t, ErrTSNotFound, err)
+	err = db.TSCreateRule(tn, src, dest, "unknown", 10)
+	assert.Equal(t, ErrTSAggregation, err)
+	err = db.TSCreateRule(tn, src, dest, "avg", 0)
+	assert.Equal(t, ErrTSBucket, err)
+	err = db.TSCreateRule(tn, src, src, "avg", 10)
+	assert.Equal(t, ErrTSRuleSameKey, err)
+	err = db.TSCreateRule(tn, src, dest, "avg", 10)
+	assert.Nil(t, err)
+	err = db.TSCreateRule(tn, src, dest2, "max", 20)
+	assert.Nil(t, err)
+	err = db.TSCreateRule(tn, src, dest, "sum", 10)
+	assert.Equal(t, ErrTSRuleExist, err)
+	err = db.TSCreateRule(tn, dest, dest2, "sum", 10)
+	assert.Equal(t, ErrTSRuleCompaction, err)
+
+	info, err := db.TSInfo(src)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSRuleInfo{{Dest: dest, AggType: "avg", Bucket: 10}, {Dest: dest2, AggType: "max", Bucket: 20}}, info.Rules)
+	info, err = db.TSInfo(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, src, info.Src)
+
+	for i := int64(0); i < 45; i++ {
+		_, err = db.TSAdd(tn, src, i, float64(i), nil)
+		assert.Nil(t, err)
+	}
+	samples, err := db.TSRange(dest, 0, math.MaxInt64, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{0, 4.5}, {10, 14.5}, {20, 24.5}, {30, 34.5}}, samples)
+	samples, err = db.TSRange(dest2, 0, math.MaxInt64, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{0, 19}, {20, 39}}, samples)
+	// the sample for the closed bucket is ignored
+	_, err = db.TSAdd(tn, src, 100, 100, nil)
+	assert.Nil(t, err)
+	_, err = db.TSAdd(tn, src, 50, 50, nil)
+	assert.Nil(t, err)
+	samples, err = db.TSRange(dest, 40, math.MaxInt64, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{40, 42}}, samples)
+
+	err = db.TSDeleteRule(tn, src, dest)
+	assert.Nil(t, err)
+	err = db.TSDeleteRule(tn, src, dest)
+	assert.Equal(t, ErrTSRuleNotFound, err)
+	info, err = db.TSInfo(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(info.Src))
+	_, err = db.TSAdd(tn, src, 200, 200, nil)
+	assert.Nil(t, err)
+	samples, err = db.TSRange(dest, 100, math.MaxInt64, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(samples))
+	samples, err = db.TSRange(dest2, 100, math.MaxInt64, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{100, 100}}, samples)
+}
+
+func TestTSMRange(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	tn := time.Now().UnixNano()
+	labels := [][]TSLabel{
+		{{Name: "type", Value: "cpu"}, {Name: "host", Value: "h1"}},
+		{{Name: "type", Value: "cpu"}, {Name: "host", Value: "h2"}},
+		{{Name: "type", Value: "mem"}, {Name: "host", Value: "h1"}},
+		nil,
+	}
+	keys := [][]byte{[]byte("test:ts_m1"), []byte("test:ts_m2"), []byte("test:ts_m3"), []byte("test:ts_m4")}
+	for i, k := range keys {
+		_, err := db.TSAdd(tn, k, int64(i), float64(i), &TSCreateOptions{Labels: labels[i]})
+		assert.Nil(t, err)
+	}
+	_, err := db.TSAdd(tn, []byte("test2:ts_m1"), 1, 1, &TSCreateOptions{Labels: labels[0]})
+	assert.Nil(t, err)
+
+	rets, err := db.TSMRange([]byte("test"), 0, math.MaxInt64, []TSLabelFilter{{Name: "type", Value: "cpu"}}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rets))
+	assert.Equal(t, keys[0], rets[0].Key)
+	assert.Equal(t, labels[0], rets[0].Labels)
+	assert.Equal(t, []TSSample{{0, 0}}, rets[0].Samples)
+	assert.Equal(t, keys[1], rets[1].Key)
+
+	rets, err = db.TSMRange([]byte("test"), 0, math.MaxInt64, []TSLabelFilter{{Name: "host", Value: "h1"},
+		{Name: "type", Value: "cpu", NotEqual: true}}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rets))
+	assert.Equal(t, keys[2], rets[0].Key)
+
+	rets, err = db.TSMRange([]byte("test"), 0, math.MaxInt64, []TSLabelFilter{{Name: "type", Value: "cpu", NotEqual: true}}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rets))
+	assert.Equal(t, keys[3], rets[1].Key)
+}
@@ -110,6 +110,7 @@ type expiration interface {
 	encodeToRawValue(dt byte, h *headerMetaValue) []byte
 	delExpire(dt byte, key []byte, rawValue []byte, keepValue bool, wb engine.WriteBatch) ([]byte, error)
 	renewOnExpired(ts int64, dt byte, key []byte, oldh *headerMetaValue)
+	setNextCheckTime(when int64, force bool)
 	check(common.ExpiredDataBuffer, chan struct{}) error
 	Start()
 	Stop()
@@ -300,6 +300,11 @@ func (exp *compactExpiration) renewOnExpired(ts int64, dataType byte, key []byte
 	}
 }
 
+func (exp *compactExpiration) setNextCheckTime(when int64, force bool) {
+	// the ttl checker is still used for the data without header (such as hash field)
+	exp.localExp.setNextCheckTime(when, force)
+}
+
 func (exp *compactExpiration) Start() {
 	exp.localExp.Start()
 }
@@ -166,14 +166,17 @@ type localBatchedBuffer struct {
 	db      *RockDB
 	buff    []*expiredMeta
 	batched [common.ALL - common.NONE]*localBatch
-	cap     int
+	// used for deleting the expired hash fields and extanded types
+	delWb engine.WriteBatch
+	cap   int
 }
 
 func newLocalBatchedBuffer(db *RockDB, cap int) *localBatchedBuffer {
 	batchedBuff := &localBatchedBuffer{
-		buff: make([]*expiredMeta, 0, cap),
-		db:   db,
-		cap:  cap,
+		buff:  make([]*expiredMeta, 0, cap),
+		db:    db,
+		delWb: db.rockEng.NewWriteBatch(),
+		cap:   cap,
 	}
 
 	types := []common.DataType{common.KV, common.LIST, common.HASH,
@@ -201,6 +204,7 @@ func (lbb *localBatchedBuffer) Destroy() {
 			b.destroy()
 		}
 	}
+	lbb.delWb.Destroy()
 }
 
 func (self *localBatchedBuffer) Write(meta *expiredMeta) error {
@@ -219,6 +223,20 @@ func (self *localBatchedBuffer) commit() {
 
 	for _, v := range self.buff {
 		dt, key, _, err := expDecodeTimeKey(v.timeKey)
+		if err == nil && dt == HFieldExpType {
+			err = self.db.hDelExpiredField(v.timeKey, v.metaKey, key, self.delWb)
+			if err != nil {
+				dbLog.Errorf("delete expired hash field failed, err:%s", err.Error())
+			}
+			continue
+		}
+		if err == nil && dt == ExtandType {
+			err = self.db.extDelExpired(v.timeKey, v.metaKey, key, self.delWb)
+			if err != nil {
+				dbLog.Errorf("delete expired extanded type data failed, err:%s", err.Error())
+			}
+			continue
+		}
 		if err != nil || dataType2CommonType(dt) == common.NONE {
 			// currently the bitmap/json type is not supported
 			if err != nil {
@@ -0,0 +1,99 @@
+package rockredis
+
+import (
+	"encoding/json"
+
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func (im *IndexMgr) loadTableSchemas(db *RockDB) error {
+	tables := db.GetSchemaTables()
+	for _, t := range tables {
+		d, err := db.GetTableSchemaValue(t)
+		if err != nil {
+			dbLog.Infof("get table %v schema failed: %v", string(t), err)
+			continue
+		}
+		if d == nil {
+			continue
+		}
+		var schema common.TableSchema
+		err = json.Unmarshal(d, &schema)
+		if err != nil {
+			dbLog.Infof("unmarshal table %v schema failed: %v", string(t), err)
+			return err
+		}
+		im.Lock()
+		indexes, ok := im.tableIndexes[string(t)]
+		if !ok {
+			indexes = NewIndexContainer()
+			im.tableIndexes[string(t)] = indexes
+		}
+		im.Unlock()
+		indexes.Lock()
+		indexes.tableSchema = &schema
+		indexes.Unlock()
+		dbLog.Infof("table %v load schema version %v", string(t), schema.Version)
+	}
+	return nil
+}
+
+// SetTableSchema add or update the table schema, the schema with older version will be ignored.
+func (im *IndexMgr) SetTableSchema(db *RockDB, table string, schema *common.TableSchema) error {
+	im.Lock()
+	indexes, ok := im.tableIndexes[table]
+	if !ok {
+		indexes = NewIndexContainer()
+		im.tableIndexes[table] = indexes
+	}
+	im.Unlock()
+	indexes.Lock()
+	defer indexes.Unlock()
+	if indexes.tableSchema != nil && indexes.tableSchema.Version > schema.Version {
+		dbLog.Infof("table %v schema version %v ignored since current is %v", table,
+			schema.Version, indexes.tableSchema.Version)
+		return nil
+	}
+	d, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	err = db.SetTableSchemaValue([]byte(table), d)
+	if err != nil {
+		return err
+	}
+	indexes.tableSchema = schema
+	dbLog.Infof("table %v schema updated: %v", table, string(d))
+	return nil
+}
+
+func (im *IndexMgr) DeleteTableSchema(db *RockDB, table string) error {
+	indexes := im.GetTableIndexes(table)
+	if indexes == nil {
+		return nil
+	}
+	indexes.Lock()
+	defer indexes.Unlock()
+	if indexes.tableSchema == nil {
+		return nil
+	}
+	err := db.SetTableSchemaValue([]byte(table), nil)
+	if err != nil {
+		return err
+	}
+	indexes.tableSchema = nil
+	dbLog.Infof("table %v schema deleted", table)
+	return nil
+}
+
+// GetTableSchema return the schema of the table, nil if no schema declared.
+// The returned schema should not be changed.
+func (im *IndexMgr) GetTableSchema(table string) *common.TableSchema {
+	indexes := im.GetTableIndexes(table)
+	if indexes == nil {
+		return nil
+	}
+	indexes.RLock()
+	defer indexes.RUnlock()
+	return indexes.tableSchema
+}
@@ -0,0 +1,132 @@
+package rockredis
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youzan/ZanRedisDB/common"
+)
+
+func TestTableSchemaSetAndLoad(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	table := "test_table_schema"
+	assert.Nil(t, db.GetTableSchema(table))
+	schema := &common.TableSchema{
+		Fields:  []common.TableFieldSchema{{Name: "id", Type: common.FieldInt, Required: true}},
+		Version: 2,
+	}
+	err := db.SetTableSchema(table, schema)
+	assert.Nil(t, err)
+	assert.Equal(t, schema, db.GetTableSchema(table))
+
+	// the older version should be ignored
+	err = db.SetTableSchema(table, &common.TableSchema{
+		Fields:  []common.TableFieldSchema{{Name: "name", Type: common.FieldString}},
+		Version: 1,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), db.GetTableSchema(table).Version)
+
+	im := NewIndexMgr()
+	err = im.loadTableSchemas(db)
+	assert.Nil(t, err)
+	loaded := im.GetTableSchema(table)
+	assert.NotNil(t, loaded)
+	assert.Equal(t, *schema, *loaded)
+
+	allSchemas, err := db.GetAllIndexSchema()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), allSchemas[table].TableSchema.Version)
+
+	err = db.DeleteTableSchema(table)
+	assert.Nil(t, err)
+	assert.Nil(t, db.GetTableSchema(table))
+	im = NewIndexMgr()
+	err = im.loadTableSchemas(db)
+	assert.Nil(t, err)
+	assert.Nil(t, im.GetTableSchema(table))
+}
+
+func TestTableSchemaFillDefaults(t *testing.T) {
+	db := getTestDB(t)
+	defer os.RemoveAll(db.cfg.DataDir)
+	defer db.Close()
+
+	defAge := "18"
+	err := db.SetTableSchema("test", &common.TableSchema{
+		Fields: []common.TableFieldSchema{
+			{Name: "id", Type: common.FieldInt},
+			{Name: "age", Type: common.FieldInt, Default: &defAge},
+		},
+		Version: 1,
+	})
+	assert.Nil(t, err)
+
+	// the default fields are written while creating the hash
+	key := []byte("test:hash_defaults")
+	n, err := db.HSet(0, false, key, []byte("id"), []byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	v, err := db.HGet(key, []byte("age"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("18"), v)
+	n, err = db.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// the field written by others should not be overwritten by the defaults
+	key = []byte("test:hash_defaults2")
+	err = db.HMset(0, key, common.KVRecord{Key: []byte("age"), Value: []byte("20")})
+	assert.Nil(t, err)
+	n, err = db.HSet(0, false, key, []byte("id"), []byte("2"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	v, err = db.HGet(key, []byte("age"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("20"), v)
+	err = db.HMset(0, key, common.KVRecord{Key: []byte("id"), Value: []byte("3")})
+	assert.Nil(t, err)
+	v, err = db.HGet(key, []byte("age"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("20"), v)
+
+	// the json created at the path should have the default fields
+	key = []byte("test:json_defaults")
+	n, err = db.JSet(0, key, []byte("id"), []byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	vals, err := db.JGet(key, []byte("age"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"18"}, vals)
+	_, err = db.JSet(0, key, []byte("age"), []byte("20"))
+	assert.Nil(t, err)
+	_, err = db.JSet(0, key, []byte("id"), []byte("2"))
+	assert.Nil(t, err)
+	vals, err = db.JGet(key, []byte("age"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20"}, vals)
+
+	// the hash created by hincrby should have the default fields
+	key = []byte("test:hash_incr_defaults")
+	n, err = db.HIncrBy(0, key, []byte("id"), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = db.HIncrBy(0, key, []byte("id"), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	v, err = db.HGet(key, []byte("age"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("18"), v)
+
+	// the json created by the merge should have the default fields
+	key = []byte("test:json_merge_defaults")
+	err = db.JMerge(0, key, []byte(""), []byte(`{"id":1}`))
+	assert.Nil(t, err)
+	vals, err = db.JGet(key, []byte("age"), []byte("id"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"18", "1"}, vals)
+}
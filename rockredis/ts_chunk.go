@@ -0,0 +1,267 @@
+package rockredis
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// The samples in the time series chunk are compressed using the gorilla encoding.
+// The timestamps are encoded using delta-of-delta and the values are encoded
+// by xor with the previous value.
+// chunk: uvarint(sample number) | bit stream of samples
+// the first sample is stored as raw 64 bits timestamp and 64 bits value.
+
+var errTSChunkData = errors.New("invalid time series chunk data")
+
+// TSSample is the sample in time series, the timestamp is in milliseconds
+type TSSample struct {
+	Ts    int64
+	Value float64
+}
+
+type tsBitWriter struct {
+	buf []byte
+	// the free bits in the last byte
+	free uint8
+}
+
+func (w *tsBitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.buf = append(w.buf, 0)
+		w.free = 8
+	}
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << (w.free - 1)
+	}
+	w.free--
+}
+
+// write the lowest nbits of v, the higher bit first
+func (w *tsBitWriter) writeBits(v uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		w.writeBit((v>>uint(i))&1 == 1)
+	}
+}
+
+type tsBitReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *tsBitReader) readBit() (bool, error) {
+	if r.pos >= len(r.buf)*8 {
+		return false, errTSChunkData
+	}
+	b := r.buf[r.pos/8]&(1<<uint(7-r.pos%8)) != 0
+	r.pos++
+	return b, nil
+}
+
+func (r *tsBitReader) readBits(nbits int) (uint64, error) {
+	var v uint64
+	for i := 0; i < nbits; i++ {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if b {
+			v |= 1
+		}
+	}
+	return v, nil
+}
+
+// the control bits and the value bits for the delta-of-delta timestamp
+var tsDodBuckets = []struct {
+	ctrl     uint64
+	ctrlBits int
+	bits     int
+}{
+	{ctrl: 0x2, ctrlBits: 2, bits: 7},
+	{ctrl: 0x6, ctrlBits: 3, bits: 9},
+	{ctrl: 0xe, ctrlBits: 4, bits: 12},
+}
+
+func tsWriteDod(w *tsBitWriter, dod int64) {
+	if dod == 0 {
+		w.writeBit(false)
+		return
+	}
+	for _, b := range tsDodBuckets {
+		if dod >= -(1<<uint(b.bits-1))+1 && dod <= 1<<uint(b.bits-1) {
+			w.writeBits(b.ctrl, b.ctrlBits)
+			w.writeBits(uint64(dod)&(1<<uint(b.bits)-1), b.bits)
+			return
+		}
+	}
+	w.writeBits(0xf, 4)
+	w.writeBits(uint64(dod), 64)
+}
+
+func tsReadDod(r *tsBitReader) (int64, error) {
+	nbits := 0
+	for i := 0; i < 4; i++ {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !b {
+			break
+		}
+		nbits++
+	}
+	if nbits == 0 {
+		return 0, nil
+	}
+	if nbits == 4 {
+		v, err := r.readBits(64)
+		return int64(v), err
+	}
+	size := tsDodBuckets[nbits-1].bits
+	v, err := r.readBits(size)
+	if err != nil {
+		return 0, err
+	}
+	dod := int64(v)
+	if dod > 1<<uint(size-1) {
+		dod -= 1 << uint(size)
+	}
+	return dod, nil
+}
+
+// encode the samples sorted by timestamp
+func encodeTSChunk(samples []TSSample) []byte {
+	var hdr [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(hdr[:], uint64(len(samples)))
+	w := &tsBitWriter{buf: make([]byte, 0, n+len(samples)*4)}
+	w.buf = append(w.buf, hdr[:n]...)
+	if len(samples) == 0 {
+		return w.buf
+	}
+	w.writeBits(uint64(samples[0].Ts), 64)
+	prevV := math.Float64bits(samples[0].Value)
+	w.writeBits(prevV, 64)
+	prevTs := samples[0].Ts
+	prevDelta := int64(0)
+	prevLeading, prevTrailing := -1, 0
+	for _, s := range samples[1:] {
+		delta := s.Ts - prevTs
+		tsWriteDod(w, delta-prevDelta)
+		prevTs = s.Ts
+		prevDelta = delta
+
+		v := math.Float64bits(s.Value)
+		xor := v ^ prevV
+		prevV = v
+		if xor == 0 {
+			w.writeBit(false)
+			continue
+		}
+		w.writeBit(true)
+		leading := bits.LeadingZeros64(xor)
+		trailing := bits.TrailingZeros64(xor)
+		if leading > 31 {
+			leading = 31
+		}
+		if prevLeading >= 0 && leading >= prevLeading && trailing >= prevTrailing {
+			// reuse the previous meaningful bits window
+			w.writeBit(false)
+			w.writeBits(xor>>uint(prevTrailing), 64-prevLeading-prevTrailing)
+			continue
+		}
+		w.writeBit(true)
+		sigbits := 64 - leading - trailing
+		w.writeBits(uint64(leading), 5)
+		// the sigbits is in [1, 64], and 64 is written as 0
+		w.writeBits(uint64(sigbits)&0x3f, 6)
+		w.writeBits(xor>>uint(trailing), sigbits)
+		prevLeading, prevTrailing = leading, trailing
+	}
+	return w.buf
+}
+
+// return the sample number in the chunk without decoding the samples
+func tsChunkCount(v []byte) (int64, error) {
+	if len(v) == 0 {
+		return 0, nil
+	}
+	cnt, n := binary.Uvarint(v)
+	if n <= 0 {
+		return 0, errTSChunkData
+	}
+	return int64(cnt), nil
+}
+
+func decodeTSChunk(v []byte) ([]TSSample, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	cnt, n := binary.Uvarint(v)
+	if n <= 0 || cnt > uint64(len(v))*8 {
+		return nil, errTSChunkData
+	}
+	if cnt == 0 {
+		return nil, nil
+	}
+	r := &tsBitReader{buf: v[n:]}
+	samples := make([]TSSample, 0, cnt)
+	ts, err := r.readBits(64)
+	if err != nil {
+		return nil, err
+	}
+	prevV, err := r.readBits(64)
+	if err != nil {
+		return nil, err
+	}
+	samples = append(samples, TSSample{Ts: int64(ts), Value: math.Float64frombits(prevV)})
+	prevTs := int64(ts)
+	prevDelta := int64(0)
+	prevLeading, prevTrailing := 0, 0
+	for i := uint64(1); i < cnt; i++ {
+		dod, err := tsReadDod(r)
+		if err != nil {
+			return nil, err
+		}
+		prevDelta += dod
+		prevTs += prevDelta
+
+		b, err := r.readBit()
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			b, err = r.readBit()
+			if err != nil {
+				return nil, err
+			}
+			if b {
+				leading, err := r.readBits(5)
+				if err != nil {
+					return nil, err
+				}
+				sigbits, err := r.readBits(6)
+				if err != nil {
+					return nil, err
+				}
+				if sigbits == 0 {
+					sigbits = 64
+				}
+				prevLeading = int(leading)
+				prevTrailing = 64 - prevLeading - int(sigbits)
+				if prevTrailing < 0 {
+					return nil, errTSChunkData
+				}
+			}
+			xor, err := r.readBits(64 - prevLeading - prevTrailing)
+			if err != nil {
+				return nil, err
+			}
+			prevV ^= xor << uint(prevTrailing)
+		}
+		samples = append(samples, TSSample{Ts: prevTs, Value: math.Float64frombits(prevV)})
+	}
+	return samples, nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+// COL.AGG ns:table FUNC field [FUNC field ...] [WHERE "field1 > 1 and field2 = xx"] [GROUP BY field]
+// the partial results from all the partitions are merged by the group value, and each row in the
+// reply is the group value (if group by) followed by the aggregation results.
+func (s *Server) doMergeColumnAgg(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) < 4 {
+		conn.WriteError(common.ErrInvalidArgs.Error())
+		return
+	}
+	_, result, err := s.dispatchAndWaitMergeCmd(cmd)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	var aggs []rockredis.ColumnAggregation
+	groupBy := false
+	groupIndex := make(map[string]int)
+	nullIndex := -1
+	groups := make([]rockredis.ColumnAggGroup, 0)
+	for _, res := range result {
+		if err, ok := res.(error); ok {
+			conn.WriteError(err.Error() + " : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+		realRes, ok := res.(*node.ColumnAggResults)
+		if !ok {
+			sLog.Infof("invalid response for column aggregate : %v, cmd: %v", res, string(cmd.Raw))
+			conn.WriteError(errInvalidResponse.Error())
+			return
+		}
+		aggs = realRes.Aggs
+		groupBy = realRes.GroupBy
+		for _, g := range realRes.Groups {
+			index := nullIndex
+			if g.Key != nil {
+				var ok bool
+				index, ok = groupIndex[string(g.Key)]
+				if !ok {
+					index = -1
+				}
+			}
+			if index < 0 {
+				index = len(groups)
+				groups = append(groups, rockredis.ColumnAggGroup{
+					Key:    g.Key,
+					Values: make([]rockredis.ColumnAggValue, len(g.Values)),
+				})
+				if g.Key == nil {
+					nullIndex = index
+				} else {
+					groupIndex[string(g.Key)] = index
+				}
+			}
+			for i := range g.Values {
+				groups[index].Values[i].Merge(g.Values[i])
+			}
+		}
+	}
+	rockredis.SortColumnAggGroups(groups)
+
+	conn.WriteArray(len(groups))
+	for _, g := range groups {
+		if groupBy {
+			conn.WriteArray(len(aggs) + 1)
+			if g.Key == nil {
+				conn.WriteNull()
+			} else {
+				conn.WriteBulk(g.Key)
+			}
+		} else {
+			conn.WriteArray(len(aggs))
+		}
+		for i, agg := range aggs {
+			if agg.Func == rockredis.ColumnAggCount {
+				conn.WriteInt64(g.Values[i].Count)
+				continue
+			}
+			v, ok := g.Values[i].Result(agg.Func)
+			if !ok {
+				conn.WriteNull()
+			} else {
+				conn.WriteBulkString(strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"github.com/youzan/ZanRedisDB/engine"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
 )
 
 type ServerConfig struct {
@@ -42,6 +43,8 @@ type ServerConfig struct {
 	WALRocksDBOpts engine.RockOptions    `json:"wal_rocksdb_opts"`
 	Namespaces     []NamespaceNodeConfig `json:"namespaces"`
 	MaxScanJob     int32                 `json:"max_scan_job"`
+	// the at-rest encryption for the data and the raft logs, disabled if no master key type
+	Encryption encryption.Config `json:"encryption"`
 }
 
 type NamespaceNodeConfig struct {
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+// merge the local full text stats of all the partitions, so the BM25 scores
+// from different partitions can be compared
+func (s *Server) mergeFullTextSearchStats(cmd redcon.Command) (*rockredis.FullTextSearchStats, error) {
+	statsCmd := buildCommand([][]byte{[]byte("ft.stats"), cmd.Args[1], cmd.Args[2]})
+	_, result, err := s.dispatchAndWaitMergeCmd(statsCmd)
+	if err != nil {
+		return nil, err
+	}
+	var stats rockredis.FullTextSearchStats
+	for _, res := range result {
+		if err, ok := res.(error); ok {
+			return nil, err
+		}
+		realRes, ok := res.(*rockredis.FullTextSearchStats)
+		if !ok {
+			sLog.Infof("invalid response for full text stats : %v, cmd: %v", res, string(cmd.Raw))
+			return nil, errInvalidResponse
+		}
+		stats.Merge(realRes)
+	}
+	return &stats, nil
+}
+
+// FT.SEARCH ns:table "query" [LIMIT offset num]
+// the reply is the total matched number followed by the key and score pairs.
+// The stats of all the partitions will be merged first, and then the search will
+// use the merged stats in each partition to get the global BM25 scores.
+func (s *Server) doMergeFullTextSearch(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) != 3 && len(cmd.Args) != 6 {
+		conn.WriteError(common.ErrInvalidArgs.Error())
+		return
+	}
+	origOffset := 0
+	origCount := 10
+	if len(cmd.Args) == 6 {
+		if !bytes.Equal(bytes.ToLower(cmd.Args[3]), []byte("limit")) {
+			conn.WriteError(common.ErrInvalidArgs.Error())
+			return
+		}
+		var err error
+		origOffset, err = strconv.Atoi(string(cmd.Args[4]))
+		if err != nil || origOffset < 0 {
+			conn.WriteError(common.ErrInvalidArgs.Error())
+			return
+		}
+		origCount, err = strconv.Atoi(string(cmd.Args[5]))
+		if err != nil {
+			conn.WriteError(common.ErrInvalidArgs.Error())
+			return
+		}
+		// each partition should return the top offset+num results, so we can
+		// get the right page after merged all the partitions
+		cmd.Args[4] = []byte("0")
+		if origCount >= 0 {
+			cmd.Args[5] = []byte(strconv.Itoa(origOffset + origCount))
+		}
+	}
+
+	stats, err := s.mergeFullTextSearchStats(cmd)
+	if err != nil {
+		conn.WriteError(err.Error() + " : Err handle command " + string(cmd.Args[0]))
+		return
+	}
+	statsData, err := json.Marshal(stats)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	searchArgs := append(cmd.Args[:len(cmd.Args):len(cmd.Args)], []byte("STATS"), statsData)
+	_, result, err := s.dispatchAndWaitMergeCmd(buildCommand(searchArgs))
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	var total int64
+	var table string
+	searchResults := make([]rockredis.FullTextSearchResult, 0)
+	for _, res := range result {
+		if err, ok := res.(error); ok {
+			conn.WriteError(err.Error() + " : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+		realRes, ok := res.(*node.FTSearchResults)
+		if !ok {
+			sLog.Infof("invalid response for full text search : %v, cmd: %v", res, string(cmd.Raw))
+			conn.WriteError(errInvalidResponse.Error())
+			return
+		}
+		table = realRes.Table
+		total += realRes.Total
+		searchResults = append(searchResults, realRes.Rets...)
+	}
+	rockredis.SortFullTextSearchResults(searchResults)
+	if origOffset >= len(searchResults) {
+		searchResults = searchResults[:0]
+	} else {
+		searchResults = searchResults[origOffset:]
+	}
+	if origCount >= 0 && origCount < len(searchResults) {
+		searchResults = searchResults[:origCount]
+	}
+
+	conn.WriteArray(len(searchResults)*2 + 1)
+	conn.WriteInt64(total)
+	for _, res := range searchResults {
+		if len(res.PKey) > len(table) && string(res.PKey[:len(table)]) == table {
+			conn.WriteBulk(res.PKey[len(table)+1:])
+		} else {
+			conn.WriteBulk(res.PKey)
+		}
+		conn.WriteBulkString(strconv.FormatFloat(res.Score, 'f', -1, 64))
+	}
+}
@@ -319,6 +319,59 @@ func (s *Server) getIndexes(w http.ResponseWriter, req *http.Request, ps httprou
 	return v.Node.GetIndexSchema(table)
 }
 
+func (s *Server) getIndexJobs(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		sLog.Infof("failed to get namespace node - %s", ns)
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	return v.Node.GetIndexJobs(), nil
+}
+
+// set the max keys scanned per second by the index build and verify jobs, and pause or resume the jobs
+func (s *Server) doSetIndexJobThrottle(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		sLog.Infof("failed to get namespace node - %s", ns)
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	rate, err := strconv.ParseInt(reqParams.Get("rate"), 10, 64)
+	if err != nil || rate < 0 {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "BAD_ARG_STRING"}
+	}
+	paused := reqParams.Get("pause") == "true"
+	v.Node.SetIndexJobThrottle(rate, paused)
+	return nil, nil
+}
+
+func (s *Server) doVerifyIndex(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
+	ns := ps.ByName("namespace")
+	v := s.GetNamespaceFromFullName(ns)
+	if v == nil || !v.IsReady() {
+		sLog.Infof("failed to get namespace node - %s", ns)
+		return nil, common.HttpErr{Code: http.StatusNotFound, Text: "no namespace found"}
+	}
+	reqParams, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: "INVALID_REQUEST"}
+	}
+	table := ps.ByName("table")
+	name := ps.ByName("indexname")
+	repair := reqParams.Get("repair") == "true"
+	err = v.Node.VerifyHsetIndex(table, name, repair)
+	if err != nil {
+		sLog.Infof("verify index %v-%v-%v failed: %v", ns, table, name, err)
+		return nil, common.HttpErr{Code: http.StatusBadRequest, Text: err.Error()}
+	}
+	return nil, nil
+}
+
 func (s *Server) checkNodeAllReady(w http.ResponseWriter, req *http.Request, ps httprouter.Params) (interface{}, error) {
 	ok := s.nsMgr.IsAllRecoveryDone()
 	if !ok {
@@ -875,6 +928,9 @@ func (s *Server) initHttpHandler() {
 	router.Handle("GET", common.APIGetMembers+"/:namespace", common.Decorate(s.getMembers, common.V1))
 	router.Handle("GET", common.APIGetIndexes+"/:namespace/:table", common.Decorate(s.getIndexes, common.V1))
 	router.Handle("GET", common.APIGetIndexes+"/:namespace", common.Decorate(s.getIndexes, common.V1))
+	router.Handle("GET", common.APIIndexJobs+"/:namespace", common.Decorate(s.getIndexJobs, common.V1))
+	router.Handle("POST", common.APIIndexBuildThrottle+"/:namespace", common.Decorate(s.doSetIndexJobThrottle, log, common.V1))
+	router.Handle("POST", common.APIIndexVerify+"/:namespace/:table/:indexname", common.Decorate(s.doVerifyIndex, log, common.V1))
 	router.Handle("GET", common.APICheckBackup+"/:namespace", common.Decorate(s.checkNodeBackup, log, common.V1))
 	router.Handle("GET", common.APIIsRaftSynced+"/:namespace", common.Decorate(s.isNsNodeFullReady, common.V1))
 	router.Handle("GET", "/kv/get/:namespace", common.Decorate(s.getKey, common.PlainText))
@@ -61,6 +61,14 @@ func (s *Server) doMergeCommand(conn redcon.Conn, cmd redcon.Command) {
 		}
 	} else if common.IsMergeIndexSearchCommand(cmdName) {
 		s.doMergeIndexSearch(conn, cmd)
+	} else if common.IsMergeTSRangeCommand(cmdName) {
+		s.doMergeTSRange(conn, cmd)
+	} else if common.IsMergeFullTextSearchCommand(cmdName) {
+		s.doMergeFullTextSearch(conn, cmd)
+	} else if common.IsMergeColumnAggCommand(cmdName) {
+		s.doMergeColumnAgg(conn, cmd)
+	} else if common.IsMergeSQLCommand(cmdName) {
+		s.doMergeSQL(conn, cmd)
 	} else if common.IsMergeKeysCommand(cmdName) {
 		// current we only handle the command which keys may across multi partitions and the
 		// response is all the same. So if the response order is need for keys, we can not handle
@@ -92,6 +100,13 @@ func (s *Server) getHandlersForKeys(cmdName string,
 			origKeys = append(origKeys, origArgs[i])
 			vals = append(vals, origArgs[i+1])
 		}
+	} else if cmdName == "json.mget" {
+		// for command which args is [key key ... path]
+		if len(origArgs) < 2 {
+			return nil, nil, hasWrite, common.ErrInvalidArgs
+		}
+		origKeys = origArgs[:len(origArgs)-1]
+		vals = origArgs[len(origArgs)-1:]
 	}
 	for kindex, arg := range origKeys {
 		ns, realKey, err := common.ExtractNamesapce(arg)
@@ -147,7 +162,12 @@ func (s *Server) getHandlersForKeys(cmdName string,
 	cmds := make([]redcon.Command, 0, len(handlerMap))
 	for name, handler := range handlerMap {
 		handlers = append(handlers, handler)
-		cmds = append(cmds, buildCommand(cmdArgMap[name]))
+		cmdArgs := cmdArgMap[name]
+		if cmdName == "json.mget" {
+			// the json path should be the last arg for each partition
+			cmdArgs = append(cmdArgs, vals[0])
+		}
+		cmds = append(cmds, buildCommand(cmdArgs))
 	}
 	return handlers, cmds, hasWrite, nil
 }
@@ -191,6 +211,32 @@ func (s *Server) doMergeKeysCommand(conn redcon.Conn, cmdName string, cmd redcon
 			}
 		}
 		return
+	case "json.mget":
+		// the keys are splitted to different partitions, so we need
+		// write the values in the same order as the original keys
+		valMap := make(map[string][]byte, len(cmd.Args)-2)
+		for i, ret := range results {
+			if err, ok := ret.(error); ok {
+				conn.WriteError(err.Error())
+				return
+			}
+			vals, ok := ret.([][]byte)
+			if !ok {
+				conn.WriteError(errInvalidResponse.Error())
+				return
+			}
+			keys := cmds[i].Args[1 : len(cmds[i].Args)-1]
+			for ki, k := range keys {
+				if ki < len(vals) {
+					valMap[string(k)] = vals[ki]
+				}
+			}
+		}
+		conn.WriteArray(len(cmd.Args) - 2)
+		for _, k := range cmd.Args[1 : len(cmd.Args)-1] {
+			conn.WriteBulk(valMap[string(k)])
+		}
+		return
 	default:
 		sLog.Infof("merge command error:%v", cmdName)
 		conn.WriteError(errInvalidCommand.Error())
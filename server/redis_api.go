@@ -34,6 +34,7 @@ func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
 		return
 	}
 	cmdName := qcmdlower(cmd.Args[0])
+	cmdName, cmd = foldSubCommand(cmdName, cmd)
 	switch cmdName {
 	case "detach":
 		hconn := conn.Detach()
@@ -65,7 +66,7 @@ func (s *Server) serverRedis(conn redcon.Conn, cmd redcon.Command) {
 				start = time.Now()
 			}
 			cmdStr := string(cmd.Args[0])
-			ns, pk, pkSum, err := GetPKAndHashSum(cmdName, cmd)
+			ns, pk, pkSum, err := s.GetPKAndHashSum(cmdName, cmd)
 			if err != nil {
 				conn.WriteError(err.Error() + " : ERR handle command " + cmdStr)
 				break
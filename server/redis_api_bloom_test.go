@@ -0,0 +1,136 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/siddontang/goredis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilter(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test:bf_test"
+	ok, err := goredis.String(c.Do("bf.reserve", key, "0.01", 100, "EXPANSION", 2))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("bf.reserve", key, "0.01", 100)
+	assert.NotNil(t, err)
+	_, err = c.Do("bf.reserve", "default:test:bf_test_invalid", "1.1", 100)
+	assert.NotNil(t, err)
+	_, err = c.Do("bf.reserve", "default:test:bf_test_invalid", "0.01", 100, "UNKNOWN")
+	assert.NotNil(t, err)
+
+	n, err := goredis.Int(c.Do("bf.add", key, "item1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("bf.add", key, "item1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	vlist, err := goredis.MultiBulk(c.Do("bf.madd", key, "item1", "item2", "item3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(0), int64(1), int64(1)}, vlist)
+	// add more items to make the filter grow
+	for i := 0; i < 300; i++ {
+		_, err = c.Do("bf.add", key, fmt.Sprintf("item-%d", i))
+		assert.Nil(t, err)
+	}
+
+	n, err = goredis.Int(c.Do("bf.exists", key, "item2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("bf.exists", key, "not_exist_item"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	vlist, err = goredis.MultiBulk(c.Do("bf.mexists", key, "item1", "item-299", "not_exist_item"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(1), int64(0)}, vlist)
+
+	vlist, err = goredis.MultiBulk(c.Do("bf.info", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(vlist))
+	assert.Equal(t, "Number of filters", string(vlist[4].([]byte)))
+	assert.True(t, vlist[5].(int64) > 1)
+	assert.Equal(t, "Expansion rate", string(vlist[8].([]byte)))
+	assert.Equal(t, int64(2), vlist[9])
+	_, err = c.Do("bf.info", "default:test:bf_test_not_exist")
+	assert.NotNil(t, err)
+
+	n, err = goredis.Int(c.Do("bf.expire", key, 100))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	ttl, err := goredis.Int(c.Do("bf.ttl", key))
+	assert.Nil(t, err)
+	assertTTLNear(t, 100, ttl)
+	n, err = goredis.Int(c.Do("bf.persist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	ttl, err = goredis.Int(c.Do("bf.ttl", key))
+	assert.Nil(t, err)
+	assert.Equal(t, -1, ttl)
+
+	n, err = goredis.Int(c.Do("bf.clear", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("bf.keyexist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestCuckooFilter(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test:cf_test"
+	ok, err := goredis.String(c.Do("cf.reserve", key, 100))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("cf.reserve", key, 100)
+	assert.NotNil(t, err)
+
+	for i := 0; i < 2; i++ {
+		n, err := goredis.Int(c.Do("cf.add", key, "item1"))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+	}
+	n, err := goredis.Int(c.Do("cf.count", key, "item1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = goredis.Int(c.Do("cf.exists", key, "item1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("cf.exists", key, "not_exist_item"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = goredis.Int(c.Do("cf.del", key, "item1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("cf.del", key, "not_exist_item"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	n, err = goredis.Int(c.Do("cf.count", key, "item1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, err = c.Do("cf.del", "default:test:cf_test_not_exist", "item1")
+	assert.NotNil(t, err)
+
+	n, err = goredis.Int(c.Do("cf.expire", key, 100))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	ttl, err := goredis.Int(c.Do("cf.ttl", key))
+	assert.Nil(t, err)
+	assertTTLNear(t, 100, ttl)
+	n, err = goredis.Int(c.Do("cf.persist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = goredis.Int(c.Do("cf.clear", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("cf.keyexist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
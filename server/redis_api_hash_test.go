@@ -436,6 +436,64 @@ func TestHashExpire(t *testing.T) {
 	assert.Equal(t, -1, realTtl)
 }
 
+func TestHashFieldExpire(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key1 := "default:test:hash_field_exp"
+	_, err := c.Do("hmset", key1, "f1", "v1", "f2", "v2", "f3", "v3")
+	assert.Nil(t, err)
+
+	vlist, err := goredis.MultiBulk(c.Do("hexpire", key1, 100, "FIELDS", 2, "f1", "f_not_exist"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(-2)}, vlist)
+	vlist, err = goredis.MultiBulk(c.Do("hpexpire", key1, 200000, "FIELDS", 2, "f2", "f3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(1)}, vlist)
+
+	vlist, err = goredis.MultiBulk(c.Do("httl", key1, "FIELDS", 3, "f1", "f2", "f_not_exist"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(vlist))
+	assertTTLNear(t, 100, int(vlist[0].(int64)))
+	assertTTLNear(t, 200, int(vlist[1].(int64)))
+	assert.Equal(t, int64(-2), vlist[2])
+	vlist, err = goredis.MultiBulk(c.Do("hpttl", key1, "FIELDS", 1, "f2"))
+	assert.Nil(t, err)
+	assert.True(t, vlist[0].(int64) > 190000)
+
+	// the ttl of whole key is not changed
+	realTtl, err := goredis.Int(c.Do("httl", key1))
+	assert.Nil(t, err)
+	assert.Equal(t, -1, realTtl)
+
+	vlist, err = goredis.MultiBulk(c.Do("hpersist", key1, "FIELDS", 1, "f1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1)}, vlist)
+	// overwrite the field will remove the ttl
+	_, err = c.Do("hset", key1, "f2", "v2_new")
+	assert.Nil(t, err)
+	vlist, err = goredis.MultiBulk(c.Do("httl", key1, "FIELDS", 3, "f1", "f2", "f3"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), vlist[0])
+	assert.Equal(t, int64(-1), vlist[1])
+	assert.True(t, vlist[2].(int64) > 0)
+
+	// expire with 0 will delete the field
+	vlist, err = goredis.MultiBulk(c.Do("hpexpire", key1, 0, "FIELDS", 1, "f3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(2)}, vlist)
+	n, err := goredis.Int(c.Do("hlen", key1))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = c.Do("hpexpire", key1, 100, "FIELDS", 2, "f1")
+	assert.NotNil(t, err)
+	_, err = c.Do("hpexpire", key1, 100, "f1")
+	assert.NotNil(t, err)
+	_, err = c.Do("httl", key1, "FIELDS", 0)
+	assert.NotNil(t, err)
+}
+
 func TestHashErrorParams(t *testing.T) {
 	c := getTestConn(t)
 	defer c.Close()
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/siddontang/goredis"
@@ -293,6 +294,96 @@ func TestJSONArrayOp(t *testing.T) {
 	assert.Equal(t, "", poped)
 }
 
+func TestJSONNumStrArrayOp(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test:json_num_str_op"
+	_, err := c.Do("json.set", key, "", `{"n":1,"s":"ab","arr":[1,2,3],"b":true,"o":{"x":1,"y":2}}`)
+	assert.Nil(t, err)
+
+	v, err := goredis.String(c.Do("json.numincrby", key, "n", "2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "3", v)
+	v, err = goredis.String(c.Do("json.nummultby", key, "$.n", "1.5"))
+	assert.Nil(t, err)
+	assert.Equal(t, "4.5", v)
+	_, err = c.Do("json.numincrby", key, "s", "1")
+	assert.NotNil(t, err)
+
+	n, err := goredis.Int(c.Do("json.strappend", key, "s", `"cd"`))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	n, err = goredis.Int(c.Do("json.strlen", key, "$.s"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+
+	n, err = goredis.Int(c.Do("json.arrinsert", key, "arr", "1", "5", "6"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	n, err = goredis.Int(c.Do("json.arrindex", key, "arr", "6"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = goredis.Int(c.Do("json.arrindex", key, "arr", "7"))
+	assert.Nil(t, err)
+	assert.Equal(t, -1, n)
+	n, err = goredis.Int(c.Do("json.arrtrim", key, "arr", "1", "2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	strRets, err := goredis.Strings(c.Do("json.get", key, "arr"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"[5,6]"}, strRets)
+
+	v, err = goredis.String(c.Do("json.toggle", key, "b"))
+	assert.Nil(t, err)
+	assert.Equal(t, "false", v)
+
+	_, err = c.Do("json.merge", key, "$.o", `{"x":null,"y":3,"z":4}`)
+	assert.Nil(t, err)
+	strRets, err = goredis.Strings(c.Do("json.get", key, "$.o"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`[{"y":3,"z":4}]`}, strRets)
+
+	n, err = goredis.Int(c.Do("json.clear", key, "arr"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("json.arrlen", key, "arr"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestJSONMGet(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	keys := make([]interface{}, 0, 10)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("default:test:json_mget_%v", i)
+		keys = append(keys, key)
+		if i%3 == 0 {
+			continue
+		}
+		_, err := c.Do("json.set", key, "", fmt.Sprintf(`{"a":%v}`, i))
+		assert.Nil(t, err)
+	}
+	args := append(keys, "a")
+	rets, err := goredis.MultiBulk(c.Do("json.mget", args...))
+	assert.Nil(t, err)
+	assert.Equal(t, len(keys), len(rets))
+	for i, r := range rets {
+		if i%3 == 0 {
+			assert.Nil(t, r)
+		} else {
+			assert.Equal(t, fmt.Sprintf("%v", i), string(r.([]byte)))
+		}
+	}
+	args = append(keys, "$.a")
+	rets, err = goredis.MultiBulk(c.Do("json.mget", args...))
+	assert.Nil(t, err)
+	assert.Equal(t, len(keys), len(rets))
+	assert.Equal(t, "[1]", string(rets[1].([]byte)))
+}
+
 func TestJSONErrorParams(t *testing.T) {
 	c := getTestConn(t)
 	defer c.Close()
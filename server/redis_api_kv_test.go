@@ -1229,3 +1229,39 @@ func TestSlowLimiterCommand(t *testing.T) {
 	assert.Equal(t, int64(601), atomic.LoadInt64(&node.SlowRefuseCostMs))
 	assert.Equal(t, int64(18), atomic.LoadInt64(&node.SlowHalfOpenSec))
 }
+
+func TestKVMemoryAndObject(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test:kv_memory_object"
+	v, err := c.Do("memory", "usage", key)
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	_, err = c.Do("set", key, "12345")
+	assert.Nil(t, err)
+	_, err = c.Do("hset", key, "f1", "v1")
+	assert.Nil(t, err)
+
+	n, err := goredis.Int64(c.Do("memory", "usage", key))
+	assert.Nil(t, err)
+	assert.True(t, n > int64(len("12345")))
+	rets, err := goredis.Values(c.Do("memory", "usage", key, "type", "hash", "withcount"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rets))
+	assert.Equal(t, int64(1), rets[1])
+
+	enc, err := goredis.String(c.Do("object", "encoding", key))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(enc, "raw"), enc)
+	enc, err = goredis.String(c.Do("object", "encoding", key, "type", "hash"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(enc, "hashtable"), enc)
+	idle, err := goredis.Int64(c.Do("object", "idletime", key))
+	assert.Nil(t, err)
+	assert.True(t, idle >= 0)
+
+	_, err = c.Do("object", "encoding", key, "type", "unknown")
+	assert.NotNil(t, err)
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -585,6 +587,37 @@ func TestIntHindexMergeSearch(t *testing.T) {
 		assert.True(t, nv > 1)
 		assert.True(t, nv < 10)
 	}
+
+	ay, err = goredis.Values(c.Do("hidx.from", ns+":"+table, "where", "\"test_f>1\"", "order", "by", "test_f", "desc", "limit", "2", "3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("17"), int64(17), []byte("16"), int64(16), []byte("15"), int64(15)}, ay)
+
+	// page through all the results by the cursor
+	cursor := common.IndexSearchCursorStart
+	var ordered []int64
+	for {
+		ay, err = goredis.Values(c.Do("hidx.from", ns+":"+table, "where", "\"test_f>1\"", "order", "by", "test_f",
+			"limit", "0", "5", "cursor", cursor))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(ay))
+		cursor = string(ay[0].([]byte))
+		rets, _ := goredis.Values(ay[1], nil)
+		for i := 1; i < len(rets); i = i + 2 {
+			ordered = append(ordered, rets[i].(int64))
+		}
+		if cursor == common.IndexSearchCursorStart {
+			break
+		}
+	}
+	assert.Equal(t, 18, len(ordered))
+	for i, v := range ordered {
+		assert.Equal(t, int64(i+2), v)
+	}
+
+	ay, err = goredis.Values(c.Do("hidx.from", ns+":"+table, "where", "\"test_f>1 and test_f<10\"",
+		"agg", "count", "*", "sum", "test_f2", "min", "test_f", "max", "test_f"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(8), []byte("204"), []byte("2"), []byte("9")}, ay)
 }
 
 func TestKVRWMultiPart(t *testing.T) {
@@ -607,3 +640,282 @@ func TestKVRWMultiPart(t *testing.T) {
 		}
 	}
 }
+
+func TestTSMergeMRange(t *testing.T) {
+	c := getMergeTestConn(t)
+	defer c.Close()
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("default:test_ts:mrange_%v", i)
+		tp := "cpu"
+		if i%2 == 0 {
+			tp = "mem"
+		}
+		_, err := c.Do("ts.add", key, i, i, "LABELS", "type", tp, "index", i)
+		assert.Nil(t, err)
+		_, err = c.Do("ts.add", key, i+100, i+100)
+		assert.Nil(t, err)
+	}
+	rets, err := goredis.MultiBulk(c.Do("ts.mrange", "default:test_ts", "-", "+", "FILTER", "type=cpu"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(rets))
+	for i, r := range rets {
+		series := r.([]interface{})
+		assert.Equal(t, fmt.Sprintf("default:test_ts:mrange_%v", i*2+1), string(series[0].([]byte)))
+		assert.Equal(t, 0, len(series[1].([]interface{})))
+		assert.Equal(t, 2, len(series[2].([]interface{})))
+	}
+	rets, err = goredis.MultiBulk(c.Do("ts.mrevrange", "default:test_ts", 0, 50, "COUNT", 1, "WITHLABELS",
+		"FILTER", "type=mem", "index!=0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(rets))
+	series := rets[0].([]interface{})
+	assert.Equal(t, "default:test_ts:mrange_2", string(series[0].([]byte)))
+	assert.Equal(t, []interface{}{[]interface{}{[]byte("type"), []byte("mem")}, []interface{}{[]byte("index"), []byte("2")}},
+		series[1])
+	assert.Equal(t, []interface{}{[]interface{}{int64(2), []byte("2")}}, series[2])
+	_, err = c.Do("ts.mrange", "default:test_ts", "-", "+", "FILTER")
+	assert.NotNil(t, err)
+}
+
+func TestFullTextMergeSearch(t *testing.T) {
+	c := getMergeTestConn(t)
+	defer c.Close()
+
+	ns := "default"
+	table := "test_fulltext"
+	sc := &node.SchemaChange{
+		Type:       node.SchemaChangeAddFullTextIndex,
+		Table:      table,
+		SchemaData: nil,
+	}
+	ftindex := &common.FullTextIndexSchema{
+		Name:       "fulltext_test",
+		HashFields: []string{"title", "body"},
+		State:      common.InitIndex,
+	}
+	sc.SchemaData, _ = json.Marshal(ftindex)
+	for _, nsNode := range testNamespaces {
+		nsNode.Node.ProposeChangeTableSchema(table, sc)
+	}
+	time.Sleep(time.Second)
+
+	sc.Type = node.SchemaChangeUpdateFullTextIndex
+	ftindex.State = common.BuildingIndex
+	sc.SchemaData, _ = json.Marshal(ftindex)
+	for _, nsNode := range testNamespaces {
+		nsNode.Node.ProposeChangeTableSchema(table, sc)
+	}
+	time.Sleep(time.Second)
+
+	ftindex.State = common.ReadyIndex
+	sc.SchemaData, _ = json.Marshal(ftindex)
+	for _, nsNode := range testNamespaces {
+		nsNode.Node.ProposeChangeTableSchema(table, sc)
+	}
+	time.Sleep(time.Second)
+
+	for i := 0; i < 20; i++ {
+		title := fmt.Sprintf("title %d", i)
+		if i%2 == 0 {
+			title = "hello " + title
+		}
+		_, err := c.Do("hmset", ns+":"+table+":"+fmt.Sprintf("%d", i), "title", title,
+			"body", strings.Repeat("word ", i+1))
+		assert.Nil(t, err)
+	}
+
+	ay, err := goredis.Values(c.Do("ft.search", ns+":"+table, "hello"))
+	assert.Nil(t, err)
+	// total, and 10 key score pairs by default
+	assert.Equal(t, 1+10*2, len(ay))
+	assert.Equal(t, int64(10), ay[0].(int64))
+
+	ay, err = goredis.Values(c.Do("ft.search", ns+":"+table, "\"hello word\"", "LIMIT", 0, 20))
+	assert.Nil(t, err)
+	assert.Equal(t, 1+10*2, len(ay))
+	assert.Equal(t, int64(10), ay[0].(int64))
+	lastScore := math.MaxFloat64
+	for i := 1; i < len(ay); i += 2 {
+		k, _ := strconv.Atoi(string(ay[i].([]byte)))
+		assert.Equal(t, 0, k%2)
+		score, err := strconv.ParseFloat(string(ay[i+1].([]byte)), 64)
+		assert.Nil(t, err)
+		assert.True(t, score <= lastScore)
+		lastScore = score
+	}
+
+	ay, err = goredis.Values(c.Do("ft.search", ns+":"+table, "title", "LIMIT", 15, 10))
+	assert.Nil(t, err)
+	assert.Equal(t, 1+5*2, len(ay))
+	assert.Equal(t, int64(20), ay[0].(int64))
+
+	ay, err = goredis.Values(c.Do("ft.search", ns+":"+table, "notexist"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(0)}, ay)
+	_, err = c.Do("ft.search", ns+":"+table, "hello", "LIMIT", 0)
+	assert.NotNil(t, err)
+}
+
+func TestColumnAggMerge(t *testing.T) {
+	c := getMergeTestConn(t)
+	defer c.Close()
+
+	ns := "default"
+	table := "test_column_agg"
+	sc := &node.SchemaChange{
+		Type:       node.SchemaChangeAddColumnTable,
+		Table:      table,
+		SchemaData: nil,
+	}
+	ct := &common.ColumnTableSchema{
+		Name:    "column_test",
+		Columns: []string{"city", "age"},
+		State:   common.InitIndex,
+	}
+	sc.SchemaData, _ = json.Marshal(ct)
+	for _, nsNode := range testNamespaces {
+		nsNode.Node.ProposeChangeTableSchema(table, sc)
+	}
+	time.Sleep(time.Second)
+
+	sc.Type = node.SchemaChangeUpdateColumnTable
+	ct.State = common.BuildingIndex
+	sc.SchemaData, _ = json.Marshal(ct)
+	for _, nsNode := range testNamespaces {
+		nsNode.Node.ProposeChangeTableSchema(table, sc)
+	}
+	time.Sleep(time.Second)
+
+	ct.State = common.ReadyIndex
+	sc.SchemaData, _ = json.Marshal(ct)
+	for _, nsNode := range testNamespaces {
+		nsNode.Node.ProposeChangeTableSchema(table, sc)
+	}
+	time.Sleep(time.Second)
+
+	for i := 0; i < 20; i++ {
+		city := "hz"
+		if i%2 == 0 {
+			city = "sh"
+		}
+		_, err := c.Do("hmset", ns+":"+table+":"+fmt.Sprintf("%d", i), "city", city, "age", i)
+		assert.Nil(t, err)
+	}
+	_, err := c.Do("hset", ns+":"+table+":nocity", "age", 100)
+	assert.Nil(t, err)
+
+	ay, err := goredis.Values(c.Do("col.agg", ns+":"+table, "COUNT", "*", "SUM", "age", "MAX", "age"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ay))
+	row, _ := goredis.Values(ay[0], nil)
+	assert.Equal(t, []interface{}{int64(21), []byte("290"), []byte("100")}, row)
+
+	ay, err = goredis.Values(c.Do("col.agg", ns+":"+table, "COUNT", "*", "AVG", "age",
+		"WHERE", "\"age < 10\"", "GROUP", "BY", "city"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ay))
+	row, _ = goredis.Values(ay[0], nil)
+	assert.Equal(t, []interface{}{[]byte("hz"), int64(5), []byte("5")}, row)
+	row, _ = goredis.Values(ay[1], nil)
+	assert.Equal(t, []interface{}{[]byte("sh"), int64(5), []byte("4")}, row)
+
+	ay, err = goredis.Values(c.Do("col.agg", ns+":"+table, "COUNT", "city", "MIN", "age", "GROUP", "BY", "city"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(ay))
+	row, _ = goredis.Values(ay[0], nil)
+	assert.Equal(t, []interface{}{nil, int64(0), []byte("100")}, row)
+
+	ay, err = goredis.Values(c.Do("col.agg", ns+":"+table, "MIN", "age", "WHERE", "\"city = bj\""))
+	assert.Nil(t, err)
+	row, _ = goredis.Values(ay[0], nil)
+	assert.Equal(t, []interface{}{nil}, row)
+
+	_, err = c.Do("col.agg", ns+":"+table, "SUM", "*")
+	assert.NotNil(t, err)
+	_, err = c.Do("col.agg", ns+":"+table, "SUM", "notexist")
+	assert.NotNil(t, err)
+	_, err = c.Do("col.agg", ns+":"+table, "COUNT", "*", "WHERE", "\"age\"")
+	assert.NotNil(t, err)
+}
+
+func TestSQLMergeQuery(t *testing.T) {
+	c := getMergeTestConn(t)
+	defer c.Close()
+
+	ns := "default"
+	table := "test_sql"
+	sc := &node.SchemaChange{
+		Type:       node.SchemaChangeAddHsetIndex,
+		Table:      table,
+		SchemaData: nil,
+	}
+	hindex := &common.HsetIndexSchema{
+		Name:       "sql_index_test",
+		IndexField: "age",
+		ValueType:  common.Int64V,
+		State:      common.InitIndex,
+	}
+	sc.SchemaData, _ = json.Marshal(hindex)
+	for _, nsNode := range testNamespaces {
+		nsNode.Node.ProposeChangeTableSchema(table, sc)
+	}
+	time.Sleep(time.Second)
+
+	sc.Type = node.SchemaChangeUpdateHsetIndex
+	for _, state := range []common.IndexState{common.BuildingIndex, common.ReadyIndex} {
+		hindex.State = state
+		sc.SchemaData, _ = json.Marshal(hindex)
+		for _, nsNode := range testNamespaces {
+			nsNode.Node.ProposeChangeTableSchema(table, sc)
+		}
+		time.Sleep(time.Second)
+	}
+
+	for i := 0; i < 20; i++ {
+		city := "hz"
+		if i%2 == 0 {
+			city = "sh"
+		}
+		_, err := c.Do("hmset", ns+":"+table+":"+fmt.Sprintf("%d", i), "city", city, "age", i)
+		assert.Nil(t, err)
+	}
+
+	getRows := func(query string) [][]string {
+		ay, err := goredis.Values(c.Do("sql", query))
+		assert.Nil(t, err, query)
+		rows := make([][]string, 0, len(ay))
+		for _, r := range ay {
+			row, err := goredis.Strings(r, nil)
+			assert.Nil(t, err)
+			rows = append(rows, row)
+		}
+		return rows
+	}
+	// ordered by the index on age
+	rows := getRows("SELECT city FROM default.test_sql WHERE age >= 10 ORDER BY age DESC LIMIT 2, 3")
+	assert.Equal(t, [][]string{{"17", "hz"}, {"16", "sh"}, {"15", "hz"}}, rows)
+
+	// the where clause searched by index and ordered by the field without index
+	rows = getRows("select age, city from default.test_sql where age < 4 order by city limit 3")
+	assert.Equal(t, [][]string{{"1", "1", "hz"}, {"3", "3", "hz"}, {"0", "0", "sh"}}, rows)
+
+	// searched by the index on age and filtered by city
+	rows = getRows("select * from default.test_sql where city = 'hz' and age > 15")
+	assert.Equal(t, 2, len(rows))
+	for _, row := range rows {
+		assert.Equal(t, 5, len(row))
+		assert.Equal(t, "city", row[1])
+		assert.Equal(t, "hz", row[2])
+	}
+	// full scan with the condition on the field without index
+	rows = getRows("select age from default.test_sql where city = 'sh' or age = 1")
+	assert.Equal(t, 11, len(rows))
+	rows = getRows("select age from default.test_sql limit 5")
+	assert.Equal(t, 5, len(rows))
+
+	_, err := c.Do("sql", "delete from default.test_sql")
+	assert.NotNil(t, err)
+	_, err = c.Do("sql", "select age from notexist.test_sql")
+	assert.NotNil(t, err)
+}
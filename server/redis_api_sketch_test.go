@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/siddontang/goredis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountMinSketch(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test:cms_test"
+	key2 := "default:test:cms_test2"
+	ok, err := goredis.String(c.Do("cms.initbydim", key, 1000, 5))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("cms.initbydim", key, 1000, 5)
+	assert.NotNil(t, err)
+	ok, err = goredis.String(c.Do("cms.initbyprob", key2, "0.002", "0.01"))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("cms.initbyprob", "default:test:cms_test_invalid", "0", "0.01")
+	assert.NotNil(t, err)
+
+	vlist, err := goredis.MultiBulk(c.Do("cms.incrby", key, "a", 1, "b", 2))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, vlist)
+	for i := 0; i < 100; i++ {
+		_, err = c.Do("cms.incrby", key, "a", 1, fmt.Sprintf("item-%d", i), 1)
+		assert.Nil(t, err)
+	}
+	_, err = c.Do("cms.incrby", key, "a", -1)
+	assert.NotNil(t, err)
+	_, err = c.Do("cms.incrby", key, "a", 1, "b")
+	assert.NotNil(t, err)
+	vlist, err = goredis.MultiBulk(c.Do("cms.query", key, "a", "b", "not_exist_item"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(101), int64(2), int64(0)}, vlist)
+	vlist, err = goredis.MultiBulk(c.Do("cms.info", key))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("width"), int64(1000), []byte("depth"), int64(5),
+		[]byte("count"), int64(203)}, vlist)
+	_, err = c.Do("cms.query", "default:test:cms_test_not_exist", "a")
+	assert.NotNil(t, err)
+
+	dest := "default:test:cms_test_dest"
+	_, err = c.Do("cms.initbydim", dest, 1000, 5)
+	assert.Nil(t, err)
+	ok, err = goredis.String(c.Do("cms.merge", dest, 1, key, "WEIGHTS", 3))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	vlist, err = goredis.MultiBulk(c.Do("cms.query", dest, "a", "b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(303), int64(6)}, vlist)
+	// width mismatch
+	_, err = c.Do("cms.merge", dest, 2, key, key2)
+	assert.NotNil(t, err)
+	_, err = c.Do("cms.merge", dest, 2, key)
+	assert.NotNil(t, err)
+
+	n, err := goredis.Int(c.Do("cms.expire", key, 100))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	ttl, err := goredis.Int(c.Do("cms.ttl", key))
+	assert.Nil(t, err)
+	assertTTLNear(t, 100, ttl)
+	n, err = goredis.Int(c.Do("cms.persist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("cms.clear", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("cms.keyexist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestTopK(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test:topk_test"
+	ok, err := goredis.String(c.Do("topk.reserve", key, 2))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("topk.reserve", key, 2)
+	assert.NotNil(t, err)
+	_, err = c.Do("topk.reserve", "default:test:topk_test_invalid", 2, 10, 5)
+	assert.NotNil(t, err)
+	_, err = c.Do("topk.add", "default:test:topk_test_not_exist", "a")
+	assert.NotNil(t, err)
+
+	vlist, err := goredis.MultiBulk(c.Do("topk.add", key, "a", "b", "a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{nil, nil, nil}, vlist)
+	vlist, err = goredis.MultiBulk(c.Do("topk.add", key, "c", "c", "c"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("b"), nil, nil}, vlist)
+
+	vlist, err = goredis.MultiBulk(c.Do("topk.query", key, "a", "b", "c"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(0), int64(1)}, vlist)
+	vlist, err = goredis.MultiBulk(c.Do("topk.list", key))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("c"), []byte("a")}, vlist)
+	vlist, err = goredis.MultiBulk(c.Do("topk.list", key, "WITHCOUNT"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]byte("c"), int64(3), []byte("a"), int64(2)}, vlist)
+
+	n, err := goredis.Int(c.Do("topk.expire", key, 100))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	ttl, err := goredis.Int(c.Do("topk.ttl", key))
+	assert.Nil(t, err)
+	assertTTLNear(t, 100, ttl)
+	n, err = goredis.Int(c.Do("topk.clear", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("topk.keyexist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/siddontang/goredis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeSeries(t *testing.T) {
+	c := getTestConn(t)
+	defer c.Close()
+
+	key := "default:test:ts_test"
+	dest := "default:test:ts_test_dest"
+	ok, err := goredis.String(c.Do("ts.create", key, "RETENTION", 0, "CHUNK_DURATION", 1000, "LABELS", "type", "cpu"))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("ts.create", key)
+	assert.NotNil(t, err)
+	_, err = c.Do("ts.create", "default:test:ts_test_invalid", "LABELS", "type")
+	assert.NotNil(t, err)
+	ok, err = goredis.String(c.Do("ts.create", dest))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	ok, err = goredis.String(c.Do("ts.createrule", key, dest, "AGGREGATION", "sum", 10))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("ts.createrule", key, dest, "AGGREGATION", "unknown", 10)
+	assert.NotNil(t, err)
+
+	for i := 0; i < 20; i++ {
+		n, err := goredis.Int64(c.Do("ts.add", key, i, i))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(i), n)
+	}
+	_, err = c.Do("ts.add", key, "invalid", 1)
+	assert.NotNil(t, err)
+	vlist, err := goredis.MultiBulk(c.Do("ts.madd", key, 20, "20.5", key, 21, 21))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(20), int64(21)}, vlist)
+	_, err = c.Do("ts.madd", key, 22, 22, "default:test:ts_test_not_exist", 1, 1)
+	assert.NotNil(t, err)
+
+	vlist, err = goredis.MultiBulk(c.Do("ts.get", key))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(21), []byte("21")}, vlist)
+	vlist, err = goredis.MultiBulk(c.Do("ts.range", key, "-", "+", "COUNT", 2))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{int64(0), []byte("0")}, []interface{}{int64(1), []byte("1")}}, vlist)
+	vlist, err = goredis.MultiBulk(c.Do("ts.revrange", key, 0, 20, "COUNT", 1))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{int64(20), []byte("20.5")}}, vlist)
+	vlist, err = goredis.MultiBulk(c.Do("ts.range", key, 0, 19, "AGGREGATION", "avg", 10))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{int64(0), []byte("4.5")}, []interface{}{int64(10), []byte("14.5")}}, vlist)
+	// the compaction rule
+	vlist, err = goredis.MultiBulk(c.Do("ts.range", dest, "-", "+"))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{int64(0), []byte("45")}, []interface{}{int64(10), []byte("145")}}, vlist)
+
+	vlist, err = goredis.MultiBulk(c.Do("ts.info", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 16, len(vlist))
+	assert.Equal(t, int64(22), vlist[1])
+	assert.Equal(t, int64(0), vlist[3])
+	assert.Equal(t, int64(21), vlist[5])
+	assert.Equal(t, int64(1000), vlist[9])
+	assert.Equal(t, []interface{}{[]interface{}{[]byte("type"), []byte("cpu")}}, vlist[11])
+	assert.Nil(t, vlist[13])
+	assert.Equal(t, []interface{}{[]interface{}{[]byte(dest), int64(10), []byte("sum")}}, vlist[15])
+	vlist, err = goredis.MultiBulk(c.Do("ts.info", dest))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(key), vlist[13])
+
+	ok, err = goredis.String(c.Do("ts.deleterule", key, dest))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", ok)
+	_, err = c.Do("ts.deleterule", key, dest)
+	assert.NotNil(t, err)
+
+	n, err := goredis.Int(c.Do("ts.expire", key, 100))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	ttl, err := goredis.Int(c.Do("ts.ttl", key))
+	assert.Nil(t, err)
+	assertTTLNear(t, 100, ttl)
+	n, err = goredis.Int(c.Do("ts.persist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("ts.clear", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = goredis.Int(c.Do("ts.keyexist", key))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = c.Do("ts.get", key)
+	assert.NotNil(t, err)
+}
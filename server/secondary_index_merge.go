@@ -6,41 +6,53 @@ import (
 
 	"github.com/youzan/ZanRedisDB/common"
 	"github.com/youzan/ZanRedisDB/node"
+	"github.com/youzan/ZanRedisDB/rockredis"
 	"github.com/absolute8511/redcon"
 )
 
 func isValidPostSearchCmd(cmd string) bool {
-	return cmd == "hget" || cmd == "hmget" || cmd == "hgetall"
+	return cmd == "hget" || cmd == "hmget" || cmd == "hgetall" || cmd == "json.get"
 }
 
-// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [LIMIT offset num] [HGET $ field2]
+// HIDX.FROM ns:table where "field1 > 1 and field1 < 2" [ORDER BY field1 [ASC|DESC]] [LIMIT offset num]
+// [CURSOR cursor] [HGET $ field2]
+// JIDX.FROM ns:table where "path1 > 1 and path1 < 2" [LIMIT offset num] [JSON.GET $ path2]
+// HIDX.FROM ns:table where "field1 > 1" AGG COUNT * SUM field2
+// With ORDER BY, the sorted results from all the partitions are merged in order, and if CURSOR is given
+// the reply is the next cursor followed by the results, the cursor "0" is returned if no more results.
+// The aggregations are computed in each partition and merged here.
 func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
-	var postCmd string
-	if len(cmd.Args) >= 5 {
-		postCmd = string(cmd.Args[4])
-		if !isValidPostSearchCmd(postCmd) {
-			conn.WriteError(common.ErrInvalidArgs.Error())
-			return
-		}
-	}
-
 	sLog.Debugf("secondary index query cmd: %v, %v", string(cmd.Raw), len(cmd.Args))
 	if len(cmd.Args) < 4 {
 		conn.WriteError(common.ErrInvalidArgs.Error())
 		return
 	}
-	args := cmd.Args[4:]
-	origOffset := 0
-	if len(args) >= 3 && bytes.Equal(bytes.ToLower(args[0]), []byte("limit")) {
-		offset, err := strconv.Atoi(string(args[1]))
-		if err != nil {
+	opts, err := common.ParseIndexSearchOptions(cmd.Args[4:])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	if opts.AggArgs != nil {
+		s.doMergeIndexAgg(conn, cmd)
+		return
+	}
+	if opts.LimitArgIndex >= 0 && opts.Offset > 0 {
+		// the offset should be applied after merged, so each partition should
+		// return the results from the beginning.
+		limitArgs := cmd.Args[4+opts.LimitArgIndex:]
+		limitArgs[1] = []byte("0")
+		if opts.Limit >= 0 {
+			limitArgs[2] = []byte(strconv.Itoa(opts.Offset + opts.Limit))
+		}
+	}
+	var postCmd string
+	if len(opts.PostArgs) > 0 {
+		postCmd = string(bytes.ToLower(opts.PostArgs[0]))
+		if !isValidPostSearchCmd(postCmd) {
 			conn.WriteError(common.ErrInvalidArgs.Error())
 			return
 		}
-		origOffset = offset
-		args[1] = []byte("0")
 	}
-	_ = origOffset
 
 	_, result, err := s.dispatchAndWaitMergeCmd(cmd)
 	if err != nil {
@@ -48,8 +60,8 @@ func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
 		return
 	}
 
-	// TODO: maybe sort search results by field from all partitions
 	hsetResults := make([]common.HIndexRespWithValues, 0)
+	partRets := make(map[int][]common.HIndexRespWithValues, len(result))
 	var table string
 	for _, res := range result {
 		if err, ok := res.(error); ok {
@@ -70,6 +82,32 @@ func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
 			return
 		}
 		hsetResults = append(hsetResults, realRes.Rets...)
+		partRets[realRes.Partition] = realRes.Rets
+	}
+	cursor := opts.Cursor
+	if opts.OrderField != nil {
+		if cursor == nil {
+			cursor = &common.IndexSearchCursor{OrderField: string(opts.OrderField), Desc: opts.Desc}
+		}
+		hsetResults = common.MergeOrderedIndexSearch(partRets, cursor, opts.Offset, opts.Limit)
+	} else {
+		if opts.Offset >= len(hsetResults) {
+			hsetResults = hsetResults[:0]
+		} else {
+			hsetResults = hsetResults[opts.Offset:]
+		}
+		if opts.Limit >= 0 && len(hsetResults) > opts.Limit {
+			hsetResults = hsetResults[:opts.Limit]
+		}
+	}
+	if opts.Cursor != nil {
+		conn.WriteArray(2)
+		if opts.Limit < 0 || len(hsetResults) < opts.Limit {
+			// all the partitions have no more results
+			conn.WriteBulkString(common.IndexSearchCursorStart)
+		} else {
+			conn.WriteBulkString(cursor.Encode())
+		}
 	}
 	if postCmd != "" {
 		conn.WriteArray(len(hsetResults) * 3)
@@ -111,3 +149,47 @@ func (s *Server) doMergeIndexSearch(conn redcon.Conn, cmd redcon.Command) {
 		}
 	}
 }
+
+// HIDX.FROM ns:table where "field1 > 1" AGG COUNT * SUM field2 MAX field2
+// the reply is the array of the aggregation results in the same order of the functions.
+func (s *Server) doMergeIndexAgg(conn redcon.Conn, cmd redcon.Command) {
+	_, result, err := s.dispatchAndWaitMergeCmd(cmd)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	var aggs []rockredis.ColumnAggregation
+	var values []rockredis.ColumnAggValue
+	for _, res := range result {
+		if err, ok := res.(error); ok {
+			conn.WriteError(err.Error() + " : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+		realRes, ok := res.(*node.HindexAggResults)
+		if !ok {
+			sLog.Infof("invalid response for index aggregate : %v, cmd: %v", res, string(cmd.Raw))
+			conn.WriteError(errInvalidResponse.Error())
+			return
+		}
+		aggs = realRes.Aggs
+		if values == nil {
+			values = make([]rockredis.ColumnAggValue, len(realRes.Values))
+		}
+		for i := range realRes.Values {
+			values[i].Merge(realRes.Values[i])
+		}
+	}
+	conn.WriteArray(len(aggs))
+	for i, agg := range aggs {
+		if agg.Func == rockredis.ColumnAggCount {
+			conn.WriteInt64(values[i].Count)
+			continue
+		}
+		v, ok := values[i].Result(agg.Func)
+		if !ok {
+			conn.WriteNull()
+		} else {
+			conn.WriteBulkString(strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+}
@@ -15,7 +15,6 @@ import (
 
 	_ "net/http/pprof"
 
-	"github.com/spaolacci/murmur3"
 	"github.com/youzan/ZanRedisDB/engine"
 	"github.com/youzan/ZanRedisDB/slow"
 
@@ -26,6 +25,7 @@ import (
 	"github.com/youzan/ZanRedisDB/common"
 	"github.com/youzan/ZanRedisDB/metric"
 	"github.com/youzan/ZanRedisDB/node"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
 	"github.com/youzan/ZanRedisDB/pkg/types"
 	"github.com/youzan/ZanRedisDB/raft"
 	"github.com/youzan/ZanRedisDB/raft/raftpb"
@@ -36,6 +36,8 @@ import (
 
 var (
 	errRaftGroupNotReady = errors.New("raft group not ready")
+	errCrossPartition    = errors.New("CROSSSLOT keys in request don't hash to the same partition")
+	errInvalidResponse   = errors.New("invalid response")
 )
 
 const (
@@ -202,6 +204,11 @@ func NewServer(conf ServerConfig) (*Server, error) {
 			mconf.WALRocksDBSharedConfig = sc
 		}
 	}
+	km, err := encryption.NewKeyManager(conf.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	mconf.KeyManager = km
 	s.nsMgr = node.NewNamespaceMgr(s.raftTransport, mconf)
 	myNode.RegID = mconf.NodeID
 
@@ -448,7 +455,7 @@ func (s *Server) Start() {
 	}
 }
 
-func GetPKAndHashSum(cmdName string, cmd redcon.Command) (string, []byte, int, error) {
+func (s *Server) GetPKAndHashSum(cmdName string, cmd redcon.Command) (string, []byte, int, error) {
 	if len(cmd.Args) < 2 {
 		return "", nil, 0, common.ErrInvalidArgs
 	}
@@ -458,7 +465,7 @@ func GetPKAndHashSum(cmdName string, cmd redcon.Command) (string, []byte, int, e
 	if err != nil {
 		return namespace, nil, 0, err
 	}
-	pkSum := int(murmur3.Sum32(pk))
+	pkSum := s.nsMgr.GetPrimaryKeySum(namespace, pk)
 	return namespace, pk, pkSum, nil
 }
 
@@ -476,9 +483,61 @@ func (s *Server) GetHandleNode(ns string, pk []byte, pkSum int, cmdName string,
 	if n.Node.IsStopping() {
 		return nil, common.ErrStopped
 	}
+	if cmdName == "geosearchstore" && len(cmd.Args) > 2 {
+		// the source key should be in the same partition with the destination
+		err = s.checkSamePartition(ns, n, cmd.Args[2])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cmdName == "cms.merge" && len(cmd.Args) > 3 {
+		// cms.merge dest numkeys src [src ...] [WEIGHTS ...]
+		num, err := strconv.Atoi(string(cmd.Args[2]))
+		if err != nil || num <= 0 || num > len(cmd.Args)-3 {
+			return nil, common.ErrInvalidArgs
+		}
+		for _, src := range cmd.Args[3 : 3+num] {
+			if err := s.checkSamePartition(ns, n, src); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if (cmdName == "ts.createrule" || cmdName == "ts.deleterule") && len(cmd.Args) > 2 {
+		// the destination should be in the same partition with the source
+		err = s.checkSamePartition(ns, n, cmd.Args[2])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cmdName == "ts.madd" {
+		// ts.madd key timestamp value [key timestamp value ...]
+		for i := 4; i < len(cmd.Args); i += 3 {
+			if err := s.checkSamePartition(ns, n, cmd.Args[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return n.Node, nil
 }
 
+func (s *Server) checkSamePartition(ns string, n *node.NamespaceNode, rawKey []byte) error {
+	keyNs, pk, err := common.ExtractNamesapce(rawKey)
+	if err != nil {
+		return err
+	}
+	if keyNs != ns {
+		return errCrossPartition
+	}
+	other, err := s.nsMgr.GetNamespaceNodeWithPrimaryKey(ns, pk)
+	if err != nil {
+		return err
+	}
+	if other != n {
+		return errCrossPartition
+	}
+	return nil
+}
+
 func isAllowStaleReadCmd(cmdName string) bool {
 	if strings.HasPrefix(cmdName, "stale.") {
 		return true
@@ -726,6 +785,11 @@ func (s *Server) handleRedisWrite(cmdName string, kvn *node.KVNode,
 		for _, d := range rv {
 			conn.WriteBulk(d)
 		}
+	case []int64:
+		conn.WriteArray(len(rv))
+		for _, d := range rv {
+			conn.WriteInt64(d)
+		}
 	default:
 		// Do we have any other resp arrays for write command which is not [][]byte?
 		conn.WriteError("Invalid response type")
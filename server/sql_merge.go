@@ -0,0 +1,66 @@
+package server
+
+import (
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+)
+
+// SQL "SELECT {* | field [, field ...]} FROM namespace.table [WHERE {WHERE clause}]
+// [ORDER BY field [ASC|DESC]] [LIMIT [offset,] num]"
+// the query is pushed down to all the partitions of the namespace and the rows are merged here.
+// Each row in the reply is the key followed by the values of the selected fields, or followed by
+// the field value pairs if all the fields are selected.
+func (s *Server) doMergeSQL(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) != 2 {
+		conn.WriteError(common.ErrInvalidArgs.Error())
+		return
+	}
+	query, err := common.ParseSQLSelect(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	sLog.Debugf("sql query: %v", string(cmd.Args[1]))
+	// the namespace is needed to find the partitions of the namespace
+	partCmd := common.BuildCommand([][]byte{cmd.Args[0],
+		[]byte(query.Namespace + ":" + query.Table), cmd.Args[1]})
+	_, result, err := s.dispatchAndWaitMergeCmd(partCmd)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	partRows := make([][]common.SQLRow, 0, len(result))
+	for _, res := range result {
+		if err, ok := res.(error); ok {
+			conn.WriteError(err.Error() + " : Err handle command " + string(cmd.Args[0]))
+			return
+		}
+		realRes, ok := res.(*node.SQLQueryResults)
+		if !ok {
+			sLog.Infof("invalid response for sql query : %v, cmd: %v", res, string(cmd.Raw))
+			conn.WriteError(errInvalidResponse.Error())
+			return
+		}
+		sLog.Debugf("sql query %v rows using plan %v", len(realRes.Rows), realRes.Plan)
+		partRows = append(partRows, realRes.Rows)
+	}
+	rows := common.MergeSQLRows(partRows, query.OrderField != nil, query.Desc, query.Offset, query.Limit)
+	table := query.Table
+	conn.WriteArray(len(rows))
+	for _, row := range rows {
+		conn.WriteArray(len(row.Values) + 1)
+		if len(row.PKey) > len(table) && string(row.PKey[:len(table)]) == table {
+			conn.WriteBulk(row.PKey[len(table)+1:])
+		} else {
+			conn.WriteBulk(row.PKey)
+		}
+		for _, v := range row.Values {
+			if v == nil {
+				conn.WriteNull()
+			} else {
+				conn.WriteBulk(v)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+
+	"github.com/absolute8511/redcon"
+	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/node"
+	"github.com/youzan/ZanRedisDB/rockredis"
+)
+
+// TS.MRANGE ns:table from to [COUNT count] [AGGREGATION type bucket] [WITHLABELS] FILTER filter...
+func (s *Server) doMergeTSRange(conn redcon.Conn, cmd redcon.Command) {
+	if len(cmd.Args) < 6 {
+		conn.WriteError(common.ErrInvalidArgs.Error())
+		return
+	}
+	ns, _, err := common.ExtractNamesapce(cmd.Args[1])
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	_, result, err := s.dispatchAndWaitMergeCmd(cmd)
+	if err != nil {
+		conn.WriteError(err.Error())
+		return
+	}
+	withLabels := false
+	series := make([]rockredis.TSRangeResult, 0)
+	for _, res := range result {
+		if err, ok := res.(error); ok {
+			conn.WriteError(err.Error())
+			return
+		}
+		realRes, ok := res.(*node.TSMRangeResults)
+		if !ok {
+			sLog.Infof("invalid response for ts range : %v, cmd: %v", res, string(cmd.Raw))
+			conn.WriteError(errInvalidResponse.Error())
+			return
+		}
+		withLabels = realRes.WithLabels
+		series = append(series, realRes.Rets...)
+	}
+	// the series in different partitions should be sorted by key
+	sort.Slice(series, func(i, j int) bool {
+		return bytes.Compare(series[i].Key, series[j].Key) < 0
+	})
+	conn.WriteArray(len(series))
+	for _, ts := range series {
+		conn.WriteArray(3)
+		conn.WriteBulkString(ns + ":" + string(ts.Key))
+		if withLabels {
+			conn.WriteArray(len(ts.Labels))
+			for _, l := range ts.Labels {
+				conn.WriteArray(2)
+				conn.WriteBulkString(l.Name)
+				conn.WriteBulkString(l.Value)
+			}
+		} else {
+			conn.WriteArray(0)
+		}
+		conn.WriteArray(len(ts.Samples))
+		for _, sample := range ts.Samples {
+			conn.WriteArray(2)
+			conn.WriteInt64(sample.Ts)
+			conn.WriteBulkString(strconv.FormatFloat(sample.Value, 'f', -1, 64))
+		}
+	}
+}
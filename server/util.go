@@ -146,6 +146,25 @@ func parseCommand(raw []byte) (redcon.Command, error) {
 	return cmd, nil
 }
 
+// foldSubCommand converts the redis command with sub command (such as memory usage key)
+// to the command name with sub command (memory.usage key), so the key is always the
+// first argument and can be used to find the partition.
+func foldSubCommand(cmdName string, cmd redcon.Command) (string, redcon.Command) {
+	switch cmdName {
+	case "memory", "object":
+	default:
+		return cmdName, cmd
+	}
+	if len(cmd.Args) < 3 {
+		return cmdName, cmd
+	}
+	cmdName = cmdName + "." + strings.ToLower(string(cmd.Args[1]))
+	args := make([][]byte, 0, len(cmd.Args)-1)
+	args = append(args, []byte(cmdName))
+	args = append(args, cmd.Args[2:]...)
+	return cmdName, common.BuildCommand(args)
+}
+
 // qcmdlower for common optimized command lowercase conversions.
 func qcmdlower(n []byte) string {
 	switch len(n) {
@@ -34,6 +34,12 @@ else
     done
 fi
 
+# the default engine for rockredis tests is mem, run the tests for the other engines
+for eng in rocksdb pebble badger; do
+    echo "rockredis tests with engine $eng"
+    GOMAXPROCS=4 CGO_CFLAGS=${CGO_CFLAGS} CGO_LDFLAGS=${CGO_LDFLAGS} go test -timeout 1500s ./rockredis -args -engine_type=$eng
+done
+
 # no tests, but a build is something
 for dir in $(find apps tools -maxdepth 1 -type d) ; do
     if grep -q '^package main$' $dir/*.go 2>/dev/null; then
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/youzan/ZanRedisDB/common"
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
 	"github.com/youzan/ZanRedisDB/pkg/fileutil"
 	"github.com/youzan/ZanRedisDB/pkg/pbutil"
 	"github.com/youzan/ZanRedisDB/raft"
@@ -63,9 +64,16 @@ var (
 	ErrSliceOutOfRange              = errors.New("wal: slice bounds out of range")
 	ErrMaxWALEntrySizeLimitExceeded = errors.New("wal: max entry size limit exceeded")
 	ErrDecoderNotFound              = errors.New("wal: decoder not found")
+	ErrNoCipher                     = errors.New("wal: no cipher to decrypt the entry")
 	crcTable                        = crc32.MakeTable(crc32.Castagnoli)
 )
 
+// Cipher encrypts the raft entries saved in the wal
+type Cipher interface {
+	Encrypt(plain []byte, ad []byte) ([]byte, error)
+	Decrypt(data []byte, ad []byte) ([]byte, error)
+}
+
 // WAL is a logical representation of the stable storage.
 // WAL is either in read mode or append mode but not both.
 // A newly created WAL is in append mode, and ready for appending records.
@@ -92,6 +100,8 @@ type WAL struct {
 	fp             *filePipeline
 	optimizedFsync bool
 	buf            []byte
+	// encrypt the entries if not nil
+	cipher Cipher
 }
 
 // Create creates a WAL ready for appending records. The given metadata is
@@ -371,7 +381,12 @@ func (w *WAL) ReadAll() (metadata []byte, state raftpb.HardState, ents []raftpb.
 	for err = decoder.decode(rec); err == nil; err = decoder.decode(rec) {
 		switch rec.Type {
 		case entryType:
-			e := mustUnmarshalEntry(rec.Data)
+			data, derr := w.decryptEntry(rec.Data)
+			if derr != nil {
+				state.Reset()
+				return nil, state, nil, derr
+			}
+			e := mustUnmarshalEntry(data)
 			if e.Index > w.start.Index {
 				up := e.Index - w.start.Index - 1
 				if up > uint64(len(ents)) {
@@ -804,6 +819,13 @@ func (w *WAL) saveEntry(e *raftpb.Entry) error {
 		data = w.buf[:n]
 	}
 
+	if w.cipher != nil {
+		var err error
+		data, err = w.cipher.Encrypt(data, nil)
+		if err != nil {
+			return err
+		}
+	}
 	rec := &walpb.Record{Type: entryType, Data: data}
 	if err := w.encoder.encode(rec); err != nil {
 		return err
@@ -812,6 +834,24 @@ func (w *WAL) saveEntry(e *raftpb.Entry) error {
 	return nil
 }
 
+// SetCipher set the cipher to encrypt the new entries and decrypt the encrypted entries
+// while reading, should be called before ReadAll.
+func (w *WAL) SetCipher(c Cipher) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cipher = c
+}
+
+func (w *WAL) decryptEntry(data []byte) ([]byte, error) {
+	if !encryption.IsEncrypted(data) {
+		return data, nil
+	}
+	if w.cipher == nil {
+		return nil, ErrNoCipher
+	}
+	return w.cipher.Decrypt(data, nil)
+}
+
 func (w *WAL) saveState(s *raftpb.HardState) error {
 	if raft.IsEmptyHardState(*s) {
 		return nil
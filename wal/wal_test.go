@@ -27,6 +27,7 @@ import (
 	"regexp"
 	"testing"
 
+	"github.com/youzan/ZanRedisDB/pkg/encryption"
 	"github.com/youzan/ZanRedisDB/pkg/fileutil"
 	"github.com/youzan/ZanRedisDB/pkg/pbutil"
 	"github.com/youzan/ZanRedisDB/raft/raftpb"
@@ -442,6 +443,80 @@ func TestRecover(t *testing.T) {
 	w.Close()
 }
 
+func TestRecoverEncrypted(t *testing.T) {
+	p, err := ioutil.TempDir(os.TempDir(), "waltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(p)
+
+	keyFile := filepath.Join(p, "master.key")
+	if err = ioutil.WriteFile(keyFile, bytes.Repeat([]byte("ab"), 32), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mk, err := encryption.LoadFileMasterKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := encryption.NewKeyManagerWithMasterKey(mk, 0).OpenKeyStore(filepath.Join(p, "wal.keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walDir := filepath.Join(p, "wal")
+	w, err := Create(walDir, []byte("metadata"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the entries saved before the cipher set are not encrypted
+	ents := []raftpb.Entry{{Index: 1, Term: 1, Data: []byte("plain")}}
+	if err = w.Save(raftpb.HardState{}, ents); err != nil {
+		t.Fatal(err)
+	}
+	w.SetCipher(ks)
+	encEnts := []raftpb.Entry{{Index: 2, Term: 1, Data: []byte("secret")}, {Index: 3, Term: 2, Data: []byte("secret")}}
+	if err = w.Save(raftpb.HardState{}, encEnts); err != nil {
+		t.Fatal(err)
+	}
+	ents = append(ents, encEnts...)
+	w.Close()
+
+	names, err := readWALNames(walDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		d, err := ioutil.ReadFile(filepath.Join(walDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(d, []byte("secret")) {
+			t.Errorf("the entry data should be encrypted in %v", name)
+		}
+	}
+
+	if w, err = Open(walDir, walpb.Snapshot{}, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = w.ReadAll(); err != ErrNoCipher {
+		t.Errorf("err = %v, want %v", err, ErrNoCipher)
+	}
+	w.Close()
+
+	if w, err = Open(walDir, walpb.Snapshot{}, true); err != nil {
+		t.Fatal(err)
+	}
+	w.SetCipher(ks)
+	_, _, entries, err := w.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, ents) {
+		t.Errorf("ents = %+v, want %+v", entries, ents)
+	}
+	w.Close()
+}
+
 func TestSearchIndex(t *testing.T) {
 	tests := []struct {
 		names []string